@@ -0,0 +1,114 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Ngc type checks Neugram programs and translates them to Go, so
+// they can be compiled by the go command.
+//
+// Usage:
+//
+//	ngc [-o file] [-pkg name] [-nolines] file.ng...
+//
+// The Go source of file.ng is written to file_ng.go, or to the file
+// given by -o when there is one program. It is derived from the
+// program alone, so running ngc again on the same program writes
+// the same source.
+//
+// The package is named by -pkg, or by $GOPACKAGE when ngc is run by
+// go generate, or by the package clause of the program, or is main.
+// A program is usually translated by a directive in a Go file of
+// the package:
+//
+//	//go:generate ngc file.ng
+//
+// Each declaration and statement of the source is preceded by a
+// //line directive giving its position in the program, so compile
+// errors and panics refer to the Neugram source. With -nolines,
+// the directives are left out.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"neugram.io/ng/gengo"
+)
+
+var (
+	flagOut     = flag.String("o", "", "write the source to `file`")
+	flagPkg     = flag.String("pkg", "", "name of the generated package")
+	flagNoLines = flag.Bool("nolines", false, "leave out //line directives")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ngc [flags] file.ng...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *flagOut != "" && flag.NArg() > 1 {
+		flag.Usage()
+	}
+
+	pkg := *flagPkg
+	if pkg == "" {
+		pkg = os.Getenv("GOPACKAGE")
+	}
+	failed := false
+	for _, file := range flag.Args() {
+		out := *flagOut
+		if out == "" {
+			out = strings.TrimSuffix(file, ".ng") + "_ng.go"
+		}
+		if err := compile(file, out, pkg); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// compile writes the Go source of the program file to out.
+func compile(file, out, pkg string) error {
+	cfg := gengo.Config{Package: pkg}
+	if !*flagNoLines {
+		name, err := lineFile(file, out)
+		if err != nil {
+			return fmt.Errorf("ngc: %v", err)
+		}
+		cfg.LineFile = name
+	}
+	src, err := gengo.GenGo(file, cfg)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out, src, 0666); err != nil {
+		return fmt.Errorf("ngc: %v", err)
+	}
+	return nil
+}
+
+// lineFile returns the name of the program file in the //line
+// directives of out. The Go compiler resolves a relative name from
+// the directory of out, so the name is relative to it if it can be.
+func lineFile(file, out string) (string, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(filepath.Dir(absOut), absFile); err == nil {
+		return filepath.ToSlash(rel), nil
+	}
+	return absFile, nil
+}
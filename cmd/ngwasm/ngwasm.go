@@ -0,0 +1,123 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js,wasm
+
+// Ngwasm runs the Neugram evaluator in a JavaScript host, such as a
+// browser playground. It is built with
+//
+//	GOOS=js GOARCH=wasm go build -o ng.wasm neugram.io/ng/cmd/ngwasm
+//
+// and run by wasm_exec.js from the Go distribution. It defines the
+// global object neugram:
+//
+//	const s = neugram.open({steps: 1e6});
+//	const r = neugram.eval(s, 'x := 6\nprint("hi")\nx * 7');
+//	// r.values is ["42"], r.output is "hi\n", r.error is null
+//	neugram.close(s);
+//
+// neugram.open starts a session, a program with its own variables,
+// and returns its id. Its optional argument limits the resources of
+// the program, with the fields steps, callDepth, and cells, as
+// eval.Limits does. A program in a browser runs on the page's only
+// thread, so a limit on steps stops a program that does not end.
+//
+// neugram.eval evaluates Neugram source in a session. Its result has
+// the values of the last statement if it is an expression, formatted
+// as by print, the output printed since the last eval, and the error
+// message if the evaluation failed.
+//
+// neugram.close ends a session.
+//
+// Shell commands report an error. Go packages cannot be imported, as
+// the type checker reads them from a Go installation.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"syscall/js"
+
+	"neugram.io/ng/eval"
+)
+
+// session is a program evaluated for the host.
+type session struct {
+	prg *eval.Program
+	out *bytes.Buffer
+}
+
+var (
+	sessions = make(map[int]*session)
+	lastID   int
+)
+
+func open(this js.Value, args []js.Value) interface{} {
+	var limits eval.Limits
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		limit := func(name string) int64 {
+			if v := args[0].Get(name); v.Type() == js.TypeNumber {
+				return int64(v.Float())
+			}
+			return 0
+		}
+		limits.Steps = limit("steps")
+		limits.CallDepth = limit("callDepth")
+		limits.Cells = limit("cells")
+	}
+	out := new(bytes.Buffer)
+	lastID++
+	sessions[lastID] = &session{
+		prg: eval.New(eval.Options{Stdout: out, Limits: limits}),
+		out: out,
+	}
+	return lastID
+}
+
+func evalSrc(this js.Value, args []js.Value) interface{} {
+	res := map[string]interface{}{
+		"values": []interface{}{},
+		"output": "",
+		"error":  nil,
+	}
+	if len(args) != 2 {
+		res["error"] = "neugram.eval: want session and source arguments"
+		return res
+	}
+	s := sessions[args[0].Int()]
+	if s == nil {
+		res["error"] = fmt.Sprintf("neugram.eval: no session %d", args[0].Int())
+		return res
+	}
+	vals, err := s.prg.Eval(args[1].String())
+	var values []interface{}
+	for _, v := range vals {
+		values = append(values, fmt.Sprint(v))
+	}
+	if values != nil {
+		res["values"] = values
+	}
+	res["output"] = s.out.String()
+	s.out.Reset()
+	if err != nil {
+		res["error"] = err.Error()
+	}
+	return res
+}
+
+func closeSession(this js.Value, args []js.Value) interface{} {
+	if len(args) > 0 {
+		delete(sessions, args[0].Int())
+	}
+	return nil
+}
+
+func main() {
+	js.Global().Set("neugram", js.ValueOf(map[string]interface{}{
+		"open":  js.FuncOf(open),
+		"eval":  js.FuncOf(evalSrc),
+		"close": js.FuncOf(closeSession),
+	}))
+	select {} // serve calls until the page goes away
+}
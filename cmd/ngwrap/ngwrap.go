@@ -0,0 +1,67 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Ngwrap generates an eval.Package for a Go package, so Neugram
+// programs can import it.
+//
+// Usage:
+//
+//	ngwrap [-o file] [-pkg name] [-register] [-v] importpath
+//
+// The source is written to standard output, or to the file given
+// by -o. The package is named ng followed by the name of the
+// wrapped package, or by -pkg. With -register, the generated
+// package registers itself with eval.Register when it is
+// imported. With -v, ngwrap lists the members it left out.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"neugram.io/ng/eval/gowrap/ngwrap"
+)
+
+var (
+	flagOut      = flag.String("o", "", "write the source to `file`")
+	flagPkg      = flag.String("pkg", "", "name of the generated package")
+	flagRegister = flag.Bool("register", false, "register the package with eval.Register")
+	flagVerbose  = flag.Bool("v", false, "list the members left out")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ngwrap [flags] importpath\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+	}
+
+	src, skipped, err := ngwrap.GenGo(flag.Arg(0), ngwrap.Config{
+		Package:  *flagPkg,
+		Register: *flagRegister,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if *flagVerbose {
+		for _, name := range skipped {
+			fmt.Fprintf(os.Stderr, "ngwrap: left out %s\n", name)
+		}
+	}
+	if *flagOut == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*flagOut, src, 0666); err != nil {
+		fmt.Fprintf(os.Stderr, "ngwrap: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+)
+
+// A Client is a connection to a daemon. Its methods may be called
+// concurrently.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the daemon at the TCP address addr.
+func Dial(addr string) (*Client, error) {
+	c, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: c}, nil
+}
+
+// Close closes the connection. Its sessions stay open.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// Open starts a session of a program taken to be in the file path.
+func (c *Client) Open(path string) (*Session, error) {
+	var reply OpenReply
+	if err := c.rpc.Call("Ng.Open", OpenArgs{Path: path}, &reply); err != nil {
+		return nil, err
+	}
+	return &Session{c: c, ID: reply.Session}, nil
+}
+
+// Session returns the open session id, as started by Open on this
+// or another connection.
+func (c *Client) Session(id string) *Session {
+	return &Session{c: c, ID: id}
+}
+
+// A Session is a program evaluated by a daemon.
+type Session struct {
+	c  *Client
+	ID string
+
+	mu     sync.Mutex
+	offset int64 // of the output read
+}
+
+// Eval evaluates the Neugram source src, and returns the values of
+// its last statement, formatted as by print.
+func (s *Session) Eval(src string) ([]string, error) {
+	var reply EvalReply
+	if err := s.c.rpc.Call("Ng.Eval", EvalArgs{Session: s.ID, Src: src}, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Values, nil
+}
+
+// Output returns the output printed by the session since the last
+// call of Output. If there is none, it waits up to wait for some.
+func (s *Session) Output(wait time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reply OutputReply
+	args := OutputArgs{Session: s.ID, Offset: s.offset, WaitMillis: int(wait / time.Millisecond)}
+	if err := s.c.rpc.Call("Ng.Output", args, &reply); err != nil {
+		return "", err
+	}
+	s.offset = reply.Offset
+	return reply.Data, nil
+}
+
+// Get returns the value of the variable or constant name.
+func (s *Session) Get(name string) (*GetReply, error) {
+	reply := new(GetReply)
+	if err := s.c.rpc.Call("Ng.Get", GetArgs{Session: s.ID, Name: name}, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Close ends the session.
+func (s *Session) Close() error {
+	return s.c.rpc.Call("Ng.Close", CloseArgs{Session: s.ID}, new(CloseReply))
+}
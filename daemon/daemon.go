@@ -0,0 +1,343 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package daemon serves Neugram sessions to remote clients, so many
+// thin clients can share one machine running the evaluator.
+//
+// The protocol is JSON-RPC 1.0, as implemented by net/rpc/jsonrpc,
+// over a TCP connection. The service is named Ng and has the methods
+//
+//	Ng.Open(OpenArgs) OpenReply      starts a session
+//	Ng.Eval(EvalArgs) EvalReply      evaluates statements
+//	Ng.Output(OutputArgs) OutputReply reads the output of print
+//	Ng.Get(GetArgs) GetReply         fetches the value of a variable
+//	Ng.Close(CloseArgs) CloseReply   ends a session
+//
+// Each session has its own program, with its own variables, and
+// lasts until it is closed, whichever connection uses it. A session
+// evaluates one Eval at a time. A goroutine of a session that
+// panics, or exceeds the server's limits, ends no other session:
+// its error is returned by the next Eval of its own session.
+//
+// The output of print, println, and printf is kept by the session
+// until it is read. Ng.Output waits for output, so a client streams
+// the output of a running Eval by calling Ng.Output on another
+// request while it waits for the Eval. Output written by shell
+// commands and by Go packages goes to the daemon's own standard
+// output.
+//
+// A session runs any program it is given, including shell commands,
+// with the permissions of the daemon. The daemon has no
+// authentication, so it should only listen where every client is
+// trusted.
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+
+	"neugram.io/ng/eval"
+)
+
+// OpenArgs are the arguments of Ng.Open.
+type OpenArgs struct {
+	// Path is the file the program is taken to be in. Relative
+	// imports are found from its directory. It may be empty.
+	Path string
+}
+
+// OpenReply is the reply of Ng.Open.
+type OpenReply struct {
+	Session string // identifies the session in other calls
+}
+
+// EvalArgs are the arguments of Ng.Eval.
+type EvalArgs struct {
+	Session string
+	Src     string // Neugram source of one or more statements
+}
+
+// EvalReply is the reply of Ng.Eval.
+type EvalReply struct {
+	// Values are the values of the last statement, if it is an
+	// expression, formatted as by print.
+	Values []string
+}
+
+// OutputArgs are the arguments of Ng.Output.
+type OutputArgs struct {
+	Session string
+
+	// Offset is the number of bytes of output already read. The
+	// output before it is discarded.
+	Offset int64
+
+	// WaitMillis is how long to wait, in milliseconds, for output
+	// if there is none after Offset. It is at most a minute.
+	WaitMillis int
+}
+
+// OutputReply is the reply of Ng.Output.
+type OutputReply struct {
+	Data   string
+	Offset int64 // Offset of the output after Data
+}
+
+// GetArgs are the arguments of Ng.Get.
+type GetArgs struct {
+	Session string
+	Name    string // variable or constant
+}
+
+// GetReply is the reply of Ng.Get.
+type GetReply struct {
+	Text string          // the value, formatted as by print
+	JSON json.RawMessage // the value as JSON, or null if it has none
+}
+
+// CloseArgs are the arguments of Ng.Close.
+type CloseArgs struct {
+	Session string
+}
+
+// CloseReply is the reply of Ng.Close.
+type CloseReply struct{}
+
+// maxWait bounds the wait of Ng.Output.
+const maxWait = time.Minute
+
+// A Server serves sessions.
+type Server struct {
+	// Limits bounds the resources of each session.
+	Limits eval.Limits
+
+	// ErrorLog logs errors accepting connections. If nil, they are
+	// logged by the log package.
+	ErrorLog *log.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// ListenAndServe listens on the TCP address addr and serves
+// sessions to the clients that connect.
+func ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return new(Server).Serve(l)
+}
+
+// Serve serves the connections accepted by l. It returns when
+// accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Ng", &service{s}); err != nil {
+		return err
+	}
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				s.logf("daemon: accept: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (s *Server) session(id string) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[id]
+	if sess == nil {
+		return nil, fmt.Errorf("daemon: no session %q", id)
+	}
+	return sess, nil
+}
+
+// A session is a program evaluated for a client.
+type session struct {
+	prg *eval.Program
+	out *output
+}
+
+// service implements the methods of the Ng service.
+type service struct {
+	s *Server
+}
+
+func (svc *service) Open(args OpenArgs, reply *OpenReply) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("daemon: session id: %v", err)
+	}
+	id := hex.EncodeToString(b)
+	out := newOutput()
+	sess := &session{
+		prg: eval.New(eval.Options{Path: args.Path, Stdout: out, Limits: svc.s.Limits}),
+		out: out,
+	}
+	svc.s.mu.Lock()
+	if svc.s.sessions == nil {
+		svc.s.sessions = make(map[string]*session)
+	}
+	svc.s.sessions[id] = sess
+	svc.s.mu.Unlock()
+	reply.Session = id
+	return nil
+}
+
+func (svc *service) Eval(args EvalArgs, reply *EvalReply) error {
+	sess, err := svc.s.session(args.Session)
+	if err != nil {
+		return err
+	}
+	vals, err := sess.prg.Eval(args.Src)
+	if err != nil {
+		return err
+	}
+	for _, v := range vals {
+		reply.Values = append(reply.Values, fmt.Sprint(v))
+	}
+	return nil
+}
+
+func (svc *service) Output(args OutputArgs, reply *OutputReply) error {
+	sess, err := svc.s.session(args.Session)
+	if err != nil {
+		return err
+	}
+	wait := time.Duration(args.WaitMillis) * time.Millisecond
+	if wait > maxWait {
+		wait = maxWait
+	}
+	data, offset, err := sess.out.read(args.Offset, wait)
+	if err != nil {
+		return err
+	}
+	reply.Data = string(data)
+	reply.Offset = offset
+	return nil
+}
+
+func (svc *service) Get(args GetArgs, reply *GetReply) error {
+	sess, err := svc.s.session(args.Session)
+	if err != nil {
+		return err
+	}
+	v, ok := sess.prg.Get(args.Name)
+	if !ok {
+		return fmt.Errorf("daemon: no variable %s", args.Name)
+	}
+	reply.Text = fmt.Sprint(v)
+	if b, err := json.Marshal(v); err == nil {
+		reply.JSON = b
+	} else {
+		reply.JSON = json.RawMessage("null")
+	}
+	return nil
+}
+
+func (svc *service) Close(args CloseArgs, reply *CloseReply) error {
+	svc.s.mu.Lock()
+	sess := svc.s.sessions[args.Session]
+	delete(svc.s.sessions, args.Session)
+	svc.s.mu.Unlock()
+	if sess == nil {
+		return fmt.Errorf("daemon: no session %q", args.Session)
+	}
+	sess.out.close()
+	return nil
+}
+
+// output holds the output of a session until it is read.
+type output struct {
+	mu      sync.Mutex
+	buf     []byte
+	start   int64         // offset of buf[0]
+	changed chan struct{} // closed when buf grows or the output is closed
+	closed  bool
+}
+
+func newOutput() *output {
+	return &output{changed: make(chan struct{})}
+}
+
+func (o *output) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return 0, fmt.Errorf("daemon: session closed")
+	}
+	o.buf = append(o.buf, b...)
+	close(o.changed)
+	o.changed = make(chan struct{})
+	return len(b), nil
+}
+
+// read discards the output before offset, and returns the output
+// after it. If there is none, it waits up to wait for some.
+func (o *output) read(offset int64, wait time.Duration) ([]byte, int64, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		o.mu.Lock()
+		end := o.start + int64(len(o.buf))
+		if offset < o.start || offset > end {
+			o.mu.Unlock()
+			return nil, 0, fmt.Errorf("daemon: output offset %d not in [%d, %d]", offset, o.start, end)
+		}
+		o.buf = append([]byte(nil), o.buf[offset-o.start:]...)
+		o.start = offset
+		if len(o.buf) > 0 || o.closed || wait <= 0 {
+			data := append([]byte(nil), o.buf...)
+			o.mu.Unlock()
+			return data, end, nil
+		}
+		changed := o.changed
+		o.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			wait = 0
+		}
+	}
+}
+
+func (o *output) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(o.changed)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, srv *Server) *Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSessions(t *testing.T) {
+	c := serve(t, new(Server))
+	defer c.Close()
+
+	s1, err := c.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals, err := s1.Eval("x := 6\ny := []int{1, 2}\nx * 7"); err != nil || len(vals) != 1 || vals[0] != "42" {
+		t.Errorf("Eval = %q, %v, want [42]", vals, err)
+	}
+	if _, err := s2.Eval("x"); err == nil {
+		t.Error("x of one session is defined in another")
+	}
+	if _, err := s1.Eval("x := "); err == nil {
+		t.Error("Eval of a partial statement succeeded")
+	}
+
+	got, err := s1.Get("y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "[1 2]" || string(got.JSON) != "[1,2]" {
+		t.Errorf("Get(y) = %q, %s, want [1 2], [1,2]", got.Text, got.JSON)
+	}
+	if _, err := s1.Get("z"); err == nil {
+		t.Error("Get of an undefined variable succeeded")
+	}
+
+	if err := s1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s1.Eval("1"); err == nil {
+		t.Error("Eval in a closed session succeeded")
+	}
+	if err := s1.Close(); err == nil {
+		t.Error("second Close succeeded")
+	}
+	if vals, err := s2.Eval("1 + 1"); err != nil || len(vals) != 1 || vals[0] != "2" {
+		t.Errorf("Eval after closing another session = %q, %v, want [2]", vals, err)
+	}
+}
+
+func TestSessionPanic(t *testing.T) {
+	c := serve(t, new(Server))
+	defer c.Close()
+
+	s1, err := c.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s1.Eval(`go func() { panic("boom") }()`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err = s1.Eval("1")
+	}
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Eval after the goroutine panicked: %v, want boom", err)
+	}
+	if vals, err := s2.Eval("2 * 3"); err != nil || len(vals) != 1 || vals[0] != "6" {
+		t.Errorf("Eval in another session = %q, %v, want [6]", vals, err)
+	}
+	if vals, err := s1.Eval("1 + 1"); err != nil || len(vals) != 1 || vals[0] != "2" {
+		t.Errorf("Eval after the panic was reported = %q, %v, want [2]", vals, err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	srv := new(Server)
+	c := serve(t, srv)
+	defer c.Close()
+	s, err := c.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if out, err := s.Output(0); err != nil || out != "" {
+		t.Errorf("Output before printing = %q, %v, want nothing", out, err)
+	}
+
+	// The output of a running Eval streams to the session attached
+	// on another connection.
+	release := make(chan bool)
+	sess, err := srv.session(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.prg.RegisterFunc("wait", func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Eval("print(\"first\")\nwait()\nprint(\"second\")")
+		done <- err
+	}()
+	attached := c.Session(s.ID)
+	if out, err := attached.Output(10 * time.Second); err != nil || out != "first\n" {
+		t.Errorf("Output while running = %q, %v, want first", out, err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out, err := attached.Output(0); err != nil || out != "second\n" {
+		t.Errorf("Output after running = %q, %v, want second", out, err)
+	}
+	if out, err := attached.Output(10 * time.Millisecond); err != nil || out != "" {
+		t.Errorf("Output after reading all = %q, %v, want nothing", out, err)
+	}
+}
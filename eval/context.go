@@ -0,0 +1,95 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync/atomic"
+
+	"neugram.io/ng/stmt"
+)
+
+// Evaluation of a statement is canceled with a context.Context.
+// The frames of a Program, one for each function call, share the
+// context of the statement being evaluated, and check it at each
+// loop iteration, statement of a block, and function call.
+//
+// A canceled evaluation unwinds the evaluator with an interrupt
+// panic. It is not a Neugram panic: recover does not stop it and
+// deferred calls are not run, as when a Go program exits.
+//
+// Blocking operations, such as a channel receive, are not
+// interrupted.
+
+// ErrInterrupted is the error returned by EvalStmt when evaluation is
+// stopped by an interrupt signal.
+var ErrInterrupted = errors.New("interrupted")
+
+type interrupt struct {
+	err error
+}
+
+// evalContext holds the context of the statement being evaluated.
+type evalContext struct {
+	v atomic.Value // ctxBox
+}
+
+// ctxBox gives atomic.Value the consistent type it requires.
+type ctxBox struct {
+	ctx context.Context
+}
+
+func newEvalContext() *evalContext {
+	c := new(evalContext)
+	c.set(context.Background())
+	return c
+}
+
+func (c *evalContext) set(ctx context.Context) { c.v.Store(ctxBox{ctx}) }
+func (c *evalContext) get() context.Context    { return c.v.Load().(ctxBox).ctx }
+
+// checkInterrupt unwinds the evaluation if its context is done.
+func (p *Program) checkInterrupt() {
+	ctx := p.ctx.get()
+	select {
+	case <-ctx.Done():
+		panic(interrupt{err: ctx.Err()})
+	default:
+	}
+}
+
+// EvalStmt evaluates the statement s. If sigint is not nil, a signal
+// received on it stops evaluation, and EvalStmt returns ErrInterrupted.
+func (p *Program) EvalStmt(s stmt.Stmt, sigint <-chan os.Signal) (res []reflect.Value, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.goErr.take(); err != nil {
+		return nil, err
+	}
+	if sigint == nil {
+		return p.evalTop(context.Background(), s)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-sigint:
+			interrupted <- true
+			cancel()
+		case <-ctx.Done():
+			interrupted <- false
+		}
+	}()
+	res, err = p.evalTop(ctx, s)
+	cancel()
+	if <-interrupted && err == context.Canceled {
+		err = ErrInterrupted
+	}
+	return res, err
+}
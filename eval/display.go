@@ -0,0 +1,95 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// A program shows rich output, such as HTML and images, with the
+// native package display, which every Program can import:
+//
+//	import "display"
+//
+//	display.HTML("<b>done</b>")
+//	display.PNG(plot) // plot is a []byte holding a PNG image
+//
+// Each function calls the Display hook with its output. A host that
+// renders rich output, such as a notebook, installs one. Without a
+// Display hook, the output is printed to the program's output as
+// plain text: HTML, Markdown, and SVG as their source, and images
+// and other data as a note of their type and size.
+
+// A DisplayEvent is rich output displayed by the program.
+type DisplayEvent struct {
+	// Data is the output in one or more MIME types, such as
+	// "text/html" or "image/png", by type.
+	Data map[string][]byte
+
+	// ExecCount is the execution count of the Eval in progress,
+	// or of the last if a goroutine displays after it returns.
+	ExecCount int
+	Frame     *Frame
+}
+
+// ExecCount returns the number of calls of Eval and
+// EvalSourceContext so far. A notebook shows it beside a cell as
+// the cell's execution count.
+func (p *Program) ExecCount() int {
+	return int(atomic.LoadInt64(&p.execCount))
+}
+
+// display calls the Display hook, if there is one, for the output
+// data, and otherwise prints its plain text form.
+func (p *Program) display(data map[string][]byte) {
+	hook := p.hooks.get().Display
+	if hook == nil {
+		if text, ok := data["text/plain"]; ok {
+			fmt.Fprintf(p.stdout, "%s\n", text)
+		}
+		return
+	}
+	hook(DisplayEvent{
+		Data:      data,
+		ExecCount: p.ExecCount(),
+		Frame:     &Frame{p: p},
+	})
+}
+
+// displayPkg is the package display of a Program.
+type displayPkg struct {
+	p *Program
+}
+
+func (displayPkg) Path() string { return "display" }
+
+func (d displayPkg) Members() map[string]interface{} {
+	source := func(mime string) func(string) {
+		return func(src string) {
+			d.p.display(map[string][]byte{
+				mime:         []byte(src),
+				"text/plain": []byte(src),
+			})
+		}
+	}
+	data := func(mime string, b []byte) {
+		d.p.display(map[string][]byte{
+			mime:         append([]byte(nil), b...),
+			"text/plain": []byte(fmt.Sprintf("<%s, %d bytes>", mime, len(b))),
+		})
+	}
+	image := func(mime string) func([]byte) {
+		return func(img []byte) { data(mime, img) }
+	}
+	return map[string]interface{}{
+		"HTML":     source("text/html"),
+		"Markdown": source("text/markdown"),
+		"SVG":      source("image/svg+xml"),
+		"PNG":      image("image/png"),
+		"JPEG":     image("image/jpeg"),
+		"Data":     data, // of any MIME type
+	}
+}
@@ -0,0 +1,617 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"neugram.io/ng/eval/shell"
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/table"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/typecheck"
+)
+
+// A Go program hosts Neugram with New, Eval, Get, and Set:
+//
+//	p := eval.New(eval.Options{})
+//	if err := p.Set("x", 2); err != nil { ... }
+//	res, err := p.Eval("y := x * 21")
+//	y, ok := p.Get("y") // 42
+//
+// Values pass between Go and Neugram as the Go values the evaluator
+// holds them in:
+//
+//   - booleans, strings, and numbers of a sized Go type, such as
+//     int or float64, are the Go type of the same name.
+//   - integer and float are *big.Int and *big.Float. Get returns
+//     a copy.
+//   - untyped constants are their default type, as in Go, except
+//     that an integer constant too large for an int is a *big.Int.
+//   - slices, arrays, maps, channels, pointers, and functions are
+//     the Go type with the corresponding elements. A slice, map,
+//     channel, or pointer shares its memory with the program.
+//   - structs, including those of a methodik, are an unnamed Go
+//     struct type with the same fields. A methodik struct also has
+//     an embedded field for each method visible to Go.
+//   - interfaces are their dynamic value, and error is error.
+//   - tables are a *table.Table, which shares its rows with the
+//     program. A table made in Go has columns of any type.
+//
+// Set accepts a value of a Go type made of these. A defined Go type
+// is converted to its underlying type, so Set("d", time.Second)
+// makes d an int64, unless it was declared by DeclareType. Go
+// structs are mapped to Neugram structs as described in gotype.go.
+
+// Eval evaluates the Neugram source src, which may hold several
+// statements, and returns the values of the last, if it is an
+// expression. If a goroutine started by an earlier call ended in a
+// panic, Eval returns its error instead; see goroutine.go.
+func (p *Program) Eval(src string) ([]interface{}, error) {
+	return p.EvalSourceContext(context.Background(), src)
+}
+
+// EvalSourceContext is Eval with a context. If ctx is canceled, the
+// evaluation stops and EvalSourceContext returns ctx.Err().
+func (p *Program) EvalSourceContext(ctx context.Context, src string) ([]interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	atomic.AddInt64(&p.execCount, 1)
+	if err := p.goErr.take(); err != nil {
+		return nil, err
+	}
+	vals, err := p.evalSource(ctx, strings.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	var res []interface{}
+	for _, v := range vals {
+		res = append(res, goValue(v))
+	}
+	return res, nil
+}
+
+// evalSource evaluates the program read from r, and returns the
+// values of its last statement.
+func (p *Program) evalSource(ctx context.Context, r io.Reader) (res []reflect.Value, err error) {
+	prsr := parser.New(p.Types.Fset, p.Path, 0)
+	defer prsr.Close()
+	scanner := bufio.NewScanner(r)
+	state := parser.StateStmt
+	var src []byte // read so far, for the source of declarations
+	for scanner.Scan() {
+		src = append(append(src, scanner.Bytes()...), '\n')
+		r := prsr.ParseLine(scanner.Bytes())
+		if len(r.Errs) > 0 {
+			return nil, r.Errs[0]
+		}
+		state = r.State
+		for _, s := range r.Stmts {
+			before := p.Cur
+			if res, err = p.evalTop(ctx, s); err != nil {
+				return nil, err
+			}
+			if isDecl(s) {
+				start := p.Types.Fset.Position(s.Pos()).Offset
+				end := p.Types.Fset.Position(s.End()).Offset
+				p.journal = append(p.journal, decl{
+					src:    string(src[start:end]),
+					before: before,
+					after:  p.Cur,
+				})
+			}
+		}
+		for _, cmd := range r.Cmds {
+			res = nil
+			j := &shell.Job{
+				Cmd:    cmd,
+				Params: shellParams{p},
+				Stdin:  os.Stdin,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			}
+			if err := j.Start(); err != nil {
+				return nil, err
+			}
+			done, err := j.Wait()
+			if err != nil {
+				return nil, err
+			}
+			if !done {
+				break // TODO not right, instead we should just have one cmd, not Cmds here.
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("eval: %v", err)
+	}
+	if state == parser.StateStmtPartial || state == parser.StateCmdPartial {
+		return nil, fmt.Errorf("eval: %s ends in a partial statement", p.Path)
+	}
+	return res, nil
+}
+
+// goValue returns the value of v for a Go program.
+func goValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if x, ok := v.Interface().(UntypedInt); ok && (!x.IsInt64() || int64(int(x.Int64())) != x.Int64()) {
+		return new(big.Int).Set(x.Int)
+	}
+	switch x := promoteUntyped(v.Interface()).(type) {
+	case *big.Int:
+		if x == nil {
+			return x
+		}
+		return new(big.Int).Set(x)
+	case *big.Float:
+		if x == nil {
+			return x
+		}
+		return new(big.Float).Copy(x)
+	default:
+		return x
+	}
+}
+
+// Get returns the value of the variable or constant name, and
+// whether there is one.
+func (p *Program) Get(name string) (interface{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	obj := p.Types.Lookup(name)
+	if obj == nil || obj.Kind != typecheck.ObjVar && obj.Kind != typecheck.ObjConst {
+		return nil, false
+	}
+	if _, isBuiltin := obj.Type.(tipe.Builtin); isBuiltin {
+		return nil, false
+	}
+	res, err := p.evalTop(context.Background(), &stmt.Simple{Expr: &expr.Ident{Name: name}})
+	if err != nil || len(res) != 1 {
+		return nil, false
+	}
+	return goValue(res[0]), true
+}
+
+// GetInto stores the value of the variable or constant name in the
+// Go variable dst points to. Unlike Get, the Go type need not be
+// the one the evaluator holds the value in:
+//
+//   - integers convert to any Go integer or float type that can
+//     represent them, and floats to any float type.
+//   - slices and arrays convert to Go slices, and to arrays of the
+//     same length, element by element. Maps convert key by key.
+//   - structs, including methodik values, convert to Go structs
+//     field by field, by name. Every exported field of the Go
+//     struct must be present; other fields are ignored.
+//   - pointers convert to pointers to a new copy of what they
+//     point to, and interfaces by their dynamic value.
+//   - tables convert to a copy of the *table.Table, or to a slice
+//     of rows, each a slice or a struct whose fields are columns
+//     by name, ignoring case if no column has the exact name.
+//   - a Go interface{} receives the value Get returns.
+//
+// A value that does not fit dst is an error naming where in the
+// value the mismatch is, such as "rows[2].Name".
+func (p *Program) GetInto(name string, dst interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("eval: GetInto(%s): %T is not a non-nil pointer", name, dst)
+	}
+	obj := p.Types.Lookup(name)
+	if obj == nil || obj.Kind != typecheck.ObjVar && obj.Kind != typecheck.ObjConst {
+		return fmt.Errorf("eval: GetInto(%s): no such variable", name)
+	}
+	if _, isBuiltin := obj.Type.(tipe.Builtin); isBuiltin {
+		return fmt.Errorf("eval: GetInto(%s): no such variable", name)
+	}
+	res, err := p.evalTop(context.Background(), &stmt.Simple{Expr: &expr.Ident{Name: name}})
+	if err != nil {
+		return err
+	}
+	if len(res) != 1 {
+		return fmt.Errorf("eval: GetInto(%s): no value", name)
+	}
+	if err := extract(rv.Elem(), res[0], name); err != nil {
+		return fmt.Errorf("eval: GetInto: %v", err)
+	}
+	return nil
+}
+
+// extract stores src, a value held by the evaluator, in dst.
+// The path names src in errors.
+func extract(dst, src reflect.Value, path string) error {
+	if src.IsValid() && src.Kind() == reflect.Interface {
+		src = src.Elem()
+	}
+	if !src.IsValid() {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Interface {
+		v := reflect.ValueOf(goValue(src))
+		if !v.Type().AssignableTo(dst.Type()) {
+			return fmt.Errorf("cannot store %s (type %s) in a %s", path, v.Type(), dst.Type())
+		}
+		dst.Set(v)
+		return nil
+	}
+	switch src.Interface().(type) {
+	case UntypedInt, UntypedFloat, UntypedString, UntypedRune, UntypedBool, UntypedComplex:
+		src = reflect.ValueOf(goValue(src))
+	}
+	mismatch := func() error {
+		return fmt.Errorf("cannot store %s (type %s) in a %s", path, src.Type(), dst.Type())
+	}
+	overflow := func() error {
+		return fmt.Errorf("%s (%v) overflows %s", path, src.Interface(), dst.Type())
+	}
+
+	switch x := src.Interface().(type) {
+	case *table.Table:
+		return extractTable(dst, x, path)
+	case *big.Int:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !x.IsInt64() || dst.OverflowInt(x.Int64()) {
+				return overflow()
+			}
+			dst.SetInt(x.Int64())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if !x.IsUint64() || dst.OverflowUint(x.Uint64()) {
+				return overflow()
+			}
+			dst.SetUint(x.Uint64())
+		case reflect.Float32, reflect.Float64:
+			f, _ := new(big.Float).SetInt(x).Float64()
+			dst.SetFloat(f)
+		case reflect.Ptr:
+			if dst.Type() != bigIntType {
+				return mismatch()
+			}
+			dst.Set(src)
+		default:
+			return mismatch()
+		}
+		return nil
+	case *big.Float:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f, _ := x.Float64()
+			dst.SetFloat(f)
+		case reflect.Ptr:
+			if dst.Type() != bigFloatType {
+				return mismatch()
+			}
+			dst.Set(src)
+		default:
+			return mismatch()
+		}
+		return nil
+	}
+
+	switch src.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return extract(dst, reflect.ValueOf(big.NewInt(src.Int())), path)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return extract(dst, reflect.ValueOf(new(big.Int).SetUint64(src.Uint())), path)
+	case reflect.Float32, reflect.Float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(src.Float())
+			return nil
+		}
+		if dst.Type() == bigFloatType {
+			dst.Set(reflect.ValueOf(big.NewFloat(src.Float())))
+			return nil
+		}
+	case reflect.Bool, reflect.String, reflect.Complex64, reflect.Complex128:
+		if src.Type().ConvertibleTo(dst.Type()) && src.Kind() == dst.Kind() {
+			dst.Set(src.Convert(dst.Type()))
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		n := src.Len()
+		switch dst.Kind() {
+		case reflect.Slice:
+			if src.Kind() == reflect.Slice && src.IsNil() {
+				dst.Set(reflect.Zero(dst.Type()))
+				return nil
+			}
+			dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+		case reflect.Array:
+			if dst.Len() != n {
+				return fmt.Errorf("cannot store %s (length %d) in a %s", path, n, dst.Type())
+			}
+		default:
+			return mismatch()
+		}
+		for i := 0; i < n; i++ {
+			if err := extract(dst.Index(i), src.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if dst.Kind() != reflect.Map {
+			return mismatch()
+		}
+		if src.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), src.Len())
+		for _, k := range src.MapKeys() {
+			dk := reflect.New(dst.Type().Key()).Elem()
+			kpath := fmt.Sprintf("%s[%v]", path, goValue(k))
+			if err := extract(dk, k, kpath+" key"); err != nil {
+				return err
+			}
+			dv := reflect.New(dst.Type().Elem()).Elem()
+			if err := extract(dv, src.MapIndex(k), kpath); err != nil {
+				return err
+			}
+			m.SetMapIndex(dk, dv)
+		}
+		dst.Set(m)
+		return nil
+	case reflect.Struct:
+		if dst.Kind() != reflect.Struct {
+			return mismatch()
+		}
+		dt := dst.Type()
+		for i := 0; i < dt.NumField(); i++ {
+			name, ok := ngField(dt.Field(i))
+			if !ok {
+				continue
+			}
+			sf := fieldByNgName(src, name)
+			if !sf.IsValid() {
+				return fmt.Errorf("%s has no field %s for %s", path, name, dt)
+			}
+			if err := extract(dst.Field(i), sf, path+"."+name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		if dst.Kind() != reflect.Ptr {
+			return mismatch()
+		}
+		if src.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		v := reflect.New(dst.Type().Elem())
+		if err := extract(v.Elem(), src.Elem(), "*"+path); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	default:
+		if v, ok := convertGo(src, dst.Type()); ok {
+			dst.Set(v)
+			return nil
+		}
+	}
+	return mismatch()
+}
+
+// Set sets the variable name to v. If there is no variable name,
+// or it is a constant, Set declares a variable of the Neugram type
+// of v. Otherwise v must be assignable to the variable.
+func (p *Program) Set(name string, v interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return fmt.Errorf("eval: cannot set %s to untyped nil", name)
+	}
+	t, err := p.goTypes.typeOf(rv.Type())
+	if err != nil {
+		return fmt.Errorf("eval: cannot set %s: %v", name, err)
+	}
+	rtype := p.reflector.ToRType(t)
+	if v, ok := convertGo(rv, rtype); ok {
+		rv = v
+	} else {
+		v := reflect.New(rtype).Elem()
+		if err := extract(v, rv, name); err != nil {
+			return fmt.Errorf("eval: cannot set %s: %v", name, err)
+		}
+		rv = v
+	}
+
+	if obj := p.Types.Lookup(name); obj != nil && obj.Kind == typecheck.ObjVar {
+		if _, isBuiltin := obj.Type.(tipe.Builtin); !isBuiltin {
+			dst := p.Cur.Lookup(name)
+			if !rv.Type().AssignableTo(dst.Type()) {
+				return fmt.Errorf("eval: cannot set %s (type %s) to a %s", name, format.Type(obj.Type), format.Type(t))
+			}
+			dst.Set(rv)
+			return nil
+		}
+	}
+	if _, err := p.evalTop(context.Background(), &stmt.Var{NameList: []string{name}, Type: t}); err != nil {
+		return err
+	}
+	p.Cur.Lookup(name).Set(rv)
+	return nil
+}
+
+// Bind declares the variable name as the Go variable ptr points to.
+// Neugram reads and writes the Go variable itself, so each sees the
+// changes the other makes:
+//
+//	var cfg struct{ Name string; Retries int }
+//	p.Bind("cfg", &cfg)
+//	p.Eval("cfg.Retries++") // cfg.Retries is 1
+//
+// The Neugram type of the variable follows the rules of Set, but
+// as the variable shares memory with Go, its Go type must be the
+// one Neugram gives its values: a struct field of a defined type,
+// such as time.Duration, cannot be bound.
+func (p *Program) Bind(name string, ptr interface{}) error {
+	return p.bind(name, ptr, false)
+}
+
+// BindReadOnly is like Bind, but Neugram can only read the variable.
+// Assigning to it, to a field of it, or taking its address is a
+// type error. Memory it points to, such as the elements of a slice
+// field, can still be modified.
+func (p *Program) BindReadOnly(name string, ptr interface{}) error {
+	return p.bind(name, ptr, true)
+}
+
+func (p *Program) bind(name string, ptr interface{}, readOnly bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("eval: cannot bind %s: %T is not a non-nil pointer", name, ptr)
+	}
+	t, err := p.goTypes.typeOf(rv.Type().Elem())
+	if err != nil {
+		return fmt.Errorf("eval: cannot bind %s: %v", name, err)
+	}
+	ptrType := reflect.PtrTo(p.reflector.ToRType(t))
+	if !rv.Type().ConvertibleTo(ptrType) {
+		return fmt.Errorf("eval: cannot bind %s: Go type %s is not held by Neugram as itself", name, rv.Type().Elem())
+	}
+	if _, err := p.evalTop(context.Background(), &stmt.Var{NameList: []string{name}, Type: t}); err != nil {
+		return err
+	}
+	for scope := p.Cur; scope != nil; scope = scope.Parent {
+		if scope.VarName == name {
+			scope.Var = rv.Convert(ptrType).Elem()
+			break
+		}
+	}
+	p.Types.Lookup(name).ReadOnly = readOnly
+	return nil
+}
+
+// RegisterFunc declares the function fn, which must be a Go func,
+// as the variable name, so that Neugram can call it:
+//
+//	p.RegisterFunc("fetch", func(url string) (string, error) { ... })
+//
+// The Neugram type of fn follows the rules of Set. Arguments and
+// results of a defined Go type, such as time.Duration, are converted
+// between it and its underlying type at each call.
+func (p *Program) RegisterFunc(name string, fn interface{}) error {
+	if rv := reflect.ValueOf(fn); rv.Kind() != reflect.Func || rv.IsNil() {
+		return fmt.Errorf("eval: cannot register %s: %T is not a func", name, fn)
+	}
+	return p.Set(name, fn)
+}
+
+// convertGo converts v, a Go value, to the type t the evaluator
+// holds it in. A struct is copied field by field, and a slice of
+// structs element by element. A func whose parameters or results
+// must be converted is wrapped in one that converts them at each
+// call.
+func convertGo(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	vt := v.Type()
+	switch {
+	case !convertibleGo(vt, t):
+		return v, false
+	case vt == t:
+		return v, true
+	case vt.ConvertibleTo(t):
+		return v.Convert(t), true
+	case vt.Kind() == reflect.Struct:
+		s := reflect.New(t).Elem()
+		if err := extract(s, v, "value"); err != nil {
+			return v, false
+		}
+		return s, true
+	case vt.Kind() == reflect.Slice && vt.Elem().Kind() == reflect.Struct:
+		if v.IsNil() {
+			return reflect.Zero(t), true
+		}
+		s := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, ok := convertGo(v.Index(i), t.Elem())
+			if !ok {
+				return v, false
+			}
+			s.Index(i).Set(elem)
+		}
+		return s, true
+	}
+	fn := reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		for i, arg := range args {
+			a, ok := convertGo(arg, vt.In(i))
+			if !ok {
+				panic(runtimeErrorf("cannot use argument %d (type %s) as %s", i, arg.Type(), vt.In(i)))
+			}
+			args[i] = a
+		}
+		var res []reflect.Value
+		if vt.IsVariadic() {
+			res = v.CallSlice(args)
+		} else {
+			res = v.Call(args)
+		}
+		for i, r := range res {
+			out, ok := convertGo(r, t.Out(i))
+			if !ok {
+				panic(runtimeErrorf("cannot use result %d (type %s) as %s", i, r.Type(), t.Out(i)))
+			}
+			res[i] = out
+		}
+		return res
+	})
+	return fn, true
+}
+
+// convertibleGo reports whether convertGo converts values of the
+// type from to the type to.
+func convertibleGo(from, to reflect.Type) bool {
+	if from.Kind() == reflect.Struct && to.Kind() == reflect.Struct {
+		return true // by field, checked as it is copied
+	}
+	if from.Kind() == reflect.Slice && to.Kind() == reflect.Slice && from.Elem().Kind() == reflect.Struct {
+		return convertibleGo(from.Elem(), to.Elem())
+	}
+	if from.Kind() != reflect.Func || to.Kind() != reflect.Func {
+		return from.ConvertibleTo(to)
+	}
+	if from.NumIn() != to.NumIn() || from.NumOut() != to.NumOut() || from.IsVariadic() != to.IsVariadic() {
+		return false
+	}
+	for i := 0; i < from.NumIn(); i++ {
+		if !convertibleGo(to.In(i), from.In(i)) {
+			return false
+		}
+	}
+	for i := 0; i < from.NumOut(); i++ {
+		if !convertibleGo(from.Out(i), to.Out(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShellParams returns the variables of p, as strings, for shell
+// commands.
+func (p *Program) ShellParams() shell.Params {
+	return shellParams{p}
+}
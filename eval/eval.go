@@ -5,32 +5,52 @@
 package eval
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"go/constant"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"plugin"
 	"reflect"
+	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 
 	"neugram.io/ng/eval/environ"
 	"neugram.io/ng/eval/gowrap"
-	"neugram.io/ng/eval/gowrap/genwrap"
 	_ "neugram.io/ng/eval/gowrap/wrapbuiltin" // registers with gowrap
 	"neugram.io/ng/eval/shell"
 	"neugram.io/ng/expr"
 	"neugram.io/ng/format"
-	"neugram.io/ng/parser"
 	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/table"
 	"neugram.io/ng/tipe"
 	"neugram.io/ng/token"
 	"neugram.io/ng/typecheck"
 )
 
+// A Scope is one variable in the chain of variables visible to the
+// code being evaluated. Var is an addressable value: assignments
+// set it, and & takes its address.
+//
+// A function literal captures the variables it uses by reference.
+// When it is evaluated it copies the Var of each of its free
+// variables into a Scope chain of its own, so it shares each
+// variable with the enclosing code, but does not see variables
+// declared there later.
+//
+// Variables declared by the init statement of a for loop, and the
+// key and value declared by a range loop, are new variables in each
+// iteration, as in Go 1.22. A function literal made in the body of
+// such a loop sees that iteration's values. For a three clause loop,
+// each iteration's variable starts with the value the previous
+// iteration's had at its end, and the post statement updates the
+// new variable.
 type Scope struct {
 	Parent  *Scope
 	VarName string
@@ -59,18 +79,29 @@ type Program struct {
 	Pkgs      map[string]*gowrap.Pkg
 	Path      string
 	reflector *reflector
+	typesMu   *sync.RWMutex // guards Types; see goroutine.go
+	mu        *sync.Mutex   // held by top-level calls; see goroutine.go
 
-	sigint     <-chan os.Signal
-	sigintSeen bool
+	ctx   *evalContext // shared by frames; see context.go
+	usage *usage       // shared by frames; see limits.go
+	hooks *hookSet     // shared by frames; see hooks.go
+	goErr *goErr       // shared by frames; see goroutine.go
+
+	execCount int64 // atomic; calls of Eval, see display.go
+
+	stdout  io.Writer
+	journal []decl    // top-level declarations; see snapshot.go
+	goTypes goTypeMap // Go types declared by DeclareType
 
 	branchType      branchType
 	branchLabel     string
 	mostRecentLabel string
 
-	// builtinCalled is set by any builtin function that has
-	// a generic return type. The intepreter has to unbox the
-	// return type.
-	builtinCalled bool
+	// defers are the calls deferred by the function being
+	// evaluated, and panicking is the panic it can recover, if
+	// it was called by a deferred call. See panic.go.
+	defers    []deferredCall
+	panicking *panicState
 
 	tempdir string
 }
@@ -91,17 +122,48 @@ type evalMap interface {
 	SetVal(key, val interface{})
 }
 
-func New(path string) *Program {
+// Options configures a new Program.
+type Options struct {
+	// Path is the file holding the program. Relative imports are
+	// found from its directory. It may be empty.
+	Path string
+
+	// Stdout receives the output of print, println, and printf.
+	// If nil, it is os.Stdout.
+	Stdout io.Writer
+
+	// Limits bounds the resources the program uses.
+	Limits Limits
+
+	// Packages are native packages the program can import, in
+	// addition to those registered with Register. A package
+	// here replaces a registered one with the same path.
+	Packages []Package
+}
+
+// New returns a Program ready to evaluate statements.
+func New(opts Options) *Program {
+	stdout := opts.Stdout
+	if stdout == nil {
+		stdout = os.Stdout
+	}
 	universe := new(Scope)
 	p := &Program{
 		Universe: universe,
-		Types:    typecheck.New(path),
+		Types:    typecheck.New(opts.Path),
 		Pkgs:     make(map[string]*gowrap.Pkg),
-		Path:     path,
+		Path:     opts.Path,
 		Cur: &Scope{
 			Parent: universe,
 		},
 		reflector: newReflector(),
+		typesMu:   new(sync.RWMutex),
+		mu:        new(sync.Mutex),
+		ctx:       newEvalContext(),
+		usage:     &usage{limits: opts.Limits},
+		hooks:     newHookSet(),
+		goErr:     new(goErr),
+		stdout:    stdout,
 	}
 	addUniverse := func(name string, val interface{}) {
 		p.Universe = &Scope{
@@ -117,39 +179,67 @@ func New(path string) *Program {
 	addUniverse("alias", (evalMap)(environ.New()))
 	addUniverse("nil", nil)
 	addUniverse("print", func(val ...interface{}) {
-		fmt.Println(val...)
+		fmt.Fprintln(stdout, val...)
+	})
+	addUniverse("println", func(val ...interface{}) {
+		fmt.Fprintln(stdout, val...)
 	})
 	addUniverse("printf", func(format string, val ...interface{}) {
-		fmt.Printf(format, val...)
+		fmt.Fprintf(stdout, format, val...)
 	})
 	addUniverse("errorf", fmt.Errorf)
 	addUniverse("len", func(c interface{}) int {
 		if c == nil {
 			return 0
 		}
-		return reflect.ValueOf(c).Len()
+		if t, isTable := c.(*table.Table); isTable {
+			return t.Len()
+		}
+		v := reflect.ValueOf(c)
+		if v.Kind() == reflect.Ptr {
+			return v.Type().Elem().Len() // pointer to array
+		}
+		return v.Len()
 	})
 	addUniverse("cap", func(c interface{}) int {
 		if c == nil {
 			return 0
 		}
-		return reflect.ValueOf(c).Cap()
+		v := reflect.ValueOf(c)
+		if v.Kind() == reflect.Ptr {
+			return v.Type().Elem().Len() // pointer to array
+		}
+		return v.Cap()
+	})
+	addUniverse("cols", func(t interface{}) int {
+		tbl, _ := t.(*table.Table)
+		return tbl.NumCols()
 	})
 	addUniverse("panic", func(c interface{}) {
 		c = promoteUntyped(c)
 		panic(Panic{c})
 	})
+	// A call of recover is evaluated by Program.recover. This is
+	// only called by defer recover(), which does not recover.
+	addUniverse("recover", func() interface{} { return nil })
 	addUniverse("copy", func(dst, src interface{}) int {
 		src = promoteUntyped(src)
 		return reflect.Copy(reflect.ValueOf(dst), reflect.ValueOf(src))
 	})
 	addUniverse("append", p.builtinAppend)
+	addUniverse("complex", p.builtinComplex)
+	addUniverse("real", p.builtinReal)
+	addUniverse("imag", p.builtinImag)
+	addUniverse("close", func(c interface{}) {
+		reflect.ValueOf(c).Close()
+	})
 	addUniverse("delete", func(m, k interface{}) {
 		k = promoteUntyped(k)
 		reflect.ValueOf(m).SetMapIndex(reflect.ValueOf(k), reflect.Value{})
 	})
 	addUniverse("make", p.builtinMake)
 	addUniverse("new", p.builtinNew)
+	p.installPackages(append([]Package{displayPkg{p}}, opts.Packages...))
 	return p
 }
 
@@ -158,59 +248,22 @@ func EvalFile(path string) error {
 	if err != nil {
 		return fmt.Errorf("eval: %v", err)
 	}
-	p := New(path)
+	p := New(Options{Path: path})
 	return p.evalFile()
 }
 
 func (p *Program) evalFile() error {
-	prsr := parser.New()
 	f, err := os.Open(p.Path)
 	if err != nil {
 		return fmt.Errorf("eval: %v", err)
 	}
 	defer f.Close()
-
-	// TODO: position information in the parser will replace i.
-	scanner := bufio.NewScanner(f)
-	for i := 0; scanner.Scan(); i++ {
-		line := scanner.Bytes()
-		res := prsr.ParseLine(line)
-		if len(res.Errs) > 0 {
-			return fmt.Errorf("%d: %v", i+1, res.Errs[0])
-		}
-		for _, s := range res.Stmts {
-			if _, err := p.Eval(s, p.sigint); err != nil {
-				if _, isPanic := err.(Panic); isPanic {
-					return err
-				}
-				return fmt.Errorf("%d: %v", i+1, err)
-			}
-		}
-		for _, cmd := range res.Cmds {
-			j := &shell.Job{
-				Cmd:    cmd,
-				Stdin:  os.Stdin,
-				Stdout: os.Stdout,
-				Stderr: os.Stderr,
-			}
-			if err := j.Start(); err != nil {
-				return err
-			}
-			done, err := j.Wait()
-			if err != nil {
-				return err
-			}
-			if !done {
-				break // TODO not right, instead we should just have one cmd, not Cmds here.
-			}
-		}
-	}
-	return nil
-
+	_, err = p.evalSource(context.Background(), f)
+	return err
 }
 
 func (p *Program) builtinAppend(s interface{}, v ...interface{}) interface{} {
-	p.builtinCalled = true
+	p.alloc(len(v))
 	res := reflect.ValueOf(s)
 	for _, elem := range v {
 		res = reflect.Append(res, reflect.ValueOf(elem))
@@ -218,39 +271,96 @@ func (p *Program) builtinAppend(s interface{}, v ...interface{}) interface{} {
 	return res.Interface()
 }
 
+func (p *Program) builtinComplex(re, im interface{}) interface{} {
+	switch re := re.(type) {
+	case float32:
+		return complex(re, im.(float32))
+	case float64:
+		return complex(re, im.(float64))
+	}
+	panic(interpPanic{fmt.Errorf("complex: bad argument type %T", re)})
+}
+
+func (p *Program) builtinReal(c interface{}) interface{} {
+	switch c := c.(type) {
+	case complex64:
+		return real(c)
+	case complex128:
+		return real(c)
+	}
+	panic(interpPanic{fmt.Errorf("real: bad argument type %T", c)})
+}
+
+func (p *Program) builtinImag(c interface{}) interface{} {
+	switch c := c.(type) {
+	case complex64:
+		return imag(c)
+	case complex128:
+		return imag(c)
+	}
+	panic(interpPanic{fmt.Errorf("imag: bad argument type %T", c)})
+}
+
 func (p *Program) builtinNew(v interface{}) interface{} {
-	p.builtinCalled = true
 	t := v.(reflect.Type)
+	p.alloc(1)
 	return reflect.New(t).Interface()
 }
 
 func (p *Program) builtinMake(v ...interface{}) interface{} {
-	p.builtinCalled = true
 	t := v[0].(reflect.Type)
 	switch t.Kind() {
 	case reflect.Chan:
 		size := 0
 		if len(v) > 1 {
-			size = v[1].(int)
+			size = makeSize(v[1], "makechan: size")
 		}
+		p.alloc(size)
 		return reflect.MakeChan(t, size).Interface()
 	case reflect.Slice:
-		var slen, scap int
-		if len(v) > 1 {
-			slen = v[1].(int)
-		}
+		slen := makeSize(v[1], "makeslice: len")
+		scap := slen
 		if len(v) > 2 {
-			scap = v[2].(int)
-		} else {
-			scap = slen
+			scap = makeSize(v[2], "makeslice: cap")
+			if scap < slen {
+				panic(runtimeErrorf("makeslice: cap out of range"))
+			}
 		}
+		p.alloc(scap)
 		return reflect.MakeSlice(t, slen, scap).Interface()
 	case reflect.Map:
+		if len(v) > 1 {
+			size := makeSize(v[1], "makemap: size")
+			p.alloc(size)
+			return reflect.MakeMapWithSize(t, size).Interface()
+		}
 		return reflect.MakeMap(t).Interface()
 	}
 	return nil
 }
 
+// makeSize returns v, a size argument to make of any integer type,
+// as an int. It panics with a runtime error naming what if v is
+// negative or too large.
+func makeSize(v interface{}, what string) int {
+	var n int64
+	var ok bool
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok = rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok = int64(rv.Uint()), rv.Uint() <= math.MaxInt64
+	default:
+		if b, isBig := v.(*big.Int); isBig {
+			n, ok = b.Int64(), b.IsInt64()
+		}
+	}
+	if !ok || n < 0 || int64(int(n)) != n {
+		panic(runtimeErrorf("%s out of range", what))
+	}
+	return int(n)
+}
+
 func (p *Program) Environ() *environ.Environ {
 	return p.Universe.Lookup("env").Interface().(*environ.Environ)
 }
@@ -259,8 +369,14 @@ func (p *Program) Alias() *environ.Environ {
 	return p.Universe.Lookup("alias").Interface().(*environ.Environ)
 }
 
+// shellParams gives shell commands the variables of a Program.
+type shellParams struct {
+	p *Program
+}
+
 // Get is part of the implementation of shell.Params.
-func (p *Program) Get(name string) string {
+func (sp shellParams) Get(name string) string {
+	p := sp.p
 	v := p.Cur.Lookup(name)
 	if v == (reflect.Value{}) {
 		return p.Environ().Get(name)
@@ -273,7 +389,8 @@ func (p *Program) Get(name string) string {
 }
 
 // Set is part of the implementation of shell.Params.
-func (p *Program) Set(name, value string) {
+func (sp shellParams) Set(name, value string) {
+	p := sp.p
 	s := &Scope{
 		Parent:   p.Cur,
 		VarName:  name,
@@ -283,40 +400,39 @@ func (p *Program) Set(name, value string) {
 	p.Cur = s
 }
 
-func (p *Program) interrupted() bool {
-	if p.sigintSeen {
-		return true
-	}
-	select {
-	case <-p.sigint:
-		p.sigintSeen = true
-		return true
-	default:
-		return false
+// EvalContext evaluates the statement s. If ctx is canceled, the
+// evaluation stops and EvalContext returns ctx.Err().
+func (p *Program) EvalContext(ctx context.Context, s stmt.Stmt) (res []reflect.Value, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.goErr.take(); err != nil {
+		return nil, err
 	}
+	return p.evalTop(ctx, s)
 }
 
-var nosig = (<-chan os.Signal)(make(chan os.Signal))
-
-func (p *Program) Eval(s stmt.Stmt, sigint <-chan os.Signal) (res []reflect.Value, err error) {
-	if sigint != nil {
-		p.sigint = sigint
-	} else {
-		p.sigint = nosig
-	}
+// evalTop evaluates the top-level statement s. The caller holds p.mu.
+func (p *Program) evalTop(ctx context.Context, s stmt.Stmt) (res []reflect.Value, err error) {
+	p.ctx.set(ctx)
 	defer func() {
-		p.sigint = nosig
-		p.sigintSeen = false
+		p.ctx.set(context.Background())
 		x := recover()
 		if x == nil {
 			return
 		}
-		switch p := x.(type) {
+		switch x := x.(type) {
+		case interrupt:
+			err = x.err
+			res = nil
+			return
 		case interpPanic:
-			err = p.reason
+			err = x.reason
+			if pos := p.Types.Fset.Position(s.Pos()); pos.IsValid() {
+				err = fmt.Errorf("%s: %v", pos, err)
+			}
 			return
 		case Panic:
-			err = p
+			err = x
 			return
 		default:
 			//panic(x)
@@ -328,17 +444,44 @@ func (p *Program) Eval(s stmt.Stmt, sigint <-chan os.Signal) (res []reflect.Valu
 	}()
 
 	p.Types.Errs = p.Types.Errs[:0]
+	p.typesMu.Lock()
 	p.Types.Add(s)
+	p.typesMu.Unlock()
 	if len(p.Types.Errs) > 0 {
-		return nil, fmt.Errorf("typecheck: %v\n", p.Types.Errs[0])
+		return nil, fmt.Errorf("typecheck: %v", p.Types.Errs[0])
 	}
 
 	p.branchType = brNone
 	p.branchLabel = ""
+	if s.Pos().IsValid() {
+		// Not a statement made by Get, Set, or the like.
+		p.stmtHook(s)
+	}
 	res = p.evalStmt(s)
 	return res, nil
 }
 
+// evalGoSrcPkg evaluates a Go package imported from source, which
+// the type checker has converted to Neugram and checked, and returns
+// its exported members.
+func (p *Program) evalGoSrcPkg(file *syntax.File) *gowrap.Pkg {
+	oldCur := p.Cur
+	p.Cur = p.Universe
+	defer func() { p.Cur = oldCur }()
+	for _, s := range file.Stmts {
+		p.evalStmt(s)
+	}
+	pkg := &gowrap.Pkg{Exports: make(map[string]reflect.Value)}
+	for sc := p.Cur; sc != p.Universe; sc = sc.Parent {
+		name := sc.VarName
+		if _, shadowed := pkg.Exports[name]; shadowed || !isExported(name) {
+			continue
+		}
+		pkg.Exports[name] = sc.Var
+	}
+	return pkg
+}
+
 func (p *Program) pushScope() {
 	p.Cur = &Scope{
 		Parent: p.Cur,
@@ -352,6 +495,68 @@ func (p *Program) popScope() {
 	p.Cur = p.Cur.Parent
 }
 
+// renewVars gives each variable declared in the scopes from p.Cur up
+// to, but not including, top a new address holding its current value.
+func (p *Program) renewVars(top *Scope) {
+	for s := p.Cur; s != top; s = s.Parent {
+		if s.VarName == "" || s.Label {
+			continue
+		}
+		v := reflect.New(s.Var.Type()).Elem()
+		v.Set(s.Var)
+		s.Var = v
+	}
+}
+
+// assign sets the variables on the left of s to vals, the values
+// on its right, of the given types. It declares the variables if s
+// is a := declaration.
+func (p *Program) assign(s *stmt.Assign, types []tipe.Type, vals []reflect.Value) {
+	vars := make([]reflect.Value, len(s.Left))
+	if s.Decl {
+		for i, lhs := range s.Left {
+			if lhs.(*expr.Ident).Name == "_" {
+				continue
+			}
+			t := p.reflector.ToRType(types[i])
+			s := &Scope{
+				Parent:   p.Cur,
+				VarName:  lhs.(*expr.Ident).Name,
+				Var:      reflect.New(t).Elem(),
+				Implicit: true,
+			}
+			p.Cur = s
+			vars[i] = s.Var
+		}
+	} else {
+		for i, lhs := range s.Left {
+			if e, isIdent := lhs.(*expr.Ident); isIdent && e.Name == "_" {
+				continue
+			}
+			if e, isIndex := lhs.(*expr.Index); isIndex {
+				if _, isMap := tipe.Underlying(p.typeOf(e.Left)).(*tipe.Map); isMap {
+					container := p.evalExprOne(e.Left)
+					k := p.evalExprOne(e.Indicies[0])
+					if env, ok := container.Interface().(evalMap); ok {
+						env.SetVal(k.String(), vals[i].String())
+					} else {
+						container.SetMapIndex(k, vals[i])
+					}
+					continue
+				}
+			}
+			v := p.evalExprOne(lhs)
+			vars[i] = v
+		}
+	}
+
+	for i := range vars {
+		if vars[i].IsValid() {
+			vars[i].Set(unbox(vals[i], vars[i].Type()))
+		}
+	}
+}
+
 func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 	mostRecentLabel := p.mostRecentLabel
 	p.mostRecentLabel = ""
@@ -361,7 +566,7 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 		vals := make([]reflect.Value, 0, len(s.Left))
 		for _, rhs := range s.Right {
 			v := p.evalExpr(rhs)
-			t := p.Types.Types[rhs]
+			t := p.typeOf(rhs)
 			if tuple, isTuple := t.(*tipe.Tuple); isTuple {
 				types = append(types, tuple.Elems...)
 			} else {
@@ -371,62 +576,33 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 			vals = append(vals, v...)
 		}
 
-		vars := make([]reflect.Value, len(s.Left))
-		if s.Decl {
-			for i, lhs := range s.Left {
-				if lhs.(*expr.Ident).Name == "_" {
-					continue
-				}
-				t := p.reflector.ToRType(types[i])
-				s := &Scope{
-					Parent:   p.Cur,
-					VarName:  lhs.(*expr.Ident).Name,
-					Var:      reflect.New(t).Elem(),
-					Implicit: true,
-				}
-				p.Cur = s
-				vars[i] = s.Var
-			}
-		} else {
-			for i, lhs := range s.Left {
-				if e, isIdent := lhs.(*expr.Ident); isIdent && e.Name == "_" {
-					continue
-				}
-				if e, isIndex := lhs.(*expr.Index); isIndex {
-					if _, isMap := tipe.Underlying(p.Types.Types[e.Left]).(*tipe.Map); isMap {
-						container := p.evalExprOne(e.Left)
-						k := p.evalExprOne(e.Indicies[0])
-						if env, ok := container.Interface().(evalMap); ok {
-							env.SetVal(k.String(), vals[i].String())
-						} else {
-							container.SetMapIndex(k, vals[i])
-						}
-						continue
-					}
-				}
-				v := p.evalExprOne(lhs)
-				vars[i] = v
-			}
-		}
-
-		for i := range vars {
-			if vars[i].IsValid() {
-				vars[i].Set(vals[i])
-			}
+		p.assign(s, types, vals)
+		return nil
+	case *stmt.Const, *stmt.ConstSet:
+		// Constant values are resolved by the typechecker.
+		return nil
+	case *stmt.Var:
+		p.evalVar(s)
+		return nil
+	case *stmt.VarSet:
+		for _, v := range s.Vars {
+			p.evalVar(v)
 		}
-
 		return nil
 	case *stmt.Block:
 		p.pushScope()
 		defer p.popScope()
 		for _, s := range s.Stmts {
+			p.step()
+			p.stmtHook(s)
 			res := p.evalStmt(s)
-			if p.branchType != brNone || p.interrupted() {
+			if p.branchType != brNone {
 				return res
 			}
 		}
 		return nil
 	case *stmt.For:
+		top := p.Cur
 		if s.Init != nil {
 			p.pushScope()
 			defer p.popScope()
@@ -443,9 +619,7 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 			p.evalStmt(s.Body)
 			// Note there are three extremely similar loops:
 			//	*stmt.For, *stmt.Range (slice, and map)
-			if p.interrupted() {
-				break
-			}
+			p.step()
 			switch p.branchType {
 			default:
 				break loop
@@ -460,6 +634,7 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 				if p.branchLabel == mostRecentLabel {
 					p.branchType = brNone
 					p.branchLabel = ""
+					p.renewVars(top)
 					if s.Post != nil {
 						p.evalStmt(s.Post)
 					}
@@ -467,20 +642,34 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 				}
 				break loop
 			}
+			p.renewVars(top)
 			if s.Post != nil {
 				p.evalStmt(s.Post)
 			}
 		}
 		return nil
-	case *stmt.Go:
+	case *stmt.Defer:
 		fn, args := p.prepCall(s.Call)
+		if fn.Kind() == reflect.Func && fn.IsNil() {
+			panic(runtimeErrorf("invalid memory address or nil pointer dereference"))
+		}
 		for i, arg := range args {
 			v := reflect.New(arg.Type()).Elem()
 			v.Set(arg)
 			args[i] = v
 		}
-		go fn.Call(args)
+		p.defers = append(p.defers, deferredCall{fn: fn, args: args, ellipsis: s.Call.Ellipsis})
 		return nil
+	case *stmt.Go:
+		p.evalGo(s)
+		return nil
+	case *stmt.Select:
+		p.evalSelect(s, mostRecentLabel)
+		return nil
+	case *stmt.Switch:
+		return p.evalSwitch(s, mostRecentLabel)
+	case *stmt.TypeSwitch:
+		return p.evalTypeSwitch(s, mostRecentLabel)
 	case *stmt.If:
 		if s.Init != nil {
 			p.pushScope()
@@ -530,36 +719,26 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 				}()
 				p.Pkgs[path] = pkg
 			}
-		} else {
-			pkg = gowrap.Pkgs[s.Path]
+		} else if typecheck.IsGoSrcPath(s.Path) {
+			dir, err := filepath.Abs(filepath.Join(filepath.Dir(p.Path), s.Path))
+			if err != nil {
+				panic(Panic{val: err})
+			}
+			pkg = p.Pkgs[dir]
 			if pkg == nil {
-				// TODO: go install pkg before genwrap for update importer?
-				src, err := genwrap.GenGo(s.Path, "main")
-				if err != nil {
-					panic(Panic{val: fmt.Errorf("plugin: wrapper gen failed for Go package %q: %v", s.Name, err)})
-				}
-				if p.tempdir == "" {
-					p.tempdir, err = ioutil.TempDir("", "ng-tmp-")
-					if err != nil {
-						panic(Panic{val: err})
-					}
+				file := p.Types.GoSrcPkgs[dir]
+				if file == nil {
+					panic(Panic{val: fmt.Errorf("cannot find package typechecking: %v", dir)})
 				}
-				name := "ng-plugin-" + strings.Replace(s.Path, "/", "_", -1) + ".go"
-				err = ioutil.WriteFile(filepath.Join(p.tempdir, name), src, 0666)
-				if err != nil {
+				pkg = p.evalGoSrcPkg(file)
+				p.Pkgs[dir] = pkg
+			}
+		} else if pkg = p.Pkgs[s.Path]; pkg == nil {
+			pkg = gowrap.Pkgs[s.Path]
+			if pkg == nil {
+				if err := p.loadPlugin(s.Path, s.Name); err != nil {
 					panic(Panic{val: err})
 				}
-				cmd := exec.Command("go", "build", "-buildmode=plugin", "-i", name)
-				cmd.Dir = p.tempdir
-				out, err := cmd.CombinedOutput()
-				if err != nil {
-					panic(Panic{val: fmt.Errorf("plugin: building wrapper failed for Go package %q: %v\n%s", s.Name, err, out)})
-				}
-				pluginName := name[:len(name)-3] + ".so"
-				_, err = plugin.Open(filepath.Join(p.tempdir, pluginName))
-				if err != nil {
-					panic(Panic{val: fmt.Errorf("plugin: failed to open Go package %q: %v", s.Name, err)})
-				}
 				pkg = gowrap.Pkgs[s.Path]
 				if pkg == nil {
 					panic(Panic{val: fmt.Errorf("plugin: contents missing from Go package %q", s.Name)})
@@ -577,9 +756,10 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 		p.pushScope()
 		defer p.popScope()
 		var key, val reflect.Value
+		var keyScope, valScope *Scope
 		if s.Decl {
 			if s.Key != nil {
-				key = reflect.New(p.reflector.ToRType(p.Types.Types[s.Key])).Elem()
+				key = reflect.New(p.reflector.ToRType(p.typeOf(s.Key))).Elem()
 				name := s.Key.(*expr.Ident).Name
 				p.Cur = &Scope{
 					Parent:   p.Cur,
@@ -587,9 +767,10 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 					Var:      key,
 					Implicit: true,
 				}
+				keyScope = p.Cur
 			}
 			if s.Val != nil {
-				val = reflect.New(p.reflector.ToRType(p.Types.Types[s.Val])).Elem()
+				val = reflect.New(p.reflector.ToRType(p.typeOf(s.Val))).Elem()
 				name := s.Val.(*expr.Ident).Name
 				p.Cur = &Scope{
 					Parent:   p.Cur,
@@ -597,25 +778,39 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 					Var:      val,
 					Implicit: true,
 				}
+				valScope = p.Cur
 			}
 		} else {
 			key = p.evalExprOne(s.Key)
 			val = p.evalExprOne(s.Val)
 		}
+		// renew makes the declared key and value new variables
+		// for the next iteration.
+		renew := func() {
+			if keyScope != nil {
+				key = reflect.New(key.Type()).Elem()
+				keyScope.Var = key
+			}
+			if valScope != nil {
+				val = reflect.New(val.Type()).Elem()
+				valScope.Var = val
+			}
+		}
 		src := p.evalExprOne(s.Expr)
 		switch src.Kind() {
 		case reflect.Array, reflect.Slice:
 			slen := src.Len()
 		sliceLoop:
 			for i := 0; i < slen; i++ {
+				if i > 0 {
+					renew()
+				}
 				key.SetInt(int64(i))
 				if val != (reflect.Value{}) {
 					val.Set(src.Index(i))
 				}
 				p.evalStmt(s.Body)
-				if p.interrupted() {
-					break
-				}
+				p.step()
 				switch p.branchType {
 				default:
 					break sliceLoop
@@ -638,14 +833,15 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 		case reflect.Map:
 			keys := src.MapKeys()
 		mapLoop:
-			for _, k := range keys {
+			for i, k := range keys {
+				if i > 0 {
+					renew()
+				}
 				key.Set(k)
 				v := src.MapIndex(key)
 				val.Set(v)
 				p.evalStmt(s.Body)
-				if p.interrupted() {
-					break
-				}
+				p.step()
 				switch p.branchType {
 				default:
 					break mapLoop
@@ -665,6 +861,40 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 					break mapLoop
 				}
 			}
+		case reflect.Chan:
+		chanLoop:
+			for i := 0; ; i++ {
+				v, ok := src.Recv()
+				if !ok {
+					break
+				}
+				if i > 0 {
+					renew()
+				}
+				if key.IsValid() {
+					key.Set(v)
+				}
+				p.evalStmt(s.Body)
+				p.step()
+				switch p.branchType {
+				default:
+					break chanLoop
+				case brNone:
+				case brBreak:
+					if p.branchLabel == mostRecentLabel {
+						p.branchType = brNone
+						p.branchLabel = ""
+					}
+					break chanLoop
+				case brContinue:
+					if p.branchLabel == mostRecentLabel {
+						p.branchType = brNone
+						p.branchLabel = ""
+						continue chanLoop
+					}
+					break chanLoop
+				}
+			}
 		default:
 			panic(interpPanic{fmt.Errorf("unknown range type: %T", src)})
 		}
@@ -680,10 +910,14 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 	case *stmt.Simple:
 		res := p.evalExpr(s.Expr)
 		if fn, isFunc := s.Expr.(*expr.FuncLiteral); isFunc && fn.Name != "" {
+			// The function is held in a variable, so that
+			// Reload can replace it for its callers.
+			v := reflect.New(res[0].Type()).Elem()
+			v.Set(res[0])
 			s := &Scope{
 				Parent:   p.Cur,
 				VarName:  fn.Name,
-				Var:      res[0],
+				Var:      v,
 				Implicit: true,
 			}
 			p.Cur = s
@@ -695,40 +929,14 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 		ch.Send(v)
 		return nil
 	case *stmt.TypeDecl:
+		if t, ok := s.Type.(*tipe.Named); ok {
+			// Without reflect.NamedOf, a defined type is
+			// represented by its underlying type.
+			p.reflector.defineNamed(t)
+		}
 		return nil
 	case *stmt.MethodikDecl:
-		t := s.Type
-		r := p.reflector
-
-		// Hack. See the file comment in methodpool.go.
-		st, isStruct := t.Type.(*tipe.Struct)
-		if !isStruct {
-			panic("eval only supports methodik on struct types")
-		}
-		var methodFuncs []reflect.Type
-		for _, m := range t.Methods {
-			methodFuncs = append(methodFuncs, r.ToRType(m))
-		}
-		var fields []reflect.StructField
-		for i, name := range t.MethodNames {
-			funcType := r.ToRType(t.Methods[i])
-			funcImpl := p.evalFuncLiteral(s.Methods[i], t)
-
-			embType := methodPoolAssign(name, funcType, funcImpl)
-			fields = append(fields, reflect.StructField{
-				Name:      embType.Name(),
-				Type:      embType,
-				Anonymous: true,
-			})
-		}
-		for i, f := range st.Fields {
-			fields = append(fields, reflect.StructField{
-				Name: st.FieldNames[i],
-				Type: r.ToRType(f),
-			})
-		}
-		rtype := reflect.StructOf(fields)
-		r.fwd[t] = rtype
+		p.evalMethodikDecl(s)
 		return nil
 	case *stmt.Labeled:
 		p.Cur = &Scope{
@@ -758,6 +966,173 @@ func (p *Program) evalStmt(s stmt.Stmt) []reflect.Value {
 	panic(fmt.Sprintf("TODO evalStmt: %s", format.Stmt(s)))
 }
 
+// evalSwitch evaluates the expression switch s, labeled label.
+// Cases are tried in order, and default runs if none matches.
+func (p *Program) evalSwitch(s *stmt.Switch, label string) []reflect.Value {
+	p.pushScope()
+	defer p.popScope()
+	if s.Init != nil {
+		p.evalStmt(s.Init)
+	}
+	tag := reflect.ValueOf(true)
+	if s.Cond != nil {
+		tag = p.evalExprOne(s.Cond)
+	}
+	match := -1
+	for i, cse := range s.Cases {
+		for _, e := range cse.Conds {
+			if valEq(basicValue(tag), basicValue(p.evalExprOne(e))) {
+				match = i
+				break
+			}
+		}
+		if match >= 0 {
+			break
+		}
+	}
+	if match < 0 {
+		match = defaultCase(len(s.Cases), func(i int) bool { return s.Cases[i].Default })
+	}
+	return p.evalCases(match, len(s.Cases), func(i int) *stmt.Block { return s.Cases[i].Body }, label)
+}
+
+// evalTypeSwitch evaluates the type switch s, labeled label. A
+// variable declared by the guard is bound in the chosen case.
+func (p *Program) evalTypeSwitch(s *stmt.TypeSwitch, label string) []reflect.Value {
+	p.pushScope()
+	defer p.popScope()
+	if s.Init != nil {
+		p.evalStmt(s.Init)
+	}
+	var name string
+	var guard *expr.TypeAssert
+	switch a := s.Assign.(type) {
+	case *stmt.Simple:
+		guard = a.Expr.(*expr.TypeAssert)
+	case *stmt.Assign:
+		name = a.Left[0].(*expr.Ident).Name
+		guard = a.Right[0].(*expr.TypeAssert)
+	}
+	v := p.evalExprOne(guard.Expr)
+	if v.Kind() == reflect.Interface {
+		v = v.Elem() // the dynamic value, invalid if nil
+	}
+	match := -1
+	for i, cse := range s.Cases {
+		for _, t := range cse.Types {
+			if p.hasType(v, t) {
+				match = i
+				break
+			}
+		}
+		if match >= 0 {
+			break
+		}
+	}
+	if match < 0 {
+		match = defaultCase(len(s.Cases), func(i int) bool { return s.Cases[i].Default })
+	}
+	if match < 0 {
+		return nil
+	}
+	if name != "" && name != "_" {
+		// As in the typechecker, the variable has the case's
+		// type if it lists exactly one, else the guard's.
+		cse := s.Cases[match]
+		t := p.typeOf(guard)
+		if len(cse.Types) == 1 && cse.Types[0] != tipe.UntypedNil {
+			t = cse.Types[0]
+		}
+		x := reflect.New(p.reflector.ToRType(t)).Elem()
+		if v.IsValid() {
+			x.Set(v)
+		}
+		p.Cur = &Scope{
+			Parent:   p.Cur,
+			VarName:  name,
+			Var:      x,
+			Implicit: true,
+		}
+	}
+	return p.evalCases(match, len(s.Cases), func(i int) *stmt.Block { return s.Cases[i].Body }, label)
+}
+
+// hasType reports whether the dynamic value v, invalid for a nil
+// interface, is of the type t of a type switch case.
+func (p *Program) hasType(v reflect.Value, t tipe.Type) bool {
+	if t == tipe.UntypedNil {
+		return !v.IsValid()
+	}
+	if !v.IsValid() {
+		return false
+	}
+	rt := p.reflector.ToRType(t)
+	return v.Type() == rt || rt.Kind() == reflect.Interface && v.Type().Implements(rt)
+}
+
+// defaultCase returns the index of the default of n cases, or -1.
+func defaultCase(n int, isDefault func(i int) bool) int {
+	for i := 0; i < n; i++ {
+		if isDefault(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// evalCases evaluates the body of case i of n and, while they end
+// in fallthrough, the bodies after it. A break of the switch, which
+// is labeled label, ends it.
+func (p *Program) evalCases(i, n int, body func(i int) *stmt.Block, label string) (res []reflect.Value) {
+	if i < 0 {
+		return nil
+	}
+	for ; i < n; i++ {
+		res = p.evalStmt(body(i))
+		if p.branchType != brFallthrough {
+			break
+		}
+		p.branchType = brNone
+	}
+	if p.branchType == brBreak && p.branchLabel == label {
+		p.branchType = brNone
+		p.branchLabel = ""
+	}
+	return res
+}
+
+func (p *Program) evalVar(s *stmt.Var) {
+	var vals []reflect.Value
+	var types []tipe.Type
+	for _, e := range s.Values {
+		vals = append(vals, p.evalExpr(e)...)
+		if tuple, isTuple := p.typeOf(e).(*tipe.Tuple); isTuple {
+			types = append(types, tuple.Elems...)
+		} else {
+			types = append(types, p.typeOf(e))
+		}
+	}
+	for i, name := range s.NameList {
+		if name == "_" {
+			continue
+		}
+		t := s.Type
+		if t == nil {
+			t = types[i]
+		}
+		v := zeroValue(p.reflector.ToRType(t))
+		if len(vals) > 0 {
+			v.Set(unbox(vals[i], v.Type()))
+		}
+		p.Cur = &Scope{
+			Parent:   p.Cur,
+			VarName:  name,
+			Var:      v,
+			Implicit: true,
+		}
+	}
+}
+
 func (p *Program) evalExprOne(e expr.Expr) reflect.Value {
 	v := p.evalExpr(e)
 	if len(v) != 1 {
@@ -766,11 +1141,51 @@ func (p *Program) evalExprOne(e expr.Expr) reflect.Value {
 	return v[0]
 }
 
+var (
+	bigIntType     = reflect.TypeOf((*big.Int)(nil))
+	bigFloatType   = reflect.TypeOf((*big.Float)(nil))
+	emptyIfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+	tableType      = reflect.TypeOf((*table.Table)(nil))
+)
+
+// zeroValue returns a new zero value of type t. Unlike reflect.New,
+// the values of the integer and float types, and of struct fields
+// and array elements of those types, are zero rather than nil.
+func zeroValue(t reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	setZero(v)
+	return v
+}
+
+func setZero(v reflect.Value) {
+	switch v.Type() {
+	case bigIntType:
+		v.Set(reflect.ValueOf(new(big.Int)))
+		return
+	case bigFloatType:
+		v.Set(reflect.ValueOf(new(big.Float)))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				setZero(f)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			setZero(v.Index(i))
+		}
+	}
+}
+
 type UntypedInt struct{ *big.Int }
 type UntypedFloat struct{ *big.Float }
 type UntypedString struct{ String string }
 type UntypedRune struct{ Rune rune }
 type UntypedBool struct{ Bool bool }
+type UntypedComplex struct{ Real, Imag *big.Float }
 
 func promoteUntyped(x interface{}) interface{} {
 	switch x := x.(type) {
@@ -785,6 +1200,10 @@ func promoteUntyped(x interface{}) interface{} {
 		return x.Rune
 	case UntypedBool:
 		return x.Bool
+	case UntypedComplex:
+		re, _ := x.Real.Float64()
+		im, _ := x.Imag.Float64()
+		return complex(re, im)
 	default:
 		return x
 	}
@@ -799,10 +1218,13 @@ func convert(v reflect.Value, t reflect.Type) reflect.Value {
 	case reflect.Type:
 		return v // type conversion
 	case UntypedInt:
-		if t == reflect.TypeOf(UntypedFloat{}) {
-			res := UntypedFloat{new(big.Float)}
-			res.Float.SetInt64(val.Int64())
-			return reflect.ValueOf(res)
+		switch t {
+		case reflect.TypeOf(UntypedFloat{}):
+			return reflect.ValueOf(UntypedFloat{new(big.Float).SetInt(val.Int)})
+		case bigIntType:
+			return reflect.ValueOf(new(big.Int).Set(val.Int))
+		case bigFloatType:
+			return reflect.ValueOf(new(big.Float).SetInt(val.Int))
 		}
 		ret := reflect.New(t).Elem()
 		switch t.Kind() {
@@ -811,25 +1233,56 @@ func convert(v reflect.Value, t reflect.Type) reflect.Value {
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 			ret.SetUint(val.Uint64())
 		case reflect.Float32, reflect.Float64:
-			ret.SetFloat(float64(val.Int64()))
+			f, _ := new(big.Float).SetInt(val.Int).Float64()
+			ret.SetFloat(f)
+		case reflect.Complex64, reflect.Complex128:
+			f, _ := new(big.Float).SetInt(val.Int).Float64()
+			ret.SetComplex(complex(f, 0))
 		default:
 			ret.SetInt(val.Int64())
 		}
 		return ret
 	case UntypedFloat:
+		switch t {
+		case bigIntType:
+			i, _ := val.Int(nil)
+			return reflect.ValueOf(i)
+		case bigFloatType:
+			return reflect.ValueOf(new(big.Float).Copy(val.Float))
+		}
 		ret := reflect.New(t).Elem()
 		f, _ := val.Float64()
-		if t.Kind() == reflect.Interface {
+		switch t.Kind() {
+		case reflect.Interface:
 			ret.Set(reflect.ValueOf(float64(f)))
-		} else {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, _ := val.Int64()
+			ret.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u, _ := val.Uint64()
+			ret.SetUint(u)
+		case reflect.Complex64, reflect.Complex128:
+			ret.SetComplex(complex(f, 0))
+		default:
 			ret.SetFloat(f)
 		}
 		return ret
+	case UntypedComplex:
+		ret := reflect.New(t).Elem()
+		c := promoteUntyped(val).(complex128)
+		if t.Kind() == reflect.Interface {
+			ret.Set(reflect.ValueOf(c))
+		} else {
+			ret.SetComplex(c)
+		}
+		return ret
 	case UntypedString:
 		ret := reflect.New(t).Elem()
 		s := val.String
 		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
 			ret.Set(reflect.ValueOf([]byte(s)))
+		} else if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Int32 {
+			ret.Set(reflect.ValueOf([]rune(s)))
 		} else if t.Kind() == reflect.Interface {
 			ret.Set(reflect.ValueOf(s))
 		} else {
@@ -839,9 +1292,12 @@ func convert(v reflect.Value, t reflect.Type) reflect.Value {
 	case UntypedRune:
 		ret := reflect.New(t).Elem()
 		r := val.Rune
-		if t.Kind() == reflect.Interface {
+		switch t.Kind() {
+		case reflect.Interface:
 			ret.Set(reflect.ValueOf(r))
-		} else {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			ret.SetUint(uint64(r))
+		default:
 			ret.SetInt(int64(r))
 		}
 		return ret
@@ -861,6 +1317,53 @@ func convert(v reflect.Value, t reflect.Type) reflect.Value {
 	}
 }
 
+// constValue returns the value of the typechecked constant expression e.
+func (p *Program) constValue(e expr.Expr, v constant.Value) reflect.Value {
+	t := p.typeOf(e)
+	var x interface{}
+	switch v.Kind() {
+	case constant.Bool:
+		if t == tipe.UntypedBool {
+			// Like the universe true and false, untyped
+			// boolean constants are evaluated as bool.
+			return reflect.ValueOf(constant.BoolVal(v))
+		}
+		x = UntypedBool{constant.BoolVal(v)}
+	case constant.String:
+		x = UntypedString{constant.StringVal(v)}
+	case constant.Int:
+		if t == tipe.UntypedRune {
+			r, _ := constant.Int64Val(v)
+			x = UntypedRune{rune(r)}
+		} else {
+			i, _ := new(big.Int).SetString(v.ExactString(), 10)
+			x = UntypedInt{i}
+		}
+	case constant.Float:
+		x = UntypedFloat{bigFloat(v)}
+	case constant.Complex:
+		re, _ := constant.Float64Val(constant.ToFloat(constant.Real(v)))
+		im, _ := constant.Float64Val(constant.ToFloat(constant.Imag(v)))
+		x = UntypedComplex{big.NewFloat(re), big.NewFloat(im)}
+	default:
+		panic(interpPanic{fmt.Errorf("eval: unsupported constant %s", v)})
+	}
+	return convert(reflect.ValueOf(x), p.reflector.ToRType(t))
+}
+
+// bigFloat returns the value of the float constant v, with more
+// precision than a float64 when v is the result of big arithmetic.
+func bigFloat(v constant.Value) *big.Float {
+	switch v := constant.Val(v).(type) {
+	case *big.Float:
+		return new(big.Float).Copy(v)
+	case *big.Rat:
+		return new(big.Float).SetPrec(512).SetRat(v)
+	}
+	f, _ := constant.Float64Val(v)
+	return big.NewFloat(f)
+}
+
 type interpPanic struct {
 	reason error
 }
@@ -884,6 +1387,20 @@ func (p *Program) prepCall(e *expr.Call) (fn reflect.Value, args []reflect.Value
 		}
 		args[i] = v
 	}
+	if e.Ellipsis {
+		// f(x, y...) passes y directly as the variadic slice.
+		// Builtins like append take a []interface{}, so copy
+		// the elements over when the slice types differ.
+		last := len(args) - 1
+		want := fn.Type().In(fn.Type().NumIn() - 1)
+		if v := args[last]; v.Type() != want {
+			s := reflect.MakeSlice(want, v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				s.Index(i).Set(v.Index(i))
+			}
+			args[last] = s
+		}
+	}
 	return fn, args
 }
 
@@ -902,12 +1419,19 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			v = reflect.ValueOf(UntypedRune{val})
 		case bool:
 			v = reflect.ValueOf(UntypedBool{val})
+		case expr.Imaginary:
+			v = reflect.ValueOf(UntypedComplex{big.NewFloat(0), val.Imag})
 		default:
 			v = reflect.ValueOf(val)
 		}
-		t := p.reflector.ToRType(p.Types.Types[e])
+		t := p.reflector.ToRType(p.typeOf(e))
 		return []reflect.Value{convert(v, t)}
 	case *expr.Binary:
+		if v := p.constOf(e); v != nil && v.Kind() != constant.Unknown {
+			// Folded by the typechecker, possibly from untyped
+			// operands of different kinds, as in 'a' + 1.
+			return []reflect.Value{p.constValue(e, v)}
+		}
 		lhs := p.evalExpr(e.Left)
 		switch e.Op {
 		case token.LogicalAnd:
@@ -939,24 +1463,53 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 				}
 				return []reflect.Value{reflect.ValueOf(v)}
 			}
-			panic("comparing uncomparable type " + format.Type(p.Types.Types[e.Left]))
+			panic("comparing uncomparable type " + format.Type(p.typeOf(e.Left)))
+		}
+		x := basicValue(lhs[0])
+		y := basicValue(rhs[0])
+		if xs, isString := x.(string); isString && e.Op == token.Add {
+			ys, _ := y.(string)
+			p.alloc(len(xs) + len(ys))
 		}
-		x := lhs[0].Interface()
-		y := rhs[0].Interface()
 		v, err := binOp(e.Op, x, y)
 		if err != nil {
 			panic(interpPanic{err})
 		}
-		t := p.reflector.ToRType(p.Types.Types[e])
+		t := p.reflector.ToRType(p.typeOf(e))
+		if rv := reflect.ValueOf(v); rv.Type() != t && rv.Kind() == t.Kind() && t.PkgPath() != "" {
+			// An operation on a Go defined type, as in 2*time.Second.
+			return []reflect.Value{rv.Convert(t)}
+		}
 		return []reflect.Value{convert(reflect.ValueOf(v), t)}
 	case *expr.Call:
+		if v := p.constOf(e); v != nil && v.Kind() != constant.Unknown {
+			// A constant conversion or builtin, as in real(1 + 2i).
+			return []reflect.Value{p.constValue(e, v)}
+		}
+		switch t := p.typeOf(e.Func); t {
+		case tipe.Recover:
+			return []reflect.Value{p.recover()}
+		case tipe.Print, tipe.Println, tipe.Printf:
+			p.evalPrint(e, t.(tipe.Builtin))
+			return nil
+		}
 		fn, args := p.prepCall(e)
 		if t, isTypeConv := fn.Interface().(reflect.Type); isTypeConv {
 			return []reflect.Value{typeConv(t, args[0])}
 		}
-		res := fn.Call(args)
-		if p.builtinCalled {
-			p.builtinCalled = false
+		if fn.IsNil() {
+			panic(runtimeErrorf("invalid memory address or nil pointer dereference"))
+		}
+		p.callHook(e, args)
+		var res []reflect.Value
+		if e.Ellipsis {
+			res = fn.CallSlice(args)
+		} else {
+			res = fn.Call(args)
+		}
+		if _, isBuiltin := p.typeOf(e.Func).(tipe.Builtin); isBuiltin {
+			// Builtins with a generic result type return an
+			// interface{}, which is unboxed here.
 			for i := range res {
 				// Necessary to turn the return type of append
 				// from an interface{} into a slice so it can
@@ -980,7 +1533,8 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		t := p.reflector.ToRType(e.Type)
 		switch t.Kind() {
 		case reflect.Struct:
-			st := reflect.New(t).Elem()
+			p.alloc(1)
+			st := zeroValue(t)
 			if len(e.Keys) > 0 {
 				for i, elem := range e.Elements {
 					name := e.Keys[i].(*expr.Ident).Name
@@ -1001,15 +1555,18 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		return []reflect.Value{p.evalFuncLiteral(e, nil)}
 	case *expr.Ident:
 		if e.Name == "nil" { // TODO: make sure it's the Universe nil
-			t := p.reflector.ToRType(p.Types.Types[e])
+			t := p.reflector.ToRType(p.typeOf(e))
 			return []reflect.Value{reflect.New(t).Elem()}
 		}
+		if v := p.constOf(e); v != nil && v.Kind() != constant.Unknown {
+			return []reflect.Value{p.constValue(e, v)}
+		}
 		if v := p.Cur.Lookup(e.Name); v != (reflect.Value{}) {
 			return []reflect.Value{v}
 		}
-		t := p.Types.Types[e]
+		t := p.typeOf(e)
 		if t != nil {
-			return []reflect.Value{reflect.ValueOf(p.reflector.ToRType(p.Types.Types[e]))}
+			return []reflect.Value{reflect.ValueOf(p.reflector.ToRType(p.typeOf(e)))}
 		}
 		panic(interpPanic{fmt.Errorf("eval: undefined identifier: %q", e.Name)})
 	case *expr.Index:
@@ -1027,8 +1584,12 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			} else {
 				j = container.Len()
 			}
+			k := -1
 			if e.Max != nil {
-				k := int(p.evalExprOne(e.Max).Int())
+				k = int(p.evalExprOne(e.Max).Int())
+			}
+			checkSlice(container, i, j, k)
+			if k >= 0 {
 				return []reflect.Value{container.Slice3(i, j, k)}
 			}
 			return []reflect.Value{container.Slice(i, j)}
@@ -1043,6 +1604,9 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			if int64(i) != k.Int() {
 				panic(interpPanic{fmt.Errorf("eval: index too big: %d", k.Int())})
 			}
+			if i < 0 || i >= container.Len() {
+				panic(runtimeErrorf("index out of range [%d] with length %d", i, container.Len()))
+			}
 			return []reflect.Value{container.Index(i)}
 		case reflect.Map:
 			v := container.MapIndex(k)
@@ -1050,9 +1614,7 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			if !exists {
 				v = reflect.Zero(container.Type().Elem())
 			}
-			if t, returnExists := p.Types.Types[e].(*tipe.Tuple); returnExists {
-				// TODO: type checker is not generating this tuple yet.
-				fmt.Printf("index t=%v\n", t)
+			if _, returnExists := p.typeOf(e).(*tipe.Tuple); returnExists {
 				return []reflect.Value{v, reflect.ValueOf(exists)}
 			}
 			return []reflect.Value{v}
@@ -1063,6 +1625,7 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		}
 	case *expr.MapLiteral:
 		t := p.reflector.ToRType(e.Type)
+		p.alloc(len(e.Keys))
 		m := reflect.MakeMap(t)
 		for i, kexpr := range e.Keys {
 			k := p.evalExprOne(kexpr)
@@ -1076,6 +1639,17 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			name := e.Right.Name
 			return []reflect.Value{pkg.Exports[name]}
 		}
+		if _, isIface := tipe.Underlying(p.typeOf(e.Left)).(*tipe.Interface); !isIface && lhs.Kind() == reflect.Interface && !lhs.IsNil() {
+			lhs = lhs.Elem() // a boxed reference to a recursive type
+		}
+		if t, i, ptr := p.methodOf(p.typeOf(e.Left), e.Right.Name); t != nil {
+			return []reflect.Value{p.methodValue(lhs, t, i, ptr)}
+		}
+		if _, isIface := tipe.Underlying(p.typeOf(e.Left)).(*tipe.Interface); isIface {
+			if x, t, i, ptr := p.dynamicMethodOf(lhs, e.Right.Name); t != nil {
+				return []reflect.Value{p.methodValue(x, t, i, ptr)}
+			}
+		}
 		v := lhs.MethodByName(e.Right.Name)
 		if v == (reflect.Value{}) && lhs.Kind() != reflect.Ptr && lhs.CanAddr() {
 			v = lhs.Addr().MethodByName(e.Right.Name)
@@ -1089,6 +1663,28 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			}
 		}
 		return []reflect.Value{v}
+	case *expr.TypeAssert:
+		v := p.evalExprOne(e.Expr)
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		t := p.reflector.ToRType(e.Type)
+		ok := v.IsValid() && (v.Type() == t || t.Kind() == reflect.Interface && v.Type().Implements(t))
+		res := reflect.New(t).Elem()
+		if ok {
+			res.Set(v)
+		}
+		if _, commaOk := p.typeOf(e).(*tipe.Tuple); commaOk {
+			return []reflect.Value{res, reflect.ValueOf(ok)}
+		}
+		if !ok {
+			dyn := "nil"
+			if v.IsValid() {
+				dyn = v.Type().String()
+			}
+			panic(Panic{val: fmt.Errorf("interface conversion: interface is %s, not %s", dyn, t)})
+		}
+		return []reflect.Value{res}
 	case *expr.Shell:
 		p.pushScope()
 		defer p.popScope()
@@ -1117,7 +1713,7 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		for _, cmd := range e.Cmds {
 			j := &shell.Job{
 				Cmd:    cmd,
-				Params: p,
+				Params: shellParams{p},
 				Stdin:  os.Stdin,
 				Stdout: out,
 				Stderr: os.Stderr,
@@ -1151,18 +1747,33 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		errt := reflect.TypeOf((*error)(nil)).Elem()
 		nilerr := reflect.New(errt).Elem()
 		return []reflect.Value{str, nilerr}
+	case *expr.ArrayLiteral:
+		t := p.reflector.ToRType(e.Type)
+		p.alloc(t.Len())
+		array := reflect.New(t).Elem()
+		for i, elem := range e.Elems {
+			v := p.evalExprOne(elem)
+			array.Index(i).Set(v)
+		}
+		return []reflect.Value{array}
 	case *expr.SliceLiteral:
 		t := p.reflector.ToRType(e.Type)
+		p.alloc(len(e.Elems))
 		slice := reflect.MakeSlice(t, len(e.Elems), len(e.Elems))
 		for i, elem := range e.Elems {
 			v := p.evalExprOne(elem)
 			slice.Index(i).Set(v)
 		}
 		return []reflect.Value{slice}
+	case *expr.TableLiteral:
+		return []reflect.Value{reflect.ValueOf(p.evalTableLiteral(e))}
 	case *expr.Type:
 		t := p.reflector.ToRType(e.Type)
 		return []reflect.Value{reflect.ValueOf(t)}
 	case *expr.Unary:
+		if v := p.constOf(e); v != nil && v.Kind() != constant.Unknown {
+			return []reflect.Value{p.constValue(e, v)}
+		}
 		var v reflect.Value
 		switch e.Op {
 		case token.LeftParen:
@@ -1172,10 +1783,14 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 			return []reflect.Value{v.Addr()}
 		case token.Mul: // deref
 			v := p.evalExprOne(e.Expr)
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				panic(runtimeErrorf("invalid memory address or nil pointer dereference"))
+			}
 			return []reflect.Value{v.Elem()}
 		case token.Not:
-			v = p.evalExprOne(e.Expr)
-			v.SetBool(!v.Bool())
+			v = reflect.ValueOf(!p.evalExprOne(e.Expr).Bool())
+		case token.Xor:
+			v = complementOp(p.evalExprOne(e.Expr))
 		case token.Sub:
 			rhs := p.evalExprOne(e.Expr)
 			var lhs interface{}
@@ -1196,6 +1811,10 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 				lhs = UntypedInt{big.NewInt(0)}
 			case UntypedFloat:
 				lhs = UntypedFloat{big.NewFloat(0)}
+			case *big.Int:
+				lhs = big.NewInt(0)
+			case *big.Float:
+				lhs = big.NewFloat(0)
 			}
 			res, err := binOp(token.Sub, lhs, rhs.Interface())
 			if err != nil {
@@ -1205,16 +1824,39 @@ func (p *Program) evalExpr(e expr.Expr) []reflect.Value {
 		case token.ChanOp:
 			ch := p.evalExprOne(e.Expr)
 			res, ok := ch.Recv()
-			_ = ok // TODO
+			if _, commaOk := p.typeOf(e).(*tipe.Tuple); commaOk {
+				return []reflect.Value{res, reflect.ValueOf(ok)}
+			}
 			v = res
 		}
-		t := p.reflector.ToRType(p.Types.Types[e])
+		t := p.reflector.ToRType(p.typeOf(e))
 		return []reflect.Value{convert(v, t)}
 	}
 	panic(interpPanic{fmt.Errorf("TODO evalExpr(%s), %T", format.Expr(e), e)})
 }
 
-func (p *Program) evalFuncLiteral(e *expr.FuncLiteral, recvt *tipe.Methodik) reflect.Value {
+// checkSlice panics with a runtime error if the slice expression
+// v[i:j:k] is out of range. A negative k means v[i:j].
+func checkSlice(v reflect.Value, i, j, k int) {
+	max := v.Len()
+	if v.Kind() == reflect.Slice {
+		max = v.Cap()
+	}
+	if k >= 0 {
+		if k > max {
+			panic(runtimeErrorf("slice bounds out of range [::%d] with capacity %d", k, max))
+		}
+		max = k
+	}
+	if j > max {
+		panic(runtimeErrorf("slice bounds out of range [:%d] with capacity %d", j, max))
+	}
+	if i > j || i < 0 {
+		panic(runtimeErrorf("slice bounds out of range [%d:%d]", i, j))
+	}
+}
+
+func (p *Program) evalFuncLiteral(e *expr.FuncLiteral, recvt *tipe.Named) reflect.Value {
 	s := &Scope{
 		Parent: p.Universe,
 	}
@@ -1232,20 +1874,43 @@ func (p *Program) evalFuncLiteral(e *expr.FuncLiteral, recvt *tipe.Methodik) ref
 		params := make([]tipe.Type, 1+len(funct.Params.Elems))
 		copy(params[1:], funct.Params.Elems)
 		params[0] = &tipe.Interface{} // not recvt, breaking cycle
-		funct.Params = &tipe.Tuple{params}
+		funct.Params = &tipe.Tuple{Elems: params}
 	}
 	rt := p.reflector.ToRType(&funct)
 	fn := reflect.MakeFunc(rt, func(args []reflect.Value) (results []reflect.Value) {
 		p := &Program{
 			Universe:  p.Universe,
-			Types:     p.Types, // TODO race cond, clone type list
+			Types:     p.Types,
 			Cur:       s,
 			reflector: p.reflector,
-		}
+			typesMu:   p.typesMu,
+			ctx:       p.ctx,
+			usage:     p.usage,
+			hooks:     p.hooks,
+			goErr:     p.goErr,
+			stdout:    p.stdout,
+			panicking: takePendingPanic(),
+		}
+		p.step()
+		p.enterCall()
+		defer p.exitCall()
+		defer func() {
+			if len(p.defers) == 0 {
+				return
+			}
+			p.runDefers(recover())
+			if results == nil {
+				// Recovered from a panic.
+				results = make([]reflect.Value, rt.NumOut())
+				for i := range results {
+					results[i] = reflect.Zero(rt.Out(i))
+				}
+			}
+		}()
 		p.pushScope()
 		defer p.popScope()
 		if recvt != nil {
-			// TODO args[0]
+			p.bindReceiver(e, recvt, args[0])
 			args = args[1:]
 		}
 		for i, name := range e.ParamNames {
@@ -1268,20 +1933,87 @@ func (p *Program) evalFuncLiteral(e *expr.FuncLiteral, recvt *tipe.Methodik) ref
 	return fn
 }
 
-// TODO make thread safe
+// A reflector is shared by the frames of a Program, which may be
+// running on several goroutines, so mu guards its maps.
 type reflector struct {
+	mu sync.Mutex
+
 	fwd map[tipe.Type]reflect.Type
 	rev map[reflect.Type]tipe.Type
+
+	// building holds the defined types whose reflect type is
+	// being made. The reflect package cannot make a recursive
+	// type, so a reference to one of these, as in
+	// struct{ next *list }, is an interface{} holding the
+	// reference. See unbox.
+	building map[*tipe.Named]bool
+
+	// methods holds the implementations of the methods of
+	// types declared by a methodik, in the order of MethodNames.
+	// See method.go.
+	methods map[*tipe.Named][]reflect.Value
 }
 
 func newReflector() *reflector {
 	return &reflector{
-		fwd: make(map[tipe.Type]reflect.Type),
-		rev: make(map[reflect.Type]tipe.Type),
+		fwd:      make(map[tipe.Type]reflect.Type),
+		rev:      make(map[reflect.Type]tipe.Type),
+		building: make(map[*tipe.Named]bool),
+		methods:  make(map[*tipe.Named][]reflect.Value),
+	}
+}
+
+// defineNamed makes the reflect type of the defined type t.
+func (r *reflector) defineNamed(t *tipe.Named) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.building[t] = true
+	r.fwd[t] = r.toRType(t.Type)
+	delete(r.building, t)
+}
+
+func (r *reflector) setBuilding(t *tipe.Named, building bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if building {
+		r.building[t] = true
+	} else {
+		delete(r.building, t)
 	}
 }
 
+func (r *reflector) setRType(t tipe.Type, rtype reflect.Type) {
+	r.mu.Lock()
+	r.fwd[t] = rtype
+	r.mu.Unlock()
+}
+
+// isBuilding reports whether t is a defined type being made.
+func (r *reflector) isBuilding(t tipe.Type) bool {
+	named, ok := tipe.Unalias(t).(*tipe.Named)
+	return ok && r.building[named]
+}
+
+// unbox returns v as a value of type t, taking it out of the
+// interface{} that holds a reference to a recursive type.
+func unbox(v reflect.Value, t reflect.Type) reflect.Value {
+	if v.Kind() != reflect.Interface || t.Kind() == reflect.Interface {
+		return v
+	}
+	if v.IsNil() {
+		return reflect.Zero(t)
+	}
+	return v.Elem()
+}
+
+// ToRType returns the reflect type that holds values of t.
 func (r *reflector) ToRType(t tipe.Type) reflect.Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.toRType(t)
+}
+
+func (r *reflector) toRType(t tipe.Type) reflect.Type {
 	if t == nil {
 		return nil
 	}
@@ -1300,7 +2032,11 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		r.fwd[t] = rtype
 		return rtype
 	}
-	t = tipe.Unalias(t)
+	if alias, isAlias := t.(*tipe.Alias); isAlias {
+		rtype = r.toRType(alias.Type)
+		r.fwd[t] = rtype
+		return rtype
+	}
 	switch t := t.(type) {
 	case tipe.Basic:
 		switch t {
@@ -1311,9 +2047,9 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		case tipe.Bool:
 			rtype = reflect.TypeOf(false)
 		case tipe.Integer:
-			rtype = reflect.TypeOf((*big.Int)(nil))
+			rtype = bigIntType
 		case tipe.Float:
-			rtype = reflect.TypeOf((*big.Float)(nil))
+			rtype = bigFloatType
 		case tipe.Complex:
 			panic("TODO rtype for Complex")
 		case tipe.String:
@@ -1338,6 +2074,8 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 			rtype = reflect.TypeOf(uint32(0))
 		case tipe.Uint64:
 			rtype = reflect.TypeOf(uint64(0))
+		case tipe.Uintptr:
+			rtype = reflect.TypeOf(uintptr(0))
 		case tipe.Float32:
 			rtype = reflect.TypeOf(float32(0))
 		case tipe.Float64:
@@ -1359,18 +2097,18 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		case tipe.UntypedBool:
 			rtype = reflect.TypeOf(UntypedBool{})
 		case tipe.UntypedComplex:
-			panic("TODO Untyped Complex")
+			rtype = reflect.TypeOf(UntypedComplex{})
 		}
 	case *tipe.Func:
 		var in, out []reflect.Type
 		if t.Params != nil {
 			for _, p := range t.Params.Elems {
-				in = append(in, r.ToRType(p))
+				in = append(in, r.toRType(p))
 			}
 		}
 		if t.Results != nil {
 			for _, p := range t.Results.Elems {
-				out = append(out, r.ToRType(p))
+				out = append(out, r.toRType(p))
 			}
 		}
 		rtype = reflect.FuncOf(in, out, t.Variadic)
@@ -1379,17 +2117,23 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		for i, f := range t.Fields {
 			fields = append(fields, reflect.StructField{
 				Name: t.FieldNames[i],
-				Type: r.ToRType(f),
+				Type: r.toRType(f),
 			})
 		}
 		rtype = reflect.StructOf(fields)
-	case *tipe.Methodik:
+	case *tipe.Named:
 		if t.PkgPath != "" {
 			path := t.PkgPath
 			if path == "neugram.io/ng/vendor/mat" {
 				path = "mat" // TODO: remove "mat" exception
 			}
-			v := gowrap.Pkgs[path].Exports[t.Name]
+			var v reflect.Value
+			if pkg := gowrap.Pkgs[path]; pkg != nil {
+				v = pkg.Exports[t.Name]
+			}
+			if !v.IsValid() {
+				panic(interpPanic{fmt.Errorf("Go type %s.%s is not in the wrapper of package %q", t.PkgName, t.Name, path)})
+			}
 			if typ, isType := v.Interface().(reflect.Type); isType {
 				rtype = typ
 			} else if _, isIface := tipe.Underlying(t).(*tipe.Interface); isIface {
@@ -1398,16 +2142,29 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 				rtype = v.Type()
 			}
 		} else {
-			panic("TODO unnamed Methodik")
+			panic("TODO unnamed Named")
 		}
 	case *tipe.Array:
-		rtype = reflect.ArrayOf(int(t.Len), r.ToRType(t.Elem))
+		rtype = reflect.ArrayOf(int(t.Len), r.toRType(t.Elem))
 	case *tipe.Slice:
-		rtype = reflect.SliceOf(r.ToRType(t.Elem))
-	// TODO case *Table:
+		if r.isBuilding(t.Elem) {
+			rtype = emptyIfaceType
+			break
+		}
+		rtype = reflect.SliceOf(r.toRType(t.Elem))
+	case *tipe.Table:
+		rtype = tableType
 	case *tipe.Pointer:
-		rtype = reflect.PtrTo(r.ToRType(t.Elem))
+		if r.isBuilding(t.Elem) {
+			rtype = emptyIfaceType
+			break
+		}
+		rtype = reflect.PtrTo(r.toRType(t.Elem))
 	case *tipe.Chan:
+		if r.isBuilding(t.Elem) {
+			rtype = emptyIfaceType
+			break
+		}
 		var dir reflect.ChanDir
 		switch t.Direction {
 		case tipe.ChanBoth:
@@ -1419,9 +2176,13 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		default:
 			panic(fmt.Sprintf("bad channel direction: %v", t.Direction))
 		}
-		rtype = reflect.ChanOf(dir, r.ToRType(t.Elem))
+		rtype = reflect.ChanOf(dir, r.toRType(t.Elem))
 	case *tipe.Map:
-		rtype = reflect.MapOf(r.ToRType(t.Key), r.ToRType(t.Value))
+		if r.isBuilding(t.Value) {
+			rtype = emptyIfaceType
+			break
+		}
+		rtype = reflect.MapOf(r.toRType(t.Key), r.toRType(t.Value))
 	// TODO case *Interface:
 	// TODO need more reflect support, MakeInterface
 	// TODO needs reflect.InterfaceOf
@@ -1431,7 +2192,7 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 		if typecheck.IsError(t) {
 			rtype = reflect.TypeOf((*error)(nil)).Elem()
 		} else {
-			rtype = reflect.TypeOf((*interface{})(nil)).Elem()
+			rtype = emptyIfaceType
 		}
 	}
 	r.fwd[t] = rtype
@@ -1439,6 +2200,8 @@ func (r *reflector) ToRType(t tipe.Type) reflect.Type {
 }
 
 func (r *reflector) FromRType(rtype reflect.Type) tipe.Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if t := r.rev[rtype]; t != nil {
 		return t
 	}
@@ -1462,6 +2225,9 @@ func (p Panic) Error() string {
 var devNull *os.File
 
 func init() {
+	if runtime.GOOS == "js" {
+		return // no shell commands to discard the output of
+	}
 	var err error
 	devNull, err = os.Open("/dev/null")
 	if err != nil {
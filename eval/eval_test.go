@@ -5,14 +5,22 @@
 package eval
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 
@@ -20,6 +28,8 @@ import (
 	"neugram.io/ng/eval/shell"
 	"neugram.io/ng/parser"
 	"neugram.io/ng/stmt"
+	"neugram.io/ng/table"
+	"neugram.io/ng/tipe"
 )
 
 var exprTests = []struct {
@@ -78,14 +88,14 @@ var exprTests = []struct {
 }
 
 func mkBasicProgram() (*Program, error) {
-	p := New("basic")
-	if _, err := p.Eval(mustParse("x := 4"), nil); err != nil {
+	p := New(Options{Path: "basic"})
+	if _, err := p.EvalStmt(mustParse("x := 4"), nil); err != nil {
 		return nil, err
 	}
-	if _, err := p.Eval(mustParse("y := 5"), nil); err != nil {
+	if _, err := p.EvalStmt(mustParse("y := 5"), nil); err != nil {
 		return nil, err
 	}
-	if _, err := p.Eval(mustParse("z := 7"), nil); err != nil {
+	if _, err := p.EvalStmt(mustParse("z := 7"), nil); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -98,7 +108,7 @@ func TestExprs(t *testing.T) {
 			t.Fatalf("mkBasicProgram: %v", err)
 		}
 		s := mustParse(test.stmt)
-		res, err := p.Eval(s, nil)
+		res, err := p.EvalStmt(s, nil)
 		if err != nil {
 			t.Errorf("Eval(%s) error: %v", pretty.Sprint(s), err)
 		}
@@ -143,8 +153,853 @@ func mustParse(src string) stmt.Stmt {
 	return expr
 }
 
+var printTests = []struct {
+	stmts []string
+	want  string
+}{
+	{[]string{`print("a", 1, nil)`}, "a 1 <nil>\n"},
+	{[]string{`println(2.5, true)`}, "2.5 true\n"},
+	{[]string{`printf("%d|%5.2f|%q|%-3v|\n", 7, 3.14159, "s", 1)`}, "7| 3.14|\"s\"|1  |\n"},
+	{[]string{`printf("%T %T %T %%T\n", 1, "s", 2.5)`}, "int string float64 %T\n"},
+	{[]string{`var x integer = 1 << 70`, `printf("%d %T\n", x, x)`}, "1180591620717411303424 integer\n"},
+	{[]string{`var f float = 0.5`, `var i interface{} = f`, `printf("%v %T\n", f, i)`}, "0.5 float\n"},
+	{[]string{`w := 4`, `printf("%*d|%-*T|\n", w, 1, w, 1)`}, "   1|int |\n"},
+	{[]string{`xs := []interface{}{1, "a"}`, `print(xs...)`, `printf("%v-%v\n", xs...)`}, "1 a\n1-a\n"},
+	{
+		[]string{
+			`methodik T struct{ N int } { func (t) String() string { return "T!" } }`,
+			`methodik P struct{ N int } { func (*p) String() string { return "P!" } }`,
+			`t, p := T{N: 1}, &P{N: 2}`,
+			`printf("%v %s %T %v %T\n", t, t, t, p, p)`,
+		},
+		"T! T! T P! *P\n",
+	},
+}
+
+func TestPrint(t *testing.T) {
+	origStdout := os.Stdout
+	defer func() { os.Stdout = origStdout }()
+
+	for _, test := range printTests {
+		out, err := ioutil.TempFile("", "print.stdout.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(out.Name())
+		os.Stdout = out
+		p := New(Options{Path: "print"})
+		for _, str := range test.stmts {
+			if _, err = p.EvalStmt(mustParse(str), nil); err != nil {
+				break
+			}
+		}
+		os.Stdout = origStdout
+		if err2 := out.Close(); err2 != nil {
+			t.Fatal(err2)
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.stmts, err)
+			continue
+		}
+		b, err := ioutil.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != test.want {
+			t.Errorf("%q: printed %q, want %q", test.stmts, got, test.want)
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	p := New(Options{Path: "cancel"})
+	for _, str := range []string{
+		`for {}`,
+		`func() { for {} }()`,
+		`func() { defer func() { recover() }(); for {} }()`,
+		`for { func() {}() }`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := p.EvalContext(ctx, mustParse(str))
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("EvalContext(%q) error: %v, want %v", str, err, context.DeadlineExceeded)
+		}
+	}
+	if _, err := p.EvalStmt(mustParse("x := 1"), nil); err != nil {
+		t.Errorf("after cancel, EvalStmt(x := 1) error: %v", err)
+	}
+
+	sigint := make(chan os.Signal, 1)
+	sigint <- os.Interrupt
+	if _, err := p.EvalStmt(mustParse("for {}"), sigint); err != ErrInterrupted {
+		t.Errorf("EvalStmt with interrupt error: %v, want %v", err, ErrInterrupted)
+	}
+}
+
+var limitsTests = []struct {
+	limits Limits
+	stmts  []string
+	want   string // error substring
+}{
+	{Limits{Steps: 1000}, []string{`for {}`}, "step limit of 1000 exceeded"},
+	{Limits{Steps: 1000}, []string{`func f() { for {} }`, `func() { defer func() { recover() }(); f() }()`, `for {}`}, "step limit"},
+	{Limits{CallDepth: 50}, []string{`var f func(int) int`, `f = func(n int) int { return f(n + 1) }`, `f(0)`}, "call depth limit of 50 exceeded"},
+	{Limits{Cells: 100}, []string{`s := make([]int, 101)`}, "memory limit of 100 cells exceeded"},
+	{Limits{Cells: 100}, []string{`s := []int{1, 2}`, `for { s = append(s, s...) }`}, "memory limit"},
+	{Limits{Cells: 1 << 20}, []string{`x := "ab"`, `for { x = x + x }`}, "memory limit"},
+	{Limits{Steps: 1000, CallDepth: 10, Cells: 100}, []string{`func f(n int) int { return n * 2 }`, `x := f(f(3))`}, ""},
+	{Limits{TableCells: 5}, []string{`t := [|]int{{1, 2}, {3, 4}}`, `u := [|]int{{5, 6}}`}, "table limit of 5 cells exceeded"},
+	{Limits{Cells: 2}, []string{`t := [|]int{{1, 2}, {3, 4}}`}, ""},
+}
+
+func TestLimits(t *testing.T) {
+	for _, test := range limitsTests {
+		p := New(Options{Path: "limits"})
+		p.SetLimits(test.limits)
+		var err error
+		for _, str := range test.stmts {
+			if _, err = p.EvalStmt(mustParse(str), nil); err != nil {
+				break
+			}
+		}
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%q: %v", test.stmts, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%q: error %v, want %q", test.stmts, err, test.want)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	var out bytes.Buffer
+	p := New(Options{Path: "embed", Stdout: &out})
+	if err := p.Set("x", 2); err != nil {
+		t.Fatalf("Set(x, 2): %v", err)
+	}
+	if err := p.Set("names", []string{"a", "b"}); err != nil {
+		t.Fatalf("Set(names): %v", err)
+	}
+	res, err := p.Eval("y := x * 21\nprintln(len(names), names[1])\ny + 1")
+	if err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if len(res) != 1 || res[0] != 43 {
+		t.Errorf("Eval result: %v, want [43]", res)
+	}
+	if got, want := out.String(), "2 b\n"; got != want {
+		t.Errorf("output: %q, want %q", got, want)
+	}
+	if y, ok := p.Get("y"); !ok || y != 42 {
+		t.Errorf(`Get("y") = %v, %v, want 42, true`, y, ok)
+	}
+	if err := p.Set("y", 7); err != nil {
+		t.Errorf("Set(y, 7): %v", err)
+	}
+	if y, _ := p.Get("y"); y != 7 {
+		t.Errorf(`after Set, Get("y") = %v, want 7`, y)
+	}
+	if err := p.Set("y", "seven"); err == nil {
+		t.Errorf("Set(y, string) succeeded, want type error")
+	}
+	if _, err := p.Eval("const c = 1 << 70"); err != nil {
+		t.Fatalf("Eval(const): %v", err)
+	}
+	if c, ok := p.Get("c"); !ok || c.(*big.Int).Cmp(new(big.Int).Lsh(big.NewInt(1), 70)) != 0 {
+		t.Errorf(`Get("c") = %v, %v, want 1<<70, true`, c, ok)
+	}
+	if _, ok := p.Get("len"); ok {
+		t.Errorf(`Get("len") found a builtin`)
+	}
+	if _, ok := p.Get("nosuch"); ok {
+		t.Errorf(`Get("nosuch") found a variable`)
+	}
+	if err := p.Set("d", time.Second); err != nil {
+		t.Fatalf("Set(d, time.Second): %v", err)
+	}
+	if res, err := p.Eval("d / 1000"); err != nil || len(res) != 1 || res[0] != int64(1e6) {
+		t.Errorf("Eval(d / 1000) = %v, %v, want [1000000]", res, err)
+	}
+	if _, err := p.Eval("z := undefined"); err == nil {
+		t.Errorf("Eval of undefined name succeeded")
+	}
+	if _, err := p.Eval("if true {"); err == nil {
+		t.Errorf("Eval of partial statement succeeded")
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	var out bytes.Buffer
+	p := New(Options{Path: "register", Stdout: &out})
+	fetch := func(url string) (string, error) {
+		if url == "" {
+			return "", errors.New("no url")
+		}
+		return "page " + url, nil
+	}
+	for name, fn := range map[string]interface{}{
+		"fetch": fetch,
+		"sleep": func(d time.Duration) time.Duration { return d * 2 },
+		"sum": func(xs ...int) (n int) {
+			for _, x := range xs {
+				n += x
+			}
+			return n
+		},
+	} {
+		if err := p.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s): %v", name, err)
+		}
+	}
+	src := `page, err := fetch("a")
+println(page, err)
+_, err = fetch("")
+println(err)
+println(sleep(3), sum(1, 2, 3), sum())`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if got, want := out.String(), "page a <nil>\nno url\n6 6 0\n"; got != want {
+		t.Errorf("output: %q, want %q", got, want)
+	}
+	if err := p.RegisterFunc("x", 1); err == nil {
+		t.Errorf("RegisterFunc of an int succeeded")
+	}
+	if err := p.RegisterFunc("f", func(...time.Duration) {}); err == nil {
+		t.Errorf("RegisterFunc of a func(...time.Duration) succeeded")
+	}
+}
+
+func TestBind(t *testing.T) {
+	type config struct {
+		Name    string
+		Retries int
+		Tags    []string
+	}
+	cfg := config{Name: "a", Tags: []string{"x"}}
+	limits := config{Name: "limits", Retries: 3}
+	p := New(Options{Path: "bind"})
+	if err := p.Bind("cfg", &cfg); err != nil {
+		t.Fatalf("Bind(cfg): %v", err)
+	}
+	if err := p.BindReadOnly("limits", &limits); err != nil {
+		t.Fatalf("BindReadOnly(limits): %v", err)
+	}
+	if _, err := p.Eval("cfg.Retries = limits.Retries + 1\ncfg.Name += \"b\""); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if cfg.Retries != 4 || cfg.Name != "ab" {
+		t.Errorf("after Eval, cfg = %+v, want Retries 4, Name ab", cfg)
+	}
+	limits.Retries = 10
+	if res, err := p.Eval("limits.Retries"); err != nil || len(res) != 1 || res[0] != 10 {
+		t.Errorf("Eval(limits.Retries) = %v, %v, want [10]", res, err)
+	}
+	for _, src := range []string{
+		"limits.Retries = 1",
+		"limits = cfg",
+		"limits.Retries++",
+		"l := &limits",
+	} {
+		_, err := p.Eval(src)
+		if err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("Eval(%q) error: %v, want read-only error", src, err)
+		}
+	}
+	if _, err := p.Eval("x := limits\nx.Retries = 0"); err != nil {
+		t.Errorf("modifying a copy of a read-only variable: %v", err)
+	}
+	if limits.Retries != 10 {
+		t.Errorf("limits.Retries = %d, want 10", limits.Retries)
+	}
+
+	if err := p.Bind("n", 1); err == nil {
+		t.Errorf("Bind of a non-pointer succeeded")
+	}
+	var d struct{ D time.Duration }
+	if err := p.Bind("d", &d); err == nil {
+		t.Errorf("Bind of a struct with a time.Duration field succeeded")
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	p := New(Options{Path: "getinto"})
+	src := `methodik point struct {
+	X int
+	Y int
+	Label string
+} {
+	func (p) Norm() int { return p.X*p.X + p.Y*p.Y }
+}
+pts := []point{point{X: 1, Y: 2, Label: "a"}, point{X: 3, Label: "b"}}
+counts := map[string]int{"a": 1, "b": 1 << 40}
+grid := [2][]float64{[]float64{1.5}, []float64{2, 3}}
+var ptr *point = &pts[0]
+big := integer(1) << 70
+const c = 7
+var any interface{} = pts[1]`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+
+	type row struct {
+		Label string
+		X     int64
+		Y     float32
+	}
+	var rows []row
+	if err := p.GetInto("pts", &rows); err != nil {
+		t.Errorf("GetInto(pts): %v", err)
+	} else if want := []row{{"a", 1, 2}, {"b", 3, 0}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("GetInto(pts) = %+v, want %+v", rows, want)
+	}
+	var counts map[string]int64
+	if err := p.GetInto("counts", &counts); err != nil || counts["b"] != 1<<40 {
+		t.Errorf("GetInto(counts) = %v, %v", counts, err)
+	}
+	var grid [][]float64
+	if err := p.GetInto("grid", &grid); err != nil || len(grid) != 2 || grid[1][1] != 3 {
+		t.Errorf("GetInto(grid) = %v, %v", grid, err)
+	}
+	var ptr *row
+	if err := p.GetInto("ptr", &ptr); err != nil || ptr == nil || ptr.Label != "a" {
+		t.Errorf("GetInto(ptr) = %+v, %v", ptr, err)
+	}
+	var c uint8
+	if err := p.GetInto("c", &c); err != nil || c != 7 {
+		t.Errorf("GetInto(c) = %v, %v", c, err)
+	}
+	var anyRow row
+	if err := p.GetInto("any", &anyRow); err != nil || anyRow.Label != "b" {
+		t.Errorf("GetInto(any) = %+v, %v", anyRow, err)
+	}
+	var bigInt *big.Int
+	if err := p.GetInto("big", &bigInt); err != nil || bigInt.BitLen() != 71 {
+		t.Errorf("GetInto(big) = %v, %v", bigInt, err)
+	}
+	var iface interface{}
+	if err := p.GetInto("c", &iface); err != nil || iface != 7 {
+		t.Errorf("GetInto(c) into interface{} = %v, %v", iface, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		dst  interface{}
+		want string
+	}{
+		{"big", new(int64), "big (1180591620717411303424) overflows int64"},
+		{"counts", new(map[string]int32), `counts[b] (1099511627776) overflows int32`},
+		{"pts", new([]struct{ Z int }), "pts[0] has no field Z"},
+		{"pts", new([]struct{ Label int }), "cannot store pts[0].Label (type string) in a int"},
+		{"grid", new([3][]float64), "cannot store grid (length 2) in a [3][]float64"},
+		{"grid", new([][]int), "cannot store grid[0][0] (type float64) in a int"},
+		{"nosuch", new(int), "no such variable"},
+		{"c", 0, "not a non-nil pointer"},
+	} {
+		err := p.GetInto(test.name, test.dst)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("GetInto(%s, %T) error: %v, want %q", test.name, test.dst, err, test.want)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	var out bytes.Buffer
+	p := New(Options{Path: "tables", Stdout: &out})
+	src := `t := [|"name" string, "x", "y"|]float64{{"a", 1, 2.5}, {"b", 3, 4}}
+print(t)`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if got, want := out.String(), "name  x  y\na     1  2.5\nb     3  4\n"; got != want {
+		t.Errorf("print(t) = %q, want %q", got, want)
+	}
+	v, _ := p.Get("t")
+	tbl, ok := v.(*table.Table)
+	if !ok {
+		t.Fatalf("Get(t) = %T, want *table.Table", v)
+	}
+	if tbl.Len() != 2 || !reflect.DeepEqual(tbl.Cols(), []string{"name", "x", "y"}) {
+		t.Errorf("t has %d rows, columns %q", tbl.Len(), tbl.Cols())
+	}
+	if y := tbl.Column(tbl.ColumnIndex("y")); !reflect.DeepEqual(y, []float64{2.5, 4}) {
+		t.Errorf("column y = %v", y)
+	}
+
+	type row struct {
+		Name string
+		Y    float32
+	}
+	var rows []row
+	if err := p.GetInto("t", &rows); err != nil {
+		t.Errorf("GetInto(t): %v", err)
+	} else if want := []row{{"a", 2.5}, {"b", 4}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("GetInto(t) = %+v, want %+v", rows, want)
+	}
+	var cp *table.Table
+	if err := p.GetInto("t", &cp); err != nil || cp == tbl || cp.Len() != 2 {
+		t.Errorf("GetInto(t) copy = %v, %v", cp, err)
+	}
+	if err := p.GetInto("t", new([][]float64)); err == nil || !strings.Contains(err.Error(), "cannot store t[0][0] (type string) in a float64") {
+		t.Errorf("GetInto(t, [][]float64) error: %v", err)
+	}
+	if err := p.GetInto("t", new([]struct{ Z int })); err == nil || !strings.Contains(err.Error(), "t has no column Z") {
+		t.Errorf("GetInto(t, []struct{Z int}) error: %v", err)
+	}
+
+	g, err := table.New(table.Column{Name: "n", Type: reflect.TypeOf(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.AppendRow(1)
+	g.AppendRow(2)
+	if err := p.Set("g", g); err != nil {
+		t.Fatalf("Set(g): %v", err)
+	}
+	if res, err := p.Eval("len(g) * 10 + cols(g)"); err != nil || len(res) != 1 || res[0] != 21 {
+		t.Errorf("len and cols of g = %v, %v, want 21", res, err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	p := New(Options{Path: "snapshot"})
+	src := `import "strings"
+type celsius float64
+base := celsius(20)
+methodik counter struct {
+	N int
+} {
+	func (c) Label() string { return strings.Repeat("*", c.N) }
+}
+const step = 2
+func warmer(c celsius) celsius { return c + base + step }
+x := "shadowed"
+x := counter{N: 3}
+temps := map[string]celsius{"a": warmer(1)}
+total := integer(1) << 80
+ch := make(chan int)
+double := func(n int) int { return n * 2 }`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	blob, err := p.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if _, err := p.Eval("base = 100"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	q, err := Restore(blob, Options{Stdout: &out})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if q.Path != "snapshot" {
+		t.Errorf("restored Path = %q, want snapshot", q.Path)
+	}
+	check := `printf("%v %v %v %s %v\n", base, warmer(1), temps["a"], x.Label(), total)
+printf("%v %v\n", ch == nil, double == nil)`
+	if _, err := q.Eval(check); err != nil {
+		t.Fatalf("Eval after Restore: %v", err)
+	}
+	if got, want := out.String(), "20 23 23 *** 1208925819614629174706176\ntrue true\n"; got != want {
+		t.Errorf("restored program printed %q, want %q", got, want)
+	}
+
+	blob2, err := q.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot of restored program: %v", err)
+	}
+	if _, err := Restore(blob2, Options{}); err != nil {
+		t.Errorf("Restore of restored program: %v", err)
+	}
+	if _, err := Restore([]byte("junk"), Options{}); err == nil {
+		t.Errorf("Restore of junk succeeded")
+	}
+}
+
+func TestConcurrentEval(t *testing.T) {
+	p := New(Options{Path: "concurrent"})
+	if _, err := p.Eval("n := 0"); err != nil {
+		t.Fatal(err)
+	}
+	const workers, evals = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("v%d", i)
+			for j := 0; j < evals; j++ {
+				if _, err := p.Eval("n++"); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := p.Set(name, j); err != nil {
+					t.Error(err)
+					return
+				}
+				if v, ok := p.Get(name); !ok || v != j {
+					t.Errorf("Get(%s) = %v, %v, want %d", name, v, ok, j)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n, _ := p.Get("n"); n != workers*evals {
+		t.Errorf("n = %v, want %d", n, workers*evals)
+	}
+}
+
+func TestEvalGoroutines(t *testing.T) {
+	p := New(Options{Path: "goroutines"})
+	if _, err := p.Eval("x := 0"); err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := p.Eval("x++"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The parser of each Eval ends its goroutine once closed.
+	var n int
+	for i := 0; i < 100; i++ {
+		if n = runtime.NumGoroutine(); n <= before+5 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("%d goroutines after 100 Evals, %d before", n, before)
+}
+
+func TestGoroutinePanic(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want string
+	}{
+		{`go func() { for {} }()`, "step limit of 1000 exceeded (in goroutine)"},
+		{`go func() { panic("boom") }()`, "boom (in goroutine)"},
+	} {
+		p := New(Options{Limits: Limits{Steps: 1000}})
+		if _, err := p.Eval(test.src); err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+			_, err = p.Eval("x := 1")
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: Eval error %v, want %q", test.src, err, test.want)
+		}
+		if _, err := p.Eval("y := 2"); err != nil {
+			t.Errorf("%q: Eval after the goroutine error: %v", test.src, err)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	const v1 = `methodik counter struct {
+	N int
+} {
+	func (c) Label() string { return "v1" }
+}
+c := counter{N: 1}
+hits := 0
+func handle() string {
+	hits++
+	return "v1 " + c.Label()
+}
+var mode string = "a"
+`
+	const v2 = `methodik counter struct {
+	N int
+} {
+	func (c) Label() string { return "v2" }
+}
+c := counter{N: 1}
+hits := 0
+func handle() string {
+	hits++
+	return "v2 " + c.Label()
+}
+var mode int = 2
+extra := 9
+handle()
+`
+	dir, err := ioutil.TempDir("", "ng-reload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "script.ng")
+	if err := ioutil.WriteFile(path, []byte(v1), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(Options{Path: path})
+	if _, err := p.Reload(path); err != nil {
+		t.Fatalf("first Reload: %v", err)
+	}
+	if _, err := p.Eval("c.N = 5\nh := func() string { return handle() }\nh()"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(v2), 0666); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := p.Reload(path)
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := []ReloadConflict{{Name: "mode", Old: "string", New: "int"}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+	res, err := p.Eval("h()")
+	if err != nil || len(res) != 1 || res[0] != "v2 v2" {
+		t.Errorf("h() after Reload = %v, %v, want v2 v2", res, err)
+	}
+	for name, want := range map[string]interface{}{"hits": 2, "mode": 2, "extra": 9} {
+		if v, _ := p.Get(name); v != want {
+			t.Errorf("%s = %v, want %v", name, v, want)
+		}
+	}
+	if res, err := p.Eval("c.N"); err != nil || len(res) != 1 || res[0] != 5 {
+		t.Errorf("c.N after Reload = %v, %v, want 5", res, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("func broken( {"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Reload(path); err == nil {
+		t.Errorf("Reload of a file that does not parse succeeded")
+	}
+}
+
+type testConfig struct {
+	Name    string `ng:"Title"`
+	Retries int
+	Limits  testLimits
+	cache   []byte
+	Secret  string `ng:"-"`
+}
+
+type testLimits struct {
+	Max int `ng:"Most"`
+}
+
+func TestGoStructs(t *testing.T) {
+	rt := reflect.TypeOf(testConfig{})
+	typ, err := TypeOfGo(rt)
+	if err != nil {
+		t.Fatalf("TypeOfGo: %v", err)
+	}
+	st := typ.(*tipe.Struct)
+	if want := []string{"Title", "Retries", "Limits"}; !reflect.DeepEqual(st.FieldNames, want) {
+		t.Errorf("TypeOfGo field names = %v, want %v", st.FieldNames, want)
+	}
+
+	var out bytes.Buffer
+	p := New(Options{Path: "gostructs", Stdout: &out})
+	if err := p.DeclareType("Config", rt); err != nil {
+		t.Fatalf("DeclareType: %v", err)
+	}
+	if err := p.Set("cfg", testConfig{Name: "a", Retries: 2, Limits: testLimits{Max: 9}, Secret: "s"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := p.RegisterFunc("describe", func(c testConfig) string {
+		return fmt.Sprintf("%s/%d/%d/%q", c.Name, c.Retries, c.Limits.Max, c.Secret)
+	}); err != nil {
+		t.Fatalf("RegisterFunc: %v", err)
+	}
+	src := `printf("%T %s %d\n", cfg, cfg.Title, cfg.Limits.Most)
+c2 := Config{Title: "b", Retries: 3}
+c2.Limits.Most = 4
+println(describe(c2))`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if got, want := out.String(), "Config a 9\nb/3/4/\"\"\n"; got != want {
+		t.Errorf("output %q, want %q", got, want)
+	}
+	var c2 testConfig
+	if err := p.GetInto("c2", &c2); err != nil {
+		t.Fatalf("GetInto: %v", err)
+	}
+	if want := (testConfig{Name: "b", Retries: 3, Limits: testLimits{Max: 4}}); !reflect.DeepEqual(c2, want) {
+		t.Errorf("GetInto(c2) = %+v, want %+v", c2, want)
+	}
+
+	gt := p.GoType(p.Types.Lookup("Config").Type)
+	v := reflect.New(gt)
+	if err := p.GetInto("c2", v.Interface()); err != nil {
+		t.Fatalf("GetInto GoType: %v", err)
+	}
+	if name := v.Elem().FieldByName("Title"); !name.IsValid() || name.String() != "b" {
+		t.Errorf("GoType value field name = %v, want b", name)
+	}
+
+	if err := p.Bind("bound", &c2); err == nil {
+		t.Errorf("Bind of a struct with renamed fields succeeded")
+	}
+	type lower struct {
+		X int `ng:"x"`
+	}
+	if _, err := TypeOfGo(reflect.TypeOf(lower{})); err == nil {
+		t.Errorf("TypeOfGo of a field renamed to x succeeded")
+	}
+}
+
 var errRE = regexp.MustCompile(`ERROR: (.*)`)
 
+func TestHooks(t *testing.T) {
+	p := New(Options{Path: "hooks"})
+	var lines []int
+	var calls []string
+	p.SetHooks(Hooks{
+		Stmt: func(ev StmtEvent) {
+			lines = append(lines, ev.Pos.Line)
+		},
+		Call: func(ev CallEvent) {
+			n, _ := ev.Frame.Lookup("n")
+			calls = append(calls, fmt.Sprintf("%d:%s%v n=%v", ev.Pos.Line, ev.Func, ev.Args, n))
+		},
+	})
+	src := "func double(n int) int {\n\treturn n * 2\n}\nn := double(3)\nn = double(n)"
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if wantLines := []int{1, 4, 2, 5, 2}; !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("statement lines = %v, want %v", lines, wantLines)
+	}
+	wantCalls := []string{
+		"4:double[3] n=<nil>",
+		"5:double[6] n=6",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %q, want %q", calls, wantCalls)
+	}
+
+	// A watchdog stops the program when it changes a variable.
+	p.SetHooks(Hooks{
+		Stmt: func(ev StmtEvent) {
+			if limit, ok := ev.Frame.Lookup("limit"); ok && limit != 10 {
+				ev.Frame.Stop(errors.New("limit changed"))
+			}
+		},
+	})
+	_, err := p.Eval("limit := 10\nfunc f() {\n\tdefer func() { recover() }()\n\tlimit = 11\n\tlimit = 12\n}\nf()")
+	if err == nil || err.Error() != "limit changed" {
+		t.Errorf("Eval with watchdog: %v, want limit changed", err)
+	}
+	if v, _ := p.Get("limit"); v != 11 {
+		t.Errorf("limit = %v, want 11", v)
+	}
+
+	p.SetHooks(Hooks{})
+	if _, err := p.Eval("limit = 13"); err != nil {
+		t.Errorf("Eval after removing hooks: %v", err)
+	}
+}
+
+type testPoint struct {
+	X float64
+	Y float64
+}
+
+type testGeo struct {
+	scale *float64
+}
+
+func (testGeo) Path() string { return "example.com/geo" }
+
+func (g testGeo) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Point":   reflect.TypeOf(testPoint{}),
+		"Origin":  testPoint{},
+		"Version": "1.0",
+		"Scale":   g.scale,
+		"Dist": func(a, b testPoint) float64 {
+			dx, dy := a.X-b.X, a.Y-b.Y
+			return math.Sqrt(dx*dx+dy*dy) * *g.scale
+		},
+		"Mid": func(a, b testPoint) testPoint {
+			return testPoint{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+		},
+	}
+}
+
+func TestPackage(t *testing.T) {
+	scale := 1.0
+	p := New(Options{Path: "package", Packages: []Package{testGeo{scale: &scale}}})
+	src := `import "example.com/geo"
+
+pt := geo.Point{X: 3, Y: 4}
+d := geo.Dist(pt, geo.Origin)
+var mid geo.Point = geo.Mid(pt, geo.Origin)
+geo.Scale = 2
+v := geo.Version`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if d, _ := p.Get("d"); d != 5.0 {
+		t.Errorf("d = %v, want 5", d)
+	}
+	var mid testPoint
+	if err := p.GetInto("mid", &mid); err != nil || mid != (testPoint{X: 1.5, Y: 2}) {
+		t.Errorf("mid = %+v, %v, want {1.5 2}", mid, err)
+	}
+	if scale != 2 {
+		t.Errorf("scale = %v, want 2", scale)
+	}
+	if v, _ := p.Get("v"); v != "1.0" {
+		t.Errorf("v = %v, want 1.0", v)
+	}
+	if res, err := p.Eval("geo.Dist(pt, geo.Origin)"); err != nil || len(res) != 1 || res[0] != 10.0 {
+		t.Errorf("Dist after setting Scale = %v, %v, want [10]", res, err)
+	}
+
+	if _, err := New(Options{Path: "package"}).Eval(`import "example.com/geo"`); err == nil {
+		t.Errorf("import of a package not given to the Program succeeded")
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	out := new(bytes.Buffer)
+	p := New(Options{Path: "display", Stdout: out})
+	if _, err := p.Eval(`import "display"`); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if _, err := p.Eval(`display.HTML("<b>hi</b>")` + "\n" + `display.PNG([]byte{1, 2, 3})`); err != nil {
+		t.Fatalf("Eval without hook: %v", err)
+	}
+	if got, want := out.String(), "<b>hi</b>\n<image/png, 3 bytes>\n"; got != want {
+		t.Errorf("output without hook = %q, want %q", got, want)
+	}
+
+	var events []DisplayEvent
+	p.SetHooks(Hooks{Display: func(ev DisplayEvent) { events = append(events, ev) }})
+	if _, err := p.Eval(`display.Data("application/json", []byte("{}"))`); err != nil {
+		t.Fatalf("Eval with hook: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d display events, want 1", len(events))
+	}
+	ev := events[0]
+	if got := string(ev.Data["application/json"]); got != "{}" {
+		t.Errorf("application/json data = %q, want {}", got)
+	}
+	if ev.ExecCount != 3 || p.ExecCount() != 3 {
+		t.Errorf("ExecCount = %d in event, %d after, want 3", ev.ExecCount, p.ExecCount())
+	}
+}
+
 func TestPrograms(t *testing.T) {
 	files, err := filepath.Glob("testdata/*.ng")
 	if err != nil {
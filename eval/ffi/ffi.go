@@ -0,0 +1,294 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ffi is the Neugram package ffi, which calls C functions
+// in shared libraries:
+//
+//	import "ffi"
+//
+//	libm := ffi.Open("libm.so.6")
+//	cos := ffi.Func(libm, "cos", "float64", "float64")
+//	print(cos(0.5))
+//
+// Func declares the signature of a C function by the names of its
+// result and parameter types, and returns a Neugram function that
+// converts its arguments, calls the C function, and converts the
+// result. The types are
+//
+//   - int8, int16, int32, int64, uint8, uint16, uint32, uint64,
+//     float32, and float64, the C types of that size. A C int is
+//     an int32, and a C long is usually an int64. An argument may
+//     be any number that fits the type.
+//   - uintptr, a C pointer held as a number.
+//   - string, a char* to a NUL terminated copy of a string
+//     argument, or a result copied to a string.
+//   - a slice of one of the number types, as in []float64, a
+//     pointer to a copy of the elements of a slice argument, which
+//     is copied back after the call, so the C function can fill it.
+//     A LAPACK routine that takes a Fortran int* takes []int32.
+//   - void, a result that is left out. The Neugram function then
+//     returns nil.
+//
+// The C function may have up to 8 parameters of floating-point type
+// and up to 8 of other types, and may not be variadic. A C function
+// that keeps a pointer to a string or slice argument after it
+// returns finds the memory freed.
+//
+// Calling C is supported with cgo on linux, darwin and freebsd, for
+// amd64 and arm64, where the arguments are passed in registers.
+// Elsewhere, Open reports an error.
+package ffi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"neugram.io/ng/eval"
+)
+
+// Package is the Neugram package ffi.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return "ffi" }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Lib":   reflect.TypeOf(Lib(0)),
+		"Open":  Open,
+		"Close": Close,
+		"Func":  Func,
+	}
+}
+
+func init() {
+	eval.Register(Package)
+}
+
+// A Lib is an open shared library.
+type Lib int
+
+// Open opens the shared library name, as dlopen does. If name is
+// empty, the library is the program itself and the libraries it is
+// linked with.
+func Open(name string) (Lib, error) {
+	lib, err := open(name)
+	if err != nil {
+		return 0, fmt.Errorf("ffi: %v", err)
+	}
+	return lib, nil
+}
+
+// Close closes lib. The functions of lib must not be called after.
+func Close(lib Lib) error {
+	if err := lib.close(); err != nil {
+		return fmt.Errorf("ffi: %v", err)
+	}
+	return nil
+}
+
+// Func returns the C function name of lib, with the result type and
+// parameter types named as described in the package documentation.
+//
+// The returned function panics if it is given arguments that do not
+// match the parameters.
+func Func(lib Lib, name, result string, params ...string) (func(args ...interface{}) interface{}, error) {
+	sig := &signature{name: name}
+	var err error
+	if sig.result, err = parseType(result, true); err != nil {
+		return nil, fmt.Errorf("ffi: %s result: %v", name, err)
+	}
+	var ints, floats int
+	for i, param := range params {
+		t, err := parseType(param, false)
+		if err != nil {
+			return nil, fmt.Errorf("ffi: %s parameter %d: %v", name, i, err)
+		}
+		if t.isFloat() {
+			floats++
+		} else {
+			ints++
+		}
+		sig.params = append(sig.params, t)
+	}
+	if ints > maxArgs || floats > maxArgs {
+		return nil, fmt.Errorf("ffi: %s has more than %d parameters of floating-point or other types", name, maxArgs)
+	}
+	fn, err := lib.sym(name)
+	if err != nil {
+		return nil, fmt.Errorf("ffi: %v", err)
+	}
+	return func(args ...interface{}) interface{} {
+		if len(args) != len(sig.params) {
+			panic(fmt.Errorf("ffi: %s called with %d arguments, want %d", name, len(args), len(sig.params)))
+		}
+		res, err := call(fn, sig, args)
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}, nil
+}
+
+// maxArgs is the number of registers for floating-point arguments,
+// and for other arguments.
+const maxArgs = 8
+
+// A signature is the declared type of a C function.
+type signature struct {
+	name   string
+	result ctype
+	params []ctype
+}
+
+// A ctype is a C type Func converts to and from. A slice is a
+// pointer to its elem.
+type ctype struct {
+	kind  reflect.Kind // Int8 to Float64, Uintptr, String, or Invalid for void
+	slice bool
+}
+
+func (t ctype) isFloat() bool {
+	return !t.slice && (t.kind == reflect.Float32 || t.kind == reflect.Float64)
+}
+
+func (t ctype) String() string {
+	if t.kind == reflect.Invalid {
+		return "void"
+	}
+	if t.slice {
+		return "[]" + t.kind.String()
+	}
+	return t.kind.String()
+}
+
+// numKinds are the number types, by name.
+var numKinds = map[string]reflect.Kind{
+	"int8":    reflect.Int8,
+	"int16":   reflect.Int16,
+	"int32":   reflect.Int32,
+	"int64":   reflect.Int64,
+	"uint8":   reflect.Uint8,
+	"uint16":  reflect.Uint16,
+	"uint32":  reflect.Uint32,
+	"uint64":  reflect.Uint64,
+	"float32": reflect.Float32,
+	"float64": reflect.Float64,
+}
+
+func parseType(name string, result bool) (ctype, error) {
+	switch name {
+	case "void":
+		if !result {
+			return ctype{}, fmt.Errorf("void parameter")
+		}
+		return ctype{}, nil
+	case "uintptr":
+		return ctype{kind: reflect.Uintptr}, nil
+	case "string":
+		return ctype{kind: reflect.String}, nil
+	}
+	if elem := strings.TrimPrefix(name, "[]"); elem != name {
+		if result {
+			return ctype{}, fmt.Errorf("slice result %s, want uintptr", name)
+		}
+		if k, ok := numKinds[elem]; ok {
+			return ctype{kind: k, slice: true}, nil
+		}
+	} else if k, ok := numKinds[name]; ok {
+		return ctype{kind: k}, nil
+	}
+	return ctype{}, fmt.Errorf("unknown type %q", name)
+}
+
+// intArg returns the argument x, of the integer or pointer type t,
+// as the bits of a register.
+func intArg(t ctype, x interface{}) (int64, error) {
+	v := reflect.ValueOf(x)
+	var i int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i = v.Int()
+		if i < 0 && (t.kind == reflect.Uintptr || reflect.Uint8 <= t.kind && t.kind <= reflect.Uint64) {
+			return 0, fmt.Errorf("%v overflows %s", x, t)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > 1<<63-1 && t.kind != reflect.Uint64 && t.kind != reflect.Uintptr {
+			return 0, fmt.Errorf("%v overflows %s", x, t)
+		}
+		i = int64(u)
+	default:
+		return 0, fmt.Errorf("%T is not a number", x)
+	}
+	var fits bool
+	switch t.kind {
+	case reflect.Int8:
+		fits = int64(int8(i)) == i
+	case reflect.Int16:
+		fits = int64(int16(i)) == i
+	case reflect.Int32:
+		fits = int64(int32(i)) == i
+	case reflect.Uint8:
+		fits = int64(uint8(i)) == i
+	case reflect.Uint16:
+		fits = int64(uint16(i)) == i
+	case reflect.Uint32:
+		fits = int64(uint32(i)) == i
+	default:
+		fits = true
+	}
+	if !fits {
+		return 0, fmt.Errorf("%v overflows %s", x, t)
+	}
+	return i, nil
+}
+
+// floatArg returns the argument x, of the floating-point type t.
+func floatArg(t ctype, x interface{}) (float64, error) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("%T is not a number", x)
+}
+
+// sliceArg returns the argument x, of the slice type t.
+func sliceArg(t ctype, x interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != t.kind {
+		return reflect.Value{}, fmt.Errorf("%T is not a %s", x, t)
+	}
+	return v, nil
+}
+
+// intResult returns the result r of the integer or pointer type t.
+func intResult(t ctype, r int64) interface{} {
+	switch t.kind {
+	case reflect.Int8:
+		return int8(r)
+	case reflect.Int16:
+		return int16(r)
+	case reflect.Int32:
+		return int32(r)
+	case reflect.Int64:
+		return r
+	case reflect.Uint8:
+		return uint8(r)
+	case reflect.Uint16:
+		return uint16(r)
+	case reflect.Uint32:
+		return uint32(r)
+	case reflect.Uint64:
+		return uint64(r)
+	}
+	return uintptr(r)
+}
@@ -0,0 +1,227 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build cgo
+// +build linux darwin freebsd
+// +build amd64 arm64
+
+package ffi
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The C function is called through a pointer to a function with
+// 8 integer and 8 floating-point parameters. On amd64 and arm64,
+// these are the registers each class of arguments is passed in, so
+// the function finds its arguments where it expects them, and does
+// not look at the others.
+
+#define NG_FFI_PARAMS int64_t, int64_t, int64_t, int64_t, int64_t, int64_t, int64_t, int64_t, \
+	double, double, double, double, double, double, double, double
+#define NG_FFI_ARGS i[0], i[1], i[2], i[3], i[4], i[5], i[6], i[7], \
+	d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7]
+
+static int64_t ng_ffi_call_int(void *fn, int64_t *i, double *d) {
+	return ((int64_t (*)(NG_FFI_PARAMS))fn)(NG_FFI_ARGS);
+}
+
+static double ng_ffi_call_double(void *fn, int64_t *i, double *d) {
+	return ((double (*)(NG_FFI_PARAMS))fn)(NG_FFI_ARGS);
+}
+
+static float ng_ffi_call_float(void *fn, int64_t *i, double *d) {
+	return ((float (*)(NG_FFI_PARAMS))fn)(NG_FFI_ARGS);
+}
+
+static int64_t ng_ffi_addr(void *p) {
+	return (int64_t)(intptr_t)p;
+}
+
+static char *ng_ffi_string(int64_t p) {
+	return (char *)(intptr_t)p;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+var (
+	libsMu  sync.Mutex
+	libs    = make(map[Lib]unsafe.Pointer) // dlopen handles
+	lastLib Lib
+)
+
+func dlerror() error {
+	if msg := C.dlerror(); msg != nil {
+		return errors.New(C.GoString(msg))
+	}
+	return errors.New("unknown dl error")
+}
+
+func open(name string) (Lib, error) {
+	var cname *C.char
+	if name != "" {
+		cname = C.CString(name)
+		defer C.free(unsafe.Pointer(cname))
+	}
+	libsMu.Lock()
+	defer libsMu.Unlock()
+	h := C.dlopen(cname, C.RTLD_NOW)
+	if h == nil {
+		return 0, dlerror()
+	}
+	lastLib++
+	libs[lastLib] = h
+	return lastLib, nil
+}
+
+func (lib Lib) handle() (unsafe.Pointer, error) {
+	h := libs[lib]
+	if h == nil {
+		return nil, fmt.Errorf("library %d is not open", lib)
+	}
+	return h, nil
+}
+
+func (lib Lib) close() error {
+	libsMu.Lock()
+	defer libsMu.Unlock()
+	h, err := lib.handle()
+	if err != nil {
+		return err
+	}
+	delete(libs, lib)
+	if C.dlclose(h) != 0 {
+		return dlerror()
+	}
+	return nil
+}
+
+func (lib Lib) sym(name string) (unsafe.Pointer, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	libsMu.Lock()
+	defer libsMu.Unlock()
+	h, err := lib.handle()
+	if err != nil {
+		return nil, err
+	}
+	C.dlerror()
+	fn := C.dlsym(h, cname)
+	if fn == nil {
+		return nil, dlerror()
+	}
+	return fn, nil
+}
+
+// call calls the C function fn with the signature sig.
+func call(fn unsafe.Pointer, sig *signature, args []interface{}) (res interface{}, err error) {
+	var ints [maxArgs]C.int64_t
+	var floats [maxArgs]C.double
+	var ni, nf int
+
+	// Strings and slices are copied to C memory, and the slices
+	// copied back after the call.
+	var cmem []unsafe.Pointer
+	defer func() {
+		for _, p := range cmem {
+			C.free(p)
+		}
+	}()
+	type copyBack struct {
+		slice reflect.Value
+		cbuf  unsafe.Pointer
+		size  C.size_t
+	}
+	var copies []copyBack
+
+	for i, t := range sig.params {
+		x := args[i]
+		switch {
+		case t.isFloat():
+			f, err := floatArg(t, x)
+			if err != nil {
+				return nil, fmt.Errorf("ffi: %s argument %d: %v", sig.name, i, err)
+			}
+			if t.kind == reflect.Float32 {
+				// A float is passed in the low bits of the register.
+				floats[nf] = C.double(math.Float64frombits(uint64(math.Float32bits(float32(f)))))
+			} else {
+				floats[nf] = C.double(f)
+			}
+			nf++
+		case t.slice:
+			v, err := sliceArg(t, x)
+			if err != nil {
+				return nil, fmt.Errorf("ffi: %s argument %d: %v", sig.name, i, err)
+			}
+			if v.Len() > 0 {
+				size := C.size_t(v.Len()) * C.size_t(v.Type().Elem().Size())
+				cbuf := C.malloc(size)
+				cmem = append(cmem, cbuf)
+				C.memcpy(cbuf, unsafe.Pointer(v.Pointer()), size)
+				copies = append(copies, copyBack{v, cbuf, size})
+				ints[ni] = C.ng_ffi_addr(cbuf)
+			}
+			ni++
+		case t.kind == reflect.String:
+			s, ok := x.(string)
+			if !ok {
+				if v := reflect.ValueOf(x); v.Kind() == reflect.String {
+					s = v.String()
+				} else {
+					return nil, fmt.Errorf("ffi: %s argument %d: %T is not a string", sig.name, i, x)
+				}
+			}
+			cs := C.CString(s)
+			cmem = append(cmem, unsafe.Pointer(cs))
+			ints[ni] = C.ng_ffi_addr(unsafe.Pointer(cs))
+			ni++
+		default:
+			n, err := intArg(t, x)
+			if err != nil {
+				return nil, fmt.Errorf("ffi: %s argument %d: %v", sig.name, i, err)
+			}
+			ints[ni] = C.int64_t(n)
+			ni++
+		}
+	}
+
+	switch {
+	case sig.result.kind == reflect.Float64:
+		res = float64(C.ng_ffi_call_double(fn, &ints[0], &floats[0]))
+	case sig.result.kind == reflect.Float32:
+		res = float32(C.ng_ffi_call_float(fn, &ints[0], &floats[0]))
+	default:
+		r := C.ng_ffi_call_int(fn, &ints[0], &floats[0])
+		switch sig.result.kind {
+		case reflect.Invalid:
+		case reflect.String:
+			if p := C.ng_ffi_string(r); p != nil {
+				res = C.GoString(p)
+			} else {
+				res = ""
+			}
+		default:
+			res = intResult(sig.result, int64(r))
+		}
+	}
+
+	for _, c := range copies {
+		C.memcpy(unsafe.Pointer(c.slice.Pointer()), c.cbuf, c.size)
+	}
+	return res, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !cgo !linux,!darwin,!freebsd !amd64,!arm64
+
+package ffi
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+var errUnsupported = errors.New("calling C is not supported on " + runtime.GOOS + "/" + runtime.GOARCH)
+
+func open(name string) (Lib, error) {
+	return 0, errUnsupported
+}
+
+func (lib Lib) close() error {
+	return errUnsupported
+}
+
+func (lib Lib) sym(name string) (unsafe.Pointer, error) {
+	return nil, errUnsupported
+}
+
+func call(fn unsafe.Pointer, sig *signature, args []interface{}) (interface{}, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ffi_test
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/eval/ffi"
+)
+
+// libm is the name of the C math library.
+func libm() string {
+	if runtime.GOOS == "darwin" {
+		return "libm.dylib"
+	}
+	if runtime.GOOS == "freebsd" {
+		return "libm.so.5"
+	}
+	return "libm.so.6"
+}
+
+func open(t *testing.T, name string) ffi.Lib {
+	lib, err := ffi.Open(name)
+	if err != nil {
+		t.Skip(err)
+	}
+	return lib
+}
+
+func TestCall(t *testing.T) {
+	m := open(t, libm())
+	defer ffi.Close(m)
+	libc := open(t, "")
+	defer ffi.Close(libc)
+
+	fn := func(lib ffi.Lib, name, result string, params ...string) func(...interface{}) interface{} {
+		f, err := ffi.Func(lib, name, result, params...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	if got, want := fn(m, "cos", "float64", "float64")(0.5), math.Cos(0.5); got != want {
+		t.Errorf("cos(0.5) = %v, want %v", got, want)
+	}
+	if got, want := fn(m, "powf", "float32", "float32", "float32")(2, float32(0.5)), float32(math.Sqrt2); got != want {
+		t.Errorf("powf(2, 0.5) = %v, want %v", got, want)
+	}
+	if got, want := fn(m, "ldexp", "float64", "float64", "int32")(1.5, 3), 12.0; got != want {
+		t.Errorf("ldexp(1.5, 3) = %v, want %v", got, want)
+	}
+	if got := fn(libc, "abs", "int32", "int32")(-7); got != int32(7) {
+		t.Errorf("abs(-7) = %v, want 7", got)
+	}
+	if got := fn(libc, "strlen", "uint64", "string")("hello"); got != uint64(5) {
+		t.Errorf("strlen(hello) = %v, want 5", got)
+	}
+
+	buf := []float64{3, 1, 2}
+	fn(libc, "memset", "uintptr", "[]float64", "int32", "uint64")(buf[1:], 0, 8)
+	if buf[0] != 3 || buf[1] != 0 || buf[2] != 2 {
+		t.Errorf("memset of buf[1] gives %v, want [3 0 2]", buf)
+	}
+	if got := fn(libc, "memset", "void", "[]uint8", "int32", "uint64")([]byte{}, 0, 0); got != nil {
+		t.Errorf("void result is %v, want nil", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	m := open(t, libm())
+	defer ffi.Close(m)
+
+	for _, sig := range [][]string{
+		{"cos", "complex128", "float64"},
+		{"cos", "float64", "void"},
+		{"cos", "[]float64", "float64"},
+		{"no_such_function", "void"},
+		{"cos", "void", "int8", "int8", "int8", "int8", "int8", "int8", "int8", "int8", "int8"},
+	} {
+		if _, err := ffi.Func(m, sig[0], sig[1], sig[2:]...); err == nil {
+			t.Errorf("Func%q succeeded, want error", sig)
+		}
+	}
+
+	cos, err := ffi.Func(m, "cos", "float64", "float64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]interface{}{{}, {"x"}, {1.0, 2.0}} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("cos%v did not panic", args)
+				}
+			}()
+			cos(args...)
+		}()
+	}
+
+	abs, err := ffi.Func(m, "cos", "void", "int8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r, _ := recover().(error); r == nil || !strings.Contains(r.Error(), "overflows int8") {
+				t.Errorf("300 as an int8 panics with %v, want overflow", r)
+			}
+		}()
+		abs(300)
+	}()
+}
+
+func TestProgram(t *testing.T) {
+	open(t, libm())
+	p := eval.New(eval.Options{})
+	src := `import "ffi"
+
+m := ffi.Open("` + libm() + `")
+sqrt := ffi.Func(m, "sqrt", "float64", "float64")
+x := sqrt(16.0).(float64)`
+	if _, err := p.Eval(src); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	if x, _ := p.Get("x"); x != 4.0 {
+		t.Errorf("x = %v, want 4", x)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"go/constant"
+	"reflect"
+	"sync"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// A go statement runs its call on a new Go goroutine, and a Neugram
+// chan T is a Go channel of the reflect type of T, so channel
+// operations and select are those of the Go runtime.
+//
+// Each function call is evaluated by its own *Program frame, so
+// the evaluator state of a call (its current scope, pending
+// branch, and deferred calls) belongs to one goroutine. The frames
+// of a Program share:
+//
+//	- variables, held by reflect.Values in the Scope chain. As in
+//	  Go, a program that reads and writes a variable on two
+//	  goroutines must synchronize them itself.
+//	- the universe scope and imported packages, which are not
+//	  modified once the program is running.
+//	- the reflector, guarded by its own mutex.
+//	- the typechecker, which records the types of expressions.
+//	  A goroutine can be running while the top-level program
+//	  checks its next statement, so the checker's maps are read
+//	  through typeOf and constOf and written under typesMu.
+//
+// An unrecovered panic on a goroutine started by a go statement,
+// including one raised by a limit, ends the goroutine. Rather than
+// end the Go program embedding Neugram, as it would in Go, the
+// panic is recorded in goErr and returned as the error of the next
+// call of Eval, EvalStmt, or EvalContext. An interrupted evaluation
+// ends only the goroutine.
+//
+// A Program may be used by several goroutines of the Go program
+// embedding it. Its methods that evaluate or declare, such as Eval,
+// EvalStmt, Get, and Set, hold the mutex mu, so one runs at a time
+// and each sees the effects of the last in full. A Neugram
+// goroutine started by an earlier call keeps running, unlocked,
+// and shares variables with later calls as goroutines do in Go.
+// A Go func called by the program, such as one registered with
+// RegisterFunc, must not call these methods of the same Program,
+// as mu is held while it runs.
+
+// typeOf returns the type the typechecker found for e.
+func (p *Program) typeOf(e expr.Expr) tipe.Type {
+	p.typesMu.RLock()
+	t := p.Types.Types[e]
+	p.typesMu.RUnlock()
+	return t
+}
+
+// constOf returns the constant value of e, or nil if e is not
+// a constant.
+func (p *Program) constOf(e expr.Expr) constant.Value {
+	p.typesMu.RLock()
+	v := p.Types.Values[e]
+	p.typesMu.RUnlock()
+	return v
+}
+
+// goErr holds the error of the first goroutine that ended in a
+// panic, until a top-level evaluation takes it.
+type goErr struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (g *goErr) set(err error) {
+	g.mu.Lock()
+	if g.err == nil {
+		g.err = err
+	}
+	g.mu.Unlock()
+}
+
+func (g *goErr) take() error {
+	g.mu.Lock()
+	err := g.err
+	g.err = nil
+	g.mu.Unlock()
+	return err
+}
+
+func (p *Program) evalGo(s *stmt.Go) {
+	fn, args := p.prepCall(s.Call)
+	if fn.Kind() == reflect.Func && fn.IsNil() {
+		panic(runtimeErrorf("invalid memory address or nil pointer dereference"))
+	}
+	for i, arg := range args {
+		v := reflect.New(arg.Type()).Elem()
+		v.Set(arg)
+		args[i] = v
+	}
+	go func() {
+		defer func() {
+			x := recover()
+			if _, isInterrupt := x.(interrupt); x == nil || isInterrupt {
+				return
+			}
+			if val, ok := recoverable(x); ok {
+				p.goErr.set(fmt.Errorf("%v (in goroutine)", val))
+				return
+			}
+			p.goErr.set(fmt.Errorf("ng eval panic: %v (in goroutine)", x))
+		}()
+		if s.Call.Ellipsis {
+			fn.CallSlice(args)
+		} else {
+			fn.Call(args)
+		}
+	}()
+}
+
+// evalSelect evaluates the select statement s. The channel and send
+// operands of every case are evaluated first, in source order, then
+// reflect.Select chooses a case that can proceed.
+func (p *Program) evalSelect(s *stmt.Select, label string) {
+	cases := make([]reflect.SelectCase, len(s.Cases))
+	for i, cse := range s.Cases {
+		switch comm := cse.Comm.(type) {
+		case nil:
+			cases[i].Dir = reflect.SelectDefault
+		case *stmt.Send:
+			cases[i].Dir = reflect.SelectSend
+			cases[i].Chan = p.evalExprOne(comm.Chan)
+			cases[i].Send = p.evalExprOne(comm.Value)
+		case *stmt.Simple:
+			cases[i].Dir = reflect.SelectRecv
+			cases[i].Chan = p.evalExprOne(comm.Expr.(*expr.Unary).Expr)
+		case *stmt.Assign:
+			cases[i].Dir = reflect.SelectRecv
+			cases[i].Chan = p.evalExprOne(comm.Right[0].(*expr.Unary).Expr)
+		}
+	}
+	chosen, recv, recvOK := reflect.Select(cases)
+	cse := s.Cases[chosen]
+
+	p.pushScope()
+	defer p.popScope()
+	if a, isAssign := cse.Comm.(*stmt.Assign); isAssign {
+		t := p.typeOf(a.Right[0])
+		types := []tipe.Type{t}
+		if tuple, isTuple := t.(*tipe.Tuple); isTuple {
+			types = tuple.Elems
+		}
+		p.assign(a, types, []reflect.Value{recv, reflect.ValueOf(recvOK)})
+	}
+	p.evalStmt(cse.Body)
+	if p.branchType == brBreak && p.branchLabel == label {
+		p.branchType = brNone
+		p.branchLabel = ""
+	}
+}
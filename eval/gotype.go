@@ -0,0 +1,283 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/typecheck"
+)
+
+// A Go struct is a Neugram struct with a field for each exported
+// field of the Go struct. A field tag with the key "ng" renames the
+// field, or with the value "-" leaves it out:
+//
+//	type Config struct {
+//		Name    string `ng:"Title"`
+//		Retries int
+//		cache   []byte         // unexported, left out
+//		Secret  string `ng:"-"` // left out
+//	}
+//
+// is the Neugram type struct{ Title string; Retries int }. As the
+// evaluator holds a struct in a Go struct, a Neugram field name must
+// be exported, so a tag cannot rename a field to a lower case name.
+// A value
+// is copied between the two field by field, so values of a struct
+// with renamed or left out fields can be given to Set and taken by
+// GetInto, but not shared by Bind.
+//
+// DeclareType gives the Neugram type a name, as a type declaration
+// does, and GoType makes a Go struct from a Neugram struct type.
+
+// DeclareType declares name as a Neugram type defined by the Go
+// type rt, usually a struct. Set and RegisterFunc then give values
+// of rt the type name.
+func (p *Program) DeclareType(name string, rt reflect.Type) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, err := p.goTypes.typeOf(rt)
+	if err != nil {
+		return fmt.Errorf("eval: cannot declare %s: %v", name, err)
+	}
+	if _, err := p.evalTop(context.Background(), &stmt.TypeDecl{Name: name, Type: t}); err != nil {
+		return err
+	}
+	if p.goTypes == nil {
+		p.goTypes = make(goTypeMap)
+	}
+	p.goTypes[rt] = p.Types.Lookup(name).Type.(*tipe.Named)
+	return nil
+}
+
+// GoType returns a Go type that holds values of the Neugram type t.
+// A struct type, or a type defined by one, is a Go struct with the
+// same fields. Other types are those the evaluator holds values in.
+func (p *Program) GoType(t tipe.Type) reflect.Type {
+	st, isStruct := tipe.Underlying(t).(*tipe.Struct)
+	if !isStruct {
+		return p.reflector.ToRType(t)
+	}
+	var fields []reflect.StructField
+	for i, f := range st.Fields {
+		fields = append(fields, reflect.StructField{
+			Name: st.FieldNames[i],
+			Type: p.reflector.ToRType(f),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// ngField returns the name of the Neugram field for the Go struct
+// field f, or false if it has none.
+func ngField(f reflect.StructField) (string, bool) {
+	switch {
+	case f.PkgPath != "":
+		return "", false
+	case f.Anonymous && isMethodPool(f.Type):
+		return "", false
+	}
+	switch tag := f.Tag.Get("ng"); tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// fieldByNgName returns the field of the struct v whose Neugram
+// name is name.
+func fieldByNgName(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if n, ok := ngField(t.Field(i)); ok && n == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+var errorRType = reflect.TypeOf((*error)(nil)).Elem()
+
+// TypeOfGo returns the Neugram type that holds values of the Go
+// type rt, as described in the comment on Set.
+func TypeOfGo(rt reflect.Type) (tipe.Type, error) {
+	return goTypeMap(nil).typeOf(rt)
+}
+
+// goTypeMap maps Go types declared with DeclareType to the Neugram
+// types declared for them.
+type goTypeMap map[reflect.Type]*tipe.Named
+
+func (m goTypeMap) typeOf(rt reflect.Type) (tipe.Type, error) {
+	if t := m[rt]; t != nil {
+		return t, nil
+	}
+	return m.underlying(rt)
+}
+
+// underlying returns the Neugram type of rt, ignoring any Neugram
+// type declared for rt itself.
+func (m goTypeMap) underlying(rt reflect.Type) (tipe.Type, error) {
+	switch rt {
+	case bigIntType:
+		return tipe.Integer, nil
+	case bigFloatType:
+		return tipe.Float, nil
+	case errorRType:
+		return typecheck.Universe.Objs["error"].Type, nil
+	case tableType:
+		return &tipe.Table{Type: &tipe.Interface{}}, nil
+	}
+	switch rt.Kind() {
+	case reflect.Bool:
+		return tipe.Bool, nil
+	case reflect.String:
+		return tipe.String, nil
+	case reflect.Int:
+		return tipe.Int, nil
+	case reflect.Int8:
+		return tipe.Int8, nil
+	case reflect.Int16:
+		return tipe.Int16, nil
+	case reflect.Int32:
+		return tipe.Int32, nil
+	case reflect.Int64:
+		return tipe.Int64, nil
+	case reflect.Uint:
+		return tipe.Uint, nil
+	case reflect.Uint8:
+		return tipe.Uint8, nil
+	case reflect.Uint16:
+		return tipe.Uint16, nil
+	case reflect.Uint32:
+		return tipe.Uint32, nil
+	case reflect.Uint64:
+		return tipe.Uint64, nil
+	case reflect.Uintptr:
+		return tipe.Uintptr, nil
+	case reflect.Float32:
+		return tipe.Float32, nil
+	case reflect.Float64:
+		return tipe.Float64, nil
+	case reflect.Complex64:
+		return tipe.Complex64, nil
+	case reflect.Complex128:
+		return tipe.Complex128, nil
+	case reflect.Slice:
+		elem, err := m.typeOf(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &tipe.Slice{Elem: elem}, nil
+	case reflect.Array:
+		elem, err := m.typeOf(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &tipe.Array{Len: int64(rt.Len()), Elem: elem}, nil
+	case reflect.Ptr:
+		elem, err := m.typeOf(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &tipe.Pointer{Elem: elem}, nil
+	case reflect.Map:
+		key, err := m.typeOf(rt.Key())
+		if err != nil {
+			return nil, err
+		}
+		val, err := m.typeOf(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &tipe.Map{Key: key, Value: val}, nil
+	case reflect.Chan:
+		elem, err := m.typeOf(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		t := &tipe.Chan{Elem: elem, Direction: tipe.ChanBoth}
+		switch rt.ChanDir() {
+		case reflect.SendDir:
+			t.Direction = tipe.ChanSend
+		case reflect.RecvDir:
+			t.Direction = tipe.ChanRecv
+		}
+		return t, nil
+	case reflect.Struct:
+		t := &tipe.Struct{}
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			name, ok := ngField(f)
+			if !ok {
+				continue
+			}
+			if !isExported(name) {
+				return nil, fmt.Errorf("Go type %s: field %s is renamed to %q, which is not exported", rt, f.Name, name)
+			}
+			ft, err := m.typeOf(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			t.FieldNames = append(t.FieldNames, name)
+			t.Fields = append(t.Fields, ft)
+		}
+		return t, nil
+	case reflect.Func:
+		return m.funcOf(rt)
+	case reflect.Interface:
+		t := &tipe.Interface{}
+		for i := 0; i < rt.NumMethod(); i++ {
+			method := rt.Method(i)
+			ft, err := m.funcOf(method.Type)
+			if err != nil {
+				return nil, err
+			}
+			if t.Methods == nil {
+				t.Methods = make(map[string]*tipe.Func)
+			}
+			t.Methods[method.Name] = ft
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("Go type %s has no Neugram equivalent", rt)
+}
+
+func (m goTypeMap) funcOf(rt reflect.Type) (*tipe.Func, error) {
+	t := &tipe.Func{
+		Params:   &tipe.Tuple{},
+		Results:  &tipe.Tuple{},
+		Variadic: rt.IsVariadic(),
+	}
+	for i := 0; i < rt.NumIn(); i++ {
+		pt, err := m.typeOf(rt.In(i))
+		if err != nil {
+			return nil, err
+		}
+		t.Params.Elems = append(t.Params.Elems, pt)
+	}
+	for i := 0; i < rt.NumOut(); i++ {
+		ot, err := m.typeOf(rt.Out(i))
+		if err != nil {
+			return nil, err
+		}
+		t.Results.Elems = append(t.Results.Elems, ot)
+	}
+	return t, nil
+}
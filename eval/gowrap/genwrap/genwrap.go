@@ -37,6 +37,9 @@ func buildDataPkg(pkgPath string, pkg *types.Package) DataPkg {
 				exports[name] = "reflect.ValueOf(reflect.TypeOf(" + quotedPkgPath + "." + name + nilexpr(obj.Type()) + "))"
 			}
 		case *types.Var, *types.Func, *types.Const:
+			if sig, ok := obj.Type().(*types.Signature); ok && sig.TypeParams().Len() > 0 {
+				continue // generic functions have no reflect.Value
+			}
 			exports[name] = "reflect.ValueOf(" + quotedPkgPath + "." + name + ")"
 		default:
 			log.Printf("genwrap: unexpected obj: %T\n", obj)
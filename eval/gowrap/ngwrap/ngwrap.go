@@ -0,0 +1,327 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ngwrap generates the Go source of an eval.Package that
+// makes a Go package importable by Neugram programs.
+//
+// The generated package has a member for each exported function,
+// type, variable, and constant of the Go package that Neugram can
+// represent. Functions are called through the evaluator, which
+// converts their arguments and results. Variables are shared with
+// the Go package. An untyped constant has its default type, except
+// that an integer is an int64 or uint64 if it is too large for an
+// int32, so the source builds for every GOARCH.
+//
+// Left out are generic functions and types, aliases, and members
+// whose types involve unsafe.Pointer or a recursive type. As the evaluator shares a variable's
+// memory, a variable is also left out if Neugram would hold its
+// value in a different Go type, as for a struct with a field of a
+// defined type.
+package ngwrap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"sort"
+	"text/template"
+)
+
+// Config configures the generated source.
+type Config struct {
+	// Package is the name of the generated package.
+	Package string
+
+	// Register makes the generated package call eval.Register
+	// in its init function.
+	Register bool
+}
+
+// GenGo returns the source of a Go package providing an
+// eval.Package for the Go package pkgPath, and the names of the
+// members of pkgPath it left out.
+func GenGo(pkgPath string, cfg Config) (src []byte, skipped []string, err error) {
+	pkg, err := importer.ForCompiler(token.NewFileSet(), "source", nil).Import(pkgPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ngwrap: %v", err)
+	}
+	return genPkg(pkg, cfg)
+}
+
+func genPkg(pkg *types.Package, cfg Config) ([]byte, []string, error) {
+	data := data{
+		OutPkgName: cfg.Package,
+		Path:       pkg.Path(),
+		Name:       pkg.Name(),
+		Register:   cfg.Register,
+	}
+	if data.OutPkgName == "" {
+		data.OutPkgName = "ng" + pkg.Name()
+	}
+	if data.Name == data.OutPkgName || data.Name == "eval" || data.Name == "reflect" {
+		data.Name = "wrap_" + data.Name
+	}
+
+	c := &checker{visiting: make(map[*types.Named]bool)}
+	var skipped []string
+	scope := pkg.Scope()
+	names := scope.Names()
+	sort.Strings(names)
+	for _, name := range names {
+		if !ast.IsExported(name) {
+			continue
+		}
+		member, ok := c.member(scope.Lookup(name), data.Name)
+		if !ok {
+			skipped = append(skipped, name)
+			continue
+		}
+		data.Members = append(data.Members, member)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, nil, fmt.Errorf("ngwrap: %v", err)
+	}
+	res, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("ngwrap: bad generated source: %v\n%s", err, buf.Bytes())
+	}
+	return res, skipped, nil
+}
+
+// checker reports whether the evaluator can represent Go types.
+type checker struct {
+	visiting map[*types.Named]bool
+}
+
+// member returns the member expression for obj, referred to in the
+// generated source by the package name qual.
+func (c *checker) member(obj types.Object, qual string) (member, bool) {
+	m := member{Name: obj.Name()}
+	ref := qual + "." + obj.Name()
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		named, isNamed := obj.Type().(*types.Named)
+		if obj.IsAlias() || !isNamed || named.TypeParams().Len() > 0 {
+			return m, false
+		}
+		if !c.ok(named.Underlying()) {
+			return m, false
+		}
+		m.Expr = fmt.Sprintf("reflect.TypeOf((*%s)(nil)).Elem()", ref)
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		if sig.TypeParams().Len() > 0 || !c.ok(sig) {
+			return m, false
+		}
+		m.Expr = ref
+	case *types.Var:
+		if !c.ok(obj.Type()) || !isError(obj.Type()) && !heldAsItself(obj.Type().Underlying()) {
+			return m, false
+		}
+		m.Expr = "&" + ref
+	case *types.Const:
+		expr, ok := constExpr(obj, ref)
+		if !ok {
+			return m, false
+		}
+		m.Expr = expr
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// constExpr returns the expression for the constant obj, giving an
+// untyped constant a type.
+func constExpr(obj *types.Const, ref string) (string, bool) {
+	basic, isBasic := obj.Type().(*types.Basic)
+	if !isBasic || basic.Info()&types.IsUntyped == 0 {
+		return ref, true
+	}
+	switch basic.Kind() {
+	case types.UntypedInt:
+		if v, exact := constant.Int64Val(obj.Val()); exact {
+			if int64(int32(v)) == v {
+				return "int(" + ref + ")", true
+			}
+			return "int64(" + ref + ")", true
+		}
+		if _, exact := constant.Uint64Val(obj.Val()); exact {
+			return "uint64(" + ref + ")", true
+		}
+		return "", false
+	case types.UntypedRune:
+		return "rune(" + ref + ")", true
+	case types.UntypedFloat:
+		return "float64(" + ref + ")", true
+	case types.UntypedComplex:
+		return "complex128(" + ref + ")", true
+	case types.UntypedString:
+		return "string(" + ref + ")", true
+	case types.UntypedBool:
+		return "bool(" + ref + ")", true
+	}
+	return "", false
+}
+
+// ok reports whether the evaluator can represent values of type t.
+func (c *checker) ok(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Kind() != types.UnsafePointer && t.Info()&types.IsUntyped == 0
+	case *types.Named:
+		if t.TypeArgs().Len() > 0 {
+			return false
+		}
+		if c.visiting[t] {
+			// A recursive type. The evaluator holds a reference
+			// to one boxed in an interface{}, which Go values
+			// are not converted to.
+			return false
+		}
+		c.visiting[t] = true
+		defer delete(c.visiting, t)
+		return c.ok(t.Underlying())
+	case *types.Pointer:
+		return c.ok(t.Elem())
+	case *types.Slice:
+		return c.ok(t.Elem())
+	case *types.Array:
+		return c.ok(t.Elem())
+	case *types.Map:
+		return c.ok(t.Key()) && c.ok(t.Elem())
+	case *types.Chan:
+		return c.ok(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			if f.Exported() && !c.ok(f.Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Signature:
+		return c.okTuple(t.Params()) && c.okTuple(t.Results())
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			if !c.ok(t.Method(i).Type()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// heldAsItself reports whether the evaluator holds values of the
+// Go type t, which is not a defined type, in t itself.
+func heldAsItself(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return true
+	case *types.Named:
+		return isError(t)
+	case *types.Pointer:
+		return heldAsItself(t.Elem())
+	case *types.Slice:
+		return heldAsItself(t.Elem())
+	case *types.Array:
+		return heldAsItself(t.Elem())
+	case *types.Map:
+		return heldAsItself(t.Key()) && heldAsItself(t.Elem())
+	case *types.Chan:
+		return heldAsItself(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if !t.Field(i).Exported() || t.Tag(i) != "" || !heldAsItself(t.Field(i).Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				if !heldAsItself(tuple.At(i).Type()) {
+					return false
+				}
+			}
+		}
+		return true
+	case *types.Interface:
+		return t.Empty()
+	}
+	return false
+}
+
+func isError(t types.Type) bool {
+	return t == types.Universe.Lookup("error").Type()
+}
+
+func (c *checker) okTuple(t *types.Tuple) bool {
+	for i := 0; i < t.Len(); i++ {
+		if !c.ok(t.At(i).Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+type data struct {
+	OutPkgName string
+	Path       string // import path of the wrapped package
+	Name       string // name the generated source imports it as
+	Register   bool
+	Members    []member
+}
+
+type member struct {
+	Name string
+	Expr string
+}
+
+// quote returns s as a Go string literal.
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+var tmpl = template.Must(template.New("ngwrap").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`// Code generated by ngwrap; DO NOT EDIT.
+
+package {{.OutPkgName}}
+
+import (
+	"reflect"
+
+	"neugram.io/ng/eval"
+
+	{{.Name}} {{quote .Path}}
+)
+
+var _ = reflect.TypeOf // in case no type is wrapped
+
+// Package is the Neugram package {{.Path}}.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return {{quote .Path}} }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+{{range .Members}}		{{quote .Name}}: {{.Expr}},
+{{end}}	}
+}
+{{if .Register}}
+func init() {
+	eval.Register(Package)
+}
+{{end}}`))
@@ -0,0 +1,106 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ngwrap
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const geoSrc = `package geo
+
+import (
+	"time"
+	"unsafe"
+)
+
+type Point struct{ X, Y float64 }
+
+type Node struct {
+	Val  int
+	Next *Node
+}
+
+type Celsius float64
+
+type Alias = Point
+
+const (
+	Freezing Celsius = 0
+	Small            = 7
+	Big              = 1 << 40
+	Huge             = 1 << 63
+	Pi               = 3.14
+	Name             = "geo"
+)
+
+var (
+	Origin  Point
+	Count   int
+	Err     error
+	Timeout struct{ D time.Duration }
+)
+
+func Dist(a, b Point) float64                { return 0 }
+func Len(n *Node) int                        { return 0 }
+func Ptr() unsafe.Pointer                    { return nil }
+func Max[T int | float64](a, b T) T          { return a }
+func Warm(c Celsius, d time.Duration) Celsius { return c }
+func hidden()                                {}
+`
+
+func TestGenPkg(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "geo.go", geoSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("example.com/geo", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, skipped, err := genPkg(pkg, Config{Register: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Alias", "Len", "Max", "Node", "Ptr", "Timeout"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %q, want %q", skipped, want)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "nggeo.go", src, 0); err != nil {
+		t.Errorf("generated source does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"package nggeo\n",
+		`geo "example.com/geo"`,
+		`func (pkg) Path() string { return "example.com/geo" }`,
+		`"Big":      int64(geo.Big),`,
+		`"Celsius":  reflect.TypeOf((*geo.Celsius)(nil)).Elem(),`,
+		`"Count":    &geo.Count,`,
+		`"Dist":     geo.Dist,`,
+		`"Err":      &geo.Err,`,
+		`"Freezing": geo.Freezing,`,
+		`"Huge":     uint64(geo.Huge),`,
+		`"Name":     string(geo.Name),`,
+		`"Pi":       float64(geo.Pi),`,
+		`"Small":    int(geo.Small),`,
+		`"Warm":     geo.Warm,`,
+		"eval.Register(Package)",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated source does not contain %q:\n%s", want, src)
+		}
+	}
+	if strings.Contains(string(src), "hidden") {
+		t.Errorf("generated source wraps an unexported function:\n%s", src)
+	}
+}
@@ -13,7 +13,12 @@ import (
 var wrap_errors = &gowrap.Pkg{
 	Exports: map[string]reflect.Value{
 
-		"New": reflect.ValueOf(errors.New),
+		"As":             reflect.ValueOf(errors.As),
+		"ErrUnsupported": reflect.ValueOf(errors.ErrUnsupported),
+		"Is":             reflect.ValueOf(errors.Is),
+		"Join":           reflect.ValueOf(errors.Join),
+		"New":            reflect.ValueOf(errors.New),
+		"Unwrap":         reflect.ValueOf(errors.Unwrap),
 	},
 }
 
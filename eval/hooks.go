@@ -0,0 +1,128 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/token"
+)
+
+// Hooks are called by the evaluator as it runs a program, to trace
+// or watch it. They are shared by the frames of a Program, and are
+// called on the goroutine evaluating the statement or call, so a
+// program that starts goroutines calls its hooks concurrently.
+//
+// A hook is called while the Program is in use, so it must not call
+// the methods of the Program. It may stop the evaluation with the
+// Stop method of its Frame.
+type Hooks struct {
+	// Stmt is called before each statement of a block, and each
+	// top-level statement that has a position, as those parsed
+	// from source do.
+	Stmt func(StmtEvent)
+
+	// Call is called before each function call, after its
+	// arguments are evaluated. Conversions and the builtins
+	// print, println, printf, and recover are not calls.
+	Call func(CallEvent)
+
+	// Display is called with the rich output of the package
+	// display. See display.go.
+	Display func(DisplayEvent)
+}
+
+// A StmtEvent is a statement about to be evaluated.
+type StmtEvent struct {
+	Pos   token.Position
+	Stmt  stmt.Stmt
+	Frame *Frame
+}
+
+// A CallEvent is a function about to be called.
+type CallEvent struct {
+	Pos   token.Position // the position of the call
+	Func  string         // the function expression, as in "fmt.Println"
+	Args  []interface{}  // converted as by Get
+	Frame *Frame         // the frame of the caller
+}
+
+// A Frame is the function a hook is called in, or the top level of
+// the program. It is valid until the hook returns.
+type Frame struct {
+	p *Program
+}
+
+// Lookup returns the value of the variable name in scope in the
+// frame, converted as by Get, and whether there is one.
+func (f *Frame) Lookup(name string) (interface{}, bool) {
+	v := f.p.Cur.Lookup(name)
+	if v == (reflect.Value{}) {
+		return nil, false
+	}
+	return goValue(v), true
+}
+
+// Stop stops the evaluation, which returns err. As with a canceled
+// context, recover does not stop it and deferred calls are not run.
+func (f *Frame) Stop(err error) {
+	panic(interrupt{err: err})
+}
+
+// hookSet holds the hooks of a Program.
+type hookSet struct {
+	v atomic.Value // Hooks
+}
+
+func newHookSet() *hookSet {
+	h := new(hookSet)
+	h.v.Store(Hooks{})
+	return h
+}
+
+func (h *hookSet) get() Hooks { return h.v.Load().(Hooks) }
+
+// SetHooks installs the hooks h, replacing any installed before.
+// The zero Hooks removes them.
+func (p *Program) SetHooks(h Hooks) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hooks.v.Store(h)
+}
+
+// stmtHook calls the Stmt hook, if there is one, for s.
+func (p *Program) stmtHook(s stmt.Stmt) {
+	hook := p.hooks.get().Stmt
+	if hook == nil {
+		return
+	}
+	hook(StmtEvent{
+		Pos:   p.Types.Fset.Position(s.Pos()),
+		Stmt:  s,
+		Frame: &Frame{p: p},
+	})
+}
+
+// callHook calls the Call hook, if there is one, for the call e.
+func (p *Program) callHook(e *expr.Call, args []reflect.Value) {
+	hook := p.hooks.get().Call
+	if hook == nil {
+		return
+	}
+	ev := CallEvent{
+		Pos:   p.Types.Fset.Position(e.Pos()),
+		Func:  format.Expr(e.Func),
+		Args:  make([]interface{}, len(args)),
+		Frame: &Frame{p: p},
+	}
+	for i, arg := range args {
+		ev.Args[i] = goValue(arg)
+	}
+	hook(ev)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import "sync/atomic"
+
+// Limits bounds the resources a Program uses, so that it can run
+// untrusted code. A zero field is no limit.
+//
+// Usage is counted from the call of SetLimits, across every
+// statement evaluated since and all goroutines. Exceeding a limit
+// raises a runtime error. A program can recover from it, but the
+// usage is still over the limit, so the next step raises it again
+// and the error reaches the caller of Eval.
+type Limits struct {
+	Steps     int64 // statements, loop iterations, and function calls
+	CallDepth int64 // function calls in progress
+
+	// Cells limits the elements allocated by make, new, append,
+	// and composite literals, and the bytes of strings made by +.
+	Cells int64
+
+	// TableCells limits the cells of tables made by table
+	// literals, counted apart from Cells.
+	TableCells int64
+}
+
+// usage is the resources used by a Program, shared by its frames.
+type usage struct {
+	limits     Limits
+	steps      int64 // atomic
+	depth      int64 // atomic
+	cells      int64 // atomic
+	tableCells int64 // atomic
+}
+
+// SetLimits sets the limits of p and resets its usage.
+func (p *Program) SetLimits(l Limits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.usage = usage{limits: l}
+}
+
+// step is called at each loop iteration, statement of a block, and
+// function call. It stops evaluation if it has been interrupted or
+// has run out of steps.
+func (p *Program) step() {
+	p.checkInterrupt()
+	if max := p.usage.limits.Steps; max > 0 && atomic.AddInt64(&p.usage.steps, 1) > max {
+		panic(runtimeErrorf("step limit of %d exceeded", max))
+	}
+}
+
+// enterCall records the start of a function call. The call must
+// be ended by exitCall.
+func (p *Program) enterCall() {
+	depth := atomic.AddInt64(&p.usage.depth, 1)
+	if max := p.usage.limits.CallDepth; max > 0 && depth > max {
+		atomic.AddInt64(&p.usage.depth, -1)
+		panic(runtimeErrorf("call depth limit of %d exceeded", max))
+	}
+}
+
+func (p *Program) exitCall() {
+	atomic.AddInt64(&p.usage.depth, -1)
+}
+
+// alloc records the allocation of n cells.
+func (p *Program) alloc(n int) {
+	max := p.usage.limits.Cells
+	if max <= 0 || n == 0 {
+		return
+	}
+	if atomic.AddInt64(&p.usage.cells, int64(n)) > max {
+		panic(runtimeErrorf("memory limit of %d cells exceeded", max))
+	}
+}
+
+// allocTable records the allocation of n table cells.
+func (p *Program) allocTable(n int) {
+	max := p.usage.limits.TableCells
+	if max <= 0 || n == 0 {
+		return
+	}
+	if atomic.AddInt64(&p.usage.tableCells, int64(n)) > max {
+		panic(runtimeErrorf("table limit of %d cells exceeded", max))
+	}
+}
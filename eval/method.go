@@ -0,0 +1,210 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"math/big"
+	"reflect"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// Without reflect.NamedOf, the evaluator cannot make Go types with
+// methods, so a value of a methodik type is a value of its
+// underlying type. Its methods are dispatched by the evaluator,
+// using the type the typechecker found for the selector x.f: each
+// method is a function taking the receiver as its first argument,
+// and x.f is that function with x bound to it.
+//
+// Only a few methods, those that fit the methodpool, are visible
+// to Go code. See methodpool.go.
+
+func (p *Program) evalMethodikDecl(s *stmt.MethodikDecl) {
+	t := s.Type
+	r := p.reflector
+
+	pool := make([]reflect.Type, len(t.MethodNames))
+	if st, isStruct := t.Type.(*tipe.Struct); isStruct {
+		// Hack. See the file comment in methodpool.go.
+		r.setBuilding(t, true)
+		var fields []reflect.StructField
+		for i, name := range t.MethodNames {
+			embType := methodPoolAssign(name)
+			if embType == nil {
+				continue
+			}
+			pool[i] = embType
+			fields = append(fields, reflect.StructField{
+				Name:      embType.Name(),
+				Type:      embType,
+				Anonymous: true,
+			})
+		}
+		for i, f := range st.Fields {
+			fields = append(fields, reflect.StructField{
+				Name: st.FieldNames[i],
+				Type: r.ToRType(f),
+			})
+		}
+		rtype := reflect.StructOf(fields)
+		r.setRType(t, rtype)
+		if len(fields) > len(st.Fields) {
+			// The methodpool types make rtype unique to t.
+			r.setNamed(rtype, t)
+		}
+		r.setBuilding(t, false)
+	} else {
+		r.defineNamed(t)
+	}
+
+	// The methods are made once the type is complete, so their
+	// parameters and results can be of the type itself.
+	impls := make([]reflect.Value, len(s.Methods))
+	for i, m := range s.Methods {
+		impls[i] = p.evalFuncLiteral(m, t)
+		if pool[i] != nil {
+			methodPoolSet(pool[i], impls[i])
+		}
+	}
+	r.setMethods(t, impls)
+}
+
+// methodOf finds the method name of a value of type t, where t is
+// a methodik type or a pointer to one. It returns the methodik type
+// and the index of the method, or nil if it has no such method.
+func (p *Program) methodOf(t tipe.Type, name string) (named *tipe.Named, i int, ptr bool) {
+	t = tipe.Unalias(t)
+	if pt, isPtr := t.(*tipe.Pointer); isPtr {
+		t = tipe.Unalias(pt.Elem)
+		ptr = true
+	}
+	named, _ = t.(*tipe.Named)
+	if named == nil || p.reflector.method(named, 0) == (reflect.Value{}) {
+		return nil, 0, false
+	}
+	for i, n := range named.MethodNames {
+		if n == name {
+			return named, i, ptr
+		}
+	}
+	return nil, 0, false
+}
+
+// dynamicMethodOf is methodOf for the dynamic type of x, a value
+// of an interface type. Only a methodik type with methods visible
+// to Go can be the dynamic type of an interface, and Go calls those
+// methods with a zero receiver, so the evaluator calls them itself.
+func (p *Program) dynamicMethodOf(x reflect.Value, name string) (v reflect.Value, named *tipe.Named, i int, ptr bool) {
+	if x.Kind() == reflect.Interface {
+		x = x.Elem()
+	}
+	named, i, ptr = p.methodOf(p.dynamicType(x), name)
+	return x, named, i, ptr
+}
+
+// dynamicType returns the Neugram type of v, the dynamic value of an
+// interface, where it differs from the Go type of v, or nil.
+func (p *Program) dynamicType(v reflect.Value) tipe.Type {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Interface().(type) {
+	case *big.Int:
+		return tipe.Integer
+	case *big.Float:
+		return tipe.Float
+	}
+	if v.Kind() == reflect.Ptr {
+		if elem := p.reflector.FromRType(v.Type().Elem()); elem != nil {
+			return &tipe.Pointer{Elem: elem}
+		}
+		return nil
+	}
+	return p.reflector.FromRType(v.Type())
+}
+
+// methodValue returns the method i of t bound to the receiver x,
+// a value of t or, if ptr is set, a pointer to one. As in Go, a
+// value receiver is copied when the method value is made, and a
+// pointer method of an addressable x is given &x.
+func (p *Program) methodValue(x reflect.Value, t *tipe.Named, i int, ptr bool) reflect.Value {
+	var recv reflect.Value
+	switch {
+	case t.PointerReceiver(i) && ptr:
+		recv = x
+	case t.PointerReceiver(i):
+		recv = x.Addr()
+	default:
+		if ptr {
+			if x.IsNil() {
+				panic(runtimeErrorf("invalid memory address or nil pointer dereference"))
+			}
+			x = x.Elem()
+		}
+		recv = reflect.New(x.Type()).Elem()
+		recv.Set(x)
+	}
+	impl := p.reflector.method(t, i)
+	ft := p.reflector.ToRType(t.Methods[i])
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		args = append([]reflect.Value{recv}, args...)
+		if ft.IsVariadic() {
+			return impl.CallSlice(args)
+		}
+		return impl.Call(args)
+	})
+}
+
+// bindReceiver declares the receiver of the method e of recvt in
+// the current scope, holding arg.
+func (p *Program) bindReceiver(e *expr.FuncLiteral, recvt *tipe.Named, arg reflect.Value) {
+	if e.ReceiverName == "" || e.ReceiverName == "_" {
+		return
+	}
+	rt := p.reflector.ToRType(recvt)
+	if e.PointerReceiver {
+		rt = reflect.PtrTo(rt)
+	}
+	v := reflect.New(rt).Elem()
+	if arg.Kind() == reflect.Interface {
+		arg = arg.Elem()
+	}
+	if arg.IsValid() && arg.Type().AssignableTo(rt) {
+		v.Set(arg) // not so for a method called through the methodpool
+	}
+	p.Cur = &Scope{
+		Parent:   p.Cur,
+		VarName:  e.ReceiverName,
+		Var:      v,
+		Implicit: true,
+	}
+}
+
+// setNamed records that values of rtype are of the methodik type t.
+func (r *reflector) setNamed(rtype reflect.Type, t *tipe.Named) {
+	r.mu.Lock()
+	r.rev[rtype] = t
+	r.mu.Unlock()
+}
+
+func (r *reflector) setMethods(t *tipe.Named, impls []reflect.Value) {
+	r.mu.Lock()
+	r.methods[t] = impls
+	r.mu.Unlock()
+}
+
+// method returns the implementation of method i of t, or the zero
+// Value if t is not a methodik type.
+func (r *reflector) method(t *tipe.Named, i int) reflect.Value {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	impls := r.methods[t]
+	if i >= len(impls) {
+		return reflect.Value{}
+	}
+	return impls[i]
+}
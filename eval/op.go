@@ -6,12 +6,46 @@ package eval
 
 import (
 	"fmt"
+	"math"
 	"math/big"
+	"math/cmplx"
 	"reflect"
+	"unicode/utf8"
 
 	"neugram.io/ng/token"
 )
 
+// basicTypes are the predeclared types binOp operates on, by kind.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:       reflect.TypeOf(false),
+	reflect.String:     reflect.TypeOf(""),
+	reflect.Int:        reflect.TypeOf(int(0)),
+	reflect.Int8:       reflect.TypeOf(int8(0)),
+	reflect.Int16:      reflect.TypeOf(int16(0)),
+	reflect.Int32:      reflect.TypeOf(int32(0)),
+	reflect.Int64:      reflect.TypeOf(int64(0)),
+	reflect.Uint:       reflect.TypeOf(uint(0)),
+	reflect.Uint8:      reflect.TypeOf(uint8(0)),
+	reflect.Uint16:     reflect.TypeOf(uint16(0)),
+	reflect.Uint32:     reflect.TypeOf(uint32(0)),
+	reflect.Uint64:     reflect.TypeOf(uint64(0)),
+	reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+	reflect.Float32:    reflect.TypeOf(float32(0)),
+	reflect.Float64:    reflect.TypeOf(float64(0)),
+	reflect.Complex64:  reflect.TypeOf(complex64(0)),
+	reflect.Complex128: reflect.TypeOf(complex128(0)),
+}
+
+// basicValue returns the value of v. A value of a Go defined type
+// with a basic underlying type, such as time.Duration, is converted
+// to the predeclared type.
+func basicValue(v reflect.Value) interface{} {
+	if t := basicTypes[v.Kind()]; t != nil && v.Type() != t && v.Type().PkgPath() != "" {
+		return v.Convert(t).Interface()
+	}
+	return v.Interface()
+}
+
 // TODO redo
 func valEq(x, y interface{}) bool {
 	if x == y {
@@ -50,6 +84,9 @@ func valEq(x, y interface{}) bool {
 }
 
 func binOp(op token.Token, x, y interface{}) (interface{}, error) {
+	if v, ok := bigOp(op, x, y); ok {
+		return v, nil
+	}
 	switch op {
 	case token.Add:
 		switch x := x.(type) {
@@ -103,6 +140,11 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case uint64:
 				return x + y, nil
 			}
+		case uintptr:
+			switch y := y.(type) {
+			case uintptr:
+				return x + y, nil
+			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -213,6 +255,11 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case uint64:
 				return x - y, nil
 			}
+		case uintptr:
+			switch y := y.(type) {
+			case uintptr:
+				return x - y, nil
+			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -306,6 +353,11 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case uint64:
 				return x * y, nil
 			}
+		case uintptr:
+			switch y := y.(type) {
+			case uintptr:
+				return x * y, nil
+			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -326,26 +378,12 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case complex128:
 				return x * y, nil
 			}
-		case *big.Int:
-			switch y := y.(type) {
-			case *big.Int:
-				z := big.NewInt(0)
-				return z.Mul(x, y), nil
-			}
-		case *big.Float:
-			switch y := y.(type) {
-			case *big.Float:
-				z := big.NewFloat(0)
-				return z.Mul(x, y), nil
-			}
 		}
 	case token.Div:
+		if v, ok := divOp(op, x, y); ok {
+			return v, nil
+		}
 		switch x := x.(type) {
-		case int:
-			switch y := y.(type) {
-			case int:
-				return x / y, nil
-			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -368,7 +406,17 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			}
 		}
 	case token.Rem:
+		if v, ok := divOp(op, x, y); ok {
+			return v, nil
+		}
 	case token.Pow:
+		if v, ok := powOp(x, y); ok {
+			return v, nil
+		}
+	case token.And, token.Or, token.Xor, token.AndNot, token.ShiftLeft, token.ShiftRight:
+		if v, ok := bitOp(op, x, y); ok {
+			return v, nil
+		}
 	case token.LogicalAnd, token.LogicalOr:
 		panic("logical ops processed before binOp")
 	case token.Equal:
@@ -427,6 +475,11 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case uint64:
 				return x < y, nil
 			}
+		case uintptr:
+			switch y := y.(type) {
+			case uintptr:
+				return x < y, nil
+			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -500,6 +553,11 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 			case uint64:
 				return x > y, nil
 			}
+		case uintptr:
+			switch y := y.(type) {
+			case uintptr:
+				return x > y, nil
+			}
 		case float32:
 			switch y := y.(type) {
 			case float32:
@@ -526,6 +584,281 @@ func binOp(op token.Token, x, y interface{}) (interface{}, error) {
 	panic(fmt.Sprintf("binOp type mismatch Left: %+v (%T), Right: %+v (%T) op: %v", x, x, y, y, op))
 }
 
+// powOp computes x ** y for numeric values of the same type.
+// Integer powers are computed by repeated squaring and wrap on
+// overflow, like repeated multiplication.
+func powOp(x, y interface{}) (res interface{}, ok bool) {
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	if xv.Type() != yv.Type() {
+		return nil, false
+	}
+	z := reflect.New(xv.Type()).Elem()
+	switch xv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := yv.Int()
+		if n < 0 {
+			panic(runtimeErrorf("negative exponent %d in integer power", n))
+		}
+		z.SetInt(intPow(xv.Int(), uint64(n)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		z.SetUint(uint64(intPow(int64(xv.Uint()), yv.Uint())))
+	case reflect.Float32, reflect.Float64:
+		z.SetFloat(math.Pow(xv.Float(), yv.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		z.SetComplex(complexPow(xv.Complex(), yv.Complex()))
+	default:
+		return nil, false
+	}
+	return z.Interface(), true
+}
+
+func intPow(x int64, n uint64) int64 {
+	z := int64(1)
+	for n > 0 {
+		if n&1 == 1 {
+			z *= x
+		}
+		x *= x
+		n >>= 1
+	}
+	return z
+}
+
+// bitOp computes the bitwise operation or shift x op y on integers.
+// Apart from shifts, x and y have the same type.
+func bitOp(op token.Token, x, y interface{}) (res interface{}, ok bool) {
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	var s uint64 // shift count
+	switch op {
+	case token.ShiftLeft, token.ShiftRight:
+		switch yv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if yv.Int() < 0 {
+				panic(runtimeErrorf("negative shift amount %d", yv.Int()))
+			}
+			s = uint64(yv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			s = yv.Uint()
+		default:
+			return nil, false
+		}
+	default:
+		if xv.Type() != yv.Type() {
+			return nil, false
+		}
+	}
+
+	z := reflect.New(xv.Type()).Elem()
+	switch xv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		a := xv.Int()
+		switch op {
+		case token.And:
+			z.SetInt(a & yv.Int())
+		case token.Or:
+			z.SetInt(a | yv.Int())
+		case token.Xor:
+			z.SetInt(a ^ yv.Int())
+		case token.AndNot:
+			z.SetInt(a &^ yv.Int())
+		case token.ShiftLeft:
+			z.SetInt(a << s)
+		case token.ShiftRight:
+			z.SetInt(a >> s)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		a := xv.Uint()
+		switch op {
+		case token.And:
+			z.SetUint(a & yv.Uint())
+		case token.Or:
+			z.SetUint(a | yv.Uint())
+		case token.Xor:
+			z.SetUint(a ^ yv.Uint())
+		case token.AndNot:
+			z.SetUint(a &^ yv.Uint())
+		case token.ShiftLeft:
+			z.SetUint(a << s)
+		case token.ShiftRight:
+			z.SetUint(a >> s)
+		}
+	default:
+		return nil, false
+	}
+	return z.Interface(), true
+}
+
+// bigOp computes the arithmetic, bitwise, or shift operation x op y
+// on the values of the integer and float types, *big.Int and
+// *big.Float. Apart from shifts, x and y have the same type.
+func bigOp(op token.Token, x, y interface{}) (res interface{}, ok bool) {
+	switch x := x.(type) {
+	case *big.Int:
+		if op == token.ShiftLeft || op == token.ShiftRight {
+			s := shiftCount(y)
+			if op == token.ShiftLeft {
+				return new(big.Int).Lsh(x, s), true
+			}
+			return new(big.Int).Rsh(x, s), true
+		}
+		y, ok := y.(*big.Int)
+		if !ok {
+			return nil, false
+		}
+		z := new(big.Int)
+		switch op {
+		case token.Add:
+			return z.Add(x, y), true
+		case token.Sub:
+			return z.Sub(x, y), true
+		case token.Mul:
+			return z.Mul(x, y), true
+		case token.Div, token.Rem:
+			if y.Sign() == 0 {
+				panic(runtimeErrorf("integer divide by zero"))
+			}
+			if op == token.Div {
+				return z.Quo(x, y), true
+			}
+			return z.Rem(x, y), true
+		case token.Pow:
+			if y.Sign() < 0 {
+				panic(runtimeErrorf("negative exponent %s in integer power", y))
+			}
+			return z.Exp(x, y, nil), true
+		case token.And:
+			return z.And(x, y), true
+		case token.Or:
+			return z.Or(x, y), true
+		case token.Xor:
+			return z.Xor(x, y), true
+		case token.AndNot:
+			return z.AndNot(x, y), true
+		}
+	case *big.Float:
+		y, ok := y.(*big.Float)
+		if !ok {
+			return nil, false
+		}
+		z := new(big.Float)
+		switch op {
+		case token.Add:
+			return z.Add(x, y), true
+		case token.Sub:
+			return z.Sub(x, y), true
+		case token.Mul:
+			return z.Mul(x, y), true
+		case token.Div:
+			return z.Quo(x, y), true
+		case token.Pow:
+			return bigFloatPow(x, y), true
+		}
+	}
+	return nil, false
+}
+
+// shiftCount returns the shift count y, a value of any integer
+// type. As in Go, a negative count panics.
+func shiftCount(y interface{}) uint {
+	if y, ok := y.(*big.Int); ok {
+		if y.Sign() < 0 {
+			panic(runtimeErrorf("negative shift amount %s", y))
+		}
+		return uint(y.Uint64())
+	}
+	yv := reflect.ValueOf(y)
+	switch yv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if yv.Int() < 0 {
+			panic(runtimeErrorf("negative shift amount %d", yv.Int()))
+		}
+		return uint(yv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uint(yv.Uint())
+	}
+	panic(interpPanic{fmt.Errorf("shift count of type %T", y)})
+}
+
+// bigFloatPow computes x ** y, exactly when y is a small whole number.
+func bigFloatPow(x, y *big.Float) *big.Float {
+	if y.IsInt() && y.Sign() >= 0 && y.Cmp(big.NewFloat(64)) <= 0 {
+		n, _ := y.Int64()
+		z := new(big.Float).SetPrec(x.Prec()).SetInt64(1)
+		for ; n > 0; n-- {
+			z.Mul(z, x)
+		}
+		return z
+	}
+	xf, _ := x.Float64()
+	yf, _ := y.Float64()
+	return big.NewFloat(math.Pow(xf, yf))
+}
+
+// divOp computes x / y or x % y for integers of the same type.
+// As in Go, the quotient is truncated toward zero, overflow wraps,
+// and dividing by zero panics.
+func divOp(op token.Token, x, y interface{}) (res interface{}, ok bool) {
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	if xv.Type() != yv.Type() {
+		return nil, false
+	}
+	z := reflect.New(xv.Type()).Elem()
+	switch xv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		a, b := xv.Int(), yv.Int()
+		if b == 0 {
+			panic(runtimeErrorf("integer divide by zero"))
+		}
+		if op == token.Div {
+			z.SetInt(a / b)
+		} else {
+			z.SetInt(a % b)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		a, b := xv.Uint(), yv.Uint()
+		if b == 0 {
+			panic(runtimeErrorf("integer divide by zero"))
+		}
+		if op == token.Div {
+			z.SetUint(a / b)
+		} else {
+			z.SetUint(a % b)
+		}
+	default:
+		return nil, false
+	}
+	return z.Interface(), true
+}
+
+// complementOp computes the bitwise complement ^x of an integer.
+func complementOp(x reflect.Value) reflect.Value {
+	if x, ok := x.Interface().(*big.Int); ok {
+		return reflect.ValueOf(new(big.Int).Not(x))
+	}
+	z := reflect.New(x.Type()).Elem()
+	switch x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		z.SetInt(^x.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		z.SetUint(^x.Uint())
+	default:
+		panic(fmt.Sprintf("complement of non-integer %s", x.Type()))
+	}
+	return z
+}
+
+// complexPow computes x ** y, exactly when y is a small whole number.
+func complexPow(x, y complex128) complex128 {
+	if n := real(y); imag(y) == 0 && n == math.Trunc(n) && n >= 0 && n <= 64 {
+		z := complex128(1)
+		for ; n > 0; n-- {
+			z *= x
+		}
+		return z
+	}
+	return cmplx.Pow(x, y)
+}
+
 func typeConv(t reflect.Type, v reflect.Value) (res reflect.Value) {
 	if v.Type() == t {
 		return v
@@ -644,21 +977,50 @@ func typeConv(t reflect.Type, v reflect.Value) (res reflect.Value) {
 		case reflect.Float32, reflect.Float64:
 			return reflect.ValueOf(uint64(v.Float()))
 		}
+	case reflect.Float32:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(float32(v.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return reflect.ValueOf(float32(v.Uint()))
+		case reflect.Float64:
+			return reflect.ValueOf(float32(v.Float()))
+		}
 	case reflect.Float64:
-		if v.Kind() == reflect.Float64 {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(float64(v.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return reflect.ValueOf(float64(v.Uint()))
+		case reflect.Float32, reflect.Float64:
 			res = reflect.New(t).Elem()
 			res.SetFloat(v.Float())
 			return res
 		}
-		return reflect.ValueOf(float64(v.Int()))
 	case reflect.Interface:
 		return reflect.ValueOf(v.Interface())
 	case reflect.String:
 		switch src := v.Interface().(type) {
 		case []byte:
 			return reflect.ValueOf(string(src))
-		case rune:
+		case []rune:
 			return reflect.ValueOf(string(src))
+		case UntypedRune:
+			return reflect.ValueOf(string(src.Rune))
+		case UntypedInt:
+			if !src.IsInt64() {
+				return reflect.ValueOf(string(utf8.RuneError))
+			}
+			return reflect.ValueOf(intToString(src.Int64()))
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return reflect.ValueOf(intToString(v.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() > utf8.MaxRune {
+				return reflect.ValueOf(string(utf8.RuneError))
+			}
+			return reflect.ValueOf(intToString(int64(v.Uint())))
 		}
 	}
 	if t == reflect.TypeOf([]byte(nil)) {
@@ -667,5 +1029,20 @@ func typeConv(t reflect.Type, v reflect.Value) (res reflect.Value) {
 			return reflect.ValueOf([]byte(src))
 		}
 	}
+	if t == reflect.TypeOf([]rune(nil)) {
+		switch src := v.Interface().(type) {
+		case string:
+			return reflect.ValueOf([]rune(src))
+		}
+	}
 	panic(interpPanic{fmt.Errorf("unknown type conv: %v <- %v", t, v.Type())})
 }
+
+// intToString converts an integer to a string the way the Go
+// conversion string(i) does, yielding "\uFFFD" for invalid runes.
+func intToString(i int64) string {
+	if i < 0 || i > utf8.MaxRune {
+		return string(utf8.RuneError)
+	}
+	return string(rune(i))
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"neugram.io/ng/eval/gowrap"
+	"neugram.io/ng/tipe"
+)
+
+// A native package is written in Go and imported by Neugram
+// programs by its path, as a Go package is:
+//
+//	import "geo"
+//
+//	p := geo.Point{X: 1, Y: 2}
+//	print(geo.Dist(p, geo.Origin))
+//
+// Unlike a Go package, it needs no wrapper generated and built as a
+// plugin. Its members are Go values, and the kind of each is that
+// of its value:
+//
+//   - a reflect.Type is a type. Its Neugram type, named by the
+//     member, follows the rules of Set, and other members use it
+//     wherever they use the Go type. Methods of the Go type are
+//     not members of the Neugram type.
+//   - a pointer is a variable, shared with Go as by Bind.
+//   - any other value, including a func, is a value of its Neugram
+//     type, converted as by Set.
+//
+// A package is imported as the last element of its path.
+//
+// Packages registered with Register are available to every Program
+// made after, and those in Options.Packages to one Program.
+
+// A Package is a native package.
+type Package interface {
+	// Path is the import path of the package, as in "geo" or
+	// "example.com/geo".
+	Path() string
+
+	// Members returns the members of the package, by name.
+	Members() map[string]interface{}
+}
+
+var (
+	packagesMu sync.Mutex
+	packages   = make(map[string]Package)
+)
+
+// Register makes pkg available to the Programs made after it. It is
+// usually called by the init function of the package providing pkg.
+// It panics if a package with the same path is already registered.
+func Register(pkg Package) {
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+	if pkg == nil {
+		panic("eval: Register package is nil")
+	}
+	path := pkg.Path()
+	if _, dup := packages[path]; dup {
+		panic("eval: Register called twice for package " + path)
+	}
+	packages[path] = pkg
+}
+
+// installPackages makes the registered packages, and extra, ready
+// to import. It panics if a package has a member with no Neugram
+// equivalent.
+func (p *Program) installPackages(extra []Package) {
+	byPath := make(map[string]Package)
+	packagesMu.Lock()
+	for path, pkg := range packages {
+		byPath[path] = pkg
+	}
+	packagesMu.Unlock()
+	for _, pkg := range extra {
+		byPath[pkg.Path()] = pkg
+	}
+	var paths []string
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := p.installPackage(byPath[path]); err != nil {
+			panic(fmt.Sprintf("eval: package %s: %v", path, err))
+		}
+	}
+}
+
+func (p *Program) installPackage(pkg Package) error {
+	path := pkg.Path()
+	pkgName := path[strings.LastIndex(path, "/")+1:]
+	members := pkg.Members()
+	var names []string
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	typ := &tipe.Package{Path: path, Exports: make(map[string]tipe.Type)}
+	val := &gowrap.Pkg{Exports: make(map[string]reflect.Value)}
+
+	// Name the types first, so the other members, and the types
+	// themselves, refer to them.
+	if p.goTypes == nil {
+		p.goTypes = make(goTypeMap)
+	}
+	types := make(map[string]reflect.Type)
+	for _, name := range names {
+		if rt, isType := members[name].(reflect.Type); isType {
+			if p.goTypes[rt] != nil {
+				return fmt.Errorf("type %s: Go type %s already has a Neugram type", name, rt)
+			}
+			types[name] = rt
+			p.goTypes[rt] = &tipe.Named{Name: name, PkgName: pkgName, PkgPath: path}
+		}
+	}
+	for _, name := range names {
+		rt := types[name]
+		if rt == nil {
+			continue
+		}
+		t := p.goTypes[rt]
+		under, err := p.goTypes.underlying(rt)
+		if err != nil {
+			return fmt.Errorf("type %s: %v", name, err)
+		}
+		t.Type = under
+		p.reflector.defineNamed(t)
+		typ.Exports[name] = t
+		val.Exports[name] = reflect.ValueOf(p.reflector.ToRType(t))
+	}
+
+	for _, name := range names {
+		if types[name] != nil {
+			continue
+		}
+		rv := reflect.ValueOf(members[name])
+		if !rv.IsValid() {
+			return fmt.Errorf("%s is untyped nil", name)
+		}
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return fmt.Errorf("variable %s is a nil pointer", name)
+			}
+			t, err := p.goTypes.typeOf(rv.Type().Elem())
+			if err != nil {
+				return fmt.Errorf("variable %s: %v", name, err)
+			}
+			ptrType := reflect.PtrTo(p.reflector.ToRType(t))
+			if !rv.Type().ConvertibleTo(ptrType) {
+				return fmt.Errorf("variable %s: Go type %s is not held by Neugram as itself", name, rv.Type().Elem())
+			}
+			typ.Exports[name] = t
+			val.Exports[name] = rv.Convert(ptrType).Elem()
+			continue
+		}
+		t, err := p.goTypes.typeOf(rv.Type())
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		rtype := p.reflector.ToRType(t)
+		v, ok := convertGo(rv, rtype)
+		if !ok {
+			v = reflect.New(rtype).Elem()
+			if err := extract(v, rv, name); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		typ.Exports[name] = t
+		val.Exports[name] = v
+	}
+
+	p.Types.GoPkgs[path] = typ
+	p.Pkgs[path] = val
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Neugram panic is a Go panic with a Panic value. It unwinds the
+// Go stack of the evaluator, which has a frame for each Neugram
+// function call, made by evalFuncLiteral. A function that has
+// deferred calls catches the panic on its way past, runs the calls,
+// and unless one of them recovered, panics again with the same
+// value.
+//
+// recover stops a panic only when called directly by a deferred
+// function. That function's frame is told of the panic by the
+// frame running the deferred calls. They cannot pass it through
+// the reflect.Value.Call between them, so the panic is left in
+// pendingPanics under the id of the goroutine, for the next frame
+// started on it to take.
+
+// runtimeError is the value of a panic raised by an invalid
+// operation, such as an integer division by zero. As in Go, such a
+// panic can be recovered, and its value is an error.
+type runtimeError struct {
+	msg string
+}
+
+func (e runtimeError) Error() string { return "runtime error: " + e.msg }
+
+// RuntimeError marks runtimeError as a runtime.Error.
+func (runtimeError) RuntimeError() {}
+
+func runtimeErrorf(format string, args ...interface{}) Panic {
+	return Panic{val: runtimeError{msg: fmt.Sprintf(format, args...)}}
+}
+
+// deferredCall is a call made by a defer statement. The function
+// and its arguments are evaluated when the defer statement runs.
+type deferredCall struct {
+	fn       reflect.Value
+	args     []reflect.Value
+	ellipsis bool
+}
+
+// panicState is a panic being handled by deferred calls.
+type panicState struct {
+	val       Panic
+	recovered bool
+}
+
+var (
+	pendingMu     sync.Mutex
+	pendingPanics = make(map[int64]*panicState) // by goroutine id
+	pendingCount  int32                         // len(pendingPanics), read atomically
+)
+
+func setPendingPanic(state *panicState) {
+	pendingMu.Lock()
+	pendingPanics[goid()] = state
+	atomic.StoreInt32(&pendingCount, int32(len(pendingPanics)))
+	pendingMu.Unlock()
+}
+
+// takePendingPanic removes and returns the panic left for the
+// function being called on this goroutine, if any.
+func takePendingPanic() *panicState {
+	if atomic.LoadInt32(&pendingCount) == 0 {
+		return nil
+	}
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	id := goid()
+	state := pendingPanics[id]
+	delete(pendingPanics, id)
+	atomic.StoreInt32(&pendingCount, int32(len(pendingPanics)))
+	return state
+}
+
+// goid returns the id of the current goroutine, which the runtime
+// reports as the first line of a stack trace, "goroutine 7 [...".
+func goid() int64 {
+	var buf [64]byte
+	s := string(buf[:runtime.Stack(buf[:], false)])
+	s = strings.TrimPrefix(s, "goroutine ")
+	if i := strings.IndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("eval: cannot find goroutine id: %v", err))
+	}
+	return id
+}
+
+// recoverable returns x, a value recovered from a Go panic, as a
+// Neugram Panic. Errors in the evaluator itself are not recoverable.
+func recoverable(x interface{}) (Panic, bool) {
+	switch x := x.(type) {
+	case Panic:
+		return x, true
+	case runtime.Error:
+		return Panic{val: x}, true
+	}
+	return Panic{}, false
+}
+
+// runDefers runs the deferred calls of the function frame p, last
+// deferred first. x is the value the function is panicking with,
+// or nil. If the panic is not recovered, runDefers panics with it,
+// or with the value of a later panic in a deferred call.
+func (p *Program) runDefers(x interface{}) {
+	var state *panicState
+	if x != nil {
+		val, ok := recoverable(x)
+		if !ok {
+			panic(x)
+		}
+		state = &panicState{val: val}
+	}
+	for len(p.defers) > 0 {
+		d := p.defers[len(p.defers)-1]
+		p.defers = p.defers[:len(p.defers)-1]
+		if next := p.callDeferred(d, state); next != nil {
+			state = next
+		}
+	}
+	if state != nil && !state.recovered {
+		panic(state.val)
+	}
+}
+
+// callDeferred calls d while the function is panicking with state,
+// or nil. If d panics, the new panic replaces state and is returned.
+func (p *Program) callDeferred(d deferredCall, state *panicState) (next *panicState) {
+	defer func() {
+		takePendingPanic() // d may not have been a Neugram function
+		if x := recover(); x != nil {
+			val, ok := recoverable(x)
+			if !ok {
+				panic(x)
+			}
+			next = &panicState{val: val}
+		}
+	}()
+	if state != nil && !state.recovered {
+		setPendingPanic(state)
+	}
+	if d.ellipsis {
+		d.fn.CallSlice(d.args)
+	} else {
+		d.fn.Call(d.args)
+	}
+	return nil
+}
+
+// recover implements the builtin recover in the function frame p.
+func (p *Program) recover() reflect.Value {
+	v := reflect.New(emptyIfaceType).Elem()
+	if p.panicking == nil || p.panicking.recovered {
+		return v
+	}
+	p.panicking.recovered = true
+	if val := p.panicking.val.val; val != nil {
+		v.Set(reflect.ValueOf(val))
+	}
+	return v
+}
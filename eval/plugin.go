@@ -0,0 +1,52 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !js
+
+package eval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"neugram.io/ng/eval/gowrap/genwrap"
+)
+
+// loadPlugin builds a wrapper of the Go package path, imported as
+// name, as a plugin and opens it, which adds the package to
+// gowrap.Pkgs.
+func (p *Program) loadPlugin(path, name string) error {
+	// TODO: go install pkg before genwrap for update importer?
+	src, err := genwrap.GenGo(path, "main")
+	if err != nil {
+		return fmt.Errorf("plugin: wrapper gen failed for Go package %q: %v", name, err)
+	}
+	if p.tempdir == "" {
+		p.tempdir, err = ioutil.TempDir("", "ng-tmp-")
+		if err != nil {
+			return err
+		}
+	}
+	file := "ng-plugin-" + strings.Replace(path, "/", "_", -1) + ".go"
+	err = ioutil.WriteFile(filepath.Join(p.tempdir, file), src, 0666)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("go", "build", "-buildmode=plugin", "-i", file)
+	cmd.Dir = p.tempdir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("plugin: building wrapper failed for Go package %q: %v\n%s", name, err, out)
+	}
+	pluginName := file[:len(file)-3] + ".so"
+	_, err = plugin.Open(filepath.Join(p.tempdir, pluginName))
+	if err != nil {
+		return fmt.Errorf("plugin: failed to open Go package %q: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js
+
+package eval
+
+import "fmt"
+
+// loadPlugin reports an error, as there are no plugins on js. A
+// program imports the Go packages in gowrap.Pkgs, and the native
+// packages it is given.
+func (p *Program) loadPlugin(path, name string) error {
+	return fmt.Errorf("plugin: cannot load Go package %q on js", name)
+}
@@ -0,0 +1,203 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/tipe"
+)
+
+// The builtins print, println, and printf format their operands with
+// the fmt package, knowing the Neugram type of each: %T prints the
+// Neugram type, and a value of a methodik type with a String or Error
+// method is printed by calling it, as fmt does for a Go Stringer.
+//
+// print and println are the same: both separate their operands by
+// spaces and end with a newline.
+
+// evalPrint evaluates e, a call of the builtin print, println, or
+// printf.
+func (p *Program) evalPrint(e *expr.Call, builtin tipe.Builtin) {
+	args := e.Args
+	var layout string
+	if builtin == tipe.Printf {
+		layout = p.evalExprOne(args[0]).String()
+		args = args[1:]
+	}
+	var vals []interface{}
+	for i, arg := range args {
+		v := p.evalExprOne(arg)
+		if e.Ellipsis && i == len(args)-1 {
+			for j := 0; j < v.Len(); j++ {
+				vals = append(vals, printArg{p: p, v: v.Index(j)})
+			}
+			continue
+		}
+		vals = append(vals, printArg{p: p, v: v, t: p.typeOf(arg)})
+	}
+	if builtin == tipe.Printf {
+		layout, vals = typeVerbs(layout, vals)
+		fmt.Fprintf(p.stdout, layout, vals...)
+	} else {
+		fmt.Fprintln(p.stdout, vals...)
+	}
+}
+
+// printArg is an operand of print, println, or printf.
+type printArg struct {
+	p *Program
+	v reflect.Value
+	t tipe.Type // Neugram type of v, or nil if it is an interface{}
+}
+
+// value returns the value of a and its Neugram type. For an
+// interface, these are the dynamic value and its type, which is
+// nil unless it is a Neugram type with no Go equivalent.
+func (a printArg) value() (reflect.Value, tipe.Type) {
+	v, t := a.v, a.t
+	if _, isIface := tipe.Underlying(t).(*tipe.Interface); isIface || t == nil {
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		t = a.p.dynamicType(v)
+	}
+	return v, t
+}
+
+func (a printArg) Format(f fmt.State, verb rune) {
+	v, t := a.value()
+	if !v.IsValid() {
+		fmt.Fprintf(f, formatSpec(f, verb), nil)
+		return
+	}
+	if (verb == 'v' && !f.Flag('#')) || verb == 's' || verb == 'q' {
+		if s, ok := a.p.stringMethod(v, t); ok {
+			fmt.Fprintf(f, formatSpec(f, verb), s)
+			return
+		}
+	}
+	fmt.Fprintf(f, formatSpec(f, verb), v.Interface())
+}
+
+// typeName returns the name of the type of a, as printed by %T.
+func (a printArg) typeName() string {
+	v, t := a.value()
+	switch {
+	case t != nil:
+		return format.Type(t)
+	case !v.IsValid():
+		return "<nil>"
+	}
+	return v.Type().String()
+}
+
+// typeVerbs replaces each %T directive of the printf format with %s,
+// and its operand with the name of the operand's type. The fmt
+// package formats %T itself, without asking the operand.
+//
+// A format that uses explicit argument indexes is left alone.
+func typeVerbs(format string, args []interface{}) (string, []interface{}) {
+	var out []byte
+	argNum := 0
+	for i := 0; i < len(format); i++ {
+		out = append(out, format[i])
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			out = append(out, format[i])
+			i++
+		}
+		for i < len(format) && (format[i] == '.' || format[i] == '*' || '0' <= format[i] && format[i] <= '9') {
+			if format[i] == '*' && argNum < len(args) {
+				if a, ok := args[argNum].(printArg); ok {
+					args[argNum] = a.v.Interface() // fmt requires an int
+				}
+				argNum++
+			}
+			out = append(out, format[i])
+			i++
+		}
+		if i == len(format) {
+			break
+		}
+		switch format[i] {
+		case '[':
+			return format, args
+		case '%':
+			out = append(out, '%')
+			continue
+		case 'T':
+			if argNum < len(args) {
+				if a, ok := args[argNum].(printArg); ok {
+					args[argNum] = a.typeName()
+					out = append(out, 's')
+					argNum++
+					continue
+				}
+			}
+		}
+		out = append(out, format[i])
+		argNum++
+	}
+	return string(out), args
+}
+
+// stringMethod calls the Error or String method of v, a value of the
+// type t, if t is a methodik type, or a pointer to one, with such a
+// method.
+func (p *Program) stringMethod(v reflect.Value, t tipe.Type) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	for _, name := range []string{"Error", "String"} {
+		named, i, ptr := p.methodOf(t, name)
+		if named == nil {
+			continue
+		}
+		ft := named.Methods[i]
+		if ft.Params != nil && len(ft.Params.Elems) > 0 {
+			continue
+		}
+		if ft.Results == nil || len(ft.Results.Elems) != 1 || ft.Results.Elems[0] != tipe.String {
+			continue
+		}
+		if named.PointerReceiver(i) && !ptr && !v.CanAddr() {
+			continue // as in Go, the method is not in the value's method set
+		}
+		if ptr && v.IsNil() {
+			return "<nil>", true
+		}
+		res := p.methodValue(v, named, i, ptr).Call(nil)
+		return res[0].String(), true
+	}
+	return "", false
+}
+
+// formatSpec returns the format directive, such as "%-8.2f", that
+// f is formatting with the verb.
+func formatSpec(f fmt.State, verb rune) string {
+	b := []byte{'%'}
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			b = append(b, byte(flag))
+		}
+	}
+	if w, ok := f.Width(); ok {
+		b = strconv.AppendInt(b, int64(w), 10)
+	}
+	if prec, ok := f.Precision(); ok {
+		b = append(b, '.')
+		b = strconv.AppendInt(b, int64(prec), 10)
+	}
+	return string(append(b, string(verb)...))
+}
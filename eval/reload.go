@@ -0,0 +1,225 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+)
+
+// Reloading a file evaluates its top-level declarations again, so a
+// long-running program picks up changes to its functions and types.
+//
+// Imports, types, methodiks, constants, and functions are declared
+// again. A function whose type is unchanged replaces the old one
+// everywhere, including in functions already running, such as the
+// loop of a goroutine.
+//
+// A global variable declared again with the same type keeps its
+// value, and its initializer is not evaluated. If its type is a
+// methodik or defined type that was declared again, its value is
+// copied into the new type, field by field. A variable whose type
+// changed is declared again, as a conflict, and starts from its new
+// initializer. A new variable is declared as usual.
+//
+// Other top-level statements, such as calls and assignments, are
+// not evaluated again.
+
+// A ReloadConflict is a global variable whose value Reload could not
+// keep, because its type changed.
+type ReloadConflict struct {
+	Name string
+	Old  string // the old type
+	New  string // the new type
+}
+
+func (c ReloadConflict) String() string {
+	if c.Old == c.New {
+		return fmt.Sprintf("%s: %s was declared again and its value does not fit the new type", c.Name, c.Old)
+	}
+	return fmt.Sprintf("%s changed from %s to %s", c.Name, c.Old, c.New)
+}
+
+// Reload evaluates the declarations of the file filename again. It
+// returns the variables whose values it could not keep.
+//
+// If the file does not parse, Reload returns an error and changes
+// nothing. An error evaluating a declaration stops the reload with
+// the declarations before it evaluated.
+func (p *Program) Reload(filename string) ([]ReloadConflict, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("eval: %v", err)
+	}
+	defer f.Close()
+
+	type sourceStmt struct {
+		s   stmt.Stmt
+		src string
+	}
+	var stmts []sourceStmt
+	prsr := parser.New(p.Types.Fset, filename, 0)
+	defer prsr.Close()
+	scanner := bufio.NewScanner(f)
+	var src []byte
+	for scanner.Scan() {
+		src = append(append(src, scanner.Bytes()...), '\n')
+		r := prsr.ParseLine(scanner.Bytes())
+		if len(r.Errs) > 0 {
+			return nil, r.Errs[0]
+		}
+		for _, s := range r.Stmts {
+			start := p.Types.Fset.Position(s.Pos()).Offset
+			end := p.Types.Fset.Position(s.End()).Offset
+			stmts = append(stmts, sourceStmt{s: s, src: string(src[start:end])})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("eval: %v", err)
+	}
+
+	var conflicts []ReloadConflict
+	for _, ss := range stmts {
+		switch {
+		case isDecl(ss.s):
+			if err := p.reloadDecl(ss.s, ss.src); err != nil {
+				return conflicts, err
+			}
+		case varNames(ss.s) != nil:
+			c, err := p.reloadVars(ss.s)
+			conflicts = append(conflicts, c...)
+			if err != nil {
+				return conflicts, err
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// varNames returns the names declared by s, if it declares variables.
+func varNames(s stmt.Stmt) (names []string) {
+	switch s := s.(type) {
+	case *stmt.Assign:
+		if !s.Decl {
+			return nil
+		}
+		for _, e := range s.Left {
+			names = append(names, e.(*expr.Ident).Name)
+		}
+	case *stmt.Var:
+		names = s.NameList
+	case *stmt.VarSet:
+		for _, v := range s.Vars {
+			names = append(names, v.NameList...)
+		}
+	}
+	return names
+}
+
+// reloadDecl evaluates the declaration s again. A function that
+// replaces one of the same Go type is set in the variable of the
+// old one, which running functions refer to.
+func (p *Program) reloadDecl(s stmt.Stmt, src string) error {
+	before := p.Cur
+	if _, err := p.evalTop(context.Background(), s); err != nil {
+		return err
+	}
+	p.journal = append(p.journal, decl{src: src, before: before, after: p.Cur})
+
+	fn, isFunc := s.(*stmt.Simple)
+	if !isFunc {
+		return nil
+	}
+	name := fn.Expr.(*expr.FuncLiteral).Name
+	v := p.Cur.Lookup(name)
+	for scope := before; scope != nil && scope != p.Universe; scope = scope.Parent {
+		if scope.VarName != name || scope.Var.Type() != v.Type() || !scope.Var.CanSet() {
+			continue
+		}
+		scope.Var.Set(v)
+	}
+	return nil
+}
+
+// reloadVars evaluates s, a declaration of variables, again if it
+// declares a new variable or changes the type of one.
+func (p *Program) reloadVars(s stmt.Stmt) ([]ReloadConflict, error) {
+	names := varNames(s)
+	oldTypes := make(map[string]string)
+	oldVals := make(map[string]reflect.Value)
+	for _, name := range names {
+		if obj := p.Types.Lookup(name); obj != nil && name != "_" {
+			oldTypes[name] = format.Type(obj.Type)
+			oldVals[name] = p.Cur.Lookup(name)
+		}
+	}
+
+	// Find the new types without evaluating the initializers.
+	p.Types.Errs = p.Types.Errs[:0]
+	p.typesMu.Lock()
+	p.Types.Add(s)
+	p.typesMu.Unlock()
+	if len(p.Types.Errs) > 0 {
+		return nil, fmt.Errorf("typecheck: %v", p.Types.Errs[0])
+	}
+	keep := true
+	var conflicts []ReloadConflict
+	for _, name := range names {
+		if name == "_" {
+			continue
+		}
+		old, existed := oldTypes[name]
+		newType := format.Type(p.Types.Lookup(name).Type)
+		switch {
+		case !existed:
+			keep = false
+		case old != newType:
+			keep = false
+			conflicts = append(conflicts, ReloadConflict{Name: name, Old: old, New: newType})
+		}
+	}
+
+	if keep {
+		for _, name := range names {
+			if name == "_" {
+				continue
+			}
+			if err := p.keepVar(name, oldVals[name]); err != nil {
+				keep = false
+				conflicts = append(conflicts, ReloadConflict{Name: name, Old: oldTypes[name], New: oldTypes[name]})
+			}
+		}
+	}
+	if !keep {
+		if _, err := p.evalTop(context.Background(), s); err != nil {
+			return conflicts, err
+		}
+	}
+	return conflicts, nil
+}
+
+// keepVar gives the variable name, whose declaration has just been
+// checked again, the value old of its previous declaration.
+func (p *Program) keepVar(name string, old reflect.Value) error {
+	t := p.Types.Lookup(name).Type
+	if old.Type() == p.reflector.ToRType(t) {
+		return nil // the variable is unchanged
+	}
+	if _, err := p.evalTop(context.Background(), &stmt.Var{NameList: []string{name}, Type: t}); err != nil {
+		return err
+	}
+	return extract(p.Cur.Lookup(name), old, name)
+}
@@ -2,6 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// +build !js
+
 package shell
 
 import (
@@ -15,26 +17,11 @@ import (
 	"sync"
 	"syscall"
 
-	"neugram.io/ng/eval/environ"
 	"neugram.io/ng/expr"
 	"neugram.io/ng/format"
 	"neugram.io/ng/token"
 )
 
-var (
-	Env   *environ.Environ
-	Alias *environ.Environ
-)
-
-type Params interface {
-	Get(name string) string
-	Set(name, value string)
-}
-
-type paramset interface {
-	Get(name string) string
-}
-
 type Job struct {
 	Cmd    *expr.ShellList
 	Stdin  *os.File
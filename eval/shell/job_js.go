@@ -0,0 +1,43 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js
+
+package shell
+
+import (
+	"errors"
+	"os"
+
+	"neugram.io/ng/expr"
+)
+
+// errNoShell is the error of a job where there are no processes.
+var errNoShell = errors.New("shell: commands are not supported on js")
+
+type Job struct {
+	Cmd    *expr.ShellList
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+	Params Params
+}
+
+func (j *Job) Start() error {
+	return errNoShell
+}
+
+func (j *Job) Result() (done bool, err error) {
+	return true, errNoShell
+}
+
+func (j *Job) Continue() error {
+	return errNoShell
+}
+
+func (j *Job) Wait() (done bool, err error) {
+	return true, errNoShell
+}
+
+func Init() {}
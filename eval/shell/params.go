@@ -0,0 +1,21 @@
+// Copyright 2015 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shell
+
+import "neugram.io/ng/eval/environ"
+
+var (
+	Env   *environ.Environ
+	Alias *environ.Environ
+)
+
+type Params interface {
+	Get(name string) string
+	Set(name, value string)
+}
+
+type paramset interface {
+	Get(name string) string
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/stmt"
+)
+
+// A snapshot of a Program is the source of its top-level
+// declarations, and the types and values of its global variables,
+// in the order they were made. Restore evaluates the declarations
+// again, so imports, types, methodiks, constants, and functions are
+// remade, and declares each variable with its value.
+//
+// Only declarations evaluated from source by Eval or from a file
+// are recorded, as the source of a statement given to EvalStmt is
+// not known. Values are copied with encoding/gob, so:
+//
+//   - channels, funcs assigned to variables, and interface values
+//     of a type gob does not know are restored as their zero value.
+//   - pointers are followed, and two variables that point to the
+//     same value are restored pointing to two copies of it.
+//   - variables made by Bind and RegisterFunc are restored as copies
+//     of their values, and must be bound or registered again.
+
+// snapshotVersion is the version of the format of a snapshot.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int
+	Path    string
+	Items   []snapshotItem
+}
+
+// snapshotItem is a declaration, if Src is set, or a variable.
+type snapshotItem struct {
+	Src   string
+	Name  string
+	Type  string
+	Value []byte // gob encoding, or nil for the zero value
+}
+
+// decl is a top-level declaration evaluated from source. The scopes
+// before and after evaluating it bound the variables it made.
+type decl struct {
+	src           string
+	before, after *Scope
+}
+
+// isDecl reports whether s is a declaration recorded for Snapshot.
+func isDecl(s stmt.Stmt) bool {
+	switch s := s.(type) {
+	case *stmt.Import, *stmt.ImportSet, *stmt.TypeDecl, *stmt.MethodikDecl, *stmt.Const, *stmt.ConstSet:
+		return true
+	case *stmt.Simple:
+		fn, isFunc := s.Expr.(*expr.FuncLiteral)
+		return isFunc && fn.Name != ""
+	}
+	return false
+}
+
+// Snapshot returns the state of p, which Restore makes a new Program
+// from.
+func (p *Program) Snapshot() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var scopes []*Scope // oldest first
+	for scope := p.Cur; scope != nil && scope != p.Universe; scope = scope.Parent {
+		scopes = append(scopes, scope)
+	}
+	for i, j := 0, len(scopes)-1; i < j; i, j = i+1, j-1 {
+		scopes[i], scopes[j] = scopes[j], scopes[i]
+	}
+	index := make(map[*Scope]int)
+	latest := make(map[*Scope]bool) // not shadowed by a later variable
+	seen := make(map[string]bool)
+	for i := len(scopes) - 1; i >= 0; i-- {
+		index[scopes[i]] = i
+		if name := scopes[i].VarName; !seen[name] {
+			seen[name] = true
+			latest[scopes[i]] = true
+		}
+	}
+
+	// A variable made by a declaration is remade by evaluating it.
+	owned := make(map[*Scope]bool)
+	declsAt := make(map[int][]string)
+	for _, d := range p.journal {
+		before, okBefore := index[d.before]
+		after, okAfter := index[d.after]
+		if !okBefore || !okAfter {
+			continue
+		}
+		for _, scope := range scopes[before+1 : after+1] {
+			owned[scope] = true
+		}
+		declsAt[after] = append(declsAt[after], d.src)
+	}
+
+	snap := snapshot{Version: snapshotVersion, Path: p.Path}
+	for i, scope := range scopes {
+		if scope.VarName != "" && scope.VarName != "_" && !owned[scope] {
+			if item, ok := p.snapshotVar(scope, latest[scope]); ok {
+				snap.Items = append(snap.Items, item)
+			}
+		}
+		for _, src := range declsAt[i] {
+			snap.Items = append(snap.Items, snapshotItem{Src: src})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		return nil, fmt.Errorf("eval: snapshot: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// snapshotVar records the variable of scope. Its Neugram type is
+// known if it is the latest variable of its name, otherwise it is
+// found from the Go type of its value.
+func (p *Program) snapshotVar(scope *Scope, latest bool) (snapshotItem, bool) {
+	item := snapshotItem{Name: scope.VarName}
+	if obj := p.Types.Lookup(scope.VarName); latest && obj != nil {
+		item.Type = format.Type(obj.Type)
+	} else if t, err := TypeOfGo(scope.Var.Type()); err == nil {
+		item.Type = format.Type(t)
+	} else {
+		return item, false
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(scope.Var); err == nil {
+		item.Value = buf.Bytes()
+	}
+	return item, true
+}
+
+// Restore returns a new Program with the state recorded by Snapshot.
+// If opts.Path is empty, it is the path of the snapshot's Program.
+func Restore(blob []byte, opts Options) (*Program, error) {
+	var snap snapshot
+	if err := gob.NewDecoder(bytes.NewReader(blob)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("eval: restore: %v", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("eval: restore: snapshot version %d, want %d", snap.Version, snapshotVersion)
+	}
+	if opts.Path == "" {
+		opts.Path = snap.Path
+	}
+	p := New(opts)
+	for _, item := range snap.Items {
+		if item.Src != "" {
+			if _, err := p.evalSource(context.Background(), strings.NewReader(item.Src)); err != nil {
+				return nil, fmt.Errorf("eval: restore: %v", err)
+			}
+			continue
+		}
+		if _, err := p.evalSource(context.Background(), strings.NewReader("var "+item.Name+" "+item.Type)); err != nil {
+			return nil, fmt.Errorf("eval: restore %s: %v", item.Name, err)
+		}
+		if item.Value == nil {
+			continue
+		}
+		v := p.Cur.Lookup(item.Name)
+		if err := gob.NewDecoder(bytes.NewReader(item.Value)).DecodeValue(v); err != nil {
+			return nil, fmt.Errorf("eval: restore %s: %v", item.Name, err)
+		}
+	}
+	return p, nil
+}
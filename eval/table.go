@@ -0,0 +1,132 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/table"
+	"neugram.io/ng/tipe"
+)
+
+// A table, [|]T, is held in a *table.Table, with a column of the Go
+// type of each column's values. The names of its columns are those
+// of the literal, or of the schema of its type.
+
+func (p *Program) evalTableLiteral(e *expr.TableLiteral) *table.Table {
+	t, _ := p.typeOf(e).(*tipe.Table)
+	if t == nil {
+		t = e.Type
+	}
+	width := len(e.ColNames)
+	if width == 0 && t.Schema != nil {
+		width = len(t.Schema.Columns)
+	}
+	if width == 0 && len(e.Rows) > 0 {
+		width = len(e.Rows[0])
+	}
+	cols := make([]table.Column, width)
+	for i := range cols {
+		typ := t.Type
+		if t.Schema != nil {
+			col := &t.Schema.Columns[i]
+			cols[i].Name = col.Name
+			typ = t.ColumnType(col)
+		}
+		if len(e.ColNames) > 0 {
+			cols[i].Name = p.evalExprOne(e.ColNames[i]).String()
+		}
+		cols[i].Type = p.reflector.ToRType(typ)
+	}
+	tbl, err := table.New(cols...)
+	if err != nil {
+		panic(runtimeErrorf("%v", err))
+	}
+	p.allocTable(len(e.Rows) * width)
+	row := make([]interface{}, width)
+	for _, r := range e.Rows {
+		for i, elem := range r {
+			row[i] = p.evalExprOne(elem).Interface()
+		}
+		if err := tbl.AppendRow(row...); err != nil {
+			panic(interpPanic{err})
+		}
+	}
+	return tbl
+}
+
+// extractTable stores the table src in dst, a *table.Table, a slice
+// of rows that are slices, or a slice of structs with a field for
+// each column it needs, by name.
+func extractTable(dst reflect.Value, src *table.Table, path string) error {
+	if dst.Type() == tableType {
+		dst.Set(reflect.ValueOf(src.Copy()))
+		return nil
+	}
+	if dst.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot store %s (type %s) in a %s", path, tableType, dst.Type())
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	n := src.Len()
+	rows := reflect.MakeSlice(dst.Type(), n, n)
+	et := dst.Type().Elem()
+	for y := 0; y < n; y++ {
+		row := rows.Index(y)
+		rowPath := fmt.Sprintf("%s[%d]", path, y)
+		switch et.Kind() {
+		case reflect.Struct:
+			for i := 0; i < et.NumField(); i++ {
+				name, ok := ngField(et.Field(i))
+				if !ok {
+					continue
+				}
+				x := columnFor(src, name)
+				if x < 0 {
+					return fmt.Errorf("%s has no column %s for %s", path, name, et)
+				}
+				if err := extract(row.Field(i), src.Value(y, x), rowPath+"."+name); err != nil {
+					return err
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			if et.Kind() == reflect.Slice {
+				row.Set(reflect.MakeSlice(et, src.NumCols(), src.NumCols()))
+			} else if et.Len() != src.NumCols() {
+				return fmt.Errorf("cannot store %s (%d columns) in a %s", path, src.NumCols(), dst.Type())
+			}
+			for x := 0; x < src.NumCols(); x++ {
+				if err := extract(row.Index(x), src.Value(y, x), fmt.Sprintf("%s[%d]", rowPath, x)); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("cannot store %s (type %s) in a %s", path, tableType, dst.Type())
+		}
+	}
+	dst.Set(rows)
+	return nil
+}
+
+// columnFor returns the column of t for the struct field name: the
+// column named name or, failing that, one whose name matches it
+// ignoring case, as encoding/json matches keys. It returns -1 if
+// there is none.
+func columnFor(t *table.Table, name string) int {
+	if x := t.ColumnIndex(name); x >= 0 {
+		return x
+	}
+	for x, col := range t.Cols() {
+		if strings.EqualFold(col, name) {
+			return x
+		}
+	}
+	return -1
+}
@@ -0,0 +1,12 @@
+package models
+
+import "math"
+
+// Dist returns the distance between p and q.
+func Dist(p, q Point) float64 {
+	return p.Sub(q).Len()
+}
+
+func (p Point) Len() float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y)
+}
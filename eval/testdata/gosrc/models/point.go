@@ -0,0 +1,22 @@
+package models
+
+// Origin is the point (0, 0).
+var Origin = Point{}
+
+const Version = "v1"
+
+// A Point is a position in the plane.
+type Point struct {
+	X float64
+	Y float64
+}
+
+func (p Point) Sub(q Point) Point {
+	return Point{X: p.X - q.X, Y: p.Y - q.Y}
+}
+
+// Scale multiplies the coordinates of p by k.
+func (p *Point) Scale(k float64) {
+	p.X *= k
+	p.Y *= k
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expr
+
+import (
+	"strings"
+
+	"neugram.io/ng/token"
+)
+
+// Comment is a single //-style or /*-style comment.
+type Comment struct {
+	Span
+	Text string // comment text, including the comment markers
+}
+
+// CommentGroup is a sequence of comments with no blank lines
+// or other tokens between them.
+type CommentGroup struct {
+	List []*Comment
+}
+
+func (g *CommentGroup) Pos() token.Pos { return g.List[0].Pos() }
+func (g *CommentGroup) End() token.Pos { return g.List[len(g.List)-1].End() }
+
+// Text returns the text of the comment group with the comment
+// markers, trailing spaces, and leading and trailing blank lines
+// removed. A non-empty result ends in a newline.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		if strings.HasPrefix(text, "//") {
+			text = text[2:]
+			if strings.HasPrefix(text, " ") {
+				text = text[1:]
+			}
+		} else {
+			text = strings.TrimSuffix(text[2:], "*/")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
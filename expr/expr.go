@@ -6,52 +6,94 @@
 package expr
 
 import (
+	"math/big"
+
 	"neugram.io/ng/tipe"
 	"neugram.io/ng/token"
 )
 
+// Node is a node of the syntax tree, an expression or statement.
+// Positions are resolved with the token.FileSet used by the parser.
+type Node interface {
+	Pos() token.Pos // position of the first character of the node
+	End() token.Pos // position just after the node
+}
+
+// Span is the source range of a node. It is embedded in every
+// expression and statement to implement Node.
+type Span struct {
+	From token.Pos
+	To   token.Pos
+}
+
+func (s Span) Pos() token.Pos { return s.From }
+func (s Span) End() token.Pos { return s.To }
+
 type Expr interface {
+	Node
 	expr()
 }
 
 type Binary struct {
+	Span
 	Op    token.Token // Add, Sub, Mul, Div, Rem, Pow, And, Or, Equal, NotEqual, Less, Greater
 	Left  Expr
 	Right Expr
 }
 
 type Unary struct {
+	Span
 	Op   token.Token // Not, Mul (deref), Ref, LeftParen, Range
 	Expr Expr
 }
 
 type Bad struct {
+	Span
 	Error error
 }
 
 type Selector struct {
+	Span
 	Left  Expr
 	Right *Ident
 }
 
+// TypeAssert is a type assertion, "x.(T)".
+// Type is nil for the "x.(type)" guard of a type switch.
+type TypeAssert struct {
+	Span
+	Expr Expr
+	Type tipe.Type
+}
+
 type Slice struct {
+	Span
 	Low  Expr
 	High Expr
 	Max  Expr
 }
 
 type Index struct {
+	Span
 	Left     Expr
 	Indicies []Expr
 }
 
 type BasicLiteral struct {
-	Value interface{} // string, *big.Int, *big.Float
+	Span
+	Value interface{} // string, rune, *big.Int, *big.Float, Imaginary
+}
+
+// Imaginary is the value of an imaginary BasicLiteral, such as 3i.
+type Imaginary struct {
+	Imag *big.Float
 }
 
 type FuncLiteral struct {
-	Name            string // may be empty
-	ReceiverName    string // if non-empty, this is a method
+	Span
+	Doc             *CommentGroup // associated documentation, or nil
+	Name            string        // may be empty
+	ReceiverName    string        // if non-empty, this is a method
 	PointerReceiver bool
 	Type            *tipe.Func
 	ParamNames      []string
@@ -60,23 +102,33 @@ type FuncLiteral struct {
 }
 
 type CompLiteral struct {
+	Span
 	Type     tipe.Type
 	Keys     []Expr // TODO: could make this []string
 	Elements []Expr
 }
 
 type MapLiteral struct {
+	Span
 	Type   tipe.Type
 	Keys   []Expr
 	Values []Expr
 }
 
+type ArrayLiteral struct {
+	Span
+	Type  *tipe.Array
+	Elems []Expr
+}
+
 type SliceLiteral struct {
+	Span
 	Type  *tipe.Slice
 	Elems []Expr
 }
 
 type TableLiteral struct {
+	Span
 	Type     *tipe.Table
 	ColNames []Expr
 	Rows     [][]Expr
@@ -85,17 +137,21 @@ type TableLiteral struct {
 // Type is not a typical Neugram expression. It is used only for when
 // types are passed as arguments to the builtin functions new and make.
 type Type struct {
+	Span
 	Type tipe.Type
 }
 
 type Ident struct {
+	Span
 	Name string
 	// Type tipe.Type
 }
 
 type Call struct {
+	Span
 	Func       Expr
 	Args       []Expr
+	Ellipsis   bool // last argument is spread with ...
 	ElideError bool
 }
 
@@ -106,43 +162,51 @@ type Range struct {
 }
 
 type ShellList struct {
+	Span
 	AndOr []*ShellAndOr
 }
 
 type ShellAndOr struct {
+	Span
 	Pipeline   []*ShellPipeline
 	Sep        []token.Token // '&&' or '||'. len(Sep) == len(Pipeline)-1
 	Background bool
 }
 
 type ShellPipeline struct {
+	Span
 	Bang bool
 	Cmd  []*ShellCmd // Cmd[0] | Cmd[1] | ...
 }
 
 type ShellCmd struct {
+	Span
 	SimpleCmd *ShellSimpleCmd // or:
 	Subshell  *ShellList
 }
 
 type ShellSimpleCmd struct {
+	Span
 	Redirect []*ShellRedirect
 	Assign   []ShellAssign
 	Args     []string
 }
 
 type ShellRedirect struct {
+	Span
 	Number   *int
 	Token    token.Token // '<', '<&', '>', '>&', '>>'
 	Filename string
 }
 
 type ShellAssign struct {
+	Span
 	Key   string
 	Value string
 }
 
 type Shell struct {
+	Span
 	Cmds       []*ShellList
 	TrapOut    bool // override os.Stdout, outer language collect it
 	DropOut    bool // send stdout to /dev/null (just an optimization)
@@ -155,11 +219,13 @@ var (
 	_ = Expr((*Unary)(nil))
 	_ = Expr((*Bad)(nil))
 	_ = Expr((*Selector)(nil))
+	_ = Expr((*TypeAssert)(nil))
 	_ = Expr((*Slice)(nil))
 	_ = Expr((*BasicLiteral)(nil))
 	_ = Expr((*FuncLiteral)(nil))
 	_ = Expr((*CompLiteral)(nil))
 	_ = Expr((*MapLiteral)(nil))
+	_ = Expr((*ArrayLiteral)(nil))
 	_ = Expr((*SliceLiteral)(nil))
 	_ = Expr((*TableLiteral)(nil))
 	_ = Expr((*Type)(nil))
@@ -179,11 +245,13 @@ func (e *Binary) expr()         {}
 func (e *Unary) expr()          {}
 func (e *Bad) expr()            {}
 func (e *Selector) expr()       {}
+func (e *TypeAssert) expr()     {}
 func (e *Slice) expr()          {}
 func (e *BasicLiteral) expr()   {}
 func (e *FuncLiteral) expr()    {}
 func (e *CompLiteral) expr()    {}
 func (e *MapLiteral) expr()     {}
+func (e *ArrayLiteral) expr()   {}
 func (e *SliceLiteral) expr()   {}
 func (e *TableLiteral) expr()   {}
 func (e *Type) expr()           {}
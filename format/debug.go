@@ -7,12 +7,7 @@ package format
 import (
 	"bytes"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
-	"os/exec"
 	"reflect"
-	"strings"
 )
 
 type debugPrinter struct {
@@ -172,6 +167,10 @@ func (p *debugPrinter) printv(v reflect.Value) {
 				if isZero(v.Field(i)) {
 					continue
 				}
+				if f := t.Field(i); f.Anonymous && f.Name == "Span" {
+					// Source positions make every diff noisy.
+					continue
+				}
 				p.newline()
 				p.printf("%s: ", t.Field(i).Name)
 				p.printv(v.Field(i))
@@ -199,54 +198,6 @@ func (p *debugPrinter) printv(v reflect.Value) {
 	}
 }
 
-func printToFile(x interface{}) (path string, err error) {
-	f, err := ioutil.TempFile("", "neugram-diff-")
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		err2 := f.Close()
-		if err == nil {
-			err = err2
-		}
-		if err != nil {
-			os.Remove(f.Name())
-		}
-	}()
-
-	str := Debug(x)
-	if _, err := io.WriteString(f, str); err != nil {
-		return "", err
-	}
-	return f.Name(), nil
-}
-
-func diffVal(x, y interface{}) (string, error) {
-	fx, err := printToFile(x)
-	if err != nil {
-		return "", fmt.Errorf("diff print lhs error: %v", err)
-	}
-	defer os.Remove(fx)
-	fy, err := printToFile(y)
-	if err != nil {
-		return "", fmt.Errorf("diff print rhs error: %v", err)
-	}
-	defer os.Remove(fy)
-
-	b, _ := ioutil.ReadFile(fx)
-	fmt.Printf("fx: %s\n", b)
-
-	data, err := exec.Command("diff", "-U100", "-u", fx, fy).CombinedOutput()
-	if err != nil && len(data) == 0 {
-		// diff exits with a non-zero status when the files don't match.
-		return "", fmt.Errorf("diff error: %v", err)
-	}
-	res := string(data)
-	res = strings.Replace(res, fx, "/x", 1)
-	res = strings.Replace(res, fy, "/y", 1)
-	return res, nil
-}
-
 func WriteDebug(buf *bytes.Buffer, e interface{}) {
 	p := debugPrinter{
 		buf:     buf,
@@ -0,0 +1,61 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !js
+
+package format
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func printToFile(x interface{}) (path string, err error) {
+	f, err := ioutil.TempFile("", "neugram-diff-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	str := Debug(x)
+	if _, err := io.WriteString(f, str); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func diffVal(x, y interface{}) (string, error) {
+	fx, err := printToFile(x)
+	if err != nil {
+		return "", fmt.Errorf("diff print lhs error: %v", err)
+	}
+	defer os.Remove(fx)
+	fy, err := printToFile(y)
+	if err != nil {
+		return "", fmt.Errorf("diff print rhs error: %v", err)
+	}
+	defer os.Remove(fy)
+
+	data, err := exec.Command("diff", "-U100", "-u", fx, fy).CombinedOutput()
+	if err != nil && len(data) == 0 {
+		// diff exits with a non-zero status when the files don't match.
+		return "", fmt.Errorf("diff error: %v", err)
+	}
+	res := string(data)
+	res = strings.Replace(res, fx, "/x", 1)
+	res = strings.Replace(res, fy, "/y", 1)
+	return res, nil
+}
@@ -0,0 +1,13 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js
+
+package format
+
+import "errors"
+
+func diffVal(x, y interface{}) (string, error) {
+	return "", errors.New("diff is not supported on js")
+}
@@ -10,6 +10,8 @@ package format
 import (
 	"bytes"
 	"fmt"
+	"math/big"
+	"strconv"
 
 	"neugram.io/ng/expr"
 	"neugram.io/ng/token"
@@ -22,6 +24,91 @@ type printer struct {
 
 func (p *printer) expr(e expr.Expr) {
 	switch e := e.(type) {
+	case *expr.BasicLiteral:
+		switch v := e.Value.(type) {
+		case string:
+			p.buf.WriteString(strconv.Quote(v))
+		case rune:
+			p.buf.WriteString(strconv.QuoteRune(v))
+		case *big.Int:
+			p.buf.WriteString(v.String())
+		case *big.Float:
+			p.buf.WriteString(v.Text('g', -1))
+		case expr.Imaginary:
+			p.buf.WriteString(v.Imag.Text('g', -1))
+			p.buf.WriteByte('i')
+		default:
+			p.printf("%v", v)
+		}
+	case *expr.Ident:
+		p.buf.WriteString(e.Name)
+	case *expr.Type:
+		p.tipe(e.Type)
+	case *expr.Binary:
+		p.expr(e.Left)
+		p.printf(" %s ", e.Op)
+		p.expr(e.Right)
+	case *expr.Unary:
+		switch e.Op {
+		case token.LeftParen:
+			p.buf.WriteByte('(')
+			p.expr(e.Expr)
+			p.buf.WriteByte(')')
+		case token.Range:
+			p.buf.WriteString("range ")
+			p.expr(e.Expr)
+		default:
+			p.buf.WriteString(e.Op.String())
+			p.expr(e.Expr)
+		}
+	case *expr.Selector:
+		p.expr(e.Left)
+		p.buf.WriteByte('.')
+		p.expr(e.Right)
+	case *expr.Index:
+		p.expr(e.Left)
+		p.buf.WriteByte('[')
+		for i, ind := range e.Indicies {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expr(ind)
+		}
+		p.buf.WriteByte(']')
+	case *expr.Slice:
+		if e.Low != nil {
+			p.expr(e.Low)
+		}
+		p.buf.WriteByte(':')
+		if e.High != nil {
+			p.expr(e.High)
+		}
+		if e.Max != nil {
+			p.buf.WriteByte(':')
+			p.expr(e.Max)
+		}
+	case *expr.TypeAssert:
+		p.expr(e.Expr)
+		p.buf.WriteString(".(")
+		if e.Type == nil {
+			p.buf.WriteString("type")
+		} else {
+			p.tipe(e.Type)
+		}
+		p.buf.WriteByte(')')
+	case *expr.Call:
+		p.expr(e.Func)
+		p.buf.WriteByte('(')
+		for i, arg := range e.Args {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expr(arg)
+		}
+		if e.Ellipsis {
+			p.buf.WriteString("...")
+		}
+		p.buf.WriteByte(')')
 	case *expr.Shell:
 		if len(e.Cmds) == 1 {
 			p.buf.WriteString("$$ ")
@@ -118,10 +205,98 @@ func (p *printer) expr(e expr.Expr) {
 			p.buf.WriteString(r.Token.String())
 			p.buf.WriteString(r.Filename)
 		}
+	case *expr.ShellRedirect:
+		if e.Number != nil {
+			p.printf("%d", *e.Number)
+		}
+		p.buf.WriteString(e.Token.String())
+		p.buf.WriteString(e.Filename)
+	case *expr.ShellAssign:
+		p.printf("%s=%s", e.Key, e.Value)
+	case *expr.CompLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		}
+		p.buf.WriteByte('{')
+		for i, elem := range e.Elements {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			if i < len(e.Keys) && e.Keys[i] != nil {
+				p.expr(e.Keys[i])
+				p.buf.WriteString(": ")
+			}
+			p.expr(elem)
+		}
+		p.buf.WriteByte('}')
+	case *expr.MapLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		}
+		p.buf.WriteByte('{')
+		for i, key := range e.Keys {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.expr(key)
+			p.buf.WriteString(": ")
+			if i < len(e.Values) {
+				p.expr(e.Values[i])
+			}
+		}
+		p.buf.WriteByte('}')
+	case *expr.ArrayLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		}
+		p.exprList("{", e.Elems, "}")
+	case *expr.SliceLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		}
+		p.exprList("{", e.Elems, "}")
+	case *expr.TableLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		}
+		p.buf.WriteByte('{')
+		if len(e.ColNames) > 0 {
+			p.exprList("{|", e.ColNames, "|}")
+		}
+		for i, row := range e.Rows {
+			if i > 0 || len(e.ColNames) > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.exprList("{", row, "}")
+		}
+		p.buf.WriteByte('}')
+	case *expr.FuncLiteral:
+		if e.Type != nil {
+			p.tipe(e.Type)
+		} else {
+			p.buf.WriteString("func")
+		}
+		p.buf.WriteString(" {...}")
+	case *expr.Bad:
+		p.buf.WriteString("BadExpr")
+	case nil:
+		p.buf.WriteString("<nil>")
 	default:
-		p.printf("format: unknown expr %T: ", e)
-		WriteDebug(p.buf, e)
+		p.printf("<unknown expr %T>", e)
+	}
+}
+
+// exprList writes the expressions es, separated by commas, between
+// open and close.
+func (p *printer) exprList(open string, es []expr.Expr, close string) {
+	p.buf.WriteString(open)
+	for i, e := range es {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.expr(e)
 	}
+	p.buf.WriteString(close)
 }
 
 func (p *printer) printf(format string, args ...interface{}) {
@@ -20,17 +20,46 @@ $$`,
 
 func TestRoundTrip(t *testing.T) {
 	for _, src := range roundTripTests {
-		s, err := parser.ParseStmt([]byte("(" + src + ")"))
+		x, err := parser.ParseExpr([]byte("(" + src + ")"))
 		if err != nil {
-			t.Errorf("ParseStmt(%q): error: %v", src, err)
+			t.Errorf("ParseExpr(%q): error: %v", src, err)
 			continue
 		}
-		if s == nil {
-			t.Errorf("ParseStmt(%q): nil stmt", src)
+		got := format.Expr(x.(*expr.Unary).Expr)
+		if got != src {
+			t.Errorf("bad ouput: Expr(%q)=%q", src, got)
+		}
+	}
+}
+
+var exprTests = []string{
+	`x + y * 2`,
+	`f(a, "b", 'c')`,
+	`s[1:len(s)]`,
+	`*p.X`,
+	`f(&m[k], !(a && b))`,
+	`pkg.F(1.5)`,
+	`-x ** 2 ** y`,
+	`x &^ y | ^z << 2 >> n`,
+	`1 + 2.5i`,
+	`f(x, y...)`,
+	`f(x.(int64), y.(io.Reader))`,
+	`f(P{X: 1}, []int{1, 2})`,
+	`P{X: 1}.X`,
+	`[]int{1, 2}[0]`,
+	`[2]string{"a", "b"}`,
+	`map[string]int{"a": 1, "b": 2}`,
+	`[|]int{{|"a", "b"|}, {1, 2}}`,
+}
+
+func TestExprs(t *testing.T) {
+	for _, src := range exprTests {
+		x, err := parser.ParseExpr([]byte(src))
+		if err != nil {
+			t.Errorf("ParseExpr(%q): error: %v", src, err)
 			continue
 		}
-		e := s.(*stmt.Simple).Expr.(*expr.Unary).Expr
-		got := format.Expr(e)
+		got := format.Expr(x)
 		if got != src {
 			t.Errorf("bad ouput: Expr(%q)=%q", src, got)
 		}
@@ -41,6 +70,9 @@ var typeTests = []string{
 	`string`,
 	`uintptr`,
 	`[]interface{}`,
+	`[4][]int`,
+	`[|]float64`,
+	`[|"a", "b" string|]float64`,
 	`map[int64]map[string]int`,
 	`struct {
 	Field0     int
@@ -0,0 +1,397 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gengo translates Neugram programs to Go source, so a
+// program can be built into a binary that needs no evaluator.
+//
+// The program is type checked first, and its Go equivalent is
+// derived from the types and constants the type checker recorded.
+// Neugram features that Go lacks are lowered:
+//
+//   - the builtins print, println, printf, errorf, and cols call
+//     the runtime support package neugram.io/ng/gengo/ngrt,
+//   - x ** y is a constant if it is one, and otherwise a call of
+//     the ngrt Pow function for its type,
+//   - a call whose error result is elided panics if the error is
+//     not nil, as it does when evaluated,
+//   - a table is an *ngrt.Table.
+//
+// The variables declared at the top level of a program are package
+// variables of the Go program, so named functions can refer to
+// them. In package main, the other top-level statements make up
+// func main.
+//
+// With Config.LineFile, the source has //line directives that give
+// the position of each declaration and statement in the program.
+//
+// Shell expressions, the environment variables env and alias,
+// imports of Neugram packages, and the types num, integer and float
+// have no Go equivalent, and are reported as errors.
+package gengo
+
+import (
+	"bytes"
+	"fmt"
+	goformat "go/format"
+	"go/printer"
+	gotoken "go/token"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/goast"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+	"neugram.io/ng/typecheck"
+)
+
+// Config configures the generated source.
+type Config struct {
+	// Package is the name of the generated package. If empty, it
+	// is the name from the package clause of the program, or main.
+	Package string
+
+	// LineFile, if not empty, is the name by which the Go compiler
+	// finds the program from the generated file. Each declaration
+	// and statement is then preceded by a //line directive giving
+	// its position in the program, so compile errors and panics
+	// refer to the Neugram source.
+	LineFile string
+}
+
+// RuntimePath is the import path of the runtime support package.
+const RuntimePath = "neugram.io/ng/gengo/ngrt"
+
+// GenGo returns the Go source of the Neugram program in filename.
+func GenGo(filename string, cfg Config) ([]byte, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Translate(filename, src, cfg)
+}
+
+// Translate returns the Go source of the Neugram program src, read
+// from filename.
+func Translate(filename string, src []byte, cfg Config) ([]byte, error) {
+	c := typecheck.New("")
+	f, err := parser.ParseFile(c.Fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	unnamed := make(map[*stmt.Import]bool)
+	for _, s := range f.Stmts {
+		switch s := s.(type) {
+		case *stmt.Import:
+			unnamed[s] = s.Name == ""
+		case *stmt.ImportSet:
+			for _, imp := range s.Imports {
+				unnamed[imp] = imp.Name == ""
+			}
+		}
+		c.Add(s)
+		if len(c.Errs) > 0 {
+			return nil, c.Errs[0]
+		}
+	}
+	if cfg.Package != "" {
+		f.Package = cfg.Package
+	}
+	if f.Package == "" {
+		f.Package = "main"
+	}
+
+	l := &lowerer{c: c, fset: c.Fset, unnamed: unnamed, imported: make(map[string]bool)}
+	if err := l.file(f); err != nil {
+		return nil, err
+	}
+	gof, err := goast.File(f)
+	if err != nil {
+		return nil, fmt.Errorf("gengo: %s: %v", filename, err)
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by gengo from %s; DO NOT EDIT.\n\n", filepath.Base(filename))
+	fmt.Fprintf(buf, "package %s\n", gof.Name.Name)
+	// The converted declarations have no positions, so they are
+	// printed one at a time to separate them by blank lines.
+	for _, d := range gof.Decls {
+		buf.WriteString("\n")
+		if err := printer.Fprint(buf, gotoken.NewFileSet(), d); err != nil {
+			return nil, fmt.Errorf("gengo: %s: %v", filename, err)
+		}
+		buf.WriteString("\n")
+	}
+	res, err := goformat.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("gengo: %s: bad generated source: %v\n%s", filename, err, buf.Bytes())
+	}
+	if cfg.LineFile != "" {
+		res, err = lineDirectives(res, f, c.Fset, cfg.LineFile)
+		if err != nil {
+			return nil, fmt.Errorf("gengo: %s: %v", filename, err)
+		}
+	}
+	return res, nil
+}
+
+// file lowers the statements of f, and declares the variables of
+// its top level as package variables.
+func (l *lowerer) file(f *syntax.File) (err error) {
+	defer catch(&err)
+
+	var stmts []stmt.Stmt
+	for _, s := range f.Stmts {
+		stmts = append(stmts, l.stmt(s))
+	}
+
+	// Hoist the top-level variables. Declarations before the
+	// first statement of main are already package variables.
+	imports := &stmt.ImportSet{}
+	vars := make(map[string]*stmt.Var)
+	var decls []*stmt.Var
+	inMain := false
+	f.Stmts = nil
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *stmt.Import:
+			l.addImport(imports, s)
+			continue
+		case *stmt.ImportSet:
+			for _, imp := range s.Imports {
+				l.addImport(imports, imp)
+			}
+			continue
+		case *stmt.Const, *stmt.ConstSet, *stmt.TypeDecl, *stmt.MethodikDecl:
+		case *stmt.Var:
+			if f.Package != "main" || !inMain && l.packageVar(s, vars) {
+				break
+			}
+			f.Stmts = append(f.Stmts, l.hoistVar(s, vars, &decls)...)
+			continue
+		case *stmt.VarSet:
+			if f.Package != "main" {
+				break
+			}
+			if !inMain && !redeclares(s.Vars, vars) {
+				for _, v := range s.Vars {
+					l.packageVar(v, vars)
+				}
+				break
+			}
+			for _, v := range s.Vars {
+				f.Stmts = append(f.Stmts, l.hoistVar(v, vars, &decls)...)
+			}
+			continue
+		case *stmt.Assign:
+			if !s.Decl {
+				inMain = true
+				break
+			}
+			if f.Package != "main" {
+				// A package has no main, so the variables
+				// are initialized where they are declared.
+				v := &stmt.Var{Span: s.Span, Values: s.Right}
+				for _, lhs := range s.Left {
+					v.NameList = append(v.NameList, lhs.(*expr.Ident).Name)
+				}
+				f.Stmts = append(f.Stmts, v)
+				continue
+			}
+			for _, lhs := range s.Left {
+				l.hoist(lhs.(*expr.Ident), vars, &decls)
+			}
+			s.Decl = false
+			inMain = true
+		case *stmt.Simple:
+			if fn, isFunc := s.Expr.(*expr.FuncLiteral); !isFunc || fn.Name == "" {
+				inMain = true
+			}
+		default:
+			inMain = true
+		}
+		f.Stmts = append(f.Stmts, s)
+	}
+	switch len(decls) {
+	case 0:
+	case 1:
+		f.Stmts = append([]stmt.Stmt{decls[0]}, f.Stmts...)
+	default:
+		f.Stmts = append([]stmt.Stmt{&stmt.VarSet{Vars: decls}}, f.Stmts...)
+	}
+
+	for i, s := range f.Stmts {
+		f.Stmts[i] = l.goTypes(s).(stmt.Stmt)
+	}
+	if l.runtime {
+		imports.Imports = append(imports.Imports, &stmt.Import{Path: RuntimePath})
+	}
+	switch len(imports.Imports) {
+	case 0:
+	case 1:
+		f.Stmts = append([]stmt.Stmt{imports.Imports[0]}, f.Stmts...)
+	default:
+		f.Stmts = append([]stmt.Stmt{imports}, f.Stmts...)
+	}
+	return nil
+}
+
+// addImport adds imp to the imports of the file. The type checker
+// names every import, and the names the program left out are left
+// out again where Go gives the package the same name.
+func (l *lowerer) addImport(imports *stmt.ImportSet, imp *stmt.Import) {
+	l.imported[imp.Name] = true
+	if l.unnamed[imp] && imp.Name == path.Base(imp.Path) {
+		imp.Name = ""
+	}
+	imports.Imports = append(imports.Imports, imp)
+}
+
+// hoistVar declares the variables of v as package variables, and
+// returns the statements that set them, as v does.
+func (l *lowerer) hoistVar(v *stmt.Var, vars map[string]*stmt.Var, decls *[]*stmt.Var) []stmt.Stmt {
+	var res []stmt.Stmt
+	for i, name := range v.NameList {
+		if name == "_" {
+			continue
+		}
+		t := v.Type
+		if t == nil {
+			t = l.valueType(v, i)
+		}
+		if l.declare(v, name, t, vars, decls) && len(v.Values) == 0 {
+			// Redeclared, so reset to the zero value.
+			res = append(res, &stmt.Assign{
+				Span: v.Span,
+				Left: []expr.Expr{&expr.Ident{Name: name}},
+				Right: []expr.Expr{&expr.Unary{
+					Op:   token.Mul,
+					Expr: call(&expr.Ident{Name: "new"}, &expr.Type{Type: t}),
+				}},
+			})
+		}
+	}
+	if len(v.Values) == 0 {
+		return res
+	}
+	assign := &stmt.Assign{Span: v.Span, Right: v.Values}
+	for _, name := range v.NameList {
+		assign.Left = append(assign.Left, &expr.Ident{Name: name})
+	}
+	return append(res, assign)
+}
+
+// packageVar records the variables of v, declared before the first
+// statement of main, as package variables. It reports false if one
+// is already declared, as v then redeclares it in main.
+func (l *lowerer) packageVar(v *stmt.Var, vars map[string]*stmt.Var) bool {
+	if redeclares([]*stmt.Var{v}, vars) {
+		return false
+	}
+	for i, name := range v.NameList {
+		l.checkName(v, name)
+		t := v.Type
+		if t == nil {
+			t = l.valueType(v, i)
+		}
+		vars[name] = &stmt.Var{NameList: []string{name}, Type: t}
+	}
+	return true
+}
+
+// checkName reports an error if the package variable name is also
+// the name of an import, which Neugram allows as a variable in the
+// top-level scope shadows the import.
+func (l *lowerer) checkName(n node, name string) {
+	if l.imported[name] {
+		l.errorf(n, "variable %s has the name of an import", name)
+	}
+}
+
+// redeclares reports whether vs declare a variable in vars.
+func redeclares(vs []*stmt.Var, vars map[string]*stmt.Var) bool {
+	for _, v := range vs {
+		for _, name := range v.NameList {
+			if vars[name] != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// valueType returns the type of the i'th variable of v, which has
+// no type of its own.
+func (l *lowerer) valueType(v *stmt.Var, i int) tipe.Type {
+	if len(v.Values) == len(v.NameList) {
+		return defaultType(l.typeOf(v.Values[i]))
+	}
+	if tuple, isTuple := l.typeOf(v.Values[0]).(*tipe.Tuple); isTuple && i < len(tuple.Elems) {
+		return tuple.Elems[i]
+	}
+	l.errorf(v, "no type for %s", v.NameList[i])
+	panic("unreachable")
+}
+
+// hoist declares the variable defined by lhs as a package variable.
+func (l *lowerer) hoist(lhs *expr.Ident, vars map[string]*stmt.Var, decls *[]*stmt.Var) {
+	if lhs.Name == "_" {
+		return
+	}
+	obj := l.c.Defs[lhs]
+	if obj == nil {
+		l.errorf(lhs, "no type for %s", lhs.Name)
+	}
+	l.declare(lhs, lhs.Name, defaultType(obj.Type), vars, decls)
+}
+
+// declare declares the package variable name of type t, and
+// reports whether it was already declared. A package variable has
+// one type, so the program may only redeclare it with the same type.
+func (l *lowerer) declare(n node, name string, t tipe.Type, vars map[string]*stmt.Var, decls *[]*stmt.Var) bool {
+	l.checkName(n, name)
+	if prev := vars[name]; prev != nil {
+		if !tipe.Equal(prev.Type, t) {
+			l.errorf(n, "%s redeclared as %s, was %s", name, format.Type(t), format.Type(prev.Type))
+		}
+		return true
+	}
+	v := &stmt.Var{NameList: []string{name}, Type: t}
+	vars[name] = v
+	*decls = append(*decls, v)
+	return false
+}
+
+// bailout is panicked by errorf and recovered by catch.
+type bailout struct {
+	err error
+}
+
+func catch(err *error) {
+	if r := recover(); r != nil {
+		b, ok := r.(bailout)
+		if !ok {
+			panic(r)
+		}
+		*err = b.err
+	}
+}
+
+// node is a syntax node with a position.
+type node interface {
+	Pos() token.Pos
+}
+
+func (l *lowerer) errorf(n node, msgf string, args ...interface{}) {
+	msg := fmt.Sprintf(msgf, args...)
+	if n != nil && n.Pos().IsValid() {
+		msg = l.fset.Position(n.Pos()).String() + ": " + msg
+	}
+	panic(bailout{fmt.Errorf("gengo: %s", msg)})
+}
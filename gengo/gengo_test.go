@@ -0,0 +1,197 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gengo
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// programs are run by the evaluator tests, and translate to Go.
+var programs = []string{
+	"../eval/testdata/closure1.ng",
+	"../eval/testdata/complex.ng",
+	"../eval/testdata/error5.ng",
+	"../eval/testdata/func.ng",
+	"../eval/testdata/import2.ng",
+	"../eval/testdata/import7.ng",
+	"../eval/testdata/method2.ng",
+	"../eval/testdata/pow1.ng",
+	"../eval/testdata/type1.ng",
+	"testdata/elide1.ng",
+	"testdata/table1.ng",
+}
+
+func TestPrograms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "gengo-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range programs {
+		src, err := GenGo(file, Config{})
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		gofile := filepath.Join(dir, strings.TrimSuffix(filepath.Base(file), ".ng")+".go")
+		if err := ioutil.WriteFile(gofile, src, 0666); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(gocmd, "run", gofile).CombinedOutput()
+		if err != nil || !strings.Contains(string(out), "OK") {
+			t.Errorf("%s: %v\n%s\n%s", file, err, out, src)
+		}
+	}
+}
+
+var translateTests = []struct {
+	src  string
+	want []string
+}{
+	{
+		src:  "x := 3\nprint(x ** 2, 2 ** 10)\n",
+		want: []string{"var x int", "x = 3", "ngrt.Println(int(ngrt.PowInt(int64(x), 2)), 1024)"},
+	},
+	{
+		src:  "package p\nvar b uint8 = 2\nconst c = 1.5 ** 2\n",
+		want: []string{"package p", "var b uint8 = 2", "const c = 2.25"},
+	},
+	{
+		src:  "import \"os\"\nf := os.Open(\"x\")\nf.Close()\n",
+		want: []string{"import \"os\"", "var f *os.File", "v, err := os.Open(\"x\")", "panic(err)", "return v"},
+	},
+	{
+		src:  "t := [|]float64{{|\"a\"|}, {1}}\n",
+		want: []string{"var t *ngrt.Table", `ngrt.NewTable([]string{"a"}, [][]interface{}{[]interface{}{float64(1)}})`},
+	},
+	{
+		src:  "type r interface { Read() error }\nvar x = 1\nprint(x)\nvar x int\n",
+		want: []string{"Read() error", "var x = 1", "x = *new(int)"},
+	},
+}
+
+func TestTranslate(t *testing.T) {
+	for _, test := range translateTests {
+		src, err := Translate("t.ng", []byte(test.src), Config{})
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(src), want) {
+				t.Errorf("%q: output does not contain %q:\n%s", test.src, want, src)
+			}
+		}
+	}
+}
+
+var errorTests = []struct {
+	src string
+	err string
+}{
+	{"s := $$ echo hi $$\n", "shell expression"},
+	{"print(env[\"HOME\"])\n", "env has no Go equivalent"},
+	{"x := 1\nprint(x)\nx := \"a\"\n", "x redeclared"},
+	{"import \"fmt\"\nfmt := 1\n", "has the name of an import"},
+	{"package p\nprint(1)\n", "outside a function"},
+}
+
+func TestTranslateError(t *testing.T) {
+	for _, test := range errorTests {
+		_, err := Translate("t.ng", []byte(test.src), Config{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %q", test.src, err, test.err)
+		}
+	}
+}
+
+func TestPackage(t *testing.T) {
+	src, err := Translate("t.ng", []byte("func F() int { return 1 }\n"), Config{Package: "gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "package gen\n") {
+		t.Errorf("package not named gen:\n%s", src)
+	}
+}
+
+const panicSrc = `func check(n int) {
+	if n > 1 {
+		panic("too big")
+	}
+}
+
+for i := 0; i < 3; i++ {
+	check(i)
+}
+`
+
+func TestLineDirectives(t *testing.T) {
+	src, err := Translate("p.ng", []byte(panicSrc), Config{LineFile: "p.ng"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"//line p.ng:1\nfunc check", "//line p.ng:3\n\t\tpanic", "//line p.ng:8\n\t\tcheck(i)"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("output does not contain %q:\n%s", want, src)
+		}
+	}
+
+	if testing.Short() {
+		return
+	}
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "gengo-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gofile := filepath.Join(dir, "p_ng.go")
+	if err := ioutil.WriteFile(gofile, src, 0666); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(gocmd, "run", gofile).CombinedOutput()
+	if err == nil {
+		t.Fatalf("program did not panic:\n%s", out)
+	}
+	for _, want := range []string{"p.ng:3", "p.ng:8"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("panic does not refer to %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	src := "import \"strings\"\nimport \"fmt\"\nx, y := 1, \"a\"\nfmt.Println(strings.Repeat(y, x), 2 ** x)\n"
+	want, err := Translate("d.ng", []byte(src), Config{LineFile: "d.ng"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := Translate("d.ng", []byte(src), Config{LineFile: "d.ng"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("translation %d differs:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gengo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/token"
+)
+
+// lineDirectives returns the Go source src of the lowered file f
+// with a //line directive before each declaration and statement,
+// giving its line in the program file name.
+//
+// The Go declarations are matched to the statements of f as
+// goast.File arranges them. Within a declaration, the statements of
+// each block are matched in order, and are left without directives
+// if the two do not have as many.
+func lineDirectives(src []byte, f *syntax.File, fset *token.FileSet, name string) ([]byte, error) {
+	gofset := gotoken.NewFileSet()
+	gof, err := goparser.ParseFile(gofset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	var decls []ast.Decl
+	for _, d := range gof.Decls {
+		if d, isGen := d.(*ast.GenDecl); isGen && d.Tok == gotoken.IMPORT {
+			continue
+		}
+		decls = append(decls, d)
+	}
+
+	var known []placed     // Go nodes with a program position
+	var unknown []ast.Node // statements the lowerer made
+	pair := func(g ast.Node, n walk.Node) {
+		if g == nil {
+			return
+		}
+		if n, ok := n.(node); ok && n.Pos().IsValid() {
+			known = append(known, placed{g, fset.Position(n.Pos()).Line})
+		}
+		gs, ns := goStmts(g), ngStmts(n)
+		if len(gs) != len(ns) {
+			return
+		}
+		for i, s := range ns {
+			if s.Pos().IsValid() {
+				known = append(known, placed{gs[i], fset.Position(s.Pos()).Line})
+			} else {
+				unknown = append(unknown, gs[i])
+			}
+		}
+	}
+	next := func() ast.Decl {
+		if len(decls) == 0 {
+			return nil
+		}
+		d := decls[0]
+		decls = decls[1:]
+		return d
+	}
+	var main []stmt.Stmt
+	for _, s := range f.Stmts {
+		switch s := s.(type) {
+		case *stmt.Import, *stmt.ImportSet:
+		case *stmt.Const, *stmt.ConstSet, *stmt.TypeDecl:
+			pair(next(), s)
+		case *stmt.Var, *stmt.VarSet:
+			if len(main) > 0 {
+				main = append(main, s)
+				continue
+			}
+			pair(next(), s)
+		case *stmt.MethodikDecl:
+			pair(next(), s)
+			for _, m := range s.Methods {
+				pair(next(), m)
+			}
+		case *stmt.Simple:
+			if fn, isFunc := s.Expr.(*expr.FuncLiteral); isFunc && fn.Name != "" {
+				pair(next(), s)
+				continue
+			}
+			main = append(main, s)
+		default:
+			main = append(main, s)
+		}
+	}
+	if len(main) > 0 {
+		if fn, isFunc := next().(*ast.FuncDecl); isFunc {
+			pair(fn.Body, &stmt.Block{Stmts: main})
+		}
+	}
+
+	lines := make(map[int]int) // program line, by Go line
+	for _, p := range known {
+		lines[gofset.Position(p.Pos()).Line] = p.line
+	}
+	// A statement made by the lowerer has the line of the innermost
+	// statement around it.
+	for _, g := range unknown {
+		var in *placed
+		for i, p := range known {
+			if p.Pos() <= g.Pos() && g.End() <= p.End() && (in == nil || p.Pos() >= in.Pos()) {
+				in = &known[i]
+			}
+		}
+		if in != nil {
+			lines[gofset.Position(g.Pos()).Line] = in.line
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for i, line := range bytes.SplitAfter(src, []byte("\n")) {
+		if n, ok := lines[i+1]; ok {
+			fmt.Fprintf(buf, "//line %s:%d\n", name, n)
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes(), nil
+}
+
+// placed is a Go node and the line of the program it came from.
+type placed struct {
+	ast.Node
+	line int
+}
+
+// goStmts returns the statements of the blocks and case clauses in
+// n. The statements of a block precede those of the blocks in them.
+func goStmts(n ast.Node) []ast.Stmt {
+	var res []ast.Stmt
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			for _, s := range n.List {
+				switch s.(type) {
+				case *ast.CaseClause, *ast.CommClause:
+				default:
+					res = append(res, s)
+				}
+			}
+		case *ast.CaseClause:
+			res = append(res, n.Body...)
+		case *ast.CommClause:
+			res = append(res, n.Body...)
+		}
+		return true
+	})
+	return res
+}
+
+// ngStmts returns the statements of the blocks in n, in the order
+// of goStmts.
+func ngStmts(n walk.Node) []stmt.Stmt {
+	var res []stmt.Stmt
+	walk.Inspect(n, func(n walk.Node) bool {
+		if b, isBlock := n.(*stmt.Block); isBlock {
+			res = append(res, b.Stmts...)
+		}
+		return true
+	})
+	return res
+}
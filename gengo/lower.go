@@ -0,0 +1,367 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gengo
+
+import (
+	"fmt"
+	"go/constant"
+	"math/big"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/format"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+	"neugram.io/ng/typecheck"
+)
+
+// lowerer rewrites a type checked Neugram syntax tree into the
+// subset of Neugram that is also Go.
+type lowerer struct {
+	c       *typecheck.Checker
+	fset    *token.FileSet
+	runtime bool // the runtime support package is used
+
+	unnamed  map[*stmt.Import]bool // imports the program did not name
+	imported map[string]bool       // names of the imports
+
+	// types holds the types of the expressions made by the
+	// lowerer, which the type checker has not seen.
+	types map[expr.Expr]tipe.Type
+}
+
+// builtins maps the builtins that Go lacks to their implementation
+// in the runtime support package.
+var builtins = map[string]string{
+	"print":   "Println",
+	"println": "Println",
+	"printf":  "Printf",
+	"errorf":  "Errorf",
+	"cols":    "Cols",
+}
+
+func (l *lowerer) stmt(s stmt.Stmt) stmt.Stmt {
+	return walk.Apply(s, nil, l.post).(stmt.Stmt)
+}
+
+// post lowers the node of c, whose children are lowered.
+func (l *lowerer) post(c *walk.Cursor) bool {
+	switch n := c.Node().(type) {
+	case *stmt.Import:
+		if strings.HasSuffix(n.Path, ".ng") {
+			l.errorf(n, "import of Neugram package %q has no Go equivalent", n.Path)
+		}
+	case *stmt.TypeDecl:
+		// The type checker replaces the type of the declaration
+		// with the type it declares.
+		switch t := n.Type.(type) {
+		case *tipe.Named:
+			if t.Name == n.Name {
+				n.Type = t.Type
+			}
+		case *tipe.Alias:
+			if t.Name == n.Name {
+				n.Type = t.Type
+			}
+		}
+	case *expr.Shell:
+		l.errorf(n, "shell expression has no Go equivalent")
+	case *expr.Ident:
+		obj := l.c.Defs[n]
+		if obj == nil || obj != typecheck.Universe.Objs[n.Name] {
+			break
+		}
+		if name, isBuiltin := builtins[n.Name]; isBuiltin {
+			l.replace(c, l.rt(name))
+		} else if n.Name == "env" || n.Name == "alias" {
+			l.errorf(n, "%s has no Go equivalent", n.Name)
+		}
+	case *expr.Binary:
+		if n.Op == token.Pow {
+			l.pow(c, n)
+		}
+	case *expr.Call:
+		if l.isTableLen(n) {
+			l.replace(c, call(l.rt("Len"), n.Args[0]))
+			break
+		}
+		if n.ElideError {
+			l.elide(c, n)
+		}
+	case *expr.TableLiteral:
+		l.table(c, n)
+	}
+	return true
+}
+
+// replace replaces the node of c with e, which has its type.
+func (l *lowerer) replace(c *walk.Cursor, e expr.Expr) {
+	if l.types == nil {
+		l.types = make(map[expr.Expr]tipe.Type)
+	}
+	l.types[e] = l.typeOf(c.Node().(expr.Expr))
+	c.Replace(e)
+}
+
+func (l *lowerer) typeOf(e expr.Expr) tipe.Type {
+	if t, ok := l.types[e]; ok {
+		return t
+	}
+	return l.c.Types[e]
+}
+
+// isTableLen reports whether e is a call of the builtin len on a
+// table, which Go's len cannot take.
+func (l *lowerer) isTableLen(e *expr.Call) bool {
+	fn, isIdent := e.Func.(*expr.Ident)
+	if !isIdent || fn.Name != "len" || len(e.Args) != 1 {
+		return false
+	}
+	if obj := l.c.Defs[fn]; obj == nil || obj != typecheck.Universe.Objs["len"] {
+		return false
+	}
+	_, isTable := tipe.Underlying(l.typeOf(e.Args[0])).(*tipe.Table)
+	return isTable
+}
+
+// rt returns the member name of the runtime support package.
+func (l *lowerer) rt(name string) expr.Expr {
+	l.runtime = true
+	return &expr.Selector{Left: &expr.Ident{Name: "ngrt"}, Right: &expr.Ident{Name: name}}
+}
+
+// pow lowers x ** y to its value if it is constant, and otherwise
+// to a call of the runtime Pow function for its type.
+func (l *lowerer) pow(c *walk.Cursor, e *expr.Binary) {
+	t := l.typeOf(e)
+	if v := l.c.Values[e]; v != nil {
+		l.replace(c, l.constant(e, v, t))
+		return
+	}
+	var fn string
+	var arg tipe.Type
+	switch tipe.Underlying(t) {
+	case tipe.Int, tipe.Int8, tipe.Int16, tipe.Int32, tipe.Int64:
+		fn, arg = "PowInt", tipe.Int64
+	case tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64, tipe.Uintptr:
+		fn, arg = "PowUint", tipe.Uint64
+	case tipe.Float32, tipe.Float64:
+		fn, arg = "PowFloat", tipe.Float64
+	case tipe.Complex64, tipe.Complex128:
+		fn, arg = "PowComplex", tipe.Complex128
+	default:
+		l.errorf(e, "** of type %s has no Go equivalent", format.Type(t))
+	}
+	args := []expr.Expr{e.Left, e.Right}
+	for i, x := range args {
+		if l.c.Values[x] == nil {
+			args[i] = convert(arg, x, l.typeOf(x))
+		}
+	}
+	l.replace(c, convert(t, call(l.rt(fn), args...), arg))
+}
+
+// constant returns a literal of the constant v of type t.
+func (l *lowerer) constant(n node, v constant.Value, t tipe.Type) expr.Expr {
+	var lit expr.Expr
+	switch v.Kind() {
+	case constant.Bool:
+		lit = &expr.Ident{Name: v.String()}
+	case constant.String:
+		lit = &expr.BasicLiteral{Value: constant.StringVal(v)}
+	case constant.Int:
+		i, _ := new(big.Int).SetString(v.ExactString(), 10)
+		lit = &expr.BasicLiteral{Value: i}
+	case constant.Float:
+		f, _ := constant.Float64Val(v)
+		lit = &expr.BasicLiteral{Value: big.NewFloat(f)}
+	case constant.Complex:
+		re, _ := constant.Float64Val(constant.Real(v))
+		im, _ := constant.Float64Val(constant.Imag(v))
+		lit = &expr.Unary{Op: token.LeftParen, Expr: &expr.Binary{
+			Op:    token.Add,
+			Left:  &expr.BasicLiteral{Value: big.NewFloat(re)},
+			Right: &expr.BasicLiteral{Value: expr.Imaginary{Imag: big.NewFloat(im)}},
+		}}
+	default:
+		l.errorf(n, "constant %s has no Go equivalent", v)
+	}
+	if _, isBasic := tipe.Underlying(t).(tipe.Basic); !isBasic || isUntyped(t) {
+		// Untyped, or in an interface.
+		return lit
+	}
+	return convert(t, lit, nil)
+}
+
+// elide lowers a call whose final error result is elided to a call
+// of a function that panics if the error is not nil.
+//
+// The type checker elides the error of a call that is a statement,
+// or the only value assigned to one fewer variables than it has
+// results, and records the type of all its results. Elsewhere, it
+// records the type of the results that remain.
+func (l *lowerer) elide(c *walk.Cursor, e *expr.Call) {
+	t := l.typeOf(e)
+	results := []tipe.Type{t}
+	if tuple, isTuple := t.(*tipe.Tuple); isTuple {
+		results = tuple.Elems
+	}
+	n := len(results) // values of e, not counting the error
+	switch p := c.Parent().(type) {
+	case *stmt.Simple:
+		n--
+		results = nil
+	case *stmt.Assign:
+		if len(p.Right) == 1 && len(p.Left) == len(results)-1 {
+			n--
+			results = results[:n]
+		}
+	}
+
+	var vals, lhs []expr.Expr
+	for i := 0; i < n; i++ {
+		if results == nil {
+			lhs = append(lhs, &expr.Ident{Name: "_"})
+			continue
+		}
+		v := &expr.Ident{Name: "v"}
+		if n > 1 {
+			v.Name = fmt.Sprintf("v%d", i)
+		}
+		lhs = append(lhs, v)
+		vals = append(vals, v)
+	}
+	errv := &expr.Ident{Name: "err"}
+	body := []stmt.Stmt{
+		&stmt.Assign{Decl: true, Left: append(lhs, errv), Right: []expr.Expr{e}},
+		&stmt.If{
+			Cond: &expr.Binary{Op: token.NotEqual, Left: errv, Right: &expr.Ident{Name: "nil"}},
+			Body: &stmt.Block{Stmts: []stmt.Stmt{
+				&stmt.Simple{Expr: call(&expr.Ident{Name: "panic"}, errv)},
+			}},
+		},
+	}
+	if len(vals) > 0 {
+		body = append(body, &stmt.Return{Exprs: vals})
+	}
+	e.ElideError = false
+	fn := &expr.FuncLiteral{
+		Type: &tipe.Func{Params: &tipe.Tuple{}, Results: &tipe.Tuple{Elems: results}},
+		Body: &stmt.Block{Stmts: body},
+	}
+	l.replace(c, call(fn))
+}
+
+// table lowers a table literal to a call of ngrt.NewTable.
+func (l *lowerer) table(c *walk.Cursor, e *expr.TableLiteral) {
+	var names expr.Expr = &expr.Ident{Name: "nil"}
+	if len(e.ColNames) > 0 {
+		names = &expr.SliceLiteral{Type: &tipe.Slice{Elem: tipe.String}, Elems: e.ColNames}
+	}
+	rowType := &tipe.Slice{Elem: &tipe.Interface{}}
+	rows := &expr.SliceLiteral{Type: &tipe.Slice{Elem: rowType}}
+	for _, row := range e.Rows {
+		cells := &expr.SliceLiteral{Type: rowType}
+		for _, cell := range row {
+			cells.Elems = append(cells.Elems, l.cell(e.Type.Type, cell))
+		}
+		rows.Elems = append(rows.Elems, cells)
+	}
+	l.replace(c, call(l.rt("NewTable"), names, rows))
+}
+
+// cell converts the value of a cell to the type t of the table's
+// values, so it is held in an interface{} as that type.
+func (l *lowerer) cell(t tipe.Type, e expr.Expr) expr.Expr {
+	if _, isIface := tipe.Underlying(t).(*tipe.Interface); isIface {
+		return e
+	}
+	if v := l.c.Values[e]; v != nil {
+		if tipe.Equal(constDefault[v.Kind()], t) {
+			return e
+		}
+		return convert(t, e, nil)
+	}
+	return convert(t, e, l.typeOf(e))
+}
+
+// constDefault is the type of an untyped constant held in an
+// interface{}, by kind.
+var constDefault = map[constant.Kind]tipe.Type{
+	constant.Bool:    tipe.Bool,
+	constant.String:  tipe.String,
+	constant.Int:     tipe.Int,
+	constant.Float:   tipe.Float64,
+	constant.Complex: tipe.Complex128,
+}
+
+// goTypes replaces the types in n that Go spells differently: a
+// table type is *ngrt.Table, and the type checker's error interface
+// is error.
+func (l *lowerer) goTypes(n walk.Node) walk.Node {
+	return walk.Apply(n, func(c *walk.Cursor) bool {
+		switch t := c.Node().(type) {
+		case *tipe.Table:
+			c.Replace(&tipe.Pointer{Elem: &tipe.Unresolved{Package: "ngrt", Name: "Table"}})
+			l.runtime = true
+			return false
+		case *tipe.Interface:
+			if typecheck.IsError(t) {
+				c.Replace(&tipe.Unresolved{Name: "error"})
+				return false
+			}
+		}
+		return true
+	}, nil)
+}
+
+// convert returns e, of type from, converted to t. If from is t,
+// it returns e.
+func convert(t tipe.Type, e expr.Expr, from tipe.Type) expr.Expr {
+	if from != nil && tipe.Equal(from, t) {
+		return e
+	}
+	var fn expr.Expr = &expr.Type{Type: t}
+	switch t.(type) {
+	case *tipe.Pointer, *tipe.Func, *tipe.Chan:
+		fn = &expr.Unary{Op: token.LeftParen, Expr: fn}
+	}
+	return call(fn, e)
+}
+
+func call(fn expr.Expr, args ...expr.Expr) *expr.Call {
+	return &expr.Call{Func: fn, Args: args}
+}
+
+func isUntyped(t tipe.Type) bool {
+	switch t {
+	case tipe.UntypedNil, tipe.UntypedString, tipe.UntypedBool,
+		tipe.UntypedInteger, tipe.UntypedFloat, tipe.UntypedRune, tipe.UntypedComplex:
+		return true
+	}
+	return false
+}
+
+// defaultType is the type of a variable declared with an untyped
+// value of type t.
+func defaultType(t tipe.Type) tipe.Type {
+	switch t {
+	case tipe.UntypedBool:
+		return tipe.Bool
+	case tipe.UntypedString:
+		return tipe.String
+	case tipe.UntypedRune:
+		return tipe.Rune
+	case tipe.UntypedInteger:
+		return tipe.Int
+	case tipe.UntypedFloat:
+		return tipe.Float64
+	case tipe.UntypedComplex:
+		return tipe.Complex128
+	}
+	return t
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ngrt supports Go programs translated from Neugram by the
+// gengo package. It implements the Neugram builtins and operators
+// that Go does not have.
+package ngrt // import "neugram.io/ng/gengo/ngrt"
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// Println implements the builtins print and println, which both
+// separate their operands by spaces and end with a newline.
+func Println(a ...interface{}) {
+	fmt.Println(a...)
+}
+
+// Printf implements the builtin printf.
+func Printf(format string, a ...interface{}) {
+	fmt.Printf(format, a...)
+}
+
+// Errorf implements the builtin errorf.
+func Errorf(format string, a ...interface{}) error {
+	return fmt.Errorf(format, a...)
+}
+
+// PowInt implements x ** y for signed integers. It wraps on
+// overflow, like repeated multiplication. A negative y panics.
+func PowInt(x, y int64) int64 {
+	if y < 0 {
+		panic(fmt.Sprintf("negative exponent %d in integer power", y))
+	}
+	return int64(PowUint(uint64(x), uint64(y)))
+}
+
+// PowUint implements x ** y for unsigned integers.
+func PowUint(x, y uint64) uint64 {
+	res := uint64(1)
+	for ; y > 0; y >>= 1 {
+		if y&1 == 1 {
+			res *= x
+		}
+		x *= x
+	}
+	return res
+}
+
+// PowFloat implements x ** y for floats.
+func PowFloat(x, y float64) float64 {
+	return math.Pow(x, y)
+}
+
+// PowComplex implements x ** y for complex numbers. It is exact
+// when y is a small whole number.
+func PowComplex(x, y complex128) complex128 {
+	if n := real(y); imag(y) == 0 && n == math.Trunc(n) && n >= 0 && n <= 64 {
+		z := complex128(1)
+		for ; n > 0; n-- {
+			z *= x
+		}
+		return z
+	}
+	return cmplx.Pow(x, y)
+}
+
+// A Table is a Neugram table, [|]T. Its values are checked to be of
+// type T by the Neugram type checker, and held as interface{}.
+type Table struct {
+	ColNames []string // nil if the columns have no names
+	Rows     [][]interface{}
+}
+
+// NewTable returns a table with the columns colNames and rows.
+func NewTable(colNames []string, rows [][]interface{}) *Table {
+	return &Table{ColNames: colNames, Rows: rows}
+}
+
+// Len implements the builtin len of a table, its number of rows.
+func Len(t *Table) int {
+	if t == nil {
+		return 0
+	}
+	return len(t.Rows)
+}
+
+// Cols implements the builtin cols, the number of columns of t.
+func Cols(t *Table) int {
+	if t == nil {
+		return 0
+	}
+	if t.ColNames != nil {
+		return len(t.ColNames)
+	}
+	if len(t.Rows) > 0 {
+		return len(t.Rows[0])
+	}
+	return 0
+}
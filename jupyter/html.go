@@ -0,0 +1,119 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jupyter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+
+	"neugram.io/ng/table"
+)
+
+// maxRows bounds the rows of an HTML table. The rest are summarized.
+const maxRows = 500
+
+// htmlTable returns v as an HTML table, if it is a table or a list
+// of rows: a slice or array of structs, whose fields are the
+// columns, or of slices or arrays, whose elements are the cells.
+func htmlTable(v interface{}) (string, bool) {
+	if t, isTable := v.(*table.Table); isTable {
+		return htmlTableOf(t), true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", false
+	}
+	elem := rv.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	var cols []int // fields of a struct row
+	switch elem.Kind() {
+	case reflect.Struct:
+		for i := 0; i < elem.NumField(); i++ {
+			// Neugram methodik structs embed a field for each
+			// method. They are not data.
+			if f := elem.Field(i); f.PkgPath == "" && !f.Anonymous {
+				cols = append(cols, i)
+			}
+		}
+		if len(cols) == 0 {
+			return "", false
+		}
+	case reflect.Slice, reflect.Array:
+	default:
+		return "", false
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("<table>\n")
+	if cols != nil {
+		buf.WriteString("<tr>")
+		for _, i := range cols {
+			fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(elem.Field(i).Name))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	for r := 0; r < rv.Len() && r < maxRows; r++ {
+		row := rv.Index(r)
+		for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+			row = row.Elem()
+		}
+		buf.WriteString("<tr>")
+		switch {
+		case !row.IsValid():
+		case cols != nil:
+			for _, i := range cols {
+				writeCell(buf, row.Field(i))
+			}
+		default:
+			for i := 0; i < row.Len(); i++ {
+				writeCell(buf, row.Index(i))
+			}
+		}
+		buf.WriteString("</tr>\n")
+	}
+	endTable(buf, rv.Len())
+	return buf.String(), true
+}
+
+// htmlTableOf returns the table t as an HTML table, with a header of
+// the names of its columns if they have names.
+func htmlTableOf(t *table.Table) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("<table>\n")
+	names := t.Cols()
+	if strings.Join(names, "") != "" {
+		buf.WriteString("<tr>")
+		for _, name := range names {
+			fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(name))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	for r := 0; r < t.Len() && r < maxRows; r++ {
+		buf.WriteString("<tr>")
+		for c := 0; c < t.NumCols(); c++ {
+			writeCell(buf, t.Value(r, c))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	endTable(buf, t.Len())
+	return buf.String()
+}
+
+// endTable ends a table of n rows, summarizing those past maxRows.
+func endTable(buf *bytes.Buffer, n int) {
+	buf.WriteString("</table>\n")
+	if n > maxRows {
+		fmt.Fprintf(buf, "<p>%d more rows</p>\n", n-maxRows)
+	}
+}
+
+func writeCell(buf *bytes.Buffer, v reflect.Value) {
+	fmt.Fprintf(buf, "<td>%s</td>", html.EscapeString(fmt.Sprint(v.Interface())))
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jupyter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A client is the frontend of a notebook, as far as the tests need.
+type client struct {
+	t      *testing.T
+	signer signer
+	shell  *conn
+	ctl    *conn
+	iopub  *conn
+	hb     *conn
+}
+
+func dial(t *testing.T, port int, typ string) *conn {
+	c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(30 * time.Second))
+	zc, err := handshake(c, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zc
+}
+
+func newClient(t *testing.T, k *Kernel) *client {
+	c := &client{
+		t:      t,
+		signer: k.signer,
+		shell:  dial(t, k.Info.ShellPort, "DEALER"),
+		ctl:    dial(t, k.Info.ControlPort, "DEALER"),
+		iopub:  dial(t, k.Info.IOPubPort, "SUB"),
+		hb:     dial(t, k.Info.HBPort, "REQ"),
+	}
+	if err := c.iopub.writeMsg([][]byte{{1}}); err != nil { // subscribe to all
+		t.Fatal(err)
+	}
+	// Wait for the kernel to add the subscriber, so it sees all
+	// that is published from now on.
+	for {
+		k.iopub.mu.Lock()
+		n := len(k.iopub.peers)
+		k.iopub.mu.Unlock()
+		if n > 0 {
+			return c
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// send sends a request on zc, and returns its id.
+func (c *client) send(zc *conn, typ string, content interface{}) string {
+	frames, err := c.signer.encode(nil, "test", typ, nil, content)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	m, err := c.signer.decode(frames)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := zc.writeMsg(frames); err != nil {
+		c.t.Fatal(err)
+	}
+	return m.header.MsgID
+}
+
+// recv receives a message on zc.
+func (c *client) recv(zc *conn) (typ string, content map[string]interface{}) {
+	frames, err := zc.readMsg()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	m, err := c.signer.decode(frames)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(m.content, &content); err != nil {
+		c.t.Fatal(err)
+	}
+	return m.header.MsgType, content
+}
+
+// published returns the messages published until the kernel is idle,
+// by type.
+func (c *client) published() map[string]map[string]interface{} {
+	msgs := make(map[string]map[string]interface{})
+	for {
+		typ, content := c.recv(c.iopub)
+		if typ == "status" && content["execution_state"] == "idle" {
+			return msgs
+		}
+		if typ == "stream" && msgs[typ] != nil {
+			msgs[typ]["text"] = msgs[typ]["text"].(string) + content["text"].(string)
+			continue
+		}
+		msgs[typ] = content
+	}
+}
+
+func (c *client) execute(code string) (reply map[string]interface{}, published map[string]map[string]interface{}) {
+	c.send(c.shell, "execute_request", map[string]interface{}{"code": code})
+	typ, reply := c.recv(c.shell)
+	if typ != "execute_reply" {
+		c.t.Fatalf("execute %q: reply is %s", code, typ)
+	}
+	return reply, c.published()
+}
+
+func TestKernel(t *testing.T) {
+	k, err := NewKernel(ConnectionInfo{IP: "127.0.0.1", Key: "secret", SignatureScheme: "hmac-sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	served := make(chan error)
+	go func() { served <- k.Serve() }()
+	c := newClient(t, k)
+
+	c.send(c.shell, "kernel_info_request", map[string]interface{}{})
+	if typ, reply := c.recv(c.shell); typ != "kernel_info_reply" || reply["protocol_version"] != protocolVersion {
+		t.Errorf("kernel_info reply is %s %v", typ, reply)
+	}
+	c.published()
+
+	reply, pub := c.execute("x := 6\nprint(\"hi\")\nx * 7")
+	if reply["status"] != "ok" || reply["execution_count"] != 1.0 {
+		t.Errorf("execute reply = %v, want ok and count 1", reply)
+	}
+	if got := pub["stream"]["text"]; got != "hi\n" {
+		t.Errorf("stream = %q, want hi", got)
+	}
+	if res := pub["execute_result"]; res == nil || res["data"].(map[string]interface{})["text/plain"] != "42" {
+		t.Errorf("execute_result = %v, want 42", res)
+	}
+
+	_, pub = c.execute(`import "display"` + "\n" + `display.PNG([]byte{1, 2})`)
+	if d := pub["display_data"]; d == nil || d["data"].(map[string]interface{})["image/png"] != "AQI=" {
+		t.Errorf("display_data = %v, want image/png AQI=", d)
+	}
+
+	_, pub = c.execute("[][]int{[]int{1, 2}, []int{3, 4}}")
+	html, _ := pub["execute_result"]["data"].(map[string]interface{})["text/html"].(string)
+	if !strings.Contains(html, "<tr><td>3</td><td>4</td></tr>") {
+		t.Errorf("table result has HTML %q", html)
+	}
+
+	_, pub = c.execute(`[|]int{{|"a", "b"|}, {1, 2}}`)
+	html, _ = pub["execute_result"]["data"].(map[string]interface{})["text/html"].(string)
+	if !strings.Contains(html, "<tr><th>a</th><th>b</th></tr>\n<tr><td>1</td><td>2</td></tr>") {
+		t.Errorf("table result has HTML %q", html)
+	}
+
+	reply, pub = c.execute("y")
+	if reply["status"] != "error" || reply["execution_count"] != 5.0 || pub["error"] == nil {
+		t.Errorf("execute of undefined y: reply %v, error %v", reply, pub["error"])
+	}
+
+	for code, want := range map[string]string{
+		"x = 1":        "complete",
+		"func f() {":   "incomplete",
+		"x := := 1":    "invalid",
+		"for {\n}\nx+": "incomplete",
+	} {
+		c.send(c.shell, "is_complete_request", map[string]string{"code": code})
+		if _, reply := c.recv(c.shell); reply["status"] != want {
+			t.Errorf("is_complete %q = %v, want %s", code, reply["status"], want)
+		}
+		c.published()
+	}
+
+	ping := [][]byte{{}, []byte("ping")}
+	if err := c.hb.writeMsg(ping); err != nil {
+		t.Fatal(err)
+	}
+	if pong, err := c.hb.readMsg(); err != nil || len(pong) != 2 || !bytes.Equal(pong[1], ping[1]) {
+		t.Errorf("heartbeat replied %q, %v", pong, err)
+	}
+
+	// Interrupt a cell that does not end.
+	c.send(c.shell, "execute_request", map[string]interface{}{"code": "for {}"})
+	for {
+		if typ, _ := c.recv(c.iopub); typ == "execute_input" {
+			break
+		}
+	}
+	c.send(c.ctl, "interrupt_request", map[string]interface{}{})
+	if typ, _ := c.recv(c.ctl); typ != "interrupt_reply" {
+		t.Errorf("interrupt reply is %s", typ)
+	}
+	if _, reply := c.recv(c.shell); reply["ename"] != "interrupted" {
+		t.Errorf("interrupted execute reply = %v", reply)
+	}
+
+	c.send(c.ctl, "shutdown_request", map[string]bool{"restart": false})
+	if typ, _ := c.recv(c.ctl); typ != "shutdown_reply" {
+		t.Errorf("shutdown reply is %s", typ)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Serve did not return after shutdown")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s := signer{key: []byte("secret")}
+	frames, err := s.encode([][]byte{[]byte("peer")}, "test", "kernel_info_request", nil, map[string]int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.decode(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.ids) != 1 || string(m.ids[0]) != "peer" || m.header.MsgType != "kernel_info_request" {
+		t.Errorf("decoded ids %q, type %s", m.ids, m.header.MsgType)
+	}
+	frames[len(frames)-1] = []byte(`{"x": 1}`)
+	if _, err := s.decode(frames); err == nil {
+		t.Errorf("decode of a changed message succeeded")
+	}
+	if _, err := (signer{key: []byte("other")}).decode(frames); err == nil {
+		t.Errorf("decode with another key succeeded")
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jupyter implements a Jupyter kernel for Neugram, so a
+// notebook can mix Markdown with cells of Neugram.
+//
+// Jupyter starts a kernel with the command line of its kernel spec.
+// The spec in the directory kernelspec runs ng -jupyter, and is
+// installed with
+//
+//	jupyter kernelspec install kernelspec --name neugram
+//
+// Each cell is evaluated by Eval of one Program, so a cell sees the
+// variables and functions declared by the cells run before it. The
+// output of print, println, and printf appears under the cell, and
+// so does the rich output of the package display, such as HTML and
+// images. When the last statement of a cell is an expression, its
+// values are the result of the cell, shown as text and, for a table
+// or a list of rows such as a slice of structs, as an HTML table.
+//
+// The kernel handles the kernel_info, execute, is_complete,
+// comm_info, interrupt, and shutdown requests. Interrupting stops
+// the cell as a canceled context stops EvalContext. Input is not supported, and shell
+// commands write to the standard output of the kernel process, not
+// to the notebook.
+package jupyter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/token"
+)
+
+// ConnectionInfo is the connection file Jupyter gives a kernel. It
+// names the ports of the kernel's sockets and the key that signs
+// messages. A zero port is chosen by the kernel.
+type ConnectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	ControlPort     int    `json:"control_port"`
+	StdinPort       int    `json:"stdin_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	HBPort          int    `json:"hb_port"`
+	Key             string `json:"key"`
+	SignatureScheme string `json:"signature_scheme"`
+}
+
+// Run runs a kernel with the connection file at path until a client
+// shuts it down.
+func Run(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var info ConnectionInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return fmt.Errorf("jupyter: connection file %s: %v", path, err)
+	}
+	k, err := NewKernel(info)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.Serve()
+}
+
+// A Kernel evaluates the cells of a notebook.
+type Kernel struct {
+	// Info is the connection of the kernel, with the ports it
+	// chose for zero ports.
+	Info ConnectionInfo
+
+	shell, control, stdin, iopub, hb *socket
+
+	signer  signer
+	session string
+	prg     *eval.Program
+
+	mu     sync.Mutex
+	parent *message           // the request being executed, for its output
+	cancel context.CancelFunc // interrupts the request being executed
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewKernel binds the sockets of a kernel.
+func NewKernel(info ConnectionInfo) (*Kernel, error) {
+	if info.Transport != "" && info.Transport != "tcp" {
+		return nil, fmt.Errorf("jupyter: unsupported transport %q", info.Transport)
+	}
+	if info.Key != "" && info.SignatureScheme != "" && info.SignatureScheme != "hmac-sha256" {
+		return nil, fmt.Errorf("jupyter: unsupported signature scheme %q", info.SignatureScheme)
+	}
+	k := &Kernel{
+		signer:  signer{key: []byte(info.Key)},
+		session: newID(),
+		done:    make(chan struct{}),
+	}
+	for _, s := range []struct {
+		sock **socket
+		typ  string
+		port *int
+	}{
+		{&k.shell, "ROUTER", &info.ShellPort},
+		{&k.control, "ROUTER", &info.ControlPort},
+		{&k.stdin, "ROUTER", &info.StdinPort},
+		{&k.iopub, "PUB", &info.IOPubPort},
+		{&k.hb, "REP", &info.HBPort},
+	} {
+		sock, err := listen(s.typ, fmt.Sprintf("%s:%d", info.IP, *s.port))
+		if err != nil {
+			k.Close()
+			return nil, fmt.Errorf("jupyter: %v", err)
+		}
+		*s.sock = sock
+		*s.port = sock.port()
+	}
+	k.Info = info
+
+	k.prg = eval.New(eval.Options{Stdout: streamWriter{k}})
+	k.prg.SetHooks(eval.Hooks{
+		Display: func(ev eval.DisplayEvent) {
+			k.publish("display_data", map[string]interface{}{
+				"data":     mimeBundle(ev.Data),
+				"metadata": map[string]interface{}{},
+			})
+		},
+	})
+	return k, nil
+}
+
+// Close closes the sockets of the kernel.
+func (k *Kernel) Close() error {
+	k.closeOnce.Do(func() { close(k.done) })
+	for _, s := range []*socket{k.shell, k.control, k.stdin, k.iopub, k.hb} {
+		if s != nil {
+			s.close()
+		}
+	}
+	return nil
+}
+
+// Serve serves clients until one shuts down the kernel or the
+// kernel is closed.
+func (k *Kernel) Serve() error {
+	go k.heartbeat()
+	go k.serve(k.control)
+	go k.serve(k.shell)
+	<-k.done
+	return nil
+}
+
+// heartbeat echoes the messages of the heartbeat socket, which tell
+// a client the kernel is alive.
+func (k *Kernel) heartbeat() {
+	for {
+		msg, err := k.hb.recv()
+		if err != nil {
+			return
+		}
+		k.hb.send(msg)
+	}
+}
+
+// serve handles the requests of the shell or control socket s, one
+// at a time.
+func (k *Kernel) serve(s *socket) {
+	for {
+		frames, err := s.recv()
+		if err != nil {
+			return
+		}
+		req, err := k.signer.decode(frames)
+		if err != nil {
+			log.Printf("jupyter: %v", err)
+			continue
+		}
+		k.publishTo(req, "status", map[string]string{"execution_state": "busy"})
+		k.handle(s, req)
+		k.publishTo(req, "status", map[string]string{"execution_state": "idle"})
+	}
+}
+
+func (k *Kernel) handle(s *socket, req *message) {
+	reply := func(content interface{}) {
+		typ := strings.TrimSuffix(req.header.MsgType, "_request") + "_reply"
+		k.send(s, req.ids, typ, req, content)
+	}
+	switch req.header.MsgType {
+	case "kernel_info_request":
+		reply(map[string]interface{}{
+			"status":                 "ok",
+			"protocol_version":       protocolVersion,
+			"implementation":         "ng",
+			"implementation_version": "0.1",
+			"banner":                 "Neugram",
+			"language_info": map[string]string{
+				"name":           "neugram",
+				"mimetype":       "text/x-neugram",
+				"file_extension": ".ng",
+			},
+		})
+	case "execute_request":
+		reply(k.execute(req))
+	case "is_complete_request":
+		var content struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(req.content, &content)
+		reply(map[string]string{"status": isComplete(content.Code)})
+	case "comm_info_request":
+		reply(map[string]interface{}{
+			"status": "ok",
+			"comms":  map[string]interface{}{},
+		})
+	case "interrupt_request":
+		k.mu.Lock()
+		if k.cancel != nil {
+			k.cancel()
+		}
+		k.mu.Unlock()
+		reply(map[string]string{"status": "ok"})
+	case "shutdown_request":
+		var content struct {
+			Restart bool `json:"restart"`
+		}
+		json.Unmarshal(req.content, &content)
+		reply(map[string]interface{}{"status": "ok", "restart": content.Restart})
+		k.closeOnce.Do(func() { close(k.done) })
+	default:
+		log.Printf("jupyter: unhandled message type %q", req.header.MsgType)
+	}
+}
+
+// execute evaluates the cell of an execute_request, and returns the
+// content of its reply.
+func (k *Kernel) execute(req *message) map[string]interface{} {
+	var content struct {
+		Code   string `json:"code"`
+		Silent bool   `json:"silent"`
+	}
+	if err := json.Unmarshal(req.content, &content); err != nil {
+		return errorContent(k.prg.ExecCount(), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		k.mu.Lock()
+		k.cancel = nil
+		k.mu.Unlock()
+	}()
+	k.mu.Lock()
+	k.parent = req
+	k.cancel = cancel
+	k.mu.Unlock()
+
+	count := k.prg.ExecCount() + 1
+	if !content.Silent {
+		k.publish("execute_input", map[string]interface{}{
+			"code":            content.Code,
+			"execution_count": count,
+		})
+	}
+	vals, err := k.prg.EvalSourceContext(ctx, content.Code)
+	if err == context.Canceled {
+		err = eval.ErrInterrupted
+	}
+	if err != nil {
+		c := errorContent(count, err)
+		k.publish("error", c)
+		return c
+	}
+	if len(vals) > 0 && !content.Silent {
+		k.publish("execute_result", map[string]interface{}{
+			"execution_count": count,
+			"data":            resultBundle(vals),
+			"metadata":        map[string]interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"status":           "ok",
+		"execution_count":  count,
+		"payload":          []interface{}{},
+		"user_expressions": map[string]interface{}{},
+	}
+}
+
+func errorContent(count int, err error) map[string]interface{} {
+	ename := "error"
+	if err == eval.ErrInterrupted {
+		ename = "interrupted"
+	}
+	return map[string]interface{}{
+		"status":          "error",
+		"execution_count": count,
+		"ename":           ename,
+		"evalue":          err.Error(),
+		"traceback":       []string{err.Error()},
+	}
+}
+
+// isComplete reports whether code is a complete cell: "complete",
+// "incomplete" if it ends in a partial statement, or "invalid".
+func isComplete(code string) string {
+	p := parser.New(token.NewFileSet(), "", 0)
+	state := parser.StateStmt
+	for _, line := range strings.Split(code, "\n") {
+		res := p.ParseLine([]byte(line))
+		if len(res.Errs) > 0 {
+			return "invalid"
+		}
+		state = res.State
+	}
+	if state == parser.StateStmtPartial || state == parser.StateCmdPartial {
+		return "incomplete"
+	}
+	return "complete"
+}
+
+// resultBundle returns the MIME bundle of the result of a cell.
+func resultBundle(vals []interface{}) map[string]string {
+	var text []string
+	for _, v := range vals {
+		text = append(text, fmt.Sprint(v))
+	}
+	bundle := map[string]string{"text/plain": strings.Join(text, " ")}
+	if len(vals) == 1 {
+		if table, ok := htmlTable(vals[0]); ok {
+			bundle["text/html"] = table
+		}
+	}
+	return bundle
+}
+
+// mimeBundle returns the display data as Jupyter sends it: JSON as
+// itself, text as a string, and other data in base64, as
+// encoding/json encodes a []byte.
+func mimeBundle(data map[string][]byte) map[string]interface{} {
+	bundle := make(map[string]interface{})
+	for mime, b := range data {
+		switch {
+		case strings.HasSuffix(mime, "json") && json.Valid(b):
+			bundle[mime] = json.RawMessage(b)
+		case strings.HasPrefix(mime, "text/") || strings.HasSuffix(mime, "+xml"):
+			bundle[mime] = string(b)
+		default:
+			bundle[mime] = b
+		}
+	}
+	return bundle
+}
+
+// publish publishes a message on behalf of the request being
+// executed.
+func (k *Kernel) publish(typ string, content interface{}) {
+	k.mu.Lock()
+	parent := k.parent
+	k.mu.Unlock()
+	k.publishTo(parent, typ, content)
+}
+
+func (k *Kernel) publishTo(parent *message, typ string, content interface{}) {
+	k.send(k.iopub, [][]byte{[]byte(typ)}, typ, parent, content)
+}
+
+func (k *Kernel) send(s *socket, ids [][]byte, typ string, parent *message, content interface{}) {
+	frames, err := k.signer.encode(ids, k.session, typ, parent, content)
+	if err != nil {
+		log.Printf("jupyter: %s: %v", typ, err)
+		return
+	}
+	s.send(frames)
+}
+
+// streamWriter publishes the output of a program as a stream.
+type streamWriter struct {
+	k *Kernel
+}
+
+func (w streamWriter) Write(b []byte) (int, error) {
+	w.k.publish("stream", map[string]string{"name": "stdout", "text": string(b)})
+	return len(b), nil
+}
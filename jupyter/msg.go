@@ -0,0 +1,122 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jupyter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// protocolVersion is the version of the Jupyter messaging protocol
+// the kernel speaks.
+const protocolVersion = "5.3"
+
+// delim separates the routing identities of a message from its
+// signed parts.
+const delim = "<IDS|MSG>"
+
+// A header identifies a message.
+type header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// A message is a Jupyter message. On the wire it is the frames
+//
+//	identities... <IDS|MSG> signature header parent metadata content
+//
+// where the signature is the HMAC of the four JSON parts after it.
+type message struct {
+	ids       [][]byte // routing identities, the first of its peer
+	header    header
+	rawHeader json.RawMessage // as received, to be the parent of replies
+	content   json.RawMessage
+}
+
+// A signer signs and checks messages with the key of a connection.
+type signer struct {
+	key []byte // no signatures if empty
+}
+
+func (s signer) sign(parts [][]byte) []byte {
+	if len(s.key) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, s.key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	sig := make([]byte, hex.EncodedLen(mac.Size()))
+	hex.Encode(sig, mac.Sum(nil))
+	return sig
+}
+
+// decode decodes and checks the message in frames.
+func (s signer) decode(frames [][]byte) (*message, error) {
+	i := 0
+	for i < len(frames) && string(frames[i]) != delim {
+		i++
+	}
+	if len(frames) < i+6 {
+		return nil, errors.New("jupyter: malformed message")
+	}
+	m := &message{ids: frames[:i]}
+	sig, parts := frames[i+1], frames[i+2:i+6]
+	if !hmac.Equal(sig, s.sign(parts)) {
+		return nil, errors.New("jupyter: message has a bad signature")
+	}
+	if err := json.Unmarshal(parts[0], &m.header); err != nil {
+		return nil, fmt.Errorf("jupyter: message header: %v", err)
+	}
+	m.rawHeader = parts[0]
+	m.content = parts[3]
+	return m, nil
+}
+
+// encode returns the frames of a message, of type typ, to the peers
+// ids, in reply to or on behalf of parent.
+func (s signer) encode(ids [][]byte, session, typ string, parent *message, content interface{}) ([][]byte, error) {
+	h, err := json.Marshal(header{
+		MsgID:    newID(),
+		Session:  session,
+		Username: "kernel",
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  typ,
+		Version:  protocolVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := []byte("{}")
+	if parent != nil {
+		p = parent.rawHeader
+	}
+	c, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	parts := [][]byte{h, p, []byte("{}"), c}
+	frames := append(append([][]byte(nil), ids...), []byte(delim), s.sign(parts))
+	return append(frames, parts...), nil
+}
+
+// newID returns a random message or session id.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("jupyter: random id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,352 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jupyter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// The kernel speaks to Jupyter over ZeroMQ sockets. Rather than bind
+// libzmq, it implements the part of ZMTP 3.0, the ZeroMQ wire
+// protocol, that a kernel uses: the NULL security mechanism, and
+// bound ROUTER, REP, and PUB sockets over TCP.
+//
+// A ROUTER socket receives each message with a first frame added,
+// the identity of the peer it came from, and sends a message to the
+// peer its first frame identifies. The REP socket of the heartbeat
+// only echoes messages, so it routes as a ROUTER does. A PUB socket
+// sends each message to every peer, and ignores the subscriptions of
+// its peers, as Jupyter clients subscribe to everything.
+//
+// See https://rfc.zeromq.org/spec/23/.
+
+const (
+	flagMore    = 1 << 0
+	flagLong    = 1 << 1
+	flagCommand = 1 << 2
+
+	maxFrame = 1 << 30 // bytes
+)
+
+var errClosed = errors.New("jupyter: socket closed")
+
+// greeting returns the ZMTP 3.0 greeting of a peer using the NULL
+// mechanism.
+func greeting() []byte {
+	g := make([]byte, 64)
+	g[0] = 0xff
+	g[9] = 0x7f
+	g[10] = 3 // version 3.0
+	copy(g[12:32], "NULL")
+	return g
+}
+
+// A conn is a ZMTP connection, past its handshake.
+type conn struct {
+	c        net.Conn
+	r        *bufio.Reader
+	identity []byte // the Identity property of the peer
+
+	wmu sync.Mutex // guards writes
+}
+
+// handshake exchanges greetings and READY commands over c, as a
+// socket of type typ.
+func handshake(c net.Conn, typ string) (*conn, error) {
+	if _, err := c.Write(greeting()); err != nil {
+		return nil, err
+	}
+	zc := &conn{c: c, r: bufio.NewReader(c)}
+	g := make([]byte, 64)
+	if _, err := io.ReadFull(zc.r, g); err != nil {
+		return nil, err
+	}
+	if g[0] != 0xff || g[9]&1 == 0 || g[10] < 3 {
+		return nil, errors.New("jupyter: peer does not speak ZMTP 3")
+	}
+	if mech := string(bytes.TrimRight(g[12:32], "\x00")); mech != "NULL" {
+		return nil, fmt.Errorf("jupyter: unsupported security mechanism %q", mech)
+	}
+
+	ready := []byte("\x05READY")
+	ready = appendProp(ready, "Socket-Type", typ)
+	if typ == "DEALER" || typ == "REQ" {
+		ready = appendProp(ready, "Identity", "")
+	}
+	if err := zc.writeFrame(ready, flagCommand); err != nil {
+		return nil, err
+	}
+	cmd, flags, err := zc.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagCommand == 0 || len(cmd) < 6 || string(cmd[:6]) != "\x05READY" {
+		return nil, errors.New("jupyter: peer did not send READY")
+	}
+	props, err := parseProps(cmd[6:])
+	if err != nil {
+		return nil, err
+	}
+	zc.identity = props["Identity"]
+	return zc, nil
+}
+
+func appendProp(b []byte, name, value string) []byte {
+	b = append(b, byte(len(name)))
+	b = append(b, name...)
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(value)))
+	b = append(b, n[:]...)
+	return append(b, value...)
+}
+
+func parseProps(b []byte) (map[string][]byte, error) {
+	props := make(map[string][]byte)
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+4 {
+			return nil, errors.New("jupyter: malformed READY property")
+		}
+		name := string(b[1 : 1+n])
+		b = b[1+n:]
+		m := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint64(m) > uint64(len(b)) {
+			return nil, errors.New("jupyter: malformed READY property")
+		}
+		props[name] = b[:m]
+		b = b[m:]
+	}
+	return props, nil
+}
+
+func (c *conn) writeFrame(data []byte, flags byte) error {
+	var hdr [9]byte
+	n := 2
+	if len(data) > 255 {
+		flags |= flagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(data)))
+		n = 9
+	} else {
+		hdr[1] = byte(len(data))
+	}
+	hdr[0] = flags
+	if _, err := c.c.Write(append(hdr[:n:n], data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *conn) readFrame() (data []byte, flags byte, err error) {
+	if flags, err = c.r.ReadByte(); err != nil {
+		return nil, 0, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		var n [8]byte
+		if _, err := io.ReadFull(c.r, n[:]); err != nil {
+			return nil, 0, err
+		}
+		size = binary.BigEndian.Uint64(n[:])
+	} else {
+		n, err := c.r.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		size = uint64(n)
+	}
+	if size > maxFrame {
+		return nil, 0, fmt.Errorf("jupyter: frame of %d bytes is too long", size)
+	}
+	data = make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, 0, err
+	}
+	return data, flags, nil
+}
+
+// readMsg reads the next message, skipping commands.
+func (c *conn) readMsg() ([][]byte, error) {
+	var msg [][]byte
+	for {
+		data, flags, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue
+		}
+		msg = append(msg, data)
+		if flags&flagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+func (c *conn) writeMsg(msg [][]byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	for i, frame := range msg {
+		var flags byte
+		if i < len(msg)-1 {
+			flags = flagMore
+		}
+		if err := c.writeFrame(frame, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A socket is a bound ROUTER, REP, or PUB socket.
+type socket struct {
+	typ  string
+	l    net.Listener
+	in   chan [][]byte // received messages, after their peer identity
+	done chan struct{} // closed by close
+
+	mu     sync.Mutex
+	peers  map[string]*conn
+	nextID uint32
+	closed bool
+}
+
+// listen binds a socket of type typ to the TCP address addr.
+func listen(typ, addr string) (*socket, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &socket{
+		typ:   typ,
+		l:     l,
+		in:    make(chan [][]byte),
+		done:  make(chan struct{}),
+		peers: make(map[string]*conn),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// port returns the TCP port the socket is bound to.
+func (s *socket) port() int {
+	return s.l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *socket) accept() {
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(c)
+	}
+}
+
+func (s *socket) serve(c net.Conn) {
+	defer c.Close()
+	zc, err := handshake(c, s.typ)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	id := string(zc.identity)
+	if id == "" || s.peers[id] != nil {
+		s.nextID++
+		var b [5]byte // as libzmq makes them, a zero byte and a number
+		binary.BigEndian.PutUint32(b[1:], s.nextID)
+		id = string(b[:])
+	}
+	s.peers[id] = zc
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.peers, id)
+		s.mu.Unlock()
+	}()
+
+	for {
+		msg, err := zc.readMsg()
+		if err != nil {
+			return
+		}
+		if s.typ == "PUB" {
+			continue // a subscription
+		}
+		select {
+		case s.in <- append([][]byte{[]byte(id)}, msg...):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// recv returns the next message received by a ROUTER or REP socket,
+// after the identity of its peer.
+func (s *socket) recv() ([][]byte, error) {
+	select {
+	case msg := <-s.in:
+		return msg, nil
+	case <-s.done:
+		return nil, errClosed
+	}
+}
+
+// send sends msg. A message to a peer that is gone is dropped, as
+// ZeroMQ does.
+func (s *socket) send(msg [][]byte) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errClosed
+	}
+	var peers []*conn
+	if s.typ == "PUB" {
+		for _, c := range s.peers {
+			peers = append(peers, c)
+		}
+	} else {
+		if len(msg) == 0 {
+			s.mu.Unlock()
+			return errors.New("jupyter: message has no peer identity")
+		}
+		if c := s.peers[string(msg[0])]; c != nil {
+			peers = append(peers, c)
+		}
+		msg = msg[1:]
+	}
+	s.mu.Unlock()
+	for _, c := range peers {
+		if err := c.writeMsg(msg); err != nil {
+			c.c.Close() // its serve goroutine drops it
+		}
+	}
+	return nil
+}
+
+func (s *socket) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, c := range s.peers {
+		c.c.Close()
+	}
+	return s.l.Close()
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -18,11 +19,19 @@ import (
 	"strings"
 	"time"
 
+	"neugram.io/ng/daemon"
 	"neugram.io/ng/eval"
 	"neugram.io/ng/eval/environ"
+	_ "neugram.io/ng/eval/ffi"
 	"neugram.io/ng/eval/shell"
 	"neugram.io/ng/format"
+	"neugram.io/ng/jupyter"
+	"neugram.io/ng/notebook"
 	"neugram.io/ng/parser"
+	_ "neugram.io/ng/table/csv"
+	_ "neugram.io/ng/table/json"
+	_ "neugram.io/ng/table/parquet"
+	_ "neugram.io/ng/table/sql"
 	"neugram.io/ng/tipe"
 
 	"github.com/peterh/liner"
@@ -62,7 +71,7 @@ func mode() liner.ModeApplier {
 	return m
 }
 
-const usageLine = "ng [programfile | -e cmd] [arguments]"
+const usageLine = "ng [programfile | run notebook.ngnb | -e cmd | -daemon address | -jupyter connfile] [arguments]"
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `ng - neugram scripting language and shell
@@ -80,6 +89,8 @@ func main() {
 
 	help := flag.Bool("h", false, "display help message and exit")
 	e := flag.String("e", "", "program passed as a string")
+	daemonAddr := flag.String("daemon", "", "serve remote sessions on the TCP `address`")
+	connFile := flag.String("jupyter", "", "run a Jupyter kernel with the connection `file`")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: %s\n", usageLine)
 		os.Exit(1)
@@ -90,12 +101,29 @@ func main() {
 		usage()
 		os.Exit(0)
 	}
+	if *daemonAddr != "" {
+		fmt.Fprintf(os.Stderr, "ng: serving sessions on %s\n", *daemonAddr)
+		if err := daemon.ListenAndServe(*daemonAddr); err != nil {
+			exitf("%v", err)
+		}
+		return
+	}
+	if *connFile != "" {
+		if err := jupyter.Run(*connFile); err != nil {
+			exitf("%v", err)
+		}
+		return
+	}
 	if *e != "" {
 		initProgram(filepath.Join(cwd, "ng-arg"))
 		res := p.ParseLine([]byte(*e))
 		handleResult(res)
 		return
 	}
+	if args := flag.Args(); len(args) > 1 && args[0] == "run" && filepath.Ext(args[1]) == ".ngnb" {
+		runNotebook(args[1])
+		return
+	}
 	if args := flag.Args(); len(args) > 0 {
 		// TODO: plumb through the rest of the args
 		path := args[0]
@@ -200,8 +228,8 @@ func init() {
 }
 
 func initProgram(path string) {
-	p = parser.New()
-	prg = eval.New(path)
+	prg = eval.New(eval.Options{Path: path})
+	p = parser.New(prg.Types.Fset, path, 0)
 	shell.Env = prg.Environ()
 	shell.Alias = prg.Alias()
 
@@ -243,6 +271,35 @@ func runFile(f *os.File) (parser.ParserState, error) {
 	}
 }
 
+// runNotebook runs the notebook in the file path, and saves it with
+// its new outputs. An interrupt stops the cell being run, and the
+// notebook is saved with the cells run so far.
+func runNotebook(path string) {
+	nb, err := notebook.Load(path)
+	if err != nil {
+		exitf("%v", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		exitf("%v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		cancel()
+	}()
+	runErr := nb.Run(ctx, eval.Options{Path: abs, Stdout: os.Stdout})
+	if err := nb.Save(path); err != nil {
+		exitf("%v", err)
+	}
+	if runErr != nil {
+		exitf("%s: %v", path, runErr)
+	}
+}
+
 func loop() {
 	path := filepath.Join(cwd, "ng-interactive")
 	initProgram(path)
@@ -334,8 +391,16 @@ func loop() {
 }
 
 func handleResult(res parser.Result) {
+	if len(res.Errs) > 0 {
+		// The statements of a line with errors are not evaluated,
+		// as what was parsed of them may be incomplete.
+		for _, err := range res.Errs {
+			fmt.Println(err.Error())
+		}
+		return
+	}
 	for _, s := range res.Stmts {
-		v, err := prg.Eval(s, sigint)
+		v, err := prg.EvalStmt(s, sigint)
 		if err != nil {
 			fmt.Printf("ng: %v\n", err)
 			continue
@@ -372,15 +437,12 @@ func handleResult(res parser.Result) {
 			fmt.Println("")
 		}
 	}
-	for _, err := range res.Errs {
-		fmt.Println(err.Error())
-	}
 	//editMode := mode()
 	//origMode.ApplyMode()
 	for _, cmd := range res.Cmds {
 		j := &shell.Job{
 			Cmd:    cmd,
-			Params: prg,
+			Params: prg.ShellParams(),
 			Stdin:  os.Stdin,
 			Stdout: os.Stdout,
 			Stderr: os.Stderr,
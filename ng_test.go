@@ -2,9 +2,12 @@ package main_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +49,30 @@ func TestPrintf(t *testing.T) {
 		t.Errorf("printf returned %q, want %q", got, want)
 	}
 }
+
+func TestRunNotebook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ng-notebook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.ngnb")
+	src := `{"ngnb": 1, "cells": [{"kind": "code", "source": "print(\"hi\")\n6 * 7"}]}`
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(testng, "run", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("testng run failed: %v\n%s", err, out)
+	}
+	if got := string(out); got != "hi\n" {
+		t.Errorf("testng run printed %q, want hi", got)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"text/plain": "42"`) {
+		t.Errorf("saved notebook has no result 42:\n%s", b)
+	}
+}
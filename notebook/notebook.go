@@ -0,0 +1,323 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package notebook reads, runs, and writes Neugram notebooks, files
+// of cells of source with the output each cell printed when it was
+// last run. A notebook records an analysis with its results, and is
+// run again, as by
+//
+//	ng run analysis.ngnb
+//
+// without a Jupyter installation.
+//
+// A notebook file, named with the extension .ngnb, is JSON:
+//
+//	{
+//		"ngnb": 1,
+//		"cells": [
+//			{"kind": "markdown", "source": "# Totals"},
+//			{
+//				"kind": "code",
+//				"source": "n := 6\nprint(\"hi\")\nn * 7",
+//				"exec_count": 1,
+//				"outputs": [
+//					{"kind": "stream", "text": "hi\n"},
+//					{"kind": "result", "data": {"text/plain": "42"}}
+//				]
+//			}
+//		]
+//	}
+//
+// The data of an output is by MIME type. Text, XML, and JSON types
+// are strings, and other types, such as images, are base64.
+package notebook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"neugram.io/ng/eval"
+)
+
+// Version is the version of the notebook format written by Write.
+const Version = 1
+
+// Kinds of cells.
+const (
+	Code     = "code"
+	Markdown = "markdown"
+)
+
+// Kinds of outputs.
+const (
+	Stream  = "stream"  // printed, in Text
+	Result  = "result"  // values of the last expression, in Data
+	Display = "display" // shown by the package display, in Data
+	Error   = "error"   // the error that stopped the cell, in Text
+)
+
+// A Notebook is a list of cells.
+type Notebook struct {
+	Cells []*Cell
+}
+
+// A Cell is Neugram source, or Markdown, with the outputs of its
+// last run.
+type Cell struct {
+	Kind      string   `json:"kind"`
+	Source    string   `json:"source"`
+	ExecCount int      `json:"exec_count,omitempty"`
+	Outputs   []Output `json:"outputs,omitempty"`
+}
+
+// An Output is output of a cell.
+type Output struct {
+	Kind string
+	Text string
+	Data map[string][]byte // by MIME type
+}
+
+// file is the JSON form of a notebook.
+type file struct {
+	Version int     `json:"ngnb"`
+	Cells   []*Cell `json:"cells"`
+}
+
+// output is the JSON form of an Output.
+type output struct {
+	Kind string            `json:"kind"`
+	Text string            `json:"text,omitempty"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// isText reports whether data of the MIME type mime is written as
+// a string, rather than in base64.
+func isText(mime string) bool {
+	return strings.HasPrefix(mime, "text/") || strings.HasSuffix(mime, "+xml") || strings.HasSuffix(mime, "json")
+}
+
+// MarshalJSON encodes o, with its data by the rules of isText.
+func (o Output) MarshalJSON() ([]byte, error) {
+	out := output{Kind: o.Kind, Text: o.Text}
+	if o.Data != nil {
+		out.Data = make(map[string]string)
+		for mime, b := range o.Data {
+			if isText(mime) {
+				out.Data[mime] = string(b)
+			} else {
+				out.Data[mime] = base64.StdEncoding.EncodeToString(b)
+			}
+		}
+	}
+	return marshal(out, "")
+}
+
+// marshal encodes v as JSON with the indent, not escaping HTML, as
+// sources hold < and &.
+func marshal(v interface{}, indent string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes o, as encoded by MarshalJSON.
+func (o *Output) UnmarshalJSON(b []byte) error {
+	var out output
+	if err := json.Unmarshal(b, &out); err != nil {
+		return err
+	}
+	*o = Output{Kind: out.Kind, Text: out.Text}
+	if out.Data != nil {
+		o.Data = make(map[string][]byte)
+		for mime, s := range out.Data {
+			if isText(mime) {
+				o.Data[mime] = []byte(s)
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("%s data: %v", mime, err)
+			}
+			o.Data[mime] = b
+		}
+	}
+	return nil
+}
+
+// Read reads a notebook from r.
+func Read(r io.Reader) (*Notebook, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("notebook: %v", err)
+	}
+	if f.Version < 1 || f.Version > Version {
+		return nil, fmt.Errorf("notebook: unsupported version %d", f.Version)
+	}
+	for i, c := range f.Cells {
+		if c == nil || (c.Kind != Code && c.Kind != Markdown) {
+			return nil, fmt.Errorf("notebook: cell %d is not code or markdown", i+1)
+		}
+	}
+	return &Notebook{Cells: f.Cells}, nil
+}
+
+// Load reads the notebook in the file path.
+func Load(path string) (*Notebook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	nb, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return nb, nil
+}
+
+// Write writes nb to w.
+func (nb *Notebook) Write(w io.Writer) error {
+	cells := nb.Cells
+	if cells == nil {
+		cells = []*Cell{}
+	}
+	b, err := marshal(file{Version: Version, Cells: cells}, "\t")
+	if err != nil {
+		return fmt.Errorf("notebook: %v", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Save writes nb to the file path. It replaces the file only once
+// the notebook is written in full, and keeps its permissions.
+func (nb *Notebook) Save(path string) error {
+	buf := new(bytes.Buffer)
+	if err := nb.Write(buf); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".ngnb")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Run runs the code cells of nb in order, in a new Program made with
+// opts, and replaces their outputs. If a cell fails, or ctx is
+// canceled, its error is its last output, the cells after it are
+// not run and keep their outputs, and Run returns the error.
+//
+// The output the program prints is also written to opts.Stdout, if
+// it is not nil.
+func (nb *Notebook) Run(ctx context.Context, opts eval.Options) error {
+	w := &cellWriter{tee: opts.Stdout}
+	opts.Stdout = w
+	p := eval.New(opts)
+	p.SetHooks(eval.Hooks{
+		Display: func(ev eval.DisplayEvent) {
+			w.add(Output{Kind: Display, Data: ev.Data})
+		},
+	})
+	for i, c := range nb.Cells {
+		if c.Kind != Code {
+			continue
+		}
+		w.set(c)
+		vals, err := p.EvalSourceContext(ctx, c.Source)
+		c.ExecCount = p.ExecCount()
+		if err != nil {
+			w.add(Output{Kind: Error, Text: err.Error()})
+			w.set(nil)
+			return fmt.Errorf("cell %d: %v", i+1, err)
+		}
+		if len(vals) > 0 {
+			var text []string
+			for _, v := range vals {
+				text = append(text, fmt.Sprint(v))
+			}
+			w.add(Output{Kind: Result, Data: map[string][]byte{
+				"text/plain": []byte(strings.Join(text, " ")),
+			}})
+		}
+	}
+	w.set(nil)
+	return nil
+}
+
+// cellWriter collects the output of the cell being run.
+type cellWriter struct {
+	tee io.Writer // or nil
+
+	mu   sync.Mutex // a goroutine may print as a later cell runs
+	cell *Cell      // or nil, between runs
+}
+
+// set starts collecting the outputs of c, or stops if c is nil.
+func (w *cellWriter) set(c *Cell) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cell = c
+	if c != nil {
+		c.Outputs = nil
+	}
+}
+
+func (w *cellWriter) add(o Output) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cell != nil {
+		w.cell.Outputs = append(w.cell.Outputs, o)
+	}
+}
+
+// Write adds b to the stream output of the cell, joining it with
+// the output before if that is also printed.
+func (w *cellWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	if c := w.cell; c != nil {
+		if n := len(c.Outputs); n > 0 && c.Outputs[n-1].Kind == Stream {
+			c.Outputs[n-1].Text += string(b)
+		} else {
+			c.Outputs = append(c.Outputs, Output{Kind: Stream, Text: string(b)})
+		}
+	}
+	w.mu.Unlock()
+	if w.tee != nil {
+		return w.tee.Write(b)
+	}
+	return len(b), nil
+}
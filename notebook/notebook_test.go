@@ -0,0 +1,149 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package notebook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/eval"
+)
+
+func TestRun(t *testing.T) {
+	nb := &Notebook{Cells: []*Cell{
+		{Kind: Markdown, Source: "# Totals"},
+		{Kind: Code, Source: "x := 6\nprint(\"hi\")\nprint(\"there\")\nx * 7"},
+		{Kind: Code, Source: "import \"display\"\ndisplay.PNG([]byte{1, 2})\nprint(x)"},
+		{Kind: Code, Source: "y"},
+		{Kind: Code, Source: "print(1)", Outputs: []Output{{Kind: Stream, Text: "old\n"}}},
+	}}
+	out := new(bytes.Buffer)
+	err := nb.Run(context.Background(), eval.Options{Stdout: out})
+	if err == nil || !strings.Contains(err.Error(), "cell 4") {
+		t.Errorf("Run error = %v, want undeclared y in cell 4", err)
+	}
+	if got, want := out.String(), "hi\nthere\n6\n"; got != want {
+		t.Errorf("Stdout = %q, want %q", got, want)
+	}
+
+	want := [][]Output{
+		nil,
+		{
+			{Kind: Stream, Text: "hi\nthere\n"},
+			{Kind: Result, Data: map[string][]byte{"text/plain": []byte("42")}},
+		},
+		{
+			{Kind: Display, Data: map[string][]byte{
+				"image/png":  {1, 2},
+				"text/plain": []byte("<image/png, 2 bytes>"),
+			}},
+			{Kind: Stream, Text: "6\n"},
+		},
+		nil, // checked below
+		{{Kind: Stream, Text: "old\n"}},
+	}
+	for i, c := range nb.Cells {
+		if i == 3 {
+			if len(c.Outputs) != 1 || c.Outputs[0].Kind != Error {
+				t.Errorf("cell 4 outputs = %+v, want an error", c.Outputs)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(c.Outputs, want[i]) {
+			t.Errorf("cell %d outputs = %+v, want %+v", i+1, c.Outputs, want[i])
+		}
+	}
+	for i, count := range []int{0, 1, 2, 3, 0} {
+		if nb.Cells[i].ExecCount != count {
+			t.Errorf("cell %d ExecCount = %d, want %d", i+1, nb.Cells[i].ExecCount, count)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	nb := &Notebook{Cells: []*Cell{
+		{Kind: Markdown, Source: "a < b & c"},
+		{Kind: Code, Source: "1", ExecCount: 1, Outputs: []Output{
+			{Kind: Display, Data: map[string][]byte{
+				"image/png":        {0, 0xff},
+				"text/html":        []byte("<b>x</b>"),
+				"application/json": []byte(`{"a":1}`),
+			}},
+			{Kind: Error, Text: "failed"},
+		}},
+	}}
+	buf := new(bytes.Buffer)
+	if err := nb.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"a < b & c"`, `"<b>x</b>"`, `"AP8="`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("written notebook does not hold %s:\n%s", s, buf)
+		}
+	}
+	got, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, nb) {
+		t.Errorf("read %+v, want %+v", got, nb)
+	}
+
+	for _, src := range []string{
+		`{"ngnb": 2, "cells": []}`,
+		`{"cells": []}`,
+		`{"ngnb": 1, "cells": [{"kind": "raw"}]}`,
+		`{"ngnb": 1, "cells": [{"kind": "code", "outputs": [{"data": {"image/png": "!"}}]}]}`,
+	} {
+		if _, err := Read(strings.NewReader(src)); err == nil {
+			t.Errorf("Read(%s) succeeded", src)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notebook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.ngnb")
+	if err := ioutil.WriteFile(path, []byte(`{"ngnb": 1, "cells": [{"kind": "code", "source": "2 * 3"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nb.Run(context.Background(), eval.Options{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nb.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("saved notebook has mode %v, want 0600", fi.Mode().Perm())
+	}
+	nb, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outs := nb.Cells[0].Outputs; len(outs) != 1 || string(outs[0].Data["text/plain"]) != "6" {
+		t.Errorf("saved outputs = %+v, want result 6", outs)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Save left %d files in the directory, want 1", len(files))
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package parser
+
+import (
+	"strings"
+
+	"neugram.io/ng/token"
+)
+
+// Fuzz is the entry point for go-fuzz.
+//
+// The parser must return an error for any input it cannot parse,
+// so an internal error is reported to go-fuzz as a crash.
+func Fuzz(data []byte) int {
+	_, err := ParseFile(token.NewFileSet(), "fuzz.ng", data, ParseComments)
+	if err == nil {
+		return 1
+	}
+	if errs, ok := err.(Errors); ok {
+		for _, e := range errs {
+			if strings.HasPrefix(e.Msg, "internal error: ") {
+				panic(e.Msg)
+			}
+		}
+	}
+	return 0
+}
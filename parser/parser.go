@@ -8,20 +8,50 @@ import (
 	"bytes"
 	"fmt"
 	"math/big"
-	"os"
-	"runtime/debug"
-	"strconv"
+	"strings"
 
 	"neugram.io/ng/expr"
 	"neugram.io/ng/format"
 	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
 	"neugram.io/ng/tipe"
 	"neugram.io/ng/token"
 )
 
-func New() *Parser {
+// A Mode is a set of flags controlling optional parser behavior.
+type Mode uint
+
+const (
+	// ParseComments records comments in the Result and attaches
+	// leading comments to declarations as documentation.
+	ParseComments Mode = 1 << iota
+
+	// NoShell reports shell expressions, $$ ... $$, as errors,
+	// for embedders that accept only the Go-like language.
+	NoShell
+
+	// Trace prints the productions entered and left by the
+	// parser to standard output, for debugging the parser.
+	Trace
+)
+
+// DefaultMaxDepth is the limit on the nesting of productions of a
+// Parser without SetMaxDepth. Deeper input is reported as an error
+// instead of exhausting the stack.
+const DefaultMaxDepth = 10000
+
+// tooDeep is panicked when the maximum depth is exceeded. It is
+// recovered by parseTopStmt.
+type tooDeep struct{}
+
+// New returns a parser for the source named filename, which is
+// added to fset as it is read.
+func New(fset *token.FileSet, filename string, mode Mode) *Parser {
 	p := &Parser{
-		s: newScanner(),
+		s:        newScanner(fset, filename),
+		fset:     fset,
+		mode:     mode,
+		maxDepth: DefaultMaxDepth,
 	}
 	go p.work()
 	<-p.s.needSrc
@@ -46,12 +76,60 @@ func (p *Parser) ParseLine(line []byte) Result {
 	return r
 }
 
+// Outcome classifies a line of interactive input fed to a Parser.
+type Outcome int
+
+const (
+	NeedMore Outcome = iota // the input so far ends inside a statement or command
+	Complete                // the input so far is complete statements or commands, maybe none
+	Invalid                 // the line has syntax errors
+)
+
+// Feed parses a line of interactive input, as ParseLine does, and
+// reports whether the line completed the input, needs more lines,
+// or has syntax errors.
+//
+// After an error the parser skips to the end of the statement.
+// If the error was inside a block, the block is still open and the
+// outcome of the following lines is NeedMore until it is closed.
+func (p *Parser) Feed(line []byte) (Outcome, Result) {
+	r := p.ParseLine(line)
+	switch {
+	case len(r.Errs) > 0:
+		return Invalid, r
+	case r.State == StateStmtPartial || r.State == StateCmdPartial:
+		return NeedMore, r
+	}
+	return Complete, r
+}
+
 type Parser struct {
 	res Result
 
 	interactive bool
-	noCompLit   bool // to resolve composite literal parsing
+	noCompLit   bool      // to resolve composite literal parsing
+	noLabel     bool      // a trailing ':' ends a select case, not a label
+	inColNames  bool      // a '|' ends table column names, it is not an or
+	inCase      bool      // parsing the statements of a switch case
+	sawStmt     bool      // a top-level statement has been parsed
+	nerrs       int       // number of errors reported, for error recovery
+	depth       int       // nesting of productions
+	maxDepth    int       // limit of depth
+	stmtPos     token.Pos // start of the innermost statement
+	prevTok     token.Token
+	prevLit     interface{}
+	prevPos     token.Pos
+	tracer      TraceFunc
+	lastErr     token.Position
+	pkgName     string
+	pkgDoc      *expr.CommentGroup
 	s           *Scanner
+
+	fset *token.FileSet
+	mode Mode
+	end  token.Pos // end of the last consumed token
+
+	leadComment *expr.CommentGroup // comment group on the lines before the current token
 }
 
 // Result is the result of parsing a line of input.
@@ -61,6 +139,8 @@ type Result struct {
 	Stmts []stmt.Stmt
 	Cmds  []*expr.ShellList
 	Errs  []Error
+
+	Comments []*expr.CommentGroup // only in ParseComments mode
 }
 
 func (p *Parser) Close() {
@@ -71,11 +151,21 @@ func (p *Parser) work() {
 	defer func() {
 		// Work is processed on a separate goroutine. Avoid panicing
 		// here so there's an oppertunity to clean up terminal state.
+		// A parser bug is reported as an error, and the rest of the
+		// input is consumed without parsing so callers never block.
 		if x := recover(); x != nil {
-			err := p.errorf("panic: %v", x)
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			debug.PrintStack()
-			close(p.s.needSrc)
+			p.res.Errs = append(p.res.Errs, Error{
+				Pos:   p.fset.Position(p.s.Pos),
+				Msg:   fmt.Sprintf("internal error: %v", x),
+				Token: p.s.Token,
+			})
+			p.res.State = StateUnknown
+			for {
+				p.s.needSrc <- struct{}{}
+				if b := <-p.s.addSrc; b == nil {
+					return
+				}
+			}
 		}
 	}()
 
@@ -95,7 +185,7 @@ func (p *Parser) work() {
 		// the parsed output of a top-level $$ before the entire expression
 		// is availble, so the REPL can evaluate as we go. That's what
 		// makes a simple expression behave like an interactive shell.
-		if p.res.State != StateCmd && p.s.Token == token.Shell {
+		if p.res.State != StateCmd && p.s.Token == token.Shell && p.mode&NoShell == 0 {
 			p.res.State = StateCmd
 		} else if p.res.State == StateCmd {
 			p.interactive = true
@@ -110,38 +200,282 @@ func (p *Parser) work() {
 				p.expect(token.Semicolon)
 				p.res.State = StateUnknown
 			}
+		} else if p.s.Token == token.Package {
+			p.parsePackageClause()
 		} else {
 			p.res.State = StateStmtPartial
-			p.res.Stmts = append(p.res.Stmts, p.parseStmt())
+			p.res.Stmts = append(p.res.Stmts, p.parseTopStmt())
 			p.res.State = StateStmt
+			p.sawStmt = true
 		}
 	}
 }
 
+func (p *Parser) parsePackageClause() {
+	if p.sawStmt || p.pkgName != "" {
+		p.error("package clause must be first in file")
+	}
+	p.pkgDoc = p.leadComment
+	p.next()
+	p.pkgName = p.parseIdent().Name
+	p.expectSemi()
+}
+
+// ParseFile parses the source of a Neugram file.
+// Positions are recorded in fset.
+//
+// If the source has syntax errors, the returned error is an Errors
+// listing all of them.
+func ParseFile(fset *token.FileSet, filename string, src []byte, mode Mode) (*syntax.File, error) {
+	p := New(fset, filename, mode)
+	defer p.Close()
+	return p.ParseFile(src)
+}
+
+// ParseFile parses src as the whole source of the file p was made
+// for, as the function ParseFile does, with the settings of p. It
+// must be given a new Parser.
+func (p *Parser) ParseFile(src []byte) (*syntax.File, error) {
+	f := &syntax.File{Filename: p.s.filename}
+	var errs Errors
+	var res Result
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		res = p.ParseLine(line)
+		errs = append(errs, res.Errs...)
+		f.Stmts = append(f.Stmts, res.Stmts...)
+		f.Comments = append(f.Comments, res.Comments...)
+		for _, cmd := range res.Cmds {
+			f.Stmts = append(f.Stmts, &stmt.Simple{Expr: &expr.Shell{
+				Cmds: []*expr.ShellList{cmd},
+			}})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if res.State == StateStmtPartial || res.State == StateCmdPartial {
+		return nil, Errors{p.eofError()}
+	}
+	f.Package = p.pkgName
+	f.Doc = p.pkgDoc
+	return f, nil
+}
+
+// ParseProgram parses the statements of a Neugram program, for
+// callers that have source but no file. Statements are separated
+// by semicolons or newlines and may span lines.
+//
+// A program is parsed as a file, so it may start with a package
+// clause. To keep positions or comments, use ParseFile.
+func ParseProgram(src []byte) ([]stmt.Stmt, error) {
+	f, err := ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f.Stmts, nil
+}
+
+// ParseStmt parses a single statement.
+//
+// If the source has syntax errors, the returned error is an Errors
+// listing all of them.
 func ParseStmt(src []byte) (stmt stmt.Stmt, err error) {
-	p := New()
+	return ParseStmtFrom(token.NewFileSet(), "", src, 0)
+}
+
+// ParseExpr parses a single expression, such as a formula typed
+// into a cell or a configuration file.
+//
+// A source that is any other kind of statement, such as an
+// assignment or a named function declaration, is an error.
+func ParseExpr(src []byte) (expr.Expr, error) {
+	return ParseExprFrom(token.NewFileSet(), "", src, 0)
+}
+
+// ParseExprFrom is ParseExpr for the source named filename,
+// which is added to fset, parsed in the given mode.
+func ParseExprFrom(fset *token.FileSet, filename string, src []byte, mode Mode) (expr.Expr, error) {
+	s, err := ParseStmtFrom(fset, filename, src, mode)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := s.(*stmt.Simple); ok {
+		if fn, ok := s.Expr.(*expr.FuncLiteral); !ok || fn.Name == "" {
+			return s.Expr, nil
+		}
+	}
+	return nil, Errors{{
+		Pos: fset.Position(s.Pos()),
+		Msg: "expected expression, found statement",
+	}}
+}
+
+// ParseStmtFrom is ParseStmt for the source named filename,
+// which is added to fset, parsed in the given mode.
+func ParseStmtFrom(fset *token.FileSet, filename string, src []byte, mode Mode) (stmt.Stmt, error) {
+	p := New(fset, filename, mode)
 	defer p.Close()
+	return p.ParseStmt(src)
+}
+
+// ParseStmt parses src as a single statement, as the function
+// ParseStmt does, with the settings of p. It must be given a new
+// Parser.
+func (p *Parser) ParseStmt(src []byte) (stmt.Stmt, error) {
 	res := p.ParseLine(src)
 	if res.State == StateStmtPartial {
-		return nil, fmt.Errorf("parser.ParseStmt: partial statement")
+		return nil, Errors{p.eofError()}
 	}
 	if len(res.Errs) > 0 {
 		return nil, Errors(res.Errs)
 	}
 	if len(res.Stmts) != 1 {
-		return nil, fmt.Errorf("parser.ParseStmt: expected 1 statement, got %d", len(res.Stmts))
+		var pos token.Pos
+		if len(res.Stmts) > 1 {
+			pos = res.Stmts[1].Pos()
+		}
+		return nil, Errors{{
+			Pos: p.fset.Position(pos),
+			Msg: fmt.Sprintf("expected 1 statement, got %d", len(res.Stmts)),
+		}}
 	}
 	return res.Stmts[0], nil
 }
 
+// eofError reports that the input ended inside a statement.
+func (p *Parser) eofError() Error {
+	return Error{
+		Pos:   p.fset.Position(p.end),
+		Msg:   "unexpected EOF",
+		Token: token.Unknown,
+	}
+}
+
 func (p *Parser) next() {
+	p.end = p.s.End
+	p.prevTok, p.prevLit, p.prevPos = p.s.Token, p.s.Literal, p.s.Pos
 	p.s.Next()
+	if p.s.Token == token.Illegal {
+		p.errorf("illegal character %q", p.s.Literal)
+	}
+	p.leadComment = nil
+	if p.mode&ParseComments == 0 {
+		for p.s.Token == token.Comment {
+			p.s.Next()
+		}
+		return
+	}
 	if p.s.Token == token.Comment {
-		p.next()
+		p.collectComments()
+	}
+}
+
+// collectComments records the comments starting at the current
+// token, grouping comments on adjacent lines. A group that starts
+// on a line of its own and ends on the line before the next token
+// is the lead comment of that token.
+func (p *Parser) collectComments() {
+	var g *expr.CommentGroup
+	endLine := 0
+	for p.s.Token == token.Comment {
+		c := &expr.Comment{
+			Span: expr.Span{From: p.s.Pos, To: p.s.End},
+			Text: p.s.Literal.(string),
+		}
+		if g == nil || p.line(c.Pos()) > endLine+1 {
+			g = &expr.CommentGroup{}
+			p.res.Comments = append(p.res.Comments, g)
+		}
+		g.List = append(g.List, c)
+		endLine = p.line(c.End())
+		p.s.Next()
+	}
+	if p.line(g.Pos()) > p.line(p.end) && p.line(p.s.Pos) == endLine+1 {
+		p.leadComment = g
+	}
+}
+
+// A TraceFunc is called as the parser enters and leaves each
+// grammar production, with the current token and its position.
+type TraceFunc func(production string, enter bool, tok token.Token, pos token.Position)
+
+// SetTrace arranges for f to be called for each production the
+// parser enters and leaves. It must be called before any input
+// is given to the parser. A nil f stops tracing.
+//
+// The Trace mode prints the same events to standard output.
+func (p *Parser) SetTrace(f TraceFunc) {
+	p.tracer = f
+}
+
+// SetMaxDepth limits the nesting of the productions p parses to n,
+// so that deeply nested input is an error rather than exhausting
+// the stack. Zero means DefaultMaxDepth. It must be called before
+// any input is given to the parser.
+func (p *Parser) SetMaxDepth(n int) {
+	if n <= 0 {
+		n = DefaultMaxDepth
+	}
+	p.maxDepth = n
+}
+
+// enter begins parsing the production name, tracing it and
+// limiting nesting. It is used as
+//
+//	defer p.leave(p.enter("Stmt"))
+func (p *Parser) enter(name string) string {
+	p.trace(name, true)
+	p.depth++
+	if p.depth > p.maxDepth {
+		p.error("exceeded maximum nesting depth")
+		panic(tooDeep{})
+	}
+	return name
+}
+
+// leave ends parsing the production name.
+func (p *Parser) leave(name string) {
+	p.depth--
+	p.trace(name, false)
+}
+
+func (p *Parser) trace(name string, enter bool) {
+	if p.tracer == nil && p.mode&Trace == 0 {
+		return
+	}
+	pos := p.fset.Position(p.s.Pos)
+	if p.tracer != nil {
+		p.tracer(name, enter, p.s.Token, pos)
+	}
+	if p.mode&Trace != 0 {
+		indent := strings.Repeat(". ", p.depth)
+		if enter {
+			fmt.Printf("%5d:%3d: %s%s ( %s\n", pos.Line, pos.Column, indent, name, p.s.Token)
+		} else {
+			fmt.Printf("%5d:%3d: %s) %s\n", pos.Line, pos.Column, indent, name)
+		}
 	}
 }
 
+// line reports the line number of pos.
+func (p *Parser) line(pos token.Pos) int { return p.fset.Position(pos).Line }
+
+// pos reports the position of the current token.
+func (p *Parser) pos() token.Pos { return p.s.Pos }
+
+// span reports the source span from pos to the end of the last
+// consumed token.
+func (p *Parser) span(pos token.Pos) expr.Span {
+	return expr.Span{From: pos, To: p.end}
+}
+
+// typeSpan is span for a type.
+func (p *Parser) typeSpan(pos token.Pos) tipe.Span {
+	return tipe.Span{From: pos, To: p.end}
+}
+
 func (p *Parser) parseExpr() expr.Expr {
+	defer p.leave(p.enter("Expr"))
 	return p.parseBinaryExpr(1)
 }
 
@@ -150,14 +484,20 @@ func (p *Parser) parseBinaryExpr(minPrec int) expr.Expr {
 	for prec := p.s.Token.Precedence(); prec >= minPrec; prec-- {
 		for {
 			op := p.s.Token
-			if op.Precedence() != prec {
+			if op.Precedence() != prec || (op == token.Or && p.inColNames) {
 				break
 			}
 			p.next()
-			y := p.parseBinaryExpr(prec + 1)
+			var y expr.Expr
+			if op == token.Pow {
+				// ** is right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2).
+				y = p.parseBinaryExpr(prec)
+			} else {
+				y = p.parseBinaryExpr(prec + 1)
+			}
 			// TODO: distinguish expr from types, when we have types
-			// TODO record position
 			x = &expr.Binary{
+				Span:  p.span(x.Pos()),
 				Op:    op,
 				Left:  x,
 				Right: y,
@@ -168,20 +508,31 @@ func (p *Parser) parseBinaryExpr(minPrec int) expr.Expr {
 }
 
 func (p *Parser) parseUnaryExpr() expr.Expr {
+	defer p.leave(p.enter("UnaryExpr"))
+	pos := p.pos()
 	switch p.s.Token {
-	case token.Add, token.Sub, token.Not, token.Ref:
+	case token.Add, token.Sub, token.Not, token.Xor, token.Ref:
 		op := p.s.Token
 		p.next()
 		if p.s.err != nil {
-			return &expr.Bad{Error: p.s.err}
+			return &expr.Bad{Span: p.span(pos), Error: p.s.err}
 		}
-		x := p.parseUnaryExpr()
+		// ** binds tighter than unary operators: -x ** 2 is -(x ** 2).
+		x := p.parseBinaryExpr(token.Pow.Precedence())
 		// TODO: distinguish expr from types, when we have types
-		return &expr.Unary{Op: op, Expr: x}
+		return &expr.Unary{Span: p.span(pos), Op: op, Expr: x}
 	case token.Mul:
 		p.next()
 		x := p.parseUnaryExpr()
-		return &expr.Unary{Op: token.Mul, Expr: x}
+		return &expr.Unary{Span: p.span(pos), Op: token.Mul, Expr: x}
+	case token.Pow:
+		// Not a power, two dereferences: **x.
+		p.next()
+		x := p.parseUnaryExpr()
+		inner := &expr.Unary{Op: token.Mul, Expr: x}
+		inner.Span = p.span(pos)
+		inner.From++
+		return &expr.Unary{Span: p.span(pos), Op: token.Mul, Expr: inner}
 	case token.ChanOp:
 		// channel type or receive expression
 		p.next()
@@ -196,12 +547,12 @@ func (p *Parser) parseUnaryExpr() expr.Expr {
 				// TODO: nested channel types
 				t.Direction = tipe.ChanRecv
 			} else {
-				p.errorf(`expected "chan", found %q`, format.Type(t))
+				p.errorf(`expected "chan", found %q`, format.Type(extyp.Type))
 			}
 			return x
 		}
 		// parsed a receive expression
-		return &expr.Unary{Op: token.ChanOp, Expr: x}
+		return &expr.Unary{Span: p.span(pos), Op: token.ChanOp, Expr: x}
 	default:
 		return p.parsePrimaryExpr()
 	}
@@ -212,30 +563,41 @@ func (p *Parser) expectCommaOr(otherwise token.Token, msg string) bool {
 	case p.s.Token == token.Comma:
 		return true
 	case p.s.Token != otherwise:
-		p.error("missing ',' in " + msg + " (got " + p.s.Token.String() + ")")
-		return true // fake it
+		p.errorExpected("missing ',' in "+msg+" (got "+p.s.Token.String()+")", token.Comma, otherwise)
+		// Fake it, unless the statement has ended, so that
+		// a missing ')' does not consume the following lines.
+		return p.s.Token != token.Semicolon
 	default:
 		return false
 	}
 }
 
-func (p *Parser) parseArgs() []expr.Expr {
+func (p *Parser) parseArgs() (args []expr.Expr, ellipsis bool) {
+	defer p.leave(p.enter("Args"))
 	p.expect(token.LeftParen)
 	p.next()
-	var args []expr.Expr
 	for p.s.Token != token.RightParen && p.s.r > 0 {
+		if ellipsis {
+			p.error("can only use ... with final argument in list")
+		}
 		args = append(args, p.parseExpr())
+		if p.s.Token == token.Ellipsis {
+			ellipsis = true
+			p.next()
+		}
 		if !p.expectCommaOr(token.RightParen, "arguments") {
 			break
 		}
 		p.next()
 	}
-	p.expect(token.RightParen)
-	p.next()
-	return args
+	if p.expect(token.RightParen) {
+		p.next()
+	}
+	return args, ellipsis
 }
 
 func (p *Parser) parsePrimaryExpr() expr.Expr {
+	defer p.leave(p.enter("PrimaryExpr"))
 	x := p.parseOperand()
 	for {
 		switch p.s.Token {
@@ -243,32 +605,51 @@ func (p *Parser) parsePrimaryExpr() expr.Expr {
 			p.next()
 			switch p.s.Token {
 			case token.Ident:
+				right := p.parseIdent()
 				x = &expr.Selector{
+					Span:  p.span(x.Pos()),
 					Left:  x,
-					Right: p.parseIdent(),
+					Right: right,
 				}
 			case token.LeftParen:
-				panic("TODO parse type assertion")
+				p.next()
+				var t tipe.Type
+				if p.s.Token == token.Type {
+					// x.(type), only valid in a type switch
+					p.next()
+				} else {
+					t = p.parseType()
+				}
+				p.expect(token.RightParen)
+				p.next()
+				x = &expr.TypeAssert{Span: p.span(x.Pos()), Expr: x, Type: t}
 			default:
-				panic("TODO expect selector type assertion")
+				x = &expr.Bad{
+					Span:  p.span(x.Pos()),
+					Error: p.errorf("expected selector or type assertion, found %s", p.s.Token),
+				}
 			}
 		case token.LeftBracket:
 			x = p.parseIndex(x)
 		case token.LeftParen:
-			args := p.parseArgs()
-			x = &expr.Call{Func: x, Args: args}
+			args, ellipsis := p.parseArgs()
+			x = &expr.Call{Span: p.span(x.Pos()), Func: x, Args: args, Ellipsis: ellipsis}
 		case token.LeftBrace:
 			if tExpr, isType := x.(*expr.Type); isType {
+				pos := tExpr.Pos()
 				switch t := tExpr.Type.(type) {
 				case *tipe.Slice:
-					x = p.parseSliceLiteral(t)
+					x = p.parseSliceLiteral(pos, t)
+				case *tipe.Array:
+					x = p.parseArrayLiteral(pos, t)
 				case *tipe.Table:
-					x = p.parseTableLiteral(t)
+					x = p.parseTableLiteral(pos, t)
 				case *tipe.Map:
-					x = p.parseMapLiteral(t)
+					x = p.parseMapLiteral(pos, t)
 				default:
-					x = p.parseCompLiteral(t)
+					x = p.parseCompLiteral(pos, t)
 				}
+				continue // the literal may be indexed or selected
 			}
 
 			// The problem is that in expressions like
@@ -284,9 +665,10 @@ func (p *Parser) parsePrimaryExpr() expr.Expr {
 			}
 
 			if xpr, isIdent := x.(*expr.Ident); isIdent {
-				x = &expr.Type{Type: &tipe.Unresolved{Name: xpr.Name}}
+				t := &tipe.Unresolved{Span: tipe.Span(xpr.Span), Name: xpr.Name}
+				x = &expr.Type{Span: xpr.Span, Type: t}
 			} else if t := maybePackageType(x); t != nil {
-				x = &expr.Type{Type: t}
+				x = &expr.Type{Span: p.span(x.Pos()), Type: t}
 			} else {
 				return x // end of statement
 			}
@@ -308,12 +690,14 @@ func maybePackageType(x expr.Expr) *tipe.Unresolved {
 		return nil
 	}
 	return &tipe.Unresolved{
+		Span:    tipe.Span(sel.Span),
 		Package: ident.Name,
 		Name:    sel.Right.Name,
 	}
 }
 
 func (p *Parser) parseIndex(lhs expr.Expr) expr.Expr {
+	defer p.leave(p.enter("Index"))
 	p.expect(token.LeftBracket)
 	p.next()
 
@@ -329,15 +713,16 @@ func (p *Parser) parseIndex(lhs expr.Expr) expr.Expr {
 			p.next()
 		}
 
+		pos := p.pos()
 		if p.s.Token == token.Colon {
 			// [:expr]
 			p.next()
 			if p.s.Token == token.RightBracket || p.s.Token == token.Comma {
-				res.Indicies = append(res.Indicies, &expr.Slice{})
+				res.Indicies = append(res.Indicies, &expr.Slice{Span: p.span(pos)})
 				continue
 			}
 			high := p.parseExpr()
-			res.Indicies = append(res.Indicies, &expr.Slice{High: high})
+			res.Indicies = append(res.Indicies, &expr.Slice{Span: p.span(pos), High: high})
 			continue
 		}
 
@@ -351,13 +736,14 @@ func (p *Parser) parseIndex(lhs expr.Expr) expr.Expr {
 		p.next()
 		if p.s.Token == token.RightBracket || p.s.Token == token.Comma {
 			// [expr:]
-			res.Indicies = append(res.Indicies, &expr.Slice{Low: e})
+			res.Indicies = append(res.Indicies, &expr.Slice{Span: p.span(pos), Low: e})
 			continue
 		}
 		high := p.parseExpr()
 		if p.s.Token == token.RightBracket || p.s.Token == token.Comma {
 			// [expr:high]
 			res.Indicies = append(res.Indicies, &expr.Slice{
+				Span: p.span(pos),
 				Low:  e,
 				High: high,
 			})
@@ -368,6 +754,7 @@ func (p *Parser) parseIndex(lhs expr.Expr) expr.Expr {
 		max := p.parseExpr()
 		// [expr:high:max]
 		res.Indicies = append(res.Indicies, &expr.Slice{
+			Span: p.span(pos),
 			Low:  e,
 			High: high,
 			Max:  max,
@@ -376,6 +763,7 @@ func (p *Parser) parseIndex(lhs expr.Expr) expr.Expr {
 	}
 	p.expect(token.RightBracket)
 	p.next()
+	res.Span = p.span(lhs.Pos())
 	return res
 }
 
@@ -402,12 +790,26 @@ func (p *Parser) parseRange() (r expr.Range) {
 	return r
 }
 
-func (p *Parser) parseParam() (name string, t tipe.Type) {
+func (p *Parser) parseParam() (name string, t tipe.Type, variadic bool) {
 	// Scan what may be a type, or may be a parameter name.
-	first := p.maybeParseType()
+	var first tipe.Type
+	if p.s.Token != token.Ellipsis {
+		first = p.maybeParseType()
+	}
 	if n := typeAsName(first); n != "" && p.s.Token > 0 && p.s.Token != token.Comma && p.s.Token != token.RightParen {
 		// Looks like a type may follow. Treat first as a name.
 		name = n
+		first = nil
+	}
+	if first == nil && p.s.Token == token.Ellipsis {
+		// ...T, the final parameter of a variadic function
+		pos := p.pos()
+		p.next()
+		variadic = true
+		if elem := p.parseType(); elem != nil {
+			t = &tipe.Slice{Span: p.typeSpan(pos), Elem: elem}
+		}
+	} else if first == nil {
 		t = p.maybeParseType()
 	} else {
 		t = first
@@ -418,7 +820,7 @@ func (p *Parser) parseParam() (name string, t tipe.Type) {
 	} else if p.s.Token == token.Comma {
 		p.next()
 	}
-	return name, t
+	return name, t, variadic
 }
 
 func typeAsName(t tipe.Type) string {
@@ -428,13 +830,17 @@ func typeAsName(t tipe.Type) string {
 	return ""
 }
 
-func (p *Parser) parseParamTuple() (names []string, params *tipe.Tuple) {
+func (p *Parser) parseParamTuple() (names []string, params *tipe.Tuple, variadic bool) {
 	params = &tipe.Tuple{}
 	for p.s.Token > 0 && p.s.Token != token.RightParen {
-		name, t := p.parseParam()
+		name, t, isVariadic := p.parseParam()
 		if t == nil {
 			continue
 		}
+		if variadic {
+			p.error("can only use ... with final parameter in list")
+		}
+		variadic = isVariadic
 		names = append(names, name)
 		params.Elems = append(params.Elems, t)
 	}
@@ -451,13 +857,17 @@ func (p *Parser) parseParamTuple() (names []string, params *tipe.Tuple) {
 				names[i] = typeAsName(params.Elems[i])
 				if names[i] == "" {
 					p.error("function signature mixes named and unnamed arguments")
-					return nil, &tipe.Tuple{}
+					return nil, &tipe.Tuple{}, false
 				}
 				params.Elems[i] = nil
 			} else {
 				// Back-propagate types for named, typeless params.
 				t := params.Elems[i]
 				for j := i - 1; j >= 0 && params.Elems[j] == nil; j-- {
+					if variadic && i == len(names)-1 {
+						p.error("can only use ... with final parameter in list")
+						return nil, &tipe.Tuple{}, false
+					}
 					params.Elems[j] = t
 				}
 			}
@@ -465,18 +875,19 @@ func (p *Parser) parseParamTuple() (names []string, params *tipe.Tuple) {
 		for _, t := range params.Elems {
 			if t == nil {
 				p.error("function signature mixes named and unnamed arguments")
-				return nil, &tipe.Tuple{}
+				return nil, &tipe.Tuple{}, false
 			}
 		}
 	}
-	return names, params
+	return names, params, variadic
 }
 
-func (p *Parser) parseMethodik(name string) stmt.Stmt {
+func (p *Parser) parseMethodik(pos token.Pos, name string) *stmt.MethodikDecl {
 	c := &stmt.MethodikDecl{
 		Name: name,
-		Type: &tipe.Methodik{
+		Type: &tipe.Named{
 			// TODO Spec
+			Name: name,
 			Type: p.parseType(),
 		},
 	}
@@ -486,13 +897,16 @@ func (p *Parser) parseMethodik(name string) stmt.Stmt {
 	tags := make(map[string]bool)
 	for p.s.Token > 0 && p.s.Token != token.RightBrace {
 		p.expect(token.Func)
+		doc := p.leadComment
 		m := p.parseFunc(true)
+		m.Doc = doc
 		if tags[m.Name] {
 			p.errorf("func %s redeclared in methodik %s", m.Name, c.Name)
 		} else {
 			tags[m.Name] = true
 			c.Type.MethodNames = append(c.Type.MethodNames, m.Name)
 			c.Type.Methods = append(c.Type.Methods, m.Type)
+			c.Type.PointerReceivers = append(c.Type.PointerReceivers, m.PointerReceiver)
 			c.Methods = append(c.Methods, m)
 		}
 		if p.s.Token == token.Semicolon {
@@ -501,6 +915,7 @@ func (p *Parser) parseMethodik(name string) stmt.Stmt {
 	}
 	p.expect(token.RightBrace)
 	p.next()
+	c.Span = p.span(pos)
 
 	return c
 }
@@ -514,6 +929,8 @@ func (p *Parser) parseType() tipe.Type {
 }
 
 func (p *Parser) maybeParseType() tipe.Type {
+	defer p.leave(p.enter("Type"))
+	pos := p.pos()
 	switch p.s.Token {
 	case token.Ident:
 		ident := p.parseIdent()
@@ -521,6 +938,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 			p.next()
 			sel := p.parseIdent()
 			return &tipe.Unresolved{
+				Span:    p.typeSpan(pos),
 				Package: ident.Name,
 				Name:    sel.Name,
 			}
@@ -530,24 +948,69 @@ func (p *Parser) maybeParseType() tipe.Type {
 		if ident.Name == "num" {
 			return tipe.Num
 		}
-		return &tipe.Unresolved{Name: ident.Name}
+		return &tipe.Unresolved{Span: p.typeSpan(pos), Name: ident.Name}
 	case token.LeftBracket:
 		p.next()
+		if p.s.Token == token.Ellipsis {
+			p.next()
+			p.expect(token.RightBracket)
+			p.next()
+			t := &tipe.Array{Ellipsis: true, Elem: p.parseType()}
+			t.Span = p.typeSpan(pos)
+			return t
+		}
+		if p.s.Token != token.Pipe && p.s.Token != token.RightBracket {
+			x := p.parseExpr()
+			p.expect(token.RightBracket)
+			p.next()
+			if lit, ok := x.(*expr.BasicLiteral); ok {
+				if n, ok := lit.Value.(*big.Int); ok {
+					if !n.IsInt64() {
+						p.errorf("array length %s too large", n)
+					}
+					t := &tipe.Array{Len: n.Int64(), Elem: p.parseType()}
+					t.Span = p.typeSpan(pos)
+					return t
+				}
+			}
+			// A constant expression, folded by the typechecker.
+			t := &tipe.Array{LenExpr: x, Elem: p.parseType()}
+			t.Span = p.typeSpan(pos)
+			return t
+		}
 		table := false
+		var schema *tipe.TableSchema
 		if p.s.Token == token.Pipe {
 			table = true
 			p.next()
+			if p.s.Token == token.String {
+				schema = p.parseTableSchema()
+			}
 		}
 		p.expect(token.RightBracket)
 		p.next()
 		if table {
-			return &tipe.Table{Type: p.parseType()}
+			t := &tipe.Table{Type: p.parseType(), Schema: schema}
+			t.Span = p.typeSpan(pos)
+			return t
 		} else {
-			return &tipe.Slice{Elem: p.parseType()}
+			t := &tipe.Slice{Elem: p.parseType()}
+			t.Span = p.typeSpan(pos)
+			return t
 		}
 	case token.Mul:
 		p.next()
-		return &tipe.Pointer{Elem: p.parseType()}
+		t := &tipe.Pointer{Elem: p.parseType()}
+		t.Span = p.typeSpan(pos)
+		return t
+	case token.Pow:
+		// Two pointers, **T. The inner one starts after the first *.
+		p.next()
+		elem := p.parseType()
+		return &tipe.Pointer{
+			Span: p.typeSpan(pos),
+			Elem: &tipe.Pointer{Span: tipe.Span{From: pos + 1, To: p.end}, Elem: elem},
+		}
 	case token.Struct:
 		p.next()
 		p.expect(token.LeftBrace)
@@ -558,7 +1021,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 			n := p.parseIdent().Name
 			t := p.parseType()
 			if tags[n] {
-				p.errorf("field %s redeclared in struct %s", n, s)
+				p.errorf("field %s redeclared in struct", n) // s is partly parsed
 			} else {
 				tags[n] = true
 				s.FieldNames = append(s.FieldNames, n)
@@ -572,6 +1035,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 		}
 		p.expect(token.RightBrace)
 		p.next()
+		s.Span = p.typeSpan(pos)
 		return s
 	case token.Interface:
 		p.next()
@@ -590,10 +1054,12 @@ func (p *Parser) maybeParseType() tipe.Type {
 		}
 		p.expect(token.RightBrace)
 		p.next()
+		iface.Span = p.typeSpan(pos)
 		return iface
 	case token.Func:
 		p.next()
 		lit := p.parseFuncType(false)
+		lit.Type.Span = p.typeSpan(pos)
 		return lit.Type
 	case token.Map:
 		// map[T]U
@@ -605,6 +1071,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 		p.expect(token.RightBracket)
 		p.next()
 		s.Value = p.parseType()
+		s.Span = p.typeSpan(pos)
 		return s
 	case token.ChanOp:
 		// <-chan T, a read-only channel
@@ -615,6 +1082,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 			Direction: tipe.ChanRecv,
 			Elem:      p.parseType(),
 		}
+		s.Span = p.typeSpan(pos)
 		return s
 	case token.Chan:
 		// chan T, or chan<- T
@@ -627,6 +1095,7 @@ func (p *Parser) maybeParseType() tipe.Type {
 			s.Direction = tipe.ChanBoth
 		}
 		s.Elem = p.parseType()
+		s.Span = p.typeSpan(pos)
 		return s
 	case token.Semicolon, token.Comma, token.RightParen, token.LeftBrace:
 		// no type
@@ -659,29 +1128,48 @@ func arithAssignOp(t token.Token) token.Token {
 		return token.Rem
 	case token.PowAssign:
 		return token.Pow
+	case token.AndAssign:
+		return token.And
+	case token.OrAssign:
+		return token.Or
+	case token.XorAssign:
+		return token.Xor
+	case token.AndNotAssign:
+		return token.AndNot
+	case token.ShiftLeftAssign:
+		return token.ShiftLeft
+	case token.ShiftRightAssign:
+		return token.ShiftRight
 	default:
 		return token.Unknown
 	}
 }
 
 func (p *Parser) parseSimpleStmt() stmt.Stmt {
+	defer p.leave(p.enter("SimpleStmt"))
+	pos := p.pos()
 	exprs := p.parseExprs()
 
 	switch p.s.Token {
 	case token.Define, token.Assign, token.AddAssign, token.SubAssign,
-		token.MulAssign, token.DivAssign, token.RemAssign, token.PowAssign:
+		token.MulAssign, token.DivAssign, token.RemAssign, token.PowAssign,
+		token.AndAssign, token.OrAssign, token.XorAssign, token.AndNotAssign,
+		token.ShiftLeftAssign, token.ShiftRightAssign:
 		tok := p.s.Token
 
 		p.next()
 		var right []expr.Expr
 		if p.s.Token == token.Range {
+			rangePos := p.pos()
 			p.next()
 			if tok != token.Define && tok != token.Assign {
-				right = []expr.Expr{&expr.Bad{p.error("range can only be used inside ':=' or '='")}}
+				right = []expr.Expr{&expr.Bad{Span: p.span(rangePos), Error: p.error("range can only be used inside ':=' or '='")}}
 			} else {
+				x := p.parseExpr()
 				right = []expr.Expr{&expr.Unary{
+					Span: p.span(rangePos),
 					Op:   token.Range,
-					Expr: p.parseExpr(),
+					Expr: x,
 				}}
 			}
 		} else {
@@ -690,15 +1178,16 @@ func (p *Parser) parseSimpleStmt() stmt.Stmt {
 		if tok == token.Define {
 			for i, e := range exprs {
 				if _, ok := e.(*expr.Ident); !ok {
-					exprs[i] = &expr.Bad{p.error("expected identifier as declaration")}
+					exprs[i] = &expr.Bad{Span: expr.Span{From: e.Pos(), To: e.End()}, Error: p.error("expected identifier as declaration")}
 				}
 			}
 		}
 		if arithOp := arithAssignOp(tok); arithOp != token.Unknown {
 			if len(exprs) != 1 || len(right) != 1 {
-				right = []expr.Expr{&expr.Bad{p.error(fmt.Sprintf("arithmetic assignement %q only accepts one argument", tok))}}
+				right = []expr.Expr{&expr.Bad{Span: p.span(pos), Error: p.error(fmt.Sprintf("arithmetic assignement %q only accepts one argument", tok))}}
 			} else {
 				right[0] = &expr.Binary{
+					Span:  p.span(pos),
 					Op:    arithOp,
 					Left:  exprs[0],
 					Right: right[0],
@@ -713,6 +1202,7 @@ func (p *Parser) parseSimpleStmt() stmt.Stmt {
 			}
 		}
 		return &stmt.Assign{
+			Span:  p.span(pos),
 			Decl:  tok == token.Define,
 			Left:  exprs,
 			Right: right,
@@ -730,46 +1220,56 @@ func (p *Parser) parseSimpleStmt() stmt.Stmt {
 		if p.s.Token == token.Dec {
 			op = token.Sub
 		}
+		opPos := p.pos()
 		p.next()
 		return &stmt.Assign{
+			Span: p.span(pos),
 			Left: []expr.Expr{exprs[0]},
 			Right: []expr.Expr{&expr.Binary{
+				Span:  p.span(pos),
 				Op:    op,
 				Left:  exprs[0],
-				Right: &expr.BasicLiteral{big.NewInt(1)},
+				Right: &expr.BasicLiteral{Span: p.span(opPos), Value: big.NewInt(1)},
 			}},
 		}
 	case token.ChanOp:
 		p.next()
+		value := p.parseExpr()
 		return &stmt.Send{
+			Span:  p.span(pos),
 			Chan:  exprs[0],
-			Value: p.parseExpr(),
+			Value: value,
 		}
 	case token.Colon:
+		if p.noLabel {
+			break
+		}
 		p.next()
 		// TODO: we can be stricter here, sometimes it is invalid to declare a label.
 		if lhs, isIdent := exprs[0].(*expr.Ident); isIdent {
+			body := p.parseStmt()
 			return &stmt.Labeled{
+				Span:  expr.Span{From: pos, To: body.End()},
 				Label: lhs.Name,
-				Stmt:  p.parseStmt(),
+				Stmt:  body,
 			}
 		}
 		p.error("bad label declaration")
-		return &stmt.Bad{}
+		return &stmt.Bad{Span: p.span(pos)}
 	}
 
 	// TODO len==1
 	if e, isShell := exprs[0].(*expr.Shell); isShell {
 		e.TrapOut = false
 	}
-	return &stmt.Simple{exprs[0]}
+	return &stmt.Simple{Span: p.span(pos), Expr: exprs[0]}
 }
 
 func (p *Parser) extractExpr(s stmt.Stmt) expr.Expr {
 	if e, isExpr := s.(*stmt.Simple); isExpr {
 		return e.Expr
 	}
-	return &expr.Bad{p.error("expected boolean expression, found statement")}
+	return &expr.Bad{Span: expr.Span{From: s.Pos(), To: s.End()}, Error: p.error("expected boolean expression, found statement")}
 }
 
 func extractRange(s stmt.Stmt) (res *stmt.Range) {
@@ -789,10 +1289,14 @@ func extractRange(s stmt.Stmt) (res *stmt.Range) {
 	if len(a.Left) == 2 {
 		val = a.Left[1]
 	}
-	return &stmt.Range{Decl: a.Decl, Key: key, Val: val, Expr: r.Expr}
+	return &stmt.Range{Span: a.Span, Decl: a.Decl, Key: key, Val: val, Expr: r.Expr}
 }
 
 func (p *Parser) parseStmt() stmt.Stmt {
+	defer p.leave(p.enter("Stmt"))
+	pos := p.pos()
+	p.stmtPos = pos
+	doc := p.leadComment
 	switch p.s.Token {
 	// TODO: many many kinds of statements
 	case token.If:
@@ -819,19 +1323,30 @@ func (p *Parser) parseStmt() stmt.Stmt {
 		if p.s.Token == token.Else {
 			p.next()
 			s.Else = p.parseStmt()
+			s.Span = expr.Span{From: pos, To: s.Else.End()}
 		} else {
+			s.Span = p.span(pos)
 			p.expectSemi()
 		}
 		return s
-	case token.Ident, token.Int, token.Float, token.Add, token.Sub, token.Mul, token.ChanOp, token.Map,
+	case token.Ident, token.Int, token.Float, token.Imaginary, token.Add, token.Sub, token.Mul, token.Pow, token.Xor, token.ChanOp, token.Map,
 		token.Func, token.LeftBracket, token.LeftParen, token.String, token.Rune, token.Shell:
 		// A "simple" statement, no control flow.
 		s := p.parseSimpleStmt()
+		if s, ok := s.(*stmt.Simple); ok {
+			if f, ok := s.Expr.(*expr.FuncLiteral); ok && f.Name != "" {
+				f.Doc = doc
+			}
+		}
 		p.expectSemi()
 		return s
 	case token.Return:
 		p.next()
-		s := &stmt.Return{Exprs: p.parseExprs()}
+		s := &stmt.Return{}
+		if p.s.Token != token.Semicolon && p.s.Token != token.RightBrace {
+			s.Exprs = p.parseExprs()
+		}
+		s.Span = p.span(pos)
 		p.expectSemi()
 		return s
 	case token.LeftBrace:
@@ -842,41 +1357,94 @@ func (p *Parser) parseStmt() stmt.Stmt {
 		s := p.parseFor()
 		p.expectSemi()
 		return s
+	case token.Switch:
+		s := p.parseSwitch()
+		p.expectSemi()
+		return s
+	case token.Select:
+		s := p.parseSelect()
+		p.expectSemi()
+		return s
 	case token.Go:
 		s := p.parseGo()
 		p.expectSemi()
 		return s
+	case token.Defer:
+		s := p.parseDefer()
+		p.expectSemi()
+		return s
 	case token.Const:
 		p.next()
-		s := &stmt.Const{
-			Name: p.parseIdent().Name,
-		}
-		if p.s.Token != token.Assign {
-			s.Type = p.parseType()
+		if p.s.Token == token.LeftParen {
+			p.next()
+			s := &stmt.ConstSet{Doc: doc}
+			var prev *stmt.Const
+			for p.s.Token > 0 && p.s.Token != token.RightParen {
+				c := p.parseConst(prev)
+				s.Consts = append(s.Consts, c)
+				prev = c
+				if p.s.Token == token.Semicolon {
+					p.next()
+				}
+			}
+			p.expect(token.RightParen)
+			p.next()
+			s.Span = p.span(pos)
+			p.expectSemi()
+			return s
 		}
-		p.expect(token.Assign)
+		s := p.parseConst(nil)
+		s.From = pos
+		s.Doc = doc
+		p.expectSemi()
+		return s
+	case token.Var:
 		p.next()
-		s.Value = p.parseExpr()
+		if p.s.Token == token.LeftParen {
+			p.next()
+			s := &stmt.VarSet{Doc: doc}
+			for p.s.Token > 0 && p.s.Token != token.RightParen {
+				s.Vars = append(s.Vars, p.parseVar())
+				if p.s.Token == token.Semicolon {
+					p.next()
+				}
+			}
+			p.expect(token.RightParen)
+			p.next()
+			s.Span = p.span(pos)
+			p.expectSemi()
+			return s
+		}
+		s := p.parseVar()
+		s.From = pos
+		s.Doc = doc
 		p.expectSemi()
 		return s
 	case token.Methodik:
 		p.next()
-		m := p.parseMethodik(p.parseIdent().Name)
+		m := p.parseMethodik(pos, p.parseIdent().Name)
+		m.Doc = doc
 		p.expectSemi()
 		return m
 	case token.Type:
 		p.next()
 		s := &stmt.TypeDecl{
+			Doc:  doc,
 			Name: p.parseIdent().Name,
-			Type: p.parseType(),
 		}
+		if p.s.Token == token.Assign {
+			s.Alias = true
+			p.next()
+		}
+		s.Type = p.parseType()
+		s.Span = p.span(pos)
 		p.expectSemi()
 		return s
 	case token.Import:
 		p.next()
 		if p.s.Token == token.LeftParen {
 			p.next()
-			s := &stmt.ImportSet{}
+			s := &stmt.ImportSet{Doc: doc}
 			for p.s.Token > 0 && p.s.Token != token.RightParen {
 				s.Imports = append(s.Imports, p.parseImport())
 				if p.s.Token == token.Semicolon {
@@ -885,41 +1453,166 @@ func (p *Parser) parseStmt() stmt.Stmt {
 			}
 			p.expect(token.RightParen)
 			p.next()
+			s.Span = p.span(pos)
 			p.expectSemi()
 			return s
 		}
 		s := p.parseImport()
+		s.From = pos
+		s.Doc = doc
 		p.expectSemi()
 		return s
 	case token.Continue, token.Break, token.Goto, token.Fallthrough:
+		if p.s.Token == token.Fallthrough && !p.inCase {
+			p.error("fallthrough statement out of place")
+		}
 		s := p.parseBranch()
 		p.expectSemi()
 		return s
 	}
-	panic(fmt.Sprintf("TODO parseStmt %s", p.s.Token))
+	p.errorf("expected statement, found %s", p.s.Token)
+	p.syncStmt()
+	if p.end < pos {
+		// Nothing was skipped.
+		return &stmt.Bad{Span: expr.Span{From: pos, To: pos}}
+	}
+	return &stmt.Bad{Span: p.span(pos)}
+}
+
+// parseTopStmt parses a top-level statement. If the statement
+// nests too deeply, the parser abandons it and skips the rest.
+func (p *Parser) parseTopStmt() (s stmt.Stmt) {
+	pos := p.pos()
+	defer func() {
+		if x := recover(); x != nil {
+			if _, ok := x.(tooDeep); !ok {
+				panic(x)
+			}
+			p.depth = 0
+			p.noCompLit, p.noLabel, p.inColNames, p.inCase = false, false, false, false
+			p.syncStmt()
+			s = &stmt.Bad{Span: p.span(pos)}
+		}
+	}()
+	return p.parseRecover()
+}
+
+// parseRecover parses a statement. If the statement has errors,
+// the rest of it is skipped so that parsing resumes at the next
+// statement, and every mistake in a file is reported separately
+// instead of the first one causing a cascade. A statement with
+// errors is returned as a *stmt.Bad, as what was parsed of it may
+// be incomplete in ways later passes cannot handle.
+func (p *Parser) parseRecover() stmt.Stmt {
+	pos := p.pos()
+	nerrs := p.nerrs
+	s := p.parseStmt()
+	if p.nerrs > nerrs {
+		p.syncStmt()
+		if p.end < pos {
+			return &stmt.Bad{Span: expr.Span{From: pos, To: pos}}
+		}
+		return &stmt.Bad{Span: p.span(pos)}
+	}
+	return s
+}
+
+// syncStmt skips tokens up to the end of the current statement:
+// a semicolon, which includes the end of a line, or the closing
+// brace or case clause of the enclosing block. Blocks opened by
+// the skipped tokens are skipped whole.
+func (p *Parser) syncStmt() {
+	depth := 0
+	for {
+		switch p.s.Token {
+		case token.Unknown:
+			return
+		case token.Semicolon, token.Case, token.Default:
+			if depth == 0 {
+				return
+			}
+		case token.LeftBrace:
+			depth++
+		case token.RightBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+		p.next()
+	}
+}
+
+// parseConst parses a constant specification. Inside a const group
+// prev is the preceding specification, whose type and value are
+// repeated if this specification has none.
+func (p *Parser) parseConst(prev *stmt.Const) *stmt.Const {
+	pos := p.pos()
+	s := &stmt.Const{
+		Doc:  p.leadComment,
+		Name: p.parseIdent().Name,
+	}
+	if prev != nil && (p.s.Token == token.Semicolon || p.s.Token == token.RightParen) {
+		s.Type = prev.Type
+		s.Value = prev.Value
+		s.Span = p.span(pos)
+		return s
+	}
+	if p.s.Token != token.Assign {
+		s.Type = p.parseType()
+	}
+	p.expect(token.Assign)
+	p.next()
+	s.Value = p.parseExpr()
+	s.Span = p.span(pos)
+	return s
+}
+
+func (p *Parser) parseVar() *stmt.Var {
+	pos := p.pos()
+	s := &stmt.Var{Doc: p.leadComment}
+	s.NameList = append(s.NameList, p.parseIdent().Name)
+	for p.s.Token == token.Comma {
+		p.next()
+		s.NameList = append(s.NameList, p.parseIdent().Name)
+	}
+	if p.s.Token != token.Assign {
+		s.Type = p.maybeParseType()
+	}
+	if p.s.Token == token.Assign {
+		p.next()
+		s.Values = p.parseExprs()
+	} else if s.Type == nil {
+		p.error("missing variable type or initialization")
+	}
+	s.Span = p.span(pos)
+	return s
 }
 
 func (p *Parser) parseImport() (s *stmt.Import) {
+	pos := p.pos()
+	doc := p.leadComment
 	name := ""
 	if p.s.Token == token.Ident {
 		name = p.s.Literal.(string)
-		name = name[1 : len(name)-1]
 		p.next()
 	}
 	if !p.expect(token.String) {
 		p.next()
-		return &stmt.Import{}
+		return &stmt.Import{Span: p.span(pos)}
 	}
-	path := p.s.Literal.(string)
 	s = &stmt.Import{
+		Doc:  doc,
 		Name: name,
-		Path: path[1 : len(path)-1],
+		Path: p.s.Literal.(string),
 	}
 	p.next()
+	s.Span = p.span(pos)
 	return s
 }
 
 func (p *Parser) parseBranch() *stmt.Branch {
+	pos := p.pos()
 	s := &stmt.Branch{
 		Type: p.s.Token,
 	}
@@ -928,22 +1621,252 @@ func (p *Parser) parseBranch() *stmt.Branch {
 		s.Label = p.s.Literal.(string)
 		p.next()
 	}
+	s.Span = p.span(pos)
 	return s
 }
 
 func (p *Parser) parseGo() stmt.Stmt {
+	pos := p.pos()
 	p.expect(token.Go)
 	p.next()
+	call := p.parseCallStmt("go")
+	if call == nil {
+		return &stmt.Bad{Span: p.span(pos)}
+	}
+	return &stmt.Go{Span: p.span(pos), Call: call}
+}
+
+func (p *Parser) parseDefer() stmt.Stmt {
+	pos := p.pos()
+	p.expect(token.Defer)
+	p.next()
+	call := p.parseCallStmt("defer")
+	if call == nil {
+		return &stmt.Bad{Span: p.span(pos)}
+	}
+	return &stmt.Defer{Span: p.span(pos), Call: call}
+}
+
+// parseCallStmt parses the function call following a go or
+// defer keyword. It reports an error and returns nil if the
+// expression is not a call.
+func (p *Parser) parseCallStmt(keyword string) *expr.Call {
 	e := p.parsePrimaryExpr()
+	if u, ok := e.(*expr.Unary); ok && u.Op == token.LeftParen {
+		p.errorf("expression in %s must not be parenthesized", keyword)
+		return nil
+	}
 	call, ok := e.(*expr.Call)
 	if !ok {
-		p.errorf("go statement must invoke function")
+		p.errorf("expression in %s must be function call", keyword)
 		return nil
 	}
-	return &stmt.Go{Call: call}
+	return call
+}
+
+func (p *Parser) parseSwitch() stmt.Stmt {
+	pos := p.pos()
+	p.expect(token.Switch)
+	p.next()
+
+	var init, guard stmt.Stmt
+	p.noCompLit = true
+	if p.s.Token != token.LeftBrace {
+		if p.s.Token == token.Semicolon {
+			// switch ; x { }
+			p.next()
+		} else {
+			guard = p.parseSimpleStmt()
+			if p.s.Token == token.Semicolon {
+				// switch x := f(); x { }
+				p.next()
+				init, guard = guard, nil
+			}
+		}
+		if guard == nil && p.s.Token != token.LeftBrace {
+			guard = p.parseSimpleStmt()
+		}
+	}
+	p.noCompLit = false
+
+	if isTypeSwitchGuard(guard) {
+		cases := p.parseTypeSwitchCases()
+		return &stmt.TypeSwitch{
+			Span:   p.span(pos),
+			Init:   init,
+			Assign: guard,
+			Cases:  cases,
+		}
+	}
+	s := &stmt.Switch{Init: init}
+	if guard != nil {
+		s.Cond = p.extractExpr(guard)
+	}
+	s.Cases = p.parseSwitchCases()
+	s.Span = p.span(pos)
+	return s
+}
+
+// isTypeSwitchGuard reports whether s is of the form
+//
+//	x.(type)
+//	v := x.(type)
+func isTypeSwitchGuard(s stmt.Stmt) bool {
+	var e expr.Expr
+	switch s := s.(type) {
+	case *stmt.Simple:
+		e = s.Expr
+	case *stmt.Assign:
+		if !s.Decl || len(s.Left) != 1 || len(s.Right) != 1 {
+			return false
+		}
+		e = s.Right[0]
+	default:
+		return false
+	}
+	ta, ok := e.(*expr.TypeAssert)
+	return ok && ta.Type == nil
+}
+
+// parseCaseClause parses the "case ...:" or "default:" introduction
+// to a switch clause. It reports false if no clause was found.
+func (p *Parser) parseCaseClause(seenDefault *bool, parseCase func()) (isDefault, ok bool) {
+	switch p.s.Token {
+	case token.Case:
+		p.next()
+		parseCase()
+	case token.Default:
+		p.next()
+		if *seenDefault {
+			p.error("multiple defaults in switch")
+		}
+		*seenDefault = true
+		isDefault = true
+	default:
+		p.errorExpected(fmt.Sprintf("expected 'case' or 'default', found %s", p.s.Token), token.Case, token.Default)
+		p.next() // make progress
+		return false, false
+	}
+	p.expect(token.Colon)
+	p.next()
+	return isDefault, true
+}
+
+func (p *Parser) parseSwitchCases() (cases []stmt.SwitchCase) {
+	p.expect(token.LeftBrace)
+	p.next()
+	seenDefault := false
+	for p.s.Token > 0 && p.s.Token != token.RightBrace {
+		pos := p.pos()
+		c := stmt.SwitchCase{}
+		isDefault, ok := p.parseCaseClause(&seenDefault, func() {
+			c.Conds = p.parseExprs()
+		})
+		if !ok {
+			continue
+		}
+		c.Default = isDefault
+		bodyPos := p.end
+		c.Body = &stmt.Block{Stmts: p.parseStmtList(true)}
+		c.Body.Span = p.span(bodyPos)
+		c.Span = p.span(pos)
+		cases = append(cases, c)
+	}
+	p.expect(token.RightBrace)
+	p.next()
+	return cases
+}
+
+func (p *Parser) parseTypeSwitchCases() (cases []stmt.TypeSwitchCase) {
+	p.expect(token.LeftBrace)
+	p.next()
+	seenDefault := false
+	for p.s.Token > 0 && p.s.Token != token.RightBrace {
+		pos := p.pos()
+		c := stmt.TypeSwitchCase{}
+		isDefault, ok := p.parseCaseClause(&seenDefault, func() {
+			c.Types = append(c.Types, p.parseType())
+			for p.s.Token == token.Comma {
+				p.next()
+				c.Types = append(c.Types, p.parseType())
+			}
+		})
+		if !ok {
+			continue
+		}
+		c.Default = isDefault
+		bodyPos := p.end
+		c.Body = &stmt.Block{Stmts: p.parseStmts()}
+		c.Body.Span = p.span(bodyPos)
+		c.Span = p.span(pos)
+		cases = append(cases, c)
+	}
+	p.expect(token.RightBrace)
+	p.next()
+	return cases
+}
+
+func (p *Parser) parseSelect() stmt.Stmt {
+	pos := p.pos()
+	p.expect(token.Select)
+	p.next()
+	p.expect(token.LeftBrace)
+	p.next()
+	s := &stmt.Select{}
+	seenDefault := false
+	for p.s.Token > 0 && p.s.Token != token.RightBrace {
+		pos := p.pos()
+		c := stmt.SelectCase{}
+		isDefault, ok := p.parseCaseClause(&seenDefault, func() {
+			p.noLabel = true
+			c.Comm = p.parseSimpleStmt()
+			p.noLabel = false
+			if !isCommClause(c.Comm) {
+				p.error("select case must be receive, send or assign recv")
+			}
+		})
+		if !ok {
+			continue
+		}
+		c.Default = isDefault
+		bodyPos := p.end
+		c.Body = &stmt.Block{Stmts: p.parseStmts()}
+		c.Body.Span = p.span(bodyPos)
+		c.Span = p.span(pos)
+		s.Cases = append(s.Cases, c)
+	}
+	p.expect(token.RightBrace)
+	p.next()
+	s.Span = p.span(pos)
+	return s
+}
+
+// isCommClause reports whether s is one of
+//
+//	ch <- x
+//	<-ch
+//	v, ok := <-ch
+func isCommClause(s stmt.Stmt) bool {
+	var e expr.Expr
+	switch s := s.(type) {
+	case *stmt.Send:
+		return true
+	case *stmt.Simple:
+		e = s.Expr
+	case *stmt.Assign:
+		if len(s.Left) > 2 || len(s.Right) != 1 {
+			return false
+		}
+		e = s.Right[0]
+	default:
+		return false
+	}
+	u, ok := e.(*expr.Unary)
+	return ok && u.Op == token.ChanOp
 }
 
 func (p *Parser) parseFor() stmt.Stmt {
+	pos := p.pos()
 	p.expect(token.For)
 	p.next()
 
@@ -957,12 +1880,12 @@ func (p *Parser) parseFor() stmt.Stmt {
 
 	if p.s.Token == token.LeftBrace {
 		// for {}
-		return &stmt.For{Body: body()}
+		return &stmt.For{Body: body(), Span: p.span(pos)}
 	}
 	if p.s.Token == token.Range {
 		// for range r { }
 		p.next()
-		return &stmt.Range{Expr: p.parseExpr(), Body: body()}
+		return &stmt.Range{Expr: p.parseExpr(), Body: body(), Span: p.span(pos)}
 	}
 	if p.s.Token == token.Semicolon {
 		p.next()
@@ -970,20 +1893,24 @@ func (p *Parser) parseFor() stmt.Stmt {
 			p.next()
 			if p.s.Token == token.LeftBrace {
 				// for ;; { }
-				return &stmt.For{Body: body()}
+				return &stmt.For{Body: body(), Span: p.span(pos)}
 			}
 			// for ;;i2 { }
 			i2 := p.parseSimpleStmt()
-			return &stmt.For{Post: i2, Body: body()}
+			return &stmt.For{Post: i2, Body: body(), Span: p.span(pos)}
 		}
 		i1 := p.parseSimpleStmt()
-		if p.s.Token == token.Semicolon {
+		if !p.expect(token.Semicolon) {
+			return &stmt.Bad{Span: p.span(pos)}
+		}
+		p.next()
+		if p.s.Token == token.LeftBrace {
 			// for ;i1; { }
-			p.next()
-			return &stmt.For{Cond: p.extractExpr(i1), Body: body()}
+			return &stmt.For{Cond: p.extractExpr(i1), Body: body(), Span: p.span(pos)}
 		}
 		// for ;i1;i2 { }
-		panic("TODO parseFor 'for ;'") // TODO
+		i2 := p.parseSimpleStmt()
+		return &stmt.For{Cond: p.extractExpr(i1), Post: i2, Body: body(), Span: p.span(pos)}
 	} else {
 		i0 := p.parseSimpleStmt()
 		if p.s.Token == token.LeftBrace {
@@ -991,24 +1918,25 @@ func (p *Parser) parseFor() stmt.Stmt {
 				// for k := range r { }
 				// for k, _ := range r { }
 				r.Body = body()
+				r.Span = p.span(pos)
 				return r
 			} else {
 				// for i0 {}
-				return &stmt.For{Cond: p.extractExpr(i0), Body: body()}
+				return &stmt.For{Cond: p.extractExpr(i0), Body: body(), Span: p.span(pos)}
 			}
 		}
 		p.expectSemi()
 		p.next()
 		if p.s.Token == token.Semicolon {
 			// for i0;; {}
-			return &stmt.For{Init: i0, Body: body()}
+			return &stmt.For{Init: i0, Body: body(), Span: p.span(pos)}
 		}
 		i1 := p.parseSimpleStmt()
 		p.expectSemi()
 		p.next()
 		if p.s.Token == token.LeftBrace {
 			// for i0;i1; { }
-			return &stmt.For{Init: i0, Cond: p.extractExpr(i1), Body: body()}
+			return &stmt.For{Init: i0, Cond: p.extractExpr(i1), Body: body(), Span: p.span(pos)}
 		}
 		i2 := p.parseSimpleStmt()
 		p.expect(token.LeftBrace)
@@ -1018,6 +1946,7 @@ func (p *Parser) parseFor() stmt.Stmt {
 			Cond: p.extractExpr(i1),
 			Post: i2,
 			Body: body(),
+			Span: p.span(pos),
 		}
 	}
 
@@ -1026,21 +1955,47 @@ func (p *Parser) parseFor() stmt.Stmt {
 }
 
 func (p *Parser) parseBlock() stmt.Stmt {
+	defer p.leave(p.enter("Block"))
+	pos := p.pos()
 	p.expect(token.LeftBrace)
 	p.next()
 	s := &stmt.Block{Stmts: p.parseStmts()}
 	p.expect(token.RightBrace)
 	p.next()
+	s.Span = p.span(pos)
 	return s
 }
 
 func (p *Parser) parseStmts() (stmts []stmt.Stmt) {
+	return p.parseStmtList(false)
+}
+
+// parseStmtList parses a list of statements. If inCase is set, the
+// list is the body of an expression switch case and may end with a
+// fallthrough statement.
+func (p *Parser) parseStmtList(inCase bool) (stmts []stmt.Stmt) {
+	outerInCase := p.inCase
+	p.inCase = inCase
+	defer func() { p.inCase = outerInCase }()
+
 	// TODO there are other kinds of blocks to exit from
-	for p.s.Token > 0 && p.s.Token != token.RightBrace {
-		stmts = append(stmts, p.parseStmt())
+	for p.s.Token > 0 && p.s.Token != token.RightBrace &&
+		p.s.Token != token.Case && p.s.Token != token.Default {
+		pos := p.pos()
+		s := p.parseRecover()
+		stmts = append(stmts, s)
 		if p.s.Token == token.Semicolon {
 			p.next()
 		}
+		if b, ok := s.(*stmt.Branch); ok && b.Type == token.Fallthrough && inCase {
+			switch p.s.Token {
+			case token.Case, token.Default:
+			case token.RightBrace:
+				p.errorAt(pos, token.Fallthrough, "cannot fallthrough final case in switch")
+			default:
+				p.errorAt(pos, token.Fallthrough, "fallthrough statement out of place")
+			}
+		}
 	}
 	return stmts
 }
@@ -1048,6 +2003,7 @@ func (p *Parser) parseStmts() (stmts []stmt.Stmt) {
 // parseFuncType just parses the top of the func (the part woven
 // into the type declaration), not the body.
 func (p *Parser) parseFuncType(method bool) *expr.FuncLiteral {
+	pos := p.pos()
 	f := &expr.FuncLiteral{
 		Type: &tipe.Func{},
 	}
@@ -1072,63 +2028,85 @@ func (p *Parser) parseFuncType(method bool) *expr.FuncLiteral {
 	}
 
 	p.expect(token.LeftParen)
+	paramsPos := p.pos()
 	p.next()
 	if p.s.Token != token.RightParen {
-		f.ParamNames, f.Type.Params = p.parseParamTuple()
+		f.ParamNames, f.Type.Params, f.Type.Variadic = p.parseParamTuple()
 	} else {
 		f.Type.Params = new(tipe.Tuple)
 	}
 	p.expect(token.RightParen)
 	p.next()
+	f.Type.Params.Span = p.typeSpan(paramsPos)
 
 	if p.s.Token == token.LeftParen {
 		p.expect(token.LeftParen)
+		resultsPos := p.pos()
 		p.next()
 		if p.s.Token != token.RightParen {
-			f.ResultNames, f.Type.Results = p.parseParamTuple()
+			var variadic bool
+			f.ResultNames, f.Type.Results, variadic = p.parseParamTuple()
+			if variadic {
+				p.error("cannot use ... in result list")
+			}
 		}
 		p.expect(token.RightParen)
 		p.next()
+		if f.Type.Results != nil {
+			f.Type.Results.Span = p.typeSpan(resultsPos)
+		}
 	} else {
+		resultsPos := p.pos()
 		typ := p.maybeParseType()
 		if typ != nil {
 			f.ResultNames = []string{""}
-			f.Type.Results = &tipe.Tuple{Elems: []tipe.Type{typ}}
+			f.Type.Results = &tipe.Tuple{Span: p.typeSpan(resultsPos), Elems: []tipe.Type{typ}}
 		}
 	}
+	f.Type.Span = p.typeSpan(pos)
+	f.Span = p.span(pos)
 	return f
 }
 
 func (p *Parser) parseFunc(method bool) *expr.FuncLiteral {
+	defer p.leave(p.enter("Func"))
+	pos := p.pos()
 	p.expect(token.Func)
 	p.next()
 	f := p.parseFuncType(method)
+	f.Type.Span.From = pos // the signature starts at func
 	if p.s.Token != token.LeftBrace {
 		p.next()
 		p.errorf("missing function body")
+		f.Span = p.span(pos)
 		return f
 	}
 	f.Body = p.parseBlock()
+	f.Span = p.span(pos)
 	return f
 }
 
 func (p *Parser) parseOperand() expr.Expr {
+	defer p.leave(p.enter("Operand"))
+	pos := p.pos()
 	switch p.s.Token {
 	case token.Ident:
+		if err := p.s.err; err != nil {
+			p.s.err = nil
+			p.next()
+			return &expr.Bad{Span: p.span(pos), Error: p.error(err.Error())}
+		}
 		x := p.parseIdent()
 		return x
-	case token.Int, token.Float, token.Imaginary:
-		x := &expr.BasicLiteral{Value: p.s.Literal}
-		p.next()
-		return x
-	case token.Rune:
+	case token.Int, token.Float, token.Imaginary, token.Rune, token.String:
+		if err := p.s.err; err != nil {
+			p.s.err = nil
+			p.next()
+			return &expr.Bad{Span: p.span(pos), Error: p.error(err.Error())}
+		}
 		x := &expr.BasicLiteral{Value: p.s.Literal}
 		p.next()
-		return x
-	case token.String:
-		s, _ := strconv.Unquote(p.s.Literal.(string))
-		x := &expr.BasicLiteral{Value: s}
-		p.next()
+		x.Span = p.span(pos)
 		return x
 	case token.LeftParen:
 		origNoCompLit := p.noCompLit
@@ -1138,7 +2116,7 @@ func (p *Parser) parseOperand() expr.Expr {
 		p.expect(token.RightParen)
 		p.next()
 		p.noCompLit = origNoCompLit
-		return &expr.Unary{Op: token.LeftParen, Expr: ex}
+		return &expr.Unary{Span: p.span(pos), Op: token.LeftParen, Expr: ex}
 	case token.Func:
 		return p.parseFunc(false)
 	case token.Shell:
@@ -1151,22 +2129,34 @@ func (p *Parser) parseOperand() expr.Expr {
 			p.interactive = false
 			cmd := p.parseShellList()
 			p.interactive = restore
+			if cmd == nil {
+				if p.s.Token != token.ShellNewline {
+					p.errorf("expected shell command, found %s", p.s.Token)
+				}
+				p.next()
+				continue
+			}
 			x.Cmds = append(x.Cmds, cmd)
 		}
 		p.expect(token.Shell)
 		p.next()
+		x.Span = p.span(pos)
+		if p.mode&NoShell != 0 {
+			return &expr.Bad{Span: x.Span, Error: p.errorAt(pos, token.Shell, "shell expressions are not enabled")}
+		}
 		return x
 	}
 
 	if t := p.maybeParseType(); t != nil {
-		return &expr.Type{Type: t}
+		return &expr.Type{Span: p.span(pos), Type: t}
 	}
 
 	p.next()
-	return &expr.Bad{p.errorf("expected operand, got %s", p.s.Token)}
+	return &expr.Bad{Span: p.span(pos), Error: p.errorf("expected operand, got %s", p.s.Token)}
 }
 
-func (p *Parser) parseSliceLiteral(t tipe.Type) *expr.SliceLiteral {
+func (p *Parser) parseSliceLiteral(pos token.Pos, t tipe.Type) *expr.SliceLiteral {
+	defer p.leave(p.enter("SliceLiteral"))
 	x := &expr.SliceLiteral{Type: t.(*tipe.Slice)}
 	p.next()
 	for p.s.Token > 0 && p.s.Token != token.RightBrace {
@@ -1179,10 +2169,54 @@ func (p *Parser) parseSliceLiteral(t tipe.Type) *expr.SliceLiteral {
 	}
 	p.expect(token.RightBrace)
 	p.next()
+	x.Span = p.span(pos)
+	return x
+}
+
+func (p *Parser) parseArrayLiteral(pos token.Pos, t *tipe.Array) *expr.ArrayLiteral {
+	defer p.leave(p.enter("ArrayLiteral"))
+	x := &expr.ArrayLiteral{Type: t}
+	p.next()
+	for p.s.Token > 0 && p.s.Token != token.RightBrace {
+		e := p.parseExpr()
+		x.Elems = append(x.Elems, e)
+		if p.s.Token != token.Comma {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.RightBrace)
+	p.next()
+	x.Span = p.span(pos)
 	return x
 }
 
-func (p *Parser) parseTableLiteral(t tipe.Type) *expr.TableLiteral {
+// parseTableSchema parses the column names of a table type,
+// [|"x", "y" int|]T, up to and including the closing '|'.
+func (p *Parser) parseTableSchema() *tipe.TableSchema {
+	schema := new(tipe.TableSchema)
+	for p.s.Token > 0 && p.s.Token != token.Pipe {
+		if !p.expect(token.String) {
+			break
+		}
+		col := tipe.Column{Name: p.s.Literal.(string)}
+		p.next()
+		if p.s.Token != token.Comma && p.s.Token != token.Pipe {
+			col.Type = p.parseType()
+		}
+		schema.Columns = append(schema.Columns, col)
+		if p.s.Token != token.Comma {
+			break
+		}
+		p.next()
+	}
+	p.expect(token.Pipe)
+	p.next()
+	return schema
+}
+
+func (p *Parser) parseTableLiteral(pos token.Pos, t tipe.Type) *expr.TableLiteral {
+	defer p.leave(p.enter("TableLiteral"))
 	x := &expr.TableLiteral{Type: t.(*tipe.Table)}
 	p.next()
 	for p.s.Token > 0 && p.s.Token != token.RightBrace {
@@ -1194,6 +2228,7 @@ func (p *Parser) parseTableLiteral(t tipe.Type) *expr.TableLiteral {
 				p.errorf("column names can only appear at beginning of table literal")
 			}
 			p.next()
+			p.inColNames = true
 			for p.s.Token > 0 && p.s.Token != token.Pipe {
 				x.ColNames = append(x.ColNames, p.parseExpr())
 				if p.s.Token != token.Comma {
@@ -1201,6 +2236,7 @@ func (p *Parser) parseTableLiteral(t tipe.Type) *expr.TableLiteral {
 				}
 				p.next()
 			}
+			p.inColNames = false
 			p.expect(token.Pipe)
 			p.next()
 		} else {
@@ -1222,10 +2258,12 @@ func (p *Parser) parseTableLiteral(t tipe.Type) *expr.TableLiteral {
 		p.next()
 	}
 	p.next()
+	x.Span = p.span(pos)
 	return x
 }
 
-func (p *Parser) parseMapLiteral(t tipe.Type) *expr.MapLiteral {
+func (p *Parser) parseMapLiteral(pos token.Pos, t tipe.Type) *expr.MapLiteral {
+	defer p.leave(p.enter("MapLiteral"))
 	x := &expr.MapLiteral{Type: t}
 	p.next()
 	for p.s.Token > 0 && p.s.Token != token.RightBrace {
@@ -1242,10 +2280,12 @@ func (p *Parser) parseMapLiteral(t tipe.Type) *expr.MapLiteral {
 	}
 	p.expect(token.RightBrace)
 	p.next()
+	x.Span = p.span(pos)
 	return x
 }
 
-func (p *Parser) parseCompLiteral(t tipe.Type) *expr.CompLiteral {
+func (p *Parser) parseCompLiteral(pos token.Pos, t tipe.Type) *expr.CompLiteral {
+	defer p.leave(p.enter("CompLiteral"))
 	x := &expr.CompLiteral{Type: t}
 	p.next()
 	for p.s.Token > 0 && p.s.Token != token.RightBrace {
@@ -1275,27 +2315,34 @@ func (p *Parser) parseCompLiteral(t tipe.Type) *expr.CompLiteral {
 	}
 	p.expect(token.RightBrace)
 	p.next()
+	x.Span = p.span(pos)
 	return x
 }
 
+// Errors is a list of syntax errors, in the order they were found.
+// It is the type of the error returned by ParseFile and ParseStmt
+// for a source with syntax errors.
 type Errors []Error
 
 func (e Errors) Error() string {
 	buf := new(bytes.Buffer)
-	buf.WriteString("neugram: parser erorrs:\n")
+	buf.WriteString("neugram: parser errors:\n")
 	for _, err := range e {
-		fmt.Fprintf(buf, "off %5d: %v\n", err.Offset, err.Msg)
+		fmt.Fprintf(buf, "%s: %v\n", err.Pos, err.Msg)
 	}
 	return buf.String()
 }
 
+// Error is a syntax error.
 type Error struct {
-	Offset int
-	Msg    string
+	Pos      token.Position // position of the offending token
+	Msg      string
+	Token    token.Token   // the offending token, or Unknown at end of input
+	Expected []token.Token // tokens that would have been accepted, if known
 }
 
 func (e Error) Error() string {
-	return fmt.Sprintf("neugram: parser: %s (off %d)", e.Msg, e.Offset)
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
 }
 
 func (p *Parser) errorf(format string, a ...interface{}) error {
@@ -1303,10 +2350,41 @@ func (p *Parser) errorf(format string, a ...interface{}) error {
 }
 
 func (p *Parser) error(msg string) error {
-	err := Error{
-		Offset: p.s.Offset,
-		Msg:    msg,
+	return p.errorAt(p.s.Pos, p.s.Token, msg)
+}
+
+// errorExpected reports an error at the current token, which is
+// not one of the expected tokens.
+func (p *Parser) errorExpected(msg string, expected ...token.Token) error {
+	return p.report(Error{
+		Pos:      p.fset.Position(p.s.Pos),
+		Msg:      msg,
+		Token:    p.s.Token,
+		Expected: expected,
+	})
+}
+
+func (p *Parser) errorAt(pos token.Pos, tok token.Token, msg string) error {
+	return p.report(Error{
+		Pos:   p.fset.Position(pos),
+		Msg:   msg,
+		Token: tok,
+	})
+}
+
+func (p *Parser) report(err Error) error {
+	if err.Pos == p.fset.Position(p.s.Pos) {
+		if word, kw := p.misspelledKeyword(); kw != "" {
+			err.Msg += fmt.Sprintf(" (did you mean %q instead of %q?)", kw, word)
+		}
 	}
+	p.nerrs++
+	if p.nerrs > 1 && err.Pos.Filename == p.lastErr.Filename && err.Pos.Line == p.lastErr.Line {
+		// Only the first error on a line is reported, the
+		// rest are most likely caused by it.
+		return err
+	}
+	p.lastErr = err.Pos
 	p.res.Errs = append(p.res.Errs, err)
 	return err
 }
@@ -1314,7 +2392,11 @@ func (p *Parser) error(msg string) error {
 func (p *Parser) expect(t token.Token) bool {
 	met := t == p.s.Token
 	if !met {
-		p.error(fmt.Sprintf("expected %q, found %q", t, p.s.Token))
+		found := p.s.Token.String()
+		if p.s.Token == token.Semicolon && p.s.Literal == "\n" {
+			found = "newline"
+		}
+		p.errorExpected(fmt.Sprintf("expected %q, found %q", t, found), t)
 	}
 	return met
 }
@@ -1331,6 +2413,7 @@ func (p *Parser) parseIdent() *expr.Ident {
 	if p.expect(token.Ident) {
 		name = p.s.Literal.(string)
 	}
+	pos := p.pos()
 	p.next()
-	return &expr.Ident{Name: name}
+	return &expr.Ident{Span: p.span(pos), Name: name}
 }
@@ -7,14 +7,16 @@ package parser_test
 import (
 	"fmt"
 	"math/big"
+	"strings"
 	"testing"
 
 	"neugram.io/ng/expr"
 	"neugram.io/ng/format"
+	"neugram.io/ng/parser"
 	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax/equal"
 	"neugram.io/ng/tipe"
 	"neugram.io/ng/token"
-	"neugram.io/ng/parser"
 )
 
 type parserTest struct {
@@ -23,27 +25,31 @@ type parserTest struct {
 }
 
 var parserTests = []parserTest{
-	{"foo", &expr.Ident{"foo"}},
-	{"x + y", &expr.Binary{token.Add, &expr.Ident{"x"}, &expr.Ident{"y"}}},
+	{"foo", &expr.Ident{Name: "foo"}},
+	{"σ", &expr.Ident{Name: "σ"}},
+	{"Δx", &expr.Ident{Name: "Δx"}},
+	{"x٣", &expr.Ident{Name: "x٣"}},
+	{"σ * Δx", &expr.Binary{Op: token.Mul, Left: &expr.Ident{Name: "σ"}, Right: &expr.Ident{Name: "Δx"}}},
+	{"x + y", &expr.Binary{Op: token.Add, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}}},
 	{
 		"x + y + 9",
 		&expr.Binary{
-			token.Add,
-			&expr.Binary{token.Add, &expr.Ident{"x"}, &expr.Ident{"y"}},
-			&expr.BasicLiteral{big.NewInt(9)},
+			Op:    token.Add,
+			Left:  &expr.Binary{Op: token.Add, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}},
+			Right: &expr.BasicLiteral{Value: big.NewInt(9)},
 		},
 	},
 	{
 		"x + (y + 7)",
 		&expr.Binary{
-			token.Add,
-			&expr.Ident{"x"},
-			&expr.Unary{
+			Op:   token.Add,
+			Left: &expr.Ident{Name: "x"},
+			Right: &expr.Unary{
 				Op: token.LeftParen,
 				Expr: &expr.Binary{
-					token.Add,
-					&expr.Ident{"y"},
-					&expr.BasicLiteral{big.NewInt(7)},
+					Op:    token.Add,
+					Left:  &expr.Ident{Name: "y"},
+					Right: &expr.BasicLiteral{Value: big.NewInt(7)},
 				},
 			},
 		},
@@ -51,9 +57,9 @@ var parserTests = []parserTest{
 	{
 		"x + y * z",
 		&expr.Binary{
-			token.Add,
-			&expr.Ident{"x"},
-			&expr.Binary{token.Mul, &expr.Ident{"y"}, &expr.Ident{"z"}},
+			Op:    token.Add,
+			Left:  &expr.Ident{Name: "x"},
+			Right: &expr.Binary{Op: token.Mul, Left: &expr.Ident{Name: "y"}, Right: &expr.Ident{Name: "z"}},
 		},
 	},
 	{
@@ -77,6 +83,55 @@ var parserTests = []parserTest{
 			},
 		},
 	},
+	{"`a\\b\\n`", &expr.BasicLiteral{Value: `a\b\n`}},
+	{"`C:\\dir\\`", &expr.BasicLiteral{Value: `C:\dir\`}},
+	{"`line1\nline2`", &expr.BasicLiteral{Value: "line1\nline2"}},
+	{"`cr\r\nlf`", &expr.BasicLiteral{Value: "cr\nlf"}},
+	{`'a'`, &expr.BasicLiteral{Value: 'a'}},
+	{`'\n'`, &expr.BasicLiteral{Value: '\n'}},
+	{`'\''`, &expr.BasicLiteral{Value: '\''}},
+	{`'\\'`, &expr.BasicLiteral{Value: '\\'}},
+	{`'\u00e9'`, &expr.BasicLiteral{Value: 'é'}},
+	{"1.5", &expr.BasicLiteral{Value: big.NewFloat(1.5)}},
+	{".25", &expr.BasicLiteral{Value: big.NewFloat(0.25)}},
+	{"2e3", &expr.BasicLiteral{Value: big.NewFloat(2000)}},
+	{"5E-1", &expr.BasicLiteral{Value: big.NewFloat(0.5)}},
+	{"3i", &expr.BasicLiteral{Value: expr.Imaginary{Imag: big.NewFloat(3)}}},
+	{"2.5i", &expr.BasicLiteral{Value: expr.Imaginary{Imag: big.NewFloat(2.5)}}},
+	{
+		"x.y + .5",
+		&expr.Binary{
+			Op:    token.Add,
+			Left:  &expr.Selector{Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}},
+			Right: &expr.BasicLiteral{Value: big.NewFloat(0.5)},
+		},
+	},
+	{
+		"x.(int64)",
+		&expr.TypeAssert{Expr: &expr.Ident{Name: "x"}, Type: tint64},
+	},
+	{
+		"f(x, y...)",
+		&expr.Call{
+			Func:     &expr.Ident{Name: "f"},
+			Args:     []expr.Expr{&expr.Ident{Name: "x"}, &expr.Ident{Name: "y"}},
+			Ellipsis: true,
+		},
+	},
+	{
+		"func(x int64, y ...string) {}",
+		&expr.FuncLiteral{
+			Type: &tipe.Func{
+				Params: &tipe.Tuple{Elems: []tipe.Type{
+					tint64,
+					&tipe.Slice{Elem: &tipe.Unresolved{Name: "string"}},
+				}},
+				Variadic: true,
+			},
+			ParamNames: []string{"x", "y"},
+			Body:       &stmt.Block{},
+		},
+	},
 	{
 		"func() integer { return 7 }",
 		&expr.FuncLiteral{
@@ -84,8 +139,9 @@ var parserTests = []parserTest{
 				Params:  &tipe.Tuple{},
 				Results: &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 			},
-			Body: &stmt.Block{[]stmt.Stmt{
-				&stmt.Return{Exprs: []expr.Expr{&expr.BasicLiteral{big.NewInt(7)}}},
+			ResultNames: []string{""},
+			Body: &stmt.Block{Stmts: []stmt.Stmt{
+				&stmt.Return{Exprs: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(7)}}},
 			}},
 		},
 	},
@@ -104,7 +160,7 @@ var parserTests = []parserTest{
 			},
 			ParamNames:  []string{"x", "y"},
 			ResultNames: []string{"r0", "r1"},
-			Body: &stmt.Block{[]stmt.Stmt{
+			Body: &stmt.Block{Stmts: []stmt.Stmt{
 				&stmt.Return{Exprs: []expr.Expr{
 					&expr.Ident{Name: "x"},
 					&expr.Ident{Name: "y"},
@@ -123,13 +179,13 @@ var parserTests = []parserTest{
 				Results: &tipe.Tuple{Elems: []tipe.Type{tint64}},
 			},
 			ResultNames: []string{""},
-			Body: &stmt.Block{[]stmt.Stmt{
+			Body: &stmt.Block{Stmts: []stmt.Stmt{
 				&stmt.Assign{
 					Decl:  true,
-					Left:  []expr.Expr{&expr.Ident{"x"}},
-					Right: []expr.Expr{&expr.BasicLiteral{big.NewInt(7)}},
+					Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+					Right: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(7)}},
 				},
-				&stmt.Return{Exprs: []expr.Expr{&expr.Ident{"x"}}},
+				&stmt.Return{Exprs: []expr.Expr{&expr.Ident{Name: "x"}}},
 			}},
 		},
 	},
@@ -147,26 +203,26 @@ var parserTests = []parserTest{
 				Results: &tipe.Tuple{Elems: []tipe.Type{tint64}},
 			},
 			ResultNames: []string{""},
-			Body: &stmt.Block{[]stmt.Stmt{&stmt.If{
+			Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.If{
 				Init: &stmt.Assign{
 					Decl:  true,
-					Left:  []expr.Expr{&expr.Ident{"x"}},
-					Right: []expr.Expr{&expr.BasicLiteral{big.NewInt(9)}},
+					Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+					Right: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(9)}},
 				},
 				Cond: &expr.Binary{
 					Op:    token.Greater,
-					Left:  &expr.Ident{"x"},
-					Right: &expr.BasicLiteral{big.NewInt(3)},
+					Left:  &expr.Ident{Name: "x"},
+					Right: &expr.BasicLiteral{Value: big.NewInt(3)},
 				},
 				Body: &stmt.Block{Stmts: []stmt.Stmt{
-					&stmt.Return{Exprs: []expr.Expr{&expr.Ident{"x"}}},
+					&stmt.Return{Exprs: []expr.Expr{&expr.Ident{Name: "x"}}},
 				}},
 				Else: &stmt.Block{Stmts: []stmt.Stmt{
 					&stmt.Return{Exprs: []expr.Expr{
 						&expr.Binary{
 							Op:    token.Sub,
-							Left:  &expr.BasicLiteral{big.NewInt(1)},
-							Right: &expr.Ident{"x"},
+							Left:  &expr.BasicLiteral{Value: big.NewInt(1)},
+							Right: &expr.Ident{Name: "x"},
 						},
 					}},
 				}},
@@ -181,19 +237,19 @@ var parserTests = []parserTest{
 					Params:  &tipe.Tuple{Elems: []tipe.Type{&tipe.Unresolved{Name: "val"}}},
 					Results: &tipe.Tuple{Elems: []tipe.Type{&tipe.Unresolved{Name: "val"}}},
 				},
-				ParamNames:  []string{""},
+				ParamNames:  []string{"x"},
 				ResultNames: []string{""},
-				Body: &stmt.Block{[]stmt.Stmt{
+				Body: &stmt.Block{Stmts: []stmt.Stmt{
 					&stmt.Return{Exprs: []expr.Expr{
 						&expr.Binary{
 							Op:    token.Add,
-							Left:  &expr.BasicLiteral{big.NewInt(3)},
-							Right: &expr.Ident{"x"},
+							Left:  &expr.BasicLiteral{Value: big.NewInt(3)},
+							Right: &expr.Ident{Name: "x"},
 						},
 					}},
 				}},
 			},
-			Args: []expr.Expr{&expr.BasicLiteral{big.NewInt(1)}},
+			Args: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(1)}},
 		},
 	},
 	{
@@ -202,36 +258,89 @@ var parserTests = []parserTest{
 			Type: &tipe.Func{
 				Params: &tipe.Tuple{},
 			},
-			Body: &stmt.Block{[]stmt.Stmt{&stmt.Assign{
-				Left:  []expr.Expr{&expr.Ident{"x"}},
-				Right: []expr.Expr{&expr.Unary{Op: token.Sub, Expr: &expr.Ident{"x"}}},
+			Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Assign{
+				Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+				Right: []expr.Expr{&expr.Unary{Op: token.Sub, Expr: &expr.Ident{Name: "x"}}},
 			}}},
 		},
 	},
-	{"x.y.z", &expr.Selector{&expr.Selector{&expr.Ident{"x"}, &expr.Ident{"y"}}, &expr.Ident{"z"}}},
-	{"y * /* comment */ z", &expr.Binary{token.Mul, &expr.Ident{"y"}, &expr.Ident{"z"}}},
-	{"y * z//comment", &expr.Binary{token.Mul, &expr.Ident{"y"}, &expr.Ident{"z"}}},
-	{`"hello"`, &expr.BasicLiteral{"hello"}},
-	{`"hello \"neugram\""`, &expr.BasicLiteral{`hello "neugram"`}},
-	//TODO{`"\""`, &expr.BasicLiteral{`"\""`}}
-	{"x[4]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{basic(4)}}},
+	{"x.y.z", &expr.Selector{Left: &expr.Selector{Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}}, Right: &expr.Ident{Name: "z"}}},
+	{"y * /* comment */ z", &expr.Binary{Op: token.Mul, Left: &expr.Ident{Name: "y"}, Right: &expr.Ident{Name: "z"}}},
+	{"x ** 2", &expr.Binary{Op: token.Pow, Left: &expr.Ident{Name: "x"}, Right: basic(2)}},
+	{"x ** y ** z", &expr.Binary{
+		Op:   token.Pow,
+		Left: &expr.Ident{Name: "x"},
+		Right: &expr.Binary{
+			Op:    token.Pow,
+			Left:  &expr.Ident{Name: "y"},
+			Right: &expr.Ident{Name: "z"},
+		},
+	}},
+	{"-x ** 2", &expr.Unary{
+		Op:   token.Sub,
+		Expr: &expr.Binary{Op: token.Pow, Left: &expr.Ident{Name: "x"}, Right: basic(2)},
+	}},
+	{"2 * x ** 2", &expr.Binary{
+		Op:    token.Mul,
+		Left:  basic(2),
+		Right: &expr.Binary{Op: token.Pow, Left: &expr.Ident{Name: "x"}, Right: basic(2)},
+	}},
+	{"x & y | z", &expr.Binary{
+		Op:    token.Or,
+		Left:  &expr.Binary{Op: token.And, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}},
+		Right: &expr.Ident{Name: "z"},
+	}},
+	{"x ^ y &^ z", &expr.Binary{
+		Op:    token.Xor,
+		Left:  &expr.Ident{Name: "x"},
+		Right: &expr.Binary{Op: token.AndNot, Left: &expr.Ident{Name: "y"}, Right: &expr.Ident{Name: "z"}},
+	}},
+	{"1 + x << 2", &expr.Binary{
+		Op:    token.Add,
+		Left:  basic(1),
+		Right: &expr.Binary{Op: token.ShiftLeft, Left: &expr.Ident{Name: "x"}, Right: basic(2)},
+	}},
+	{"x >> y == z", &expr.Binary{
+		Op:    token.Equal,
+		Left:  &expr.Binary{Op: token.ShiftRight, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}},
+		Right: &expr.Ident{Name: "z"},
+	}},
+	{"^x", &expr.Unary{Op: token.Xor, Expr: &expr.Ident{Name: "x"}}},
+	{"**x", &expr.Unary{
+		Op:   token.Mul,
+		Expr: &expr.Unary{Op: token.Mul, Expr: &expr.Ident{Name: "x"}},
+	}},
+	{"x ** -y", &expr.Binary{
+		Op:    token.Pow,
+		Left:  &expr.Ident{Name: "x"},
+		Right: &expr.Unary{Op: token.Sub, Expr: &expr.Ident{Name: "y"}},
+	}},
+	{"y * z//comment", &expr.Binary{Op: token.Mul, Left: &expr.Ident{Name: "y"}, Right: &expr.Ident{Name: "z"}}},
+	{`"hello"`, &expr.BasicLiteral{Value: "hello"}},
+	{`"hello \"neugram\""`, &expr.BasicLiteral{Value: `hello "neugram"`}},
+	{`"\""`, &expr.BasicLiteral{Value: `"`}},
+	{`"a\\"`, &expr.BasicLiteral{Value: `a\`}},
+	{`"\a\b\f\n\r\t\v"`, &expr.BasicLiteral{Value: "\a\b\f\n\r\t\v"}},
+	{`"\x41\101\u00e9\U0001F600"`, &expr.BasicLiteral{Value: "AA\u00e9\U0001F600"}},
+	{`"\xff"`, &expr.BasicLiteral{Value: "\xff"}},
+	{"x[4]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{basic(4)}}},
 	{"x[1+2]", &expr.Index{
-		Left: &expr.Ident{"x"},
+		Left: &expr.Ident{Name: "x"},
 		Indicies: []expr.Expr{&expr.Binary{Op: token.Add,
 			Left:  basic(1),
 			Right: basic(2),
 		}},
 	}},
 	{"x[1:3]", &expr.Index{
-		Left:     &expr.Ident{"x"},
+		Left:     &expr.Ident{Name: "x"},
 		Indicies: []expr.Expr{&expr.Slice{Low: basic(1), High: basic(3)}},
 	}},
-	{"x[1:]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1)}}}},
-	{"x[:3]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{High: basic(3)}}}},
-	{"x[:]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{}}}},
-	{"x[:,:]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{}, &expr.Slice{}}}},
-	{"x[1:,:3]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1)}, &expr.Slice{High: basic(3)}}}},
-	{"x[1:3,5:7]", &expr.Index{Left: &expr.Ident{"x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1), High: basic(3)}, &expr.Slice{Low: basic(5), High: basic(7)}}}},
+	{"x[1:]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1)}}}},
+	{"x[:3]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{High: basic(3)}}}},
+	{"x[:]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{}}}},
+	{"x[:,:]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{}, &expr.Slice{}}}},
+	{"x[1:,:3]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1)}, &expr.Slice{High: basic(3)}}}},
+	{"x[1:3,5:7]", &expr.Index{Left: &expr.Ident{Name: "x"}, Indicies: []expr.Expr{&expr.Slice{Low: basic(1), High: basic(3)}, &expr.Slice{Low: basic(5), High: basic(7)}}}},
 	/* TODO
 	{`x["C1"|"C2"]`, &expr.TableIndex{Expr: &expr.Ident{"x"}, ColNames: []string{"C1", "C2"}}},
 	{`x["C1",1:]`, &expr.TableIndex{
@@ -239,13 +348,13 @@ var parserTests = []parserTest{
 		ColNames: []string{"C1"},
 		Rows:     expr.Range{Start: &expr.BasicLiteral{big.NewInt(1)}},
 	}},
-	/*{"[|]num{}", &expr.TableLiteral{Type: &tipe.Table{tipe.Num}}},
+	/*{"[|]num{}", &expr.TableLiteral{Type: &tipe.Table{Type: tipe.Num}}},
 	{"[|]num{{0, 1, 2}}", &expr.TableLiteral{
-		Type: &tipe.Table{tipe.Num},
+		Type: &tipe.Table{Type: tipe.Num},
 		Rows: [][]expr.Expr{{basic(0), basic(1), basic(2)}},
 	}},
 	{`[|]num{{|"Col1"|}, {1}, {2}}`, &expr.TableLiteral{
-		Type:     &tipe.Table{tipe.Num},
+		Type:     &tipe.Table{Type: tipe.Num},
 		ColNames: []expr.Expr{basic("Col1")},
 		Rows:     [][]expr.Expr{{basic(1)}, {basic(2)}},
 	}},
@@ -255,26 +364,43 @@ var parserTests = []parserTest{
 var tint64 = &tipe.Unresolved{Name: "int64"}
 var tinteger = &tipe.Unresolved{Name: "integer"}
 
+// diffs formats the differences between a wanted and parsed tree,
+// one per line.
+func diffs(ds []equal.Difference) string {
+	var buf strings.Builder
+	for _, d := range ds {
+		fmt.Fprintf(&buf, "\n\t%v", d)
+	}
+	return buf.String()
+}
+
 func TestParseExpr(t *testing.T) {
 	for _, test := range parserTests {
 		fmt.Printf("Parsing %q\n", test.input)
-		s, err := parser.ParseStmt([]byte(test.input))
+		got, err := parser.ParseExpr([]byte(test.input))
 		if err != nil {
 			t.Errorf("ParseExpr(%q): error: %v", test.input, err)
 			continue
 		}
-		if s == nil {
-			t.Errorf("ParseExpr(%q): nil stmt", test.input)
-			continue
+		if !equal.Expr(got, test.want) {
+			t.Errorf("ParseExpr(%q):%s", test.input, diffs(equal.DiffExpr(test.want, got)))
 		}
-		got := s.(*stmt.Simple).Expr
-		if !parser.EqualExpr(got, test.want) {
-			diff := format.Diff(test.want, got)
-			if diff == "" {
-				t.Errorf("ParseExpr(%q): format.Diff empty but expressions not equal", test.input)
-			} else {
-				t.Errorf("ParseExpr(%q):\n%v", test.input, diff)
-			}
+	}
+}
+
+func TestParseExprError(t *testing.T) {
+	for _, src := range []string{
+		"x := 1",
+		"x++",
+		"func f() {}",
+		"if x { y() }",
+		"x + ",
+		"a; b",
+	} {
+		if x, err := parser.ParseExpr([]byte(src)); err == nil {
+			t.Errorf("ParseExpr(%q)=%s, want error", src, format.Debug(x))
+		} else if _, ok := err.(parser.Errors); !ok {
+			t.Errorf("ParseExpr(%q): error %v (%T), want parser.Errors", src, err, err)
 		}
 	}
 }
@@ -548,18 +674,15 @@ func simplesh(args ...string) *expr.Shell {
 func TestParseShell(t *testing.T) {
 	for _, test := range shellTests {
 		fmt.Printf("Parsing %q\n", test.input)
-		s, err := parser.ParseStmt([]byte("($$ " + test.input + " $$)"))
+		x, err := parser.ParseExpr([]byte("($$ " + test.input + " $$)"))
 		if err != nil {
 			t.Errorf("ParseExpr(%q): error: %v", test.input, err)
 			continue
 		}
-		if s == nil {
-			t.Errorf("ParseExpr(%q): nil stmt", test.input)
-			continue
-		}
-		got := s.(*stmt.Simple).Expr.(*expr.Unary).Expr.(*expr.Shell)
-		if !parser.EqualExpr(got, test.want) {
-			t.Errorf("ParseExpr(%q) = %v\ndiff: %s", test.input, format.Debug(got), format.Diff(test.want, got))
+		got := x.(*expr.Unary).Expr.(*expr.Shell)
+		got.TrapOut = false // set by the enclosing ($$ $$)
+		if !equal.Expr(got, test.want) {
+			t.Errorf("ParseExpr(%q) = %v\ndiff:%s", test.input, format.Debug(got), diffs(equal.DiffExpr(test.want, got)))
 		}
 	}
 }
@@ -572,18 +695,20 @@ type stmtTest struct {
 var stmtTests = []stmtTest{
 	{"for {}", &stmt.For{Body: &stmt.Block{}}},
 	{"for ;; {}", &stmt.For{Body: &stmt.Block{}}},
-	{"for true {}", &stmt.For{Cond: &expr.Ident{"true"}, Body: &stmt.Block{}}},
-	{"for ; true; {}", &stmt.For{Cond: &expr.Ident{"true"}, Body: &stmt.Block{}}},
-	{"for range x {}", &stmt.Range{Expr: &expr.Ident{"x"}, Body: &stmt.Block{}}},
+	{"for true {}", &stmt.For{Cond: &expr.Ident{Name: "true"}, Body: &stmt.Block{}}},
+	{"for ; true; {}", &stmt.For{Cond: &expr.Ident{Name: "true"}, Body: &stmt.Block{}}},
+	{"for range x {}", &stmt.Range{Expr: &expr.Ident{Name: "x"}, Body: &stmt.Block{}}},
 	{"for k, v := range x {}", &stmt.Range{
-		Key:  &expr.Ident{"k"},
-		Val:  &expr.Ident{"v"},
-		Expr: &expr.Ident{"x"},
+		Decl: true,
+		Key:  &expr.Ident{Name: "k"},
+		Val:  &expr.Ident{Name: "v"},
+		Expr: &expr.Ident{Name: "x"},
 		Body: &stmt.Block{},
 	}},
 	{"for k := range x {}", &stmt.Range{
-		Key:  &expr.Ident{"k"},
-		Expr: &expr.Ident{"x"},
+		Decl: true,
+		Key:  &expr.Ident{Name: "k"},
+		Expr: &expr.Ident{Name: "x"},
 		Body: &stmt.Block{},
 	}},
 	{
@@ -591,44 +716,48 @@ var stmtTests = []stmtTest{
 		&stmt.For{
 			Init: &stmt.Assign{
 				Decl:  true,
-				Left:  []expr.Expr{&expr.Ident{"i"}},
-				Right: []expr.Expr{&expr.BasicLiteral{big.NewInt(0)}},
+				Left:  []expr.Expr{&expr.Ident{Name: "i"}},
+				Right: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(0)}},
 			},
 			Cond: &expr.Binary{
 				Op:    token.Less,
-				Left:  &expr.Ident{"i"},
-				Right: &expr.BasicLiteral{big.NewInt(10)},
+				Left:  &expr.Ident{Name: "i"},
+				Right: &expr.BasicLiteral{Value: big.NewInt(10)},
 			},
 			Post: &stmt.Assign{
-				Left: []expr.Expr{&expr.Ident{"i"}},
+				Left: []expr.Expr{&expr.Ident{Name: "i"}},
 				Right: []expr.Expr{
 					&expr.Binary{
 						Op:    token.Add,
-						Left:  &expr.Ident{"i"},
-						Right: &expr.BasicLiteral{big.NewInt(1)},
+						Left:  &expr.Ident{Name: "i"},
+						Right: &expr.BasicLiteral{Value: big.NewInt(1)},
 					},
 				},
 			},
 			Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Assign{
-				Left:  []expr.Expr{&expr.Ident{"x"}},
-				Right: []expr.Expr{&expr.Ident{"i"}},
+				Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+				Right: []expr.Expr{&expr.Ident{Name: "i"}},
 			}}},
 		},
 	},
-	{"const x = 4", &stmt.Const{Name: "x", Value: &expr.BasicLiteral{big.NewInt(4)}}},
-	{"x.y", &stmt.Simple{&expr.Selector{&expr.Ident{"x"}, &expr.Ident{"y"}}}},
+	{"const x = 4", &stmt.Const{Name: "x", Value: &expr.BasicLiteral{Value: big.NewInt(4)}}},
+	{"x.y", &stmt.Simple{Expr: &expr.Selector{Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}}}},
 	{
 		"const x int64 = 4",
 		&stmt.Const{
 			Name:  "x",
 			Type:  tint64,
-			Value: &expr.BasicLiteral{big.NewInt(4)},
+			Value: &expr.BasicLiteral{Value: big.NewInt(4)},
 		},
 	},
 	{
 		`type A integer`,
 		&stmt.TypeDecl{Name: "A", Type: tinteger},
 	},
+	{
+		`type C = integer`,
+		&stmt.TypeDecl{Name: "C", Alias: true, Type: tinteger},
+	},
 	{
 		`type S struct { x integer }`,
 		&stmt.TypeDecl{
@@ -646,13 +775,15 @@ var stmtTests = []stmtTest{
 		`,
 		&stmt.MethodikDecl{
 			Name: "AnInt",
-			Type: &tipe.Methodik{
+			Type: &tipe.Named{
+				Name:        "AnInt",
 				Type:        tinteger,
 				MethodNames: []string{"f"},
 				Methods: []*tipe.Func{{
 					Params:  &tipe.Tuple{},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 				}},
+				PointerReceivers: []bool{false},
 			},
 			Methods: []*expr.FuncLiteral{{
 				Name:         "f",
@@ -661,8 +792,9 @@ var stmtTests = []stmtTest{
 					Params:  &tipe.Tuple{},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 				},
+				ResultNames: []string{""},
 				Body: &stmt.Block{Stmts: []stmt.Stmt{
-					&stmt.Return{Exprs: []expr.Expr{&expr.Ident{"a"}}},
+					&stmt.Return{Exprs: []expr.Expr{&expr.Ident{Name: "a"}}},
 				}},
 			}},
 		},
@@ -679,60 +811,83 @@ var stmtTests = []stmtTest{
 		`,
 		&stmt.MethodikDecl{
 			Name: "T",
-			Type: &tipe.Methodik{
-				Type: &tipe.Struct{
+			Type: &tipe.Named{
+				Name: "T",
+				Type: &tipe.Pointer{Elem: &tipe.Struct{
 					FieldNames: []string{"x", "y"},
-					Fields:     []tipe.Type{tinteger, &tipe.Table{tint64}},
-				},
+					Fields:     []tipe.Type{tinteger, &tipe.Table{Type: tint64}},
+				}},
 				MethodNames: []string{"f"},
 				Methods: []*tipe.Func{{
 					Params:  &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 				}},
+				PointerReceivers: []bool{false},
 			},
 			Methods: []*expr.FuncLiteral{{
-				Name:            "f",
-				ReceiverName:    "a",
-				PointerReceiver: true,
+				Name:         "f",
+				ReceiverName: "a",
 				Type: &tipe.Func{
 					Params:  &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tinteger}},
 				},
-				ParamNames: []string{"x"},
+				ParamNames:  []string{"x"},
+				ResultNames: []string{""},
 				Body: &stmt.Block{Stmts: []stmt.Stmt{
 					&stmt.Return{Exprs: []expr.Expr{&expr.Selector{
-						Left:  &expr.Ident{"a"},
-						Right: &expr.Ident{"x"},
+						Left:  &expr.Ident{Name: "a"},
+						Right: &expr.Ident{Name: "x"},
 					}}},
 				}},
 			}},
 		},
 	},
-	{"S{ X: 7 }", &stmt.Simple{&expr.CompLiteral{
+	{"S{ X: 7 }", &stmt.Simple{Expr: &expr.CompLiteral{
 		Type:     &tipe.Unresolved{Name: "S"},
-		Keys:     []expr.Expr{&expr.Ident{"X"}},
-		Elements: []expr.Expr{&expr.BasicLiteral{big.NewInt(7)}},
+		Keys:     []expr.Expr{&expr.Ident{Name: "X"}},
+		Elements: []expr.Expr{&expr.BasicLiteral{Value: big.NewInt(7)}},
+	}}},
+	{`[2]int64{1, 2}`, &stmt.Simple{Expr: &expr.ArrayLiteral{
+		Type:  &tipe.Array{Len: 2, Elem: tint64},
+		Elems: []expr.Expr{basic(1), basic(2)},
 	}}},
-	{`map[string]string{ "foo": "bar" }`, &stmt.Simple{&expr.MapLiteral{
+	{`var t [|"x", "y" string|]int64`, &stmt.Var{
+		NameList: []string{"t"},
+		Type: &tipe.Table{
+			Type: tint64,
+			Schema: &tipe.TableSchema{Columns: []tipe.Column{
+				{Name: "x"},
+				{Name: "y", Type: &tipe.Unresolved{Name: "string"}},
+			}},
+		},
+	}},
+	{`[n+1]int64{1}`, &stmt.Simple{Expr: &expr.ArrayLiteral{
+		Type: &tipe.Array{
+			LenExpr: &expr.Binary{Op: token.Add, Left: &expr.Ident{Name: "n"}, Right: basic(1)},
+			Elem:    tint64,
+		},
+		Elems: []expr.Expr{basic(1)},
+	}}},
+	{`map[string]string{ "foo": "bar" }`, &stmt.Simple{Expr: &expr.MapLiteral{
 		Type:   &tipe.Map{Key: &tipe.Unresolved{Name: "string"}, Value: &tipe.Unresolved{Name: "string"}},
 		Keys:   []expr.Expr{basic("foo")},
 		Values: []expr.Expr{basic("bar")},
 	}}},
-	{"x.y", &stmt.Simple{&expr.Selector{&expr.Ident{"x"}, &expr.Ident{"y"}}}},
-	{"sync.Mutex{}", &stmt.Simple{&expr.CompLiteral{
+	{"x.y", &stmt.Simple{Expr: &expr.Selector{Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}}}},
+	{"sync.Mutex{}", &stmt.Simple{Expr: &expr.CompLiteral{
 		Type: &tipe.Unresolved{Package: "sync", Name: "Mutex"},
 	}}},
-	{"_ = 5", &stmt.Assign{Left: []expr.Expr{&expr.Ident{"_"}}, Right: []expr.Expr{basic(5)}}},
+	{"_ = 5", &stmt.Assign{Left: []expr.Expr{&expr.Ident{Name: "_"}}, Right: []expr.Expr{basic(5)}}},
 	{"x, _ := 4, 5", &stmt.Assign{
 		Decl:  true,
-		Left:  []expr.Expr{&expr.Ident{"x"}, &expr.Ident{"_"}},
+		Left:  []expr.Expr{&expr.Ident{Name: "x"}, &expr.Ident{Name: "_"}},
 		Right: []expr.Expr{basic(4), basic(5)},
 	}},
 	{`if x == y && y == z {}`, &stmt.If{
 		Cond: &expr.Binary{
 			Op:    token.LogicalAnd,
-			Left:  &expr.Binary{Op: token.Equal, Left: &expr.Ident{"x"}, Right: &expr.Ident{"y"}},
-			Right: &expr.Binary{Op: token.Equal, Left: &expr.Ident{"y"}, Right: &expr.Ident{"z"}},
+			Left:  &expr.Binary{Op: token.Equal, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}},
+			Right: &expr.Binary{Op: token.Equal, Left: &expr.Ident{Name: "y"}, Right: &expr.Ident{Name: "z"}},
 		},
 		Body: &stmt.Block{},
 	}},
@@ -741,7 +896,7 @@ var stmtTests = []stmtTest{
 			Op: token.LeftParen,
 			Expr: &expr.Binary{
 				Op:    token.Equal,
-				Left:  &expr.Ident{"x"},
+				Left:  &expr.Ident{Name: "x"},
 				Right: &expr.CompLiteral{Type: &tipe.Unresolved{Name: "T"}},
 			},
 		},
@@ -750,9 +905,9 @@ var stmtTests = []stmtTest{
 	{
 		`f(x, // a comment
 		y)`,
-		&stmt.Simple{&expr.Call{
-			Func: &expr.Ident{"f"},
-			Args: []expr.Expr{&expr.Ident{"x"}, &expr.Ident{"y"}},
+		&stmt.Simple{Expr: &expr.Call{
+			Func: &expr.Ident{Name: "f"},
+			Args: []expr.Expr{&expr.Ident{Name: "x"}, &expr.Ident{Name: "y"}},
 		}},
 	},
 	{
@@ -762,17 +917,192 @@ var stmtTests = []stmtTest{
 		}`,
 		&stmt.For{
 			Body: &stmt.Block{Stmts: []stmt.Stmt{
-				&stmt.Assign{Left: []expr.Expr{&expr.Ident{"x"}}, Right: []expr.Expr{basic(4)}},
-				&stmt.Assign{Left: []expr.Expr{&expr.Ident{"x"}}, Right: []expr.Expr{basic(5)}},
+				&stmt.Assign{Decl: true, Left: []expr.Expr{&expr.Ident{Name: "x"}}, Right: []expr.Expr{basic(4)}},
+				&stmt.Assign{Left: []expr.Expr{&expr.Ident{Name: "x"}}, Right: []expr.Expr{basic(5)}},
 			}},
 		},
 	},
+	{`switch {}`, &stmt.Switch{}},
+	{`switch x {
+	case 1, 2:
+		y = 3
+	case 4:
+	default:
+		y = 5
+	}`, &stmt.Switch{
+		Cond: &expr.Ident{Name: "x"},
+		Cases: []stmt.SwitchCase{
+			{
+				Conds: []expr.Expr{basic(1), basic(2)},
+				Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Assign{
+					Left:  []expr.Expr{&expr.Ident{Name: "y"}},
+					Right: []expr.Expr{basic(3)},
+				}}},
+			},
+			{
+				Conds: []expr.Expr{basic(4)},
+				Body:  &stmt.Block{},
+			},
+			{
+				Default: true,
+				Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Assign{
+					Left:  []expr.Expr{&expr.Ident{Name: "y"}},
+					Right: []expr.Expr{basic(5)},
+				}}},
+			},
+		},
+	}},
+	{`switch x := f(); {
+	case x > 1:
+	}`, &stmt.Switch{
+		Init: &stmt.Assign{
+			Decl:  true,
+			Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+			Right: []expr.Expr{&expr.Call{Func: &expr.Ident{Name: "f"}}},
+		},
+		Cases: []stmt.SwitchCase{{
+			Conds: []expr.Expr{&expr.Binary{
+				Op:    token.Greater,
+				Left:  &expr.Ident{Name: "x"},
+				Right: basic(1),
+			}},
+			Body: &stmt.Block{},
+		}},
+	}},
+	{`switch x := f(); x { default: }`, &stmt.Switch{
+		Init: &stmt.Assign{
+			Decl:  true,
+			Left:  []expr.Expr{&expr.Ident{Name: "x"}},
+			Right: []expr.Expr{&expr.Call{Func: &expr.Ident{Name: "f"}}},
+		},
+		Cond:  &expr.Ident{Name: "x"},
+		Cases: []stmt.SwitchCase{{Default: true, Body: &stmt.Block{}}},
+	}},
+	{`switch x.(type) {}`, &stmt.TypeSwitch{
+		Assign: &stmt.Simple{Expr: &expr.TypeAssert{Expr: &expr.Ident{Name: "x"}}},
+	}},
+	{`switch y := 1; v := x.(type) {
+	case int64, float64:
+		print(v)
+	case []string:
+	default:
+	}`, &stmt.TypeSwitch{
+		Init: &stmt.Assign{
+			Decl:  true,
+			Left:  []expr.Expr{&expr.Ident{Name: "y"}},
+			Right: []expr.Expr{basic(1)},
+		},
+		Assign: &stmt.Assign{
+			Decl:  true,
+			Left:  []expr.Expr{&expr.Ident{Name: "v"}},
+			Right: []expr.Expr{&expr.TypeAssert{Expr: &expr.Ident{Name: "x"}}},
+		},
+		Cases: []stmt.TypeSwitchCase{
+			{
+				Types: []tipe.Type{tint64, &tipe.Unresolved{Name: "float64"}},
+				Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Simple{Expr: &expr.Call{
+					Func: &expr.Ident{Name: "print"},
+					Args: []expr.Expr{&expr.Ident{Name: "v"}},
+				}}}},
+			},
+			{
+				Types: []tipe.Type{&tipe.Slice{Elem: &tipe.Unresolved{Name: "string"}}},
+				Body:  &stmt.Block{},
+			},
+			{Default: true, Body: &stmt.Block{}},
+		},
+	}},
+	{`select {}`, &stmt.Select{}},
+	{`select {
+	case v, ok := <-c1:
+		print(v)
+	case c2 <- 1:
+	case <-c3:
+	default:
+	}`, &stmt.Select{Cases: []stmt.SelectCase{
+		{
+			Comm: &stmt.Assign{
+				Decl:  true,
+				Left:  []expr.Expr{&expr.Ident{Name: "v"}, &expr.Ident{Name: "ok"}},
+				Right: []expr.Expr{&expr.Unary{Op: token.ChanOp, Expr: &expr.Ident{Name: "c1"}}},
+			},
+			Body: &stmt.Block{Stmts: []stmt.Stmt{&stmt.Simple{Expr: &expr.Call{
+				Func: &expr.Ident{Name: "print"},
+				Args: []expr.Expr{&expr.Ident{Name: "v"}},
+			}}}},
+		},
+		{
+			Comm: &stmt.Send{Chan: &expr.Ident{Name: "c2"}, Value: basic(1)},
+			Body: &stmt.Block{},
+		},
+		{
+			Comm: &stmt.Simple{Expr: &expr.Unary{Op: token.ChanOp, Expr: &expr.Ident{Name: "c3"}}},
+			Body: &stmt.Block{},
+		},
+		{Default: true, Body: &stmt.Block{}},
+	}}},
 	{`go func() {}()`, &stmt.Go{Call: &expr.Call{
 		Func: &expr.FuncLiteral{
 			Type: &tipe.Func{Params: &tipe.Tuple{}},
 			Body: &stmt.Block{},
 		},
 	}}},
+	{`switch x {
+	case 1:
+		fallthrough
+	case 2:
+	}`, &stmt.Switch{
+		Cond: &expr.Ident{Name: "x"},
+		Cases: []stmt.SwitchCase{
+			{
+				Conds: []expr.Expr{basic(1)},
+				Body: &stmt.Block{Stmts: []stmt.Stmt{
+					&stmt.Branch{Type: token.Fallthrough},
+				}},
+			},
+			{Conds: []expr.Expr{basic(2)}, Body: &stmt.Block{}},
+		},
+	}},
+	{`var x int64`, &stmt.Var{NameList: []string{"x"}, Type: tint64}},
+	{`var x, y = 1, "y"`, &stmt.Var{
+		NameList: []string{"x", "y"},
+		Values:   []expr.Expr{basic(1), basic("y")},
+	}},
+	{`var (
+		x int64 = 4
+		y []string
+	)`, &stmt.VarSet{Vars: []*stmt.Var{
+		{NameList: []string{"x"}, Type: tint64, Values: []expr.Expr{basic(4)}},
+		{NameList: []string{"y"}, Type: &tipe.Slice{Elem: &tipe.Unresolved{Name: "string"}}},
+	}}},
+	{`const (
+		a int64 = iota
+		b
+		c = "c"
+	)`, &stmt.ConstSet{Consts: []*stmt.Const{
+		{Name: "a", Type: tint64, Value: &expr.Ident{Name: "iota"}},
+		{Name: "b", Type: tint64, Value: &expr.Ident{Name: "iota"}},
+		{Name: "c", Value: basic("c")},
+	}}},
+	{`L: for { break L }`, &stmt.Labeled{
+		Label: "L",
+		Stmt: &stmt.For{Body: &stmt.Block{Stmts: []stmt.Stmt{
+			&stmt.Branch{Type: token.Break, Label: "L"},
+		}}},
+	}},
+	{`for { continue }`, &stmt.For{Body: &stmt.Block{Stmts: []stmt.Stmt{
+		&stmt.Branch{Type: token.Continue},
+	}}}},
+	{`goto L`, &stmt.Branch{Type: token.Goto, Label: "L"}},
+	{`func() { defer f(x) }`, &stmt.Simple{Expr: &expr.FuncLiteral{
+		Type: &tipe.Func{Params: &tipe.Tuple{}},
+		Body: &stmt.Block{Stmts: []stmt.Stmt{
+			&stmt.Defer{Call: &expr.Call{
+				Func: &expr.Ident{Name: "f"},
+				Args: []expr.Expr{&expr.Ident{Name: "x"}},
+			}},
+		}},
+	}}},
 }
 
 func TestParseStmt(t *testing.T) {
@@ -787,25 +1117,523 @@ func TestParseStmt(t *testing.T) {
 			t.Errorf("ParseStmt(%q): nil stmt", test.input)
 			continue
 		}
-		if !parser.EqualStmt(got, test.want) {
-			diff := format.Diff(test.want, got)
-			if diff == "" {
-				t.Errorf("ParseStmt(%q): format.Diff empty but statements not equal", test.input)
-			} else {
-				t.Errorf("ParseStmt(%q):\n%v", test.input, diff)
+		if !equal.Stmt(got, test.want) {
+			t.Errorf("ParseStmt(%q):%s", test.input, diffs(equal.DiffStmt(test.want, got)))
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	src := `package foo
+
+import f "fmt"
+
+const c = 1
+
+func g() {
+	f.Println(c)
+}
+
+g()
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Package != "foo" {
+		t.Errorf("Package=%q, want foo", f.Package)
+	}
+	if len(f.Stmts) != 4 {
+		t.Fatalf("got %d stmts, want 4: %s", len(f.Stmts), format.Debug(f.Stmts))
+	}
+	if imp, ok := f.Stmts[0].(*stmt.Import); !ok {
+		t.Errorf("Stmts[0] is %T, want *stmt.Import", f.Stmts[0])
+	} else if imp.Name != "f" || imp.Path != "fmt" {
+		t.Errorf("import Name=%q Path=%q, want f fmt", imp.Name, imp.Path)
+	}
+
+	if _, err := parser.ParseFile(fset, "bad.ng", []byte("x := 1\npackage foo\n"), 0); err == nil {
+		t.Errorf("misplaced package clause: no error")
+	} else if want := "bad.ng:2:1: package clause must be first in file"; !strings.Contains(err.Error(), want) {
+		t.Errorf("misplaced package clause: error %q, want %q", err, want)
+	}
+	if _, err := parser.ParseFile(fset, "eof.ng", []byte("func f() {\n"), 0); err == nil {
+		t.Errorf("unterminated func: no error")
+	}
+}
+
+func TestParseMultiLine(t *testing.T) {
+	src := `x := 1 +
+	2
+y := a &&
+	b
+z := f(1,
+	2)
+ch <-
+	v
+func g() {
+	return
+}
+w := []int{
+	1,
+}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "multi.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Stmts) != 6 {
+		t.Errorf("got %d stmts, want 6", len(f.Stmts))
+	}
+
+	_, err = parser.ParseFile(token.NewFileSet(), "paren.ng", []byte("x := (1\ny := 2\n"), 0)
+	if want := `expected "RightParen", found "newline"`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("unclosed paren: error %v, want %q", err, want)
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	src := `// Sum the squares.
+sum := 0
+
+for i := 0; i < 3; i++ { sum += i * i }; print(sum)
+f := func(
+	x int,
+) int {
+	return x // comment
+}
+
+/* done */
+`
+	stmts, err := parser.ParseProgram([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"*stmt.Assign", "*stmt.For", "*stmt.Simple", "*stmt.Assign"}
+	if len(stmts) != len(want) {
+		t.Fatalf("got %d stmts, want %d: %s", len(stmts), len(want), format.Debug(stmts))
+	}
+	for i, s := range stmts {
+		if got := fmt.Sprintf("%T", s); got != want[i] {
+			t.Errorf("stmts[%d] is %s, want %s", i, got, want[i])
+		}
+	}
+
+	if _, err := parser.ParseProgram([]byte("x := [\n")); err == nil {
+		t.Error("unterminated program: no error")
+	}
+}
+
+func TestFeed(t *testing.T) {
+	p := parser.New(token.NewFileSet(), "repl", 0)
+	defer p.Close()
+	tests := []struct {
+		line  string
+		want  parser.Outcome
+		stmts int
+	}{
+		{"x := 1", parser.Complete, 1},
+		{"", parser.Complete, 0},
+		{"if x > 0 {", parser.NeedMore, 0},
+		{"\ty := 2", parser.NeedMore, 0},
+		{"}", parser.Complete, 1},
+		{"s := `raw", parser.NeedMore, 0},
+		{"string`", parser.Complete, 1},
+		{`t := "abc`, parser.Invalid, 1},
+		{"f(]", parser.Invalid, 1},
+		{"g := f(1,", parser.NeedMore, 0},
+		{"2)", parser.Complete, 1},
+	}
+	for _, test := range tests {
+		got, res := p.Feed([]byte(test.line))
+		if got != test.want || len(res.Stmts) != test.stmts {
+			t.Errorf("Feed(%q)=%v with %d stmts, want %v with %d (errors: %v)", test.line, got, len(res.Stmts), test.want, test.stmts, res.Errs)
+		}
+	}
+}
+
+func TestNoShell(t *testing.T) {
+	for _, src := range []string{"$$ ls $$", "x := $$ ls $$"} {
+		_, err := parser.ParseStmtFrom(token.NewFileSet(), "", []byte(src), parser.NoShell)
+		if err == nil || !strings.Contains(err.Error(), "shell expressions are not enabled") {
+			t.Errorf("%s: err=%v, want shell expressions error", src, err)
+		}
+	}
+	if _, err := parser.ParseStmt([]byte("x := $$ ls $$")); err != nil {
+		t.Errorf("without NoShell: %v", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := "x := " + strings.Repeat("(", 10001) + "1" + strings.Repeat(")", 10001) + "\ny := 2\n"
+	_, err := parser.ParseFile(token.NewFileSet(), "deep.ng", []byte(src), 0)
+	errs, ok := err.(parser.Errors)
+	if !ok || len(errs) != 1 || !strings.Contains(errs[0].Msg, "exceeded maximum nesting depth") {
+		t.Fatalf("err=%v, want one nesting depth error", err)
+	}
+
+	nested := []byte("x := ((((1))))")
+	p := parser.New(token.NewFileSet(), "shallow.ng", 0)
+	p.SetMaxDepth(10)
+	_, err = p.ParseStmt(nested)
+	p.Close()
+	if err == nil || !strings.Contains(err.Error(), "exceeded maximum nesting depth") {
+		t.Errorf("depth 10: err=%v, want nesting depth error", err)
+	}
+	p = parser.New(token.NewFileSet(), "shallow.ng", 0)
+	p.SetMaxDepth(100)
+	_, err = p.ParseFile(nested)
+	p.Close()
+	if err != nil {
+		t.Errorf("depth 100: %v", err)
+	}
+	p = parser.New(token.NewFileSet(), "shallow.ng", 0)
+	p.SetMaxDepth(0)
+	if _, err = p.ParseFile(nested); err != nil {
+		t.Errorf("default depth: %v", err)
+	}
+	p.Close()
+}
+
+// badInputs once crashed or hung the parser.
+var badInputs = []string{
+	"#x",
+	"$`",
+	"\"",
+	"x := `",
+	"5Edefault",
+	"for$$ ;; {}",
+	"<-[T",
+	"intr$$face7",
+	"x := $$ ls ${x",
+	"x := \x00",
+	"import (\"os\"; \"crypto/md5)\n\nh := 1",
+	"type P struct {\n\tA [P{X: 1}\nx := 1\n}\n",
+}
+
+func TestBadInputs(t *testing.T) {
+	for _, src := range badInputs {
+		_, err := parser.ParseFile(token.NewFileSet(), "bad.ng", []byte(src), 0)
+		if err == nil {
+			t.Errorf("%q: no error", src)
+			continue
+		}
+		for _, e := range err.(parser.Errors) {
+			if strings.HasPrefix(e.Msg, "internal error") {
+				t.Errorf("%q: %v", src, e)
 			}
 		}
 	}
 }
 
+func TestMisspelledKeyword(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"fnc f() {}", `did you mean "func" instead of "fnc"?`},
+		{"func f() int { retrun 1 }", `did you mean "return" instead of "retrun"?`},
+		{"if x {} esle {}", `did you mean "else" instead of "esle"?`},
+		{"swtich x {}", `did you mean "switch" instead of "swtich"?`},
+		{"x := 1 y", ""},
+		{"foobar x", ""},
+	}
+	for _, test := range tests {
+		_, err := parser.ParseFile(token.NewFileSet(), "typo.ng", []byte(test.src), 0)
+		if err == nil {
+			t.Errorf("%q: no error", test.src)
+			continue
+		}
+		got := strings.Contains(err.Error(), "did you mean")
+		if test.want == "" && got {
+			t.Errorf("%q: unexpected suggestion: %v", test.src, err)
+		} else if test.want != "" && !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: error %v, want %q", test.src, err, test.want)
+		}
+	}
+}
+
+func TestSetTrace(t *testing.T) {
+	p := parser.New(token.NewFileSet(), "trace", 0)
+	defer p.Close()
+	var got []string
+	depth := 0
+	p.SetTrace(func(production string, enter bool, tok token.Token, pos token.Position) {
+		if enter {
+			depth++
+			if production == "Index" || production == "TableLiteral" {
+				got = append(got, fmt.Sprintf("%s %s %d:%d", production, tok, pos.Line, pos.Column))
+			}
+		} else {
+			depth--
+		}
+	})
+	res := p.ParseLine([]byte("x[1, 2]"))
+	if len(res.Errs) != 0 {
+		t.Fatal(res.Errs)
+	}
+	want := []string{"Index LeftBracket 1:2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("traced %q, want %q", got, want)
+	}
+	if depth != 0 {
+		t.Errorf("unbalanced trace, depth %d", depth)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	src := `x := 1 )
+y := 2
+if y > 1 {
+	]
+	y = 3
+}
+for ; y < 3; y++ {
+	z.]
+}
+) + 2
+w := x + y
+`
+	_, err := parser.ParseFile(token.NewFileSet(), "bad.ng", []byte(src), 0)
+	errs, ok := err.(parser.Errors)
+	if !ok {
+		t.Fatalf("error %v (%T), want parser.Errors", err, err)
+	}
+	want := []string{
+		`bad.ng:1:8: expected "Semicolon", found "RightParen"`,
+		`bad.ng:4:2: expected statement, found RightBracket`,
+		`bad.ng:8:4: expected selector or type assertion, found RightBracket`,
+		`bad.ng:10:1: expected statement, found RightParen`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("error %d: %q, want %q", i, e, want[i])
+		}
+	}
+	if e := errs[0]; e.Pos.Line != 1 || e.Pos.Column != 8 || e.Token != token.RightParen ||
+		len(e.Expected) != 1 || e.Expected[0] != token.Semicolon {
+		t.Errorf("error 0: %+v, want RightParen at 1:8, expecting Semicolon", e)
+	}
+	if e := errs[1]; e.Token != token.RightBracket || e.Expected != nil {
+		t.Errorf("error 1: %+v, want RightBracket, expecting nothing in particular", e)
+	}
+
+	// A statement with errors is a *stmt.Bad, not what was parsed
+	// of it, so it cannot be evaluated by mistake.
+	p := parser.New(token.NewFileSet(), "bad.ng", 0)
+	for _, line := range []string{"type S struct { Inner }", "x := 1 )", "if x > 1 { ] }"} {
+		res := p.ParseLine([]byte(line))
+		if len(res.Errs) == 0 || len(res.Stmts) != 1 {
+			t.Errorf("%q: %d statements, errors %v, want one statement and errors", line, len(res.Stmts), res.Errs)
+			continue
+		}
+		if _, isBad := res.Stmts[0].(*stmt.Bad); !isBad {
+			t.Errorf("%q: statement %T, want *stmt.Bad", line, res.Stmts[0])
+		}
+	}
+	if res := p.ParseLine([]byte("y := 2")); len(res.Errs) != 0 || len(res.Stmts) != 1 {
+		t.Errorf("statement after errors: %d statements, errors %v", len(res.Stmts), res.Errs)
+	} else if _, isAssign := res.Stmts[0].(*stmt.Assign); !isAssign {
+		t.Errorf("statement after errors: %T, want *stmt.Assign", res.Stmts[0])
+	}
+	p.Close()
+
+	_, err = parser.ParseFile(token.NewFileSet(), "eof.ng", []byte("x := 1 +\n"), 0)
+	if errs, ok := err.(parser.Errors); !ok || len(errs) != 1 || errs[0].Msg != "unexpected EOF" {
+		t.Errorf("partial statement: error %v, want unexpected EOF", err)
+	}
+	_, err = parser.ParseStmt([]byte("x := 1; y := 2"))
+	if _, ok := err.(parser.Errors); !ok {
+		t.Errorf("ParseStmt of two statements: error %v (%T), want parser.Errors", err, err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	src := `x := a + b
+
+func f(y int64) int64 {
+	return y * 2
+}
+
+var m map[string][]*T
+var pp **int
+`
+	// Files share the position encoding of a FileSet.
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "other.ng", []byte("y := 1\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(fset, "pos.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Stmts) != 4 {
+		t.Fatalf("got %d stmts, want 4: %s", len(f.Stmts), format.Debug(f.Stmts))
+	}
+	assign := f.Stmts[0].(*stmt.Assign)
+	fn := f.Stmts[1].(*stmt.Simple).Expr.(*expr.FuncLiteral)
+	ret := fn.Body.(*stmt.Block).Stmts[0].(*stmt.Return)
+	m := f.Stmts[2].(*stmt.Var).Type.(*tipe.Map)
+	slice := m.Value.(*tipe.Slice)
+	pp := f.Stmts[3].(*stmt.Var).Type.(*tipe.Pointer)
+
+	tests := []struct {
+		node       expr.Node
+		start, end string
+	}{
+		{assign, "pos.ng:1:1", "pos.ng:1:11"},
+		{assign.Left[0], "pos.ng:1:1", "pos.ng:1:2"},
+		{assign.Right[0], "pos.ng:1:6", "pos.ng:1:11"},
+		{assign.Right[0].(*expr.Binary).Right, "pos.ng:1:10", "pos.ng:1:11"},
+		{fn, "pos.ng:3:1", "pos.ng:5:2"},
+		{fn.Body.(*stmt.Block), "pos.ng:3:23", "pos.ng:5:2"},
+		{ret, "pos.ng:4:2", "pos.ng:4:14"},
+		{ret.Exprs[0], "pos.ng:4:9", "pos.ng:4:14"},
+		{fn.Type, "pos.ng:3:1", "pos.ng:3:22"},
+		{fn.Type.Params, "pos.ng:3:7", "pos.ng:3:16"},
+		{fn.Type.Params.Elems[0].(*tipe.Unresolved), "pos.ng:3:10", "pos.ng:3:15"},
+		{fn.Type.Results, "pos.ng:3:17", "pos.ng:3:22"},
+		{m, "pos.ng:7:7", "pos.ng:7:22"},
+		{m.Key.(*tipe.Unresolved), "pos.ng:7:11", "pos.ng:7:17"},
+		{slice, "pos.ng:7:18", "pos.ng:7:22"},
+		{slice.Elem.(*tipe.Pointer), "pos.ng:7:20", "pos.ng:7:22"},
+		{slice.Elem.(*tipe.Pointer).Elem.(*tipe.Unresolved), "pos.ng:7:21", "pos.ng:7:22"},
+		{pp, "pos.ng:8:8", "pos.ng:8:13"},
+		{pp.Elem.(*tipe.Pointer), "pos.ng:8:9", "pos.ng:8:13"},
+	}
+	for _, test := range tests {
+		if got := fset.Position(test.node.Pos()).String(); got != test.start {
+			t.Errorf("%s: Pos()=%s, want %s", format.Debug(test.node), got, test.start)
+		}
+		if got := fset.Position(test.node.End()).String(); got != test.end {
+			t.Errorf("%s: End()=%s, want %s", format.Debug(test.node), got, test.end)
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	src := `// Package foo is documented.
+package foo
+
+// c is a constant.
+const c = 1 // trailing
+
+// detached
+
+var (
+	// x is documented.
+	x = 1
+	y = 2
+)
+
+/*
+f is documented
+in a block.
+*/
+func f() {}
+
+methodik T int {
+	// M is a method.
+	func (t) M() {}
+}
+
+z := 1 /* a
+b */ w := 2
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "doc.ng", []byte(src), parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Stmts) != 6 {
+		t.Fatalf("got %d stmts, want 6: %s", len(f.Stmts), format.Debug(f.Stmts))
+	}
+	if got := len(f.Comments); got != 8 {
+		t.Errorf("got %d comment groups, want 8", got)
+	}
+	varSet := f.Stmts[1].(*stmt.VarSet)
+	tests := []struct {
+		name string
+		doc  *expr.CommentGroup
+		want string
+	}{
+		{"package", f.Doc, "Package foo is documented.\n"},
+		{"c", f.Stmts[0].(*stmt.Const).Doc, "c is a constant.\n"},
+		{"var", varSet.Doc, ""},
+		{"x", varSet.Vars[0].Doc, "x is documented.\n"},
+		{"y", varSet.Vars[1].Doc, ""},
+		{"f", f.Stmts[2].(*stmt.Simple).Expr.(*expr.FuncLiteral).Doc, "f is documented\nin a block.\n"},
+		{"T", f.Stmts[3].(*stmt.MethodikDecl).Doc, ""},
+		{"M", f.Stmts[3].(*stmt.MethodikDecl).Methods[0].Doc, "M is a method.\n"},
+	}
+	for _, test := range tests {
+		if got := test.doc.Text(); got != test.want {
+			t.Errorf("%s doc: %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// Comments are dropped without ParseComments.
+	f, err = parser.ParseFile(fset, "nodoc.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Doc != nil || len(f.Comments) != 0 {
+		t.Errorf("comments recorded without ParseComments")
+	}
+}
+
+var stmtErrorTests = []struct {
+	input string
+	want  string // substring of the first error message
+}{
+	{`go f`, "expression in go must be function call"},
+	{`go (f())`, "expression in go must not be parenthesized"},
+	{`defer f`, "expression in defer must be function call"},
+	{`fallthrough`, "fallthrough statement out of place"},
+	{`var x`, "missing variable type or initialization"},
+	{`switch { case true: fallthrough }`, "cannot fallthrough final case in switch"},
+	{`switch { case true: fallthrough; f(); default: }`, "fallthrough statement out of place"},
+	{`switch { case true: if x { fallthrough }; default: }`, "fallthrough statement out of place"},
+	{`switch x.(type) { case int64: fallthrough; default: }`, "fallthrough statement out of place"},
+	{`f(x..., y)`, "can only use ... with final argument in list"},
+	{`f := func(x ...int64, y int64) {}`, "can only use ... with final parameter in list"},
+	{`f := func(x, y ...int64) {}`, "can only use ... with final parameter in list"},
+	{`f := func() (x ...int64) {}`, "cannot use ... in result list"},
+	{`x := 'ab'`, "more than one character in rune literal"},
+	{`x := ''`, "empty rune literal"},
+	{`x := "\q"`, "unknown escape sequence"},
+	{`x := "\x4"`, "illegal character '\"' in escape sequence"},
+	{`x := "\400"`, "escape sequence is invalid Unicode code point"},
+	{`x := "\uD800"`, "escape sequence is invalid Unicode code point"},
+	{`x := "\U00110000"`, "escape sequence is invalid Unicode code point"},
+	{`x := "abc`, "string literal missing terminating"},
+	{`x := ٣x`, "identifier cannot begin with digit"},
+}
+
+func TestParseStmtError(t *testing.T) {
+	for _, test := range stmtErrorTests {
+		_, err := parser.ParseStmt([]byte(test.input))
+		if err == nil {
+			t.Errorf("ParseStmt(%q): no error, want %q", test.input, test.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseStmt(%q): error %q, want %q", test.input, err, test.want)
+		}
+	}
+}
+
 func basic(x interface{}) *expr.BasicLiteral {
 	switch x := x.(type) {
 	case int:
-		return &expr.BasicLiteral{big.NewInt(int64(x))}
+		return &expr.BasicLiteral{Value: big.NewInt(int64(x))}
 	case int64:
-		return &expr.BasicLiteral{big.NewInt(x)}
+		return &expr.BasicLiteral{Value: big.NewInt(x)}
 	case string:
-		return &expr.BasicLiteral{x}
+		return &expr.BasicLiteral{Value: x}
 	default:
 		panic(fmt.Sprintf("unknown basic %v (%T)", x, x))
 	}
@@ -8,18 +8,22 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
+	"neugram.io/ng/expr"
 	"neugram.io/ng/token"
 )
 
 const bom = 0xFEFF // byte order marker
 
-func newScanner() *Scanner {
+func newScanner(fset *token.FileSet, filename string) *Scanner {
 	s := &Scanner{
-		addSrc:  make(chan []byte),
-		needSrc: make(chan struct{}),
+		fset:     fset,
+		filename: filename,
+		addSrc:   make(chan []byte),
+		needSrc:  make(chan struct{}),
 	}
 	//go s.next()
 	//<-s.needSrc
@@ -31,22 +35,29 @@ type Scanner struct {
 	Line    int
 	Offset  int
 	Token   token.Token
-	Literal interface{} // string, *big.Int, *big.Float
+	Literal interface{} // string, *big.Int, *big.Float; "\n" for an inserted ';'
+	Pos     token.Pos   // start of Token
+	End     token.Pos   // just after Token
 
 	// Scanner state
-	src     []byte
-	r       rune
-	off     int
-	semi    bool
-	err     error
-	inShell bool
+	fset     *token.FileSet
+	filename string
+	chunks   []chunk
+	lines    int // number of newlines in src
+	src      []byte
+	r        rune
+	off      int
+	semi     bool // a newline or EOF after the current token is a ';'
+	semiNext bool // a comment ended a line, the next token is ';'
+	err      error
+	inShell  bool
 
 	addSrc  chan []byte
 	needSrc chan struct{}
 }
 
 func (s *Scanner) errorf(format string, a ...interface{}) {
-	s.err = fmt.Errorf("neugram: scanner: %s (off %d)", fmt.Sprintf(format, a...), s.Offset)
+	s.err = fmt.Errorf(format, a...)
 }
 
 func (s *Scanner) next() {
@@ -65,6 +76,7 @@ func (s *Scanner) next() {
 			s.r = -1
 			return
 		}
+		s.addChunk(b)
 		s.src = append(s.src, b...)
 	}
 
@@ -89,6 +101,35 @@ func (s *Scanner) next() {
 	return
 }
 
+// chunk is a piece of src registered in the FileSet.
+type chunk struct {
+	off  int // offset of the chunk in src
+	file *token.File
+}
+
+// addChunk registers the source b, about to be appended to src,
+// with the FileSet.
+func (s *Scanner) addChunk(b []byte) {
+	f := s.fset.AddChunk(s.filename, len(s.src), s.lines+1, len(b))
+	for i, c := range b {
+		if c == '\n' {
+			s.lines++
+			f.AddLine(i + 1)
+		}
+	}
+	s.chunks = append(s.chunks, chunk{off: len(s.src), file: f})
+}
+
+// pos reports the position of the current character.
+func (s *Scanner) pos() token.Pos {
+	for i := len(s.chunks) - 1; i >= 0; i-- {
+		if c := s.chunks[i]; c.off <= s.Offset {
+			return c.file.Pos(s.Offset - c.off)
+		}
+	}
+	return token.NoPos
+}
+
 func (s *Scanner) skipWhitespace() {
 	for s.r == ' ' || s.r == '\t' || (s.r == '\n' && !s.semi) || s.r == '\r' {
 		s.next()
@@ -113,12 +154,12 @@ func (s *Scanner) scanShellWord() string {
 		case '$':
 			s.next()
 			if s.r == '{' {
-				for s.r != '}' {
+				for s.r != '}' && s.r != -1 {
 					s.next()
 				}
 				s.next()
 			}
-		case ' ', '\t', '\n', '\r', '|', '&', ';', '<', '>', '(', ')':
+		case -1, ' ', '\t', '\n', '\r', '|', '&', ';', '<', '>', '(', ')':
 			return string(s.src[off:s.Offset])
 		default:
 			s.next()
@@ -168,6 +209,9 @@ exponent:
 	}
 
 	str := string(s.src[off:s.Offset])
+	if tok == token.Imaginary {
+		str = str[:len(str)-1]
+	}
 	var value interface{}
 	switch tok {
 	case token.Int:
@@ -176,7 +220,6 @@ exponent:
 			value = i
 		} else {
 			s.errorf("bad int literal: %q", str)
-			tok = token.Unknown
 		}
 	case token.Float:
 		f, ok := big.NewFloat(0).SetString(str)
@@ -184,10 +227,14 @@ exponent:
 			value = f
 		} else {
 			s.errorf("bad float literal: %q", str)
-			tok = token.Unknown
 		}
 	case token.Imaginary:
-		panic("TODO token.Imaginary")
+		f, ok := big.NewFloat(0).SetString(str)
+		if ok {
+			value = expr.Imaginary{Imag: f}
+		} else {
+			s.errorf("bad imaginary literal: %q", str)
+		}
 	}
 
 	return tok, value
@@ -218,7 +265,7 @@ func (s *Scanner) scanRawString() string {
 		r := s.r
 		if r <= 0 {
 			s.errorf("raw string literal not terminated")
-			break
+			return "`" + string(s.src[off:s.Offset]) + "`"
 		}
 		s.next()
 		if r == '`' {
@@ -235,52 +282,133 @@ func (s *Scanner) scanRune() rune {
 		r := s.r
 		if r <= 0 || r == '\n' {
 			s.errorf("character literal missing terminating \"'\"")
-			break
+			return 0
 		}
 		s.next()
-		if r == '\\' {
-			if s.r == '\'' {
-				s.next()
-			}
-		}
 		if r == '\'' {
 			break
 		}
+		if r == '\\' && s.r > 0 && s.r != '\n' {
+			s.next() // escaped character, may be a '
+		}
 	}
 
 	str := string(s.src[off : s.Offset-1])
-	v, _, _, err := strconv.UnquoteChar(str, '\'')
+	if str == "" {
+		s.errorf("empty rune literal or unescaped ' in rune literal")
+		return 0
+	}
+	v, _, tail, err := strconv.UnquoteChar(str, '\'')
 	if err != nil {
 		s.errorf("rune literal %v", err)
+	} else if tail != "" {
+		s.errorf("more than one character in rune literal")
 	}
 	return v
 }
 
-func (s *Scanner) scanString(spanNewlines bool) string {
+// scanString scans a double-quoted string. Shell strings may span
+// newlines and their escapes are left for the shell to interpret.
+func (s *Scanner) scanString(inShell bool) string {
 	off := s.Offset
 
 	for {
 		r := s.r
-		if r <= 0 || (!spanNewlines && r == '\n') {
+		if r <= 0 || (!inShell && r == '\n') {
 			s.errorf("string literal missing terminating '\"'")
-			break
+			return `"` + string(s.src[off:s.Offset]) + `"`
 		}
 		s.next()
+		if r == '"' {
+			break
+		}
 		if r == '\\' {
-			if s.r == '"' {
-				s.next()
+			if inShell {
+				if s.r > 0 {
+					s.next()
+				}
+			} else {
+				s.scanEscape('"')
 			}
 		}
-		if r == '"' {
-			break
+	}
+
+	return `"` + string(s.src[off:s.Offset-1]) + `"`
+}
+
+// scanEscape checks the escape sequence following a backslash.
+// It reports whether the sequence is valid.
+func (s *Scanner) scanEscape(quote rune) bool {
+	var n int
+	var base, max uint32
+	switch s.r {
+	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', quote:
+		s.next()
+		return true
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n, base, max = 3, 8, 255
+	case 'x':
+		s.next()
+		n, base, max = 2, 16, 255
+	case 'u':
+		s.next()
+		n, base, max = 4, 16, unicode.MaxRune
+	case 'U':
+		s.next()
+		n, base, max = 8, 16, unicode.MaxRune
+	default:
+		if s.r <= 0 || s.r == '\n' {
+			s.errorf("escape sequence not terminated")
+		} else {
+			s.errorf("unknown escape sequence: %q", s.r)
+		}
+		return false
+	}
+
+	var x uint32
+	for ; n > 0; n-- {
+		d := uint32(digitVal(s.r))
+		if d >= base {
+			if s.r <= 0 || s.r == '\n' {
+				s.errorf("escape sequence not terminated")
+			} else {
+				s.errorf("illegal character %q in escape sequence", s.r)
+			}
+			return false
 		}
+		x = x*base + d
+		s.next()
 	}
+	if x > max || 0xD800 <= x && x < 0xE000 {
+		s.errorf("escape sequence is invalid Unicode code point")
+		return false
+	}
+	return true
+}
+
+func digitVal(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r - 'a' + 10)
+	case 'A' <= r && r <= 'F':
+		return int(r - 'A' + 10)
+	}
+	return 16 // larger than any legal digit val
+}
 
-	str := `"` + string(s.src[off:s.Offset-1]) + `"`
-	if _, err := strconv.Unquote(str); err != nil {
+// unquote decodes a scanned string literal. Escape sequences have
+// already been checked, so it only fails if scanning did.
+func (s *Scanner) unquote(str string) string {
+	if s.err != nil {
+		return ""
+	}
+	v, err := strconv.Unquote(str)
+	if err != nil {
 		s.errorf("string literal %v", err)
 	}
-	return str
+	return v
 }
 
 func (s *Scanner) scanComment() string {
@@ -292,6 +420,10 @@ func (s *Scanner) scanComment() string {
 		for s.r > 0 && s.r != '\n' {
 			s.next()
 		}
+		if lit := s.src[off:s.Offset]; lit[len(lit)-1] == '\r' {
+			// Drop the '\r' of a "\r\n" line ending.
+			return string(lit[:len(lit)-1])
+		}
 	} else {
 		// multi-line "/* comment */"
 		s.next()
@@ -310,13 +442,13 @@ func (s *Scanner) scanComment() string {
 		}
 	}
 
-	lit := s.src[off:s.Offset]
-	// TODO remove any \r in comments?
-	return string(lit)
+	return strings.Replace(string(s.src[off:s.Offset]), "\r", "", -1)
 }
 
 func (s *Scanner) nextInShell() {
 	switch s.r {
+	case -1:
+		s.Token = token.Unknown
 	case '$':
 		// TODO: there's a significant grammatical issue here. the input:
 		//	$$ ls$$
@@ -400,6 +532,20 @@ func (s *Scanner) nextInShell() {
 	}
 }
 
+// Next scans the next token.
+//
+// As in Go, a newline (or the end of input) becomes a semicolon
+// when the line's final token is
+//
+//	an identifier or a basic literal
+//	one of the keywords break, continue, fallthrough, or return
+//	one of the operators ++ and --
+//	one of the delimiters ), ], or }
+//	a shell expression's closing $$
+//
+// so a statement continues onto the next line if its line ends
+// with a binary operator, a comma, or an opening delimiter. An
+// inserted semicolon has the Literal "\n".
 func (s *Scanner) Next() {
 	/*defer func() {
 		fmt.Printf("Scanner.Next s.Token=%s, s.inShell=%v", s.Token, s.inShell)
@@ -408,8 +554,18 @@ func (s *Scanner) Next() {
 		}
 		fmt.Printf("\n")
 	}()*/
+	if s.semiNext {
+		s.semiNext = false
+		s.Pos = s.pos()
+		s.End = s.Pos
+		s.Token = token.Semicolon
+		s.Literal = "\n"
+		return
+	}
 	s.skipWhitespace()
 	//fmt.Printf("Next: s.r=%v (%s) s.off=%d\n", s.r, string(s.r), s.off)
+	s.Pos = s.pos()
+	defer func() { s.End = s.pos() }()
 
 	wasSemi := s.semi
 	s.semi = false
@@ -432,13 +588,20 @@ func (s *Scanner) Next() {
 			s.semi = true
 		}
 		return
-	case unicode.IsDigit(r):
+	case '0' <= r && r <= '9':
 		s.semi = true
 		s.Token, s.Literal = s.scanNumber(false)
 		return
+	case unicode.IsDigit(r):
+		s.semi = true
+		s.errorf("identifier cannot begin with digit %q", r)
+		s.Token = token.Ident
+		s.Literal = s.scanIdentifier()
+		return
 	case r == '\n':
 		s.semi = false
 		s.Token = token.Semicolon
+		s.Literal = "\n"
 		return
 	}
 
@@ -447,6 +610,7 @@ func (s *Scanner) Next() {
 	case -1:
 		if wasSemi {
 			s.Token = token.Semicolon
+			s.Literal = "\n"
 			return
 		}
 		s.Token = token.Unknown
@@ -454,6 +618,7 @@ func (s *Scanner) Next() {
 	case '\n':
 		s.semi = false
 		s.Token = token.Semicolon
+		s.Literal = "\n"
 	case '(':
 		s.Token = token.LeftParen
 	case ')':
@@ -476,7 +641,7 @@ func (s *Scanner) Next() {
 	case '"':
 		s.semi = true
 		s.Token = token.String
-		s.Literal = s.scanString(false)
+		s.Literal = s.unquote(s.scanString(false))
 	case '\'':
 		s.semi = true
 		s.Token = token.Rune
@@ -484,8 +649,23 @@ func (s *Scanner) Next() {
 	case '`':
 		s.semi = true
 		s.Token = token.String
-		s.Literal = s.scanRawString()
+		s.Literal = s.unquote(s.scanRawString())
 	case '.':
+		if '0' <= s.r && s.r <= '9' {
+			// .25, a float literal rather than a selector
+			s.semi = true
+			s.Token, s.Literal = s.scanNumber(true)
+			return
+		}
+		if s.r == '.' {
+			s.next()
+			if s.r != '.' {
+				s.errorf("invalid token '..'")
+			}
+			s.next()
+			s.Token = token.Ellipsis
+			return
+		}
 		s.Token = token.Period
 	case ':':
 		switch s.r {
@@ -532,6 +712,14 @@ func (s *Scanner) Next() {
 		case '=':
 			s.next()
 			s.Token = token.MulAssign
+		case '*':
+			s.next()
+			if s.r == '=' {
+				s.next()
+				s.Token = token.PowAssign
+			} else {
+				s.Token = token.Pow
+			}
 		default:
 			s.Token = token.Mul
 		}
@@ -541,7 +729,13 @@ func (s *Scanner) Next() {
 			// Interpret newline after comment as a semicolon if the previous
 			// token would have done the same.
 			s.semi = wasSemi
-			s.Literal = s.scanComment()
+			lit := s.scanComment()
+			if wasSemi && lit[1] == '*' && strings.Contains(lit, "\n") {
+				// A general comment spanning lines acts like a newline.
+				s.semi = false
+				s.semiNext = true
+			}
+			s.Literal = lit
 			s.Token = token.Comment
 		case '=':
 			s.next()
@@ -561,15 +755,23 @@ func (s *Scanner) Next() {
 		switch s.r {
 		case '=':
 			s.next()
-			s.Token = token.PowAssign
+			s.Token = token.XorAssign
 		default:
-			s.Token = token.Pow
+			s.Token = token.Xor
 		}
 	case '>':
 		switch s.r {
 		case '=':
 			s.next()
 			s.Token = token.GreaterEqual
+		case '>':
+			s.next()
+			if s.r == '=' {
+				s.next()
+				s.Token = token.ShiftRightAssign
+			} else {
+				s.Token = token.ShiftRight
+			}
 		default:
 			s.Token = token.Greater
 		}
@@ -581,6 +783,14 @@ func (s *Scanner) Next() {
 		case '=':
 			s.next()
 			s.Token = token.LessEqual
+		case '<':
+			s.next()
+			if s.r == '=' {
+				s.next()
+				s.Token = token.ShiftLeftAssign
+			} else {
+				s.Token = token.ShiftLeft
+			}
 		default:
 			s.Token = token.Less
 		}
@@ -589,6 +799,17 @@ func (s *Scanner) Next() {
 		case '&':
 			s.next()
 			s.Token = token.LogicalAnd
+		case '^':
+			s.next()
+			if s.r == '=' {
+				s.next()
+				s.Token = token.AndNotAssign
+			} else {
+				s.Token = token.AndNot
+			}
+		case '=':
+			s.next()
+			s.Token = token.AndAssign
 		default:
 			s.Token = token.Ref
 		}
@@ -598,14 +819,18 @@ func (s *Scanner) Next() {
 			s.next()
 			s.Token = token.Shell
 			s.inShell = true
-			//default:
-			//	s.Token = token.?
+		default:
+			s.Token = token.Illegal
+			s.Literal = r
 		}
 	case '|':
 		switch s.r {
 		case '|':
 			s.next()
 			s.Token = token.LogicalOr
+		case '=':
+			s.next()
+			s.Token = token.OrAssign
 		default:
 			s.Token = token.Pipe
 		}
@@ -618,8 +843,7 @@ func (s *Scanner) Next() {
 			s.Token = token.Not
 		}
 	default:
-		s.Token = token.Unknown
-		fmt.Printf("Scanner.Next unknown r=%v (%q) s.off=%d\n", r, string(rune(r)), s.off)
-		s.err = fmt.Errorf("parser: unknown r=%v", r)
+		s.Token = token.Illegal
+		s.Literal = r
 	}
 }
@@ -6,6 +6,7 @@ package parser
 
 import (
 	"math/big"
+	"testing"
 
 	"neugram.io/ng/token"
 )
@@ -91,3 +92,82 @@ func TestScannerJoin(t *testing.T) {
 	}
 }
 */
+
+// scan returns the tokens of src and the literals of its semicolons.
+func scan(src string) (toks []token.Token, semis []interface{}) {
+	s := newScanner(token.NewFileSet(), "scan.ng")
+	go func() {
+		<-s.needSrc
+		s.addSrc <- []byte(src)
+		<-s.needSrc
+		close(s.addSrc)
+	}()
+	s.next()
+	for {
+		s.Next()
+		if s.Token == token.Unknown {
+			return toks, semis
+		}
+		toks = append(toks, s.Token)
+		if s.Token == token.Semicolon {
+			semis = append(semis, s.Literal)
+		}
+	}
+}
+
+func TestSemiFollows(t *testing.T) {
+	for _, test := range scannerBothTests {
+		toks, _ := scan(test.input + "\n")
+		semi := len(toks) == 2 && toks[1] == token.Semicolon
+		if toks[0] != test.token || semi != test.semiFollows {
+			t.Errorf("%q: got %v, want %s with semicolon %v", test.input, toks, test.token, test.semiFollows)
+		}
+	}
+}
+
+var semicolonTests = []struct {
+	input string
+	semis int
+}{
+	{"x[1]\n", 1},
+	{"f()\n", 1},
+	{"{}\n", 1},
+	{"x--\n", 1},
+	{"return\n", 1},
+	{"continue\n", 1},
+	{"fallthrough\n", 1},
+	{"'a'\n", 1},
+	{"`raw`\n", 1},
+	{"\"s\"\n", 1},
+	{"1i\n", 1},
+	{"x", 1}, // at EOF
+	{"x +\n", 0},
+	{"x &&\n", 0},
+	{"x,\n", 0},
+	{"f(\n", 0},
+	{"x[\n", 0},
+	{"x.\n", 0},
+	{"x :=\n", 0},
+	{"if\n", 0},
+	{"x // c\n", 1},
+	{"x /* c */\n", 1},
+	{"x /* c\n */ y", 2},
+	{"x + /* c\n */ y", 1},
+}
+
+func TestSemicolonInsertion(t *testing.T) {
+	for _, test := range semicolonTests {
+		_, semis := scan(test.input)
+		if len(semis) != test.semis {
+			t.Errorf("%q: got %d semicolons, want %d", test.input, len(semis), test.semis)
+		}
+		for _, lit := range semis {
+			if lit != "\n" {
+				t.Errorf("%q: inserted semicolon has literal %q", test.input, lit)
+			}
+		}
+	}
+	if _, semis := scan("x; y;"); len(semis) != 2 || semis[0] != nil {
+		t.Errorf("explicit semicolons: %q", semis)
+	}
+}
@@ -13,6 +13,7 @@ import (
 )
 
 func (p *Parser) parseShellList() *expr.ShellList {
+	pos := p.pos()
 	andor := p.parseShellAndOr()
 	if andor == nil {
 		return nil
@@ -30,6 +31,7 @@ func (p *Parser) parseShellList() *expr.ShellList {
 		}
 		l.AndOr = append(l.AndOr, p.parseShellAndOr())
 	}
+	l.Span = p.span(pos)
 	if p.s.Token == token.ShellNewline {
 		if !p.interactive {
 			p.next()
@@ -39,6 +41,7 @@ func (p *Parser) parseShellList() *expr.ShellList {
 }
 
 func (p *Parser) parseShellAndOr() *expr.ShellAndOr {
+	pos := p.pos()
 	pl := p.parseShellPipeline()
 	if pl == nil {
 		return nil
@@ -51,10 +54,12 @@ func (p *Parser) parseShellAndOr() *expr.ShellAndOr {
 		p.next()
 		l.Pipeline = append(l.Pipeline, p.parseShellPipeline())
 	}
+	l.Span = p.span(pos)
 	return l
 }
 
 func (p *Parser) parseShellPipeline() *expr.ShellPipeline {
+	pos := p.pos()
 	bang := false
 	if p.s.Token == token.Not {
 		bang = true
@@ -72,10 +77,12 @@ func (p *Parser) parseShellPipeline() *expr.ShellPipeline {
 		p.next()
 		l.Cmd = append(l.Cmd, p.parseShellCmd())
 	}
+	l.Span = p.span(pos)
 	return l
 }
 
 func (p *Parser) parseShellCmd() (l *expr.ShellCmd) {
+	pos := p.pos()
 	if p.s.Token == token.LeftParen {
 		p.next()
 		l = &expr.ShellCmd{
@@ -91,6 +98,9 @@ func (p *Parser) parseShellCmd() (l *expr.ShellCmd) {
 			}
 		}
 	}
+	if l != nil {
+		l.Span = p.span(pos)
+	}
 	return l
 }
 
@@ -107,6 +117,7 @@ func isAssignment(word string) (k, v string) {
 }
 
 func (p *Parser) parseShellSimpleCmd() (l *expr.ShellSimpleCmd) {
+	pos := p.pos()
 	for {
 		w, r := p.maybeParseShellRedirect()
 		if r == nil {
@@ -122,6 +133,7 @@ func (p *Parser) parseShellSimpleCmd() (l *expr.ShellSimpleCmd) {
 		if l == nil {
 			l = &expr.ShellSimpleCmd{}
 		}
+		l.Span = p.span(pos)
 		if r != nil {
 			l.Redirect = append(l.Redirect, r)
 		} else {
@@ -142,6 +154,7 @@ func (p *Parser) parseShellSimpleCmd() (l *expr.ShellSimpleCmd) {
 
 func (p *Parser) maybeParseShellRedirect() (string, *expr.ShellRedirect) {
 	//fmt.Printf("maybeParseShellRedirect p.s.Token=%s\n", p.s.Token)
+	pos := p.pos()
 	lit := ""
 	number := (*int)(nil)
 	if p.s.Token == token.ShellWord {
@@ -167,5 +180,6 @@ func (p *Parser) maybeParseShellRedirect() (string, *expr.ShellRedirect) {
 		l.Filename = p.s.Literal.(string)
 		p.next()
 	}
+	l.Span = p.span(pos)
 	return "", l
 }
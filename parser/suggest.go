@@ -0,0 +1,89 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parser
+
+import "neugram.io/ng/token"
+
+// misspelledKeyword looks for an identifier near the current token
+// that is probably a misspelled keyword, such as "retrun". It
+// considers the identifier that began the current statement just
+// before the current token, and an identifier following a '}',
+// where "else" may be intended.
+func (p *Parser) misspelledKeyword() (word, keyword string) {
+	switch {
+	case p.s.Token == token.Ident && p.prevTok == token.RightBrace:
+		word = p.s.Literal.(string)
+		if closeTo(word, "else") {
+			return word, "else"
+		}
+		return "", ""
+	case p.prevTok == token.Ident && p.prevPos == p.stmtPos:
+		word = p.prevLit.(string)
+	default:
+		return "", ""
+	}
+	best, bestDist := "", 3
+	for kw := range token.Keywords {
+		if !closeTo(word, kw) {
+			continue
+		}
+		if d := editDistance(word, kw); d < bestDist || d == bestDist && kw < best {
+			best, bestDist = kw, d
+		}
+	}
+	return word, best
+}
+
+// closeTo reports whether word is a likely misspelling of keyword.
+// Short words must be a single edit away, longer words two.
+func closeTo(word, keyword string) bool {
+	if len(word) < 3 || word == keyword {
+		return false
+	}
+	max := 1
+	if len(word) > 4 {
+		max = 2
+	}
+	return editDistance(word, keyword) <= max
+}
+
+// editDistance is the number of single byte insertions, deletions,
+// substitutions, and transpositions of adjacent bytes that turn a
+// into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				if t := d[i-2][j-2] + 1; t < d[i][j] {
+					d[i][j] = t
+				}
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
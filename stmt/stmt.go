@@ -12,48 +12,95 @@ import (
 )
 
 type Stmt interface {
+	expr.Node
 	stmt()
 }
 
 type Import struct {
+	expr.Span
+	Doc  *expr.CommentGroup // associated documentation, or nil
 	Name string
 	Path string
 }
 
 type ImportSet struct {
+	expr.Span
+	Doc     *expr.CommentGroup // associated documentation, or nil
 	Imports []*Import
 }
 
+// TypeDecl declares a type.
+//
+// A defined type, type T U, is a new type distinct from all others.
+// An alias declaration, type T = U, gives another name to U.
+// The type checker replaces Type with a *tipe.Named for a defined
+// type or a *tipe.Alias for an alias.
 type TypeDecl struct {
-	Name string
-	Type tipe.Type
+	expr.Span
+	Doc   *expr.CommentGroup // associated documentation, or nil
+	Name  string
+	Alias bool // type Name = Type
+	Type  tipe.Type
 }
 
 type MethodikDecl struct {
+	expr.Span
+	Doc     *expr.CommentGroup // associated documentation, or nil
 	Name    string
-	Type    *tipe.Methodik
+	Type    *tipe.Named
 	Methods []*expr.FuncLiteral
 }
 
 // TODO InterfaceLiteral struct { Name string, MethodNames []string, Methods []*tipe.Func }
 
 type Const struct {
+	expr.Span
+	Doc   *expr.CommentGroup // associated documentation, or nil
 	Name  string
 	Type  tipe.Type
 	Value expr.Expr
 }
 
+// ConstSet is a grouped constant declaration, "const ( ... )".
+// A Const with an omitted value shares the Type and Value of the
+// previous Const in the set.
+type ConstSet struct {
+	expr.Span
+	Doc    *expr.CommentGroup // associated documentation, or nil
+	Consts []*Const
+}
+
+// Var is a variable declaration, "var x, y T = a, b".
+// Either Type or Values may be nil, but not both.
+type Var struct {
+	expr.Span
+	Doc      *expr.CommentGroup // associated documentation, or nil
+	NameList []string
+	Type     tipe.Type
+	Values   []expr.Expr
+}
+
+// VarSet is a grouped variable declaration, "var ( ... )".
+type VarSet struct {
+	expr.Span
+	Doc  *expr.CommentGroup // associated documentation, or nil
+	Vars []*Var
+}
+
 type Assign struct {
+	expr.Span
 	Decl  bool
 	Left  []expr.Expr
 	Right []expr.Expr // TODO: give up on multiple rhs values for now.
 }
 
 type Block struct {
+	expr.Span
 	Stmts []Stmt
 }
 
 type If struct {
+	expr.Span
 	Init Stmt
 	Cond expr.Expr
 	Body Stmt // always *BlockStmt
@@ -61,17 +108,53 @@ type If struct {
 }
 
 type For struct {
+	expr.Span
 	Init Stmt
 	Cond expr.Expr
 	Post Stmt
 	Body Stmt // always *BlockStmt
 }
 
+type Switch struct {
+	expr.Span
+	Init  Stmt
+	Cond  expr.Expr // may be nil
+	Cases []SwitchCase
+}
+
+type SwitchCase struct {
+	expr.Span
+	Conds   []expr.Expr
+	Default bool
+	Body    *Block
+}
+
+type TypeSwitch struct {
+	expr.Span
+	Init   Stmt // may be nil
+	Assign Stmt // x.(type) or v := x.(type)
+	Cases  []TypeSwitchCase
+}
+
+type TypeSwitchCase struct {
+	expr.Span
+	Types   []tipe.Type
+	Default bool
+	Body    *Block
+}
+
 type Go struct {
+	expr.Span
+	Call *expr.Call
+}
+
+type Defer struct {
+	expr.Span
 	Call *expr.Call
 }
 
 type Range struct {
+	expr.Span
 	Decl bool
 	Key  expr.Expr
 	Val  expr.Expr
@@ -80,30 +163,49 @@ type Range struct {
 }
 
 type Return struct {
+	expr.Span
 	Exprs []expr.Expr
 }
 
 type Simple struct {
+	expr.Span
 	Expr expr.Expr
 }
 
+// Select is a select statement over channel operations.
+type Select struct {
+	expr.Span
+	Cases []SelectCase
+}
+
+type SelectCase struct {
+	expr.Span
+	Default bool
+	Comm    Stmt // Send, receive Simple, or receive Assign; nil for default
+	Body    *Block
+}
+
 // Send is channel send statement, "a <- b".
 type Send struct {
+	expr.Span
 	Chan  expr.Expr
 	Value expr.Expr
 }
 
 type Branch struct {
+	expr.Span
 	Type  token.Token // Continue, Break, Goto, or Fallthrough
 	Label string
 }
 
 type Labeled struct {
+	expr.Span
 	Label string
 	Stmt  Stmt
 }
 
 type Bad struct {
+	expr.Span
 }
 
 func (s Import) stmt()       {}
@@ -111,14 +213,21 @@ func (s ImportSet) stmt()    {}
 func (s TypeDecl) stmt()     {}
 func (s MethodikDecl) stmt() {}
 func (s Const) stmt()        {}
+func (s ConstSet) stmt()     {}
+func (s Var) stmt()          {}
+func (s VarSet) stmt()       {}
 func (s Assign) stmt()       {}
 func (s Block) stmt()        {}
 func (s If) stmt()           {}
 func (s For) stmt()          {}
+func (s Switch) stmt()       {}
+func (s TypeSwitch) stmt()   {}
+func (s Defer) stmt()        {}
 func (s Go) stmt()           {}
 func (s Range) stmt()        {}
 func (s Return) stmt()       {}
 func (s Simple) stmt()       {}
+func (s Select) stmt()       {}
 func (s Send) stmt()         {}
 func (s Branch) stmt()       {}
 func (s Labeled) stmt()      {}
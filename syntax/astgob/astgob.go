@@ -0,0 +1,183 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package astgob stores parsed Neugram files in a compact binary
+// form using encoding/gob, so they can be cached without being
+// parsed again.
+//
+// The positions of the nodes are kept, along with the token.FileSet
+// needed to resolve them.
+//
+// Only the output of the parser can be encoded. Type-checked trees
+// may contain recursive types, which gob cannot represent.
+package astgob
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+func init() {
+	// Concrete types stored in interface-typed fields.
+	for _, v := range []interface{}{
+		(*big.Int)(nil),
+		(*big.Float)(nil),
+		expr.Imaginary{},
+
+		(*expr.Binary)(nil),
+		(*expr.Unary)(nil),
+		(*expr.Bad)(nil),
+		(*expr.Selector)(nil),
+		(*expr.TypeAssert)(nil),
+		(*expr.Slice)(nil),
+		(*expr.Index)(nil),
+		(*expr.BasicLiteral)(nil),
+		(*expr.FuncLiteral)(nil),
+		(*expr.CompLiteral)(nil),
+		(*expr.MapLiteral)(nil),
+		(*expr.ArrayLiteral)(nil),
+		(*expr.SliceLiteral)(nil),
+		(*expr.TableLiteral)(nil),
+		(*expr.Type)(nil),
+		(*expr.Ident)(nil),
+		(*expr.Call)(nil),
+		(*expr.ShellList)(nil),
+		(*expr.ShellAndOr)(nil),
+		(*expr.ShellPipeline)(nil),
+		(*expr.ShellCmd)(nil),
+		(*expr.ShellSimpleCmd)(nil),
+		(*expr.ShellRedirect)(nil),
+		(*expr.ShellAssign)(nil),
+		(*expr.Shell)(nil),
+
+		(*stmt.Import)(nil),
+		(*stmt.ImportSet)(nil),
+		(*stmt.TypeDecl)(nil),
+		(*stmt.MethodikDecl)(nil),
+		(*stmt.Const)(nil),
+		(*stmt.ConstSet)(nil),
+		(*stmt.Var)(nil),
+		(*stmt.VarSet)(nil),
+		(*stmt.Assign)(nil),
+		(*stmt.Block)(nil),
+		(*stmt.If)(nil),
+		(*stmt.For)(nil),
+		(*stmt.Switch)(nil),
+		(*stmt.TypeSwitch)(nil),
+		(*stmt.Go)(nil),
+		(*stmt.Defer)(nil),
+		(*stmt.Range)(nil),
+		(*stmt.Return)(nil),
+		(*stmt.Simple)(nil),
+		(*stmt.Select)(nil),
+		(*stmt.Send)(nil),
+		(*stmt.Branch)(nil),
+		(*stmt.Labeled)(nil),
+		(*stmt.Bad)(nil),
+
+		tipe.Basic(""),
+		tipe.Builtin(""),
+		(*tipe.Func)(nil),
+		(*tipe.Struct)(nil),
+		(*tipe.Named)(nil),
+		(*tipe.Array)(nil),
+		(*tipe.Slice)(nil),
+		(*tipe.Table)(nil),
+		(*tipe.Tuple)(nil),
+		(*tipe.Pointer)(nil),
+		(*tipe.Chan)(nil),
+		(*tipe.Map)(nil),
+		(*tipe.Interface)(nil),
+		(*tipe.Alias)(nil),
+		(*tipe.Unresolved)(nil),
+		(*tipe.TypeParam)(nil),
+	} {
+		gob.Register(v)
+	}
+}
+
+// Encode writes the binary encoding of f, which was parsed into
+// fset, to w.
+func Encode(w io.Writer, fset *token.FileSet, f *syntax.File) error {
+	if err := check(f); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	if err := fset.Write(enc.Encode); err != nil {
+		return fmt.Errorf("astgob: %v", err)
+	}
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("astgob: %v", err)
+	}
+	return nil
+}
+
+// Decode reads a file written by Encode. The positions of its nodes
+// are resolved by the returned FileSet.
+func Decode(r io.Reader) (*token.FileSet, *syntax.File, error) {
+	dec := gob.NewDecoder(r)
+	fset := token.NewFileSet()
+	if err := fset.Read(dec.Decode); err != nil {
+		return nil, nil, fmt.Errorf("astgob: %v", err)
+	}
+	f := new(syntax.File)
+	if err := dec.Decode(f); err != nil {
+		return nil, nil, fmt.Errorf("astgob: %v", err)
+	}
+	relink(f)
+	return fset, f, nil
+}
+
+// check reports an error if f holds a value gob cannot encode.
+func check(f *syntax.File) (err error) {
+	seen := make(map[*tipe.Named]bool)
+	for _, s := range f.Stmts {
+		walk.Inspect(s, func(n walk.Node) bool {
+			switch n := n.(type) {
+			case *expr.Bad:
+				if n.Error != nil && err == nil {
+					err = fmt.Errorf("astgob: cannot encode syntax error: %v", n.Error)
+				}
+			case *tipe.Named:
+				if seen[n] && err == nil {
+					err = errors.New("astgob: cannot encode shared or recursive type " + n.Name)
+				}
+				seen[n] = true
+			case *tipe.Package:
+				if err == nil {
+					err = errors.New("astgob: cannot encode package type " + n.Path)
+				}
+			}
+			return err == nil
+		})
+	}
+	return err
+}
+
+// relink restores the pointers gob copies. The parser uses the type
+// of each method of a methodik as the method's type in the methodik.
+func relink(f *syntax.File) {
+	for _, s := range f.Stmts {
+		walk.Inspect(s, func(n walk.Node) bool {
+			if m, ok := n.(*stmt.MethodikDecl); ok && m.Type != nil {
+				for i, fn := range m.Methods {
+					if i < len(m.Type.Methods) {
+						m.Type.Methods[i] = fn.Type
+					}
+				}
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astgob_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/astgob"
+	"neugram.io/ng/syntax/equal"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../../eval/testdata/*.ng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test programs")
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_error.ng") {
+			continue
+		}
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+		if err != nil {
+			continue // exercised by the eval tests
+		}
+
+		var buf bytes.Buffer
+		if err := astgob.Encode(&buf, fset, f); err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		fset2, f2, err := astgob.Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+
+		if len(f2.Stmts) != len(f.Stmts) {
+			t.Errorf("%s: got %d statements, want %d", file, len(f2.Stmts), len(f.Stmts))
+			continue
+		}
+		for i, s := range f.Stmts {
+			s2 := f2.Stmts[i]
+			if !equal.Stmt(s, s2) {
+				t.Errorf("%s: statement %d: got %#v, want %#v", file, i, s2, s)
+			}
+			if got, want := fset2.Position(s2.Pos()), fset.Position(s.Pos()); got != want {
+				t.Errorf("%s: statement %d at %v, want %v", file, i, got, want)
+			}
+		}
+		if got, want := len(f2.Comments), len(f.Comments); got != want {
+			t.Errorf("%s: got %d comments, want %d", file, got, want)
+		}
+	}
+}
+
+func TestMethodik(t *testing.T) {
+	src := "methodik T struct{} {\n\tfunc (t) F() {}\n}\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "m.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := astgob.Encode(&buf, fset, f); err != nil {
+		t.Fatal(err)
+	}
+	_, f2, err := astgob.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := f2.Stmts[0].(*stmt.MethodikDecl)
+	if m.Type.Methods[0] != m.Methods[0].Type {
+		t.Errorf("method type not shared with the methodik")
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	m := &tipe.Named{Name: "T"}
+	m.Type = &tipe.Pointer{Elem: m}
+	f := &syntax.File{Stmts: []stmt.Stmt{
+		&stmt.Simple{Expr: &expr.Type{Type: m}},
+	}}
+	var buf bytes.Buffer
+	if err := astgob.Encode(&buf, token.NewFileSet(), f); err == nil {
+		t.Error("encoding a recursive type succeeded, want error")
+	}
+}
@@ -0,0 +1,601 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package astjson encodes Neugram syntax trees as JSON, so tools
+// written in other languages can consume the output of the parser.
+//
+// Every syntax node is a JSON object. Its "Kind" member names the
+// node's Go type, such as "expr.Binary", "stmt.If", or "tipe.Map",
+// and the remaining members are the node's fields in declaration
+// order, under their Go names. Fields holding an interface, such as
+// the Left of an expr.Binary, therefore say which kind of node they
+// hold. Other values are encoded as follows:
+//
+//	nil node, slice, or map  null
+//	token.Token              its string form, e.g. "+" or "LeftParen"
+//	tipe.Basic, tipe.Builtin {"Kind": "tipe.Basic", "Value": "int"}
+//	expr.BasicLiteral Value  {"Kind": "int", "Value": "12"}
+//	expr.Bad Error           the error message
+//
+// The kinds of a BasicLiteral Value are "string", "rune" (a number),
+// "int", "float", and "imaginary". Numbers are encoded as strings in
+// Go syntax, so they do not lose precision.
+//
+// A *tipe.Named is encoded in full the first time it appears,
+// with an "ID" member. Later appearances, including recursive ones,
+// are {"Kind": "tipe.Named", "Ref": ID}.
+//
+// If Marshal is given a FileSet, the source range of a node is
+// encoded as "Pos" and "End" members holding a token.Position.
+// Unmarshal ignores them: the nodes it returns have no positions.
+// The GoPkg of a tipe.Package is not encoded.
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+var (
+	kinds = make(map[string]reflect.Type) // kind name -> struct or string type
+
+	spanType    = reflect.TypeOf(expr.Span{})
+	typeSpan    = reflect.TypeOf(tipe.Span{})
+	tokenType   = reflect.TypeOf(token.Token(0))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	literalType = reflect.TypeOf(expr.BasicLiteral{})
+	packageType = reflect.TypeOf(tipe.Package{})
+	namedType   = reflect.TypeOf(tipe.Named{})
+)
+
+func init() {
+	for _, n := range []interface{}{
+		syntax.File{},
+
+		expr.Comment{},
+		expr.CommentGroup{},
+
+		expr.Binary{},
+		expr.Unary{},
+		expr.Bad{},
+		expr.Selector{},
+		expr.TypeAssert{},
+		expr.Slice{},
+		expr.Index{},
+		expr.BasicLiteral{},
+		expr.FuncLiteral{},
+		expr.CompLiteral{},
+		expr.MapLiteral{},
+		expr.ArrayLiteral{},
+		expr.SliceLiteral{},
+		expr.TableLiteral{},
+		expr.Type{},
+		expr.Ident{},
+		expr.Call{},
+		expr.ShellList{},
+		expr.ShellAndOr{},
+		expr.ShellPipeline{},
+		expr.ShellCmd{},
+		expr.ShellSimpleCmd{},
+		expr.ShellRedirect{},
+		expr.ShellAssign{},
+		expr.Shell{},
+
+		stmt.Import{},
+		stmt.ImportSet{},
+		stmt.TypeDecl{},
+		stmt.MethodikDecl{},
+		stmt.Const{},
+		stmt.ConstSet{},
+		stmt.Var{},
+		stmt.VarSet{},
+		stmt.Assign{},
+		stmt.Block{},
+		stmt.If{},
+		stmt.For{},
+		stmt.Switch{},
+		stmt.SwitchCase{},
+		stmt.TypeSwitch{},
+		stmt.TypeSwitchCase{},
+		stmt.Go{},
+		stmt.Defer{},
+		stmt.Range{},
+		stmt.Return{},
+		stmt.Simple{},
+		stmt.Select{},
+		stmt.SelectCase{},
+		stmt.Send{},
+		stmt.Branch{},
+		stmt.Labeled{},
+		stmt.Bad{},
+
+		tipe.Basic(""),
+		tipe.Builtin(""),
+		tipe.Func{},
+		tipe.Struct{},
+		tipe.Named{},
+		tipe.Array{},
+		tipe.Slice{},
+		tipe.Table{},
+		tipe.Tuple{},
+		tipe.Pointer{},
+		tipe.Chan{},
+		tipe.Map{},
+		tipe.Package{},
+		tipe.Interface{},
+		tipe.Alias{},
+		tipe.Unresolved{},
+		tipe.TypeParam{},
+	} {
+		t := reflect.TypeOf(n)
+		kinds[t.String()] = t
+	}
+}
+
+// isNode reports whether values of t are encoded with a Kind.
+func isNode(t reflect.Type) bool {
+	return kinds[t.String()] == t
+}
+
+// Marshal returns the JSON encoding of node, which is an expr.Expr,
+// stmt.Stmt, tipe.Type, or *syntax.File. If fset is not nil, it is
+// used to resolve the positions of nodes.
+func Marshal(fset *token.FileSet, node interface{}) ([]byte, error) {
+	e := &encoder{
+		fset: fset,
+		ids:  make(map[*tipe.Named]int),
+	}
+	if err := e.iface(reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	fset *token.FileSet
+	buf  bytes.Buffer
+	ids  map[*tipe.Named]int
+}
+
+func (e *encoder) json(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("astjson: %v", err)
+	}
+	e.buf.Write(b)
+	return nil
+}
+
+// iface encodes the node held by the interface value v.
+func (e *encoder) iface(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	x := v.Elem()
+	switch {
+	case x.Kind() == reflect.String && isNode(x.Type()):
+		e.buf.WriteString(`{"Kind":`)
+		e.json(x.Type().String())
+		e.buf.WriteString(`,"Value":`)
+		e.json(x.String())
+		e.buf.WriteByte('}')
+		return nil
+	case x.Kind() == reflect.Ptr && isNode(x.Type().Elem()):
+		return e.value(x)
+	}
+	return fmt.Errorf("astjson: cannot encode %s as a node", x.Type())
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	switch v.Type() {
+	case tokenType:
+		return e.json(v.Interface().(token.Token).String())
+	case errorType:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		return e.json(v.Interface().(error).Error())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		return e.iface(v)
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		if m, ok := v.Interface().(*tipe.Named); ok {
+			if id := e.ids[m]; id != 0 {
+				e.buf.WriteString(`{"Kind":"tipe.Named","Ref":`)
+				e.json(id)
+				e.buf.WriteByte('}')
+				return nil
+			}
+			e.ids[m] = len(e.ids) + 1
+		}
+		return e.value(v.Elem())
+	case reflect.Struct:
+		return e.object(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		e.buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		var keys []string
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		e.buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.json(k)
+			e.buf.WriteByte(':')
+			if err := e.value(v.MapIndex(reflect.ValueOf(k))); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+		return nil
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return e.json(v.Interface())
+	}
+	return fmt.Errorf("astjson: cannot encode value of type %s", v.Type())
+}
+
+// object encodes a struct. Nodes are prefixed with their Kind.
+func (e *encoder) object(v reflect.Value) error {
+	t := v.Type()
+	first := true
+	member := func(name string) {
+		if first {
+			e.buf.WriteByte('{')
+			first = false
+		} else {
+			e.buf.WriteByte(',')
+		}
+		e.json(name)
+		e.buf.WriteByte(':')
+	}
+	if isNode(t) {
+		member("Kind")
+		e.json(t.String())
+	}
+	if t == namedType && v.CanAddr() {
+		member("ID")
+		e.json(e.ids[v.Addr().Interface().(*tipe.Named)])
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch {
+		case f.Type == spanType, f.Type == typeSpan:
+			if e.fset == nil {
+				continue
+			}
+			var span expr.Span
+			switch s := v.Field(i).Interface().(type) {
+			case expr.Span:
+				span = s
+			case tipe.Span:
+				span = expr.Span(s)
+			}
+			if span.From.IsValid() {
+				member("Pos")
+				e.json(e.fset.Position(span.From))
+			}
+			if span.To.IsValid() {
+				member("End")
+				e.json(e.fset.Position(span.To))
+			}
+		case f.PkgPath != "":
+			// unexported
+		case t == packageType && f.Name == "GoPkg":
+			// not encoded
+		case t == literalType && f.Name == "Value":
+			member(f.Name)
+			if err := e.literal(v.Field(i).Interface()); err != nil {
+				return err
+			}
+		default:
+			member(f.Name)
+			if err := e.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	if first {
+		e.buf.WriteByte('{')
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func (e *encoder) literal(v interface{}) error {
+	var kind string
+	var val interface{}
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteString("null")
+		return nil
+	case string:
+		kind, val = "string", v
+	case rune:
+		kind, val = "rune", v
+	case *big.Int:
+		kind, val = "int", v.String()
+	case *big.Float:
+		kind, val = "float", v.Text('g', -1)
+	case expr.Imaginary:
+		kind, val = "imaginary", v.Imag.Text('g', -1)
+	default:
+		return fmt.Errorf("astjson: cannot encode literal of type %T", v)
+	}
+	e.buf.WriteString(`{"Kind":`)
+	e.json(kind)
+	e.buf.WriteString(`,"Value":`)
+	e.json(val)
+	e.buf.WriteByte('}')
+	return nil
+}
+
+// Unmarshal decodes a syntax tree encoded by Marshal.
+func Unmarshal(data []byte) (node interface{}, err error) {
+	d := &decoder{ids: make(map[int]*tipe.Named)}
+	if err := d.value(data, reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+type decoder struct {
+	ids map[int]*tipe.Named
+}
+
+func (d *decoder) unmarshal(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("astjson: %v", err)
+	}
+	return nil
+}
+
+// value decodes data into the settable value v.
+func (d *decoder) value(data []byte, v reflect.Value) error {
+	if string(data) == "null" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Type() {
+	case tokenType:
+		var s string
+		if err := d.unmarshal(data, &s); err != nil {
+			return err
+		}
+		t, ok := token.Lookup(s)
+		if !ok {
+			return fmt.Errorf("astjson: unknown token %q", s)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case errorType:
+		var s string
+		if err := d.unmarshal(data, &s); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(errors.New(s)))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		x, err := d.node(data)
+		if err != nil {
+			return err
+		}
+		if !x.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("astjson: cannot use %s as %s", x.Type(), v.Type())
+		}
+		v.Set(x)
+		return nil
+	case reflect.Ptr:
+		if !isNode(v.Type().Elem()) {
+			p := reflect.New(v.Type().Elem())
+			if err := d.value(data, p.Elem()); err != nil {
+				return err
+			}
+			v.Set(p)
+			return nil
+		}
+		x, err := d.node(data)
+		if err != nil {
+			return err
+		}
+		if x.Type() != v.Type() {
+			return fmt.Errorf("astjson: cannot use %s as %s", x.Type(), v.Type())
+		}
+		v.Set(x)
+		return nil
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := d.unmarshal(data, &obj); err != nil {
+			return err
+		}
+		return d.fields(obj, v)
+	case reflect.Slice:
+		var elems []json.RawMessage
+		if err := d.unmarshal(data, &elems); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := d.value(elem, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Map:
+		var elems map[string]json.RawMessage
+		if err := d.unmarshal(data, &elems); err != nil {
+			return err
+		}
+		m := reflect.MakeMap(v.Type())
+		for k, elem := range elems {
+			x := reflect.New(v.Type().Elem()).Elem()
+			if err := d.value(elem, x); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), x)
+		}
+		v.Set(m)
+		return nil
+	}
+	return d.unmarshal(data, v.Addr().Interface())
+}
+
+// node decodes an object with a Kind. Struct kinds are returned
+// as pointers.
+func (d *decoder) node(data []byte) (reflect.Value, error) {
+	var obj map[string]json.RawMessage
+	if err := d.unmarshal(data, &obj); err != nil {
+		return reflect.Value{}, err
+	}
+	var kind string
+	if err := d.unmarshal(obj["Kind"], &kind); err != nil {
+		return reflect.Value{}, err
+	}
+	t, ok := kinds[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("astjson: unknown node kind %q", kind)
+	}
+	if t.Kind() == reflect.String {
+		var s string
+		if err := d.unmarshal(obj["Value"], &s); err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+	}
+
+	p := reflect.New(t)
+	if t == namedType {
+		var id int
+		if ref, ok := obj["Ref"]; ok {
+			if err := d.unmarshal(ref, &id); err != nil {
+				return reflect.Value{}, err
+			}
+			m := d.ids[id]
+			if m == nil {
+				return reflect.Value{}, fmt.Errorf("astjson: undefined tipe.Named reference %d", id)
+			}
+			return reflect.ValueOf(m), nil
+		}
+		if err := d.unmarshal(obj["ID"], &id); err != nil {
+			return reflect.Value{}, err
+		}
+		// Register before decoding fields, which may refer to p.
+		d.ids[id] = p.Interface().(*tipe.Named)
+	}
+	if err := d.fields(obj, p.Elem()); err != nil {
+		return reflect.Value{}, err
+	}
+	return p, nil
+}
+
+// fields decodes the members of obj into the fields of the struct v.
+func (d *decoder) fields(obj map[string]json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		data, ok := obj[f.Name]
+		if !ok || f.Type == spanType || f.Type == typeSpan || f.PkgPath != "" {
+			continue
+		}
+		if t == literalType && f.Name == "Value" {
+			val, err := d.literal(data)
+			if err != nil {
+				return err
+			}
+			v.Field(i).Set(reflect.ValueOf(&val).Elem())
+			continue
+		}
+		if err := d.value(data, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) literal(data []byte) (interface{}, error) {
+	if string(data) == "null" {
+		return nil, nil
+	}
+	var lit struct {
+		Kind  string
+		Value json.RawMessage
+	}
+	if err := d.unmarshal(data, &lit); err != nil {
+		return nil, err
+	}
+	if lit.Kind == "rune" {
+		var r rune
+		if err := d.unmarshal(lit.Value, &r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	var s string
+	if err := d.unmarshal(lit.Value, &s); err != nil {
+		return nil, err
+	}
+	switch lit.Kind {
+	case "string":
+		return s, nil
+	case "int":
+		if x, ok := new(big.Int).SetString(s, 10); ok {
+			return x, nil
+		}
+	case "float":
+		if x, ok := big.NewFloat(0).SetString(s); ok {
+			return x, nil
+		}
+	case "imaginary":
+		if x, ok := big.NewFloat(0).SetString(s); ok {
+			return expr.Imaginary{Imag: x}, nil
+		}
+	default:
+		return nil, fmt.Errorf("astjson: unknown literal kind %q", lit.Kind)
+	}
+	return nil, fmt.Errorf("astjson: invalid %s literal %q", lit.Kind, s)
+}
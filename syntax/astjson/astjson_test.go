@@ -0,0 +1,182 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/astjson"
+	"neugram.io/ng/syntax/equal"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+const src = `// Package p is a test.
+package p
+
+import "fmt"
+
+const (
+	a = 1.5
+	b = 'x'
+	c = 2i
+)
+
+var s = []string{"x", "y"}
+
+// T is a list.
+methodik T struct {
+	Next *T
+	Val  int
+} {
+	func (*t) Len() int {
+		if t == nil {
+			return 0
+		}
+		return 1 + t.Next.Len()
+	}
+}
+
+func f(x int, ch chan<- int) (int, error) {
+	switch {
+	case x < 0:
+		return -x, nil
+	default:
+	}
+	select {
+	case ch <- x:
+	}
+	for i, v := range s {
+		fmt.Println(i, v[1:], x &^ 3)
+	}
+	m := map[string]interface{}{"a": nil}
+	_ = m
+	$$ echo hi | wc -l > /dev/null $$
+	return x, nil
+}
+`
+
+func roundTrip(t *testing.T, node interface{}) (interface{}, []byte) {
+	data, err := astjson.Marshal(nil, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := astjson.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, data)
+	}
+	data2, err := astjson.Marshal(nil, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, data2) {
+		t.Errorf("round trip changed encoding:\n%s\n%s", data, data2)
+	}
+	return got, data
+}
+
+func TestRoundTrip(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "p.ng", []byte(src), parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := roundTrip(t, f)
+	f2, ok := got.(*syntax.File)
+	if !ok {
+		t.Fatalf("Unmarshal returned %T, want *syntax.File", got)
+	}
+	if f2.Package != "p" || f2.Doc.Text() != "Package p is a test.\n" {
+		t.Errorf("package %q, doc %q", f2.Package, f2.Doc.Text())
+	}
+	if len(f2.Stmts) != len(f.Stmts) {
+		t.Fatalf("got %d statements, want %d", len(f2.Stmts), len(f.Stmts))
+	}
+	for i, s := range f.Stmts {
+		if !equal.Stmt(s, f2.Stmts[i]) {
+			t.Errorf("statement %d: got %#v, want %#v", i, f2.Stmts[i], s)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s, err := parser.ParseStmt([]byte("x + 12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := astjson.Marshal(nil, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Kind":"stmt.Simple","Expr":{"Kind":"expr.Binary","Op":"+",` +
+		`"Left":{"Kind":"expr.Ident","Name":"x"},` +
+		`"Right":{"Kind":"expr.BasicLiteral","Value":{"Kind":"int","Value":"12"}}}}`
+	if string(data) != want {
+		t.Errorf("Marshal:\n got %s\nwant %s", data, want)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pos.ng", []byte("x := 1\ny := x\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := astjson.Marshal(fset, f.Stmts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj struct {
+		Pos, End token.Position
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := obj.Pos.String(), "pos.ng:2:1"; got != want {
+		t.Errorf("Pos=%s, want %s", got, want)
+	}
+	if got, want := obj.End.String(), "pos.ng:2:7"; got != want {
+		t.Errorf("End=%s, want %s", got, want)
+	}
+
+	got, _ := roundTrip(t, f.Stmts[1])
+	if pos := got.(*stmt.Assign).Pos(); pos != token.NoPos {
+		t.Errorf("decoded Pos=%d, want NoPos", pos)
+	}
+}
+
+func TestRecursiveType(t *testing.T) {
+	// methodik T struct { next *T }
+	m := &tipe.Named{Name: "T"}
+	m.Type = &tipe.Struct{
+		FieldNames: []string{"next"},
+		Fields:     []tipe.Type{&tipe.Pointer{Elem: m}},
+	}
+	got, _ := roundTrip(t, &expr.Type{Type: m})
+	m2 := got.(*expr.Type).Type.(*tipe.Named)
+	if m2.Type.(*tipe.Struct).Fields[0].(*tipe.Pointer).Elem != m2 {
+		t.Errorf("recursive reference not preserved")
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	tests := []string{
+		`{"Kind":"expr.Nope"}`,
+		`{"Kind":"expr.Binary","Op":"nope"}`,
+		`{"Kind":"stmt.Simple","Expr":{"Kind":"stmt.Bad"}}`,
+		`{"Kind":"tipe.Named","Ref":3}`,
+		`[`,
+	}
+	for _, test := range tests {
+		if _, err := astjson.Unmarshal([]byte(test)); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", test)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package clone makes deep copies of Neugram syntax trees.
+//
+// A copy shares no mutable state with the original, so a pass can
+// rewrite it freely. Pointers shared within the original, such as
+// a recursive *tipe.Named, are shared the same way in the copy.
+// Source positions are copied unchanged.
+//
+// Some values are not part of the tree and are not copied: errors,
+// imported packages (*tipe.Package), and the predeclared aliases
+// tipe.Byte and tipe.Rune, which are compared by identity.
+package clone
+
+import (
+	"math/big"
+	"reflect"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// Expr returns a deep copy of e.
+func Expr(e expr.Expr) expr.Expr {
+	if e == nil {
+		return nil
+	}
+	return Node(e).(expr.Expr)
+}
+
+// Stmt returns a deep copy of s.
+func Stmt(s stmt.Stmt) stmt.Stmt {
+	if s == nil {
+		return nil
+	}
+	return Node(s).(stmt.Stmt)
+}
+
+// Type returns a deep copy of t.
+func Type(t tipe.Type) tipe.Type {
+	if t == nil {
+		return nil
+	}
+	return Node(t).(tipe.Type)
+}
+
+// Node returns a deep copy of n, which may be any kind of node,
+// or a *syntax.File.
+func Node(n interface{}) interface{} {
+	c := &cloner{copies: make(map[interface{}]reflect.Value)}
+	return c.copy(reflect.ValueOf(&n).Elem()).Interface()
+}
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType   = reflect.TypeOf((*big.Int)(nil))
+	bigFloatType = reflect.TypeOf((*big.Float)(nil))
+)
+
+// shared reports whether the pointer p is shared by copies.
+func shared(p interface{}) bool {
+	switch p := p.(type) {
+	case *tipe.Package:
+		return true
+	case *tipe.Alias:
+		return p == tipe.Byte || p == tipe.Rune
+	}
+	return false
+}
+
+type cloner struct {
+	copies map[interface{}]reflect.Value // original pointer -> copy
+}
+
+func (c *cloner) copy(v reflect.Value) reflect.Value {
+	switch v.Type() {
+	case errorType:
+		return v
+	case bigIntType:
+		if v.IsNil() {
+			return v
+		}
+		return reflect.ValueOf(new(big.Int).Set(v.Interface().(*big.Int)))
+	case bigFloatType:
+		if v.IsNil() {
+			return v
+		}
+		return reflect.ValueOf(new(big.Float).Copy(v.Interface().(*big.Float)))
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		out := reflect.New(v.Type()).Elem()
+		if !v.IsNil() {
+			out.Set(c.copy(v.Elem()))
+		}
+		return out
+	case reflect.Ptr:
+		if v.IsNil() || shared(v.Interface()) {
+			return v
+		}
+		if p, ok := c.copies[v.Interface()]; ok {
+			return p
+		}
+		p := reflect.New(v.Type().Elem())
+		c.copies[v.Interface()] = p // before the fields, which may refer to v
+		p.Elem().Set(c.copy(v.Elem()))
+		return p
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(c.copy(v.Field(i)))
+			}
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			out.SetMapIndex(k, c.copy(v.MapIndex(k)))
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clone_test
+
+import (
+	"math/big"
+	"testing"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/clone"
+	"neugram.io/ng/syntax/equal"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+const src = `// T counts.
+methodik T struct { n int } {
+	func (*t) Inc() { t.n++ }
+}
+
+x := 1.5
+for i := 0; i < 3; i++ {
+	switch i {
+	case 1:
+		x = x * 2
+	}
+}
+m := map[string][]int{"a": []int{1, 2}}
+$$ echo hi $$
+`
+
+func TestClone(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "c.ng", []byte(src), parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2 := clone.Node(f).(*syntax.File)
+	if !equal.Node(f, f2) {
+		t.Fatalf("copy differs: %v", equal.Diff(f, f2))
+	}
+
+	// No node of the original appears in the copy.
+	orig := make(map[walk.Node]bool)
+	for _, s := range f.Stmts {
+		walk.Inspect(s, func(n walk.Node) bool {
+			switch n.(type) {
+			case nil, tipe.Basic:
+			default:
+				orig[n] = true
+			}
+			return true
+		})
+	}
+	for _, s := range f2.Stmts {
+		walk.Inspect(s, func(n walk.Node) bool {
+			if orig[n] {
+				t.Errorf("copy shares %T with the original", n)
+			}
+			return true
+		})
+	}
+
+	// Sharing within the original is kept.
+	m := f2.Stmts[0].(*stmt.MethodikDecl)
+	if m.Type.Methods[0] != m.Methods[0].Type {
+		t.Errorf("method type not shared with the methodik")
+	}
+
+	// Rewriting the copy leaves the original alone.
+	lit := f2.Stmts[1].(*stmt.Assign).Right[0].(*expr.BasicLiteral)
+	lit.Value.(*big.Float).SetInt64(7)
+	if !equal.Node(f, clone.Node(f)) || equal.Node(f, f2) {
+		t.Error("rewriting the copy changed the original")
+	}
+}
+
+func TestCloneRecursiveType(t *testing.T) {
+	m := &tipe.Named{Name: "T"}
+	m.Type = &tipe.Struct{
+		FieldNames: []string{"next", "b"},
+		Fields:     []tipe.Type{&tipe.Pointer{Elem: m}, tipe.Byte},
+	}
+	m2 := clone.Type(m).(*tipe.Named)
+	if m2 == m {
+		t.Fatal("Type returned the original")
+	}
+	st := m2.Type.(*tipe.Struct)
+	if st.Fields[0].(*tipe.Pointer).Elem != m2 {
+		t.Error("recursive reference does not refer to the copy")
+	}
+	if st.Fields[1] != tipe.Byte {
+		t.Error("tipe.Byte was copied")
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	if clone.Expr(nil) != nil || clone.Stmt(nil) != nil || clone.Type(nil) != nil || clone.Node(nil) != nil {
+		t.Error("copy of nil is not nil")
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package equal compares Neugram syntax trees.
+//
+// Two trees are equal if they have the same shape and every field
+// of every node is equal, except source positions, which are
+// ignored. Nil and empty slices are equal, numeric literals are
+// compared by value, and errors by their messages.
+//
+// The comparison is driven by reflection, so new node kinds and
+// fields are covered without changes to this package.
+package equal
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// Expr reports whether x and y are the same expression.
+func Expr(x, y expr.Expr) bool { return Node(x, y) }
+
+// Stmt reports whether x and y are the same statement.
+func Stmt(x, y stmt.Stmt) bool { return Node(x, y) }
+
+// Type reports whether x and y are the same type.
+func Type(x, y tipe.Type) bool { return Node(x, y) }
+
+// Node reports whether x and y are the same syntax tree. They may
+// be any kind of node, or a *syntax.File.
+func Node(x, y interface{}) bool {
+	d := &differ{limit: 1}
+	d.diff("", reflect.ValueOf(&x).Elem(), reflect.ValueOf(&y).Elem())
+	return len(d.diffs) == 0
+}
+
+// A Difference is a place where two syntax trees differ.
+type Difference struct {
+	// Path locates the difference from the root of the trees, as
+	// a sequence of field selectors and indexes, e.g.
+	// ".Body.Stmts[1].Left". It is empty for the roots.
+	Path string
+
+	// X and Y are the differing values. At a path with nodes of
+	// different kinds, they are the nodes. If one tree has an
+	// element of a slice or map that the other does not, the
+	// missing value is nil.
+	X, Y interface{}
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%s: %s != %s", path, describe(d.X), describe(d.Y))
+}
+
+// describe formats a differing value. Nodes are described by type.
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "missing"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case *big.Int, *big.Float, error, fmt.Stringer:
+		return fmt.Sprint(v)
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Ptr, reflect.Struct, reflect.Slice, reflect.Map, reflect.Interface:
+		return fmt.Sprintf("%T", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// Diff returns the differences between the syntax trees x and y,
+// in depth-first order. It returns nil if Node(x, y) is true.
+func Diff(x, y interface{}) []Difference {
+	d := new(differ)
+	d.diff("", reflect.ValueOf(&x).Elem(), reflect.ValueOf(&y).Elem())
+	return d.diffs
+}
+
+// DiffExpr returns the differences between the expressions x and y.
+func DiffExpr(x, y expr.Expr) []Difference { return Diff(x, y) }
+
+// DiffStmt returns the differences between the statements x and y.
+func DiffStmt(x, y stmt.Stmt) []Difference { return Diff(x, y) }
+
+var (
+	spanType     = reflect.TypeOf(expr.Span{})
+	typeSpanType = reflect.TypeOf(tipe.Span{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType   = reflect.TypeOf((*big.Int)(nil))
+	bigFloatType = reflect.TypeOf((*big.Float)(nil))
+	packageType  = reflect.TypeOf(tipe.Package{})
+)
+
+type differ struct {
+	diffs []Difference
+	limit int // stop after limit differences, if > 0
+
+	// seen holds the pairs of named types being compared, so
+	// recursive types terminate.
+	seen map[[2]*tipe.Named]bool
+}
+
+func (d *differ) done() bool {
+	return d.limit > 0 && len(d.diffs) >= d.limit
+}
+
+func (d *differ) add(path string, x, y interface{}) {
+	d.diffs = append(d.diffs, Difference{Path: path, X: x, Y: y})
+}
+
+func iface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (d *differ) diff(path string, x, y reflect.Value) {
+	if d.done() {
+		return
+	}
+	if x.Type() != y.Type() {
+		d.add(path, iface(x), iface(y))
+		return
+	}
+
+	switch x.Type() {
+	case errorType:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.add(path, iface(x), iface(y))
+			}
+		} else if x.Interface().(error).Error() != y.Interface().(error).Error() {
+			d.add(path, iface(x), iface(y))
+		}
+		return
+	case bigIntType:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.add(path, iface(x), iface(y))
+			}
+		} else if x.Interface().(*big.Int).Cmp(y.Interface().(*big.Int)) != 0 {
+			d.add(path, iface(x), iface(y))
+		}
+		return
+	case bigFloatType:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.add(path, iface(x), iface(y))
+			}
+		} else if x.Interface().(*big.Float).Cmp(y.Interface().(*big.Float)) != 0 {
+			d.add(path, iface(x), iface(y))
+		}
+		return
+	}
+
+	switch x.Kind() {
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.add(path, iface(x), iface(y))
+			}
+			return
+		}
+		x, y = x.Elem(), y.Elem()
+		if x.Type() != y.Type() {
+			d.add(path, x.Interface(), y.Interface())
+			return
+		}
+		d.diff(path, x, y)
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.add(path, x.Interface(), y.Interface())
+			}
+			return
+		}
+		if x.Pointer() == y.Pointer() {
+			return
+		}
+		if mx, ok := x.Interface().(*tipe.Named); ok {
+			pair := [2]*tipe.Named{mx, y.Interface().(*tipe.Named)}
+			if d.seen[pair] {
+				return
+			}
+			if d.seen == nil {
+				d.seen = make(map[[2]*tipe.Named]bool)
+			}
+			d.seen[pair] = true
+		}
+		d.diff(path, x.Elem(), y.Elem())
+	case reflect.Struct:
+		t := x.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			switch {
+			case f.Type == spanType, f.Type == typeSpanType, f.PkgPath != "":
+				// positions and unexported fields are ignored
+			case t == packageType && f.Name == "GoPkg":
+				if x.Field(i).Interface() != y.Field(i).Interface() {
+					d.add(path+".GoPkg", x.Field(i).Interface(), y.Field(i).Interface())
+				}
+			default:
+				d.diff(path+"."+f.Name, x.Field(i), y.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		n := x.Len()
+		if y.Len() > n {
+			n = y.Len()
+		}
+		for i := 0; i < n; i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= x.Len():
+				d.add(p, nil, y.Index(i).Interface())
+			case i >= y.Len():
+				d.add(p, x.Index(i).Interface(), nil)
+			default:
+				d.diff(p, x.Index(i), y.Index(i))
+			}
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, k := range x.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, k := range y.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			k := keys[name]
+			p := fmt.Sprintf("%s[%q]", path, name)
+			xv, yv := x.MapIndex(k), y.MapIndex(k)
+			switch {
+			case !xv.IsValid():
+				d.add(p, nil, yv.Interface())
+			case !yv.IsValid():
+				d.add(p, xv.Interface(), nil)
+			default:
+				d.diff(p, xv, yv)
+			}
+		}
+	default:
+		if x.Interface() != y.Interface() {
+			d.add(path, x.Interface(), y.Interface())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package equal_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax/equal"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+func ident(name string) *expr.Ident { return &expr.Ident{Name: name} }
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		x, y interface{}
+		want bool
+	}{
+		{nil, nil, true},
+		{ident("x"), nil, false},
+		{ident("x"), ident("x"), true},
+		{ident("x"), ident("y"), false},
+		{
+			&expr.Ident{Span: expr.Span{From: 1, To: 2}, Name: "x"},
+			&expr.Ident{Span: expr.Span{From: 7, To: 8}, Name: "x"},
+			true,
+		},
+		{ident("x"), &expr.BasicLiteral{Value: "x"}, false},
+		{&expr.BasicLiteral{Value: big.NewInt(2)}, &expr.BasicLiteral{Value: big.NewInt(2)}, true},
+		{&expr.BasicLiteral{Value: big.NewFloat(2)}, &expr.BasicLiteral{Value: big.NewInt(2)}, false},
+		{&expr.Bad{Error: errors.New("e")}, &expr.Bad{Error: errors.New("e")}, true},
+		{&stmt.Block{}, &stmt.Block{Stmts: []stmt.Stmt{}}, true},
+		{&stmt.Return{}, &stmt.Return{Exprs: []expr.Expr{ident("x")}}, false},
+		{
+			&tipe.Interface{Methods: map[string]*tipe.Func{"M": {}}},
+			&tipe.Interface{Methods: map[string]*tipe.Func{"M": {}}},
+			true,
+		},
+		{
+			&tipe.Interface{Methods: map[string]*tipe.Func{"M": {}}},
+			&tipe.Interface{Methods: map[string]*tipe.Func{"N": {}}},
+			false,
+		},
+	}
+	for _, test := range tests {
+		if got := equal.Node(test.x, test.y); got != test.want {
+			t.Errorf("Node(%#v, %#v)=%v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestRecursiveType(t *testing.T) {
+	list := func() *tipe.Named {
+		m := &tipe.Named{Name: "T"}
+		m.Type = &tipe.Struct{
+			FieldNames: []string{"next"},
+			Fields:     []tipe.Type{&tipe.Pointer{Elem: m}},
+		}
+		return m
+	}
+	if !equal.Type(list(), list()) {
+		t.Error("recursive types are not equal")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	x := &stmt.Block{Stmts: []stmt.Stmt{
+		&stmt.Assign{
+			Left:  []expr.Expr{ident("a")},
+			Right: []expr.Expr{&expr.Binary{Op: token.Add, Left: ident("b"), Right: ident("c")}},
+		},
+		&stmt.Return{},
+	}}
+	y := &stmt.Block{Stmts: []stmt.Stmt{
+		&stmt.Assign{
+			Decl:  true,
+			Left:  []expr.Expr{ident("a")},
+			Right: []expr.Expr{&expr.Binary{Op: token.Sub, Left: ident("b"), Right: ident("d")}},
+		},
+	}}
+	want := []string{
+		`.Stmts[0].Decl: false != true`,
+		`.Stmts[0].Right[0].Op: + != -`,
+		`.Stmts[0].Right[0].Right.Name: "c" != "d"`,
+		`.Stmts[1]: *stmt.Return != missing`,
+	}
+	got := equal.DiffStmt(x, y)
+	if len(got) != len(want) {
+		t.Fatalf("DiffStmt returned %d differences, want %d: %v", len(got), len(want), got)
+	}
+	for i, d := range got {
+		if d.String() != want[i] {
+			t.Errorf("difference %d: %s, want %s", i, d, want[i])
+		}
+	}
+	if got[3].X != x.Stmts[1] || got[3].Y != nil {
+		t.Errorf("missing statement: X=%v, Y=%v", got[3].X, got[3].Y)
+	}
+
+	if d := equal.DiffExpr(ident("x"), &expr.Unary{}); len(d) != 1 || d[0].String() != "(root): *expr.Ident != *expr.Unary" {
+		t.Errorf("DiffExpr of different kinds: %v", d)
+	}
+	if d := equal.Diff(x, x); d != nil {
+		t.Errorf("Diff of a tree with itself: %v", d)
+	}
+}
@@ -0,0 +1,798 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goast
+
+import (
+	"fmt"
+	"go/ast"
+	gotoken "go/token"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/clone"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+// FromExpr converts the Go expression x to Neugram.
+func FromExpr(x ast.Expr) (e expr.Expr, err error) {
+	defer catch(&err)
+	return fromExpr(x), nil
+}
+
+// FromStmt converts the Go statement x to Neugram.
+// An empty statement converts to nil.
+func FromStmt(x ast.Stmt) (s stmt.Stmt, err error) {
+	defer catch(&err)
+	ss := fromStmt(x)
+	switch len(ss) {
+	case 0:
+		return nil, nil
+	case 1:
+		return ss[0], nil
+	}
+	errorf("grouped type declaration has no single Neugram statement")
+	panic("unreachable")
+}
+
+// FromType converts the Go type expression x to Neugram.
+func FromType(x ast.Expr) (t tipe.Type, err error) {
+	defer catch(&err)
+	return fromType(x), nil
+}
+
+// FromFile converts the Go file f to Neugram.
+//
+// Each type with methods becomes a methodik. In package main,
+// the body of func main is appended to the file as top-level
+// statements.
+func FromFile(f *ast.File) (file *syntax.File, err error) {
+	defer catch(&err)
+
+	file = &syntax.File{Package: f.Name.Name}
+	isMain := func(d *ast.FuncDecl) bool {
+		return f.Name.Name == "main" && d.Recv == nil && d.Name.Name == "main" &&
+			len(d.Type.Params.List) == 0 && d.Type.Results == nil
+	}
+
+	// Types with methods are methodiks.
+	methodiks := make(map[string]*stmt.MethodikDecl)
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.FuncDecl); ok && d.Recv != nil {
+			name, _ := receiver(d)
+			methodiks[name] = nil
+		}
+	}
+
+	var main []stmt.Stmt
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			for _, s := range fromGenDecl(d) {
+				if td, ok := s.(*stmt.TypeDecl); ok && !td.Alias {
+					if m, ok := methodiks[td.Name]; ok {
+						if m != nil {
+							errorf("type %s redeclared", td.Name)
+						}
+						m = &stmt.MethodikDecl{
+							Name: td.Name,
+							Type: &tipe.Named{Name: td.Name, Type: td.Type},
+						}
+						methodiks[td.Name] = m
+						s = m
+					}
+				}
+				file.Stmts = append(file.Stmts, s)
+			}
+		case *ast.FuncDecl:
+			if isMain(d) {
+				main = fromStmts(d.Body.List)
+				continue
+			}
+			fn := funcLit(d.Type)
+			fn.Name = d.Name.Name
+			fn.Body = fromBlock(d.Body)
+			if d.Recv == nil {
+				file.Stmts = append(file.Stmts, &stmt.Simple{Expr: fn})
+				continue
+			}
+			name, ptr := receiver(d)
+			m := methodiks[name]
+			if m == nil {
+				errorf("methods of %s declared before or without its type", name)
+			}
+			fn.PointerReceiver = ptr
+			fn.ReceiverName = "_"
+			if names := d.Recv.List[0].Names; len(names) > 0 {
+				fn.ReceiverName = names[0].Name
+			}
+			m.Type.MethodNames = append(m.Type.MethodNames, fn.Name)
+			m.Type.Methods = append(m.Type.Methods, fn.Type)
+			m.Type.PointerReceivers = append(m.Type.PointerReceivers, ptr)
+			m.Methods = append(m.Methods, fn)
+		default:
+			errorf("bad declaration")
+		}
+	}
+	file.Stmts = append(file.Stmts, main...)
+	return file, nil
+}
+
+// FromPackage converts the files of the Go package to a single
+// Neugram file.
+//
+// A Neugram file declares a name before using it, so the imports
+// come first, and the other declarations follow those they refer
+// to, otherwise keeping their order in the files. The files must
+// not import different packages with the same name.
+func FromPackage(files []*ast.File) (file *syntax.File, err error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("goast: package has no files")
+	}
+	merged := &ast.File{Name: files[0].Name}
+	imports := &ast.GenDecl{Tok: gotoken.IMPORT}
+	paths := make(map[string]string) // import path by name
+	for _, f := range files {
+		if f.Name.Name != merged.Name.Name {
+			return nil, fmt.Errorf("goast: files of packages %s and %s", merged.Name.Name, f.Name.Name)
+		}
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("goast: bad import path %s", spec.Path.Value)
+			}
+			name := path[strings.LastIndex(path, "/")+1:]
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			if prev, dup := paths[name]; dup {
+				if prev != path {
+					return nil, fmt.Errorf("goast: %s imported as both %q and %q", name, prev, path)
+				}
+				continue
+			}
+			paths[name] = path
+			imports.Specs = append(imports.Specs, spec)
+		}
+	}
+	if len(imports.Specs) > 0 {
+		merged.Decls = append(merged.Decls, imports)
+	}
+	// FromFile expects the methods of a type to follow it, which
+	// they do after the types of every file.
+	var funcs []ast.Decl
+	for _, f := range files {
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.GenDecl:
+				if d.Tok != gotoken.IMPORT {
+					merged.Decls = append(merged.Decls, d)
+				}
+			default:
+				funcs = append(funcs, d)
+			}
+		}
+	}
+	merged.Decls = append(merged.Decls, funcs...)
+	file, err = FromFile(merged)
+	if err != nil {
+		return nil, err
+	}
+	file.Stmts = declOrder(file.Stmts)
+	return file, nil
+}
+
+// declOrder orders the statements of a file so that each follows
+// the declarations it refers to. Imports come first, and statements
+// that declare nothing last. Declarations that refer to each other,
+// as mutually recursive functions do, keep their order.
+func declOrder(stmts []stmt.Stmt) []stmt.Stmt {
+	decl := make(map[string]int) // index of the statement declaring a name
+	for i, s := range stmts {
+		for _, name := range declNames(s) {
+			decl[name] = i
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(stmts))
+	var res []stmt.Stmt
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != unvisited {
+			return
+		}
+		state[i] = visiting
+		walk.Inspect(stmts[i], func(n walk.Node) bool {
+			var name string
+			switch n := n.(type) {
+			case *expr.Ident:
+				name = n.Name
+			case *tipe.Unresolved:
+				if n.Package != "" {
+					return true
+				}
+				name = n.Name
+			default:
+				return true
+			}
+			if j, ok := decl[name]; ok && j != i {
+				visit(j)
+			}
+			return true
+		})
+		state[i] = visited
+		res = append(res, stmts[i])
+	}
+	for i, s := range stmts {
+		switch s.(type) {
+		case *stmt.Import, *stmt.ImportSet:
+			visit(i)
+		}
+	}
+	for i, s := range stmts {
+		if len(declNames(s)) > 0 {
+			visit(i)
+		}
+	}
+	for i := range stmts {
+		visit(i)
+	}
+	return res
+}
+
+// declNames returns the names declared by the top-level statement s.
+func declNames(s stmt.Stmt) []string {
+	switch s := s.(type) {
+	case *stmt.Const:
+		return []string{s.Name}
+	case *stmt.ConstSet:
+		var names []string
+		for _, c := range s.Consts {
+			names = append(names, c.Name)
+		}
+		return names
+	case *stmt.Var:
+		return s.NameList
+	case *stmt.VarSet:
+		var names []string
+		for _, v := range s.Vars {
+			names = append(names, v.NameList...)
+		}
+		return names
+	case *stmt.TypeDecl:
+		return []string{s.Name}
+	case *stmt.MethodikDecl:
+		return []string{s.Name}
+	case *stmt.Simple:
+		if fn, ok := s.Expr.(*expr.FuncLiteral); ok && fn.Name != "" {
+			return []string{fn.Name}
+		}
+	}
+	return nil
+}
+
+// receiver returns the name of the receiver type of the method d,
+// and whether the receiver is a pointer.
+func receiver(d *ast.FuncDecl) (name string, ptr bool) {
+	if len(d.Recv.List) != 1 {
+		errorf("method %s has %d receivers", d.Name.Name, len(d.Recv.List))
+	}
+	t := d.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t, ptr = star.X, true
+	}
+	id, ok := t.(*ast.Ident)
+	if !ok {
+		errorf("method %s has an unsupported receiver type", d.Name.Name)
+	}
+	return id.Name, ptr
+}
+
+func fromExprs(xs []ast.Expr) []expr.Expr {
+	if xs == nil {
+		return nil
+	}
+	es := make([]expr.Expr, len(xs))
+	for i, x := range xs {
+		es[i] = fromExpr(x)
+	}
+	return es
+}
+
+func fromExpr(x ast.Expr) expr.Expr {
+	switch x := x.(type) {
+	case nil:
+		return nil
+	case *ast.BadExpr:
+		errorf("bad expression")
+	case *ast.Ident:
+		return &expr.Ident{Name: x.Name}
+	case *ast.BasicLit:
+		return fromBasicLit(x)
+	case *ast.FuncLit:
+		fn := funcLit(x.Type)
+		fn.Body = fromBlock(x.Body)
+		return fn
+	case *ast.CompositeLit:
+		return compLit(x, nil)
+	case *ast.ParenExpr:
+		return &expr.Unary{Op: token.LeftParen, Expr: fromExpr(x.X)}
+	case *ast.SelectorExpr:
+		return &expr.Selector{Left: fromExpr(x.X), Right: &expr.Ident{Name: x.Sel.Name}}
+	case *ast.IndexExpr:
+		return &expr.Index{Left: fromExpr(x.X), Indicies: []expr.Expr{fromExpr(x.Index)}}
+	case *ast.SliceExpr:
+		return &expr.Index{Left: fromExpr(x.X), Indicies: []expr.Expr{&expr.Slice{
+			Low:  fromExpr(x.Low),
+			High: fromExpr(x.High),
+			Max:  fromExpr(x.Max),
+		}}}
+	case *ast.TypeAssertExpr:
+		return &expr.TypeAssert{Expr: fromExpr(x.X), Type: fromType(x.Type)}
+	case *ast.CallExpr:
+		return &expr.Call{Func: fromExpr(x.Fun), Args: fromExprs(x.Args), Ellipsis: x.Ellipsis.IsValid()}
+	case *ast.StarExpr:
+		return &expr.Unary{Op: token.Mul, Expr: fromExpr(x.X)}
+	case *ast.UnaryExpr:
+		op, ok := fromUnaryOps[x.Op]
+		if !ok {
+			errorf("unary operator %s has no Neugram equivalent", x.Op)
+		}
+		return &expr.Unary{Op: op, Expr: fromExpr(x.X)}
+	case *ast.BinaryExpr:
+		op, ok := fromBinaryOps[x.Op]
+		if !ok {
+			errorf("operator %s has no Neugram equivalent", x.Op)
+		}
+		return &expr.Binary{Op: op, Left: fromExpr(x.X), Right: fromExpr(x.Y)}
+	case *ast.ArrayType, *ast.StructType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.ChanType:
+		return &expr.Type{Type: fromType(x)}
+	}
+	errorf("%T has no Neugram equivalent", x)
+	panic("unreachable")
+}
+
+func fromBasicLit(x *ast.BasicLit) *expr.BasicLiteral {
+	switch x.Kind {
+	case gotoken.INT:
+		if v, ok := new(big.Int).SetString(x.Value, 0); ok {
+			return &expr.BasicLiteral{Value: v}
+		}
+	case gotoken.FLOAT:
+		if v, ok := big.NewFloat(0).SetString(x.Value); ok {
+			return &expr.BasicLiteral{Value: v}
+		}
+	case gotoken.IMAG:
+		if v, ok := big.NewFloat(0).SetString(strings.TrimSuffix(x.Value, "i")); ok {
+			return &expr.BasicLiteral{Value: expr.Imaginary{Imag: v}}
+		}
+	case gotoken.CHAR:
+		if len(x.Value) >= 2 {
+			v, _, tail, err := strconv.UnquoteChar(x.Value[1:len(x.Value)-1], '\'')
+			if err == nil && tail == "" {
+				return &expr.BasicLiteral{Value: v}
+			}
+		}
+	case gotoken.STRING:
+		if v, err := strconv.Unquote(x.Value); err == nil {
+			return &expr.BasicLiteral{Value: v}
+		}
+	}
+	errorf("bad %s literal %s", x.Kind, x.Value)
+	panic("unreachable")
+}
+
+// compLit converts the composite literal x. If x has no type,
+// it is an element of an enclosing literal whose element type,
+// elided, is used in its place.
+func compLit(x *ast.CompositeLit, elided tipe.Type) expr.Expr {
+	t := elided
+	if x.Type != nil {
+		t = fromType(x.Type)
+	} else if t == nil {
+		errorf("composite literal has no type")
+	}
+
+	switch t := t.(type) {
+	case *tipe.Slice:
+		lit := &expr.SliceLiteral{Type: t}
+		for _, el := range x.Elts {
+			lit.Elems = append(lit.Elems, element(el, t.Elem))
+		}
+		return lit
+	case *tipe.Array:
+		lit := &expr.ArrayLiteral{Type: t}
+		for _, el := range x.Elts {
+			lit.Elems = append(lit.Elems, element(el, t.Elem))
+		}
+		return lit
+	case *tipe.Map:
+		lit := &expr.MapLiteral{Type: t}
+		for _, el := range x.Elts {
+			kv, ok := el.(*ast.KeyValueExpr)
+			if !ok {
+				errorf("map literal element has no key")
+			}
+			lit.Keys = append(lit.Keys, element(kv.Key, t.Key))
+			lit.Values = append(lit.Values, element(kv.Value, t.Value))
+		}
+		return lit
+	}
+	lit := &expr.CompLiteral{Type: t}
+	for _, el := range x.Elts {
+		if kv, ok := el.(*ast.KeyValueExpr); ok {
+			lit.Keys = append(lit.Keys, fromExpr(kv.Key))
+			el = kv.Value
+		}
+		lit.Elements = append(lit.Elements, fromExpr(el))
+	}
+	return lit
+}
+
+// element converts an element of a composite literal of type t.
+func element(x ast.Expr, t tipe.Type) expr.Expr {
+	switch x := x.(type) {
+	case *ast.KeyValueExpr:
+		errorf("indexed element has no Neugram equivalent")
+	case *ast.CompositeLit:
+		if x.Type != nil {
+			break
+		}
+		// The elided type is copied so that no two
+		// literals share a type.
+		if p, ok := t.(*tipe.Pointer); ok {
+			return &expr.Unary{Op: token.Ref, Expr: compLit(x, clone.Type(p.Elem))}
+		}
+		return compLit(x, clone.Type(t))
+	}
+	return fromExpr(x)
+}
+
+// funcLit converts the signature of a function. Parameters that
+// share a declaration, as in func(a, b int), share a type.
+func funcLit(ft *ast.FuncType) *expr.FuncLiteral {
+	fn := &expr.FuncLiteral{Type: &tipe.Func{Params: &tipe.Tuple{}}}
+	fn.ParamNames, fn.Type.Variadic = fromFields(ft.Params, fn.Type.Params)
+	if ft.Results != nil && len(ft.Results.List) > 0 {
+		fn.Type.Results = &tipe.Tuple{}
+		fn.ResultNames, _ = fromFields(ft.Results, fn.Type.Results)
+	}
+	return fn
+}
+
+func fromFields(fl *ast.FieldList, t *tipe.Tuple) (names []string, variadic bool) {
+	if fl == nil {
+		return nil, false
+	}
+	for _, field := range fl.List {
+		var typ tipe.Type
+		if e, ok := field.Type.(*ast.Ellipsis); ok {
+			variadic = true
+			typ = &tipe.Slice{Elem: fromType(e.Elt)}
+		} else {
+			typ = fromType(field.Type)
+		}
+		if len(field.Names) == 0 {
+			names = append(names, "")
+			t.Elems = append(t.Elems, typ)
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+			t.Elems = append(t.Elems, typ)
+		}
+	}
+	return names, variadic
+}
+
+func fromType(x ast.Expr) tipe.Type {
+	switch x := x.(type) {
+	case nil:
+		return nil
+	case *ast.Ident:
+		if x.Name == "num" {
+			return tipe.Num
+		}
+		return &tipe.Unresolved{Name: x.Name}
+	case *ast.SelectorExpr:
+		if pkg, ok := x.X.(*ast.Ident); ok {
+			return &tipe.Unresolved{Package: pkg.Name, Name: x.Sel.Name}
+		}
+	case *ast.ParenExpr:
+		return fromType(x.X)
+	case *ast.StarExpr:
+		return &tipe.Pointer{Elem: fromType(x.X)}
+	case *ast.ArrayType:
+		switch n := x.Len.(type) {
+		case nil:
+			return &tipe.Slice{Elem: fromType(x.Elt)}
+		case *ast.Ellipsis:
+			return &tipe.Array{Ellipsis: true, Elem: fromType(x.Elt)}
+		case *ast.BasicLit:
+			if v, err := strconv.ParseInt(n.Value, 0, 64); err == nil && n.Kind == gotoken.INT {
+				return &tipe.Array{Len: v, Elem: fromType(x.Elt)}
+			}
+		}
+		return &tipe.Array{LenExpr: fromExpr(x.Len), Elem: fromType(x.Elt)}
+	case *ast.MapType:
+		return &tipe.Map{Key: fromType(x.Key), Value: fromType(x.Value)}
+	case *ast.ChanType:
+		t := &tipe.Chan{Elem: fromType(x.Value)}
+		switch x.Dir {
+		case ast.SEND:
+			t.Direction = tipe.ChanSend
+		case ast.RECV:
+			t.Direction = tipe.ChanRecv
+		}
+		return t
+	case *ast.FuncType:
+		return funcLit(x).Type
+	case *ast.StructType:
+		t := &tipe.Struct{}
+		for _, field := range x.Fields.List {
+			if len(field.Names) == 0 {
+				errorf("embedded field has no Neugram equivalent")
+			}
+			if field.Tag != nil {
+				errorf("struct tag has no Neugram equivalent")
+			}
+			for _, name := range field.Names {
+				t.FieldNames = append(t.FieldNames, name.Name)
+				t.Fields = append(t.Fields, fromType(field.Type))
+			}
+		}
+		return t
+	case *ast.InterfaceType:
+		t := &tipe.Interface{Methods: make(map[string]*tipe.Func)}
+		for _, field := range x.Methods.List {
+			ft, ok := field.Type.(*ast.FuncType)
+			if !ok || len(field.Names) != 1 {
+				errorf("embedded interface has no Neugram equivalent")
+			}
+			t.Methods[field.Names[0].Name] = funcLit(ft).Type
+		}
+		return t
+	}
+	errorf("%T is not a type", x)
+	panic("unreachable")
+}
+
+func fromBlock(b *ast.BlockStmt) *stmt.Block {
+	if b == nil {
+		return nil
+	}
+	return &stmt.Block{Stmts: fromStmts(b.List)}
+}
+
+func fromStmts(xs []ast.Stmt) []stmt.Stmt {
+	var ss []stmt.Stmt
+	for _, x := range xs {
+		ss = append(ss, fromStmt(x)...)
+	}
+	return ss
+}
+
+// fromStmt1 converts x, which must be a single statement.
+func fromStmt1(x ast.Stmt) stmt.Stmt {
+	ss := fromStmt(x)
+	if len(ss) != 1 {
+		errorf("%T is not a single statement", x)
+	}
+	return ss[0]
+}
+
+// fromStmt converts x. A grouped type declaration becomes one
+// statement per type, and an empty statement none at all.
+func fromStmt(x ast.Stmt) []stmt.Stmt {
+	one := func(s stmt.Stmt) []stmt.Stmt { return []stmt.Stmt{s} }
+
+	switch x := x.(type) {
+	case nil:
+		return one(nil)
+	case *ast.BadStmt:
+		errorf("bad statement")
+	case *ast.DeclStmt:
+		d, ok := x.Decl.(*ast.GenDecl)
+		if !ok {
+			errorf("bad declaration")
+		}
+		return fromGenDecl(d)
+	case *ast.EmptyStmt:
+		return nil
+	case *ast.LabeledStmt:
+		return one(&stmt.Labeled{Label: x.Label.Name, Stmt: fromStmt1(x.Stmt)})
+	case *ast.ExprStmt:
+		return one(&stmt.Simple{Expr: fromExpr(x.X)})
+	case *ast.SendStmt:
+		return one(&stmt.Send{Chan: fromExpr(x.Chan), Value: fromExpr(x.Value)})
+	case *ast.IncDecStmt:
+		op := token.Add
+		if x.Tok == gotoken.DEC {
+			op = token.Sub
+		}
+		left := fromExpr(x.X)
+		return one(&stmt.Assign{
+			Left: []expr.Expr{left},
+			Right: []expr.Expr{&expr.Binary{
+				Op:    op,
+				Left:  left,
+				Right: &expr.BasicLiteral{Value: big.NewInt(1)},
+			}},
+		})
+	case *ast.AssignStmt:
+		if x.Tok == gotoken.DEFINE || x.Tok == gotoken.ASSIGN {
+			return one(&stmt.Assign{
+				Decl:  x.Tok == gotoken.DEFINE,
+				Left:  fromExprs(x.Lhs),
+				Right: fromExprs(x.Rhs),
+			})
+		}
+		op, ok := fromBinaryOps[fromAssignOps[x.Tok]]
+		if !ok || len(x.Lhs) != 1 || len(x.Rhs) != 1 {
+			errorf("bad assignment %s", x.Tok)
+		}
+		left := fromExpr(x.Lhs[0])
+		return one(&stmt.Assign{
+			Left:  []expr.Expr{left},
+			Right: []expr.Expr{&expr.Binary{Op: op, Left: left, Right: fromExpr(x.Rhs[0])}},
+		})
+	case *ast.GoStmt:
+		return one(&stmt.Go{Call: fromExpr(x.Call).(*expr.Call)})
+	case *ast.DeferStmt:
+		return one(&stmt.Defer{Call: fromExpr(x.Call).(*expr.Call)})
+	case *ast.ReturnStmt:
+		return one(&stmt.Return{Exprs: fromExprs(x.Results)})
+	case *ast.BranchStmt:
+		s := &stmt.Branch{Type: fromBranch[x.Tok]}
+		if x.Label != nil {
+			s.Label = x.Label.Name
+		}
+		return one(s)
+	case *ast.BlockStmt:
+		return one(fromBlock(x))
+	case *ast.IfStmt:
+		return one(&stmt.If{
+			Init: fromStmt1(x.Init),
+			Cond: fromExpr(x.Cond),
+			Body: fromBlock(x.Body),
+			Else: fromStmt1(x.Else),
+		})
+	case *ast.SwitchStmt:
+		s := &stmt.Switch{Init: fromStmt1(x.Init), Cond: fromExpr(x.Tag)}
+		for _, c := range x.Body.List {
+			c := c.(*ast.CaseClause)
+			s.Cases = append(s.Cases, stmt.SwitchCase{
+				Conds:   fromExprs(c.List),
+				Default: c.List == nil,
+				Body:    &stmt.Block{Stmts: fromStmts(c.Body)},
+			})
+		}
+		return one(s)
+	case *ast.TypeSwitchStmt:
+		s := &stmt.TypeSwitch{Init: fromStmt1(x.Init), Assign: fromStmt1(x.Assign)}
+		for _, c := range x.Body.List {
+			c := c.(*ast.CaseClause)
+			tc := stmt.TypeSwitchCase{
+				Default: c.List == nil,
+				Body:    &stmt.Block{Stmts: fromStmts(c.Body)},
+			}
+			for _, t := range c.List {
+				tc.Types = append(tc.Types, fromType(t))
+			}
+			s.Cases = append(s.Cases, tc)
+		}
+		return one(s)
+	case *ast.SelectStmt:
+		s := &stmt.Select{}
+		for _, c := range x.Body.List {
+			c := c.(*ast.CommClause)
+			s.Cases = append(s.Cases, stmt.SelectCase{
+				Default: c.Comm == nil,
+				Comm:    fromStmt1(c.Comm),
+				Body:    &stmt.Block{Stmts: fromStmts(c.Body)},
+			})
+		}
+		return one(s)
+	case *ast.ForStmt:
+		return one(&stmt.For{
+			Init: fromStmt1(x.Init),
+			Cond: fromExpr(x.Cond),
+			Post: fromStmt1(x.Post),
+			Body: fromBlock(x.Body),
+		})
+	case *ast.RangeStmt:
+		return one(&stmt.Range{
+			Decl: x.Tok == gotoken.DEFINE,
+			Key:  fromExpr(x.Key),
+			Val:  fromExpr(x.Value),
+			Expr: fromExpr(x.X),
+			Body: fromBlock(x.Body),
+		})
+	}
+	errorf("%T has no Neugram equivalent", x)
+	panic("unreachable")
+}
+
+func fromGenDecl(d *ast.GenDecl) []stmt.Stmt {
+	switch d.Tok {
+	case gotoken.IMPORT:
+		set := &stmt.ImportSet{}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ImportSpec)
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				errorf("bad import path %s", spec.Path.Value)
+			}
+			imp := &stmt.Import{Path: path}
+			if spec.Name != nil {
+				imp.Name = spec.Name.Name
+			}
+			set.Imports = append(set.Imports, imp)
+		}
+		if !d.Lparen.IsValid() && len(set.Imports) == 1 {
+			return []stmt.Stmt{set.Imports[0]}
+		}
+		return []stmt.Stmt{set}
+	case gotoken.CONST:
+		set := &stmt.ConstSet{}
+		var prev *stmt.Const
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ValueSpec)
+			if len(spec.Names) != 1 || len(spec.Values) > 1 {
+				errorf("constant declaration of %d names has no Neugram equivalent", len(spec.Names))
+			}
+			c := &stmt.Const{Name: spec.Names[0].Name}
+			if len(spec.Values) == 0 {
+				if prev == nil {
+					errorf("constant %s has no value", c.Name)
+				}
+				c.Type, c.Value = prev.Type, prev.Value
+			} else {
+				c.Type, c.Value = fromType(spec.Type), fromExpr(spec.Values[0])
+			}
+			set.Consts = append(set.Consts, c)
+			prev = c
+		}
+		if !d.Lparen.IsValid() && len(set.Consts) == 1 {
+			return []stmt.Stmt{set.Consts[0]}
+		}
+		return []stmt.Stmt{set}
+	case gotoken.VAR:
+		set := &stmt.VarSet{}
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.ValueSpec)
+			v := &stmt.Var{Type: fromType(spec.Type), Values: fromExprs(spec.Values)}
+			for _, name := range spec.Names {
+				v.NameList = append(v.NameList, name.Name)
+			}
+			set.Vars = append(set.Vars, v)
+		}
+		if !d.Lparen.IsValid() && len(set.Vars) == 1 {
+			return []stmt.Stmt{set.Vars[0]}
+		}
+		return []stmt.Stmt{set}
+	case gotoken.TYPE:
+		var ss []stmt.Stmt
+		for _, spec := range d.Specs {
+			spec := spec.(*ast.TypeSpec)
+			ss = append(ss, &stmt.TypeDecl{
+				Name:  spec.Name.Name,
+				Alias: spec.Assign.IsValid(),
+				Type:  fromType(spec.Type),
+			})
+		}
+		return ss
+	}
+	errorf("bad declaration %s", d.Tok)
+	panic("unreachable")
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package goast converts between Neugram syntax trees and go/ast.
+//
+// Only the subset of Neugram that is also Go can be converted.
+// Shell expressions, tables, the ** operator, num, and the untyped
+// Neugram numeric types report an error.
+//
+// Converted nodes carry no source positions or comments, so the
+// result is suitable for go/printer, go/types, and other tools that
+// work on syntax alone.
+//
+// A Neugram file runs its statements from top to bottom. File puts
+// the statements that are not declarations into the body of func
+// main, and FromFile appends the body of func main to the end of
+// the file.
+package goast
+
+import (
+	"fmt"
+	gotoken "go/token"
+
+	"neugram.io/ng/token"
+)
+
+// bailout is panicked by errorf and recovered at the API boundary.
+type bailout struct {
+	err error
+}
+
+func errorf(format string, args ...interface{}) {
+	panic(bailout{fmt.Errorf("goast: "+format, args...)})
+}
+
+func catch(err *error) {
+	if r := recover(); r != nil {
+		b, ok := r.(bailout)
+		if !ok {
+			panic(r)
+		}
+		*err = b.err
+	}
+}
+
+var binaryOps = map[token.Token]gotoken.Token{
+	token.Add:          gotoken.ADD,
+	token.Sub:          gotoken.SUB,
+	token.Mul:          gotoken.MUL,
+	token.Div:          gotoken.QUO,
+	token.Rem:          gotoken.REM,
+	token.And:          gotoken.AND,
+	token.Or:           gotoken.OR,
+	token.Xor:          gotoken.XOR,
+	token.AndNot:       gotoken.AND_NOT,
+	token.ShiftLeft:    gotoken.SHL,
+	token.ShiftRight:   gotoken.SHR,
+	token.LogicalAnd:   gotoken.LAND,
+	token.LogicalOr:    gotoken.LOR,
+	token.Equal:        gotoken.EQL,
+	token.NotEqual:     gotoken.NEQ,
+	token.Less:         gotoken.LSS,
+	token.LessEqual:    gotoken.LEQ,
+	token.Greater:      gotoken.GTR,
+	token.GreaterEqual: gotoken.GEQ,
+}
+
+var unaryOps = map[token.Token]gotoken.Token{
+	token.Not:    gotoken.NOT,
+	token.Add:    gotoken.ADD,
+	token.Sub:    gotoken.SUB,
+	token.Xor:    gotoken.XOR,
+	token.Ref:    gotoken.AND,
+	token.ChanOp: gotoken.ARROW,
+}
+
+// assignOps maps a Go binary operator to its assignment form.
+var assignOps = map[gotoken.Token]gotoken.Token{
+	gotoken.ADD:     gotoken.ADD_ASSIGN,
+	gotoken.SUB:     gotoken.SUB_ASSIGN,
+	gotoken.MUL:     gotoken.MUL_ASSIGN,
+	gotoken.QUO:     gotoken.QUO_ASSIGN,
+	gotoken.REM:     gotoken.REM_ASSIGN,
+	gotoken.AND:     gotoken.AND_ASSIGN,
+	gotoken.OR:      gotoken.OR_ASSIGN,
+	gotoken.XOR:     gotoken.XOR_ASSIGN,
+	gotoken.SHL:     gotoken.SHL_ASSIGN,
+	gotoken.SHR:     gotoken.SHR_ASSIGN,
+	gotoken.AND_NOT: gotoken.AND_NOT_ASSIGN,
+}
+
+var branchToks = map[token.Token]gotoken.Token{
+	token.Continue:    gotoken.CONTINUE,
+	token.Break:       gotoken.BREAK,
+	token.Goto:        gotoken.GOTO,
+	token.Fallthrough: gotoken.FALLTHROUGH,
+}
+
+// invert returns the inverse of a token map.
+func invert(m map[token.Token]gotoken.Token) map[gotoken.Token]token.Token {
+	inv := make(map[gotoken.Token]token.Token, len(m))
+	for k, v := range m {
+		inv[v] = k
+	}
+	return inv
+}
+
+var (
+	fromBinaryOps = invert(binaryOps)
+	fromUnaryOps  = invert(unaryOps)
+	fromBranch    = invert(branchToks)
+	fromAssignOps = make(map[gotoken.Token]gotoken.Token)
+)
+
+func init() {
+	for k, v := range assignOps {
+		fromAssignOps[v] = k
+	}
+}
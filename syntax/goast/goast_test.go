@@ -0,0 +1,278 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goast_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	goparser "go/parser"
+	"go/printer"
+	gotoken "go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/parser"
+	"neugram.io/ng/syntax/equal"
+	"neugram.io/ng/syntax/goast"
+	"neugram.io/ng/token"
+)
+
+const src = `const (
+	a = iota
+	b
+)
+
+var v, w int = 1, 2
+
+type P struct {
+	X float64
+	Y float64
+}
+
+type I interface {
+	Len() int
+}
+
+type celsius = float64
+
+methodik C struct { n int } {
+	func (*c) Inc() { c.n++ }
+	func (c) Len() int { return c.n }
+}
+
+func sum(xs ...int) (total int) {
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+func apply(f func(int, int) int, x, y int) int {
+	return f(x, y)
+}
+
+x := 1.0
+s := []int{1, 2, 3}
+m := map[string]int{"one": 1}
+p := &P{X: 1, Y: 2}
+c := &C{}
+c.Inc()
+var i I = c
+i.Len()
+x = x*2 + p.X
+s = s[1:]
+n := sum(s...)
+n = apply(func(a, b int) int { return a * b }, n, len(m))
+r := 'r'
+ch := make(chan int, 1)
+ch <- n
+select {
+case v := <-ch:
+	n = v
+default:
+}
+switch {
+case n > 10:
+	n--
+case n < 0:
+	n = -n
+default:
+	n <<= 1
+}
+var e interface{} = n
+switch e := e.(type) {
+case int, nil:
+	_ = e
+}
+if n, ok := m["one"]; ok {
+	_ = n
+} else {
+	_ = ok
+}
+loop:
+for j := 0; j < 3; j++ {
+	if j == 1 {
+		continue loop
+	}
+	break
+}
+defer func() { recover() }()
+_, _, _, _, _, _ = x, r, v, w, a, b
+`
+
+func TestRoundTrip(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "r.ng", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gof, err := goast.File(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := gotoken.NewFileSet()
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, gof); err != nil {
+		t.Fatal(err)
+	}
+	gof, err = goparser.ParseFile(fset, "r.go", buf.Bytes(), 0)
+	if err != nil {
+		t.Fatalf("printed Go does not parse: %v\n%s", err, buf.Bytes())
+	}
+	if _, err := new(types.Config).Check("main", fset, []*ast.File{gof}, nil); err != nil {
+		t.Fatalf("printed Go does not type check: %v\n%s", err, buf.Bytes())
+	}
+
+	f2, err := goast.FromFile(gof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f2.Stmts) != len(f.Stmts) {
+		t.Fatalf("got %d statements, want %d", len(f2.Stmts), len(f.Stmts))
+	}
+	for i, s := range f.Stmts {
+		if d := equal.DiffStmt(s, f2.Stmts[i]); d != nil {
+			t.Errorf("statement %d: %v", i, d)
+		}
+	}
+}
+
+func TestFromFile(t *testing.T) {
+	const gosrc = `package p
+
+import "fmt"
+
+type (
+	T int
+	U struct{ t T }
+	V = U
+)
+
+func (u U) String() string { return fmt.Sprint(u.t) }
+
+var us = []*U{{t: 1}, {t: 2}}
+
+var ts = [...][]T{{1, 2}, {}}
+`
+	gof, err := goparser.ParseFile(gotoken.NewFileSet(), "p.go", gosrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := goast.FromFile(gof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Package != "p" {
+		t.Errorf("Package=%q, want p", f.Package)
+	}
+
+	// Converting back and printing must reproduce the source.
+	gof2, err := goast.File(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, gotoken.NewFileSet(), gof2); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type T int",
+		"type U struct",
+		"type V = U",
+		"func (u U) String() string",
+		"[]*U{&U{t: 1}, &U{t: 2}}",
+		"[...][]T{[]T{1, 2}, []T{}}",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, buf.Bytes())
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, src := range []string{
+		"x := 2 ** 3",
+		"$$ echo hi $$",
+		"var n num",
+		"f := func() { func g() {} }",
+	} {
+		f, err := parser.ParseFile(token.NewFileSet(), "e.ng", []byte(src), 0)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if _, err := goast.File(f); err == nil {
+			t.Errorf("%s: converted to Go, want error", src)
+		} else if !strings.HasPrefix(err.Error(), "goast: ") {
+			t.Errorf("%s: error %q lacks the package prefix", src, err)
+		}
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "e.ng", []byte("package p\nx := 1\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goast.File(f); err == nil {
+		t.Error("statements outside func main of package p converted, want error")
+	}
+
+	gof, err := goparser.ParseFile(gotoken.NewFileSet(), "e.go", "package p\ntype T struct{ int }\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goast.FromFile(gof); err == nil {
+		t.Error("embedded field converted, want error")
+	}
+}
+
+func TestFromPackage(t *testing.T) {
+	srcs := []string{
+		"package p\n\nimport \"math\"\n\nfunc (p P) Len() float64 { return math.Sqrt(p.X*p.X + p.Y*p.Y) }\n\nvar Unit = P{X: One}\n",
+		"package p\n\nconst One = 1\n\ntype P struct{ X, Y float64 }\n",
+	}
+	fset := gotoken.NewFileSet()
+	var files []*ast.File
+	for i, src := range srcs {
+		f, err := goparser.ParseFile(fset, fmt.Sprintf("f%d.go", i), src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	f, err := goast.FromPackage(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gof, err := goast.File(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, gotoken.NewFileSet(), gof); err != nil {
+		t.Fatal(err)
+	}
+	// Declarations follow the declarations they refer to.
+	out := buf.String()
+	for _, decls := range [][2]string{
+		{"import \"math\"", "type P struct"},
+		{"type P struct", "func (p P) Len()"},
+		{"type P struct", "var Unit"},
+		{"const One", "var Unit"},
+	} {
+		i, j := strings.Index(out, decls[0]), strings.Index(out, decls[1])
+		if i < 0 || j < i {
+			t.Errorf("%q does not precede %q in:\n%s", decls[0], decls[1], out)
+		}
+	}
+
+	other, err := goparser.ParseFile(fset, "q.go", "package q\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goast.FromPackage(append(files, other)); err == nil {
+		t.Error("files of packages p and q converted, want error")
+	}
+}
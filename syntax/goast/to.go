@@ -0,0 +1,616 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package goast
+
+import (
+	"go/ast"
+	gotoken "go/token"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+// Expr converts the Neugram expression e to Go.
+func Expr(e expr.Expr) (x ast.Expr, err error) {
+	defer catch(&err)
+	return toExpr(e), nil
+}
+
+// Stmt converts the Neugram statement s to Go.
+//
+// Imports and named functions are only valid at the top level
+// of a Go file, so they are converted by File, not Stmt.
+func Stmt(s stmt.Stmt) (x ast.Stmt, err error) {
+	defer catch(&err)
+	return toStmt(s), nil
+}
+
+// Type converts the Neugram type t to a Go type expression.
+func Type(t tipe.Type) (x ast.Expr, err error) {
+	defer catch(&err)
+	return toType(t), nil
+}
+
+// File converts the Neugram file f to Go.
+//
+// Imports, constants, types, methodiks and named functions become
+// top-level declarations, as do variables declared before the first
+// statement. Any other statement is moved into func main, in order,
+// which requires f to be in package main or to have no package
+// clause.
+func File(f *syntax.File) (file *ast.File, err error) {
+	defer catch(&err)
+
+	name := f.Package
+	if name == "" {
+		name = "main"
+	}
+	file = &ast.File{Name: ast.NewIdent(name)}
+	var imports, decls []ast.Decl
+	var main []ast.Stmt
+	hasMain := false
+	for _, s := range f.Stmts {
+		switch s := s.(type) {
+		case *stmt.Import, *stmt.ImportSet:
+			imports = append(imports, genDecl(s))
+		case *stmt.Const, *stmt.ConstSet, *stmt.TypeDecl:
+			decls = append(decls, genDecl(s))
+		case *stmt.Var, *stmt.VarSet:
+			if len(main) > 0 {
+				main = append(main, toStmt(s))
+				continue
+			}
+			decls = append(decls, genDecl(s))
+		case *stmt.MethodikDecl:
+			decls = append(decls, genDecl(s))
+			for _, m := range s.Methods {
+				decls = append(decls, funcDecl(m, s.Name))
+			}
+		case *stmt.Simple:
+			if fn, ok := s.Expr.(*expr.FuncLiteral); ok && fn.Name != "" {
+				if fn.Name == "main" {
+					hasMain = true
+				}
+				decls = append(decls, funcDecl(fn, ""))
+				continue
+			}
+			main = append(main, toStmt(s))
+		default:
+			main = append(main, toStmt(s))
+		}
+	}
+	if len(main) > 0 {
+		if name != "main" {
+			errorf("package %s has statements outside a function", name)
+		}
+		if hasMain {
+			errorf("func main is declared and the file has top-level statements")
+		}
+		decls = append(decls, &ast.FuncDecl{
+			Name: ast.NewIdent("main"),
+			Type: &ast.FuncType{Params: &ast.FieldList{}},
+			Body: &ast.BlockStmt{List: main},
+		})
+	}
+	file.Decls = append(imports, decls...)
+	return file, nil
+}
+
+// grouped is a valid position that is not in any file. It marks
+// parenthesized declaration groups, the = of a type alias, the ...
+// of a call, and the braces of an empty struct or interface, for
+// which go/printer only checks that a position is valid.
+const grouped = gotoken.Pos(1)
+
+func toExprs(es []expr.Expr) []ast.Expr {
+	if es == nil {
+		return nil
+	}
+	xs := make([]ast.Expr, len(es))
+	for i, e := range es {
+		xs[i] = toExpr(e)
+	}
+	return xs
+}
+
+func ident(name string) *ast.Ident {
+	if name == "" {
+		return nil
+	}
+	return ast.NewIdent(name)
+}
+
+func toExpr(e expr.Expr) ast.Expr {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case *expr.Binary:
+		op, ok := binaryOps[e.Op]
+		if !ok {
+			errorf("operator %s has no Go equivalent", e.Op)
+		}
+		return &ast.BinaryExpr{X: toExpr(e.Left), Op: op, Y: toExpr(e.Right)}
+	case *expr.Unary:
+		switch e.Op {
+		case token.LeftParen:
+			return &ast.ParenExpr{X: toExpr(e.Expr)}
+		case token.Mul:
+			return &ast.StarExpr{X: toExpr(e.Expr)}
+		}
+		op, ok := unaryOps[e.Op]
+		if !ok {
+			errorf("unary operator %s has no Go equivalent", e.Op)
+		}
+		return &ast.UnaryExpr{Op: op, X: toExpr(e.Expr)}
+	case *expr.Bad:
+		errorf("bad expression: %v", e.Error)
+	case *expr.Selector:
+		return &ast.SelectorExpr{X: toExpr(e.Left), Sel: ast.NewIdent(e.Right.Name)}
+	case *expr.TypeAssert:
+		return &ast.TypeAssertExpr{X: toExpr(e.Expr), Type: toType(e.Type)}
+	case *expr.Index:
+		if len(e.Indicies) != 1 {
+			errorf("index with %d expressions has no Go equivalent", len(e.Indicies))
+		}
+		x := toExpr(e.Left)
+		if s, ok := e.Indicies[0].(*expr.Slice); ok {
+			return &ast.SliceExpr{
+				X:      x,
+				Low:    toExpr(s.Low),
+				High:   toExpr(s.High),
+				Max:    toExpr(s.Max),
+				Slice3: s.Max != nil,
+			}
+		}
+		return &ast.IndexExpr{X: x, Index: toExpr(e.Indicies[0])}
+	case *expr.BasicLiteral:
+		return basicLit(e)
+	case *expr.FuncLiteral:
+		if e.Name != "" {
+			errorf("func %s must be declared at the top level", e.Name)
+		}
+		return &ast.FuncLit{Type: funcType(e.Type, e.ParamNames, e.ResultNames), Body: body(e.Body)}
+	case *expr.CompLiteral:
+		lit := &ast.CompositeLit{Type: toType(e.Type)}
+		for i, el := range e.Elements {
+			if len(e.Keys) > 0 {
+				lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: toExpr(e.Keys[i]), Value: toExpr(el)})
+			} else {
+				lit.Elts = append(lit.Elts, toExpr(el))
+			}
+		}
+		return lit
+	case *expr.MapLiteral:
+		lit := &ast.CompositeLit{Type: toType(e.Type)}
+		for i, k := range e.Keys {
+			lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: toExpr(k), Value: toExpr(e.Values[i])})
+		}
+		return lit
+	case *expr.ArrayLiteral:
+		return &ast.CompositeLit{Type: toType(e.Type), Elts: toExprs(e.Elems)}
+	case *expr.SliceLiteral:
+		return &ast.CompositeLit{Type: toType(e.Type), Elts: toExprs(e.Elems)}
+	case *expr.Type:
+		return toType(e.Type)
+	case *expr.Ident:
+		return ast.NewIdent(e.Name)
+	case *expr.Call:
+		if e.ElideError {
+			errorf("call with elided error has no Go equivalent")
+		}
+		call := &ast.CallExpr{Fun: toExpr(e.Func), Args: toExprs(e.Args)}
+		if e.Ellipsis {
+			call.Ellipsis = grouped
+		}
+		return call
+	}
+	errorf("%T has no Go equivalent", e)
+	panic("unreachable")
+}
+
+func basicLit(e *expr.BasicLiteral) *ast.BasicLit {
+	switch v := e.Value.(type) {
+	case string:
+		return &ast.BasicLit{Kind: gotoken.STRING, Value: strconv.Quote(v)}
+	case rune:
+		return &ast.BasicLit{Kind: gotoken.CHAR, Value: strconv.QuoteRune(v)}
+	case *big.Int:
+		return &ast.BasicLit{Kind: gotoken.INT, Value: v.String()}
+	case *big.Float:
+		return &ast.BasicLit{Kind: gotoken.FLOAT, Value: floatText(v)}
+	case expr.Imaginary:
+		return &ast.BasicLit{Kind: gotoken.IMAG, Value: floatText(v.Imag) + "i"}
+	}
+	errorf("literal of type %T has no Go equivalent", e.Value)
+	panic("unreachable")
+}
+
+// floatText formats f so that Go reads it as a floating-point
+// literal, not an integer.
+func floatText(f *big.Float) string {
+	s := f.Text('g', -1)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+func body(b interface{}) *ast.BlockStmt {
+	if b == nil {
+		return nil
+	}
+	return block(b.(*stmt.Block))
+}
+
+func block(b *stmt.Block) *ast.BlockStmt {
+	if b == nil {
+		return nil
+	}
+	return &ast.BlockStmt{List: toStmts(b.Stmts)}
+}
+
+func toStmts(ss []stmt.Stmt) []ast.Stmt {
+	var list []ast.Stmt
+	for _, s := range ss {
+		list = append(list, toStmt(s))
+	}
+	return list
+}
+
+func toStmt(s stmt.Stmt) ast.Stmt {
+	switch s := s.(type) {
+	case nil:
+		return nil
+	case *stmt.Import, *stmt.ImportSet:
+		errorf("import must be at the top level of a file")
+	case *stmt.Const, *stmt.ConstSet, *stmt.Var, *stmt.VarSet, *stmt.TypeDecl:
+		return &ast.DeclStmt{Decl: genDecl(s)}
+	case *stmt.MethodikDecl:
+		if len(s.Methods) > 0 {
+			errorf("methodik %s must be declared at the top level", s.Name)
+		}
+		return &ast.DeclStmt{Decl: genDecl(s)}
+	case *stmt.Assign:
+		return assign(s)
+	case *stmt.Block:
+		return block(s)
+	case *stmt.If:
+		return &ast.IfStmt{
+			Init: toStmt(s.Init),
+			Cond: toExpr(s.Cond),
+			Body: toStmt(s.Body).(*ast.BlockStmt),
+			Else: toStmt(s.Else),
+		}
+	case *stmt.For:
+		return &ast.ForStmt{
+			Init: toStmt(s.Init),
+			Cond: toExpr(s.Cond),
+			Post: toStmt(s.Post),
+			Body: toStmt(s.Body).(*ast.BlockStmt),
+		}
+	case *stmt.Range:
+		r := &ast.RangeStmt{
+			Key:   toExpr(s.Key),
+			Value: toExpr(s.Val),
+			X:     toExpr(s.Expr),
+			Body:  toStmt(s.Body).(*ast.BlockStmt),
+		}
+		if s.Key != nil {
+			r.Tok = gotoken.ASSIGN
+			if s.Decl {
+				r.Tok = gotoken.DEFINE
+			}
+		}
+		return r
+	case *stmt.Switch:
+		sw := &ast.SwitchStmt{Init: toStmt(s.Init), Tag: toExpr(s.Cond), Body: &ast.BlockStmt{}}
+		for _, c := range s.Cases {
+			sw.Body.List = append(sw.Body.List, &ast.CaseClause{
+				List: toExprs(c.Conds),
+				Body: toStmts(c.Body.Stmts),
+			})
+		}
+		return sw
+	case *stmt.TypeSwitch:
+		sw := &ast.TypeSwitchStmt{Init: toStmt(s.Init), Assign: toStmt(s.Assign), Body: &ast.BlockStmt{}}
+		for _, c := range s.Cases {
+			clause := &ast.CaseClause{Body: toStmts(c.Body.Stmts)}
+			for _, t := range c.Types {
+				clause.List = append(clause.List, toType(t))
+			}
+			sw.Body.List = append(sw.Body.List, clause)
+		}
+		return sw
+	case *stmt.Go:
+		return &ast.GoStmt{Call: toExpr(s.Call).(*ast.CallExpr)}
+	case *stmt.Defer:
+		return &ast.DeferStmt{Call: toExpr(s.Call).(*ast.CallExpr)}
+	case *stmt.Return:
+		return &ast.ReturnStmt{Results: toExprs(s.Exprs)}
+	case *stmt.Simple:
+		return &ast.ExprStmt{X: toExpr(s.Expr)}
+	case *stmt.Select:
+		sel := &ast.SelectStmt{Body: &ast.BlockStmt{}}
+		for _, c := range s.Cases {
+			sel.Body.List = append(sel.Body.List, &ast.CommClause{
+				Comm: toStmt(c.Comm),
+				Body: toStmts(c.Body.Stmts),
+			})
+		}
+		return sel
+	case *stmt.Send:
+		return &ast.SendStmt{Chan: toExpr(s.Chan), Value: toExpr(s.Value)}
+	case *stmt.Branch:
+		return &ast.BranchStmt{Tok: branchToks[s.Type], Label: ident(s.Label)}
+	case *stmt.Labeled:
+		return &ast.LabeledStmt{Label: ast.NewIdent(s.Label), Stmt: toStmt(s.Stmt)}
+	case *stmt.Bad:
+		errorf("bad statement")
+	}
+	errorf("%T has no Go equivalent", s)
+	panic("unreachable")
+}
+
+// assign converts s, recovering the increment, decrement and
+// arithmetic assignment statements the parser desugars into
+// x = x op y.
+func assign(s *stmt.Assign) ast.Stmt {
+	if !s.Decl && len(s.Left) == 1 && len(s.Right) == 1 {
+		if b, ok := s.Right[0].(*expr.Binary); ok && b.Left == s.Left[0] {
+			if lit, ok := b.Right.(*expr.BasicLiteral); ok && (b.Op == token.Add || b.Op == token.Sub) {
+				if v, ok := lit.Value.(*big.Int); ok && v.Cmp(big.NewInt(1)) == 0 {
+					tok := gotoken.INC
+					if b.Op == token.Sub {
+						tok = gotoken.DEC
+					}
+					return &ast.IncDecStmt{X: toExpr(s.Left[0]), Tok: tok}
+				}
+			}
+			tok, ok := assignOps[binaryOps[b.Op]]
+			if !ok {
+				errorf("assignment operator %s= has no Go equivalent", b.Op)
+			}
+			return &ast.AssignStmt{
+				Lhs: []ast.Expr{toExpr(s.Left[0])},
+				Tok: tok,
+				Rhs: []ast.Expr{toExpr(b.Right)},
+			}
+		}
+	}
+	tok := gotoken.ASSIGN
+	if s.Decl {
+		tok = gotoken.DEFINE
+	}
+	return &ast.AssignStmt{Lhs: toExprs(s.Left), Tok: tok, Rhs: toExprs(s.Right)}
+}
+
+func genDecl(s stmt.Stmt) *ast.GenDecl {
+	switch s := s.(type) {
+	case *stmt.Import:
+		return &ast.GenDecl{Tok: gotoken.IMPORT, Specs: []ast.Spec{importSpec(s)}}
+	case *stmt.ImportSet:
+		d := &ast.GenDecl{Tok: gotoken.IMPORT, Lparen: grouped}
+		for _, imp := range s.Imports {
+			d.Specs = append(d.Specs, importSpec(imp))
+		}
+		return d
+	case *stmt.Const:
+		return &ast.GenDecl{Tok: gotoken.CONST, Specs: []ast.Spec{constSpec(s, nil)}}
+	case *stmt.ConstSet:
+		d := &ast.GenDecl{Tok: gotoken.CONST, Lparen: grouped}
+		var prev *stmt.Const
+		for _, c := range s.Consts {
+			d.Specs = append(d.Specs, constSpec(c, prev))
+			prev = c
+		}
+		return d
+	case *stmt.Var:
+		return &ast.GenDecl{Tok: gotoken.VAR, Specs: []ast.Spec{varSpec(s)}}
+	case *stmt.VarSet:
+		d := &ast.GenDecl{Tok: gotoken.VAR, Lparen: grouped}
+		for _, v := range s.Vars {
+			d.Specs = append(d.Specs, varSpec(v))
+		}
+		return d
+	case *stmt.TypeDecl:
+		spec := &ast.TypeSpec{Name: ast.NewIdent(s.Name), Type: toType(s.Type)}
+		if s.Alias {
+			spec.Assign = grouped
+		}
+		return &ast.GenDecl{Tok: gotoken.TYPE, Specs: []ast.Spec{spec}}
+	case *stmt.MethodikDecl:
+		return &ast.GenDecl{Tok: gotoken.TYPE, Specs: []ast.Spec{
+			&ast.TypeSpec{Name: ast.NewIdent(s.Name), Type: toType(s.Type.Type)},
+		}}
+	}
+	panic("goast: unexpected declaration")
+}
+
+func importSpec(s *stmt.Import) *ast.ImportSpec {
+	return &ast.ImportSpec{
+		Name: ident(s.Name),
+		Path: &ast.BasicLit{Kind: gotoken.STRING, Value: strconv.Quote(s.Path)},
+	}
+}
+
+// constSpec converts c. A constant in a group that repeats the
+// type and value of the previous one, prev, has them omitted.
+func constSpec(c, prev *stmt.Const) *ast.ValueSpec {
+	spec := &ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent(c.Name)}}
+	if prev != nil && c.Value == prev.Value {
+		return spec
+	}
+	spec.Type = toType(c.Type)
+	if c.Value != nil {
+		spec.Values = []ast.Expr{toExpr(c.Value)}
+	}
+	return spec
+}
+
+func varSpec(v *stmt.Var) *ast.ValueSpec {
+	spec := &ast.ValueSpec{Type: toType(v.Type), Values: toExprs(v.Values)}
+	for _, name := range v.NameList {
+		spec.Names = append(spec.Names, ast.NewIdent(name))
+	}
+	return spec
+}
+
+// funcDecl converts the named function f. If recv is not empty,
+// f is a method of the methodik recv.
+func funcDecl(f *expr.FuncLiteral, recv string) *ast.FuncDecl {
+	d := &ast.FuncDecl{
+		Name: ast.NewIdent(f.Name),
+		Type: funcType(f.Type, f.ParamNames, f.ResultNames),
+		Body: body(f.Body),
+	}
+	if recv != "" {
+		var t ast.Expr = ast.NewIdent(recv)
+		if f.PointerReceiver {
+			t = &ast.StarExpr{X: t}
+		}
+		d.Recv = &ast.FieldList{List: []*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent(f.ReceiverName)},
+			Type:  t,
+		}}}
+	}
+	return d
+}
+
+func funcType(t *tipe.Func, paramNames, resultNames []string) *ast.FuncType {
+	ft := &ast.FuncType{Params: fields(t.Params, paramNames, t.Variadic)}
+	if t.Results != nil && len(t.Results.Elems) > 0 {
+		ft.Results = fields(t.Results, resultNames, false)
+	}
+	return ft
+}
+
+// fields converts a parameter or result tuple. Consecutive named
+// parameters that share a type, as the parser produces for
+// func(a, b int), are grouped into a single field.
+func fields(t *tipe.Tuple, names []string, variadic bool) *ast.FieldList {
+	fl := &ast.FieldList{}
+	if t == nil {
+		return fl
+	}
+	for i, elem := range t.Elems {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		if name != "" && i > 0 && t.Elems[i-1] == elem && len(fl.List) > 0 {
+			if last := fl.List[len(fl.List)-1]; len(last.Names) > 0 {
+				last.Names = append(last.Names, ast.NewIdent(name))
+				continue
+			}
+		}
+		field := &ast.Field{Type: toType(elem)}
+		if variadic && i == len(t.Elems)-1 {
+			s, ok := elem.(*tipe.Slice)
+			if !ok {
+				errorf("variadic parameter of type %s is not a slice", elem)
+			}
+			field.Type = &ast.Ellipsis{Elt: toType(s.Elem)}
+		}
+		if name != "" {
+			field.Names = []*ast.Ident{ast.NewIdent(name)}
+		}
+		fl.List = append(fl.List, field)
+	}
+	return fl
+}
+
+func toType(t tipe.Type) ast.Expr {
+	switch t := t.(type) {
+	case nil:
+		return nil
+	case tipe.Basic:
+		switch t {
+		case tipe.Bool, tipe.String,
+			tipe.Int, tipe.Int8, tipe.Int16, tipe.Int32, tipe.Int64,
+			tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64, tipe.Uintptr,
+			tipe.Float32, tipe.Float64, tipe.Complex64, tipe.Complex128:
+			return ast.NewIdent(string(t))
+		}
+		errorf("type %s has no Go equivalent", t)
+	case *tipe.Alias:
+		return ast.NewIdent(t.Name)
+	case *tipe.Unresolved:
+		if t.Package != "" {
+			return &ast.SelectorExpr{X: ast.NewIdent(t.Package), Sel: ast.NewIdent(t.Name)}
+		}
+		return ast.NewIdent(t.Name)
+	case *tipe.Named:
+		if t.Name == "" {
+			errorf("methodik has no name")
+		}
+		if t.PkgName != "" {
+			return &ast.SelectorExpr{X: ast.NewIdent(t.PkgName), Sel: ast.NewIdent(t.Name)}
+		}
+		return ast.NewIdent(t.Name)
+	case *tipe.Func:
+		return funcType(t, nil, nil)
+	case *tipe.Struct:
+		st := &ast.StructType{Fields: &ast.FieldList{}}
+		for i, name := range t.FieldNames {
+			st.Fields.List = append(st.Fields.List, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(name)},
+				Type:  toType(t.Fields[i]),
+			})
+		}
+		if len(t.FieldNames) == 0 {
+			st.Fields.Opening, st.Fields.Closing = grouped, grouped
+		}
+		return st
+	case *tipe.Array:
+		var n ast.Expr = &ast.BasicLit{Kind: gotoken.INT, Value: strconv.FormatInt(t.Len, 10)}
+		if t.Ellipsis {
+			n = &ast.Ellipsis{}
+		} else if t.LenExpr != nil {
+			n = toExpr(t.LenExpr.(expr.Expr))
+		}
+		return &ast.ArrayType{Len: n, Elt: toType(t.Elem)}
+	case *tipe.Slice:
+		return &ast.ArrayType{Elt: toType(t.Elem)}
+	case *tipe.Pointer:
+		return &ast.StarExpr{X: toType(t.Elem)}
+	case *tipe.Chan:
+		dir := ast.SEND | ast.RECV
+		switch t.Direction {
+		case tipe.ChanSend:
+			dir = ast.SEND
+		case tipe.ChanRecv:
+			dir = ast.RECV
+		}
+		return &ast.ChanType{Dir: dir, Value: toType(t.Elem)}
+	case *tipe.Map:
+		return &ast.MapType{Key: toType(t.Key), Value: toType(t.Value)}
+	case *tipe.Interface:
+		var names []string
+		for name := range t.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		it := &ast.InterfaceType{Methods: &ast.FieldList{}}
+		for _, name := range names {
+			it.Methods.List = append(it.Methods.List, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(name)},
+				Type:  toType(t.Methods[name]),
+			})
+		}
+		if len(names) == 0 {
+			it.Methods.Opening, it.Methods.Closing = grouped, grouped
+		}
+		return it
+	}
+	errorf("%T has no Go equivalent", t)
+	panic("unreachable")
+}
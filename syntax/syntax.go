@@ -0,0 +1,20 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package syntax defines the root of a parsed Neugram source file.
+package syntax
+
+import (
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+)
+
+// File is a parsed Neugram source file.
+type File struct {
+	Filename string
+	Doc      *expr.CommentGroup // package clause documentation, or nil
+	Package  string             // name from the package clause, or ""
+	Stmts    []stmt.Stmt
+	Comments []*expr.CommentGroup // all comments, if parsed with parser.ParseComments
+}
@@ -0,0 +1,465 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package walk
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing
+// the current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal.
+// See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a syntax tree recursively, starting with root,
+// and calling pre and post for each node as described below.
+// Apply returns the syntax tree, possibly modified.
+//
+// If pre is not nil, it is called for each node before the node's
+// children are traversed (pre-order). If pre returns false, no
+// children are traversed, and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false,
+// post is called for each node after its children are traversed
+// (post-order). If post returns false, traversal is terminated and
+// Apply returns immediately.
+//
+// Only fields that refer to syntax nodes are traversed. Children
+// are traversed in the order in which they appear in the node's
+// struct definition, except the methods of a *tipe.Interface, which
+// are traversed in name order. Optional children that are missing
+// are visited as a nil Node, so pre may fill them in with Replace.
+//
+// If pre replaces the current node, the children of the new node
+// are traversed. Nodes inserted before or after the current node
+// are not traversed.
+//
+// As with Walk, the children of a *tipe.Named are traversed at
+// most once.
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	result = root
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+	}()
+	a := &application{
+		pre:  pre,
+		post: post,
+		seen: make(map[*tipe.Named]bool),
+	}
+	a.apply(nil, "", reflect.ValueOf(&result).Elem(), reflect.Value{}, nil, root)
+	return result
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a node encountered during Apply.
+// Information about the node and its parent is available
+// from the Node, Parent, Name, and Index methods.
+//
+// If p is a variable of type and value of the current parent node
+// c.Parent(), and f is the field identifier with name c.Name(),
+// the following invariants hold:
+//
+//	p.f            == c.Node()  if c.Index() <  0
+//	p.f[c.Index()] == c.Node()  if c.Index() >= 0
+//
+// For a slice of structs, such as the Cases of a *stmt.Switch,
+// c.Node() is a pointer to the element. The Rows of an
+// *expr.TableLiteral are lists of lists: c.Index() is the index of
+// the element within its row.
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter
+// can be used to change the syntax tree.
+type Cursor struct {
+	parent Node
+	name   string
+	field  reflect.Value // the parent's field, or a row of it
+	key    reflect.Value // map key, if field is a map
+	iter   *iterator     // valid if field is a slice
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node.
+// It is nil for the root passed to Apply.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the
+// current Node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of
+// Nodes that contains it, or a value < 0 if the current Node is not
+// part of a slice.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current Node with n.
+func (c *Cursor) Replace(n Node) {
+	switch {
+	case c.key.IsValid():
+		c.field.SetMapIndex(c.key, value(c.field.Type().Elem(), n))
+	case c.iter != nil:
+		set(c.field.Index(c.iter.index), n)
+	default:
+		set(c.field, n)
+	}
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice,
+// or from the methods of a *tipe.Interface.
+// If the current Node is not part of a slice or map, Delete panics.
+// As a special case, if the current node is a method of a
+// *tipe.Named, its name and receiver kind are deleted along with it.
+func (c *Cursor) Delete() {
+	if c.key.IsValid() {
+		c.field.SetMapIndex(c.key, reflect.Value{})
+		return
+	}
+	i := c.index("Delete")
+	if m, ok := c.parent.(*tipe.Named); ok && c.name == "Methods" && i < len(m.MethodNames) {
+		m.MethodNames = append(m.MethodNames[:i], m.MethodNames[i+1:]...)
+		if i < len(m.PointerReceivers) {
+			m.PointerReceivers = append(m.PointerReceivers[:i], m.PointerReceivers[i+1:]...)
+		}
+	}
+	v := c.field
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing
+// slice. If the current Node is not part of a slice, InsertAfter
+// panics. Apply does not walk n.
+func (c *Cursor) InsertAfter(n Node) {
+	c.insert("InsertAfter", c.index("InsertAfter")+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current Node in its containing
+// slice. If the current Node is not part of a slice, InsertBefore
+// panics. Apply does not walk n.
+func (c *Cursor) InsertBefore(n Node) {
+	c.insert("InsertBefore", c.index("InsertBefore"), n)
+	c.iter.index++
+}
+
+func (c *Cursor) index(op string) int {
+	if c.iter == nil {
+		panic(fmt.Sprintf("walk: Cursor.%s: node %T is not part of a slice", op, c.node))
+	}
+	return c.iter.index
+}
+
+func (c *Cursor) insert(op string, i int, n Node) {
+	if _, ok := c.parent.(*tipe.Named); ok && c.name == "Methods" {
+		panic(fmt.Sprintf("walk: Cursor.%s: cannot insert an unnamed method", op))
+	}
+	v := c.field
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	set(v.Index(i), n)
+}
+
+// value converts n to a value assignable to type t. Elements of
+// slices of structs are passed to ApplyFunc by pointer.
+func value(t reflect.Type, n Node) reflect.Value {
+	if n == nil {
+		return reflect.Zero(t)
+	}
+	x := reflect.ValueOf(n)
+	if t.Kind() == reflect.Struct && x.Kind() == reflect.Ptr {
+		x = x.Elem()
+	}
+	return x
+}
+
+func set(v reflect.Value, n Node) {
+	v.Set(value(v.Type(), n))
+}
+
+type iterator struct {
+	index, step int
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+	seen      map[*tipe.Named]bool
+}
+
+// field applies to the named fields of parent.
+func (a *application) field(parent Node, names ...string) {
+	for _, name := range names {
+		v := reflect.ValueOf(parent).Elem().FieldByName(name)
+		a.apply(parent, name, v, reflect.Value{}, nil, v.Interface())
+	}
+}
+
+// list applies to each element of the named slice field of parent.
+func (a *application) list(parent Node, name string) {
+	a.listOf(parent, name, reflect.ValueOf(parent).Elem().FieldByName(name))
+}
+
+// listOf applies to each element of the slice v, which belongs to
+// the named field of parent. The elements of v may be changed by
+// the ApplyFuncs, so its length is checked on each iteration.
+func (a *application) listOf(parent Node, name string, v reflect.Value) {
+	saved := a.iter
+	a.iter.index = 0
+	for a.iter.index < v.Len() {
+		e := v.Index(a.iter.index)
+		var x Node
+		if e.Kind() == reflect.Struct {
+			x = e.Addr().Interface()
+		} else {
+			x = e.Interface()
+		}
+		a.iter.step = 1
+		a.apply(parent, name, v, reflect.Value{}, &a.iter, x)
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+// methods applies to the methods of an interface, in name order.
+func (a *application) methods(parent *tipe.Interface) {
+	names := make([]string, 0, len(parent.Methods))
+	for name := range parent.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	v := reflect.ValueOf(parent.Methods)
+	for _, name := range names {
+		if m, ok := parent.Methods[name]; ok {
+			a.apply(parent, "Methods", v, reflect.ValueOf(name), nil, m)
+		}
+	}
+}
+
+func (a *application) apply(parent Node, name string, field, key reflect.Value, iter *iterator, n Node) {
+	// A nil pointer in an interface is reported as a nil Node.
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr && v.IsNil() {
+		n = nil
+	}
+
+	saved := a.cursor
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.field = field
+	a.cursor.key = key
+	a.cursor.iter = iter
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	switch n := a.cursor.node.(type) {
+	case nil:
+		// nothing to do
+
+	// Comments
+	case *expr.Comment:
+		// nothing to do
+	case *expr.CommentGroup:
+		a.list(n, "List")
+
+	// Expressions
+	case *expr.Bad, *expr.BasicLiteral, *expr.Ident,
+		*expr.ShellRedirect, *expr.ShellAssign:
+		// nothing to do
+	case *expr.Binary:
+		a.field(n, "Left", "Right")
+	case *expr.Unary:
+		a.field(n, "Expr")
+	case *expr.Selector:
+		a.field(n, "Left", "Right")
+	case *expr.TypeAssert:
+		a.field(n, "Expr", "Type")
+	case *expr.Slice:
+		a.field(n, "Low", "High", "Max")
+	case *expr.Index:
+		a.field(n, "Left")
+		a.list(n, "Indicies")
+	case *expr.FuncLiteral:
+		a.field(n, "Doc", "Type", "Body")
+	case *expr.CompLiteral:
+		a.field(n, "Type")
+		a.list(n, "Keys")
+		a.list(n, "Elements")
+	case *expr.MapLiteral:
+		a.field(n, "Type")
+		a.list(n, "Keys")
+		a.list(n, "Values")
+	case *expr.ArrayLiteral:
+		a.field(n, "Type")
+		a.list(n, "Elems")
+	case *expr.SliceLiteral:
+		a.field(n, "Type")
+		a.list(n, "Elems")
+	case *expr.TableLiteral:
+		a.field(n, "Type")
+		a.list(n, "ColNames")
+		rows := reflect.ValueOf(n).Elem().FieldByName("Rows")
+		for i := 0; i < rows.Len(); i++ {
+			a.listOf(n, "Rows", rows.Index(i))
+		}
+	case *expr.Type:
+		a.field(n, "Type")
+	case *expr.Call:
+		a.field(n, "Func")
+		a.list(n, "Args")
+	case *expr.Shell:
+		a.list(n, "Cmds")
+	case *expr.ShellList:
+		a.list(n, "AndOr")
+	case *expr.ShellAndOr:
+		a.list(n, "Pipeline")
+	case *expr.ShellPipeline:
+		a.list(n, "Cmd")
+	case *expr.ShellCmd:
+		a.field(n, "SimpleCmd", "Subshell")
+	case *expr.ShellSimpleCmd:
+		a.list(n, "Redirect")
+		a.list(n, "Assign")
+
+	// Statements
+	case *stmt.Bad, *stmt.Branch:
+		// nothing to do
+	case *stmt.Import:
+		a.field(n, "Doc")
+	case *stmt.ImportSet:
+		a.field(n, "Doc")
+		a.list(n, "Imports")
+	case *stmt.TypeDecl:
+		a.field(n, "Doc", "Type")
+	case *stmt.MethodikDecl:
+		a.field(n, "Doc", "Type")
+		a.list(n, "Methods")
+	case *stmt.Const:
+		a.field(n, "Doc", "Type", "Value")
+	case *stmt.ConstSet:
+		a.field(n, "Doc")
+		a.list(n, "Consts")
+	case *stmt.Var:
+		a.field(n, "Doc", "Type")
+		a.list(n, "Values")
+	case *stmt.VarSet:
+		a.field(n, "Doc")
+		a.list(n, "Vars")
+	case *stmt.Assign:
+		a.list(n, "Left")
+		a.list(n, "Right")
+	case *stmt.Block:
+		a.list(n, "Stmts")
+	case *stmt.If:
+		a.field(n, "Init", "Cond", "Body", "Else")
+	case *stmt.For:
+		a.field(n, "Init", "Cond", "Post", "Body")
+	case *stmt.Switch:
+		a.field(n, "Init", "Cond")
+		a.list(n, "Cases")
+	case *stmt.SwitchCase:
+		a.list(n, "Conds")
+		a.field(n, "Body")
+	case *stmt.TypeSwitch:
+		a.field(n, "Init", "Assign")
+		a.list(n, "Cases")
+	case *stmt.TypeSwitchCase:
+		a.list(n, "Types")
+		a.field(n, "Body")
+	case *stmt.Go:
+		a.field(n, "Call")
+	case *stmt.Defer:
+		a.field(n, "Call")
+	case *stmt.Range:
+		a.field(n, "Key", "Val", "Expr", "Body")
+	case *stmt.Return:
+		a.list(n, "Exprs")
+	case *stmt.Simple:
+		a.field(n, "Expr")
+	case *stmt.Select:
+		a.list(n, "Cases")
+	case *stmt.SelectCase:
+		a.field(n, "Comm", "Body")
+	case *stmt.Send:
+		a.field(n, "Chan", "Value")
+	case *stmt.Labeled:
+		a.field(n, "Stmt")
+
+	// Types
+	case tipe.Basic, tipe.Builtin, *tipe.Unresolved, *tipe.Package:
+		// nothing to do
+	case *tipe.Func:
+		a.list(n, "TypeParams")
+		a.field(n, "Params", "Results")
+	case *tipe.Struct:
+		a.list(n, "Fields")
+	case *tipe.Named:
+		if !a.seen[n] {
+			a.seen[n] = true
+			a.list(n, "TypeParams")
+			a.field(n, "Type")
+			a.list(n, "Methods")
+		}
+	case *tipe.Array:
+		if n.LenExpr != nil {
+			a.field(n, "LenExpr")
+		}
+		a.field(n, "Elem")
+	case *tipe.Slice:
+		a.field(n, "Elem")
+	case *tipe.Table:
+		a.field(n, "Type")
+	case *tipe.Tuple:
+		a.list(n, "Elems")
+	case *tipe.Pointer:
+		a.field(n, "Elem")
+	case *tipe.Chan:
+		a.field(n, "Elem")
+	case *tipe.Map:
+		a.field(n, "Key", "Value")
+	case *tipe.Interface:
+		a.methods(n)
+	case *tipe.Alias:
+		a.field(n, "Type")
+	case *tipe.TypeParam:
+		a.field(n, "Constraint")
+
+	default:
+		panic(fmt.Sprintf("walk: unexpected node type %T", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+
+	a.cursor = saved
+}
@@ -0,0 +1,358 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package walk traverses Neugram syntax trees.
+package walk
+
+import (
+	"fmt"
+	"sort"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/tipe"
+)
+
+// A Node is one of
+//
+//	expr.Expr
+//	stmt.Stmt
+//	tipe.Type
+//	*stmt.SwitchCase, *stmt.TypeSwitchCase, *stmt.SelectCase
+//	*expr.CommentGroup, *expr.Comment
+type Node interface{}
+
+// A Visitor's Visit method is invoked for each node encountered by
+// Walk. If the result visitor w is not nil, Walk visits each of the
+// children of node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order. It starts by
+// calling v.Visit(node), which must not be nil.
+//
+// Named types (*tipe.Named) are entered once per Walk, so
+// recursive types do not loop.
+func Walk(v Visitor, node Node) {
+	w := &walker{seen: make(map[*tipe.Named]bool)}
+	w.walk(v, node)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a syntax tree in depth-first order. It starts
+// by calling f(node). If f returns true, Inspect invokes f for each
+// of the children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+type walker struct {
+	seen map[*tipe.Named]bool
+}
+
+func (w *walker) exprs(v Visitor, list []expr.Expr) {
+	for _, x := range list {
+		w.walk(v, x)
+	}
+}
+
+func (w *walker) stmts(v Visitor, list []stmt.Stmt) {
+	for _, s := range list {
+		w.walk(v, s)
+	}
+}
+
+func (w *walker) types(v Visitor, list []tipe.Type) {
+	for _, t := range list {
+		w.walk(v, t)
+	}
+}
+
+// walkDoc walks an optional doc comment. A nil *expr.CommentGroup
+// is not a node.
+func (w *walker) walkDoc(v Visitor, doc *expr.CommentGroup) {
+	if doc != nil {
+		w.walk(v, doc)
+	}
+}
+
+// walkNonNil walks an optional child. The child is passed as an
+// interface, so a nil expr.Expr, stmt.Stmt, or tipe.Type is a nil Node.
+func (w *walker) walkNonNil(v Visitor, node Node) {
+	if node != nil {
+		w.walk(v, node)
+	}
+}
+
+func (w *walker) walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Comments
+	case *expr.Comment:
+		// nothing to do
+	case *expr.CommentGroup:
+		for _, c := range n.List {
+			w.walk(v, c)
+		}
+
+	// Expressions
+	case *expr.Bad, *expr.BasicLiteral, *expr.Ident,
+		*expr.ShellRedirect, *expr.ShellAssign:
+		// nothing to do
+	case *expr.Binary:
+		w.walk(v, n.Left)
+		w.walk(v, n.Right)
+	case *expr.Unary:
+		w.walk(v, n.Expr)
+	case *expr.Selector:
+		w.walk(v, n.Left)
+		w.walk(v, n.Right)
+	case *expr.TypeAssert:
+		w.walk(v, n.Expr)
+		if n.Type != nil { // nil in x.(type)
+			w.walk(v, n.Type)
+		}
+	case *expr.Slice:
+		w.walkNonNil(v, n.Low)
+		w.walkNonNil(v, n.High)
+		w.walkNonNil(v, n.Max)
+	case *expr.Index:
+		w.walk(v, n.Left)
+		w.exprs(v, n.Indicies)
+	case *expr.FuncLiteral:
+		w.walkDoc(v, n.Doc)
+		w.walk(v, n.Type)
+		if body, ok := n.Body.(*stmt.Block); ok && body != nil {
+			w.walk(v, body)
+		}
+	case *expr.CompLiteral:
+		w.walk(v, n.Type)
+		w.exprs(v, n.Keys)
+		w.exprs(v, n.Elements)
+	case *expr.MapLiteral:
+		w.walk(v, n.Type)
+		for i := range n.Keys {
+			w.walk(v, n.Keys[i])
+			w.walk(v, n.Values[i])
+		}
+	case *expr.ArrayLiteral:
+		w.walk(v, n.Type)
+		w.exprs(v, n.Elems)
+	case *expr.SliceLiteral:
+		w.walk(v, n.Type)
+		w.exprs(v, n.Elems)
+	case *expr.TableLiteral:
+		w.walk(v, n.Type)
+		w.exprs(v, n.ColNames)
+		for _, row := range n.Rows {
+			w.exprs(v, row)
+		}
+	case *expr.Type:
+		w.walk(v, n.Type)
+	case *expr.Call:
+		w.walk(v, n.Func)
+		w.exprs(v, n.Args)
+	case *expr.Shell:
+		for _, l := range n.Cmds {
+			w.walk(v, l)
+		}
+	case *expr.ShellList:
+		for _, a := range n.AndOr {
+			w.walk(v, a)
+		}
+	case *expr.ShellAndOr:
+		for _, p := range n.Pipeline {
+			w.walk(v, p)
+		}
+	case *expr.ShellPipeline:
+		for _, c := range n.Cmd {
+			w.walk(v, c)
+		}
+	case *expr.ShellCmd:
+		if n.SimpleCmd != nil {
+			w.walk(v, n.SimpleCmd)
+		}
+		if n.Subshell != nil {
+			w.walk(v, n.Subshell)
+		}
+	case *expr.ShellSimpleCmd:
+		for _, r := range n.Redirect {
+			w.walk(v, r)
+		}
+		for i := range n.Assign {
+			w.walk(v, &n.Assign[i])
+		}
+
+	// Statements
+	case *stmt.Bad, *stmt.Branch:
+		// nothing to do
+	case *stmt.Import:
+		w.walkDoc(v, n.Doc)
+	case *stmt.ImportSet:
+		w.walkDoc(v, n.Doc)
+		for _, s := range n.Imports {
+			w.walk(v, s)
+		}
+	case *stmt.TypeDecl:
+		w.walkDoc(v, n.Doc)
+		w.walk(v, n.Type)
+	case *stmt.MethodikDecl:
+		w.walkDoc(v, n.Doc)
+		w.walk(v, n.Type)
+		for _, m := range n.Methods {
+			w.walk(v, m)
+		}
+	case *stmt.Const:
+		w.walkDoc(v, n.Doc)
+		w.walkNonNil(v, n.Type)
+		w.walk(v, n.Value)
+	case *stmt.ConstSet:
+		w.walkDoc(v, n.Doc)
+		for _, c := range n.Consts {
+			w.walk(v, c)
+		}
+	case *stmt.Var:
+		w.walkDoc(v, n.Doc)
+		w.walkNonNil(v, n.Type)
+		w.exprs(v, n.Values)
+	case *stmt.VarSet:
+		w.walkDoc(v, n.Doc)
+		for _, s := range n.Vars {
+			w.walk(v, s)
+		}
+	case *stmt.Assign:
+		w.exprs(v, n.Left)
+		w.exprs(v, n.Right)
+	case *stmt.Block:
+		w.stmts(v, n.Stmts)
+	case *stmt.If:
+		w.walkNonNil(v, n.Init)
+		w.walk(v, n.Cond)
+		w.walk(v, n.Body)
+		w.walkNonNil(v, n.Else)
+	case *stmt.For:
+		w.walkNonNil(v, n.Init)
+		w.walkNonNil(v, n.Cond)
+		w.walkNonNil(v, n.Post)
+		w.walk(v, n.Body)
+	case *stmt.Switch:
+		w.walkNonNil(v, n.Init)
+		w.walkNonNil(v, n.Cond)
+		for i := range n.Cases {
+			w.walk(v, &n.Cases[i])
+		}
+	case *stmt.SwitchCase:
+		w.exprs(v, n.Conds)
+		w.walk(v, n.Body)
+	case *stmt.TypeSwitch:
+		w.walkNonNil(v, n.Init)
+		w.walk(v, n.Assign)
+		for i := range n.Cases {
+			w.walk(v, &n.Cases[i])
+		}
+	case *stmt.TypeSwitchCase:
+		w.types(v, n.Types)
+		w.walk(v, n.Body)
+	case *stmt.Go:
+		w.walk(v, n.Call)
+	case *stmt.Defer:
+		w.walk(v, n.Call)
+	case *stmt.Range:
+		w.walkNonNil(v, n.Key)
+		w.walkNonNil(v, n.Val)
+		w.walk(v, n.Expr)
+		w.walk(v, n.Body)
+	case *stmt.Return:
+		w.exprs(v, n.Exprs)
+	case *stmt.Simple:
+		w.walk(v, n.Expr)
+	case *stmt.Select:
+		for i := range n.Cases {
+			w.walk(v, &n.Cases[i])
+		}
+	case *stmt.SelectCase:
+		w.walkNonNil(v, n.Comm)
+		w.walk(v, n.Body)
+	case *stmt.Send:
+		w.walk(v, n.Chan)
+		w.walk(v, n.Value)
+	case *stmt.Labeled:
+		w.walk(v, n.Stmt)
+
+	// Types
+	case tipe.Basic, tipe.Builtin, *tipe.Unresolved, *tipe.Package:
+		// nothing to do
+	case *tipe.Func:
+		for _, p := range n.TypeParams {
+			w.walk(v, p)
+		}
+		if n.Params != nil {
+			w.walk(v, n.Params)
+		}
+		if n.Results != nil {
+			w.walk(v, n.Results)
+		}
+	case *tipe.Struct:
+		w.types(v, n.Fields)
+	case *tipe.Named:
+		if !w.seen[n] {
+			w.seen[n] = true
+			for _, p := range n.TypeParams {
+				w.walk(v, p)
+			}
+			w.walkNonNil(v, n.Type)
+			for _, m := range n.Methods {
+				w.walk(v, m)
+			}
+		}
+	case *tipe.Array:
+		w.walkNonNil(v, n.LenExpr)
+		w.walk(v, n.Elem)
+	case *tipe.Slice:
+		w.walk(v, n.Elem)
+	case *tipe.Table:
+		w.walk(v, n.Type)
+	case *tipe.Tuple:
+		w.types(v, n.Elems)
+	case *tipe.Pointer:
+		w.walk(v, n.Elem)
+	case *tipe.Chan:
+		w.walk(v, n.Elem)
+	case *tipe.Map:
+		w.walk(v, n.Key)
+		w.walk(v, n.Value)
+	case *tipe.Interface:
+		names := make([]string, 0, len(n.Methods))
+		for name := range n.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w.walk(v, n.Methods[name])
+		}
+	case *tipe.Alias:
+		w.walk(v, n.Type)
+	case *tipe.TypeParam:
+		if n.Constraint != nil {
+			w.walk(v, n.Constraint)
+		}
+
+	default:
+		panic(fmt.Sprintf("walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
@@ -0,0 +1,276 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package walk_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/expr"
+	"neugram.io/ng/parser"
+	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax/walk"
+	"neugram.io/ng/tipe"
+	"neugram.io/ng/token"
+)
+
+const src = `// f adds.
+func f(x, y int) int {
+	return x + y
+}
+
+const (
+	a = 1
+	b
+)
+
+for i := 0; i < 3; i++ {
+	switch {
+	case i == 1:
+		f(i, 2)
+	default:
+	}
+}
+
+m := map[string]int{"one": 1}
+for k, v := range m {
+	_ = k[1:]
+	_ = v
+}
+`
+
+// visitor records the visited nodes and checks that each call of
+// Visit(nil) ends a node.
+type visitor struct {
+	t     *testing.T
+	stack []walk.Node
+	names []string
+}
+
+func (v *visitor) Visit(node walk.Node) walk.Visitor {
+	if node == nil {
+		if len(v.stack) == 0 {
+			v.t.Fatal("Visit(nil) with no node to end")
+		}
+		v.stack = v.stack[:len(v.stack)-1]
+		return nil
+	}
+	v.stack = append(v.stack, node)
+	v.names = append(v.names, strings.TrimPrefix(fmt.Sprintf("%T", node), "*"))
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "walk.ng", []byte(src), parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &visitor{t: t}
+	for _, s := range f.Stmts {
+		walk.Walk(v, s)
+	}
+	if len(v.stack) != 0 {
+		t.Errorf("%d nodes not ended with Visit(nil)", len(v.stack))
+	}
+
+	got := make(map[string]int)
+	for _, name := range v.names {
+		got[name]++
+	}
+	want := map[string]int{
+		"expr.CommentGroup": 1,
+		"expr.Comment":      1,
+		"expr.FuncLiteral":  1,
+		"stmt.Return":       1,
+		"stmt.ConstSet":     1,
+		"stmt.Const":        2,
+		"stmt.For":          1,
+		"stmt.Switch":       1,
+		"stmt.SwitchCase":   2,
+		"stmt.Range":        1,
+		"expr.Slice":        1,
+		"expr.MapLiteral":   1,
+		"tipe.Map":          1,
+		"tipe.Func":         1,
+		"tipe.Tuple":        2,
+		"expr.Call":         1,
+	}
+	for name, n := range want {
+		if got[name] != n {
+			t.Errorf("visited %s %d times, want %d", name, got[name], n)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	s, err := parser.ParseStmt([]byte("x := func() { y := a + b }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Do not descend into function literals.
+	var idents []string
+	walk.Inspect(s, func(node walk.Node) bool {
+		switch node := node.(type) {
+		case *expr.FuncLiteral:
+			return false
+		case *expr.Ident:
+			idents = append(idents, node.Name)
+		}
+		return true
+	})
+	if got, want := strings.Join(idents, ","), "x"; got != want {
+		t.Errorf("idents=%s, want %s", got, want)
+	}
+
+	idents = nil
+	walk.Inspect(s, func(node walk.Node) bool {
+		if node, ok := node.(*expr.Ident); ok {
+			idents = append(idents, node.Name)
+		}
+		return true
+	})
+	if got, want := strings.Join(idents, ","), "x,y,a,b"; got != want {
+		t.Errorf("idents=%s, want %s", got, want)
+	}
+}
+
+func TestWalkRecursiveType(t *testing.T) {
+	// methodik T struct { next *T }
+	m := &tipe.Named{Name: "T"}
+	m.Type = &tipe.Struct{
+		FieldNames: []string{"next"},
+		Fields:     []tipe.Type{&tipe.Pointer{Elem: m}},
+	}
+	n := 0
+	walk.Inspect(&stmt.TypeDecl{Name: "T", Type: m}, func(node walk.Node) bool {
+		if node == m {
+			n++
+		}
+		return true
+	})
+	if n != 2 {
+		t.Errorf("visited T %d times, want 2", n)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s, err := parser.ParseStmt([]byte(`func() {
+	a := 1
+	b := a
+	print(a, b)
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename a to c, delete the assignment to b, and
+	// insert a return after the call.
+	var parents []string
+	res := walk.Apply(s, func(c *walk.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *expr.Ident:
+			if n.Name == "a" {
+				parents = append(parents, fmt.Sprintf("%T.%s[%d]", c.Parent(), c.Name(), c.Index()))
+				c.Replace(&expr.Ident{Name: "c"})
+			}
+		case *stmt.Assign:
+			if n.Left[0].(*expr.Ident).Name == "b" {
+				c.Delete()
+				return false
+			}
+		case *stmt.Simple:
+			if c.Index() >= 0 {
+				c.InsertAfter(&stmt.Return{})
+			}
+		}
+		return true
+	}, nil)
+	if res != s {
+		t.Errorf("Apply returned %v, want the root", res)
+	}
+
+	want := "[*stmt.Assign.Left[0] *expr.Call.Args[0]]"
+	if got := fmt.Sprint(parents); got != want {
+		t.Errorf("parents=%s, want %s", got, want)
+	}
+
+	body := s.(*stmt.Simple).Expr.(*expr.FuncLiteral).Body.(*stmt.Block)
+	if len(body.Stmts) != 3 {
+		t.Fatalf("len(Stmts)=%d, want 3", len(body.Stmts))
+	}
+	if name := body.Stmts[0].(*stmt.Assign).Left[0].(*expr.Ident).Name; name != "c" {
+		t.Errorf("Stmts[0] assigns to %s, want c", name)
+	}
+	if arg := body.Stmts[1].(*stmt.Simple).Expr.(*expr.Call).Args[0].(*expr.Ident).Name; arg != "c" {
+		t.Errorf("Stmts[1] passes %s, want c", arg)
+	}
+	if _, ok := body.Stmts[2].(*stmt.Return); !ok {
+		t.Errorf("Stmts[2] is %T, want *stmt.Return", body.Stmts[2])
+	}
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	e := &expr.Binary{Op: token.Add, Left: &expr.Ident{Name: "x"}, Right: &expr.Ident{Name: "y"}}
+
+	// Swap the operands of the addition, and fill in the missing
+	// high bound of a slice.
+	res := walk.Apply(e, func(c *walk.Cursor) bool {
+		if b, ok := c.Node().(*expr.Binary); ok {
+			c.Replace(&expr.Slice{Low: b.Right})
+		}
+		if c.Name() == "High" && c.Node() == nil {
+			c.Replace(&expr.Ident{Name: "z"})
+		}
+		return true
+	}, nil)
+	sl, ok := res.(*expr.Slice)
+	if !ok {
+		t.Fatalf("Apply returned %T, want *expr.Slice", res)
+	}
+	if high, _ := sl.High.(*expr.Ident); high == nil || high.Name != "z" {
+		t.Errorf("High=%v, want z", sl.High)
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	s, err := parser.ParseStmt([]byte("x := a + b + c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idents []string
+	walk.Apply(s, nil, func(c *walk.Cursor) bool {
+		if n, ok := c.Node().(*expr.Ident); ok {
+			idents = append(idents, n.Name)
+			return n.Name != "a"
+		}
+		return true
+	})
+	if got, want := strings.Join(idents, ","), "x,a"; got != want {
+		t.Errorf("idents=%s, want %s", got, want)
+	}
+}
+
+func TestApplySwitchCases(t *testing.T) {
+	s, err := parser.ParseStmt([]byte("switch x {\ncase 1:\ncase 2:\ncase 3:\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	walk.Apply(s, func(c *walk.Cursor) bool {
+		if sc, ok := c.Node().(*stmt.SwitchCase); ok && c.Index() == 1 {
+			c.InsertBefore(&stmt.SwitchCase{Default: true})
+			c.Replace(&stmt.SwitchCase{Conds: sc.Conds[:0]})
+		}
+		return true
+	}, nil)
+	sw := s.(*stmt.Switch)
+	if len(sw.Cases) != 4 {
+		t.Fatalf("len(Cases)=%d, want 4", len(sw.Cases))
+	}
+	if !sw.Cases[1].Default || len(sw.Cases[2].Conds) != 0 || len(sw.Cases[3].Conds) != 1 {
+		t.Errorf("unexpected cases: %+v", sw.Cases)
+	}
+}
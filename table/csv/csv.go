@@ -0,0 +1,307 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package csv is the Neugram package csv, which reads and writes
+// tables as files of comma-separated values:
+//
+//	import "csv"
+//
+//	t := csv.Read("prices.csv")
+//	csv.Write(t, "copy.tsv", csv.Options{Delimiter: '\t'})
+//
+// The first record of a file names the columns, unless the option
+// NoHeader is set. Read infers the type of each column from its
+// values: int if every value is an integer, float64 if every value
+// is a number, bool if every value is true or false, and otherwise
+// string. Empty values do not count against a type, and are read
+// as the zero value of the column's type. A table read has the
+// Neugram type [|]interface{}, with columns of the inferred types.
+//
+// Write writes a table of any element type, formatting each value
+// as print does, except that floats are written in full precision.
+package csv
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+// Package is the Neugram package csv.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return "csv" }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Options": reflect.TypeOf(Options{}),
+		"Read":    Read,
+		"Write":   Write,
+	}
+}
+
+func init() {
+	eval.Register(Package)
+}
+
+// Options are the options of Read and Write. The zero Options read
+// and write a file with a header, separated by commas, with types
+// inferred.
+type Options struct {
+	Delimiter rune // separates values; 0 is ','
+	NoHeader  bool // the first record is values, not column names
+
+	// Strings leaves every column read a string, rather than
+	// inferring types.
+	Strings bool
+
+	// LazyQuotes lets Read accept a quote in an unquoted value,
+	// and a quote not doubled in a quoted value.
+	LazyQuotes bool
+
+	// QuoteAll makes Write quote every value, rather than only
+	// those holding a delimiter, quote, or line break.
+	QuoteAll bool
+}
+
+func options(opts []Options) (Options, error) {
+	switch len(opts) {
+	case 0:
+		return Options{}, nil
+	case 1:
+		return opts[0], nil
+	}
+	return Options{}, fmt.Errorf("csv: %d Options, want at most 1", len(opts))
+}
+
+func (o Options) delimiter() rune {
+	if o.Delimiter == 0 {
+		return ','
+	}
+	return o.Delimiter
+}
+
+// Read reads the table in the file path. It takes at most one
+// Options.
+func Read(path string, opts ...Options) (*table.Table, error) {
+	o, err := options(opts)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := ReadFrom(f, o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t, nil
+}
+
+// ReadFrom reads a table from r.
+func ReadFrom(r io.Reader, opts Options) (*table.Table, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.delimiter()
+	cr.LazyQuotes = opts.LazyQuotes
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %v", err)
+	}
+	var names []string
+	if !opts.NoHeader && len(records) > 0 {
+		names, records = records[0], records[1:]
+	}
+	width := len(names)
+	if len(records) > 0 {
+		width = len(records[0])
+	}
+	cols := make([]table.Column, width)
+	for x := range cols {
+		if x < len(names) {
+			cols[x].Name = names[x]
+		}
+		cols[x].Type = stringType
+		if !opts.Strings {
+			cols[x].Type = inferType(records, x)
+		}
+	}
+	t, err := table.New(cols...)
+	if err != nil {
+		return nil, fmt.Errorf("csv: %v", err)
+	}
+	row := make([]interface{}, width)
+	for y, rec := range records {
+		for x, s := range rec {
+			v, err := parse(s, cols[x].Type)
+			if err != nil {
+				return nil, fmt.Errorf("csv: record %d, column %d: %v", y+1, x+1, err)
+			}
+			row[x] = v
+		}
+		if err := t.AppendRow(row...); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+var (
+	intType     = reflect.TypeOf(0)
+	float64Type = reflect.TypeOf(0.0)
+	boolType    = reflect.TypeOf(false)
+	stringType  = reflect.TypeOf("")
+)
+
+// inferType returns the narrowest type that holds the values of
+// column x of records.
+func inferType(records [][]string, x int) reflect.Type {
+	isInt, isFloat, isBool := true, true, true
+	empty := true
+	for _, rec := range records {
+		s := rec[x]
+		if s == "" {
+			continue
+		}
+		empty = false
+		if isInt {
+			_, err := strconv.ParseInt(s, 10, 0)
+			isInt = err == nil
+		}
+		if isFloat {
+			_, err := strconv.ParseFloat(s, 64)
+			isFloat = err == nil
+		}
+		if isBool {
+			isBool = strings.EqualFold(s, "true") || strings.EqualFold(s, "false")
+		}
+	}
+	switch {
+	case empty:
+		return stringType
+	case isInt:
+		return intType
+	case isFloat:
+		return float64Type
+	case isBool:
+		return boolType
+	}
+	return stringType
+}
+
+// parse returns the value s of a column of type t.
+func parse(s string, t reflect.Type) (interface{}, error) {
+	if s == "" {
+		return reflect.Zero(t).Interface(), nil
+	}
+	switch t {
+	case intType:
+		v, err := strconv.ParseInt(s, 10, 0)
+		return int(v), err
+	case float64Type:
+		return strconv.ParseFloat(s, 64)
+	case boolType:
+		return strings.EqualFold(s, "true"), nil
+	}
+	return s, nil
+}
+
+// Write writes the table t to the file path, replacing it. It takes
+// at most one Options. The table is an interface{} so that a
+// Neugram table of any element type can be written, but it must be
+// a *table.Table.
+func Write(t interface{}, path string, opts ...Options) error {
+	o, err := options(opts)
+	if err != nil {
+		return err
+	}
+	tbl, ok := t.(*table.Table)
+	if !ok {
+		return fmt.Errorf("csv: cannot write %T, it is not a table", t)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteTo(f, tbl, o); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// WriteTo writes the table t to w.
+func WriteTo(w io.Writer, t *table.Table, opts Options) error {
+	bw := bufio.NewWriter(w)
+	var write func([]string) error
+	if opts.QuoteAll {
+		write = func(rec []string) error { return writeQuoted(bw, rec, opts.delimiter()) }
+	} else {
+		cw := csv.NewWriter(bw)
+		cw.Comma = opts.delimiter()
+		write = func(rec []string) error {
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	}
+	names := t.Cols()
+	if !opts.NoHeader && strings.Join(names, "") != "" {
+		if err := write(names); err != nil {
+			return fmt.Errorf("csv: %v", err)
+		}
+	}
+	rec := make([]string, t.NumCols())
+	for y := 0; y < t.Len(); y++ {
+		for x := range rec {
+			rec[x] = format(t.At(y, x))
+		}
+		if err := write(rec); err != nil {
+			return fmt.Errorf("csv: %v", err)
+		}
+	}
+	return bw.Flush()
+}
+
+// format returns v as a value of a CSV file.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeQuoted writes the record rec with every value quoted.
+func writeQuoted(w *bufio.Writer, rec []string, delim rune) error {
+	for i, s := range rec {
+		if i > 0 {
+			w.WriteRune(delim)
+		}
+		w.WriteByte('"')
+		w.WriteString(strings.Replace(s, `"`, `""`, -1))
+		w.WriteByte('"')
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/eval"
+)
+
+const prices = `name,qty,price,ok,note
+ann,3,1.5,true,
+"b, c",,2,FALSE,x
+`
+
+func TestReadFrom(t *testing.T) {
+	tbl, err := ReadFrom(strings.NewReader(prices), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tbl.Cols(), []string{"name", "qty", "price", "ok", "note"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %q, want %q", got, want)
+	}
+	for x, want := range []interface{}{
+		[]string{"ann", "b, c"},
+		[]int{3, 0},
+		[]float64{1.5, 2},
+		[]bool{true, false},
+		[]string{"", "x"},
+	} {
+		if got := tbl.Column(x); !reflect.DeepEqual(got, want) {
+			t.Errorf("column %d = %#v, want %#v", x, got, want)
+		}
+	}
+
+	tbl, err = ReadFrom(strings.NewReader("1;2\n3;x\n"), Options{Delimiter: ';', NoHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Len() != 2 || tbl.At(1, 0) != 3 || tbl.At(1, 1) != "x" || tbl.Cols()[0] != "" {
+		t.Errorf("read %v", tbl)
+	}
+	tbl, err = ReadFrom(strings.NewReader("a\n1\n"), Options{Strings: true})
+	if err != nil || tbl.At(0, 0) != "1" {
+		t.Errorf("read with Strings: %v, %v", tbl, err)
+	}
+
+	if _, err := ReadFrom(strings.NewReader("a,b\n1\n"), Options{}); err == nil {
+		t.Errorf("read of a short record succeeded")
+	}
+	if _, err := ReadFrom(strings.NewReader("a,a\n1,2\n"), Options{}); err == nil {
+		t.Errorf("read of duplicate columns succeeded")
+	}
+	if _, err := ReadFrom(strings.NewReader("a\nx\"y\n"), Options{LazyQuotes: true}); err != nil {
+		t.Errorf("read with LazyQuotes: %v", err)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	tbl, err := ReadFrom(strings.NewReader(prices), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteTo(buf, tbl, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,qty,price,ok,note\nann,3,1.5,true,\n\"b, c\",0,2,false,x\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf, want)
+	}
+
+	buf.Reset()
+	if err := WriteTo(buf, tbl, Options{Delimiter: '\t', NoHeader: true, QuoteAll: true}); err != nil {
+		t.Fatal(err)
+	}
+	want = "\"ann\"\t\"3\"\t\"1.5\"\t\"true\"\t\"\"\n\"b, c\"\t\"0\"\t\"2\"\t\"false\"\t\"x\"\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf, want)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.csv")
+	if err := ioutil.WriteFile(in, []byte(prices), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := eval.New(eval.Options{})
+	p.Set("dir", dir)
+	src := `import "csv"
+t := csv.Read(dir + "/in.csv")
+csv.Write(t, dir + "/out.tsv", csv.Options{Delimiter: '\t'})
+u := [|]float64{{|"x", "y"|}, {1, 0.1}}
+csv.Write(u, dir + "/u.csv")
+len(t) * 10 + cols(t)`
+	res, err := p.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != 25 {
+		t.Errorf("len and cols of the table read = %v, want 25", res)
+	}
+	for file, want := range map[string]string{
+		"out.tsv": "name\tqty\tprice\tok\tnote\nann\t3\t1.5\ttrue\t\nb, c\t0\t2\tfalse\tx\n",
+		"u.csv":   "x,y\n1,0.1\n",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s = %q, want %q", file, b, want)
+		}
+	}
+
+	if _, err := p.Eval(`csv.Read(dir + "/none.csv")`); err == nil {
+		t.Errorf("read of a missing file succeeded")
+	}
+}
@@ -0,0 +1,580 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package json is the Neugram package json, which decodes JSON
+// arrays of objects into tables, and encodes tables and other
+// values as JSON:
+//
+//	import "json"
+//
+//	users := json.Decode($$ curl -s https://example.com/users $$)
+//	print(json.Encode(users, json.Options{Indent: "  "}))
+//
+// A decoded table has a column for each key of the objects, in the
+// order the keys first appear. The type of a column is inferred
+// from its values: int if every value is an integer, float64 if
+// every value is a number, bool or string if every value is one,
+// and otherwise interface{}. Missing keys and nulls do not count
+// against a type, and are decoded as the zero value of the
+// column's type. A table decoded has the Neugram type
+// [|]interface{}.
+//
+// A nested object is one value, a map[string]interface{}, unless
+// the option Flatten is set. Then each of its keys is a column,
+// named by the key of the object and the key within it, as in
+// "address.city". Encoding with Flatten does the reverse, nesting
+// the values of columns whose names hold the separator.
+//
+// Encode writes a table as an array of objects, one for each row,
+// or an array of arrays if its columns have no names. Structs,
+// including methodik values, are objects of their fields, maps are
+// objects with their keys as text, and slices and arrays are
+// arrays. Integers and floats that are not finite are null.
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+// Package is the Neugram package json.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return "json" }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Options": reflect.TypeOf(Options{}),
+		"Decode":  Decode,
+		"Encode":  Encode,
+		"Read":    Read,
+		"Write":   Write,
+	}
+}
+
+func init() {
+	eval.Register(Package)
+}
+
+// Options are the options of decoding and encoding. The zero
+// Options keep nested objects whole and encode without indenting.
+type Options struct {
+	// Flatten makes the keys of nested objects columns of their
+	// own when decoding, and nests columns when encoding.
+	Flatten bool
+
+	// Separator joins the keys of a flattened column name. If
+	// it is empty, it is ".".
+	Separator string
+
+	// Indent, if not empty, indents each level of the encoded
+	// JSON, which then has a line for each element.
+	Indent string
+}
+
+func options(opts []Options) (Options, error) {
+	var o Options
+	switch len(opts) {
+	case 0:
+	case 1:
+		o = opts[0]
+	default:
+		return o, fmt.Errorf("json: %d Options, want at most 1", len(opts))
+	}
+	if o.Separator == "" {
+		o.Separator = "."
+	}
+	return o, nil
+}
+
+// Decode decodes data, a JSON array of objects, into a table. It
+// takes at most one Options.
+func Decode(data string, opts ...Options) (*table.Table, error) {
+	o, err := options(opts)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFrom(strings.NewReader(data), o)
+}
+
+// Read decodes the JSON array of objects in the file path into a
+// table. It takes at most one Options.
+func Read(path string, opts ...Options) (*table.Table, error) {
+	o, err := options(opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ReadFrom(bytes.NewReader(b), o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t, nil
+}
+
+// ReadFrom decodes a JSON array of objects from r into a table.
+func ReadFrom(r io.Reader, opts Options) (*table.Table, error) {
+	if opts.Separator == "" {
+		opts.Separator = "."
+	}
+	var objs []json.RawMessage
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&objs); err != nil {
+		return nil, fmt.Errorf("json: want an array of objects: %v", err)
+	}
+
+	// Collect the columns, in the order their keys appear.
+	var names []string
+	index := make(map[string]int)
+	var rows []map[string]interface{}
+	for i, raw := range objs {
+		row := make(map[string]interface{})
+		if err := decodeObject(raw, "", opts, row, func(key string) {
+			if _, ok := index[key]; !ok {
+				index[key] = len(names)
+				names = append(names, key)
+			}
+		}); err != nil {
+			return nil, fmt.Errorf("json: element %d: %v", i, err)
+		}
+		rows = append(rows, row)
+	}
+
+	cols := make([]table.Column, len(names))
+	for x, name := range names {
+		cols[x] = table.Column{Name: name, Type: inferType(rows, name)}
+	}
+	t, err := table.New(cols...)
+	if err != nil {
+		return nil, fmt.Errorf("json: %v", err)
+	}
+	vals := make([]interface{}, len(cols))
+	for _, row := range rows {
+		for x, col := range cols {
+			vals[x] = convert(row[col.Name], col.Type)
+		}
+		if err := t.AppendRow(vals...); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// decodeObject decodes the object raw into row, by key, calling
+// addKey for each key in the order they appear. Keys are prefixed
+// by prefix, and nested objects are flattened if opts.Flatten.
+func decodeObject(raw json.RawMessage, prefix string, opts Options, row map[string]interface{}, addKey func(string)) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("%s is not an object", raw)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + tok.(string)
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+		if opts.Flatten && len(val) > 0 && val[0] == '{' {
+			if err := decodeObject(val, key+opts.Separator, opts, row, addKey); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := decodeValue(val)
+		if err != nil {
+			return err
+		}
+		addKey(key)
+		row[key] = v
+	}
+	return nil
+}
+
+// decodeValue decodes the JSON value raw, with numbers that are
+// integers as int and others as float64.
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return numbers(v), nil
+}
+
+// numbers replaces the json.Numbers in v by ints and float64s.
+func numbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	}
+	return v
+}
+
+var (
+	intType     = reflect.TypeOf(0)
+	float64Type = reflect.TypeOf(0.0)
+	boolType    = reflect.TypeOf(false)
+	stringType  = reflect.TypeOf("")
+	ifaceType   = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// inferType returns the narrowest type that holds the values of the
+// column name of rows.
+func inferType(rows []map[string]interface{}, name string) reflect.Type {
+	var typ reflect.Type
+	for _, row := range rows {
+		v := row[name]
+		if v == nil {
+			continue
+		}
+		t := reflect.TypeOf(v)
+		switch {
+		case typ == nil || typ == t:
+			typ = t
+		case typ == intType && t == float64Type || typ == float64Type && t == intType:
+			typ = float64Type
+		default:
+			return ifaceType
+		}
+	}
+	switch typ {
+	case intType, float64Type, boolType, stringType:
+		return typ
+	}
+	return ifaceType
+}
+
+// convert returns v as a value of a column of type t.
+func convert(v interface{}, t reflect.Type) interface{} {
+	if v == nil {
+		return reflect.Zero(t).Interface()
+	}
+	if i, isInt := v.(int); isInt && t == float64Type {
+		return float64(i)
+	}
+	return v
+}
+
+// Encode returns v as JSON. It takes at most one Options.
+func Encode(v interface{}, opts ...Options) (string, error) {
+	o, err := options(opts)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteTo(buf, v, o); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Write writes v as JSON to the file path, replacing it. It takes
+// at most one Options.
+func Write(v interface{}, path string, opts ...Options) error {
+	o, err := options(opts)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteTo(buf, v, o); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// WriteTo writes v as JSON to w, followed by a newline.
+func WriteTo(w io.Writer, v interface{}, opts Options) error {
+	if opts.Separator == "" {
+		opts.Separator = "."
+	}
+	e := &encoder{opts: opts}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	b := e.buf.Bytes()
+	if opts.Indent != "" {
+		out := new(bytes.Buffer)
+		if err := json.Indent(out, b, "", opts.Indent); err != nil {
+			return fmt.Errorf("json: %v", err)
+		}
+		b = out.Bytes()
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+type encoder struct {
+	buf  bytes.Buffer
+	opts Options
+}
+
+func (e *encoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	switch x := v.Interface().(type) {
+	case *table.Table:
+		return e.encodeTable(x)
+	case *big.Int:
+		if x == nil {
+			e.buf.WriteString("null")
+		} else {
+			e.buf.WriteString(x.String())
+		}
+		return nil
+	case *big.Float:
+		if x == nil || x.IsInf() {
+			e.buf.WriteString("null")
+		} else {
+			e.buf.WriteString(x.Text('g', -1))
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			e.buf.WriteString("null")
+			return nil
+		}
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	case reflect.Map:
+		return e.encodeMap(v)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break // base64, as encoding/json
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		e.buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+		return nil
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("json: cannot encode a %s", v.Type())
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("json: %v", err)
+	}
+	e.buf.Write(b)
+	return nil
+}
+
+func (e *encoder) encodeKey(key string) {
+	b, _ := json.Marshal(key)
+	e.buf.Write(b)
+	e.buf.WriteByte(':')
+}
+
+func (e *encoder) encodeStruct(v reflect.Value) error {
+	t := v.Type()
+	e.buf.WriteByte('{')
+	n := 0
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// A methodik value embeds a field for its methods, which
+		// is not data.
+		if f.PkgPath != "" || f.Anonymous && f.Type.Kind() != reflect.Struct {
+			continue
+		}
+		name := f.Name
+		switch tag := f.Tag.Get("ng"); tag {
+		case "-":
+			continue
+		case "":
+		default:
+			name = tag
+		}
+		if n > 0 {
+			e.buf.WriteByte(',')
+		}
+		n++
+		e.encodeKey(name)
+		if err := e.encode(v.Field(i)); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func (e *encoder) encodeMap(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	keys := v.MapKeys()
+	names := make([]string, len(keys))
+	byName := make(map[string]reflect.Value)
+	for i, k := range keys {
+		names[i] = fmt.Sprint(k.Interface())
+		byName[names[i]] = v.MapIndex(k)
+	}
+	sort.Strings(names)
+	e.buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.encodeKey(name)
+		if err := e.encode(byName[name]); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func (e *encoder) encodeTable(t *table.Table) error {
+	if t == nil {
+		e.buf.WriteString("null")
+		return nil
+	}
+	names := t.Cols()
+	e.buf.WriteByte('[')
+	for y := 0; y < t.Len(); y++ {
+		if y > 0 {
+			e.buf.WriteByte(',')
+		}
+		var err error
+		if strings.Join(names, "") == "" {
+			err = e.encode(reflect.ValueOf(t.Row(y)))
+		} else {
+			err = e.encodeRow(t, y, names)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte(']')
+	return nil
+}
+
+// encodeRow encodes row y of t as an object. With Flatten, columns
+// named a.b and a.c are the keys b and c of an object a.
+func (e *encoder) encodeRow(t *table.Table, y int, names []string) error {
+	root := &object{}
+	for x, name := range names {
+		path := []string{name}
+		if e.opts.Flatten {
+			path = strings.Split(name, e.opts.Separator)
+		}
+		if err := root.set(path, t.Value(y, x)); err != nil {
+			return fmt.Errorf("json: column %q: %v", name, err)
+		}
+	}
+	return e.encodeObject(root)
+}
+
+// An object is a JSON object being built from the columns of a row.
+type object struct {
+	keys []string
+	vals map[string]interface{} // reflect.Value or *object
+}
+
+func (o *object) set(path []string, v reflect.Value) error {
+	if o.vals == nil {
+		o.vals = make(map[string]interface{})
+	}
+	key := path[0]
+	old, exists := o.vals[key]
+	if !exists {
+		o.keys = append(o.keys, key)
+	}
+	if len(path) == 1 {
+		if exists {
+			return fmt.Errorf("key %q is both a value and an object", key)
+		}
+		o.vals[key] = v
+		return nil
+	}
+	sub, isObj := old.(*object)
+	if exists && !isObj {
+		return fmt.Errorf("key %q is both a value and an object", key)
+	}
+	if !exists {
+		sub = &object{}
+		o.vals[key] = sub
+	}
+	return sub.set(path[1:], v)
+}
+
+func (e *encoder) encodeObject(o *object) error {
+	e.buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.encodeKey(key)
+		var err error
+		switch v := o.vals[key].(type) {
+		case *object:
+			err = e.encodeObject(v)
+		case reflect.Value:
+			err = e.encode(v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+const users = `[
+	{"id": 1, "name": "ann", "addr": {"city": "x", "zip": 10}, "ok": true},
+	{"id": 2.5, "tags": ["a"], "addr": {"city": "y"}, "ok": null, "name": null}
+]`
+
+func TestDecode(t *testing.T) {
+	tbl, err := Decode(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tbl.Cols(), []string{"id", "name", "addr", "ok", "tags"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %q, want %q", got, want)
+	}
+	for x, want := range []interface{}{
+		[]float64{1, 2.5},
+		[]string{"ann", ""},
+		[]interface{}{
+			map[string]interface{}{"city": "x", "zip": 10},
+			map[string]interface{}{"city": "y"},
+		},
+		[]bool{true, false},
+		[]interface{}{nil, []interface{}{"a"}},
+	} {
+		if got := tbl.Column(x); !reflect.DeepEqual(got, want) {
+			t.Errorf("column %d = %#v, want %#v", x, got, want)
+		}
+	}
+
+	tbl, err = Decode(users, Options{Flatten: true, Separator: "_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tbl.Cols(), []string{"id", "name", "addr_city", "addr_zip", "ok", "tags"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flattened columns %q, want %q", got, want)
+	}
+	if got := tbl.Column(3); !reflect.DeepEqual(got, []int{10, 0}) {
+		t.Errorf("column addr_zip = %#v", got)
+	}
+
+	for _, data := range []string{`{"a": 1}`, `[1, 2]`, `[{"a": 1}`} {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("Decode(%s) succeeded", data)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tbl, err := Decode(users, Options{Flatten: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		v    interface{}
+		opts Options
+		want string
+	}{
+		{tbl, Options{Flatten: true}, `[{"id":1,"name":"ann","addr":{"city":"x","zip":10},"ok":true,"tags":null},{"id":2.5,"name":"","addr":{"city":"y","zip":0},"ok":false,"tags":["a"]}]`},
+		{tbl, Options{}, `[{"id":1,"name":"ann","addr.city":"x","addr.zip":10,"ok":true,"tags":null},{"id":2.5,"name":"","addr.city":"y","addr.zip":0,"ok":false,"tags":["a"]}]`},
+		{map[string]interface{}{"b": []int{1}, "a": math.NaN()}, Options{}, `{"a":null,"b":[1]}`},
+		{map[int]string{2: "x"}, Options{Indent: " "}, "{\n \"2\": \"x\"\n}"},
+		{struct {
+			Name  string
+			Score float64 `ng:"score"`
+			skip  int
+		}{Name: "a", Score: 1.5}, Options{}, `{"Name":"a","score":1.5}`},
+		{[]byte("hi"), Options{}, `"aGk="`},
+		{nil, Options{}, `null`},
+	} {
+		got, err := Encode(test.v, test.opts)
+		if err != nil {
+			t.Errorf("Encode(%v): %v", test.v, err)
+		} else if got != test.want {
+			t.Errorf("Encode(%v) = %s, want %s", test.v, got, test.want)
+		}
+	}
+
+	unnamed, _ := table.New(table.Column{Type: reflect.TypeOf(0)}, table.Column{})
+	unnamed.AppendRow(1, "x")
+	if got, err := Encode(unnamed); err != nil || got != `[[1,"x"]]` {
+		t.Errorf("Encode of a table with no column names = %s, %v", got, err)
+	}
+	clash, _ := table.New(table.Column{Name: "a", Type: reflect.TypeOf(0)}, table.Column{Name: "a.b", Type: reflect.TypeOf(0)})
+	clash.AppendRow(1, 2)
+	if _, err := Encode(clash, Options{Flatten: true}); err == nil {
+		t.Errorf("Encode of columns a and a.b with Flatten succeeded")
+	}
+	if _, err := Encode(func() {}); err == nil {
+		t.Errorf("Encode of a func succeeded")
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "users.json"), []byte(users), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := eval.New(eval.Options{})
+	p.Set("dir", dir)
+	src := `import "json"
+t := json.Read(dir + "/users.json", json.Options{Flatten: true})
+methodik point struct {
+	X int
+	Y float64
+} {
+	func (p) Norm() float64 { return float64(p.X)*float64(p.X) + p.Y*p.Y }
+}
+json.Write([]point{point{X: 1, Y: 0.5}}, dir + "/points.json")
+u := [|]int{{|"a.b", "a.c"|}, {1, 2}}
+s := json.Encode(u, json.Options{Flatten: true})
+len(t) * 10 + cols(t)`
+	res, err := p.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != 26 {
+		t.Errorf("len and cols of the table read = %v, want 26", res)
+	}
+	if s, _ := p.Get("s"); s != `[{"a":{"b":1,"c":2}}]` {
+		t.Errorf("encoded table = %v", s)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "points.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "[{\"X\":1,\"Y\":0.5}]\n"; got != want {
+		t.Errorf("points.json = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+)
+
+var errCorrupt = errors.New("corrupt page")
+
+// decodeRLE decodes n values of width bits from b, in the hybrid of
+// run length encoding and bit packing that holds levels and
+// dictionary indices.
+func decodeRLE(b []byte, width, n int) ([]int32, error) {
+	if width < 0 || width > 32 {
+		return nil, errCorrupt
+	}
+	out := make([]int32, 0, n)
+	byteWidth := (width + 7) / 8
+	for len(out) < n {
+		h, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, errCorrupt
+		}
+		b = b[k:]
+		if h&1 == 0 { // a run of one value
+			if len(b) < byteWidth {
+				return nil, errCorrupt
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(b[i]) << (8 * uint(i))
+			}
+			b = b[byteWidth:]
+			for i := uint64(0); i < h>>1 && len(out) < n; i++ {
+				out = append(out, int32(v))
+			}
+			continue
+		}
+		// Groups of 8 values, packed from the low bit up.
+		size := int(h>>1) * width
+		if size < 0 || size > len(b) {
+			return nil, errCorrupt
+		}
+		for i := 0; i < int(h>>1)*8 && len(out) < n; i++ {
+			var v uint32
+			for j := 0; j < width; j++ {
+				bit := i*width + j
+				v |= uint32(b[bit/8]>>uint(bit%8)&1) << uint(j)
+			}
+			out = append(out, int32(v))
+		}
+		b = b[size:]
+	}
+	return out, nil
+}
+
+// bitWidth returns the bits needed to hold values up to max.
+func bitWidth(max int) int {
+	w := 0
+	for ; max > 0; max >>= 1 {
+		w++
+	}
+	return w
+}
+
+// decodePlain decodes n values of the column c from b, in the plain
+// encoding, into a slice of the column's Go type.
+func decodePlain(b []byte, c *column, n int) (reflect.Value, error) {
+	vals := reflect.MakeSlice(reflect.SliceOf(c.goType), n, n)
+	fixed := func(size int) error {
+		if n*size > len(b) || n*size < 0 {
+			return errCorrupt
+		}
+		return nil
+	}
+	switch c.el.typ {
+	case typeBoolean:
+		if (n+7)/8 > len(b) {
+			return vals, errCorrupt
+		}
+		for i := 0; i < n; i++ {
+			vals.Index(i).SetBool(b[i/8]>>uint(i%8)&1 != 0)
+		}
+	case typeInt32:
+		if err := fixed(4); err != nil {
+			return vals, err
+		}
+		for i := 0; i < n; i++ {
+			v := int32(binary.LittleEndian.Uint32(b[4*i:]))
+			if k := c.goType.Kind(); k >= reflect.Uint && k <= reflect.Uint64 {
+				vals.Index(i).SetUint(uint64(uint32(v)))
+			} else {
+				vals.Index(i).SetInt(int64(v))
+			}
+		}
+	case typeInt64:
+		if err := fixed(8); err != nil {
+			return vals, err
+		}
+		for i := 0; i < n; i++ {
+			v := binary.LittleEndian.Uint64(b[8*i:])
+			if c.goType.Kind() == reflect.Uint64 {
+				vals.Index(i).SetUint(v)
+			} else {
+				vals.Index(i).SetInt(int64(v))
+			}
+		}
+	case typeInt96:
+		// Nanoseconds of the day, then the Julian day.
+		if err := fixed(12); err != nil {
+			return vals, err
+		}
+		for i := 0; i < n; i++ {
+			nanos := int64(binary.LittleEndian.Uint64(b[12*i:]))
+			day := int64(binary.LittleEndian.Uint32(b[12*i+8:]))
+			vals.Index(i).SetInt((day-julianUnixEpoch)*86400e9 + nanos)
+		}
+	case typeFloat:
+		if err := fixed(4); err != nil {
+			return vals, err
+		}
+		for i := 0; i < n; i++ {
+			vals.Index(i).SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))))
+		}
+	case typeDouble:
+		if err := fixed(8); err != nil {
+			return vals, err
+		}
+		for i := 0; i < n; i++ {
+			vals.Index(i).SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:])))
+		}
+	case typeByteArray, typeFixedLenByteArray:
+		for i := 0; i < n; i++ {
+			size := int(c.el.typeLength)
+			if c.el.typ == typeByteArray {
+				if len(b) < 4 {
+					return vals, errCorrupt
+				}
+				size = int(binary.LittleEndian.Uint32(b))
+				b = b[4:]
+			}
+			if size < 0 || size > len(b) {
+				return vals, errCorrupt
+			}
+			if c.goType.Kind() == reflect.String {
+				vals.Index(i).SetString(string(b[:size]))
+			} else {
+				vals.Index(i).SetBytes(append(make([]byte, 0, size), b[:size]...))
+			}
+			b = b[size:]
+		}
+	default:
+		return vals, fmt.Errorf("unknown physical type %d", c.el.typ)
+	}
+	return vals, nil
+}
+
+// julianUnixEpoch is the Julian day of 1970-01-01.
+const julianUnixEpoch = 2440588
+
+// encodePlain appends the values of the slice vals, of the column c,
+// to b in the plain encoding.
+func encodePlain(b []byte, vals reflect.Value, c *column) []byte {
+	n := vals.Len()
+	var tmp [8]byte
+	switch c.el.typ {
+	case typeBoolean:
+		packed := make([]byte, (n+7)/8)
+		for i := 0; i < n; i++ {
+			if vals.Index(i).Bool() {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		b = append(b, packed...)
+	case typeInt32:
+		for i := 0; i < n; i++ {
+			v := vals.Index(i)
+			var x uint32
+			if k := v.Kind(); k >= reflect.Uint && k <= reflect.Uint64 {
+				x = uint32(v.Uint())
+			} else {
+				x = uint32(v.Int())
+			}
+			binary.LittleEndian.PutUint32(tmp[:], x)
+			b = append(b, tmp[:4]...)
+		}
+	case typeInt64:
+		for i := 0; i < n; i++ {
+			v := vals.Index(i)
+			var x uint64
+			if k := v.Kind(); k >= reflect.Uint && k <= reflect.Uint64 {
+				x = v.Uint()
+			} else {
+				x = uint64(v.Int())
+			}
+			binary.LittleEndian.PutUint64(tmp[:], x)
+			b = append(b, tmp[:]...)
+		}
+	case typeFloat:
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(float32(vals.Index(i).Float())))
+			b = append(b, tmp[:4]...)
+		}
+	case typeDouble:
+		for i := 0; i < n; i++ {
+			binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(vals.Index(i).Float()))
+			b = append(b, tmp[:]...)
+		}
+	case typeByteArray:
+		for i := 0; i < n; i++ {
+			v := vals.Index(i)
+			var s []byte
+			if v.Kind() == reflect.String {
+				s = []byte(v.String())
+			} else {
+				s = v.Bytes()
+			}
+			binary.LittleEndian.PutUint32(tmp[:], uint32(len(s)))
+			b = append(b, tmp[:4]...)
+			b = append(b, s...)
+		}
+	}
+	return b
+}
+
+// decompress returns the page data b, compressed by codec, in full.
+func decompress(b []byte, codec int64, size int64) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return b, nil
+	case codecSnappy:
+		return snappyDecode(b, size)
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unsupported compression %s", codecName(codec))
+}
+
+func compress(b []byte, codec int64) []byte {
+	switch codec {
+	case codecSnappy:
+		return snappyEncode(b)
+	case codecGzip:
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write(b)
+		zw.Close()
+		return buf.Bytes()
+	}
+	return b
+}
+
+var codecNames = []string{"none", "snappy", "gzip", "lzo", "brotli", "lz4", "zstd", "lz4_raw"}
+
+func codecName(codec int64) string {
+	if codec >= 0 && codec < int64(len(codecNames)) {
+		return codecNames[codec]
+	}
+	return fmt.Sprintf("codec %d", codec)
+}
@@ -0,0 +1,277 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+// The metadata of parquet.thrift used to read and write flat
+// tables. Field ids are those of parquet.thrift.
+
+// Physical types.
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDouble            = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// Repetitions of a field.
+const (
+	repRequired = 0
+	repOptional = 1
+	repRepeated = 2
+)
+
+// Converted types, the older form of logical types.
+const (
+	convUTF8 = 0
+	convEnum = 4
+	convJSON = 19
+)
+
+// Encodings.
+const (
+	encPlain     = 0
+	encPlainDict = 2
+	encRLE       = 3
+	encBitPacked = 4
+	encRLEDict   = 8
+)
+
+// Compression codecs.
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+// Page types.
+const (
+	pageData       = 0
+	pageIndex      = 1
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+type fileMeta struct {
+	version   int64
+	schema    []schemaElement
+	numRows   int64
+	rowGroups []rowGroup
+	createdBy string
+}
+
+type schemaElement struct {
+	typ         int64 // -1 for a group
+	typeLength  int64
+	repetition  int64
+	name        string
+	numChildren int64
+	converted   int64 // -1 if none
+	isString    bool  // the logical type is STRING, ENUM, or JSON
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	numRows int64
+}
+
+type columnChunk struct {
+	filePath         string
+	typ              int64
+	path             []string
+	codec            int64
+	numValues        int64
+	compressedSize   int64
+	uncompressedSize int64
+	dataPageOffset   int64
+	dictPageOffset   int64 // 0 if none
+	hasDictPage      bool
+}
+
+type pageHeader struct {
+	typ              int64
+	uncompressedSize int64
+	compressedSize   int64
+
+	numValues int64
+	encoding  int64
+
+	// Data page v2
+	numNulls     int64
+	defLevelsLen int64
+	repLevelsLen int64
+	isCompressed bool
+}
+
+func decodeFileMeta(s tstruct) (*fileMeta, error) {
+	m := &fileMeta{
+		version:   s.int(1),
+		numRows:   s.int(3),
+		createdBy: s.string(6),
+	}
+	for _, v := range s.list(2) {
+		e, _ := v.(tstruct)
+		el := schemaElement{
+			typ:         -1,
+			typeLength:  e.int(2),
+			repetition:  e.int(3),
+			name:        e.string(4),
+			numChildren: e.int(5),
+			converted:   -1,
+		}
+		if e.has(1) {
+			el.typ = e.int(1)
+		}
+		if e.has(6) {
+			el.converted = e.int(6)
+		}
+		switch el.converted {
+		case convUTF8, convEnum, convJSON:
+			el.isString = true
+		}
+		if lt := e.strct(10); lt != nil {
+			// STRING, ENUM, and JSON of the LogicalType union.
+			el.isString = el.isString || lt.has(1) || lt.has(4) || lt.has(12)
+		}
+		m.schema = append(m.schema, el)
+	}
+	for _, v := range s.list(4) {
+		g, _ := v.(tstruct)
+		rg := rowGroup{numRows: g.int(3)}
+		for _, v := range g.list(1) {
+			c, _ := v.(tstruct)
+			md := c.strct(3)
+			if md == nil {
+				return nil, errThrift
+			}
+			cc := columnChunk{
+				filePath:       c.string(1),
+				typ:            md.int(1),
+				codec:          md.int(4),
+				numValues:      md.int(5),
+				compressedSize: md.int(7),
+				dataPageOffset: md.int(9),
+				dictPageOffset: md.int(11),
+				hasDictPage:    md.has(11),
+			}
+			for _, p := range md.list(3) {
+				b, _ := p.([]byte)
+				cc.path = append(cc.path, string(b))
+			}
+			rg.columns = append(rg.columns, cc)
+		}
+		m.rowGroups = append(m.rowGroups, rg)
+	}
+	return m, nil
+}
+
+func decodePageHeader(s tstruct) pageHeader {
+	h := pageHeader{
+		typ:              s.int(1),
+		uncompressedSize: s.int(2),
+		compressedSize:   s.int(3),
+	}
+	switch {
+	case s.has(5):
+		d := s.strct(5)
+		h.numValues = d.int(1)
+		h.encoding = d.int(2)
+	case s.has(7):
+		d := s.strct(7)
+		h.numValues = d.int(1)
+		h.encoding = d.int(2)
+	case s.has(8):
+		d := s.strct(8)
+		h.numValues = d.int(1)
+		h.numNulls = d.int(2)
+		h.encoding = d.int(4)
+		h.defLevelsLen = d.int(5)
+		h.repLevelsLen = d.int(6)
+		h.isCompressed = !d.has(7) || d.bool(7)
+	}
+	return h
+}
+
+func (m *fileMeta) fields() []tfield {
+	var schema tlist
+	for _, e := range m.schema {
+		var f []tfield
+		if e.typ >= 0 {
+			f = append(f, tfield{1, int32(e.typ)})
+		}
+		if e.numChildren == 0 {
+			f = append(f, tfield{3, int32(e.repetition)})
+		}
+		f = append(f, tfield{4, e.name})
+		if e.numChildren > 0 {
+			f = append(f, tfield{5, int32(e.numChildren)})
+		}
+		if e.converted >= 0 {
+			f = append(f, tfield{6, int32(e.converted)})
+		}
+		if e.isString {
+			f = append(f, tfield{10, []tfield{{1, []tfield{}}}}) // LogicalType{STRING: StringType{}}
+		}
+		schema = append(schema, f)
+	}
+	var groups tlist
+	for _, g := range m.rowGroups {
+		var cols tlist
+		var size int64
+		for _, c := range g.columns {
+			var path tlist
+			for _, p := range c.path {
+				path = append(path, p)
+			}
+			md := []tfield{
+				{1, int32(c.typ)},
+				{2, tlist{int32(encPlain), int32(encRLE)}},
+				{3, path},
+				{4, int32(c.codec)},
+				{5, c.numValues},
+				{6, c.uncompressedSize},
+				{7, c.compressedSize},
+				{9, c.dataPageOffset},
+			}
+			if c.hasDictPage {
+				md = append(md, tfield{11, c.dictPageOffset})
+			}
+			cols = append(cols, []tfield{
+				{2, c.dataPageOffset},
+				{3, md},
+			})
+			size += c.uncompressedSize
+		}
+		groups = append(groups, []tfield{
+			{1, cols},
+			{2, size},
+			{3, g.numRows},
+		})
+	}
+	return []tfield{
+		{1, int32(m.version)},
+		{2, schema},
+		{3, m.numRows},
+		{4, groups},
+		{6, m.createdBy},
+	}
+}
+
+func (h *pageHeader) fields() []tfield {
+	return []tfield{
+		{1, int32(h.typ)},
+		{2, int32(h.uncompressedSize)},
+		{3, int32(h.compressedSize)},
+		{5, []tfield{
+			{1, int32(h.numValues)},
+			{2, int32(h.encoding)},
+			{3, int32(encRLE)}, // definition levels
+			{4, int32(encRLE)}, // repetition levels
+		}},
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package parquet is the Neugram package parquet, which reads and
+// writes tables as Apache Parquet files:
+//
+//	import "parquet"
+//
+//	t := parquet.Read("trips.parquet", parquet.Options{Columns: []string{"id", "fare"}})
+//	parquet.Write(t, "copy.parquet", parquet.Options{Compression: "snappy"})
+//
+// A file is a sequence of row groups, each holding its rows column
+// by column. A large file can be read a row group at a time, with
+// NumRowGroups and ReadRowGroup, so only one row group is in memory:
+//
+//	for i := 0; i < parquet.NumRowGroups(path); i++ {
+//		t := parquet.ReadRowGroup(path, i)
+//		...
+//	}
+//
+// Columns keep their types. Integers of each size, floats, bools,
+// strings, and []byte are read as the Go types they were written
+// from; INT96 timestamps are read as int64 nanoseconds since 1970.
+// Null values of optional columns are read as the zero value. Only
+// flat files are read: nested and repeated columns are an error.
+// Pages may be plain or dictionary encoded, uncompressed or
+// compressed with Snappy or gzip.
+//
+// Write writes a table of columns of those types, in row groups of
+// Options.RowGroupSize rows. A table read has the Neugram type
+// [|]interface{}.
+package parquet
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+// Package is the Neugram package parquet.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return "parquet" }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Options":      reflect.TypeOf(Options{}),
+		"NumRowGroups": NumRowGroups,
+		"Read":         Read,
+		"ReadRowGroup": ReadRowGroup,
+		"Write":        Write,
+	}
+}
+
+func init() {
+	eval.Register(Package)
+}
+
+// Options are the options of reading and writing files. The zero
+// Options read every column, and write uncompressed row groups of
+// DefaultRowGroupSize rows.
+type Options struct {
+	// Columns names the columns to read, in the order of the
+	// table read. If empty, every column is read.
+	Columns []string
+
+	// Compression is the codec of the pages written:
+	// "none" (or ""), "snappy", or "gzip".
+	Compression string
+
+	// RowGroupSize is the most rows written in a row group.
+	RowGroupSize int
+}
+
+func options(opts []Options) (Options, error) {
+	switch len(opts) {
+	case 0:
+		return Options{}, nil
+	case 1:
+		return opts[0], nil
+	}
+	return Options{}, fmt.Errorf("parquet: %d Options, want at most 1", len(opts))
+}
+
+func (o Options) codec() (int64, error) {
+	switch o.Compression {
+	case "", "none":
+		return codecUncompressed, nil
+	case "snappy":
+		return codecSnappy, nil
+	case "gzip":
+		return codecGzip, nil
+	}
+	return 0, fmt.Errorf("parquet: unknown compression %q", o.Compression)
+}
+
+// open opens the file path and calls fn with a Reader of it.
+func open(path string, fn func(r *Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := fn(r); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Read reads every row group of the file path as one table. It
+// takes at most one Options.
+func Read(path string, opts ...Options) (*table.Table, error) {
+	o, err := options(opts)
+	if err != nil {
+		return nil, err
+	}
+	var t *table.Table
+	err = open(path, func(r *Reader) error {
+		cols := r.Columns()
+		if len(o.Columns) > 0 {
+			idx, err := r.project(o.Columns)
+			if err != nil {
+				return err
+			}
+			all := cols
+			cols = nil
+			for _, x := range idx {
+				cols = append(cols, all[x])
+			}
+		}
+		if t, err = table.New(cols...); err != nil {
+			return err
+		}
+		for i := 0; i < r.NumRowGroups(); i++ {
+			g, err := r.ReadRowGroup(i, o.Columns...)
+			if err != nil {
+				return err
+			}
+			if err := t.Append(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReadRowGroup reads row group i of the file path as a table. It
+// takes at most one Options.
+func ReadRowGroup(path string, i int, opts ...Options) (*table.Table, error) {
+	o, err := options(opts)
+	if err != nil {
+		return nil, err
+	}
+	var t *table.Table
+	err = open(path, func(r *Reader) error {
+		t, err = r.ReadRowGroup(i, o.Columns...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NumRowGroups returns the number of row groups of the file path.
+func NumRowGroups(path string) (int, error) {
+	n := 0
+	err := open(path, func(r *Reader) error {
+		n = r.NumRowGroups()
+		return nil
+	})
+	return n, err
+}
+
+// Write writes the table t to the file path. It takes at most one
+// Options.
+func Write(t interface{}, path string, opts ...Options) error {
+	o, err := options(opts)
+	if err != nil {
+		return err
+	}
+	tbl, ok := t.(*table.Table)
+	if !ok {
+		return fmt.Errorf("parquet: cannot write %T, it is not a table", t)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	pw, err := NewWriter(bw, tbl.Columns(), o)
+	if err == nil {
+		err = pw.Write(tbl)
+	}
+	if err == nil {
+		err = pw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return f.Close()
+}
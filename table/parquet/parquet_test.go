@@ -0,0 +1,335 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+func allTypes(t *testing.T) *table.Table {
+	cols := []table.Column{
+		{Name: "b", Type: reflect.TypeOf(false)},
+		{Name: "i8", Type: reflect.TypeOf(int8(0))},
+		{Name: "i16", Type: reflect.TypeOf(int16(0))},
+		{Name: "i32", Type: reflect.TypeOf(int32(0))},
+		{Name: "i64", Type: reflect.TypeOf(int64(0))},
+		{Name: "u8", Type: reflect.TypeOf(uint8(0))},
+		{Name: "u16", Type: reflect.TypeOf(uint16(0))},
+		{Name: "u32", Type: reflect.TypeOf(uint32(0))},
+		{Name: "u64", Type: reflect.TypeOf(uint64(0))},
+		{Name: "f32", Type: reflect.TypeOf(float32(0))},
+		{Name: "f64", Type: reflect.TypeOf(float64(0))},
+		{Name: "s", Type: reflect.TypeOf("")},
+		{Name: "raw", Type: reflect.TypeOf([]byte(nil))},
+	}
+	tbl, err := table.FromColumns(cols,
+		[]bool{true, false, true},
+		[]int8{-128, 0, 127},
+		[]int16{-300, 1, 300},
+		[]int32{-1 << 31, 2, 1<<31 - 1},
+		[]int64{-1 << 63, 3, 1<<63 - 1},
+		[]uint8{0, 4, 255},
+		[]uint16{0, 5, 65535},
+		[]uint32{0, 6, 1<<32 - 1},
+		[]uint64{0, 7, 1<<64 - 1},
+		[]float32{-1.5, 0, 3.25},
+		[]float64{-2.5, 0.1, 1e300},
+		[]string{"", "héllo", "world"},
+		[][]byte{{}, {0, 1}, {255}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
+
+func writeTable(t *testing.T, tbl *table.Table, opts Options) []byte {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, tbl.Columns(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(tbl); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newReader(t *testing.T, b []byte) *Reader {
+	r, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := allTypes(t)
+	for _, compression := range []string{"", "snappy", "gzip"} {
+		b := writeTable(t, want, Options{Compression: compression})
+		r := newReader(t, b)
+		if r.NumRows() != 3 || r.NumRowGroups() != 1 {
+			t.Errorf("%q: %d rows in %d row groups, want 3 in 1", compression, r.NumRows(), r.NumRowGroups())
+			continue
+		}
+		if got := r.Columns(); !reflect.DeepEqual(got, want.Columns()) {
+			t.Errorf("%q: columns %v, want %v", compression, got, want.Columns())
+		}
+		got, err := r.ReadRowGroup(0)
+		if err != nil {
+			t.Errorf("%q: %v", compression, err)
+			continue
+		}
+		for x := 0; x < want.NumCols(); x++ {
+			if !reflect.DeepEqual(got.Column(x), want.Column(x)) {
+				t.Errorf("%q: column %d = %#v, want %#v", compression, x, got.Column(x), want.Column(x))
+			}
+		}
+	}
+}
+
+func TestRowGroups(t *testing.T) {
+	cols := []table.Column{{Type: reflect.TypeOf(0)}, {Type: reflect.TypeOf("")}}
+	tbl, err := table.New(cols...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tbl.AppendRow(i, string(rune('a'+i)))
+	}
+	b := writeTable(t, tbl, Options{RowGroupSize: 4, Compression: "snappy"})
+	r := newReader(t, b)
+	if r.NumRowGroups() != 3 || r.NumRows() != 10 {
+		t.Fatalf("%d rows in %d row groups, want 10 in 3", r.NumRows(), r.NumRowGroups())
+	}
+	if got := r.Columns(); got[0].Name != "c0" || got[1].Name != "c1" || got[0].Type != reflect.TypeOf(int64(0)) {
+		t.Errorf("columns %v, want c0 int64 and c1 string", got)
+	}
+	g, err := r.ReadRowGroup(2, "c1", "c0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"i", "j"}; !reflect.DeepEqual(g.Column(0), want) {
+		t.Errorf("projected column = %v, want %v", g.Column(0), want)
+	}
+	if want := []int64{8, 9}; !reflect.DeepEqual(g.Column(1), want) {
+		t.Errorf("projected column = %v, want %v", g.Column(1), want)
+	}
+	if _, err := r.ReadRowGroup(3); err == nil {
+		t.Errorf("read of row group 3 of 3 succeeded")
+	}
+	if _, err := r.ReadRowGroup(0, "c2"); err == nil {
+		t.Errorf("read of a missing column succeeded")
+	}
+}
+
+// pageOf returns a page of header h and data, h's sizes set.
+func pageOf(h pageHeader, data []byte) []byte {
+	h.uncompressedSize = int64(len(data))
+	h.compressedSize = int64(len(data))
+	e := new(tencoder)
+	e.writeStruct(h.fields())
+	return append(e.buf, data...)
+}
+
+// TestEncodings reads pages as other writers write them: optional
+// columns with definition levels, and dictionaries.
+func TestEncodings(t *testing.T) {
+	var b []byte
+	b = append(b, magic...)
+
+	// An optional int32 column of 1, null, 3, null, holding the
+	// values 1 and 3 in a dictionary.
+	dictOff := int64(len(b))
+	b = append(b, pageOf(pageHeader{typ: pageDictionary, numValues: 2, encoding: encPlain},
+		[]byte{1, 0, 0, 0, 3, 0, 0, 0})...)
+	dataOff := int64(len(b))
+	var data []byte
+	data = append(data, 2, 0, 0, 0) // the length of the levels
+	data = append(data, 3, 0x05)    // one group of 8 levels: 1, 0, 1, 0
+	data = append(data, 1)          // the width of the indices
+	data = append(data, 2, 0, 2, 1) // runs of one 0, then one 1
+	b = append(b, pageOf(pageHeader{typ: pageData, numValues: 4, encoding: encRLEDict}, data)...)
+	c0 := columnChunk{
+		typ: typeInt32, path: []string{"x"}, numValues: 4,
+		compressedSize: int64(len(b)) - dictOff, dataPageOffset: dataOff,
+		dictPageOffset: dictOff, hasDictPage: true,
+	}
+
+	// A required boolean column of true, true, false, true in RLE.
+	boolOff := int64(len(b))
+	data = []byte{2, 0, 0, 0, 3, 0x0b}
+	b = append(b, pageOf(pageHeader{typ: pageData, numValues: 4, encoding: encRLE}, data)...)
+	c1 := columnChunk{
+		typ: typeBoolean, path: []string{"y"}, numValues: 4,
+		compressedSize: int64(len(b)) - boolOff, dataPageOffset: boolOff,
+	}
+
+	meta := fileMeta{
+		version: 1,
+		numRows: 4,
+		schema: []schemaElement{
+			{typ: -1, name: "schema", numChildren: 2, converted: -1},
+			{typ: typeInt32, name: "x", repetition: repOptional, converted: -1},
+			{typ: typeBoolean, name: "y", repetition: repRequired, converted: -1},
+		},
+		rowGroups: []rowGroup{{numRows: 4, columns: []columnChunk{c0, c1}}},
+	}
+	e := new(tencoder)
+	e.writeStruct(meta.fields())
+	b = append(b, e.buf...)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(e.buf)))
+	b = append(b, n[:]...)
+	b = append(b, magic...)
+
+	tbl, err := newReader(t, b).ReadRowGroup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tbl.Column(0), []int32{1, 0, 3, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("optional dictionary column = %v, want %v", got, want)
+	}
+	if got, want := tbl.Column(1), []bool{true, true, false, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RLE boolean column = %v, want %v", got, want)
+	}
+}
+
+// TestArrowFile reads testdata/arrow.parquet, written by the Apache
+// Arrow Parquet writer as described in testdata/README: snappy pages,
+// dictionaries, statistics, and the Arrow schema in the metadata.
+func TestArrowFile(t *testing.T) {
+	r, err := os.Open("testdata/arrow.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := NewReader(r, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.NumRows() != 3 || pr.NumRowGroups() != 1 {
+		t.Errorf("%d rows in %d row groups, want 3 in 1", pr.NumRows(), pr.NumRowGroups())
+	}
+	wantCols := []table.Column{
+		{Name: "id", Type: reflect.TypeOf(int64(0))},
+		{Name: "name", Type: reflect.TypeOf("")},
+		{Name: "score", Type: reflect.TypeOf(float64(0))},
+		{Name: "ok", Type: reflect.TypeOf(false)},
+		{Name: "n", Type: reflect.TypeOf(int32(0))},
+	}
+	if got := pr.Columns(); !reflect.DeepEqual(got, wantCols) {
+		t.Errorf("columns %v, want %v", got, wantCols)
+	}
+	tbl, err := pr.ReadRowGroup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range []interface{}{
+		[]int64{1, 2, 3},
+		[]string{"ann", "", "cy"},
+		[]float64{0.5, 1.5, 0},
+		[]bool{true, false, true},
+		[]int32{-7, 0, 7},
+	} {
+		if got := tbl.Column(x); !reflect.DeepEqual(got, want) {
+			t.Errorf("column %d = %#v, want %#v", x, got, want)
+		}
+	}
+}
+
+func TestSnappy(t *testing.T) {
+	for _, src := range [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("abcdabcdabcdabcdabcdabcdabcdabcd"),
+		bytes.Repeat([]byte("neugram "), 1000),
+		bytes.Repeat([]byte{0}, 70000),
+	} {
+		enc := snappyEncode(src)
+		dec, err := snappyDecode(enc, int64(len(src)))
+		if err != nil {
+			t.Errorf("decode of %d bytes: %v", len(src), err)
+			continue
+		}
+		if !bytes.Equal(dec, src) {
+			t.Errorf("decode of %d bytes = %d bytes, not the same", len(src), len(dec))
+		}
+		if len(src) > 100 && len(enc) > len(src)/4 {
+			t.Errorf("%d repetitive bytes encoded in %d", len(src), len(enc))
+		}
+	}
+	if _, err := snappyDecode([]byte{4, 0x05, 1, 2}, 4); err == nil {
+		t.Errorf("decode of a copy before the start succeeded")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader([]byte("PAR1 not a file PAR2")), 20); err == nil {
+		t.Errorf("read of a file with bad magic succeeded")
+	}
+	cols := []table.Column{{Name: "x", Type: reflect.TypeOf([]int(nil))}}
+	if _, err := NewWriter(new(bytes.Buffer), cols, Options{}); err == nil {
+		t.Errorf("writer of a []int column succeeded")
+	}
+	if _, err := NewWriter(new(bytes.Buffer), nil, Options{Compression: "lzo"}); err == nil {
+		t.Errorf("writer with lzo compression succeeded")
+	}
+	b := writeTable(t, allTypes(t), Options{})
+	if _, err := NewReader(bytes.NewReader(b[:len(b)-1]), int64(len(b)-1)); err == nil {
+		t.Errorf("read of a truncated file succeeded")
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := eval.New(eval.Options{})
+	p.Set("dir", dir)
+	src := `import "parquet"
+t := [|]float64{{|"x", "y"|}, {1, 0.5}, {2, 1.5}, {3, 2.5}}
+parquet.Write(t, dir + "/t.parquet", parquet.Options{RowGroupSize: 2, Compression: "gzip"})
+u := parquet.Read(dir + "/t.parquet", parquet.Options{Columns: []string{"y"}})
+g := parquet.ReadRowGroup(dir + "/t.parquet", 1)
+parquet.NumRowGroups(dir + "/t.parquet") * 100 + len(u) * 10 + len(g) + cols(u)`
+	res, err := p.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != 232 {
+		t.Errorf("row groups, lens and cols of the tables read = %v, want 232", res)
+	}
+
+	tbl, err := Read(filepath.Join(dir, "t.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.5, 1.5, 2.5}; !reflect.DeepEqual(tbl.Column(1), want) {
+		t.Errorf("column y = %v, want %v", tbl.Column(1), want)
+	}
+	if _, err := p.Eval(`parquet.Read(dir + "/none.parquet")`); err == nil {
+		t.Errorf("read of a missing file succeeded")
+	}
+}
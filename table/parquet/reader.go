@@ -0,0 +1,381 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	"neugram.io/ng/table"
+)
+
+const magic = "PAR1"
+
+// maxPageSize bounds the pages read, so a corrupt header does not
+// allocate without limit.
+const maxPageSize = 1 << 30
+
+// A column is a column of a file, a leaf of its schema.
+type column struct {
+	el     schemaElement
+	goType reflect.Type
+	maxDef int // 1 if the column is optional
+}
+
+// Converted types of integers.
+const (
+	convUint8  = 11
+	convUint16 = 12
+	convUint32 = 13
+	convUint64 = 14
+	convInt8   = 15
+	convInt16  = 16
+)
+
+// goTypeOf returns the Go type of the values of the leaf el.
+func goTypeOf(el schemaElement) (reflect.Type, error) {
+	switch el.typ {
+	case typeBoolean:
+		return reflect.TypeOf(false), nil
+	case typeInt32:
+		switch el.converted {
+		case convInt8:
+			return reflect.TypeOf(int8(0)), nil
+		case convInt16:
+			return reflect.TypeOf(int16(0)), nil
+		case convUint8:
+			return reflect.TypeOf(uint8(0)), nil
+		case convUint16:
+			return reflect.TypeOf(uint16(0)), nil
+		case convUint32:
+			return reflect.TypeOf(uint32(0)), nil
+		}
+		return reflect.TypeOf(int32(0)), nil
+	case typeInt64:
+		if el.converted == convUint64 {
+			return reflect.TypeOf(uint64(0)), nil
+		}
+		return reflect.TypeOf(int64(0)), nil
+	case typeInt96:
+		return reflect.TypeOf(int64(0)), nil
+	case typeFloat:
+		return reflect.TypeOf(float32(0)), nil
+	case typeDouble:
+		return reflect.TypeOf(float64(0)), nil
+	case typeByteArray, typeFixedLenByteArray:
+		if el.isString {
+			return reflect.TypeOf(""), nil
+		}
+		return reflect.TypeOf([]byte(nil)), nil
+	}
+	return nil, fmt.Errorf("column %q has unknown physical type %d", el.name, el.typ)
+}
+
+// A Reader reads the tables of a Parquet file, one row group at a
+// time.
+type Reader struct {
+	r    io.ReaderAt
+	meta *fileMeta
+	cols []column
+}
+
+// NewReader returns a Reader of the Parquet file in r, of size
+// bytes. It reads the metadata at the end of the file.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("parquet: file of %d bytes is too short", size)
+	}
+	var tail [8]byte
+	if _, err := r.ReadAt(tail[:], size-8); err != nil {
+		return nil, fmt.Errorf("parquet: %v", err)
+	}
+	if string(tail[4:]) != magic {
+		return nil, fmt.Errorf("parquet: not a Parquet file")
+	}
+	n := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if n > size-12 {
+		return nil, fmt.Errorf("parquet: metadata of %d bytes in a file of %d", n, size)
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, size-8-n); err != nil {
+		return nil, fmt.Errorf("parquet: %v", err)
+	}
+	s, err := newTDecoder(bytes.NewReader(buf)).readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("parquet: metadata: %v", err)
+	}
+	meta, err := decodeFileMeta(s)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: metadata: %v", err)
+	}
+	pr := &Reader{r: r, meta: meta}
+	if len(meta.schema) == 0 || int(meta.schema[0].numChildren) != len(meta.schema)-1 {
+		return nil, fmt.Errorf("parquet: nested columns are not supported")
+	}
+	for _, el := range meta.schema[1:] {
+		if el.numChildren > 0 || el.typ < 0 || el.repetition == repRepeated {
+			return nil, fmt.Errorf("parquet: column %q: nested columns are not supported", el.name)
+		}
+		t, err := goTypeOf(el)
+		if err != nil {
+			return nil, fmt.Errorf("parquet: %v", err)
+		}
+		c := column{el: el, goType: t}
+		if el.repetition == repOptional {
+			c.maxDef = 1
+		}
+		pr.cols = append(pr.cols, c)
+	}
+	for i, g := range meta.rowGroups {
+		if len(g.columns) != len(pr.cols) {
+			return nil, fmt.Errorf("parquet: row group %d has %d columns, want %d", i, len(g.columns), len(pr.cols))
+		}
+	}
+	return pr, nil
+}
+
+// NumRows returns the number of rows in the file.
+func (r *Reader) NumRows() int64 { return r.meta.numRows }
+
+// NumRowGroups returns the number of row groups in the file.
+func (r *Reader) NumRowGroups() int { return len(r.meta.rowGroups) }
+
+// Columns returns the columns of the file, with the Go types their
+// values are read as.
+func (r *Reader) Columns() []table.Column {
+	cols := make([]table.Column, len(r.cols))
+	for i, c := range r.cols {
+		cols[i] = table.Column{Name: c.el.name, Type: c.goType}
+	}
+	return cols
+}
+
+// project returns the indexes of the columns named names, or of all
+// columns if names is empty.
+func (r *Reader) project(names []string) ([]int, error) {
+	var idx []int
+	if len(names) == 0 {
+		for i := range r.cols {
+			idx = append(idx, i)
+		}
+		return idx, nil
+	}
+	for _, name := range names {
+		found := -1
+		for i, c := range r.cols {
+			if c.el.name == name {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("parquet: no column %q", name)
+		}
+		idx = append(idx, found)
+	}
+	return idx, nil
+}
+
+// ReadRowGroup reads row group i as a table. It reads only the
+// columns named names, in that order, or all columns if there are
+// none. Only the data of those columns in the row group is read.
+func (r *Reader) ReadRowGroup(i int, names ...string) (*table.Table, error) {
+	if i < 0 || i >= len(r.meta.rowGroups) {
+		return nil, fmt.Errorf("parquet: no row group %d of %d", i, len(r.meta.rowGroups))
+	}
+	idx, err := r.project(names)
+	if err != nil {
+		return nil, err
+	}
+	g := r.meta.rowGroups[i]
+	all := r.Columns()
+	cols := make([]table.Column, len(idx))
+	data := make([]interface{}, len(idx))
+	for j, x := range idx {
+		cols[j] = all[x]
+		vals, err := r.readChunk(&r.cols[x], &g.columns[x], int(g.numRows))
+		if err != nil {
+			return nil, fmt.Errorf("parquet: row group %d, column %q: %v", i, r.cols[x].el.name, err)
+		}
+		data[j] = vals.Interface()
+	}
+	return table.FromColumns(cols, data...)
+}
+
+// readChunk reads the n values of the column chunk cc of c.
+func (r *Reader) readChunk(c *column, cc *columnChunk, n int) (reflect.Value, error) {
+	if cc.filePath != "" {
+		return reflect.Value{}, fmt.Errorf("data in another file, %s, is not supported", cc.filePath)
+	}
+	start := cc.dataPageOffset
+	if cc.hasDictPage && cc.dictPageOffset > 0 && cc.dictPageOffset < start {
+		start = cc.dictPageOffset
+	}
+	if cc.compressedSize < 0 || cc.compressedSize > maxPageSize {
+		return reflect.Value{}, errCorrupt
+	}
+	buf := make([]byte, cc.compressedSize)
+	if _, err := r.r.ReadAt(buf, start); err != nil {
+		return reflect.Value{}, err
+	}
+
+	out := reflect.MakeSlice(reflect.SliceOf(c.goType), n, n)
+	var dict reflect.Value
+	row := 0
+	for row < n {
+		br := bytes.NewReader(buf)
+		s, err := newTDecoder(br).readStruct()
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("page header: %v", err)
+		}
+		buf = buf[len(buf)-br.Len():]
+		h := decodePageHeader(s)
+		if h.compressedSize < 0 || h.compressedSize > int64(len(buf)) || h.uncompressedSize < 0 || h.uncompressedSize > maxPageSize {
+			return reflect.Value{}, errCorrupt
+		}
+		page := buf[:h.compressedSize]
+		buf = buf[h.compressedSize:]
+
+		switch h.typ {
+		case pageDictionary:
+			data, err := decompress(page, cc.codec, h.uncompressedSize)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if dict, err = decodePlain(data, c, int(h.numValues)); err != nil {
+				return reflect.Value{}, err
+			}
+		case pageData, pageDataV2:
+			if h.numValues < 0 || row+int(h.numValues) > n {
+				return reflect.Value{}, errCorrupt
+			}
+			if err := r.readPage(c, cc, &h, page, dict, out.Slice(row, row+int(h.numValues))); err != nil {
+				return reflect.Value{}, err
+			}
+			row += int(h.numValues)
+		default: // index pages
+		}
+	}
+	return out, nil
+}
+
+// readPage reads the data page of header h into out.
+func (r *Reader) readPage(c *column, cc *columnChunk, h *pageHeader, page []byte, dict, out reflect.Value) error {
+	n := out.Len()
+	var defs []int32
+	var data []byte
+	if h.typ == pageDataV2 {
+		levels := h.repLevelsLen + h.defLevelsLen
+		if h.repLevelsLen < 0 || h.defLevelsLen < 0 || levels > int64(len(page)) {
+			return errCorrupt
+		}
+		if c.maxDef > 0 {
+			var err error
+			if defs, err = decodeRLE(page[h.repLevelsLen:levels], bitWidth(c.maxDef), n); err != nil {
+				return err
+			}
+		}
+		data = page[levels:]
+		if h.isCompressed {
+			var err error
+			if data, err = decompress(data, cc.codec, h.uncompressedSize-levels); err != nil {
+				return err
+			}
+		}
+	} else {
+		var err error
+		if data, err = decompress(page, cc.codec, h.uncompressedSize); err != nil {
+			return err
+		}
+		if c.maxDef > 0 {
+			if len(data) < 4 {
+				return errCorrupt
+			}
+			size := int(binary.LittleEndian.Uint32(data))
+			if size < 0 || 4+size > len(data) {
+				return errCorrupt
+			}
+			if defs, err = decodeRLE(data[4:4+size], bitWidth(c.maxDef), n); err != nil {
+				return err
+			}
+			data = data[4+size:]
+		}
+	}
+
+	present := n
+	if defs != nil {
+		present = 0
+		for _, d := range defs {
+			if int(d) == c.maxDef {
+				present++
+			}
+		}
+	}
+	var vals reflect.Value
+	switch h.encoding {
+	case encPlain:
+		var err error
+		if vals, err = decodePlain(data, c, present); err != nil {
+			return err
+		}
+	case encPlainDict, encRLEDict:
+		if !dict.IsValid() {
+			return fmt.Errorf("dictionary encoded page with no dictionary")
+		}
+		if present > 0 && len(data) < 1 {
+			return errCorrupt
+		}
+		var idx []int32
+		if present > 0 {
+			var err error
+			if idx, err = decodeRLE(data[1:], int(data[0]), present); err != nil {
+				return err
+			}
+		}
+		vals = reflect.MakeSlice(out.Type(), present, present)
+		for i, x := range idx {
+			if x < 0 || int(x) >= dict.Len() {
+				return errCorrupt
+			}
+			vals.Index(i).Set(dict.Index(int(x)))
+		}
+	case encRLE:
+		if c.el.typ != typeBoolean {
+			return fmt.Errorf("RLE encoding of a non-boolean column")
+		}
+		if h.typ != pageDataV2 {
+			if len(data) < 4 {
+				return errCorrupt
+			}
+			data = data[4:]
+		}
+		bits, err := decodeRLE(data, 1, present)
+		if err != nil {
+			return err
+		}
+		vals = reflect.MakeSlice(out.Type(), present, present)
+		for i, b := range bits {
+			vals.Index(i).SetBool(b != 0)
+		}
+	default:
+		return fmt.Errorf("unsupported encoding %d", h.encoding)
+	}
+
+	if defs == nil {
+		reflect.Copy(out, vals)
+		return nil
+	}
+	j := 0
+	for i, d := range defs {
+		if int(d) == c.maxDef { // nulls are left the zero value
+			out.Index(i).Set(vals.Index(j))
+			j++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import "encoding/binary"
+
+// Snappy is the usual compression of Parquet pages. A page is one
+// block of the Snappy format: its length, then literals and copies
+// of earlier bytes.
+
+// snappyDecode decodes the block src, which must hold size bytes.
+func snappyDecode(src []byte, size int64) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || int64(n) != size {
+		return nil, errCorrupt
+	}
+	src = src[k:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 3 {
+		case 0: // literal
+			length = int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				nb := length - 59
+				if len(src) < nb {
+					return nil, errCorrupt
+				}
+				length = 0
+				for i := 0; i < nb; i++ {
+					length |= int(src[i]) << (8 * uint(i))
+				}
+				src = src[nb:]
+			}
+			length++
+			if length <= 0 || length > len(src) || len(dst)+length > int(n) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 1: // copy with a 1-byte offset
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			length = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2: // copy with a 2-byte offset
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3: // copy with a 4-byte offset
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(n) {
+			return nil, errCorrupt
+		}
+		for i := 0; i < length; i++ { // the copy may overlap itself
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if len(dst) != int(n) {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
+
+// snappyEncode encodes src as a block, copying the earlier bytes of
+// four byte sequences found again.
+func snappyEncode(src []byte) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	dst := append([]byte(nil), tmp[:binary.PutUvarint(tmp[:], uint64(len(src)))]...)
+	const tableBits = 14
+	var table [1 << tableBits]int32 // positions + 1, by hash
+	load := func(i int) uint32 { return binary.LittleEndian.Uint32(src[i:]) }
+	lit := 0 // start of the bytes not yet encoded
+	for i := 0; i+4 <= len(src); {
+		h := load(i) * 0x1e35a7bd >> (32 - tableBits)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > 0xffff || load(cand) != load(i) {
+			i++
+			continue
+		}
+		dst = snappyLiteral(dst, src[lit:i])
+		n := 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = snappyCopy(dst, i-cand, n)
+		i += n
+		lit = i
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length < 12 && offset < 2048 {
+		return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|1, byte(offset))
+	}
+	return append(dst, byte(length-1)<<2|2, byte(offset), byte(offset>>8))
+}
@@ -0,0 +1,327 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The metadata of a Parquet file is encoded with the Thrift compact
+// protocol. Rather than generate code from parquet.thrift, a struct
+// is decoded into a tstruct, its fields by id, and the metadata
+// types in meta.go pick out the fields they know, so unknown fields
+// are skipped as Thrift requires.
+
+// Types of the compact protocol.
+const (
+	tStop      = 0
+	tTrue      = 1
+	tFalse     = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStruct    = 12
+	maxTDepth  = 64
+	maxTLength = 1 << 28
+)
+
+// A tstruct is a decoded Thrift struct. Its values are bool, int64
+// (for all integer types), float64, []byte, tlist, and tstruct.
+type tstruct map[int16]interface{}
+
+type tlist []interface{}
+
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) bool(id int16) bool {
+	v, _ := s[id].(bool)
+	return v
+}
+
+func (s tstruct) string(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) list(id int16) tlist {
+	v, _ := s[id].(tlist)
+	return v
+}
+
+func (s tstruct) strct(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+var errThrift = errors.New("malformed thrift")
+
+// A tdecoder reads the compact protocol.
+type tdecoder struct {
+	r     io.ByteReader
+	depth int
+}
+
+func newTDecoder(r io.Reader) *tdecoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &tdecoder{r: br}
+}
+
+func (d *tdecoder) uvarint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+func (d *tdecoder) varint() (int64, error) {
+	u, err := d.uvarint()
+	return int64(u>>1) ^ -int64(u&1), err // zigzag
+}
+
+func (d *tdecoder) readStruct() (tstruct, error) {
+	if d.depth++; d.depth > maxTDepth {
+		return nil, errThrift
+	}
+	defer func() { d.depth-- }()
+	s := make(tstruct)
+	var id int16
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		typ := b & 0x0f
+		if typ == tStop {
+			return s, nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := d.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		var v interface{}
+		switch typ {
+		case tTrue:
+			v = true
+		case tFalse:
+			v = false
+		default:
+			if v, err = d.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+		s[id] = v
+	}
+}
+
+func (d *tdecoder) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case tTrue, tFalse: // a bool element of a list
+		b, err := d.r.ReadByte()
+		return b == tTrue, err
+	case tByte:
+		b, err := d.r.ReadByte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		return d.varint()
+	case tDouble:
+		var b [8]byte
+		for i := range b {
+			c, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			b[i] = c
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:])), nil
+	case tBinary:
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > maxTLength {
+			return nil, errThrift
+		}
+		b := make([]byte, n)
+		for i := range b {
+			if b[i], err = d.r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case tList, tSet:
+		h, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(h >> 4)
+		if n == 15 {
+			if n, err = d.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if n > maxTLength {
+			return nil, errThrift
+		}
+		l := make(tlist, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.readValue(h & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case tMap:
+		n, err := d.uvarint()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		if n > maxTLength {
+			return nil, errThrift
+		}
+		h, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < 2*n; i++ { // maps are skipped
+			typ := h >> 4
+			if i%2 == 1 {
+				typ = h & 0x0f
+			}
+			if _, err := d.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case tStruct:
+		return d.readStruct()
+	}
+	return nil, fmt.Errorf("%v: type %d", errThrift, typ)
+}
+
+// A tfield is a field of a struct to encode, in order of id.
+type tfield struct {
+	id  int16
+	val interface{} // bool, int32, int64, []byte, string, []tfield (a struct), or tlist
+}
+
+// A tencoder writes the compact protocol.
+type tencoder struct {
+	buf []byte
+}
+
+func (e *tencoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *tencoder) varint(v int64) {
+	e.uvarint(uint64(v<<1) ^ uint64(v>>63)) // zigzag
+}
+
+func ttype(v interface{}) byte {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return tTrue
+		}
+		return tFalse
+	case int32:
+		return tI32
+	case int64:
+		return tI64
+	case []byte, string:
+		return tBinary
+	case []tfield:
+		return tStruct
+	case tlist:
+		return tList
+	}
+	panic(fmt.Sprintf("parquet: cannot encode %T", v))
+}
+
+func (e *tencoder) writeStruct(fields []tfield) {
+	var last int16
+	for _, f := range fields {
+		typ := ttype(f.val)
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			e.buf = append(e.buf, byte(delta)<<4|typ)
+		} else {
+			e.buf = append(e.buf, typ)
+			e.varint(int64(f.id))
+		}
+		last = f.id
+		if _, isBool := f.val.(bool); !isBool {
+			e.writeValue(f.val)
+		}
+	}
+	e.buf = append(e.buf, tStop)
+}
+
+func (e *tencoder) writeValue(v interface{}) {
+	switch v := v.(type) {
+	case bool: // a bool element of a list
+		if v {
+			e.buf = append(e.buf, tTrue)
+		} else {
+			e.buf = append(e.buf, tFalse)
+		}
+	case int32:
+		e.varint(int64(v))
+	case int64:
+		e.varint(v)
+	case []byte:
+		e.uvarint(uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	case string:
+		e.uvarint(uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	case []tfield:
+		e.writeStruct(v)
+	case tlist:
+		var typ byte = tStruct
+		if len(v) > 0 {
+			typ = ttype(v[0])
+			if typ == tFalse {
+				typ = tTrue
+			}
+		}
+		if len(v) < 15 {
+			e.buf = append(e.buf, byte(len(v))<<4|typ)
+		} else {
+			e.buf = append(e.buf, 0xf0|typ)
+			e.uvarint(uint64(len(v)))
+		}
+		for _, elem := range v {
+			e.writeValue(elem)
+		}
+	default:
+		panic(fmt.Sprintf("parquet: cannot encode %T", v))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	"neugram.io/ng/table"
+)
+
+// DefaultRowGroupSize is the number of rows in a row group written
+// when Options.RowGroupSize is zero.
+const DefaultRowGroupSize = 1 << 17
+
+// A Writer writes tables to a Parquet file. Every table written
+// must have the columns the Writer was made with. The file is not
+// complete until Close.
+type Writer struct {
+	w      io.Writer
+	off    int64
+	cols   []column
+	codec  int64
+	groupN int
+	meta   fileMeta
+	err    error
+}
+
+// elementOf returns the schema element of a column of Go type t.
+func elementOf(name string, t reflect.Type) (schemaElement, error) {
+	el := schemaElement{name: name, repetition: repRequired, converted: -1}
+	switch t.Kind() {
+	case reflect.Bool:
+		el.typ = typeBoolean
+	case reflect.Int8:
+		el.typ, el.converted = typeInt32, convInt8
+	case reflect.Int16:
+		el.typ, el.converted = typeInt32, convInt16
+	case reflect.Int32:
+		el.typ = typeInt32
+	case reflect.Uint8:
+		el.typ, el.converted = typeInt32, convUint8
+	case reflect.Uint16:
+		el.typ, el.converted = typeInt32, convUint16
+	case reflect.Uint32:
+		el.typ, el.converted = typeInt32, convUint32
+	case reflect.Int, reflect.Int64:
+		el.typ = typeInt64
+	case reflect.Uint, reflect.Uint64:
+		el.typ, el.converted = typeInt64, convUint64
+	case reflect.Float32:
+		el.typ = typeFloat
+	case reflect.Float64:
+		el.typ = typeDouble
+	case reflect.String:
+		el.typ, el.converted, el.isString = typeByteArray, convUTF8, true
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return el, fmt.Errorf("parquet: column %q of type %v cannot be written", name, t)
+		}
+		el.typ = typeByteArray
+	default:
+		return el, fmt.Errorf("parquet: column %q of type %v cannot be written", name, t)
+	}
+	return el, nil
+}
+
+// NewWriter returns a Writer of tables with the columns cols to w.
+// Unnamed columns are named c0, c1, and so on, by position.
+func NewWriter(w io.Writer, cols []table.Column, opts Options) (*Writer, error) {
+	codec, err := opts.codec()
+	if err != nil {
+		return nil, err
+	}
+	pw := &Writer{
+		w:      w,
+		codec:  codec,
+		groupN: opts.RowGroupSize,
+		meta:   fileMeta{version: 1, createdBy: "neugram"},
+	}
+	if pw.groupN <= 0 {
+		pw.groupN = DefaultRowGroupSize
+	}
+	pw.meta.schema = append(pw.meta.schema, schemaElement{
+		typ:         -1,
+		name:        "schema",
+		numChildren: int64(len(cols)),
+		converted:   -1,
+	})
+	for i, c := range cols {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("c%d", i)
+		}
+		t := c.Type
+		if t == nil {
+			return nil, fmt.Errorf("parquet: column %q has no type", name)
+		}
+		el, err := elementOf(name, t)
+		if err != nil {
+			return nil, err
+		}
+		pw.cols = append(pw.cols, column{el: el, goType: t})
+		pw.meta.schema = append(pw.meta.schema, el)
+	}
+	pw.write([]byte(magic))
+	return pw, pw.err
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.off += int64(n)
+	w.err = err
+}
+
+// Write writes the rows of t, in row groups of at most
+// Options.RowGroupSize rows.
+func (w *Writer) Write(t *table.Table) error {
+	if w.err != nil {
+		return w.err
+	}
+	cols := t.Columns()
+	if len(cols) != len(w.cols) {
+		return fmt.Errorf("parquet: table has %d columns, want %d", len(cols), len(w.cols))
+	}
+	for i, c := range cols {
+		if c.Type != w.cols[i].goType {
+			return fmt.Errorf("parquet: column %d has type %v, want %v", i, c.Type, w.cols[i].goType)
+		}
+	}
+	for start := 0; start < t.Len(); start += w.groupN {
+		end := start + w.groupN
+		if end > t.Len() {
+			end = t.Len()
+		}
+		w.writeRowGroup(t, start, end)
+	}
+	return w.err
+}
+
+// writeRowGroup writes rows [start, end) of t as a row group, each
+// column chunk one page of plain values.
+func (w *Writer) writeRowGroup(t *table.Table, start, end int) {
+	g := rowGroup{numRows: int64(end - start)}
+	for i := range w.cols {
+		c := &w.cols[i]
+		vals := reflect.ValueOf(t.Column(i)).Slice(start, end)
+		data := encodePlain(nil, vals, c)
+		page := compress(data, w.codec)
+		h := pageHeader{
+			typ:              pageData,
+			uncompressedSize: int64(len(data)),
+			compressedSize:   int64(len(page)),
+			numValues:        int64(end - start),
+			encoding:         encPlain,
+		}
+		e := new(tencoder)
+		e.writeStruct(h.fields())
+		cc := columnChunk{
+			typ:              c.el.typ,
+			path:             []string{c.el.name},
+			codec:            w.codec,
+			numValues:        int64(end - start),
+			compressedSize:   int64(len(e.buf) + len(page)),
+			uncompressedSize: int64(len(e.buf) + len(data)),
+			dataPageOffset:   w.off,
+		}
+		w.write(e.buf)
+		w.write(page)
+		g.columns = append(g.columns, cc)
+	}
+	w.meta.rowGroups = append(w.meta.rowGroups, g)
+	w.meta.numRows += g.numRows
+}
+
+// Close writes the metadata that ends the file. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	e := new(tencoder)
+	e.writeStruct(w.meta.fields())
+	w.write(e.buf)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(e.buf)))
+	w.write(n[:])
+	w.write([]byte(magic))
+	return w.err
+}
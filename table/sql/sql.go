@@ -0,0 +1,289 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sql is the Neugram package sql, which runs queries with
+// database/sql and reads their results as tables:
+//
+//	import "sql"
+//
+//	dsn := "postgres://localhost/shop"
+//	t := sql.Query("postgres", dsn, "select name, price from items where price < $1", 10)
+//	n := sql.Exec("postgres", dsn, "delete from items where price = 0")
+//
+// The driver must be registered with database/sql, usually by
+// importing its package. A database is opened the first time it is
+// used and kept open, so a series of statements share its pool of
+// connections, and an in-memory database lasts between them.
+//
+// A table read has the Neugram type [|]interface{}, with a column
+// for each column of the result. The type of a column is that of
+// its values: int for integers, as in the packages csv and json,
+// float64 for floats (or a mix of integers and floats), bool,
+// time.Time, and string for text.
+// Bytes are a string unless the database type of the column is
+// binary, as BLOB or BYTEA is, when they are []byte. A column of
+// values of other types, or of several types, is interface{}. NULL
+// is read as the zero value of the column's type.
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"neugram.io/ng/eval"
+	"neugram.io/ng/table"
+)
+
+// Package is the Neugram package sql.
+var Package eval.Package = pkg{}
+
+type pkg struct{}
+
+func (pkg) Path() string { return "sql" }
+
+func (pkg) Members() map[string]interface{} {
+	return map[string]interface{}{
+		"Drivers": sql.Drivers,
+		"Exec":    Exec,
+		"Query":   Query,
+	}
+}
+
+func init() {
+	eval.Register(Package)
+}
+
+var (
+	dbsMu sync.Mutex
+	dbs   = make(map[[2]string]*sql.DB) // by driver and dsn
+)
+
+// open returns the database of driver and dsn, opening it the first
+// time.
+func open(driver, dsn string) (*sql.DB, error) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	key := [2]string{driver, dsn}
+	if db := dbs[key]; db != nil {
+		return db, nil
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %v", err)
+	}
+	dbs[key] = db
+	return db, nil
+}
+
+// Query runs query, with the placeholder parameters args, on the
+// database of driver and dsn, and reads the rows of its result.
+func Query(driver, dsn, query string, args ...interface{}) (*table.Table, error) {
+	db, err := open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %v", err)
+	}
+	defer rows.Close()
+	return ReadRows(rows)
+}
+
+// Exec runs the statement query, with the placeholder parameters
+// args, on the database of driver and dsn. It returns the number of
+// rows affected, or -1 if the driver does not report it.
+func Exec(driver, dsn, query string, args ...interface{}) (int, error) {
+	db, err := open(driver, dsn)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("sql: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, nil
+	}
+	return int(n), nil
+}
+
+// ReadRows reads the remaining rows of rows as a table, with the
+// column types described in the package documentation. It does not
+// close rows.
+func ReadRows(rows *sql.Rows) (*table.Table, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("sql: %v", err)
+	}
+	vals := make([][]interface{}, len(types))
+	dst := make([]interface{}, len(types))
+	for rows.Next() {
+		row := make([]interface{}, len(types))
+		for i := range row {
+			dst[i] = &row[i]
+		}
+		if err := rows.Scan(dst...); err != nil {
+			return nil, fmt.Errorf("sql: %v", err)
+		}
+		for i, v := range row {
+			vals[i] = append(vals[i], v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql: %v", err)
+	}
+
+	cols := make([]table.Column, len(types))
+	data := make([]interface{}, len(types))
+	for i, ct := range types {
+		t := columnType(ct, vals[i])
+		cols[i] = table.Column{Name: ct.Name(), Type: t}
+		col := reflect.MakeSlice(reflect.SliceOf(t), len(vals[i]), len(vals[i]))
+		binary := isBinary(ct)
+		for j, v := range vals[i] {
+			if v == nil {
+				continue // NULL
+			}
+			col.Index(j).Set(convert(v, t, binary))
+		}
+		data[i] = col.Interface()
+	}
+	t, err := table.FromColumns(cols, data...)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %v", err)
+	}
+	return t, nil
+}
+
+var (
+	intType       = reflect.TypeOf(0)
+	float64Type   = reflect.TypeOf(float64(0))
+	boolType      = reflect.TypeOf(false)
+	stringType    = reflect.TypeOf("")
+	bytesType     = reflect.TypeOf([]byte(nil))
+	timeType      = reflect.TypeOf(time.Time{})
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// columnType returns the type of the column ct, holding vals.
+func columnType(ct *sql.ColumnType, vals []interface{}) reflect.Type {
+	var t reflect.Type
+	for _, v := range vals {
+		if v == nil {
+			continue
+		}
+		vt := valueType(ct, v)
+		switch {
+		case t == nil || t == vt:
+			t = vt
+		case t == intType && vt == float64Type, t == float64Type && vt == intType:
+			t = float64Type
+		default:
+			return interfaceType
+		}
+	}
+	if t == nil { // no values, or all NULL
+		t = scanType(ct)
+	}
+	return t
+}
+
+// valueType returns the column type of the value v, scanned from a
+// column ct.
+func valueType(ct *sql.ColumnType, v interface{}) reflect.Type {
+	switch v.(type) {
+	case int64:
+		return intType
+	case float64, bool, string, time.Time:
+		return reflect.TypeOf(v)
+	case []byte:
+		if isBinary(ct) {
+			return bytesType
+		}
+		return stringType
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return intType
+	case reflect.Float32:
+		return float64Type
+	}
+	return interfaceType
+}
+
+// scanType returns the column type of ct from the type the driver
+// scans it into, as the type of a column with no values.
+func scanType(ct *sql.ColumnType) reflect.Type {
+	t := ct.ScanType()
+	if t == nil {
+		return interfaceType
+	}
+	switch t {
+	case reflect.TypeOf(sql.NullInt64{}):
+		return intType
+	case reflect.TypeOf(sql.NullFloat64{}):
+		return float64Type
+	case reflect.TypeOf(sql.NullBool{}):
+		return boolType
+	case reflect.TypeOf(sql.NullString{}):
+		return stringType
+	case timeType:
+		return timeType
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return intType
+	case reflect.Float32, reflect.Float64:
+		return float64Type
+	case reflect.Bool:
+		return boolType
+	case reflect.String:
+		return stringType
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if isBinary(ct) {
+				return bytesType
+			}
+			return stringType
+		}
+	}
+	return interfaceType
+}
+
+// isBinary reports whether the database type of ct is binary data.
+func isBinary(ct *sql.ColumnType) bool {
+	name := strings.ToUpper(ct.DatabaseTypeName())
+	for _, b := range []string{"BLOB", "BINARY", "BYTEA", "IMAGE"} {
+		if strings.Contains(name, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// convert converts the value v, scanned from a column of type t, to
+// t. Bytes of a column that is not binary are a string, and
+// integers are int.
+func convert(v interface{}, t reflect.Type, binary bool) reflect.Value {
+	switch x := v.(type) {
+	case []byte:
+		if !binary {
+			v = string(x)
+		}
+	case int64:
+		v = int(x)
+	}
+	if t == interfaceType {
+		return reflect.ValueOf(&v).Elem()
+	}
+	return reflect.ValueOf(v).Convert(t)
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"neugram.io/ng/eval"
+)
+
+// testDriver is a database/sql driver of canned results. A query
+// returns the result of its text, and a statement is recorded.
+type testDriver struct {
+	mu      sync.Mutex
+	opens   int
+	results map[string]*testResult
+	execs   []string
+	args    [][]driver.Value
+}
+
+type testResult struct {
+	cols   []string
+	types  []string // database type names
+	scan   []reflect.Type
+	values [][]driver.Value
+}
+
+var testDB = &testDriver{results: make(map[string]*testResult)}
+
+func init() {
+	sql.Register("ngtest", testDB)
+}
+
+func (d *testDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.opens++
+	return testConn{d}, nil
+}
+
+type testConn struct{ d *testDriver }
+
+func (c testConn) Prepare(query string) (driver.Stmt, error) { return testStmt{c.d, query}, nil }
+func (c testConn) Close() error                              { return nil }
+func (c testConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type testStmt struct {
+	d     *testDriver
+	query string
+}
+
+func (s testStmt) Close() error  { return nil }
+func (s testStmt) NumInput() int { return -1 }
+
+func (s testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.execs = append(s.d.execs, s.query)
+	s.d.args = append(s.d.args, args)
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	res := s.d.results[s.query]
+	if res == nil {
+		return nil, errors.New("no such table")
+	}
+	return &testRows{res: res}, nil
+}
+
+type testRows struct {
+	res *testResult
+	row int
+}
+
+func (r *testRows) Columns() []string { return r.res.cols }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.row == len(r.res.values) {
+		return io.EOF
+	}
+	copy(dest, r.res.values[r.row])
+	r.row++
+	return nil
+}
+
+func (r *testRows) ColumnTypeDatabaseTypeName(i int) string { return r.res.types[i] }
+
+func (r *testRows) ColumnTypeScanType(i int) reflect.Type {
+	if r.res.scan == nil {
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	return r.res.scan[i]
+}
+
+func TestQuery(t *testing.T) {
+	day := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	testDB.results["select *"] = &testResult{
+		cols:  []string{"id", "price", "mixed", "name", "data", "ok", "at", "none", "any"},
+		types: []string{"INT", "REAL", "NUMERIC", "VARCHAR", "BLOB", "BOOL", "TIMESTAMP", "INT", ""},
+		scan: []reflect.Type{
+			reflect.TypeOf(int64(0)),
+			reflect.TypeOf(float64(0)),
+			reflect.TypeOf(float64(0)),
+			reflect.TypeOf(sql.RawBytes(nil)),
+			reflect.TypeOf(sql.RawBytes(nil)),
+			reflect.TypeOf(false),
+			reflect.TypeOf(time.Time{}),
+			reflect.TypeOf(sql.NullInt64{}),
+			reflect.TypeOf((*interface{})(nil)).Elem(),
+		},
+		values: [][]driver.Value{
+			{int64(1), 1.5, int64(2), []byte("ann"), []byte{0, 1}, true, day, nil, "x"},
+			{int64(2), nil, 2.5, nil, []byte{2}, false, nil, nil, int64(3)},
+		},
+	}
+	tbl, err := Query("ngtest", "TestQuery", "select *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tbl.Cols(), testDB.results["select *"].cols; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %q, want %q", got, want)
+	}
+	for x, want := range []interface{}{
+		[]int{1, 2},
+		[]float64{1.5, 0},
+		[]float64{2, 2.5},
+		[]string{"ann", ""},
+		[][]byte{{0, 1}, {2}},
+		[]bool{true, false},
+		[]time.Time{day, {}},
+		[]int{0, 0},
+		[]interface{}{"x", 3},
+	} {
+		if got := tbl.Column(x); !reflect.DeepEqual(got, want) {
+			t.Errorf("column %d = %#v, want %#v", x, got, want)
+		}
+	}
+
+	if _, err := Query("ngtest", "TestQuery", "select nothing"); err == nil {
+		t.Errorf("query of a missing table succeeded")
+	}
+	if _, err := Query("nodriver", "", "select *"); err == nil {
+		t.Errorf("query of an unknown driver succeeded")
+	}
+}
+
+func TestPackage(t *testing.T) {
+	testDB.results["select id, name from t"] = &testResult{
+		cols:   []string{"id", "name"},
+		types:  []string{"INT", "TEXT"},
+		values: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}},
+	}
+	testDB.mu.Lock()
+	opens := testDB.opens
+	testDB.mu.Unlock()
+
+	p := eval.New(eval.Options{})
+	src := `import "sql"
+n := sql.Exec("ngtest", "TestPackage", "insert into t values (?, ?)", 4, "d")
+t := sql.Query("ngtest", "TestPackage", "select id, name from t")
+len(t) * 100 + cols(t) * 10 + n`
+	res, err := p.Eval(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != 322 {
+		t.Errorf("len and cols of the table and rows affected = %#v, want 322", res)
+	}
+
+	testDB.mu.Lock()
+	defer testDB.mu.Unlock()
+	if got, want := testDB.execs[len(testDB.execs)-1], "insert into t values (?, ?)"; got != want {
+		t.Errorf("statement %q, want %q", got, want)
+	}
+	if got, want := testDB.args[len(testDB.args)-1], []driver.Value{int64(4), "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statement args %#v, want %#v", got, want)
+	}
+	if testDB.opens != opens+1 {
+		t.Errorf("%d connections opened, want 1", testDB.opens-opens)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package table implements the tables of Neugram, [|]T: rows of
+// values in columns that may be named and may each have their own
+// type.
+//
+// A Table stores each column as a Go slice of the column's type, so
+// a column is read in full, or found by name, in constant time, and
+// a column of float64 holds no boxed values. Rows are added at the
+// end, as elements are by append.
+//
+// A Table is a frame.Frame, so the frame package copies between it
+// and other frames, such as database tables.
+package table // import "neugram.io/ng/table"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// A Column describes a column of a table.
+type Column struct {
+	Name string // "" if the column has no name
+	Type reflect.Type
+}
+
+// A Table is a table of values. The zero Table has no columns, and
+// a nil *Table is an empty table with no columns.
+type Table struct {
+	cols  []Column
+	data  []reflect.Value // data[i] is a []cols[i].Type, of length n
+	index map[string]int  // columns by name
+	n     int             // rows
+}
+
+var emptyIface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// New returns an empty table with the columns cols. Names of columns
+// must be unique, except for "", and a column with no Type holds
+// values of any type, as an interface{}.
+func New(cols ...Column) (*Table, error) {
+	t := &Table{
+		cols:  append([]Column(nil), cols...),
+		data:  make([]reflect.Value, len(cols)),
+		index: make(map[string]int),
+	}
+	for i, col := range t.cols {
+		if col.Type == nil {
+			t.cols[i].Type = emptyIface
+		}
+		if col.Name != "" {
+			if _, dup := t.index[col.Name]; dup {
+				return nil, fmt.Errorf("table: duplicate column %q", col.Name)
+			}
+			t.index[col.Name] = i
+		}
+		t.data[i] = reflect.MakeSlice(reflect.SliceOf(t.cols[i].Type), 0, 0)
+	}
+	return t, nil
+}
+
+// FromColumns returns a table of the columns cols, with the values
+// of column i in data[i], a slice of its type, such as []float64.
+// The slices must be of the same length. The table takes them as
+// its storage, so they must not be used after.
+func FromColumns(cols []Column, data ...interface{}) (*Table, error) {
+	t, err := New(cols...)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != len(cols) {
+		return nil, fmt.Errorf("table: %d slices of values for %d columns", len(data), len(cols))
+	}
+	for i, d := range data {
+		v := reflect.ValueOf(d)
+		if !v.IsValid() || v.Type() != t.data[i].Type() {
+			return nil, fmt.Errorf("table: values of column %s are a %T, not a %s", t.colName(i), d, t.data[i].Type())
+		}
+		if i > 0 && v.Len() != t.n {
+			return nil, fmt.Errorf("table: column %s has %d values, column 0 has %d", t.colName(i), v.Len(), t.n)
+		}
+		t.data[i] = v
+		t.n = v.Len()
+	}
+	return t, nil
+}
+
+// Len returns the number of rows of t.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return t.n
+}
+
+// NumCols returns the number of columns of t.
+func (t *Table) NumCols() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.cols)
+}
+
+// Columns returns the columns of t.
+func (t *Table) Columns() []Column {
+	if t == nil {
+		return nil
+	}
+	return append([]Column(nil), t.cols...)
+}
+
+// Cols returns the names of the columns of t, "" for those with no
+// name.
+func (t *Table) Cols() []string {
+	if t == nil {
+		return nil
+	}
+	names := make([]string, len(t.cols))
+	for i, col := range t.cols {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// ColumnIndex returns the index of the column named name, or -1.
+func (t *Table) ColumnIndex(name string) int {
+	if t == nil {
+		return -1
+	}
+	if i, ok := t.index[name]; ok {
+		return i
+	}
+	return -1
+}
+
+// Column returns the values of column i, a slice of its type, such
+// as []float64. The slice shares its elements with t until the next
+// row is added.
+func (t *Table) Column(i int) interface{} {
+	return t.data[i].Interface()
+}
+
+// At returns the value in row and column col.
+func (t *Table) At(row, col int) interface{} {
+	t.checkRow(row)
+	return t.data[col].Index(row).Interface()
+}
+
+// Value returns the value in row and column col, as a settable
+// reflect.Value of the column's type.
+func (t *Table) Value(row, col int) reflect.Value {
+	t.checkRow(row)
+	return t.data[col].Index(row)
+}
+
+// SetAt sets the value in row and column col to v.
+func (t *Table) SetAt(row, col int, v interface{}) error {
+	t.checkRow(row)
+	rv, err := t.convert(col, v)
+	if err != nil {
+		return err
+	}
+	t.data[col].Index(row).Set(rv)
+	return nil
+}
+
+// Row returns the values of row i.
+func (t *Table) Row(i int) []interface{} {
+	t.checkRow(i)
+	row := make([]interface{}, len(t.cols))
+	for j := range row {
+		row[j] = t.data[j].Index(i).Interface()
+	}
+	return row
+}
+
+// AppendRow adds a row of the values vals, one for each column, to
+// the end of t.
+func (t *Table) AppendRow(vals ...interface{}) error {
+	if len(vals) != len(t.cols) {
+		return fmt.Errorf("table: row of %d values for %d columns", len(vals), len(t.cols))
+	}
+	row := make([]reflect.Value, len(vals))
+	for i, v := range vals {
+		rv, err := t.convert(i, v)
+		if err != nil {
+			return err
+		}
+		row[i] = rv
+	}
+	for i, rv := range row {
+		t.data[i] = reflect.Append(t.data[i], rv)
+	}
+	t.n++
+	return nil
+}
+
+// Append adds the rows of u to the end of t. The columns of u must
+// have the types of those of t.
+func (t *Table) Append(u *Table) error {
+	if u.NumCols() != len(t.cols) {
+		return fmt.Errorf("table: cannot append a table of %d columns to one of %d", u.NumCols(), len(t.cols))
+	}
+	for i, col := range u.Columns() {
+		if col.Type != t.cols[i].Type {
+			return fmt.Errorf("table: cannot append column %s of type %s to one of %s", t.colName(i), col.Type, t.cols[i].Type)
+		}
+	}
+	for i := range t.data {
+		t.data[i] = reflect.AppendSlice(t.data[i], u.data[i])
+	}
+	t.n += u.Len()
+	return nil
+}
+
+// grow adds rows of zero values until t has n rows.
+func (t *Table) grow(n int) {
+	if n <= t.n {
+		return
+	}
+	for i, col := range t.cols {
+		zeros := reflect.MakeSlice(reflect.SliceOf(col.Type), n-t.n, n-t.n)
+		t.data[i] = reflect.AppendSlice(t.data[i], zeros)
+	}
+	t.n = n
+}
+
+// Copy returns a copy of t, with its own rows.
+func (t *Table) Copy() *Table {
+	if t == nil {
+		return nil
+	}
+	c, _ := New(t.cols...)
+	for i, d := range t.data {
+		c.data[i] = reflect.AppendSlice(c.data[i], d)
+	}
+	c.n = t.n
+	return c
+}
+
+func (t *Table) checkRow(row int) {
+	if row < 0 || row >= t.Len() {
+		panic(fmt.Sprintf("table: row %d out of range [0, %d)", row, t.Len()))
+	}
+}
+
+// convert returns v as a value of the type of column col.
+func (t *Table) convert(col int, v interface{}) (reflect.Value, error) {
+	typ := t.cols[col].Type
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+			return reflect.Zero(typ), nil
+		}
+	} else if rv.Type().AssignableTo(typ) {
+		return rv, nil
+	}
+	return reflect.Value{}, fmt.Errorf("table: cannot use %v (type %T) in column %s of type %s", v, v, t.colName(col), typ)
+}
+
+func (t *Table) colName(col int) string {
+	if name := t.cols[col].Name; name != "" {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprint(col)
+}
+
+// Get implements frame.Frame. It stores the values of row y, from
+// column x on, in the variables dst point to. It returns io.EOF if
+// there is no row y.
+func (t *Table) Get(x, y int, dst ...interface{}) error {
+	if y >= t.Len() {
+		return io.EOF
+	}
+	if x < 0 || x+len(dst) > len(t.cols) {
+		return fmt.Errorf("table: Get of columns [%d, %d) of %d", x, x+len(dst), len(t.cols))
+	}
+	for i, d := range dst {
+		p := reflect.ValueOf(d)
+		if p.Kind() != reflect.Ptr || p.IsNil() {
+			return fmt.Errorf("table: Get destination %T is not a non-nil pointer", d)
+		}
+		v := t.data[x+i].Index(y)
+		if !v.Type().AssignableTo(p.Elem().Type()) {
+			return fmt.Errorf("table: cannot store column %s of type %s in a %s", t.colName(x+i), v.Type(), p.Elem().Type())
+		}
+		p.Elem().Set(v)
+	}
+	return nil
+}
+
+// Set implements frame.Frame. It sets the values of row y, from
+// column x on, to vals, adding rows of zero values if t has no row
+// y.
+func (t *Table) Set(x, y int, vals ...interface{}) error {
+	if x < 0 || y < 0 || x+len(vals) > len(t.cols) {
+		return fmt.Errorf("table: Set of columns [%d, %d) of row %d, with %d columns", x, x+len(vals), y, len(t.cols))
+	}
+	row := make([]reflect.Value, len(vals))
+	for i, v := range vals {
+		rv, err := t.convert(x+i, v)
+		if err != nil {
+			return err
+		}
+		row[i] = rv
+	}
+	t.grow(y + 1)
+	for i, rv := range row {
+		t.data[x+i].Index(y).Set(rv)
+	}
+	return nil
+}
+
+// String formats t as text, with the names of its columns, if any,
+// above its rows, and the columns aligned.
+func (t *Table) String() string {
+	if t == nil {
+		return "[|]"
+	}
+	buf := new(bytes.Buffer)
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	named := false
+	for _, col := range t.cols {
+		named = named || col.Name != ""
+	}
+	if named {
+		for i, col := range t.cols {
+			if i > 0 {
+				io.WriteString(w, "\t")
+			}
+			io.WriteString(w, col.Name)
+		}
+		io.WriteString(w, "\n")
+	}
+	for y := 0; y < t.n; y++ {
+		for x := range t.cols {
+			if x > 0 {
+				io.WriteString(w, "\t")
+			}
+			fmt.Fprint(w, t.data[x].Index(y).Interface())
+		}
+		io.WriteString(w, "\n")
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
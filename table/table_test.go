@@ -0,0 +1,145 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package table
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"neugram.io/ng/frame"
+)
+
+var (
+	stringType  = reflect.TypeOf("")
+	float64Type = reflect.TypeOf(0.0)
+)
+
+func TestTable(t *testing.T) {
+	tbl, err := New(Column{Name: "name", Type: stringType}, Column{Name: "x", Type: float64Type}, Column{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.AppendRow("a", 1.5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.AppendRow("b", 2.0, 7); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Len() != 2 || tbl.NumCols() != 3 {
+		t.Errorf("table is %dx%d, want 2x3", tbl.Len(), tbl.NumCols())
+	}
+	if got := tbl.Column(tbl.ColumnIndex("x")); !reflect.DeepEqual(got, []float64{1.5, 2}) {
+		t.Errorf("column x = %v", got)
+	}
+	if tbl.ColumnIndex("y") != -1 {
+		t.Errorf("found column y")
+	}
+	if got := tbl.Row(1); !reflect.DeepEqual(got, []interface{}{"b", 2.0, 7}) {
+		t.Errorf("row 1 = %v", got)
+	}
+	if err := tbl.SetAt(0, 1, 3.0); err != nil || tbl.At(0, 1) != 3.0 {
+		t.Errorf("SetAt: %v, value %v", err, tbl.At(0, 1))
+	}
+
+	cp := tbl.Copy()
+	tbl.SetAt(0, 0, "z")
+	if cp.At(0, 0) != "a" {
+		t.Errorf("Copy shares rows with the table")
+	}
+
+	for _, row := range [][]interface{}{
+		{"c", 1, nil}, // int in a float64 column
+		{"c", 1.0},    // too few values
+		{1, 1.0, nil},
+	} {
+		if err := tbl.AppendRow(row...); err == nil {
+			t.Errorf("AppendRow(%v) succeeded", row)
+		}
+	}
+	if tbl.Len() != 2 {
+		t.Errorf("failed appends left %d rows", tbl.Len())
+	}
+
+	if _, err := New(Column{Name: "a"}, Column{Name: "a"}); err == nil {
+		t.Errorf("New with a duplicate column succeeded")
+	}
+}
+
+func TestColumns(t *testing.T) {
+	cols := []Column{{Name: "x", Type: float64Type}, {Name: "s", Type: stringType}}
+	tbl, err := FromColumns(cols, []float64{1, 2}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Len() != 2 || tbl.At(1, 1) != "b" {
+		t.Errorf("FromColumns made %v", tbl)
+	}
+	if err := tbl.Append(tbl.Copy()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tbl.Column(0); !reflect.DeepEqual(got, []float64{1, 2, 1, 2}) {
+		t.Errorf("appended column x = %v", got)
+	}
+
+	if _, err := FromColumns(cols, []float64{1}, []string{"a", "b"}); err == nil {
+		t.Errorf("FromColumns of columns of different lengths succeeded")
+	}
+	if _, err := FromColumns(cols, []int{1}, []string{"a"}); err == nil {
+		t.Errorf("FromColumns of []int for a float64 column succeeded")
+	}
+	other, _ := New(Column{Type: stringType}, Column{Type: stringType})
+	if err := tbl.Append(other); err == nil {
+		t.Errorf("Append of a table with other column types succeeded")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var _ frame.Frame = (*Table)(nil)
+
+	tbl, err := New(Column{Name: "name", Type: stringType}, Column{Name: "x", Type: float64Type})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Set(1, 2, 4.5); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Len() != 3 {
+		t.Errorf("Set of row 2 left %d rows, want 3", tbl.Len())
+	}
+	var name string
+	var x float64
+	if err := tbl.Get(0, 2, &name, &x); err != nil || name != "" || x != 4.5 {
+		t.Errorf("Get = %q, %v, %v", name, x, err)
+	}
+	if err := tbl.Get(0, 3, &name); err != io.EOF {
+		t.Errorf("Get past the end: %v, want io.EOF", err)
+	}
+	if err := tbl.Get(0, 0, &x); err == nil {
+		t.Errorf("Get of a string into a float64 succeeded")
+	}
+	if err := tbl.Set(0, 0, 1, 2); err == nil {
+		t.Errorf("Set of an int in a string column succeeded")
+	}
+}
+
+func TestString(t *testing.T) {
+	tbl, _ := New(Column{Name: "name", Type: stringType}, Column{Name: "x", Type: float64Type})
+	tbl.AppendRow("alpha", 1.5)
+	tbl.AppendRow("b", 20.0)
+	want := strings.Join([]string{
+		"name   x",
+		"alpha  1.5",
+		"b      20",
+	}, "\n")
+	if got := tbl.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+	var nilTable *Table
+	if nilTable.Len() != 0 || nilTable.NumCols() != 0 {
+		t.Errorf("nil table is not empty")
+	}
+}
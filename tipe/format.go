@@ -0,0 +1,232 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tipe
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// FormatOptions control how Format writes a type.
+type FormatOptions struct {
+	// Qualified writes named types imported from Go with their
+	// package path, net/http.Request, instead of the package name.
+	Qualified bool
+
+	// Expr formats the length expression of an array whose
+	// length has not been folded by the typechecker. It is given
+	// the Array's LenExpr, an expr.Expr. Package format provides
+	// one; without it such lengths are written as [?].
+	Expr func(e interface{}) string
+}
+
+// TypeString returns t in Neugram syntax, as written in source.
+// (The name String is taken by the basic type.)
+func TypeString(t Type) string {
+	return Format(t, FormatOptions{})
+}
+
+// Format returns t in Neugram syntax. Struct and interface types
+// with members are written over several lines, indented by tabs.
+// Package format, and through it the typechecker's error messages,
+// print types with Format.
+func Format(t Type, opts FormatOptions) string {
+	p := &printer{opts: opts}
+	p.tipe(t)
+	return p.buf.String()
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	opts   FormatOptions
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	for i := 0; i < p.indent; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+func (p *printer) tipe(t Type) {
+	if t == nil {
+		p.buf.WriteString("<nil>")
+		return
+	}
+	switch t := t.(type) {
+	case Basic:
+		p.buf.WriteString(string(t))
+	case Builtin:
+		p.buf.WriteString(string(t))
+	case *Struct:
+		if len(t.Fields) == 0 {
+			p.buf.WriteString("struct{}")
+			return
+		}
+		p.buf.WriteString("struct {")
+		p.indent++
+		maxlen := 0
+		for _, name := range t.FieldNames {
+			if len(name) > maxlen {
+				maxlen = len(name)
+			}
+		}
+		for i, ft := range t.Fields {
+			p.newline()
+			name := "*ERROR*No*Name*"
+			if i < len(t.FieldNames) {
+				name = t.FieldNames[i]
+			}
+			p.buf.WriteString(name)
+			for i := len(name); i <= maxlen; i++ {
+				p.buf.WriteByte(' ')
+			}
+			p.tipe(ft)
+		}
+		p.indent--
+		p.newline()
+		p.buf.WriteByte('}')
+	case *Pointer:
+		p.buf.WriteByte('*')
+		p.tipe(t.Elem)
+	case *Unresolved:
+		if t.Package != "" {
+			p.buf.WriteString(t.Package)
+			p.buf.WriteByte('.')
+		}
+		p.buf.WriteString(t.Name)
+	case *Array:
+		switch {
+		case t.Ellipsis:
+			p.buf.WriteString("[...]")
+		case t.LenExpr != nil && p.opts.Expr != nil:
+			fmt.Fprintf(&p.buf, "[%s]", p.opts.Expr(t.LenExpr))
+		case t.LenExpr != nil:
+			p.buf.WriteString("[?]")
+		default:
+			fmt.Fprintf(&p.buf, "[%d]", t.Len)
+		}
+		p.tipe(t.Elem)
+	case *Slice:
+		p.buf.WriteString("[]")
+		p.tipe(t.Elem)
+	case *Table:
+		p.buf.WriteString("[|")
+		if t.Schema != nil {
+			for i, col := range t.Schema.Columns {
+				if i > 0 {
+					p.buf.WriteString(", ")
+				}
+				fmt.Fprintf(&p.buf, "%q", col.Name)
+				if col.Type != nil {
+					p.buf.WriteByte(' ')
+					p.tipe(col.Type)
+				}
+			}
+			p.buf.WriteByte('|')
+		}
+		p.buf.WriteByte(']')
+		p.tipe(t.Type)
+	case *Tuple:
+		p.buf.WriteByte('(')
+		if t != nil {
+			p.list(t.Elems)
+		}
+		p.buf.WriteByte(')')
+	case *Interface:
+		if len(t.Methods) == 0 {
+			p.buf.WriteString("interface{}")
+			return
+		}
+		p.buf.WriteString("interface {")
+		p.indent++
+		names := make([]string, 0, len(t.Methods))
+		for name := range t.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p.newline()
+			p.buf.WriteString(name)
+			p.funcSig(t.Methods[name])
+		}
+		p.indent--
+		p.newline()
+		p.buf.WriteByte('}')
+	case *Map:
+		p.buf.WriteString("map[")
+		p.tipe(t.Key)
+		p.buf.WriteByte(']')
+		p.tipe(t.Value)
+	case *Chan:
+		if t.Direction == ChanRecv {
+			p.buf.WriteString("<-")
+		}
+		p.buf.WriteString("chan")
+		if t.Direction == ChanSend {
+			p.buf.WriteString("<-")
+		}
+		p.buf.WriteByte(' ')
+		p.tipe(t.Elem)
+	case *Func:
+		p.buf.WriteString("func")
+		p.funcSig(t)
+	case *Alias:
+		p.buf.WriteString(t.Name)
+	case *TypeParam:
+		p.buf.WriteString(t.Name)
+	case *Named:
+		if p.opts.Qualified && t.PkgPath != "" {
+			p.buf.WriteString(t.PkgPath)
+			p.buf.WriteByte('.')
+		} else if t.PkgName != "" {
+			p.buf.WriteString(t.PkgName)
+			p.buf.WriteByte('.')
+		}
+		p.buf.WriteString(t.Name)
+	case *Package:
+		fmt.Fprintf(&p.buf, "package %q", t.Path)
+	default:
+		fmt.Fprintf(&p.buf, "<unknown type %T>", t)
+	}
+}
+
+func (p *printer) list(ts []Type) {
+	for i, t := range ts {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.tipe(t)
+	}
+}
+
+func (p *printer) funcSig(t *Func) {
+	p.buf.WriteByte('(')
+	if t.Params != nil {
+		for i, elem := range t.Params.Elems {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			if s, ok := elem.(*Slice); ok && t.Variadic && i == len(t.Params.Elems)-1 {
+				p.buf.WriteString("...")
+				elem = s.Elem
+			}
+			p.tipe(elem)
+		}
+	}
+	p.buf.WriteByte(')')
+	if t.Results != nil && len(t.Results.Elems) > 0 {
+		p.buf.WriteByte(' ')
+		if len(t.Results.Elems) > 1 {
+			p.buf.WriteByte('(')
+		}
+		p.list(t.Results.Elems)
+		if len(t.Results.Elems) > 1 {
+			p.buf.WriteByte(')')
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tipe
+
+import "testing"
+
+var request = &Named{
+	Name:    "Request",
+	PkgName: "http",
+	PkgPath: "net/http",
+	Type:    &Struct{},
+}
+
+var formatTests = []struct {
+	t    Type
+	want string
+}{
+	{Int64, "int64"},
+	{Byte, "byte"},
+	{&Table{Type: Float64}, "[|]float64"},
+	{
+		&Table{Type: Float64, Schema: &TableSchema{Columns: []Column{{Name: "a"}, {Name: "b", Type: String}}}},
+		`[|"a", "b" string|]float64`,
+	},
+	{&Array{Len: 3, Elem: &Pointer{Elem: String}}, "[3]*string"},
+	{&Array{LenExpr: "n", Elem: Int}, "[?]int"},
+	{&Unresolved{Package: "sync", Name: "Mutex"}, "sync.Mutex"},
+	{&Chan{Direction: ChanRecv, Elem: Bool}, "<-chan bool"},
+	{&Map{Key: String, Value: &Slice{Elem: Int}}, "map[string][]int"},
+	{&Tuple{Elems: []Type{Int, String}}, "(int, string)"},
+	{
+		&Func{
+			Params:   &Tuple{Elems: []Type{String, &Slice{Elem: Int}}},
+			Results:  &Tuple{Elems: []Type{Int, Bool}},
+			Variadic: true,
+		},
+		"func(string, ...int) (int, bool)",
+	},
+	{request, "http.Request"},
+	{
+		&Struct{FieldNames: []string{"A", "Long"}, Fields: []Type{Int, request}},
+		"struct {\n\tA    int\n\tLong http.Request\n}",
+	},
+	{
+		&Interface{Methods: map[string]*Func{
+			"Close": {Params: &Tuple{}, Results: &Tuple{}},
+			"Bind":  {Params: &Tuple{Elems: []Type{Int}}, Results: &Tuple{}},
+		}},
+		"interface {\n\tBind(int)\n\tClose()\n}",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range formatTests {
+		if got := TypeString(test.t); got != test.want {
+			t.Errorf("TypeString(%#v) = %q, want %q", test.t, got, test.want)
+		}
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	opts := FormatOptions{
+		Qualified: true,
+		Expr:      func(e interface{}) string { return e.(string) },
+	}
+	if got, want := Format(&Pointer{Elem: request}, opts), "*net/http.Request"; got != want {
+		t.Errorf("qualified Format = %q, want %q", got, want)
+	}
+	if got, want := Format(&Array{LenExpr: "n+1", Elem: Int}, opts), "[n+1]int"; got != want {
+		t.Errorf("Format with Expr = %q, want %q", got, want)
+	}
+}
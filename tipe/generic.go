@@ -0,0 +1,334 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tipe
+
+import "fmt"
+
+// Instantiate returns the generic type t, a *Func or *Named with
+// TypeParams, with each type parameter replaced by the matching type
+// argument. It is an error for an argument not to have the methods
+// required by its parameter's Constraint.
+func Instantiate(t Type, args []Type) (Type, error) {
+	var tparams []*TypeParam
+	switch t := t.(type) {
+	case *Func:
+		tparams = t.TypeParams
+	case *Named:
+		tparams = t.TypeParams
+	}
+	if len(tparams) == 0 {
+		return nil, fmt.Errorf("cannot instantiate non-generic type %T", t)
+	}
+	if len(args) != len(tparams) {
+		return nil, fmt.Errorf("got %d type arguments, want %d", len(args), len(tparams))
+	}
+	m := NewMemory()
+	sub := make(map[*TypeParam]Type, len(tparams))
+	for i, p := range tparams {
+		if p.Constraint != nil {
+			if name, _ := m.MissingMethod(args[i], p.Constraint); name != "" {
+				return nil, fmt.Errorf("type argument for %s does not satisfy its constraint (missing %s method)", p.Name, name)
+			}
+		}
+		sub[p] = args[i]
+	}
+	return Substitute(t, sub), nil
+}
+
+// Substitute returns t with each type parameter in sub replaced by
+// its mapped type. Parts of t that do not mention any of those
+// parameters are shared with the result, not copied.
+func Substitute(t Type, sub map[*TypeParam]Type) Type {
+	if len(sub) == 0 {
+		return t
+	}
+	s := &substituter{
+		sub:      sub,
+		copies:   make(map[*Named]*Named),
+		visiting: make(map[*Named]bool),
+	}
+	return s.typ(t)
+}
+
+type substituter struct {
+	sub      map[*TypeParam]Type
+	copies   map[*Named]*Named // original -> substituted copy
+	visiting map[*Named]bool   // cycle check for mentions
+}
+
+func (s *substituter) typ(t Type) Type {
+	if t == nil || !s.mentions(t) {
+		return t
+	}
+	switch t := t.(type) {
+	case *TypeParam:
+		return s.sub[t]
+	case *Func:
+		return s.fn(t)
+	case *Struct:
+		return &Struct{
+			Spec:       t.Spec,
+			FieldNames: t.FieldNames,
+			Fields:     s.types(t.Fields),
+		}
+	case *Named:
+		if c := s.copies[t]; c != nil {
+			return c
+		}
+		c := &Named{
+			Spec:             t.Spec,
+			TypeParams:       s.unbound(t.TypeParams),
+			PkgName:          t.PkgName,
+			PkgPath:          t.PkgPath,
+			Name:             t.Name,
+			MethodNames:      t.MethodNames,
+			PointerReceivers: t.PointerReceivers,
+		}
+		s.copies[t] = c // before the methods, which may refer to t
+		c.Type = s.typ(t.Type)
+		for _, m := range t.Methods {
+			c.Methods = append(c.Methods, s.fn(m))
+		}
+		return c
+	case *Array:
+		return &Array{Len: t.Len, Elem: s.typ(t.Elem)}
+	case *Slice:
+		return &Slice{Elem: s.typ(t.Elem)}
+	case *Table:
+		return &Table{Type: s.typ(t.Type), Schema: s.schema(t.Schema)}
+	case *Tuple:
+		return s.tuple(t)
+	case *Pointer:
+		return &Pointer{Elem: s.typ(t.Elem)}
+	case *Chan:
+		return &Chan{Direction: t.Direction, Elem: s.typ(t.Elem)}
+	case *Map:
+		return &Map{Key: s.typ(t.Key), Value: s.typ(t.Value)}
+	case *Interface:
+		methods := make(map[string]*Func, len(t.Methods))
+		for name, m := range t.Methods {
+			methods[name] = s.fn(m)
+		}
+		return &Interface{Methods: methods}
+	case *Alias:
+		return s.typ(t.Type)
+	}
+	return t
+}
+
+func (s *substituter) schema(schema *TableSchema) *TableSchema {
+	if schema == nil {
+		return nil
+	}
+	res := &TableSchema{Columns: make([]Column, len(schema.Columns))}
+	for i, col := range schema.Columns {
+		res.Columns[i] = Column{Name: col.Name, Type: s.typ(col.Type)}
+	}
+	return res
+}
+
+func (s *substituter) fn(t *Func) *Func {
+	if t == nil || !s.mentions(t) {
+		return t
+	}
+	return &Func{
+		Spec:       t.Spec,
+		TypeParams: s.unbound(t.TypeParams),
+		Params:     s.tuple(t.Params),
+		Results:    s.tuple(t.Results),
+		Variadic:   t.Variadic,
+		FreeVars:   t.FreeVars,
+		FreeMdik:   t.FreeMdik,
+	}
+}
+
+func (s *substituter) tuple(t *Tuple) *Tuple {
+	if t == nil {
+		return nil
+	}
+	return &Tuple{Elems: s.types(t.Elems)}
+}
+
+func (s *substituter) types(ts []Type) []Type {
+	if ts == nil {
+		return nil
+	}
+	res := make([]Type, len(ts))
+	for i, t := range ts {
+		res[i] = s.typ(t)
+	}
+	return res
+}
+
+// unbound returns the type parameters in tparams that are not
+// being substituted, which remain parameters of the result.
+func (s *substituter) unbound(tparams []*TypeParam) []*TypeParam {
+	var res []*TypeParam
+	for _, p := range tparams {
+		if _, ok := s.sub[p]; !ok {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// mentions reports whether t refers to any of the type parameters
+// being substituted.
+func (s *substituter) mentions(t Type) bool {
+	switch t := t.(type) {
+	case *TypeParam:
+		_, ok := s.sub[t]
+		return ok
+	case *Func:
+		return t != nil && (s.mentions(t.Params) || s.mentions(t.Results))
+	case *Struct:
+		return s.mentionsAny(t.Fields)
+	case *Named:
+		if s.visiting[t] {
+			return false
+		}
+		s.visiting[t] = true
+		defer delete(s.visiting, t)
+		if s.mentions(t.Type) {
+			return true
+		}
+		for _, m := range t.Methods {
+			if s.mentions(m) {
+				return true
+			}
+		}
+		return false
+	case *Array:
+		return s.mentions(t.Elem)
+	case *Slice:
+		return s.mentions(t.Elem)
+	case *Table:
+		if t.Schema != nil {
+			for _, col := range t.Schema.Columns {
+				if col.Type != nil && s.mentions(col.Type) {
+					return true
+				}
+			}
+		}
+		return s.mentions(t.Type)
+	case *Tuple:
+		return t != nil && s.mentionsAny(t.Elems)
+	case *Pointer:
+		return s.mentions(t.Elem)
+	case *Chan:
+		return s.mentions(t.Elem)
+	case *Map:
+		return s.mentions(t.Key) || s.mentions(t.Value)
+	case *Interface:
+		for _, m := range t.Methods {
+			if s.mentions(m) {
+				return true
+			}
+		}
+	case *Alias:
+		return s.mentions(t.Type)
+	}
+	return false
+}
+
+func (s *substituter) mentionsAny(ts []Type) bool {
+	for _, t := range ts {
+		if s.mentions(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unify matches the type x, which may mention the type parameters
+// tparams, against the type y. It records in sub the type each
+// parameter must be for x to be identical to y, and reports whether
+// that is possible. Parameters already in sub must match exactly.
+//
+// Unify is how type arguments are inferred from the types of the
+// arguments of a call to a generic function.
+func Unify(tparams []*TypeParam, x, y Type, sub map[*TypeParam]Type) bool {
+	x, y = Unalias(x), Unalias(y)
+	if p, ok := x.(*TypeParam); ok && isParam(tparams, p) {
+		if bound := sub[p]; bound != nil {
+			return Equal(bound, y)
+		}
+		sub[p] = y
+		return true
+	}
+	switch x := x.(type) {
+	case *Func:
+		y, ok := y.(*Func)
+		if !ok || x == nil || y == nil || x.Variadic != y.Variadic {
+			return false
+		}
+		return Unify(tparams, x.Params, y.Params, sub) &&
+			Unify(tparams, x.Results, y.Results, sub)
+	case *Struct:
+		y, ok := y.(*Struct)
+		if !ok || len(x.Fields) != len(y.Fields) {
+			return false
+		}
+		for i := range x.Fields {
+			if x.FieldNames[i] != y.FieldNames[i] || !Unify(tparams, x.Fields[i], y.Fields[i], sub) {
+				return false
+			}
+		}
+		return true
+	case *Array:
+		y, ok := y.(*Array)
+		return ok && x.Len == y.Len && Unify(tparams, x.Elem, y.Elem, sub)
+	case *Slice:
+		y, ok := y.(*Slice)
+		return ok && Unify(tparams, x.Elem, y.Elem, sub)
+	case *Table:
+		y, ok := y.(*Table)
+		return ok && Unify(tparams, x.Type, y.Type, sub)
+	case *Tuple:
+		y, ok := y.(*Tuple)
+		if !ok || x == nil || y == nil {
+			return ok && x == nil && y == nil
+		}
+		if len(x.Elems) != len(y.Elems) {
+			return false
+		}
+		for i := range x.Elems {
+			if !Unify(tparams, x.Elems[i], y.Elems[i], sub) {
+				return false
+			}
+		}
+		return true
+	case *Pointer:
+		y, ok := y.(*Pointer)
+		return ok && Unify(tparams, x.Elem, y.Elem, sub)
+	case *Chan:
+		y, ok := y.(*Chan)
+		return ok && x.Direction == y.Direction && Unify(tparams, x.Elem, y.Elem, sub)
+	case *Map:
+		y, ok := y.(*Map)
+		return ok && Unify(tparams, x.Key, y.Key, sub) && Unify(tparams, x.Value, y.Value, sub)
+	case *Interface:
+		y, ok := y.(*Interface)
+		if !ok || len(x.Methods) != len(y.Methods) {
+			return false
+		}
+		for name, m := range x.Methods {
+			if !Unify(tparams, m, y.Methods[name], sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return Equal(x, y)
+}
+
+func isParam(tparams []*TypeParam, p *TypeParam) bool {
+	for _, tp := range tparams {
+		if tp == p {
+			return true
+		}
+	}
+	return false
+}
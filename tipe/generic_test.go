@@ -0,0 +1,151 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tipe
+
+import "testing"
+
+func TestInstantiate(t *testing.T) {
+	T := &TypeParam{Name: "T"}
+	// func[T](x []T, f func(T) T) []T
+	mapFn := &Func{
+		TypeParams: []*TypeParam{T},
+		Params: &Tuple{Elems: []Type{
+			&Slice{Elem: T},
+			&Func{
+				Params:  &Tuple{Elems: []Type{T}},
+				Results: &Tuple{Elems: []Type{T}},
+			},
+		}},
+		Results: &Tuple{Elems: []Type{&Slice{Elem: T}}},
+	}
+	got, err := Instantiate(mapFn, []Type{Int64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Func{
+		Params: &Tuple{Elems: []Type{
+			&Slice{Elem: Int64},
+			&Func{
+				Params:  &Tuple{Elems: []Type{Int64}},
+				Results: &Tuple{Elems: []Type{Int64}},
+			},
+		}},
+		Results: &Tuple{Elems: []Type{&Slice{Elem: Int64}}},
+	}
+	if !Equal(got, want) {
+		t.Errorf("Instantiate(map, int64) = %#v, want %#v", got, want)
+	}
+	if len(got.(*Func).TypeParams) != 0 {
+		t.Errorf("instantiated func still has type parameters")
+	}
+	if !Equal(mapFn.Params.Elems[0], &Slice{Elem: T}) {
+		t.Errorf("Instantiate modified the generic func")
+	}
+
+	if _, err := Instantiate(mapFn, []Type{Int64, String}); err == nil {
+		t.Errorf("Instantiate with two type arguments succeeded")
+	}
+	if _, err := Instantiate(want, []Type{Int64}); err == nil {
+		t.Errorf("Instantiate of non-generic func succeeded")
+	}
+}
+
+func TestInstantiateConstraint(t *testing.T) {
+	stringer := &Interface{Methods: map[string]*Func{
+		"String": {Params: &Tuple{}, Results: &Tuple{Elems: []Type{String}}},
+	}}
+	T := &TypeParam{Name: "T", Constraint: stringer}
+	fn := &Func{
+		TypeParams: []*TypeParam{T},
+		Params:     &Tuple{Elems: []Type{T}},
+		Results:    &Tuple{Elems: []Type{String}},
+	}
+	if _, err := Instantiate(fn, []Type{Int}); err == nil {
+		t.Errorf("Instantiate with int satisfied a String method constraint")
+	}
+	named := &Named{
+		Name:        "name",
+		Type:        String,
+		MethodNames: []string{"String"},
+		Methods:     []*Func{stringer.Methods["String"]},
+	}
+	if _, err := Instantiate(fn, []Type{named}); err != nil {
+		t.Errorf("Instantiate with a Stringer: %v", err)
+	}
+}
+
+func TestSubstituteNamed(t *testing.T) {
+	T := &TypeParam{Name: "T"}
+	// methodik list[T] struct{ Val T; Next *list } { func (l) Get() T }
+	list := &Named{
+		Name:        "list",
+		TypeParams:  []*TypeParam{T},
+		MethodNames: []string{"Get"},
+		Methods:     []*Func{{Params: &Tuple{}, Results: &Tuple{Elems: []Type{T}}}},
+	}
+	list.Type = &Struct{
+		FieldNames: []string{"Val", "Next"},
+		Fields:     []Type{T, &Pointer{Elem: list}},
+	}
+
+	got, err := Instantiate(list, []Type{String})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := got.(*Named)
+	if inst == list {
+		t.Fatal("Instantiate returned the generic named type")
+	}
+	st := inst.Type.(*Struct)
+	if st.Fields[0] != String {
+		t.Errorf("Val field is %v, want string", st.Fields[0])
+	}
+	if next := st.Fields[1].(*Pointer).Elem; next != inst {
+		t.Errorf("Next field points to %p, want the instance %p", next, inst)
+	}
+	if res := inst.Methods[0].Results.Elems[0]; res != String {
+		t.Errorf("Get returns %v, want string", res)
+	}
+
+	// Types that do not mention T are shared.
+	other := &Slice{Elem: Int}
+	if Substitute(other, map[*TypeParam]Type{T: String}) != other {
+		t.Errorf("Substitute copied a type without type parameters")
+	}
+}
+
+func TestUnify(t *testing.T) {
+	K, V := &TypeParam{Name: "K"}, &TypeParam{Name: "V"}
+	tparams := []*TypeParam{K, V}
+	x := &Func{
+		Params:  &Tuple{Elems: []Type{&Map{Key: K, Value: V}, K}},
+		Results: &Tuple{Elems: []Type{V}},
+	}
+
+	sub := make(map[*TypeParam]Type)
+	y := &Func{
+		Params:  &Tuple{Elems: []Type{&Map{Key: String, Value: Float64}, String}},
+		Results: &Tuple{Elems: []Type{Float64}},
+	}
+	if !Unify(tparams, x, y, sub) {
+		t.Fatal("Unify failed")
+	}
+	if sub[K] != String || sub[V] != Float64 {
+		t.Errorf("Unify gave K=%v, V=%v, want string, float64", sub[K], sub[V])
+	}
+
+	sub = make(map[*TypeParam]Type)
+	y = &Func{
+		Params:  &Tuple{Elems: []Type{&Map{Key: String, Value: Float64}, Int}},
+		Results: &Tuple{Elems: []Type{Float64}},
+	}
+	if Unify(tparams, x, y, sub) {
+		t.Errorf("Unify matched K to both string and int")
+	}
+
+	if Unify(tparams, &Slice{Elem: K}, &Array{Len: 2, Elem: Int}, map[*TypeParam]Type{}) {
+		t.Errorf("Unify matched a slice to an array")
+	}
+}
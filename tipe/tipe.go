@@ -11,34 +11,54 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+
+	"neugram.io/ng/token"
 )
 
 type Type interface {
 	tipe()
 }
 
+// Span is the source range of a type written in a program. It is
+// embedded in the types the parser builds; types made by the
+// typechecker have none.
+type Span struct {
+	From token.Pos
+	To   token.Pos
+}
+
+func (s Span) Pos() token.Pos { return s.From }
+func (s Span) End() token.Pos { return s.To }
+
 type Func struct {
-	Spec     Specialization
-	Params   *Tuple
-	Results  *Tuple
-	Variadic bool // last value of Params is a slice
-	FreeVars []string
-	FreeMdik []*Methodik
+	Span
+	Spec       Specialization
+	TypeParams []*TypeParam // generic function, see Instantiate
+	Params     *Tuple
+	Results    *Tuple
+	Variadic   bool // last value of Params is a slice
+	FreeVars   []string
+	FreeMdik   []*Named
 }
 
 type Struct struct {
+	Span
 	Spec       Specialization
 	FieldNames []string
 	Fields     []Type
 }
 
-// TODO rename to Named
-type Methodik struct {
+// Named is a defined type: a new type with the same underlying
+// Type, distinct from all others. It is declared in Neugram by
+// type Meters float64, or by methodik, which also attaches methods.
+// Named types imported from Go have a PkgPath.
+type Named struct {
 	// TODO: need to track the definition package so the evaluator can
 	// extract the mscope from the right place. Is this the only
 	// instance of needing the source package? What about debug printing?
-	Spec Specialization
-	Type Type
+	Spec       Specialization
+	TypeParams []*TypeParam // generic type, see Instantiate
+	Type       Type
 
 	PkgName string
 	PkgPath string
@@ -46,27 +66,104 @@ type Methodik struct {
 
 	MethodNames []string
 	Methods     []*Func
+
+	// PointerReceivers reports, for each method, whether it is
+	// declared on a pointer receiver. Such methods are only in
+	// the method set of a pointer to the Named type.
+	PointerReceivers []bool
+}
+
+// PointerReceiver reports whether method i has a pointer receiver.
+func (t *Named) PointerReceiver(i int) bool {
+	return i < len(t.PointerReceivers) && t.PointerReceivers[i]
 }
 
 type Array struct {
+	Span
 	Len      int64
 	Elem     Type
 	Ellipsis bool // array was defined as [...]T
+
+	// LenExpr is the length as written when it is not an integer
+	// literal, an expr.Expr. The typechecker folds it into Len.
+	LenExpr interface{}
 }
 
 type Slice struct {
+	Span
 	Elem Type
 }
 
+// Table is a table of values of Type, written [|]T.
+//
+// A table type may name its columns, [|"a", "b"|]T. A table with
+// a Schema is assignable to a table type whose columns it has, so
+// a function can ask for the columns it uses and accept any table
+// that has them.
 type Table struct {
-	Type Type
+	Span
+	Type   Type
+	Schema *TableSchema // nil if the columns are not known
+}
+
+// TableSchema describes the columns of a table.
+type TableSchema struct {
+	Columns []Column
+}
+
+// Column is a column of a table.
+type Column struct {
+	Name string
+	Type Type // type of the column's values, nil for the table's Type
+}
+
+// Column returns the column named name, or nil.
+func (s *TableSchema) Column(name string) *Column {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+// ColumnType returns the type of the values in column col of a
+// table of t.
+func (t *Table) ColumnType(col *Column) Type {
+	if col.Type != nil {
+		return col.Type
+	}
+	return t.Type
+}
+
+// MissingColumn returns the first column of the schema of dst that
+// a table of type src lacks, or has with a different type. A table
+// of src can be assigned to dst if its values are of the same type
+// and MissingColumn returns nil.
+func MissingColumn(dst, src *Table) *Column {
+	if dst.Schema == nil {
+		return nil
+	}
+	for i := range dst.Schema.Columns {
+		want := &dst.Schema.Columns[i]
+		have := src.Schema.Column(want.Name)
+		if have == nil || !Equal(dst.ColumnType(want), src.ColumnType(have)) {
+			return want
+		}
+	}
+	return nil
 }
 
 type Tuple struct {
+	Span
 	Elems []Type
 }
 
 type Pointer struct {
+	Span
 	Elem Type
 }
 
@@ -79,11 +176,14 @@ const (
 )
 
 type Chan struct {
+	Span
 	Direction ChanDirection
 	Elem      Type
 }
 
+// Map is a map type. As in Go, the Key type must be Comparable.
 type Map struct {
+	Span
 	Key   Type
 	Value Type
 }
@@ -95,6 +195,7 @@ type Package struct {
 }
 
 type Interface struct {
+	Span
 	Methods map[string]*Func
 }
 
@@ -110,7 +211,7 @@ var (
 
 // Specialization carries any type specialization data particular to this type.
 //
-// *Func, *Struct, *Methodik can be parameterized over the name num, which can
+// *Func, *Struct, *Named can be parameterized over the name num, which can
 // take any of:
 //
 //	integer, int64, float, float32, float64, complex, complex128
@@ -167,30 +268,46 @@ const (
 type Builtin string
 
 const (
-	Append  Builtin = "builtin append"
-	Cap     Builtin = "builtin cap"
-	Close   Builtin = "builtin close"
-	Copy    Builtin = "builtin copy"
-	Delete  Builtin = "builtin delete"
-	Len     Builtin = "builtin len"
-	Make    Builtin = "builtin make"
-	New     Builtin = "builtin new"
-	Panic   Builtin = "builtin panic"
-	Recover Builtin = "builtin recover"
-	// TODO Real Complex, Imaginary, Print
+	Append      Builtin = "builtin append"
+	Cap         Builtin = "builtin cap"
+	Close       Builtin = "builtin close"
+	Cols        Builtin = "builtin cols"
+	ComplexFunc Builtin = "builtin complex"
+	Copy        Builtin = "builtin copy"
+	Delete      Builtin = "builtin delete"
+	Imag        Builtin = "builtin imag"
+	Len         Builtin = "builtin len"
+	Make        Builtin = "builtin make"
+	New         Builtin = "builtin new"
+	Panic       Builtin = "builtin panic"
+	Print       Builtin = "builtin print"
+	Printf      Builtin = "builtin printf"
+	Println     Builtin = "builtin println"
+	Real        Builtin = "builtin real"
+	Recover     Builtin = "builtin recover"
 )
 
 type Unresolved struct {
+	Span
 	Package string
 	Name    string
 }
 
+// TypeParam is a type parameter of a generic *Func or *Named.
+//
+// A TypeParam is identified by its address, not its name: parameters
+// of the same name declared in two places are different types.
+type TypeParam struct {
+	Name       string
+	Constraint *Interface // methods a type argument must have, nil for any
+}
+
 var (
 	_ = Type(Basic(""))
 	_ = Type(Builtin(""))
 	_ = Type((*Func)(nil))
 	_ = Type((*Struct)(nil))
-	_ = Type((*Methodik)(nil))
+	_ = Type((*Named)(nil))
 	_ = Type((*Array)(nil))
 	_ = Type((*Slice)(nil))
 	_ = Type((*Table)(nil))
@@ -202,13 +319,14 @@ var (
 	_ = Type((*Interface)(nil))
 	_ = Type((*Alias)(nil))
 	_ = Type((*Unresolved)(nil))
+	_ = Type((*TypeParam)(nil))
 )
 
 func (t Basic) tipe()       {}
 func (t Builtin) tipe()     {}
 func (t *Func) tipe()       {}
 func (t *Struct) tipe()     {}
-func (t *Methodik) tipe()   {}
+func (t *Named) tipe()      {}
 func (t *Array) tipe()      {}
 func (t *Slice) tipe()      {}
 func (t *Table) tipe()      {}
@@ -220,6 +338,7 @@ func (t *Package) tipe()    {}
 func (t *Interface) tipe()  {}
 func (t *Alias) tipe()      {}
 func (t *Unresolved) tipe() {}
+func (t *TypeParam) tipe()  {}
 
 func IsNumeric(t Type) bool {
 	t = Unalias(t)
@@ -230,7 +349,7 @@ func IsNumeric(t Type) bool {
 	switch b {
 	case Num, Integer, Float, Complex,
 		Int, Int8, Int16, Int32, Int64,
-		Uint8, Uint16, Uint32, Uint64,
+		Uint, Uint8, Uint16, Uint32, Uint64, Uintptr,
 		Float32, Float64, Complex64, Complex128,
 		UntypedInteger, UntypedFloat, UntypedComplex:
 		return true
@@ -239,47 +358,67 @@ func IsNumeric(t Type) bool {
 }
 
 func UsesNum(t Type) bool {
+	return usesNum(t, nil)
+}
+
+// usesNum reports whether t uses num. The defined types in seen
+// are being checked, and are skipped to end recursion.
+func usesNum(t Type, seen map[*Named]bool) bool {
 	t = Unalias(t)
 	switch t := t.(type) {
 	case *Func:
 		if t.Params != nil {
 			for _, t := range t.Params.Elems {
-				if UsesNum(t) {
+				if usesNum(t, seen) {
 					return true
 				}
 			}
 		}
 		if t.Results != nil {
 			for _, t := range t.Results.Elems {
-				if UsesNum(t) {
+				if usesNum(t, seen) {
 					return true
 				}
 			}
 		}
 	case *Struct:
 		for _, t := range t.Fields {
-			if UsesNum(t) {
+			if usesNum(t, seen) {
 				return true
 			}
 		}
-	case *Methodik:
+	case *Named:
+		if seen[t] {
+			return false
+		}
+		if seen == nil {
+			seen = make(map[*Named]bool)
+		}
+		seen[t] = true
 		for _, t := range t.Methods {
-			if UsesNum(t) {
+			if usesNum(t, seen) {
 				return true
 			}
 		}
 	case *Array:
-		if UsesNum(t.Elem) {
+		if usesNum(t.Elem, seen) {
 			return true
 		}
 	case *Slice:
-		if UsesNum(t.Elem) {
+		if usesNum(t.Elem, seen) {
 			return true
 		}
 	case *Table:
-		if UsesNum(t.Type) {
+		if usesNum(t.Type, seen) {
 			return true
 		}
+		if t.Schema != nil {
+			for _, col := range t.Schema.Columns {
+				if col.Type != nil && usesNum(col.Type, seen) {
+					return true
+				}
+			}
+		}
 	case Basic:
 		return t == Num
 	case Builtin:
@@ -288,6 +427,28 @@ func UsesNum(t Type) bool {
 	return false
 }
 
+// Comparable reports whether values of type t can be compared
+// with == and !=, and so whether t can be the key of a map.
+func Comparable(t Type) bool {
+	switch t := Underlying(t).(type) {
+	case Basic:
+		return t != Invalid && t != UntypedNil
+	case *Chan, *Interface, *Pointer:
+		return true
+	case *Struct:
+		for _, f := range t.Fields {
+			if !Comparable(f) {
+				return false
+			}
+		}
+		return true
+	case *Array:
+		return Comparable(t.Elem)
+	default:
+		return false
+	}
+}
+
 func Unalias(t Type) Type {
 	for {
 		if u, ok := t.(*Alias); ok {
@@ -299,7 +460,18 @@ func Unalias(t Type) Type {
 	return t
 }
 
+// Equal reports whether x and y are the same type.
 func Equal(x, y Type) bool {
+	return equal(x, y, nil)
+}
+
+// namedPair is a pair of defined types being compared by equal.
+type namedPair struct{ x, y *Named }
+
+// equal reports whether x and y are the same type, assuming the
+// pairs of defined types in seen are. The assumption ends the
+// comparison of recursive types, like T in struct{ Next *T }.
+func equal(x, y Type, seen map[namedPair]bool) bool {
 	x, y = Unalias(x), Unalias(y)
 	if x == y {
 		return true
@@ -325,13 +497,13 @@ func Equal(x, y Type) bool {
 		if x == nil || y == nil {
 			return false
 		}
-		if x.Spec != y.Spec {
+		if x.Spec != y.Spec || x.Variadic != y.Variadic {
 			return false
 		}
-		if !Equal(x.Params, y.Params) {
+		if !equal(x.Params, y.Params, seen) {
 			return false
 		}
-		if !Equal(x.Results, y.Results) {
+		if !equal(x.Results, y.Results, seen) {
 			return false
 		}
 		return true
@@ -353,23 +525,31 @@ func Equal(x, y Type) bool {
 			return false
 		}
 		for i := range x.Fields {
-			if !Equal(x.Fields[i], y.Fields[i]) {
+			if !equal(x.Fields[i], y.Fields[i], seen) {
 				return false
 			}
 		}
 		return true
-	case *Methodik:
-		y, ok := y.(*Methodik)
+	case *Named:
+		y, ok := y.(*Named)
 		if !ok {
 			return false
 		}
 		if x == nil || y == nil {
 			return false
 		}
-		if x.Spec != y.Spec {
+		if x.Spec != y.Spec || x.Name != y.Name || x.PkgPath != y.PkgPath {
 			return false
 		}
-		if !Equal(x.Type, y.Type) {
+		pair := namedPair{x, y}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = make(map[namedPair]bool)
+		}
+		seen[pair] = true
+		if !equal(x.Type, y.Type, seen) {
 			return false
 		}
 		if !reflect.DeepEqual(x.MethodNames, y.MethodNames) {
@@ -379,7 +559,7 @@ func Equal(x, y Type) bool {
 			return false
 		}
 		for i := range x.Methods {
-			if !Equal(x.Methods[i], y.Methods[i]) {
+			if !equal(x.Methods[i], y.Methods[i], seen) {
 				return false
 			}
 		}
@@ -395,7 +575,7 @@ func Equal(x, y Type) bool {
 		if x.Len != y.Len {
 			return false
 		}
-		return Equal(x.Elem, y.Elem)
+		return equal(x.Elem, y.Elem, seen)
 	case *Slice:
 		y, ok := y.(*Slice)
 		if !ok {
@@ -404,7 +584,7 @@ func Equal(x, y Type) bool {
 		if x == nil || y == nil {
 			return false
 		}
-		return Equal(x.Elem, y.Elem)
+		return equal(x.Elem, y.Elem, seen)
 	case *Table:
 		y, ok := y.(*Table)
 		if !ok {
@@ -413,23 +593,40 @@ func Equal(x, y Type) bool {
 		if x == nil || y == nil {
 			return false
 		}
-		return Equal(x.Type, y.Type)
+		if !equal(x.Type, y.Type, seen) || (x.Schema == nil) != (y.Schema == nil) {
+			return false
+		}
+		if x.Schema == nil {
+			return true
+		}
+		if len(x.Schema.Columns) != len(y.Schema.Columns) {
+			return false
+		}
+		for i, xc := range x.Schema.Columns {
+			yc := y.Schema.Columns[i]
+			if xc.Name != yc.Name || !equal(x.ColumnType(&xc), y.ColumnType(&yc), seen) {
+				return false
+			}
+		}
+		return true
 	case *Tuple:
 		y, ok := y.(*Tuple)
 		if !ok {
 			return false
 		}
-		if x == nil && y == nil {
-			return true
+		// A nil tuple, as in the Params of a func(), is empty.
+		var xElems, yElems []Type
+		if x != nil {
+			xElems = x.Elems
 		}
-		if x == nil || y == nil {
-			return false
+		if y != nil {
+			yElems = y.Elems
 		}
-		if len(x.Elems) != len(y.Elems) {
+		if len(xElems) != len(yElems) {
 			return false
 		}
-		for i := range x.Elems {
-			if !Equal(x.Elems[i], y.Elems[i]) {
+		for i := range xElems {
+			if !equal(xElems[i], yElems[i], seen) {
 				return false
 			}
 		}
@@ -453,7 +650,7 @@ func Equal(x, y Type) bool {
 			if !ok {
 				return false
 			}
-			if !Equal(xt, yt) {
+			if !equal(xt, yt, seen) {
 				return false
 			}
 		}
@@ -477,7 +674,7 @@ func Equal(x, y Type) bool {
 			if !ok {
 				return false
 			}
-			if !Equal(xt, yt) {
+			if !equal(xt, yt, seen) {
 				return false
 			}
 		}
@@ -490,7 +687,7 @@ func Equal(x, y Type) bool {
 		if x == nil || y == nil {
 			return false
 		}
-		return Equal(x.Elem, y.Elem)
+		return equal(x.Elem, y.Elem, seen)
 	case *Chan:
 		y, ok := y.(*Chan)
 		if !ok {
@@ -502,7 +699,7 @@ func Equal(x, y Type) bool {
 		if x.Direction != y.Direction {
 			return false
 		}
-		return Equal(x.Elem, y.Elem)
+		return equal(x.Elem, y.Elem, seen)
 	case *Map:
 		y, ok := y.(*Map)
 		if !ok {
@@ -511,25 +708,19 @@ func Equal(x, y Type) bool {
 		if x == nil || y == nil {
 			return false
 		}
-		if !Equal(x.Key, y.Key) {
+		if !equal(x.Key, y.Key, seen) {
 			return false
 		}
-		return Equal(x.Value, y.Value)
+		return equal(x.Value, y.Value, seen)
+	case *TypeParam:
+		return false // only equal to itself
 	}
 	fmt.Printf("tipe.Equal TODO %T\n", x)
 	return false
 }
 
 func (t Interface) String() string {
-	if len(t.Methods) == 0 {
-		return "interface{}"
-	}
-	s := "interface{"
-	for name, _ := range t.Methods {
-		s += "\t" + name + "(TODO)"
-	}
-	s += "\n}"
-	return s
+	return TypeString(&t)
 }
 
 func Underlying(t Type) Type {
@@ -539,7 +730,7 @@ func Underlying(t Type) Type {
 	switch t := t.(type) {
 	case *Alias:
 		return Underlying(t.Type)
-	case *Methodik:
+	case *Named:
 		return Underlying(t.Type)
 	default:
 		return t
@@ -591,10 +782,39 @@ func (m *Memory) Method(t Type, name string) *Func {
 	return nil
 }
 
+// Implements reports whether the method set of t includes every
+// method of iface.
+func (m *Memory) Implements(t Type, iface *Interface) bool {
+	name, _ := m.MissingMethod(t, iface)
+	return name == ""
+}
+
+// MissingMethod returns the name of a method of iface that is not in
+// the method set of t, or "" if t implements iface. If t has a method
+// of that name with a different signature, it is returned as have.
+//
+// Methods are considered in name order, so the result is stable.
+func (m *Memory) MissingMethod(t Type, iface *Interface) (name string, have *Func) {
+	var want []string
+	for name := range iface.Methods {
+		want = append(want, name)
+	}
+	sort.Strings(want)
+	for _, name := range want {
+		f := m.Method(t, name)
+		if f == nil {
+			return name, nil
+		}
+		if !Equal(f, iface.Methods[name]) {
+			return name, f
+		}
+	}
+	return "", nil
+}
+
 func methods(t Type, methodset map[string]Type, pointersRemoved int) {
 	t = Unalias(t)
 	switch t := t.(type) {
-	// TODO case *Named:
 	case *Pointer:
 		if pointersRemoved < 1 {
 			methods(t.Elem, methodset, pointersRemoved+1)
@@ -606,11 +826,18 @@ func methods(t Type, methodset map[string]Type, pointersRemoved int) {
 			}
 			methodset[name] = typ
 		}
-	case *Methodik:
+	case *TypeParam:
+		if t.Constraint != nil {
+			methods(t.Constraint, methodset, pointersRemoved)
+		}
+	case *Named:
 		for i, name := range t.MethodNames {
 			if methodset[name] != nil {
 				continue
 			}
+			if t.PointerReceiver(i) && pointersRemoved == 0 {
+				continue
+			}
 			methodset[name] = t.Methods[i]
 		}
 		methods(t.Type, methodset, pointersRemoved)
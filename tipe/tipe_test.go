@@ -0,0 +1,63 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tipe
+
+import "testing"
+
+func table(elem Type, cols ...Column) *Table {
+	return &Table{Type: elem, Schema: &TableSchema{Columns: cols}}
+}
+
+func TestMissingColumn(t *testing.T) {
+	ab := table(Float64, Column{Name: "a"}, Column{Name: "b", Type: String})
+	tests := []struct {
+		dst     *Table
+		missing string
+	}{
+		{&Table{Type: Float64}, ""},
+		{table(Float64), ""},
+		{table(Float64, Column{Name: "a"}), ""},
+		{table(Float64, Column{Name: "b", Type: String}, Column{Name: "a", Type: Float64}), ""},
+		{table(Float64, Column{Name: "c"}), "c"},
+		{table(Float64, Column{Name: "b"}), "b"},
+	}
+	for _, test := range tests {
+		col := MissingColumn(test.dst, ab)
+		got := ""
+		if col != nil {
+			got = col.Name
+		}
+		if got != test.missing {
+			t.Errorf("MissingColumn(%s, %s) = %q, want %q", TypeString(test.dst), TypeString(ab), got, test.missing)
+		}
+	}
+	if col := MissingColumn(table(Float64, Column{Name: "a"}), &Table{Type: Float64}); col == nil {
+		t.Errorf("table without columns has column a")
+	}
+}
+
+func TestEqualTable(t *testing.T) {
+	x := table(Int, Column{Name: "a"}, Column{Name: "b"})
+	if !Equal(x, table(Int, Column{Name: "a", Type: Int}, Column{Name: "b"})) {
+		t.Errorf("column of the table's type is not equal to an untyped column")
+	}
+	if Equal(x, table(Int, Column{Name: "b"}, Column{Name: "a"})) {
+		t.Errorf("tables with columns in a different order are equal")
+	}
+	if Equal(x, &Table{Type: Int}) {
+		t.Errorf("table with columns equals table without")
+	}
+}
+
+func TestEqualFuncNoParams(t *testing.T) {
+	x := &Func{Results: &Tuple{Elems: []Type{String}}}
+	y := &Func{Params: &Tuple{}, Results: &Tuple{Elems: []Type{String}}}
+	if !Equal(x, y) {
+		t.Errorf("func with nil params is not equal to func with empty params")
+	}
+	if Equal(x, &Func{Params: &Tuple{Elems: []Type{Int}}, Results: x.Results}) {
+		t.Errorf("func() string equals func(int) string")
+	}
+}
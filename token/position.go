@@ -0,0 +1,205 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package token
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Position is a resolved location in Neugram source code.
+// The zero Position is not valid.
+type Position struct {
+	Filename string // may be empty
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // byte offset in the line, starting at 1
+}
+
+// IsValid reports whether p refers to a location in source code.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String returns p in one of the forms
+//
+//	file:line:column
+//	line:column
+//	file
+//	-
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Pos is a compact encoding of a source position within a FileSet.
+// It can be converted to a Position with FileSet.Position.
+//
+// Each File in a FileSet owns a disjoint range of Pos values, so
+// Pos values from different files (or different REPL sessions
+// sharing a FileSet) can be compared and stored without ambiguity.
+type Pos int
+
+// NoPos is the zero Pos. It is not associated with any file.
+const NoPos Pos = 0
+
+// IsValid reports whether p is a position in some file.
+func (p Pos) IsValid() bool { return p != NoPos }
+
+// File is a source file, or a chunk of one, registered in a FileSet.
+type File struct {
+	name   string
+	base   int
+	size   int
+	offset int // byte offset of the chunk in the file
+	line   int // line number of the first line of the chunk
+
+	mu    sync.Mutex
+	lines []int // offset of the first character of each line
+}
+
+// Name returns the file name f was registered with.
+func (f *File) Name() string { return f.name }
+
+// Base returns the Pos value of the first byte of f.
+func (f *File) Base() int { return f.base }
+
+// Size returns the size of f in bytes.
+func (f *File) Size() int { return f.size }
+
+// AddLine records the offset of the first character of a new line.
+// Offsets must be added in increasing order and lie within f.
+func (f *File) AddLine(offset int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n := len(f.lines); f.lines[n-1] < offset && offset <= f.size {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// Pos returns the Pos value for the byte offset in f.
+func (f *File) Pos(offset int) Pos {
+	if offset < 0 || offset > f.size {
+		panic(fmt.Sprintf("token: offset %d out of range for file %s", offset, f.name))
+	}
+	return Pos(f.base + offset)
+}
+
+// Offset returns the byte offset in f of p.
+func (f *File) Offset(p Pos) int {
+	if int(p) < f.base || int(p) > f.base+f.size {
+		panic(fmt.Sprintf("token: pos %d out of range for file %s", p, f.name))
+	}
+	return int(p) - f.base
+}
+
+// Position resolves p, which must belong to f.
+func (f *File) Position(p Pos) Position {
+	if !p.IsValid() {
+		return Position{}
+	}
+	offset := f.Offset(p)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+	return Position{
+		Filename: f.name,
+		Offset:   f.offset + offset,
+		Line:     f.line + i,
+		Column:   offset - f.lines[i] + 1,
+	}
+}
+
+// A FileSet is a registry of source files. Pos values are only
+// meaningful relative to the FileSet that produced them.
+type FileSet struct {
+	mu    sync.RWMutex
+	base  int
+	files []*File // sorted by base
+}
+
+// NewFileSet returns an empty FileSet.
+func NewFileSet() *FileSet {
+	return &FileSet{base: 1} // 0 is NoPos
+}
+
+// Base returns the smallest base that can be passed to AddFile.
+func (s *FileSet) Base() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.base
+}
+
+// AddFile registers a new file of the given size. A negative base
+// means s.Base(). Line offsets are recorded with AddLine.
+func (s *FileSet) AddFile(filename string, base, size int) *File {
+	return s.addFile(filename, base, 0, 1, size)
+}
+
+// AddChunk registers size bytes of filename starting at the given
+// byte offset and line of the file. Source read incrementally, such
+// as REPL input, is added a chunk at a time so the chunks of several
+// files can interleave in s. A chunk must start at the beginning of
+// a line.
+func (s *FileSet) AddChunk(filename string, offset, line, size int) *File {
+	return s.addFile(filename, -1, offset, line, size)
+}
+
+func (s *FileSet) addFile(filename string, base, offset, line, size int) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if base < 0 {
+		base = s.base
+	}
+	if base < s.base || size < 0 {
+		panic(fmt.Sprintf("token: invalid base %d or size %d for file %s", base, size, filename))
+	}
+	f := &File{
+		name:   filename,
+		base:   base,
+		size:   size,
+		offset: offset,
+		line:   line,
+		lines:  []int{0},
+	}
+	s.base = base + size + 1 // +1 so a file's end position is unique
+	s.files = append(s.files, f)
+	return f
+}
+
+// File returns the file containing p, or nil.
+func (s *FileSet) File(p Pos) *File {
+	if !p.IsValid() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(p) }) - 1
+	if i < 0 {
+		return nil
+	}
+	f := s.files[i]
+	if int(p) > f.base+f.size {
+		return nil
+	}
+	return f
+}
+
+// Position resolves p. It returns the zero Position if p is not
+// a position in any file of s.
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.Position(p)
+	}
+	return Position{}
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package token
+
+import "testing"
+
+func TestFileSet(t *testing.T) {
+	fset := NewFileSet()
+
+	// A REPL session adds a line at a time, interleaved with an
+	// imported file.
+	repl1 := fset.AddChunk("repl", 0, 1, len("x := 1\n"))
+	lib := fset.AddFile("lib.ng", -1, len("a\nbc\n"))
+	lib.AddLine(2)
+	repl2 := fset.AddChunk("repl", len("x := 1\n"), 2, len("y := x\n"))
+
+	tests := []struct {
+		pos  Pos
+		want string
+	}{
+		{NoPos, "-"},
+		{repl1.Pos(0), "repl:1:1"},
+		{repl1.Pos(5), "repl:1:6"},
+		{lib.Pos(0), "lib.ng:1:1"},
+		{lib.Pos(3), "lib.ng:2:2"},
+		{repl2.Pos(0), "repl:2:1"},
+		{repl2.Pos(5), "repl:2:6"},
+		{Pos(fset.Base() + 10), "-"},
+	}
+	for _, test := range tests {
+		if got := fset.Position(test.pos).String(); got != test.want {
+			t.Errorf("Position(%d)=%s, want %s", test.pos, got, test.want)
+		}
+	}
+
+	if got, want := fset.Position(repl2.Pos(5)).Offset, len("x := 1\ny := "); got != want {
+		t.Errorf("repl offset=%d, want %d", got, want)
+	}
+}
+
+func TestFileSetSerialize(t *testing.T) {
+	fset := NewFileSet()
+	f := fset.AddFile("a.ng", -1, len("x\ny\n"))
+	f.AddLine(2)
+	repl := fset.AddChunk("repl", 10, 3, len("z := 1\n"))
+
+	var saved interface{}
+	if err := fset.Write(func(x interface{}) error { saved = x; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	fset2 := NewFileSet()
+	err := fset2.Read(func(x interface{}) error {
+		*x.(*serializedFileSet) = saved.(serializedFileSet)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fset2.Base(), fset.Base(); got != want {
+		t.Errorf("Base()=%d, want %d", got, want)
+	}
+	for _, p := range []Pos{f.Pos(0), f.Pos(3), repl.Pos(2)} {
+		if got, want := fset2.Position(p), fset.Position(p); got != want {
+			t.Errorf("Position(%d)=%v, want %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package token
+
+type serializedFile struct {
+	// fields correspond 1:1 to fields with same (lower-case) name in File
+	Name   string
+	Base   int
+	Size   int
+	Offset int
+	Line   int
+	Lines  []int
+}
+
+type serializedFileSet struct {
+	Base  int
+	Files []serializedFile
+}
+
+// Read calls decode to deserialize a file set into s; s must not be nil.
+func (s *FileSet) Read(decode func(interface{}) error) error {
+	var ss serializedFileSet
+	if err := decode(&ss); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.base = ss.Base
+	files := make([]*File, len(ss.Files))
+	for i, f := range ss.Files {
+		files[i] = &File{
+			name:   f.Name,
+			base:   f.Base,
+			size:   f.Size,
+			offset: f.Offset,
+			line:   f.Line,
+			lines:  f.Lines,
+		}
+	}
+	s.files = files
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Write calls encode to serialize the file set s.
+func (s *FileSet) Write(encode func(interface{}) error) error {
+	var ss serializedFileSet
+
+	s.mu.RLock()
+	ss.Base = s.base
+	files := make([]serializedFile, len(s.files))
+	for i, f := range s.files {
+		f.mu.Lock()
+		files[i] = serializedFile{
+			Name:   f.name,
+			Base:   f.base,
+			Size:   f.size,
+			Offset: f.offset,
+			Line:   f.line,
+			Lines:  append([]int(nil), f.lines...),
+		}
+		f.mu.Unlock()
+	}
+	ss.Files = files
+	s.mu.RUnlock()
+
+	return encode(ss)
+}
@@ -13,6 +13,7 @@ type Token int
 const (
 	Unknown Token = iota
 	Comment
+	Illegal // a character that begins no token
 
 	// Constants
 
@@ -30,8 +31,11 @@ const (
 	Mul          // *
 	Div          // /
 	Rem          // %
-	Pow          // ^
+	Pow          // **
 	Ref          // &
+	Xor          // ^
+	AndNot       // &^
+	ShiftLeft    // <<
 	LogicalAnd   // &&
 	LogicalOr    // ||
 	Equal        // ==
@@ -60,9 +64,16 @@ const (
 	MulAssign // *=
 	DivAssign // /=
 	RemAssign // %=
-	PowAssign // ^=
+	PowAssign // **=
 	Define    // :=
 
+	AndAssign        // &=
+	OrAssign         // |=
+	XorAssign        // ^=
+	AndNotAssign     // &^=
+	ShiftLeftAssign  // <<=
+	ShiftRightAssign // >>=
+
 	LeftParen    // (
 	LeftBracket  // [
 	LeftBrace    // {
@@ -71,7 +82,8 @@ const (
 	RightBrace   // }
 	Comma        // ,
 	Period       // .
-	Semicolon    // ;
+	Ellipsis     // ...
+	Semicolon    // ; or a newline that ends a statement
 	Colon        // :
 	Pipe         // |
 
@@ -84,11 +96,13 @@ const (
 	Return
 
 	Switch
+	Select
 	Case
 	Default
 	Fallthrough
 
 	Const
+	Var
 
 	If
 	Else
@@ -100,6 +114,7 @@ const (
 	Goto
 
 	Go
+	Defer
 
 	Chan
 	Map
@@ -109,9 +124,17 @@ const (
 	Type
 )
 
+// Binary operators spelled the same as other tokens.
+const (
+	And        = Ref        // &
+	Or         = Pipe       // |
+	ShiftRight = TwoGreater // >>
+)
+
 var tokens = map[string]Token{
 	"unknown":      Unknown,
 	"comment":      Comment,
+	"illegal":      Illegal,
 	"ident":        Ident,
 	"integer":      Int,
 	"float":        Float,
@@ -123,8 +146,11 @@ var tokens = map[string]Token{
 	"*":            Mul,
 	"/":            Div,
 	"%":            Rem,
-	"^":            Pow,
+	"**":           Pow,
 	"&":            Ref,
+	"^":            Xor,
+	"&^":           AndNot,
+	"<<":           ShiftLeft,
 	"&&":           LogicalAnd,
 	"||":           LogicalOr,
 	"==":           Equal,
@@ -137,7 +163,7 @@ var tokens = map[string]Token{
 	">=":           GreaterEqual,
 	"$$":           Shell,
 	"shellword":    ShellWord,
-	"|":            ShellPipe,
+	"shellpipe":    ShellPipe,
 	"shellnewline": ShellNewline,
 	">&":           GreaterAnd,
 	"&>":           AndGreater,
@@ -152,6 +178,14 @@ var tokens = map[string]Token{
 	"RemAssign":    RemAssign,
 	"PowAssign":    PowAssign,
 	"Define":       Define,
+
+	"AndAssign":        AndAssign,
+	"OrAssign":         OrAssign,
+	"XorAssign":        XorAssign,
+	"AndNotAssign":     AndNotAssign,
+	"ShiftLeftAssign":  ShiftLeftAssign,
+	"ShiftRightAssign": ShiftRightAssign,
+
 	"LeftParen":    LeftParen,
 	"LeftBracket":  LeftBracket,
 	"LeftBrace":    LeftBrace,
@@ -160,9 +194,10 @@ var tokens = map[string]Token{
 	"RightBrace":   RightBrace,
 	"Comma":        Comma,
 	"Period":       Period,
+	"...":          Ellipsis,
 	"Semicolon":    Semicolon,
 	"Colon":        Colon,
-	"Pipe":         Pipe,
+	"|":            Pipe,
 }
 
 var Keywords = map[string]Token{
@@ -171,10 +206,12 @@ var Keywords = map[string]Token{
 	"func":        Func,
 	"return":      Return,
 	"switch":      Switch,
+	"select":      Select,
 	"case":        Case,
 	"default":     Default,
 	"fallthrough": Fallthrough,
 	"const":       Const,
+	"var":         Var,
 	"if":          If,
 	"else":        Else,
 	"for":         For,
@@ -183,6 +220,7 @@ var Keywords = map[string]Token{
 	"break":       Break,
 	"goto":        Goto,
 	"go":          Go,
+	"defer":       Defer,
 	"chan":        Chan,
 	"map":         Map,
 	"struct":      Struct,
@@ -206,6 +244,15 @@ func init() {
 	}
 }
 
+// Lookup returns the token whose String is s.
+func Lookup(s string) (t Token, ok bool) {
+	if t, ok = tokens[s]; ok {
+		return t, true
+	}
+	t, ok = Keywords[s]
+	return t, ok
+}
+
 func (t Token) String() string {
 	if s := tokenStrings[t]; s != "" {
 		return s
@@ -221,10 +268,12 @@ func (t Token) Precedence() int {
 		return 2
 	case Equal, NotEqual, Less, LessEqual, Greater, GreaterEqual:
 		return 3
-	case Add, Sub:
+	case Add, Sub, Or, Xor:
 		return 4
-	case Mul, Div, Rem, Pow:
+	case Mul, Div, Rem, And, AndNot, ShiftLeft, ShiftRight:
 		return 5
+	case Pow:
+		return 6
 	}
 	return 0
 }
@@ -26,31 +26,13 @@ var universeObjs = map[string]*Obj{
 	"true":  &Obj{Kind: ObjConst, Type: tipe.UntypedBool, Decl: constant.MakeBool(true)},
 	"false": &Obj{Kind: ObjConst, Type: tipe.UntypedBool, Decl: constant.MakeBool(false)},
 	"nil":   &Obj{Kind: ObjVar, Type: tipe.UntypedNil},
+	"iota":  &Obj{Kind: ObjConst, Type: tipe.UntypedInteger},
 	"env":   &Obj{Kind: ObjVar, Type: &tipe.Map{Key: tipe.String, Value: tipe.String}},
 	"alias": &Obj{Kind: ObjVar, Type: &tipe.Map{Key: tipe.String, Value: tipe.String}},
 	"error": &Obj{
 		Kind: ObjType,
 		Type: errorType,
 	},
-	"print": &Obj{
-		Kind: ObjVar,
-		Type: &tipe.Func{
-			Params: &tipe.Tuple{Elems: []tipe.Type{
-				&tipe.Slice{Elem: &tipe.Interface{}},
-			}},
-			Variadic: true,
-		},
-	},
-	"printf": &Obj{
-		Kind: ObjVar,
-		Type: &tipe.Func{
-			Params: &tipe.Tuple{Elems: []tipe.Type{
-				tipe.String,
-				&tipe.Slice{Elem: &tipe.Interface{}},
-			}},
-			Variadic: true,
-		},
-	},
 	"errorf": &Obj{
 		Kind: ObjVar,
 		Type: &tipe.Func{
@@ -65,12 +47,19 @@ var universeObjs = map[string]*Obj{
 	"append":  &Obj{Kind: ObjVar, Type: tipe.Append},
 	"cap":     &Obj{Kind: ObjVar, Type: tipe.Cap},
 	"close":   &Obj{Kind: ObjVar, Type: tipe.Close},
+	"cols":    &Obj{Kind: ObjVar, Type: tipe.Cols},
+	"complex": &Obj{Kind: ObjVar, Type: tipe.ComplexFunc},
 	"copy":    &Obj{Kind: ObjVar, Type: tipe.Copy},
 	"delete":  &Obj{Kind: ObjVar, Type: tipe.Delete},
+	"imag":    &Obj{Kind: ObjVar, Type: tipe.Imag},
 	"len":     &Obj{Kind: ObjVar, Type: tipe.Len},
 	"make":    &Obj{Kind: ObjVar, Type: tipe.Make},
 	"new":     &Obj{Kind: ObjVar, Type: tipe.New},
 	"panic":   &Obj{Kind: ObjVar, Type: tipe.Panic},
+	"print":   &Obj{Kind: ObjVar, Type: tipe.Print},
+	"printf":  &Obj{Kind: ObjVar, Type: tipe.Printf},
+	"println": &Obj{Kind: ObjVar, Type: tipe.Println},
+	"real":    &Obj{Kind: ObjVar, Type: tipe.Real},
 	"recover": &Obj{Kind: ObjVar, Type: tipe.Recover},
 }
 
@@ -79,7 +68,7 @@ func init() {
 		tipe.Bool,
 		tipe.Integer,
 		tipe.Float,
-		tipe.Complex,
+		// tipe.Complex is not declared, "complex" is the builtin.
 		tipe.String,
 		tipe.Int,
 		tipe.Int8,
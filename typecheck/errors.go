@@ -0,0 +1,97 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package typecheck
+
+import (
+	"fmt"
+
+	"neugram.io/ng/token"
+)
+
+// An Error is a typechecking error. The types it mentions are
+// formatted into Msg.
+type Error struct {
+	Pos  token.Position // position of the expression or statement at fault
+	Code Code
+	Msg  string
+}
+
+func (e Error) Error() string {
+	if !e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Code, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Pos, e.Code, e.Msg)
+}
+
+// A Code classifies an Error. Codes are stable: the number of a
+// code does not change when the wording of its messages does, so
+// tools can match on it.
+type Code int
+
+func (c Code) String() string {
+	return fmt.Sprintf("NG%04d", int(c))
+}
+
+const (
+	Unsupported Code = 1 // valid code the checker cannot yet handle
+
+	// Names and declarations.
+	Redeclared     Code = 101 // name declared twice in a block
+	UndeclaredName Code = 102 // use of an undeclared identifier
+	NotAType       Code = 103 // value used where a type is required
+	UndefinedPkg   Code = 104 // unknown package or package member
+	InvalidLabel   Code = 105 // branch to a missing or unsuitable label
+	NoNewVar       Code = 106 // := declares nothing new
+	InvalidBlank   Code = 107 // _ used as a value
+	InvalidIota    Code = 108 // iota outside a constant declaration
+	InvalidCycle   Code = 109 // type that contains itself
+
+	// Assignments.
+	AssignMismatch Code = 201 // wrong number of values
+	Unassignable   Code = 202 // value cannot be assigned to a type
+	NoValue        Code = 203 // expression has no value or type
+	ReadOnlyVar    Code = 204 // assignment to a read-only variable
+	NotAssignable  Code = 205 // assignment to a value that is not a variable
+
+	// Operators and conversions.
+	MismatchedTypes   Code = 301 // operands of different types
+	UndefinedOp       Code = 302 // operator not defined on a type
+	InvalidConversion Code = 303 // type conversion not allowed
+	DivByZero         Code = 304 // constant division by zero
+	InvalidShiftCount Code = 305 // negative or oversized shift count
+	InvalidMapKey     Code = 306 // map key type is not comparable
+	Unaddressable     Code = 307 // & of an unaddressable operand
+
+	// Constants.
+	NotConstant   Code = 401 // constant declared with a non-constant value
+	ConstOverflow Code = 402 // constant not representable in its type
+
+	// Calls and builtins.
+	WrongArgCount   Code = 501 // too few or too many arguments
+	InvalidArgument Code = 502 // argument of the wrong type
+	NotAFunction    Code = 503 // call of a non-function
+
+	// Composite values.
+	InvalidIndex         Code = 601 // index out of range
+	InvalidSlice         Code = 602 // slice or table slice of an unsliceable value
+	InvalidCompLit       Code = 603 // malformed composite literal
+	MissingFieldOrMethod Code = 604 // selector names no field or method
+	NotAnExpr            Code = 605 // type used where a value is required
+	InvalidArrayLen      Code = 606 // array length not a non-negative integer constant
+	InvalidTableSchema   Code = 607 // malformed or mismatched table columns
+
+	// Interfaces and methods.
+	ImpossibleAssert Code = 701 // type assertion that can never succeed
+	NonInterface     Code = 702 // type assertion on a non-interface
+	PointerMethod    Code = 703 // pointer method called on a value
+
+	// Statements.
+	InvalidChanOp     Code = 801 // send, receive, or close misuse
+	InvalidSwitchCase Code = 802 // case that does not match the switch
+	InvalidDefer      Code = 803 // defer outside a function
+
+	// Imports.
+	ImportFailed Code = 901 // package could not be imported
+)
@@ -0,0 +1,22 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !js
+
+package typecheck
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// installGo installs the Go package path, so the '.a' file the type
+// checker imports it from is fresh.
+func installGo(path string) error {
+	out, err := exec.Command("go", "install", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("go install %s: %v\n%s", path, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2017 The Neugram Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js
+
+package typecheck
+
+import "fmt"
+
+// installGo reports an error, as there is no go command on js. A
+// program only imports the Go packages it is given.
+func installGo(path string) error {
+	return fmt.Errorf("cannot import Go package %s on js", path)
+}
@@ -8,13 +8,17 @@ package typecheck
 import (
 	"bufio"
 	"fmt"
+	"go/ast"
+	"go/build"
 	"go/constant"
 	goimporter "go/importer"
+	goparser "go/parser"
 	gotoken "go/token"
 	gotypes "go/types"
+	"math"
 	"math/big"
+	"math/cmplx"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"unicode"
@@ -24,31 +28,44 @@ import (
 	"neugram.io/ng/format"
 	"neugram.io/ng/parser"
 	"neugram.io/ng/stmt"
+	"neugram.io/ng/syntax"
+	"neugram.io/ng/syntax/goast"
+	"neugram.io/ng/syntax/walk"
 	"neugram.io/ng/tipe"
 	"neugram.io/ng/token"
 )
 
 type Checker struct {
 	ImportGo func(path string) (*gotypes.Package, error)
+	Fset     *token.FileSet // resolves the positions of checked statements
 
 	// TODO: we could put these on our AST. Should we?
 	Types         map[expr.Expr]tipe.Type
 	Defs          map[*expr.Ident]*Obj
 	Values        map[expr.Expr]constant.Value
 	NgPkgs        map[string]*tipe.Package // abs file path -> pkg
+	GoSrcPkgs     map[string]*syntax.File  // abs dir -> Go package converted to Neugram
 	GoPkgs        map[string]*tipe.Package // path -> pkg
 	GoTypes       map[gotypes.Type]tipe.Type
 	GoTypesToFill map[gotypes.Type]tipe.Type
 	// TODO: GoEquiv is tricky and deserving of docs. Particular type instance is associated with a Go type. That means EqualType(t1, t2)==true but t1 could have GoEquiv and t2 not.
 	GoEquiv map[tipe.Type]gotypes.Type
 	NumSpec map[expr.Expr]tipe.Basic // *tipe.Call, *tipe.CompLiteral -> numeric basic type
-	Errs    []error
+	Errs    []Error
 
 	importWalk []string // in-process pkgs, used to detect cycles
 
+	goSrcScopes map[*tipe.Package]*Scope // declarations of Go source packages
+
 	cur *Scope
+	pos token.Pos // position of the statement being checked
+
+	labels []*stmt.Labeled // enclosing labeled statements
+	iota   constant.Value  // value of iota in a const declaration, or nil
+	funcs  int             // number of enclosing function literals
 
-	memory *tipe.Memory
+	memory    *tipe.Memory
+	resolving map[*tipe.Named]bool // cycle check for resolve
 }
 
 func New(initPkg string) *Checker {
@@ -57,10 +74,13 @@ func New(initPkg string) *Checker {
 	}
 	return &Checker{
 		ImportGo:      goimporter.Default().Import,
+		Fset:          token.NewFileSet(),
 		Types:         make(map[expr.Expr]tipe.Type),
 		Defs:          make(map[*expr.Ident]*Obj),
 		Values:        make(map[expr.Expr]constant.Value),
 		NgPkgs:        make(map[string]*tipe.Package),
+		GoSrcPkgs:     make(map[string]*syntax.File),
+		goSrcScopes:   make(map[*tipe.Package]*Scope),
 		GoPkgs:        make(map[string]*tipe.Package),
 		GoTypes:       make(map[gotypes.Type]tipe.Type),
 		GoTypesToFill: make(map[gotypes.Type]tipe.Type),
@@ -71,6 +91,7 @@ func New(initPkg string) *Checker {
 		},
 		importWalk: []string{initPkg},
 		memory:     tipe.NewMemory(),
+		resolving:  make(map[*tipe.Named]bool),
 	}
 }
 
@@ -88,6 +109,7 @@ const (
 	modeVoid
 	modeConst
 	modeVar
+	modeValue // a value that is not a variable, as s[i] of a string
 	modeBuiltin
 	modeTypeExpr
 	modeFunc
@@ -105,6 +127,9 @@ func IsError(t tipe.Type) bool {
 }
 
 func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
+	defer func(pos token.Pos) { c.pos = pos }(c.pos)
+	c.pos = s.Pos()
+
 	switch s := s.(type) {
 	case *stmt.Assign:
 		var partials []partial
@@ -113,9 +138,16 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 			if p.mode == modeInvalid {
 				return nil
 			}
+			if len(s.Left) == 2 && len(s.Right) == 1 {
+				if t := c.commaOk(rhs, p.typ); t != nil {
+					// v, ok := m[k]
+					c.Types[rhs] = t
+					p.typ = t
+				}
+			}
 			if tuple, isTuple := p.typ.(*tipe.Tuple); isTuple {
 				if len(s.Right) > 1 {
-					c.errorf("multiple value %s in single-value context", rhs)
+					c.errorf(rhs, AssignMismatch, "multiple value %s in single-value context", rhs)
 					return nil
 				}
 				for _, t := range tuple.Elems {
@@ -138,19 +170,37 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		}
 
 		if len(s.Left) != len(partials) {
-			c.errorf("arity mismatch, left %d != right %d", len(s.Left), len(partials))
+			c.errorf(nil, AssignMismatch, "arity mismatch, left %d != right %d", len(s.Left), len(partials))
 			return nil
 		}
 
 		if s.Decl {
+			if !c.topLevel() && !c.newVars(s.Left) {
+				c.errorf(nil, NoNewVar, "no new variables on left side of :=")
+				return nil
+			}
 			for i, lhs := range s.Left {
 				p := partials[i]
-				if isUntyped(p.typ) {
-					c.constrainUntyped(&p, defaultType(p.typ))
+				name := lhs.(*expr.Ident).Name
+				for _, prev := range s.Left[:i] {
+					if name != "_" && prev.(*expr.Ident).Name == name {
+						c.errorf(lhs, NoNewVar, "%s repeated on left side of :=", name)
+						return nil
+					}
+				}
+				if old := c.cur.Objs[name]; old != nil && !c.topLevel() {
+					// x, y := f() assigns to an x
+					// declared in the same block.
+					c.Defs[lhs.(*expr.Ident)] = old
+					c.assign(&p, old.Type)
+					continue
 				}
-				if lhs.(*expr.Ident).Name == "_" {
+				if !c.declType(&p, s.Right, i) {
+					return nil
+				}
+				if name == "_" {
 					if len(s.Left) == 1 {
-						c.errorf("no new variables in declaration")
+						c.errorf(lhs, NoNewVar, "no new variables in declaration")
 						return nil
 					}
 					continue
@@ -170,11 +220,34 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 					continue
 				}
 				lhsP := c.expr(lhs)
+				if lhsP.mode != modeInvalid && !c.assignTo(lhs, lhsP) {
+					continue
+				}
 				c.assign(&p, lhsP.typ)
 			}
 		}
 		return nil
 
+	case *stmt.Const:
+		c.checkConst(s, 0)
+		return nil
+
+	case *stmt.ConstSet:
+		for i, s := range s.Consts {
+			c.checkConst(s, i)
+		}
+		return nil
+
+	case *stmt.Var:
+		c.checkVar(s)
+		return nil
+
+	case *stmt.VarSet:
+		for _, v := range s.Vars {
+			c.checkVar(v)
+		}
+		return nil
+
 	case *stmt.Simple:
 		p := c.exprNoElide(s.Expr)
 		if c, isCall := s.Expr.(*expr.Call); isCall {
@@ -211,6 +284,14 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		}
 		return nil
 
+	case *stmt.Defer:
+		if c.funcs == 0 {
+			c.errorf(nil, InvalidDefer, "defer outside function")
+			return nil
+		}
+		c.expr(s.Call)
+		return nil
+
 	case *stmt.Go:
 		c.expr(s.Call)
 		return nil
@@ -259,8 +340,16 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		case *tipe.Map:
 			kt = t.Key
 			vt = t.Value
+		case *tipe.Chan:
+			kt = t.Elem
+			if t.Direction == tipe.ChanSend {
+				c.errorf(s.Expr, InvalidChanOp, "invalid operation: range %s (receive from send-only type %s)", format.Expr(s.Expr), format.Type(p.typ))
+			}
+			if s.Val != nil {
+				c.errorf(s.Val, InvalidChanOp, "range %s permits only one iteration variable", format.Expr(s.Expr))
+			}
 		default:
-			c.errorf("TODO range over non-slice: %T", t)
+			c.errorf(s.Expr, Unsupported, "TODO range over non-slice: %T", t)
 		}
 		if s.Decl {
 			if s.Key != nil {
@@ -278,11 +367,13 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		} else {
 			if s.Key != nil {
 				p := c.expr(s.Key)
+				c.assignTo(s.Key, p)
 				c.assign(&p, kt)
 				c.Types[s.Key] = kt
 			}
 			if s.Val != nil {
 				p := c.expr(s.Val)
+				c.assignTo(s.Val, p)
 				c.assign(&p, vt)
 				c.Types[s.Val] = vt
 			}
@@ -290,22 +381,83 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		c.stmt(s.Body, retType)
 		return nil
 
+	case *stmt.Switch:
+		c.pushScope()
+		defer c.popScope()
+		if s.Init != nil {
+			c.stmt(s.Init, retType)
+		}
+		tag := partial{mode: modeConst, typ: tipe.Bool, val: constant.MakeBool(true)}
+		if s.Cond != nil {
+			tag = c.expr(s.Cond)
+			if isUntyped(tag.typ) {
+				c.constrainUntyped(&tag, defaultType(tag.typ))
+			}
+		}
+		for _, cse := range s.Cases {
+			for _, e := range cse.Conds {
+				c.checkSwitchCase(s.Cond, tag, e)
+			}
+			c.stmt(cse.Body, retType)
+		}
+		return nil
+
+	case *stmt.TypeSwitch:
+		c.pushScope()
+		defer c.popScope()
+		if s.Init != nil {
+			c.stmt(s.Init, retType)
+		}
+		c.checkTypeSwitch(s, retType)
+		return nil
+
+	case *stmt.Select:
+		for _, cse := range s.Cases {
+			c.pushScope()
+			if cse.Comm != nil {
+				c.stmt(cse.Comm, retType)
+			}
+			c.stmt(cse.Body, retType)
+			c.popScope()
+		}
+		return nil
+
 	case *stmt.TypeDecl:
-		t, _ := c.resolve(s.Type)
-		s.Type = t
+		if s.Alias {
+			t, _ := c.resolve(s.Type)
+			s.Type = &tipe.Alias{Name: s.Name, Type: t}
+			c.cur.Objs[s.Name] = &Obj{
+				Kind: ObjType,
+				Type: s.Type,
+				Decl: s,
+			}
+			return nil
+		}
 
-		obj := &Obj{
+		// A defined type is in scope in its own declaration,
+		// so it can refer to itself: type list struct{ next *list }
+		t := &tipe.Named{Name: s.Name}
+		c.cur.Objs[s.Name] = &Obj{
 			Kind: ObjType,
-			Type: s.Type,
+			Type: t,
 			Decl: s,
 		}
-		c.cur.Objs[s.Name] = obj
+		t.Type, _ = c.resolve(s.Type)
+		s.Type = t
+		c.checkCycle(t)
 		return nil
 
 	case *stmt.MethodikDecl:
 		var usesNum bool
+		obj := &Obj{
+			Kind: ObjType,
+			Type: s.Type,
+			Decl: s,
+		}
+		c.cur.Objs[s.Name] = obj
 		t, _ := c.resolve(s.Type)
-		s.Type = t.(*tipe.Methodik)
+		s.Type = t.(*tipe.Named)
+		c.checkCycle(s.Type)
 		for _, f := range s.Type.Methods {
 			usesNum = usesNum || tipe.UsesNum(f)
 		}
@@ -317,6 +469,9 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 					Kind: ObjVar,
 					Type: s.Type,
 				}
+				if m.PointerReceiver {
+					obj.Type = &tipe.Pointer{Elem: s.Type}
+				}
 				c.cur.Objs[m.ReceiverName] = obj
 			}
 			c.expr(m)
@@ -327,18 +482,20 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		if usesNum {
 			s.Type.Spec.Num = tipe.Num
 		}
-
-		obj := &Obj{
-			Kind: ObjType,
-			Type: s.Type,
-			Decl: s,
-		}
-		c.cur.Objs[s.Name] = obj
 		return nil
 
 	case *stmt.Return:
+		if len(s.Exprs) == 0 {
+			// Results cannot be named variables, so a bare
+			// return only ends a function without results.
+			if retType != nil && len(retType.Elems) > 0 {
+				c.errorf(nil, AssignMismatch, "not enough arguments to return")
+			}
+			return nil
+		}
 		if retType == nil || len(s.Exprs) > len(retType.Elems) {
-			c.errorf("too many arguments to return")
+			c.errorf(nil, AssignMismatch, "too many arguments to return")
+			return nil
 		}
 		var partials []partial
 		for i, e := range s.Exprs {
@@ -357,31 +514,35 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		var got []tipe.Type
 		if tup, ok := partials[0].typ.(*tipe.Tuple); ok {
 			if len(partials) != 1 {
-				c.errorf("multi-value %s in single-value context", partials[0])
+				c.errorf(s.Exprs[1], AssignMismatch, "multi-value %s in single-value context", partials[0])
 				return nil
 			}
 			got = tup.Elems
 		} else {
 			for _, p := range partials {
 				if _, ok := p.typ.(*tipe.Tuple); ok {
-					c.errorf("multi-value %s in single-value context", partials[0])
+					c.errorf(p.expr, AssignMismatch, "multi-value %s in single-value context", partials[0])
 					return nil
 				}
 				got = append(got, p.typ)
 			}
 		}
 		if len(got) > len(want) {
-			c.errorf("too many arguments to return")
+			c.errorf(nil, AssignMismatch, "too many arguments to return")
 			return nil
 		}
 		if len(got) < len(want) {
-			c.errorf("too few arguments to return")
+			c.errorf(nil, AssignMismatch, "too few arguments to return")
 			return nil
 		}
 
 		for i := range want {
 			if !c.assignable(want[i], got[i]) {
-				c.errorf("cannot use %s as %s in return argument", format.Type(got[i]), format.Type(want[i]))
+				var e expr.Expr // a multi-value call has one expression
+				if len(partials) == len(want) {
+					e = partials[i].expr
+				}
+				c.errorf(e, Unassignable, "cannot use %s as %s in return argument%s", format.Type(got[i]), format.Type(want[i]), c.notImplemented(got[i], want[i]))
 			}
 		}
 		return nil
@@ -401,27 +562,34 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 		if p.mode == modeInvalid {
 			return nil
 		}
-		cht, ok := p.typ.(*tipe.Chan)
+		cht, ok := tipe.Underlying(p.typ).(*tipe.Chan)
 		if !ok {
-			c.errorf("cannot send to non-channel type: %s", format.Type(cht))
+			c.errorf(s.Chan, InvalidChanOp, "cannot send to non-channel type: %s", format.Type(p.typ))
+			return nil
+		}
+		if cht.Direction == tipe.ChanRecv {
+			c.errorf(s.Chan, InvalidChanOp, "invalid operation: %s <- %s (send to receive-only type %s)", format.Expr(s.Chan), format.Expr(s.Value), format.Type(p.typ))
 			return nil
 		}
 		p = c.expr(s.Value)
 		if p.mode == modeInvalid {
 			return nil
 		}
-		c.convert(&p, cht.Elem)
-		if p.mode == modeInvalid {
-			c.errorf("cannot send %s to %s", format.Type(p.typ), format.Type(cht))
+		if isUntyped(p.typ) {
+			c.assign(&p, cht.Elem)
+		} else if !c.assignable(cht.Elem, p.typ) {
+			c.errorf(s.Value, InvalidChanOp, "cannot send %s to %s%s", format.Type(p.typ), format.Type(cht), c.notImplemented(p.typ, cht.Elem))
 		}
 		return nil
 
 	case *stmt.Branch:
-		// TODO: make sure the branch is valid
+		c.checkBranch(s)
 		return nil
 
 	case *stmt.Labeled:
+		c.labels = append(c.labels, s)
 		c.stmt(s.Stmt, retType)
+		c.labels = c.labels[:len(c.labels)-1]
 		return nil
 
 	default:
@@ -431,10 +599,536 @@ func (c *Checker) stmt(s stmt.Stmt, retType *tipe.Tuple) tipe.Type {
 
 var goErrorID = gotypes.Universe.Lookup("error").Id()
 
+// exprSlice checks the slice expression e, "x[low:high:max]".
+func (c *Checker) exprSlice(e *expr.Index, s *expr.Slice, left partial) (p partial) {
+	p.expr = e
+	switch lt := tipe.Underlying(left.typ).(type) {
+	case *tipe.Slice:
+		p.typ = left.typ
+	case *tipe.Array:
+		p.typ = &tipe.Slice{Elem: lt.Elem}
+	case tipe.Basic:
+		if lt != tipe.String {
+			c.errorf(e.Left, InvalidSlice, "cannot slice %s (type %s)", format.Expr(e.Left), format.Type(left.typ))
+			return p
+		}
+		if s.Max != nil {
+			c.errorf(e, InvalidSlice, "invalid operation %s (3-index slice of string)", format.Expr(e))
+			return p
+		}
+		p.typ = left.typ
+	default:
+		c.errorf(e.Left, InvalidSlice, "cannot slice %s (type %s)", format.Expr(e.Left), format.Type(left.typ))
+		return p
+	}
+	for _, ind := range []expr.Expr{s.Low, s.High, s.Max} {
+		if ind == nil {
+			continue
+		}
+		ip := c.expr(ind)
+		if ip.mode == modeInvalid {
+			return ip
+		}
+		c.convert(&ip, tipe.Int)
+		if ip.mode == modeInvalid {
+			return ip
+		}
+		if at, isArray := tipe.Underlying(left.typ).(*tipe.Array); isArray {
+			if !c.checkIndex(ip, "slice", at.Len, at.Len+1) {
+				p.mode = modeInvalid
+				return p
+			}
+		} else if !c.checkIndex(ip, "slice", 0, -1) {
+			p.mode = modeInvalid
+			return p
+		}
+	}
+	p.mode = modeVar
+	if tipe.Underlying(left.typ) == tipe.String {
+		p.mode = modeValue
+	}
+	return p
+}
+
+// checkIndex reports whether the index i, if constant, is
+// non-negative and less than bound. A negative bound is unknown.
+// An out of bounds index is reported against an array of length n.
+func (c *Checker) checkIndex(i partial, kind string, n, bound int64) bool {
+	if i.mode != modeConst {
+		return true
+	}
+	v, exact := constant.Int64Val(constant.ToInt(i.val))
+	if !exact {
+		return true
+	}
+	if v < 0 {
+		c.errorf(i.expr, InvalidIndex, "invalid %s index %d (index must be non-negative)", kind, v)
+		return false
+	}
+	if bound >= 0 && v >= bound {
+		c.errorf(i.expr, InvalidIndex, "invalid %s index %d (out of bounds for %d-element array)", kind, v, n)
+		return false
+	}
+	return true
+}
+
+// hasCallOrRecv reports whether e contains a function call or a
+// channel receive.
+func hasCallOrRecv(e expr.Expr) bool {
+	found := false
+	walk.Inspect(e, func(n walk.Node) bool {
+		switch n := n.(type) {
+		case *expr.Call:
+			found = true
+		case *expr.Unary:
+			if n.Op == token.ChanOp {
+				found = true
+			}
+		case *expr.FuncLiteral:
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// arrayLen folds the length expression of the array type t into
+// t.Len, reporting whether it is a valid constant length.
+func (c *Checker) arrayLen(t *tipe.Array) bool {
+	e := t.LenExpr.(expr.Expr)
+	p := c.expr(e)
+	if p.mode == modeInvalid {
+		return false
+	}
+	if p.mode != modeConst {
+		c.errorf(e, InvalidArrayLen, "array length %s is not a constant", format.Expr(e))
+		return false
+	}
+	v := constant.ToInt(p.val)
+	if !isNumeric(p.typ) || v.Kind() != constant.Int {
+		c.errorf(e, InvalidArrayLen, "array length %s (%s) must be integer", format.Expr(e), format.Type(p.typ))
+		return false
+	}
+	n, exact := constant.Int64Val(v)
+	if !exact || n < 0 {
+		c.errorf(e, InvalidArrayLen, "invalid array length %s", format.Expr(e))
+		return false
+	}
+	t.Len = n
+	t.LenExpr = nil
+	return true
+}
+
+// addressable reports whether e is addressable: a variable, a
+// pointer indirection, a slice index, or a field selector or array
+// index of an addressable operand.
+func (c *Checker) addressable(e expr.Expr) bool {
+	switch e := e.(type) {
+	case *expr.Ident:
+		obj := c.Defs[e]
+		return obj != nil && obj.Kind == ObjVar && e.Name != "nil"
+	case *expr.Unary:
+		switch e.Op {
+		case token.LeftParen:
+			return c.addressable(e.Expr)
+		case token.Mul:
+			return true
+		}
+	case *expr.Index:
+		switch tipe.Underlying(c.Types[e.Left]).(type) {
+		case *tipe.Slice:
+			return true
+		case *tipe.Array:
+			return c.addressable(e.Left)
+		}
+	case *expr.Selector:
+		if _, isPtr := tipe.Underlying(c.Types[e.Left]).(*tipe.Pointer); isPtr {
+			return true
+		}
+		if _, isPkg := c.Types[e.Left].(*tipe.Package); isPkg {
+			return true
+		}
+		return c.addressable(e.Left)
+	}
+	return false
+}
+
+// writable reports whether e, which is assigned to or has its
+// address taken, may be modified. It reports an error if e is a
+// read-only variable, or a field or array element of one.
+func (c *Checker) writable(e expr.Expr) bool {
+	root := e
+	for {
+		switch x := root.(type) {
+		case *expr.Unary:
+			if x.Op != token.LeftParen {
+				return true
+			}
+			root = x.Expr
+			continue
+		case *expr.Index:
+			if _, isArray := tipe.Underlying(c.Types[x.Left]).(*tipe.Array); !isArray {
+				return true
+			}
+			root = x.Left
+			continue
+		case *expr.Selector:
+			switch tipe.Underlying(c.Types[x.Left]).(type) {
+			case *tipe.Pointer, *tipe.Package:
+				return true
+			}
+			root = x.Left
+			continue
+		case *expr.Ident:
+			if obj := c.Defs[x]; obj != nil && obj.ReadOnly {
+				c.errorf(e, ReadOnlyVar, "cannot modify %s (%s is read-only)", format.Expr(e), x.Name)
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// assignTo reports whether e, checked as p, may be assigned to. It
+// reports an error if e is a value but not a variable, or is not
+// writable.
+func (c *Checker) assignTo(e expr.Expr, p partial) bool {
+	if p.mode == modeValue {
+		c.errorf(e, NotAssignable, "cannot assign to %s (strings are immutable)", format.Expr(e))
+		return false
+	}
+	return c.writable(e)
+}
+
+func isCompLiteral(e expr.Expr) bool {
+	switch e.(type) {
+	case *expr.CompLiteral, *expr.ArrayLiteral, *expr.SliceLiteral, *expr.MapLiteral:
+		return true
+	}
+	return false
+}
+
+// commaOk reports the (T, bool) type of e if it is an expression
+// that can produce an optional second boolean value in an
+// assignment, such as the map index expression m[k] or the
+// type assertion x.(T).
+func (c *Checker) commaOk(e expr.Expr, t tipe.Type) *tipe.Tuple {
+	switch e := e.(type) {
+	case *expr.Index:
+		if _, isMap := tipe.Underlying(c.Types[e.Left]).(*tipe.Map); !isMap {
+			return nil
+		}
+	case *expr.TypeAssert:
+	case *expr.Unary:
+		if e.Op != token.ChanOp {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return &tipe.Tuple{Elems: []tipe.Type{t, tipe.Bool}}
+}
+
+// declType gives p, the i'th value on the right of a declaration
+// with no explicit type, the type of the variable it declares.
+// It reports false if p cannot be the value of a variable.
+func (c *Checker) declType(p *partial, right []expr.Expr, i int) bool {
+	switch {
+	case p.mode == modeInvalid:
+		return false
+	case p.typ == nil:
+		e := right[0]
+		if i < len(right) {
+			e = right[i]
+		}
+		c.errorf(e, NoValue, "%s (no value) used as value", format.Expr(e))
+		return false
+	case p.typ == tipe.UntypedNil:
+		c.errorf(p.expr, NoValue, "use of untyped nil in assignment")
+		return false
+	case isUntyped(p.typ):
+		c.constrainUntyped(p, defaultType(p.typ))
+	}
+	return true
+}
+
+// checkConst declares the constant s. It is the iota'th
+// specification of its const declaration.
+func (c *Checker) checkConst(s *stmt.Const, iota int) {
+	c.iota = constant.MakeInt64(int64(iota))
+	p := c.expr(s.Value)
+	c.iota = nil
+	if p.mode == modeInvalid {
+		return
+	}
+	if p.mode != modeConst {
+		c.errorf(s.Value, NotConstant, "const initializer %s is not a constant", format.Expr(s.Value))
+		return
+	}
+	if s.Type != nil {
+		t, resolved := c.resolve(s.Type)
+		if !resolved {
+			return
+		}
+		s.Type = t
+		c.convert(&p, t)
+		if p.mode == modeInvalid {
+			return
+		}
+	}
+	if c.redeclared(s.Name) {
+		return
+	}
+	c.cur.Objs[s.Name] = &Obj{
+		Kind: ObjConst,
+		Type: p.typ,
+		Decl: p.val,
+	}
+}
+
+func (c *Checker) checkVar(s *stmt.Var) {
+	if s.Type != nil {
+		t, resolved := c.resolve(s.Type)
+		if !resolved {
+			return
+		}
+		s.Type = t
+	}
+	types := make([]tipe.Type, len(s.NameList))
+	if len(s.Values) == 1 && len(s.NameList) > 1 {
+		// var a, b = f()
+		p := c.exprNoElide(s.Values[0])
+		if p.mode == modeInvalid {
+			return
+		}
+		if len(s.NameList) == 2 {
+			if t := c.commaOk(s.Values[0], p.typ); t != nil {
+				c.Types[s.Values[0]] = t
+				p.typ = t
+			}
+		}
+		tuple, isTuple := p.typ.(*tipe.Tuple)
+		if !isTuple || len(tuple.Elems) != len(s.NameList) {
+			c.errorf(s.Values[0], AssignMismatch, "arity mismatch, left %d != right %d", len(s.NameList), len(s.Values))
+			return
+		}
+		for i, t := range tuple.Elems {
+			p := partial{mode: modeVar, typ: t}
+			if s.Type != nil {
+				c.assign(&p, s.Type)
+				if p.mode == modeInvalid {
+					return
+				}
+			}
+			types[i] = t
+		}
+	} else if len(s.Values) > 0 {
+		if len(s.Values) != len(s.NameList) {
+			c.errorf(nil, AssignMismatch, "arity mismatch, left %d != right %d", len(s.NameList), len(s.Values))
+			return
+		}
+		for i, v := range s.Values {
+			p := c.expr(v)
+			if s.Type != nil {
+				c.assign(&p, s.Type)
+			} else if !c.declType(&p, s.Values, i) {
+				return
+			}
+			if p.mode == modeInvalid {
+				return
+			}
+			types[i] = p.typ
+		}
+	}
+	for i, name := range s.NameList {
+		if name == "_" || c.redeclared(name) {
+			continue
+		}
+		t := s.Type
+		if t == nil {
+			t = types[i]
+		}
+		c.cur.Objs[name] = &Obj{
+			Kind: ObjVar,
+			Type: t,
+		}
+	}
+}
+
+// checkCycle reports an error if the defined type t contains
+// itself by value, as in "type T struct{ x T }", which would make
+// it infinitely large. The error gives the path of the cycle.
+func (c *Checker) checkCycle(t *tipe.Named) {
+	path := cyclePath(t.Type, []*tipe.Named{t})
+	if path == nil {
+		return
+	}
+	names := make([]string, len(path))
+	for i, n := range path {
+		names[i] = n.Name
+	}
+	c.errorf(nil, InvalidCycle, "invalid recursive type %s: %s", t.Name, strings.Join(names, " refers to "))
+	t.Type = tipe.Invalid
+}
+
+// cyclePath returns the defined types from the end of path to the
+// one the type t, which path refers to, refers back to by value.
+func cyclePath(t tipe.Type, path []*tipe.Named) []*tipe.Named {
+	switch t := tipe.Unalias(t).(type) {
+	case *tipe.Named:
+		for i, n := range path {
+			if n == t {
+				return append(path[i:len(path):len(path)], t)
+			}
+		}
+		return cyclePath(t.Type, append(path, t))
+	case *tipe.Struct:
+		for _, f := range t.Fields {
+			if p := cyclePath(f, path); p != nil {
+				return p
+			}
+		}
+	case *tipe.Array:
+		return cyclePath(t.Elem, path)
+	}
+	return nil
+}
+
+// checkSwitchCase checks the case expression e of a switch on the
+// expression cond, which has been evaluated to tag. A switch with no
+// cond switches on true.
+func (c *Checker) checkSwitchCase(cond expr.Expr, tag partial, e expr.Expr) {
+	p := c.expr(e)
+	if p.mode == modeInvalid || tag.mode == modeInvalid {
+		return
+	}
+	c.constrainUntyped(&p, tag.typ)
+	if p.mode == modeInvalid {
+		return
+	}
+	if cond == nil {
+		if !c.assignable(tipe.Bool, p.typ) {
+			c.errorf(e, InvalidSwitchCase, "invalid case %s in switch (mismatched types %s and bool)", format.Expr(e), format.Type(p.typ))
+		}
+		return
+	}
+	if !c.assignable(tag.typ, p.typ) && !c.assignable(p.typ, tag.typ) {
+		c.errorf(e, InvalidSwitchCase, "invalid case %s in switch on %s (mismatched types %s and %s)", format.Expr(e), format.Expr(cond), format.Type(p.typ), format.Type(tag.typ))
+	}
+}
+
+// checkTypeSwitch checks the guard and cases of a type switch.
+// When the guard declares a variable, each case body has its own
+// copy of it, typed as the case's type if the case lists exactly
+// one, or as the switch expression's type otherwise.
+func (c *Checker) checkTypeSwitch(s *stmt.TypeSwitch, retType *tipe.Tuple) {
+	var name string
+	var guard *expr.TypeAssert
+	switch a := s.Assign.(type) {
+	case *stmt.Simple:
+		guard = a.Expr.(*expr.TypeAssert)
+	case *stmt.Assign:
+		name = a.Left[0].(*expr.Ident).Name
+		guard = a.Right[0].(*expr.TypeAssert)
+	}
+	x := c.expr(guard.Expr)
+	if x.mode == modeInvalid {
+		return
+	}
+	if _, isIface := tipe.Underlying(x.typ).(*tipe.Interface); !isIface {
+		c.errorf(guard.Expr, NonInterface, "cannot type switch on non-interface value %s (type %s)", format.Expr(guard.Expr), format.Type(x.typ))
+		return
+	}
+	c.Types[guard] = x.typ
+	for _, cse := range s.Cases {
+		vt := x.typ
+		for i, t := range cse.Types {
+			if u, ok := t.(*tipe.Unresolved); ok && u.Package == "" && u.Name == "nil" {
+				cse.Types[i] = tipe.UntypedNil
+				continue
+			}
+			rt, resolved := c.resolve(t)
+			if !resolved {
+				continue
+			}
+			cse.Types[i] = rt
+			if _, isIface := tipe.Underlying(rt).(*tipe.Interface); !isIface && !c.assignable(x.typ, rt) {
+				c.errorf(typeNode(t), ImpossibleAssert, "impossible type switch case: %s (type %s) cannot have dynamic type %s", format.Expr(guard.Expr), format.Type(x.typ), format.Type(rt))
+			}
+		}
+		if len(cse.Types) == 1 && cse.Types[0] != tipe.UntypedNil {
+			vt = cse.Types[0]
+		}
+		c.pushScope()
+		if name != "" && name != "_" {
+			c.cur.Objs[name] = &Obj{Kind: ObjVar, Type: vt}
+		}
+		c.stmt(cse.Body, retType)
+		c.popScope()
+	}
+}
+
+// topLevel reports whether the current scope is the top-level
+// scope. Unlike a block, it allows names to be declared again,
+// so that an interactive session can redefine a variable.
+func (c *Checker) topLevel() bool {
+	return c.cur.Parent == Universe
+}
+
+// redeclared reports an error if name is already declared in the
+// current block.
+func (c *Checker) redeclared(name string) bool {
+	if name == "_" || c.topLevel() || c.cur.Objs[name] == nil {
+		return false
+	}
+	c.errorf(nil, Redeclared, "%s redeclared in this block", name)
+	return true
+}
+
+// newVars reports whether any of the identifiers on the left of a
+// := statement are not already declared in the current block.
+func (c *Checker) newVars(left []expr.Expr) bool {
+	for _, lhs := range left {
+		if name := lhs.(*expr.Ident).Name; name != "_" && c.cur.Objs[name] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBranch reports an error if a labeled break or continue
+// does not refer to an enclosing statement it can branch to.
+func (c *Checker) checkBranch(s *stmt.Branch) {
+	if s.Label == "" || (s.Type != token.Break && s.Type != token.Continue) {
+		// TODO: check goto labels, which may be declared later.
+		return
+	}
+	for i := len(c.labels) - 1; i >= 0; i-- {
+		l := c.labels[i]
+		if l.Label != s.Label {
+			continue
+		}
+		switch l.Stmt.(type) {
+		case *stmt.For, *stmt.Range:
+			return
+		case *stmt.Switch, *stmt.TypeSwitch, *stmt.Select:
+			if s.Type == token.Break {
+				return
+			}
+		}
+		c.errorf(nil, InvalidLabel, "invalid %s label %s", s.Type, s.Label)
+		return
+	}
+	c.errorf(nil, InvalidLabel, "%s label not defined: %s", s.Type, s.Label)
+}
+
 func (c *Checker) fromGoType(t gotypes.Type) (res tipe.Type) {
 	if res = c.GoTypes[t]; res != nil {
 		return res
 	}
+	if alias, isAlias := t.(*gotypes.Alias); isAlias {
+		return c.fromGoType(gotypes.Unalias(alias)) // as in any
+	}
 	defer func() {
 		if res == nil {
 			fmt.Printf("typecheck: unknown go type: %v\n", t)
@@ -498,7 +1192,7 @@ func (c *Checker) fromGoType(t gotypes.Type) (res tipe.Type) {
 		if t.Obj().Id() == goErrorID {
 			return Universe.Objs["error"].Type
 		}
-		return new(tipe.Methodik)
+		return new(tipe.Named)
 	case *gotypes.Array:
 		return &tipe.Array{}
 	case *gotypes.Slice:
@@ -527,8 +1221,8 @@ func (c *Checker) fillGoType(res tipe.Type, t gotypes.Type) {
 			return
 		}
 		base := c.fromGoType(t.Underlying())
-		mdik := res.(*tipe.Methodik)
-		*mdik = tipe.Methodik{
+		mdik := res.(*tipe.Named)
+		*mdik = tipe.Named{
 			Type:    base,
 			Name:    t.Obj().Name(),
 			PkgName: t.Obj().Pkg().Name(),
@@ -538,6 +1232,8 @@ func (c *Checker) fillGoType(res tipe.Type, t gotypes.Type) {
 			m := t.Method(i)
 			mdik.MethodNames = append(mdik.MethodNames, m.Name())
 			mdik.Methods = append(mdik.Methods, c.fromGoType(m.Type()).(*tipe.Func))
+			_, ptr := m.Type().(*gotypes.Signature).Recv().Type().(*gotypes.Pointer)
+			mdik.PointerReceivers = append(mdik.PointerReceivers, ptr)
 		}
 	case *gotypes.Array:
 		a := res.(*tipe.Array)
@@ -607,10 +1303,8 @@ func (c *Checker) goPkg(path string) (*tipe.Package, error) {
 	if path == "mat" {
 		goPath = "neugram.io/ng/vendor/mat" // TODO: remove "mat" exception
 	}
-	// Make sure our '.a' files are fresh.
-	out, err := exec.Command("go", "install", goPath).CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("go install %s: %v\n%s", goPath, err, out)
+	if err := installGo(goPath); err != nil {
+		return nil, err
 	}
 	gopkg, err := c.ImportGo(goPath)
 	if err != nil {
@@ -625,7 +1319,7 @@ func (c *Checker) goPkg(path string) (*tipe.Package, error) {
 
 	for _, name := range gopkg.Scope().Names() {
 		obj := gopkg.Scope().Lookup(name)
-		if !obj.Exported() {
+		if !obj.Exported() || isGenericGo(obj) {
 			continue
 		}
 		pkg.Exports[name] = c.fromGoType(obj.Type())
@@ -639,6 +1333,19 @@ func (c *Checker) goPkg(path string) (*tipe.Package, error) {
 	return pkg, nil
 }
 
+// isGenericGo reports whether obj is a generic Go function or type,
+// which Neugram cannot instantiate.
+func isGenericGo(obj gotypes.Object) bool {
+	switch t := obj.Type().(type) {
+	case *gotypes.Signature:
+		return t.TypeParams().Len() > 0
+	case *gotypes.Named:
+		_, isTypeName := obj.(*gotypes.TypeName)
+		return isTypeName && t.TypeParams().Len() > 0
+	}
+	return false
+}
+
 func (c *Checker) ngPkg(path string) (*tipe.Package, error) {
 	if !filepath.IsAbs(path) {
 		path = filepath.Join(filepath.Dir(c.importWalk[len(c.importWalk)-1]), path)
@@ -669,37 +1376,111 @@ func (c *Checker) ngPkg(path string) (*tipe.Package, error) {
 	c.importWalk = append(c.importWalk, path)
 	oldcur := c.cur
 	defer func() {
-		f.Close()
+		f.Close()
+		c.importWalk = c.importWalk[:len(c.importWalk)-1]
+		c.cur = oldcur
+	}()
+
+	c.cur = &Scope{
+		Parent: Universe,
+		Objs:   make(map[string]*Obj),
+	}
+	if err := c.parseFile(f); err != nil {
+		return nil, fmt.Errorf("ng import parse: %v", err)
+	}
+	pkg := &tipe.Package{
+		Path:    path,
+		Exports: make(map[string]tipe.Type),
+	}
+	c.NgPkgs[path] = pkg
+	for c.cur != Universe {
+		for name, obj := range c.cur.Objs {
+			if !isExported(name) {
+				continue
+			}
+			if _, exists := pkg.Exports[name]; exists {
+				continue
+			}
+			pkg.Exports[name] = obj.Type
+			fmt.Printf("package exports %q\n", name)
+		}
+		c.cur = c.cur.Parent
+	}
+	return pkg, nil
+}
+
+// IsGoSrcPath reports whether the import path names a directory of
+// Go source relative to the importing file, as in "./models".
+func IsGoSrcPath(path string) bool {
+	if strings.HasSuffix(path, ".ng") {
+		return false
+	}
+	return path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// goSrcPkg imports the Go package in the directory path from its
+// source. The package is converted to Neugram, and checked as an
+// imported Neugram package is. It returns the package and its name.
+func (c *Checker) goSrcPkg(path string) (*tipe.Package, string, error) {
+	dir, err := filepath.Abs(filepath.Join(filepath.Dir(c.importWalk[len(c.importWalk)-1]), path))
+	if err != nil {
+		return nil, "", fmt.Errorf("go source import: %v", err)
+	}
+	if pkg := c.NgPkgs[dir]; pkg != nil {
+		return pkg, c.GoSrcPkgs[dir].Package, nil
+	}
+	bpkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("go source import: %v", err)
+	}
+	if len(bpkg.CgoFiles) > 0 {
+		return nil, "", fmt.Errorf("go source import: %s uses cgo", dir)
+	}
+	fset := gotoken.NewFileSet()
+	var files []*ast.File
+	for _, name := range bpkg.GoFiles {
+		f, err := goparser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, "", fmt.Errorf("go source import: %v", err)
+		}
+		files = append(files, f)
+	}
+	file, err := goast.FromPackage(files)
+	if err != nil {
+		return nil, "", fmt.Errorf("go source import: %s: %v", dir, err)
+	}
+
+	// A relative import of the package is relative to its directory.
+	c.importWalk = append(c.importWalk, filepath.Join(dir, bpkg.GoFiles[0]))
+	oldcur := c.cur
+	defer func() {
 		c.importWalk = c.importWalk[:len(c.importWalk)-1]
 		c.cur = oldcur
 	}()
-
 	c.cur = &Scope{
 		Parent: Universe,
 		Objs:   make(map[string]*Obj),
 	}
-	if err := c.parseFile(f); err != nil {
-		return nil, fmt.Errorf("ng import parse: %v", err)
+	for _, s := range file.Stmts {
+		c.Add(s)
+		if len(c.Errs) > 0 {
+			return nil, "", fmt.Errorf("go source import: %s: %v", dir, c.Errs[0])
+		}
 	}
 	pkg := &tipe.Package{
-		Path:    path,
+		Path:    dir,
 		Exports: make(map[string]tipe.Type),
 	}
-	c.NgPkgs[path] = pkg
-	for c.cur != Universe {
-		for name, obj := range c.cur.Objs {
-			if !isExported(name) {
-				continue
-			}
-			if _, exists := pkg.Exports[name]; exists {
-				continue
-			}
+	for name, obj := range c.cur.Objs {
+		if isExported(name) {
 			pkg.Exports[name] = obj.Type
-			fmt.Printf("package exports %q\n", name)
 		}
-		c.cur = c.cur.Parent
 	}
-	return pkg, nil
+	c.NgPkgs[dir] = pkg
+	c.GoSrcPkgs[dir] = file
+	c.goSrcScopes[pkg] = c.cur
+	return pkg, file.Package, nil
 }
 
 func isExported(name string) bool {
@@ -708,19 +1489,18 @@ func isExported(name string) bool {
 }
 
 func (c *Checker) parseFile(f *os.File) error {
-	p := parser.New()
+	p := parser.New(c.Fset, f.Name(), 0)
 
 	scanner := bufio.NewScanner(f)
-	for i := 0; scanner.Scan(); i++ {
-		line := scanner.Bytes()
-		res := p.ParseLine(line)
+	for scanner.Scan() {
+		res := p.ParseLine(scanner.Bytes())
 		if len(res.Errs) > 0 {
-			return fmt.Errorf("%d: %v", i+1, res.Errs[0]) // TODO: position information
+			return res.Errs[0]
 		}
 		for _, s := range res.Stmts {
 			c.Add(s)
 			if len(c.Errs) > 0 {
-				return fmt.Errorf("%d: typecheck: %v\n", i+1, c.Errs[0])
+				return fmt.Errorf("typecheck: %v", c.Errs[0])
 			}
 		}
 	}
@@ -729,7 +1509,7 @@ func (c *Checker) parseFile(f *os.File) error {
 
 func (c *Checker) checkImport(s *stmt.Import) {
 	if strings.HasPrefix(s.Path, "/") {
-		c.errorf("imports do not support absolute paths: %q", s.Path)
+		c.errorf(nil, ImportFailed, "imports do not support absolute paths: %q", s.Path)
 		return
 	}
 	var pkg *tipe.Package
@@ -737,20 +1517,35 @@ func (c *Checker) checkImport(s *stmt.Import) {
 	if strings.HasSuffix(s.Path, ".ng") {
 		pkg, err = c.ngPkg(s.Path)
 		if err != nil {
-			c.errorf("importing of ng package failed: %v", err)
+			c.errorf(nil, ImportFailed, "importing of ng package failed: %v", err)
 			return
 		}
 		if s.Name == "" {
 			s.Name = strings.TrimSuffix(filepath.Base(s.Path), ".ng")
 		}
+	} else if IsGoSrcPath(s.Path) {
+		var name string
+		pkg, name, err = c.goSrcPkg(s.Path)
+		if err != nil {
+			c.errorf(nil, ImportFailed, "importing of go source package failed: %v", err)
+			return
+		}
+		if s.Name == "" {
+			s.Name = name
+		}
 	} else {
 		pkg, err = c.goPkg(s.Path)
 		if err != nil {
-			c.errorf("importing of go package failed: %v", err)
+			c.errorf(nil, ImportFailed, "importing of go package failed: %v", err)
 			return
 		}
 		if s.Name == "" {
-			s.Name = pkg.GoPkg.(*gotypes.Package).Name()
+			if gopkg, isGo := pkg.GoPkg.(*gotypes.Package); isGo {
+				s.Name = gopkg.Name()
+			} else {
+				// A package provided by the evaluator.
+				s.Name = s.Path[strings.LastIndex(s.Path, "/")+1:]
+			}
 		}
 	}
 	obj := &Obj{
@@ -766,7 +1561,7 @@ func (c *Checker) expr(e expr.Expr) (p partial) {
 	p = c.exprPartial(e, hintElideErr)
 	if p.mode == modeTypeExpr {
 		p.mode = modeInvalid
-		c.errorf("type %s is not an expression", format.Type(p.typ))
+		c.errorf(e, NotAnExpr, "type %s is not an expression", format.Type(p.typ))
 	}
 	return p
 }
@@ -776,7 +1571,7 @@ func (c *Checker) exprNoElide(e expr.Expr) (p partial) {
 	// TODO: dedup with expr()
 	if p.mode == modeTypeExpr {
 		p.mode = modeInvalid
-		c.errorf("type %s is not an expression", format.Type(p.typ))
+		c.errorf(e, NotAnExpr, "type %s is not an expression", format.Type(p.typ))
 	}
 	return p
 }
@@ -793,7 +1588,7 @@ func (c *Checker) exprType(e expr.Expr) tipe.Type {
 			}
 		}
 	}
-	c.errorf("argument %s is not a type (%#+v)", format.Expr(e), p)
+	c.errorf(e, NotAType, "argument %s is not a type (%#+v)", format.Expr(e), p)
 	return nil
 }
 
@@ -819,8 +1614,17 @@ func (c *Checker) resolve(t tipe.Type) (ret tipe.Type, resolved bool) {
 		var r1, r2 bool
 		t.Key, r1 = c.resolve(t.Key)
 		t.Value, r2 = c.resolve(t.Value)
+		if r1 && !tipe.Comparable(t.Key) {
+			c.errorf(t, InvalidMapKey, "invalid map key type %s", format.Type(t.Key))
+		}
 		return t, r1 && r2
-	case *tipe.Methodik:
+	case *tipe.Named:
+		if c.resolving[t] {
+			// a recursive type, already being resolved
+			return t, true
+		}
+		c.resolving[t] = true
+		defer delete(c.resolving, t)
 		t.Type, resolved = c.resolve(t.Type)
 		for i, f := range t.Methods {
 			f, r1 := c.resolve(f)
@@ -832,6 +1636,13 @@ func (c *Checker) resolve(t tipe.Type) (ret tipe.Type, resolved bool) {
 		t.Elem, resolved = c.resolve(t.Elem)
 		return t, resolved
 	case *tipe.Array:
+		if t.Ellipsis {
+			c.errorf(t, InvalidCompLit, "invalid use of [...] array (outside a composite literal)")
+			return t, false
+		}
+		if t.LenExpr != nil && !c.arrayLen(t) {
+			return t, false
+		}
 		t.Elem, resolved = c.resolve(t.Elem)
 		return t, resolved
 	case *tipe.Slice:
@@ -855,6 +1666,22 @@ func (c *Checker) resolve(t tipe.Type) (ret tipe.Type, resolved bool) {
 		return t, resolved
 	case *tipe.Table:
 		t.Type, resolved = c.resolve(t.Type)
+		if t.Schema == nil {
+			return t, resolved
+		}
+		seen := make(map[string]bool)
+		for i, col := range t.Schema.Columns {
+			if seen[col.Name] {
+				c.errorf(t, InvalidTableSchema, "duplicate column %q in table type", col.Name)
+				return t, false
+			}
+			seen[col.Name] = true
+			if col.Type != nil {
+				var r1 bool
+				t.Schema.Columns[i].Type, r1 = c.resolve(col.Type)
+				resolved = resolved && r1
+			}
+		}
 		return t, resolved
 	case *tipe.Tuple:
 		if t == nil {
@@ -877,11 +1704,11 @@ func (c *Checker) resolve(t tipe.Type) (ret tipe.Type, resolved bool) {
 		}
 		obj := c.cur.LookupRec(t.Name)
 		if obj == nil {
-			c.errorf("type %s not declared", t.Name)
+			c.errorf(t, UndeclaredName, "type %s not declared", t.Name)
 			return t, false
 		}
 		if obj.Kind != ObjType {
-			c.errorf("symbol %s is not a type", t.Name)
+			c.errorf(t, NotAType, "symbol %s is not a type", t.Name)
 			return t, false
 		}
 		return obj.Type, true
@@ -895,17 +1722,17 @@ func (c *Checker) lookupPkgType(pkgName, sel string) tipe.Type {
 	name := pkgName + "." + sel
 	obj := c.cur.LookupRec(pkgName)
 	if obj == nil {
-		c.errorf("undefined %s in %s", pkgName, name)
+		c.errorf(nil, UndefinedPkg, "undefined %s in %s", pkgName, name)
 		return nil
 	}
 	if obj.Kind != ObjPkg {
-		c.errorf("%s is not a packacge", pkgName)
+		c.errorf(nil, UndefinedPkg, "%s is not a packacge", pkgName)
 		return nil
 	}
 	pkg := obj.Type.(*tipe.Package)
 	res := pkg.Exports[sel]
 	if res == nil {
-		c.errorf("%s not in package %s", name, pkgName)
+		c.errorf(nil, UndefinedPkg, "%s not in package %s", name, pkgName)
 		return nil
 	}
 	return res
@@ -915,64 +1742,119 @@ func (c *Checker) exprBuiltinCall(e *expr.Call) partial {
 	p := c.expr(e.Func)
 	p.expr = e
 
+	printing := p.typ == tipe.Print || p.typ == tipe.Println || p.typ == tipe.Printf
+	if e.Ellipsis && p.typ != tipe.Append && !printing {
+		p.mode = modeInvalid
+		c.errorf(e, InvalidArgument, "invalid use of ... with builtin %s", format.Expr(e.Func))
+		return p
+	}
+
 	switch p.typ.(tipe.Builtin) {
 	case tipe.Append:
 		if len(e.Args) == 0 {
 			p.mode = modeInvalid
-			c.errorf("too few arguments to append")
+			c.errorf(e, WrongArgCount, "too few arguments to append")
 			return p
 		}
 		arg0 := c.expr(e.Args[0])
 		slice, isSlice := tipe.Underlying(arg0.typ).(*tipe.Slice)
 		if !isSlice {
 			p.mode = modeInvalid
-			c.errorf("first argument to append must be a slice, got %s", format.Type(arg0.typ))
+			c.errorf(e.Args[0], InvalidArgument, "first argument to append must be a slice, got %s", format.Type(arg0.typ))
 			return p
 		}
 		p.typ = arg0.typ
-		// TODO: append(x, y...)
+		if e.Ellipsis {
+			if len(e.Args) != 2 {
+				p.mode = modeInvalid
+				c.errorf(e, InvalidArgument, "can only use ... with final argument to append")
+				return p
+			}
+			argp := c.expr(e.Args[1])
+			if argp.mode == modeInvalid {
+				p.mode = modeInvalid
+				return p
+			}
+			if isString(argp.typ) && tipe.Unalias(slice.Elem) == tipe.Byte {
+				// append([]byte, string...)
+				c.constrainUntyped(&argp, tipe.String)
+				return p
+			}
+			if !c.builtinArg("append", e.Args[1], &argp, slice) {
+				p.mode = modeInvalid
+			}
+			return p
+		}
 		for _, arg := range e.Args[1:] {
 			argp := c.expr(arg)
-			argpTyp := argp.typ
-			c.convert(&argp, slice.Elem)
-			if argp.mode == modeInvalid {
+			if !c.builtinArg("append", arg, &argp, slice.Elem) {
 				p.mode = modeInvalid
-				c.errorf("cannot use %s (type %s) as type %s in argument to append", format.Expr(arg), format.Type(argpTyp), format.Type(slice.Elem))
 				return p
 			}
 		}
 		return p
 	case tipe.Close:
 		p.typ = nil
+		if len(e.Args) != 1 {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "close takes exactly 1 argument, got %d", len(e.Args))
+			return p
+		}
+		arg0 := c.expr(e.Args[0])
+		if arg0.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		ch, isChan := tipe.Underlying(arg0.typ).(*tipe.Chan)
+		if !isChan {
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidChanOp, "invalid operation: %s (non-chan type %s)", format.Expr(e), format.Type(arg0.typ))
+			return p
+		}
+		if ch.Direction == tipe.ChanRecv {
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidChanOp, "invalid operation: %s (cannot close receive-only channel)", format.Expr(e))
+			return p
+		}
+		return p
 	case tipe.Copy:
 		p.typ = tipe.Int
 		if len(e.Args) != 2 {
 			p.mode = modeInvalid
-			c.errorf("copy takes two arguments, got %d", len(e.Args))
+			c.errorf(e, WrongArgCount, "copy takes two arguments, got %d", len(e.Args))
 			return p
 		}
 		dst, src := c.expr(e.Args[0]), c.expr(e.Args[1])
 		var srcElem, dstElem tipe.Type
-		srcTyp := tipe.Underlying(src.typ)
+		if dst.mode == modeInvalid || src.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		c.constrainUntyped(&src, tipe.String)
+		srcTyp := tipe.Unalias(tipe.Underlying(src.typ))
 		if t, isSlice := srcTyp.(*tipe.Slice); isSlice {
 			srcElem = t.Elem
 		} else if srcTyp == tipe.String {
 			srcElem = tipe.Byte
 		} else {
 			p.mode = modeInvalid
-			c.errorf("copy source must be slice or string, got %s", format.Type(src.typ))
+			c.errorf(e.Args[1], InvalidArgument, "copy source must be slice or string, got %s", format.Type(src.typ))
 			return p
 		}
 		if t, isSlice := tipe.Underlying(dst.typ).(*tipe.Slice); isSlice {
 			dstElem = t.Elem
 		} else {
 			p.mode = modeInvalid
-			c.errorf("copy destination must be a slice, have %s", format.Type(dst.typ))
+			c.errorf(e.Args[0], InvalidArgument, "copy destination must be a slice, have %s", format.Type(dst.typ))
+			return p
+		}
+		if srcTyp == tipe.String && tipe.Unalias(dstElem) == tipe.Byte {
+			// copy([]byte, string)
 			return p
 		}
-		if !c.convertible(dstElem, srcElem) {
+		if !tipe.Equal(dstElem, srcElem) {
 			p.mode = modeInvalid
-			c.errorf("copy source type %s is not convertible to destination %s", format.Type(dstElem), format.Type(srcElem))
+			c.errorf(e, InvalidArgument, "arguments to copy have different element types %s and %s", format.Type(dstElem), format.Type(srcElem))
 			return p
 		}
 		return p
@@ -980,90 +1862,242 @@ func (c *Checker) exprBuiltinCall(e *expr.Call) partial {
 		p.typ = nil
 		if len(e.Args) != 2 {
 			p.mode = modeInvalid
-			c.errorf("delete takes exactly two arguments, got %d", len(e.Args))
+			c.errorf(e, WrongArgCount, "delete takes exactly two arguments, got %d", len(e.Args))
 			return p
 		}
 		arg0, arg1 := c.expr(e.Args[0]), c.expr(e.Args[1])
+		if arg0.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
 		var keyType tipe.Type
 		if t, isMap := tipe.Underlying(arg0.typ).(*tipe.Map); isMap {
 			keyType = t.Key
 		} else {
 			p.mode = modeInvalid
-			c.errorf("first argument to delete must be a map, got %s (type %s)", format.Expr(e.Args[0]), format.Type(arg0.typ))
+			c.errorf(e.Args[0], InvalidArgument, "first argument to delete must be a map, got %s (type %s)", format.Expr(e.Args[0]), format.Type(arg0.typ))
+			return p
+		}
+		if arg1.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		if isUntyped(arg1.typ) {
+			c.assign(&arg1, keyType)
+		} else if !c.assignable(keyType, arg1.typ) {
+			arg1.mode = modeInvalid
+			c.errorf(e.Args[1], InvalidArgument, "second argument to delete must match the key type %s, got type %s", format.Type(keyType), format.Type(arg1.typ))
+		}
+		if arg1.mode == modeInvalid {
+			p.mode = modeInvalid
+		}
+		return p
+	case tipe.ComplexFunc:
+		if len(e.Args) != 2 {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "complex takes exactly 2 arguments, got %d", len(e.Args))
+			return p
+		}
+		re, im := c.expr(e.Args[0]), c.expr(e.Args[1])
+		if re.mode == modeInvalid || im.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		if re.mode == modeConst && im.mode == modeConst && isUntyped(re.typ) && isUntyped(im.typ) {
+			rev, imv := constant.ToFloat(re.val), constant.ToFloat(im.val)
+			if rev.Kind() == constant.Unknown || imv.Kind() == constant.Unknown {
+				p.mode = modeInvalid
+				c.errorf(e, InvalidArgument, "invalid operation: %s (arguments must be floating-point)", format.Expr(e))
+				return p
+			}
+			p.mode = modeConst
+			p.typ = tipe.UntypedComplex
+			p.val = constant.BinaryOp(rev, gotoken.ADD, constant.MakeImag(imv))
+			return p
+		}
+		c.constrainUntyped(&re, im.typ)
+		c.constrainUntyped(&im, re.typ)
+		if !tipe.Equal(re.typ, im.typ) {
+			p.mode = modeInvalid
+			c.errorf(e, MismatchedTypes, "invalid operation: %s (mismatched types %s and %s)", format.Expr(e), format.Type(re.typ), format.Type(im.typ))
+			return p
+		}
+		switch tipe.Unalias(tipe.Underlying(re.typ)) {
+		case tipe.Float32:
+			p.typ = tipe.Complex64
+		case tipe.Float64:
+			p.typ = tipe.Complex128
+		default:
+			p.mode = modeInvalid
+			c.errorf(e, InvalidArgument, "invalid operation: %s (arguments have type %s, expected floating-point)", format.Expr(e), format.Type(re.typ))
+		}
+		return p
+	case tipe.Real, tipe.Imag:
+		name := "real"
+		part := constant.Real
+		if p.typ == tipe.Imag {
+			name = "imag"
+			part = constant.Imag
+		}
+		if len(e.Args) != 1 {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "%s takes exactly 1 argument, got %d", name, len(e.Args))
 			return p
 		}
-		if !c.convertible(keyType, arg1.typ) {
+		arg := c.expr(e.Args[0])
+		if arg.mode == modeInvalid {
 			p.mode = modeInvalid
-			c.errorf("second argument to delete must match the key type %s, got type %s", format.Type(keyType), format.Type(arg1.typ))
 			return p
 		}
+		if arg.mode == modeConst && isUntyped(arg.typ) {
+			v := constant.ToComplex(arg.val)
+			if v.Kind() == constant.Unknown {
+				p.mode = modeInvalid
+				c.errorf(e.Args[0], InvalidArgument, "invalid argument %s (%s) for %s", format.Expr(e.Args[0]), format.Type(arg.typ), name)
+				return p
+			}
+			p.mode = modeConst
+			p.typ = tipe.UntypedFloat
+			p.val = part(v)
+			return p
+		}
+		switch tipe.Unalias(tipe.Underlying(arg.typ)) {
+		case tipe.Complex64:
+			p.typ = tipe.Float32
+		case tipe.Complex128:
+			p.typ = tipe.Float64
+		default:
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidArgument, "invalid argument %s (%s) for %s", format.Expr(e.Args[0]), format.Type(arg.typ), name)
+			return p
+		}
+		if arg.mode == modeConst {
+			p.mode = modeConst
+			p.val = part(arg.val)
+		}
 		return p
 	case tipe.Len, tipe.Cap:
+		fn := p.typ
 		p.typ = tipe.Int
 		if len(e.Args) != 1 {
 			p.mode = modeInvalid
-			c.errorf("%s takes exactly 1 argument, got %d", format.Type(p.typ), len(e.Args))
+			c.errorf(e, WrongArgCount, "%s takes exactly 1 argument, got %d", format.Expr(e.Func), len(e.Args))
 			return p
 		}
 		arg0 := c.expr(e.Args[0])
-		switch t := tipe.Underlying(arg0.typ).(type) {
-		case *tipe.Array, *tipe.Slice, *tipe.Map, *tipe.Chan:
+		if arg0.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		argt := tipe.Underlying(arg0.typ)
+		if ptr, isPtr := argt.(*tipe.Pointer); isPtr {
+			if arr, isArray := tipe.Underlying(ptr.Elem).(*tipe.Array); isArray {
+				argt = arr
+			}
+		}
+		switch t := argt.(type) {
+		case *tipe.Array:
+			// The length of an array is part of its type, so
+			// it is constant if evaluating the operand has no
+			// effects: no calls or channel receives.
+			if !hasCallOrRecv(e.Args[0]) {
+				p.mode = modeConst
+				p.val = constant.MakeInt64(t.Len)
+			}
 			return p
+		case *tipe.Slice, *tipe.Chan:
+			return p
+		case *tipe.Map, *tipe.Table:
+			// The len of a table is its number of rows.
+			if fn == tipe.Len {
+				return p
+			}
 		case tipe.Basic:
-			if t == tipe.String {
+			if (t == tipe.String || t == tipe.UntypedString) && fn == tipe.Len {
+				if arg0.mode == modeConst {
+					p.mode = modeConst
+					p.val = constant.MakeInt64(int64(len(constant.StringVal(arg0.val))))
+				}
 				return p
 			}
 		}
 		p.mode = modeInvalid
-		c.errorf("invalid argument %s (%s) for %s ", format.Expr(e.Args[0]), format.Type(arg0.typ), format.Type(p.typ))
+		c.errorf(e.Args[0], InvalidArgument, "invalid argument %s (%s) for %s", format.Expr(e.Args[0]), format.Type(arg0.typ), format.Expr(e.Func))
+		return p
+	case tipe.Cols:
+		p.typ = tipe.Int
+		if len(e.Args) != 1 {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "cols takes exactly 1 argument, got %d", len(e.Args))
+			return p
+		}
+		arg0 := c.expr(e.Args[0])
+		if arg0.mode == modeInvalid {
+			p.mode = modeInvalid
+			return p
+		}
+		if _, isTable := tipe.Underlying(arg0.typ).(*tipe.Table); !isTable {
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidArgument, "invalid argument %s (%s) for cols", format.Expr(e.Args[0]), format.Type(arg0.typ))
+		}
 		return p
 	case tipe.Make:
-		switch len(e.Args) {
-		case 3:
-			arg := c.expr(e.Args[2])
-			c.convert(&arg, tipe.Int)
-			if arg.mode == modeInvalid {
-				p.mode = modeInvalid
-				return p
-			}
-			fallthrough
-		case 2:
-			arg := c.expr(e.Args[1])
-			c.convert(&arg, tipe.Int)
-			if arg.mode == modeInvalid {
-				p.mode = modeInvalid
-				return p
-			}
-			fallthrough
-		case 1:
-		default:
+		if len(e.Args) == 0 {
 			p.mode = modeInvalid
-			c.errorf("make requires 1-3 arguments")
+			c.errorf(e, WrongArgCount, "not enough arguments to make")
 			return p
 		}
-
 		arg0 := c.exprType(e.Args[0])
-		if arg0 != nil {
-			switch t := arg0.(type) {
-			case *tipe.Slice, *tipe.Map, *tipe.Chan:
-				p.typ = t
+		if arg0 == nil {
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidArgument, "make argument must be a slice, map, or channel")
+			return p
+		}
+		min, max := 1, 2
+		switch tipe.Underlying(arg0).(type) {
+		case *tipe.Slice:
+			min, max = 2, 3
+		case *tipe.Map, *tipe.Chan:
+		default:
+			p.mode = modeInvalid
+			c.errorf(e.Args[0], InvalidArgument, "cannot make %s; type must be slice, map, or channel", format.Type(arg0))
+			return p
+		}
+		p.typ = arg0
+		if len(e.Args) < min {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "missing len argument to make(%s)", format.Type(arg0))
+			return p
+		}
+		if len(e.Args) > max {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "too many arguments to make(%s)", format.Type(arg0))
+			return p
+		}
+		var sizes []constant.Value
+		for _, arg := range e.Args[1:] {
+			v, ok := c.sizeArg(arg)
+			if !ok {
+				p.mode = modeInvalid
+				return p
 			}
+			sizes = append(sizes, v)
 		}
-		if p.typ == nil {
+		if len(sizes) == 2 && sizes[0] != nil && sizes[1] != nil && constant.Compare(sizes[0], gotoken.GTR, sizes[1]) {
 			p.mode = modeInvalid
-			c.errorf("make argument must be a slice, map, or channel")
+			c.errorf(e, InvalidArgument, "len larger than cap in make(%s)", format.Type(arg0))
 		}
 		return p
 	case tipe.New:
 		if len(e.Args) != 1 {
 			p.mode = modeInvalid
-			c.errorf("new takes exactly one argument, got %d", len(e.Args))
+			c.errorf(e, WrongArgCount, "new takes exactly one argument, got %d", len(e.Args))
 			return p
 		}
 		arg0 := c.exprType(e.Args[0])
 		if arg0 == nil {
 			p.mode = modeInvalid
-			c.errorf("argument to new must be a type")
+			c.errorf(e.Args[0], NotAType, "argument to new must be a type")
 			return p
 		}
 		e.Args[0] = &expr.Type{Type: arg0}
@@ -1073,7 +2107,7 @@ func (c *Checker) exprBuiltinCall(e *expr.Call) partial {
 		p.typ = nil
 		if len(e.Args) != 1 {
 			p.mode = modeInvalid
-			c.errorf("panic takes exactly 1 argument, got %d", len(e.Args))
+			c.errorf(e, WrongArgCount, "panic takes exactly 1 argument, got %d", len(e.Args))
 			return p
 		}
 		if arg0 := c.expr(e.Args[0]); arg0.mode == modeInvalid {
@@ -1081,13 +2115,95 @@ func (c *Checker) exprBuiltinCall(e *expr.Call) partial {
 			return p
 		}
 		return p
+	case tipe.Print, tipe.Println, tipe.Printf:
+		name := format.Expr(e.Func)
+		args := e.Args
+		if p.typ == tipe.Printf {
+			if len(args) == 0 || e.Ellipsis && len(args) == 1 {
+				p.mode = modeInvalid
+				c.errorf(e, WrongArgCount, "too few arguments to %s", name)
+				return p
+			}
+			argp := c.expr(args[0])
+			if !c.builtinArg(name, args[0], &argp, tipe.String) {
+				p.mode = modeInvalid
+			}
+			args = args[1:]
+		}
+		p.typ = nil
+		for i, arg := range args {
+			var t tipe.Type = &tipe.Interface{}
+			if e.Ellipsis && i == len(args)-1 {
+				t = &tipe.Slice{Elem: t}
+			}
+			argp := c.expr(arg)
+			if !c.builtinArg(name, arg, &argp, t) {
+				p.mode = modeInvalid
+			}
+		}
+		return p
 	case tipe.Recover:
+		p.typ = &tipe.Interface{}
+		if len(e.Args) != 0 {
+			p.mode = modeInvalid
+			c.errorf(e, WrongArgCount, "recover takes no arguments, got %d", len(e.Args))
+		}
+		return p
 	default:
 		panic(fmt.Sprintf("unknown builtin: %s", p.typ))
 	}
 	panic("TODO builtin")
 }
 
+// builtinArg checks that p, the argument e to the builtin name,
+// can be used as a value of type t.
+func (c *Checker) builtinArg(name string, e expr.Expr, p *partial, t tipe.Type) bool {
+	if p.mode == modeInvalid {
+		return false
+	}
+	if p.typ == nil {
+		c.errorf(e, NoValue, "%s (no value) used as value", format.Expr(e))
+		return false
+	}
+	if isUntyped(p.typ) {
+		c.assign(p, t)
+		return p.mode != modeInvalid
+	}
+	if !c.assignable(t, p.typ) {
+		c.errorf(e, InvalidArgument, "cannot use %s (type %s) as type %s in argument to %s", format.Expr(e), format.Type(p.typ), format.Type(t), name)
+		return false
+	}
+	return true
+}
+
+// sizeArg checks e, a size argument to make, which must be of
+// integer type or an untyped constant representable as an int.
+// It returns the value of a constant size, or nil.
+func (c *Checker) sizeArg(e expr.Expr) (constant.Value, bool) {
+	p := c.expr(e)
+	if p.mode == modeInvalid {
+		return nil, false
+	}
+	if !isInteger(p.typ) && !(isUntyped(p.typ) && p.mode == modeConst && isNumeric(p.typ)) {
+		c.errorf(e, InvalidArgument, "non-integer size argument %s (%s) to make", format.Expr(e), format.Type(p.typ))
+		return nil, false
+	}
+	if isUntyped(p.typ) {
+		c.convert(&p, tipe.Int)
+		if p.mode == modeInvalid {
+			return nil, false
+		}
+	}
+	if p.mode != modeConst {
+		return nil, true
+	}
+	if constant.Sign(p.val) < 0 {
+		c.errorf(e, InvalidArgument, "negative size argument %s to make", format.Expr(e))
+		return nil, false
+	}
+	return p.val, true
+}
+
 func (c *Checker) exprPartialCall(e *expr.Call) partial {
 	p := c.exprPartial(e.Func, hintElideErr)
 	switch p.mode {
@@ -1099,11 +2215,15 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 		// type conversion
 		if len(e.Args) == 0 {
 			p.mode = modeInvalid
-			c.errorf("type conversion to %s is missing an argument", format.Type(p.typ))
+			c.errorf(e, WrongArgCount, "type conversion to %s is missing an argument", format.Type(p.typ))
 			return p
 		} else if len(e.Args) != 1 {
 			p.mode = modeInvalid
-			c.errorf("type conversion to %s has too many arguments", format.Type(p.typ))
+			c.errorf(e, WrongArgCount, "type conversion to %s has too many arguments", format.Type(p.typ))
+			return p
+		} else if e.Ellipsis {
+			p.mode = modeInvalid
+			c.errorf(e, InvalidConversion, "invalid use of ... in type conversion to %s", format.Type(p.typ))
 			return p
 		}
 		t := p.typ
@@ -1111,7 +2231,19 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 		if p.mode == modeInvalid {
 			return p
 		}
-		c.convert(&p, t)
+		if isString(t) && isInteger(p.typ) {
+			// string(x) is the UTF-8 encoding of the rune x.
+			if p.mode == modeConst {
+				s := string(utf8.RuneError)
+				if i, ok := constant.Int64Val(p.val); ok && 0 <= i && i <= utf8.MaxRune && utf8.ValidRune(rune(i)) {
+					s = string(rune(i))
+				}
+				p.val = constant.MakeString(s)
+			}
+			p.typ = t
+		} else {
+			c.convert(&p, t)
+		}
 		p.expr = e
 		return p
 	case modeVar, modeFunc:
@@ -1124,7 +2256,12 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 
 	p.mode = modeVar
 	p.expr = e
-	funct := p.typ.(*tipe.Func)
+	funct, isFunc := tipe.Underlying(p.typ).(*tipe.Func)
+	if !isFunc {
+		p.mode = modeInvalid
+		c.errorf(e.Func, NotAFunction, "cannot call non-function %s (type %s)", format.Expr(e.Func), format.Type(p.typ))
+		return p
+	}
 	var params, results []tipe.Type
 	if funct.Params != nil {
 		params = funct.Params.Elems
@@ -1142,10 +2279,16 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 		p.typ = funct.Results
 	}
 
-	if funct.Variadic {
+	if e.Ellipsis && !funct.Variadic {
+		p.mode = modeInvalid
+		c.errorf(e, InvalidArgument, "invalid use of ... in call to non-variadic function %s", format.Expr(e.Func))
+		return p
+	}
+
+	if funct.Variadic && !e.Ellipsis {
 		if len(e.Args) < len(params)-1 {
 			p.mode = modeInvalid
-			c.errorf("too few arguments (%d) to variadic function %s", len(e.Args), format.Type(funct))
+			c.errorf(e, WrongArgCount, "too few arguments (%d) to variadic function %s", len(e.Args), format.Type(funct))
 			return p
 		}
 		for i := 0; i < len(params)-1; i++ {
@@ -1154,7 +2297,7 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 			c.convert(&argp, t)
 			if argp.mode == modeInvalid {
 				p.mode = modeInvalid
-				c.errorf("cannot use type %s as type %s in argument %d to function", format.Type(argp.typ), format.Type(t), i)
+				c.errorf(e.Args[i], InvalidArgument, "cannot use type %s as type %s in argument %d to function", format.Type(argp.typ), format.Type(t), i)
 				return p
 			}
 		}
@@ -1164,13 +2307,13 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 			argp := c.exprPartial(arg, hintNone)
 			if argp.mode == modeTypeExpr {
 				p.mode = modeInvalid
-				c.errorf("type %s is not an expression", format.Type(p.typ))
+				c.errorf(arg, NotAnExpr, "type %s is not an expression", format.Type(p.typ))
 				return p
 			}
 			c.convert(&argp, vart)
 			if argp.mode == modeInvalid {
 				p.mode = modeInvalid
-				c.errorf("cannot use type %s as type %s in variadic argument to function", format.Type(argp.typ), format.Type(vart))
+				c.errorf(arg, InvalidArgument, "cannot use type %s as type %s in variadic argument to function", format.Type(argp.typ), format.Type(vart))
 				return p
 			}
 		}
@@ -1179,17 +2322,28 @@ func (c *Checker) exprPartialCall(e *expr.Call) partial {
 
 	if len(e.Args) != len(params) {
 		p.mode = modeInvalid
-		c.errorf("wrong number of arguments (%d) to function %s", len(e.Args), format.Type(funct))
+		c.errorf(e, WrongArgCount, "wrong number of arguments (%d) to function %s", len(e.Args), format.Type(funct))
 		return p
 	}
 	for i, arg := range e.Args {
 		t := params[i]
 		argp := c.expr(arg)
 		//fmt.Printf("argp i=%d: %#+v (arg=%#+v)\n", i, argp, arg)
-		c.convert(&argp, t)
+		// Interface and table arguments are checked for
+		// assignability, so the error can say what is missing.
+		var explain bool
+		switch tipe.Underlying(t).(type) {
+		case *tipe.Interface, *tipe.Table:
+			explain = isTyped(argp.typ)
+		}
+		if explain && !c.assignable(t, argp.typ) {
+			argp.mode = modeInvalid
+		} else {
+			c.convert(&argp, t)
+		}
 		if argp.mode == modeInvalid {
 			p.mode = modeInvalid
-			c.errorf("cannot use type %s as type %s in argument to function", format.Type(argp.typ), format.Type(t))
+			c.errorf(arg, InvalidArgument, "cannot use type %s as type %s in argument to function%s", format.Type(argp.typ), format.Type(t), c.notImplemented(argp.typ, t))
 			break
 		}
 	}
@@ -1211,13 +2365,13 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 	case *expr.Ident:
 		if e.Name == "_" {
 			p.mode = modeInvalid
-			c.errorf("cannot use _ as a value")
+			c.errorf(e, InvalidBlank, "cannot use _ as a value")
 			return p
 		}
 		obj := c.cur.LookupRec(e.Name)
 		if obj == nil {
 			p.mode = modeInvalid
-			c.errorf("undeclared identifier: %s", e.Name)
+			c.errorf(e, UndeclaredName, "undeclared identifier: %s", e.Name)
 			return p
 		}
 		c.Defs[e] = obj // TODO Defs is more than definitions? rename?
@@ -1231,6 +2385,14 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			if v, ok := obj.Decl.(constant.Value); ok {
 				p.val = v
 			}
+			if obj == Universe.Objs["iota"] {
+				if c.iota == nil {
+					p.mode = modeInvalid
+					c.errorf(e, InvalidIota, "cannot use iota outside constant declaration")
+					return p
+				}
+				p.val = c.iota
+			}
 		case ObjType:
 			p.mode = modeTypeExpr
 		}
@@ -1250,11 +2412,15 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		case string:
 			p.mode = modeConst
 			p.typ = tipe.UntypedString
-			p.val = constant.MakeFromLiteral(v, gotoken.STRING, 0)
+			p.val = constant.MakeString(v)
 		case rune:
 			p.mode = modeConst
 			p.typ = tipe.UntypedRune
-			p.val = constant.MakeFromLiteral(string(v), gotoken.CHAR, 0)
+			p.val = constant.MakeInt64(int64(v))
+		case expr.Imaginary:
+			p.mode = modeConst
+			p.typ = tipe.UntypedComplex
+			p.val = constant.MakeFromLiteral(v.Imag.Text('g', -1)+"i", gotoken.IMAG, 0)
 		case bool:
 			p.mode = modeConst
 			p.typ = tipe.UntypedBool
@@ -1264,8 +2430,11 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 	case *expr.FuncLiteral:
 		c.pushScope()
 		defer c.popScope()
+		labels := c.labels
+		c.labels = nil
+		defer func() { c.labels = labels }()
 		c.cur.foundInParent = make(map[string]bool)
-		c.cur.foundMdikInParent = make(map[*tipe.Methodik]bool)
+		c.cur.foundMdikInParent = make(map[*tipe.Named]bool)
 		if e.Type.Params != nil {
 			for i, t := range e.Type.Params.Elems {
 				t, _ = c.resolve(t)
@@ -1282,7 +2451,9 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				e.Type.Results.Elems[i], _ = c.resolve(t)
 			}
 		}
+		c.funcs++
 		c.stmt(e.Body.(*stmt.Block), e.Type.Results)
+		c.funcs--
 		for name := range c.cur.foundInParent {
 			e.Type.FreeVars = append(e.Type.FreeVars, name)
 		}
@@ -1294,7 +2465,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		return p
 	case *expr.CompLiteral:
 		p.mode = modeVar
-		structName := fmt.Sprintf("%s", e.Type)
+		structName := format.Type(e.Type)
 		if t, resolved := c.resolve(e.Type); resolved {
 			e.Type = t
 			p.typ = t
@@ -1304,7 +2475,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		}
 		t, isStruct := tipe.Underlying(e.Type).(*tipe.Struct)
 		if !isStruct {
-			c.errorf("cannot construct type %s with a composite literal", format.Type(e.Type))
+			c.errorf(e, InvalidCompLit, "cannot construct type %s with a composite literal", format.Type(e.Type))
 			p.mode = modeInvalid
 			return p
 		}
@@ -1321,7 +2492,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				return p
 			}
 			if len(e.Elements) != len(t.Fields) {
-				c.errorf("wrong number of elements, %d, when %s expects %d", len(e.Elements), structName, len(t.Fields))
+				c.errorf(e, InvalidCompLit, "wrong number of elements, %d, when %s expects %d", len(e.Elements), structName, len(t.Fields))
 				p.mode = modeInvalid
 				return p
 			}
@@ -1333,11 +2504,25 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				}
 			}
 		} else {
+			fields := make(map[string]bool)
+			for _, name := range t.FieldNames {
+				fields[name] = true
+			}
 			namedp := make(map[string]partial)
 			for i, elemp := range elemsp {
 				ident, ok := e.Keys[i].(*expr.Ident)
 				if !ok {
-					c.errorf("invalid field name %s in struct initializer", e.Keys[i])
+					c.errorf(e.Keys[i], InvalidCompLit, "invalid field name %s in struct initializer", format.Expr(e.Keys[i]))
+					p.mode = modeInvalid
+					return p
+				}
+				if !fields[ident.Name] {
+					c.errorf(e.Keys[i], InvalidCompLit, "unknown field %s in struct literal of type %s", ident.Name, structName)
+					p.mode = modeInvalid
+					return p
+				}
+				if _, dup := namedp[ident.Name]; dup {
+					c.errorf(e.Keys[i], InvalidCompLit, "duplicate field name %s in struct literal", ident.Name)
 					p.mode = modeInvalid
 					return p
 				}
@@ -1372,7 +2557,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		}
 		t, isMap := tipe.Underlying(e.Type).(*tipe.Map)
 		if !isMap {
-			c.errorf("cannot construct type %s with a map composite literal", format.Type(e.Type))
+			c.errorf(e, InvalidCompLit, "cannot construct type %s with a map composite literal", format.Type(e.Type))
 			p.mode = modeInvalid
 			return p
 		}
@@ -1382,19 +2567,53 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				p.mode = modeInvalid
 				return p
 			}
-			c.assign(&kp, t.Key)
-			if kp.mode == modeInvalid {
+			c.assign(&kp, t.Key)
+			if kp.mode == modeInvalid {
+				p.mode = modeInvalid
+				return p
+			}
+		}
+		for _, v := range e.Values {
+			vp := c.expr(v)
+			if vp.mode == modeInvalid {
+				p.mode = modeInvalid
+				return p
+			}
+			c.assign(&vp, t.Value)
+			if vp.mode == modeInvalid {
 				p.mode = modeInvalid
 				return p
 			}
 		}
-		for _, v := range e.Values {
+		p.expr = e
+		return p
+
+	case *expr.ArrayLiteral:
+		p.mode = modeVar
+		if e.Type.Ellipsis {
+			// [...]T{...} has the length of its elements.
+			e.Type = &tipe.Array{Len: int64(len(e.Elems)), Elem: e.Type.Elem}
+		}
+		t, resolved := c.resolve(e.Type)
+		if !resolved {
+			p.mode = modeInvalid
+			return p
+		}
+		arrayType := t.(*tipe.Array)
+		e.Type = arrayType
+		p.typ = arrayType
+		if int64(len(e.Elems)) > arrayType.Len {
+			c.errorf(e, InvalidIndex, "array index %d out of bounds [0:%d]", arrayType.Len, arrayType.Len)
+			p.mode = modeInvalid
+			return p
+		}
+		for _, v := range e.Elems {
 			vp := c.expr(v)
 			if vp.mode == modeInvalid {
 				p.mode = modeInvalid
 				return p
 			}
-			c.assign(&vp, t.Value)
+			c.assign(&vp, arrayType.Elem)
 			if vp.mode == modeInvalid {
 				p.mode = modeInvalid
 				return p
@@ -1402,14 +2621,13 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		}
 		p.expr = e
 		return p
-
 	case *expr.SliceLiteral:
 		p.mode = modeVar
 		var sliceType *tipe.Slice
 		if t, resolved := c.resolve(e.Type); resolved {
 			t, isSlice := t.(*tipe.Slice)
 			if !isSlice {
-				c.errorf("type %s is not a slice", format.Type(t))
+				c.errorf(e, InvalidSlice, "type %s is not a slice", format.Type(t))
 				p.mode = modeInvalid
 				return p
 			}
@@ -1443,7 +2661,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		if t, resolved := c.resolve(e.Type); resolved {
 			t, isTable := t.(*tipe.Table)
 			if !isTable {
-				c.errorf("type %s is not a table", format.Type(t))
+				c.errorf(e, InvalidSlice, "type %s is not a table", format.Type(t))
 				p.mode = modeInvalid
 				return p
 			}
@@ -1455,6 +2673,11 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			return p
 		}
 
+		// Constant column names give the literal a schema.
+		var schema *tipe.TableSchema
+		if len(e.ColNames) > 0 {
+			schema = &tipe.TableSchema{}
+		}
 		for _, colNameExpr := range e.ColNames {
 			colp := c.expr(colNameExpr)
 			c.assign(&colp, tipe.String)
@@ -1462,6 +2685,29 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				p.mode = modeInvalid
 				return p
 			}
+			if colp.mode != modeConst {
+				schema = nil
+			} else if schema != nil {
+				name := constant.StringVal(colp.val)
+				if schema.Column(name) != nil {
+					c.errorf(colNameExpr, InvalidTableSchema, "duplicate column %q in table literal", name)
+					p.mode = modeInvalid
+					return p
+				}
+				schema.Columns = append(schema.Columns, tipe.Column{Name: name})
+			}
+		}
+		tableType := p.typ.(*tipe.Table)
+		if want := tableType.Schema; want != nil {
+			if len(e.ColNames) == 0 {
+				schema = want
+			} else if schema != nil && !tipe.Equal(tableType, &tipe.Table{Type: elemType, Schema: schema}) {
+				c.errorf(e, InvalidTableSchema, "table literal columns %s do not match %s", format.Type(&tipe.Table{Type: elemType, Schema: schema}), format.Type(tableType))
+				p.mode = modeInvalid
+				return p
+			}
+		} else if len(e.ColNames) > 0 && schema != nil {
+			p.typ = &tipe.Table{Type: elemType, Schema: schema}
 		}
 		if len(e.Rows) == 0 {
 			return p
@@ -1470,19 +2716,28 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		// Check everyone agrees on the width.
 		w := len(e.Rows[0])
 		if len(e.ColNames) > 0 && len(e.ColNames) != w {
-			c.errorf("table literal has %d column names but a width of %d", len(e.ColNames), w)
+			c.errorf(e, InvalidCompLit, "table literal has %d column names but a width of %d", len(e.ColNames), w)
+			p.mode = modeInvalid
+			return p
+		}
+		if schema != nil && len(schema.Columns) != w {
+			c.errorf(e, InvalidCompLit, "table literal has %d columns but a width of %d", len(schema.Columns), w)
 			p.mode = modeInvalid
 			return p
 		}
 		for _, r := range e.Rows {
 			if len(r) != w {
-				c.errorf("table literal has rows of different lengths (%d and %d)", w, len(r))
+				c.errorf(e, InvalidCompLit, "table literal has rows of different lengths (%d and %d)", w, len(r))
 				p.mode = modeInvalid
 				return p
 			}
-			for _, elem := range r {
+			for i, elem := range r {
+				t := elemType
+				if schema != nil {
+					t = tableType.ColumnType(&schema.Columns[i])
+				}
 				elemp := c.expr(elem)
-				c.assign(&elemp, elemType)
+				c.assign(&elemp, t)
 				if elemp.mode == modeInvalid {
 					p.mode = modeInvalid
 					return p
@@ -1507,12 +2762,43 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			sub := c.exprPartial(e.Expr, hintElideErr)
 			p.mode = sub.mode
 			p.typ = sub.typ
+			if p.mode == modeConst {
+				if e.Op == token.LeftParen {
+					p.val = sub.val
+				} else {
+					p.val = constant.UnaryOp(convGoOp(e.Op), sub.val, 0)
+					c.checkOverflow(&p)
+				}
+			}
+			return p
+		case token.Xor:
+			sub := c.exprPartial(e.Expr, hintElideErr)
+			if sub.mode == modeInvalid {
+				return sub
+			}
+			if !isInteger(sub.typ) {
+				c.errorf(e.Expr, UndefinedOp, "invalid operation: operator ^ not defined on %s (%s)", format.Expr(e.Expr), format.Type(sub.typ))
+				p.mode = modeInvalid
+				return p
+			}
+			p.mode = sub.mode
+			p.typ = sub.typ
+			if p.mode == modeConst {
+				p.val = constant.UnaryOp(gotoken.XOR, sub.val, unsignedBits(p.typ))
+			}
 			return p
 		case token.Ref:
 			sub := c.expr(e.Expr)
 			if sub.mode == modeInvalid {
 				return p
 			}
+			if !isCompLiteral(e.Expr) && !c.addressable(e.Expr) {
+				c.errorf(e.Expr, Unaddressable, "cannot take the address of %s", format.Expr(e.Expr))
+				return p
+			}
+			if !c.writable(e.Expr) {
+				return p
+			}
 			p.mode = modeVar
 			p.typ = &tipe.Pointer{Elem: sub.typ}
 			if goElem := c.GoEquiv[sub.typ]; goElem != nil {
@@ -1531,7 +2817,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				p.typ = t.Elem
 				return p
 			}
-			c.errorf("invalid dereference of %s", e.Expr)
+			c.errorf(e.Expr, UndefinedOp, "invalid indirect of %s (type %s)", format.Expr(e.Expr), format.Type(sub.typ))
 			p.mode = modeInvalid
 			return p
 		case token.ChanOp:
@@ -1540,9 +2826,14 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				p.mode = modeInvalid
 				return p
 			}
-			t, ok := sub.typ.(*tipe.Chan)
+			t, ok := tipe.Underlying(sub.typ).(*tipe.Chan)
 			if !ok {
-				c.errorf("receive from non-chan type %s", format.Type(sub.typ))
+				c.errorf(e.Expr, InvalidChanOp, "receive from non-chan type %s", format.Type(sub.typ))
+				p.mode = modeInvalid
+				return p
+			}
+			if t.Direction == tipe.ChanSend {
+				c.errorf(e, InvalidChanOp, "invalid operation: %s (receive from send-only type %s)", format.Expr(e), format.Type(sub.typ))
 				p.mode = modeInvalid
 				return p
 			}
@@ -1560,8 +2851,30 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			return right
 		}
 		ltOrig, rtOrig := left.typ, right.typ
+		var operandOk func(tipe.Type) bool
+		switch e.Op {
+		case token.Pow:
+			operandOk = isNumeric
+		case token.Rem, token.And, token.Or, token.Xor, token.AndNot:
+			operandOk = isInteger
+		case token.ShiftLeft, token.ShiftRight:
+			return c.exprShift(e, left, right)
+		}
+		if operandOk != nil && (!operandOk(ltOrig) || !operandOk(rtOrig)) {
+			x, t := e.Left, ltOrig
+			if operandOk(ltOrig) {
+				x, t = e.Right, rtOrig
+			}
+			c.errorf(x, UndefinedOp, "invalid operation: operator %s not defined on %s (%s)", e.Op, format.Expr(x), format.Type(t))
+			left.mode = modeInvalid
+			return left
+		}
 		c.constrainUntyped(&left, right.typ)
 		c.constrainUntyped(&right, left.typ)
+		if left.mode == modeInvalid || right.mode == modeInvalid {
+			left.mode = modeInvalid
+			return left
+		}
 		left.expr = e
 
 		switch e.Op {
@@ -1569,46 +2882,74 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			// comparison
 			lt, rt := left.typ, right.typ
 			if !c.assignable(lt, rt) && !c.assignable(rt, lt) {
-				c.errorf("incomparable types %s and %s", format.Type(lt), format.Type(rt))
+				c.errorf(e, MismatchedTypes, "incomparable types %s and %s", format.Type(lt), format.Type(rt))
 				left.mode = modeInvalid
 				return left
 			}
 			switch e.Op {
 			case token.Equal, token.NotEqual:
-				if !isComparable(lt) {
+				if !tipe.Comparable(lt) {
 					if canBeNil(lt) || canBeNil(rt) {
 						if ltOrig != tipe.UntypedNil && rtOrig != tipe.UntypedNil {
-							c.errorf("type %s only comparable to nil", format.Type(lt))
+							c.errorf(e, UndefinedOp, "type %s only comparable to nil", format.Type(lt))
 							left.mode = modeInvalid
 							return left
 						}
 					} else {
-						c.errorf("incomparable type %s", format.Type(lt))
+						c.errorf(e, UndefinedOp, "incomparable type %s", format.Type(lt))
 						left.mode = modeInvalid
 						return left
 					}
 				}
 			case token.LessEqual, token.GreaterEqual, token.Less, token.Greater:
 				if !isOrdered(lt) {
-					c.errorf("unordered type %s", format.Type(lt))
+					c.errorf(e, UndefinedOp, "unordered type %s", format.Type(lt))
 					left.mode = modeInvalid
 					return left
 				}
 			}
 			left.typ = tipe.Bool
+			if left.mode == modeConst && right.mode == modeConst {
+				left.val = constant.MakeBool(constant.Compare(left.val, convGoOp(e.Op), right.val))
+			} else {
+				left.mode = modeVar
+			}
 			return left
 		}
 
-		// TODO check for division by zero
+		if e.Op == token.Pow {
+			if left.mode == modeConst && right.mode == modeConst {
+				v, err := constPow(left.val, right.val, isInteger(left.typ))
+				if err != nil {
+					c.errorf(e, ConstOverflow, "%v", err)
+					left.mode = modeInvalid
+					return left
+				}
+				left.val = v
+				return left
+			}
+		}
+
+		if (e.Op == token.Div || e.Op == token.Rem) && right.mode == modeConst && constant.Sign(right.val) == 0 {
+			c.errorf(e.Right, DivByZero, "invalid operation: division by zero")
+			left.mode = modeInvalid
+			return left
+		}
 		if left.mode == modeConst && right.mode == modeConst {
-			left.val = constant.BinaryOp(left.val, convGoOp(e.Op), right.val)
-			// TODO check rounding
-			// TODO check for comparison, result is untyped bool
+			op := convGoOp(e.Op)
+			if op == gotoken.QUO && isInteger(left.typ) && isInteger(right.typ) {
+				op = gotoken.QUO_ASSIGN // integer division
+			}
+			left.val = constant.BinaryOp(left.val, op, right.val)
+			c.checkOverflow(&left)
 			return left
 		}
+		if left.mode == modeConst {
+			left.mode = modeVar
+		}
 
 		if !tipe.Equal(left.typ, right.typ) {
-			c.errorf("inoperable types %s and %s", format.Type(left.typ), format.Type(right.typ))
+			c.errorf(e, MismatchedTypes, "inoperable types %s and %s", format.Type(left.typ), format.Type(right.typ))
 			left.mode = modeInvalid
 			return left
 		}
@@ -1617,9 +2958,13 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		p := c.exprPartialCall(e)
 		if tuple, isTuple := p.typ.(*tipe.Tuple); isTuple && hint == hintElideErr {
 			if IsError(tuple.Elems[len(tuple.Elems)-1]) {
-				tuple.Elems = tuple.Elems[:len(tuple.Elems)-1]
-				if len(tuple.Elems) == 1 {
-					p.typ = tuple.Elems[0]
+				// The tuple may be the results of a function
+				// type, so it is not changed.
+				elems := tuple.Elems[:len(tuple.Elems)-1]
+				if len(elems) == 1 {
+					p.typ = elems[0]
+				} else {
+					p.typ = &tipe.Tuple{Elems: elems}
 				}
 				e.ElideError = true
 			}
@@ -1640,10 +2985,26 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				return
 			}
 		}
+		if mdik, ok := tipe.Unalias(left.typ).(*tipe.Named); ok {
+			// x.m() is shorthand for (&x).m() when x is addressable.
+			for i, name := range mdik.MethodNames {
+				if name != right || !mdik.PointerReceiver(i) {
+					continue
+				}
+				if !c.addressable(e.Left) {
+					p.mode = modeInvalid
+					c.errorf(e, PointerMethod, "cannot call pointer method %s on %s", right, format.Type(left.typ))
+					return p
+				}
+				p.mode = modeVar
+				p.typ = mdik.Methods[i]
+				return p
+			}
+		}
 
 		lt := tipe.Underlying(left.typ)
 		if t, isPtr := lt.(*tipe.Pointer); isPtr {
-			lt = t.Elem
+			lt = tipe.Underlying(t.Elem)
 		}
 		switch lt := lt.(type) {
 		case *tipe.Struct:
@@ -1655,16 +3016,23 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				}
 			}
 			p.mode = modeInvalid
-			c.errorf("%s undefined (type %s has no field or method %s)", e, format.Type(lt), right)
+			c.errorf(e, MissingFieldOrMethod, "%s undefined (type %s has no field or method %s)", format.Expr(e), format.Type(lt), right)
 			return p
 		case *tipe.Package:
 			for name, t := range lt.Exports {
 				if name == e.Right.Name {
 					p.typ = t
+					if sc := c.goSrcScopes[lt]; sc != nil {
+						if obj := sc.Objs[name]; obj.Kind == ObjConst {
+							p.mode = modeConst
+							p.val, _ = obj.Decl.(constant.Value)
+							return p
+						}
+					}
 					if lt.GoPkg != nil {
 						s := lt.GoPkg.(*gotypes.Package).Scope()
 						obj := s.Lookup(name)
-						if _, isAType := obj.Type().(*gotypes.Named); isAType {
+						if _, isAType := obj.(*gotypes.TypeName); isAType {
 							p.mode = modeTypeExpr
 							return p
 						}
@@ -1674,23 +3042,51 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				}
 			}
 			p.mode = modeInvalid
-			c.errorf("%s not in package %s", e, lt)
+			c.errorf(e, UndefinedPkg, "%s not in package %s", format.Expr(e), lt)
 			return p
 		}
 		p.mode = modeInvalid
-		c.errorf("%s undefined (type %s is not a struct or package)", e, format.Type(left.typ))
+		c.errorf(e, MissingFieldOrMethod, "%s undefined (type %s is not a struct or package)", format.Expr(e), format.Type(left.typ))
 		return p
 	case *expr.Index:
 		left := c.expr(e.Left)
 		if left.mode == modeInvalid {
 			return left
 		}
+		if left.typ == tipe.UntypedString {
+			c.constrainUntyped(&left, tipe.String)
+		}
 		lt := tipe.Underlying(left.typ)
+		if len(e.Indicies) == 1 {
+			if s, isSlice := e.Indicies[0].(*expr.Slice); isSlice {
+				return c.exprSlice(e, s, left)
+			}
+		}
 		switch lt := lt.(type) {
+		case tipe.Basic:
+			if lt != tipe.String {
+				break
+			}
+			if len(e.Indicies) != 1 {
+				p.mode = modeInvalid
+				c.errorf(e, InvalidSlice, "cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
+				return p
+			}
+			ind := c.expr(e.Indicies[0])
+			if ind.mode == modeInvalid {
+				return ind
+			}
+			c.assign(&ind, tipe.Int)
+			if ind.mode == modeInvalid {
+				return ind
+			}
+			p.mode = modeValue
+			p.typ = tipe.Uint8
+			return p
 		case *tipe.Map:
 			if len(e.Indicies) != 1 {
 				p.mode = modeInvalid
-				c.errorf("cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
+				c.errorf(e, InvalidSlice, "cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
 				return p
 			}
 			ind := c.expr(e.Indicies[0])
@@ -1707,7 +3103,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		case *tipe.Array:
 			if len(e.Indicies) != 1 {
 				p.mode = modeInvalid
-				c.errorf("cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
+				c.errorf(e, InvalidSlice, "cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
 				return p
 			}
 			ind := c.expr(e.Indicies[0])
@@ -1718,38 +3114,17 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			if ind.mode == modeInvalid {
 				return ind
 			}
+			if !c.checkIndex(ind, "array", lt.Len, lt.Len) {
+				p.mode = modeInvalid
+				return p
+			}
 			p.mode = modeVar
 			p.typ = lt.Elem
 			return p
 		case *tipe.Slice:
 			if len(e.Indicies) != 1 {
 				p.mode = modeInvalid
-				c.errorf("cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
-				return p
-			}
-			if s, isSlice := e.Indicies[0].(*expr.Slice); isSlice {
-				p.mode = modeVar
-				p.typ = left.typ
-				ints := func(exprs ...expr.Expr) (p partial) {
-					for _, e := range exprs {
-						if e == nil {
-							continue
-						}
-						p := c.expr(e)
-						if p.mode == modeInvalid {
-							return p
-						}
-						c.convert(&p, tipe.Int)
-						if p.mode == modeInvalid {
-							return p
-						}
-					}
-					p.mode = modeVar
-					return p
-				}
-				if p := ints(s.Low, s.High, s.Max); p.mode == modeInvalid {
-					return p
-				}
+				c.errorf(e, InvalidSlice, "cannot table slice %s (type %s)", e.Left, format.Type(left.typ))
 				return p
 			}
 			ind := c.expr(e.Indicies[0])
@@ -1760,12 +3135,16 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 			if ind.mode == modeInvalid {
 				return ind
 			}
+			if !c.checkIndex(ind, "slice", 0, -1) {
+				p.mode = modeInvalid
+				return p
+			}
 			p.mode = modeVar
 			p.typ = lt.Elem
 			return p
 		case *tipe.Table:
 			p.mode = modeInvalid
-			c.errorf("TODO table slicing support")
+			c.errorf(e, Unsupported, "TODO table slicing support")
 			return p
 		}
 		if atTyp := c.memory.Method(lt, "At"); atTyp != nil {
@@ -1777,7 +3156,7 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 				atTyp.Params.Elems[0] != tipe.Int || (dim == 2 && atTyp.Params.Elems[1] != tipe.Int) ||
 				len(atTyp.Results.Elems) != 1 {
 				p.mode = modeInvalid
-				c.errorf("cannot slice type %s, expecting method %q but type has %q", left.typ, want, format.Type(atTyp))
+				c.errorf(e, InvalidSlice, "cannot slice type %s, expecting method %q but type has %q", left.typ, want, format.Type(atTyp))
 				return p
 			}
 			p.mode = modeVar
@@ -1786,11 +3165,37 @@ func (c *Checker) exprPartial(e expr.Expr, hint typeHint) (p partial) {
 		}
 		if setTyp := c.memory.Method(lt, "Set"); setTyp != nil {
 			p.mode = modeInvalid
-			c.errorf("TODO Set index")
+			c.errorf(e, Unsupported, "TODO Set index")
 			return p
 		}
 
 		panic(fmt.Sprintf("typecheck.expr TODO Index: %s, %s", format.Debug(e))) //, format.Debug(tipe.Underlying(left.typ))))
+	case *expr.TypeAssert:
+		p.mode = modeInvalid
+		if e.Type == nil {
+			c.errorf(e, NonInterface, "use of .(type) outside type switch")
+			return p
+		}
+		left := c.expr(e.Expr)
+		if left.mode == modeInvalid {
+			return p
+		}
+		if _, isIface := tipe.Underlying(left.typ).(*tipe.Interface); !isIface {
+			c.errorf(e.Expr, NonInterface, "invalid type assertion: %s (non-interface type %s on left)", format.Expr(e.Expr), format.Type(left.typ))
+			return p
+		}
+		t, resolved := c.resolve(e.Type)
+		if !resolved {
+			return p
+		}
+		e.Type = t
+		if _, isIface := tipe.Underlying(t).(*tipe.Interface); !isIface && !c.assignable(left.typ, t) {
+			c.errorf(e, ImpossibleAssert, "impossible type assertion: %s does not implement %s", format.Type(t), format.Type(left.typ))
+			return p
+		}
+		p.mode = modeVar
+		p.typ = t
+		return p
 	case *expr.Shell:
 		p.mode = modeVar
 		if hint == hintElideErr {
@@ -1811,15 +3216,75 @@ func (c *Checker) assign(p *partial, t tipe.Type) {
 		return
 	}
 	if isUntyped(p.typ) {
+		if iface, isIface := tipe.Underlying(t).(*tipe.Interface); isIface && p.typ != tipe.UntypedNil {
+			// The constant becomes a value of its default
+			// type, which has no methods.
+			if dt := defaultType(p.typ); !c.memory.Implements(dt, iface) {
+				c.errorf(p.expr, Unassignable, "cannot assign %s to %s: %s", format.Type(dt), format.Type(t), c.missingMethod(dt, iface))
+				p.mode = modeInvalid
+				return
+			}
+		}
 		c.constrainUntyped(p, t)
 		return
 	}
-	if !tipe.Equal(p.typ, t) { // TODO interfaces, etc
-		c.errorf("cannot assign %s to %s", format.Type(p.typ), format.Type(t))
+	if !c.assignable(t, p.typ) {
+		c.errorf(p.expr, Unassignable, "cannot assign %s to %s%s", format.Type(p.typ), format.Type(t), c.notImplemented(p.typ, t))
 		p.mode = modeInvalid
 	}
 }
 
+// notImplemented returns ": " and the reason src does not implement
+// dst if dst is an interface, or lacks a column of dst if dst is a
+// table, and "" otherwise. It completes an error message about a
+// failed assignment of src to dst.
+func (c *Checker) notImplemented(src, dst tipe.Type) string {
+	if dstT, ok := tipe.Underlying(dst).(*tipe.Table); ok {
+		srcT, ok := tipe.Underlying(src).(*tipe.Table)
+		if !ok || !tipe.Equal(srcT.Type, dstT.Type) {
+			return ""
+		}
+		if col := tipe.MissingColumn(dstT, srcT); col != nil {
+			if srcT.Schema.Column(col.Name) != nil {
+				return fmt.Sprintf(": column %q has the wrong type", col.Name)
+			}
+			return fmt.Sprintf(": missing column %q", col.Name)
+		}
+		return ""
+	}
+	iface, isIface := tipe.Underlying(dst).(*tipe.Interface)
+	if !isIface || isUntyped(src) {
+		return ""
+	}
+	return ": " + c.missingMethod(src, iface)
+}
+
+// missingMethod explains why t does not implement iface.
+func (c *Checker) missingMethod(t tipe.Type, iface *tipe.Interface) string {
+	name, have := c.memory.MissingMethod(t, iface)
+	switch {
+	case have != nil:
+		return fmt.Sprintf("%s does not implement interface (wrong type for %s method)\n\t\thave %s\n\t\twant %s",
+			format.Type(t), name, methodSig(name, have), methodSig(name, iface.Methods[name]))
+	case name == "":
+		return fmt.Sprintf("%s does not implement interface", format.Type(t))
+	}
+	if mdik, ok := tipe.Unalias(t).(*tipe.Named); ok {
+		for i, n := range mdik.MethodNames {
+			if n == name && mdik.PointerReceiver(i) {
+				return fmt.Sprintf("%s does not implement interface (%s method has pointer receiver)", format.Type(t), name)
+			}
+		}
+	}
+	return fmt.Sprintf("%s does not implement interface (missing %s method)", format.Type(t), name)
+}
+
+// methodSig formats the method name of type fn as it is declared,
+// for example "Read([]byte) (int, error)".
+func methodSig(name string, fn *tipe.Func) string {
+	return name + strings.TrimPrefix(format.Type(fn), "func")
+}
+
 func (c *Checker) convert(p *partial, t tipe.Type) {
 	//fmt.Printf("Checker.convert(p=%#+v, t=%s)\n", p, t)
 	_, tIsConst := t.(tipe.Basic)
@@ -1827,14 +3292,14 @@ func (c *Checker) convert(p *partial, t tipe.Type) {
 		// TODO or integer -> string conversion
 		if round(p.val, t.(tipe.Basic)) == nil {
 			// p.val does not fit in t
-			c.errorf("constant %s does not fit in %s", p.val, format.Type(t))
+			c.errorf(p.expr, ConstOverflow, "constant %s does not fit in %s", p.val, format.Type(t))
 			p.mode = modeInvalid
 			return
 		}
 	}
 
 	if !c.convertible(t, p.typ) {
-		c.errorf("cannot convert %s to %s", format.Type(p.typ), format.Type(t))
+		c.errorf(p.expr, InvalidConversion, "cannot convert %s to %s", format.Type(p.typ), format.Type(t))
 		p.mode = modeInvalid
 		return
 	}
@@ -1860,32 +3325,36 @@ func (c *Checker) assignable(dst, src tipe.Type) bool {
 	if src == tipe.UntypedString && tipe.Underlying(dst) == tipe.String {
 		return true
 	}
+	// a defined type is assignable to or from its underlying type
+	// literal, such as a struct{...}, but not another defined type
+	if !isNamed(dst) || !isNamed(src) {
+		if tipe.Equal(tipe.Underlying(dst), tipe.Underlying(src)) {
+			return true
+		}
+	}
 
 	if idst, ok := tipe.Underlying(dst).(*tipe.Interface); ok {
 		// Everything can be assigned to interface{}.
 		if len(idst.Methods) == 0 {
 			return true
 		}
-		srcNames, srcTypes := c.memory.Methods(src)
-		srcm := make(map[string]tipe.Type)
-		for i, name := range srcNames {
-			srcm[name] = srcTypes[i]
-		}
-		dstNames, dstTypes := c.memory.Methods(dst)
-		//panic(fmt.Sprintf("dst: %s, dstNames: %s, dstTypes: %s\n", dst, dstNames, dstTypes))
-		for i, name := range dstNames {
-			if !tipe.Equal(dstTypes[i], srcm[name]) {
-				//panic(fmt.Sprintf("assignable name=%s, dst=%s, srcm[name]=%s\n", name, pretty.Sprint(dstTypes[i]), pretty.Sprint(srcm[name])))
-				// TODO: report missing method?
-				return false
-			}
+		return c.memory.Implements(src, idst)
+	}
+
+	// a table with columns can be assigned to a table type that
+	// asks for some of them, as long as one of the types is not named
+	if srcT, ok := tipe.Underlying(src).(*tipe.Table); ok && srcT.Schema != nil {
+		if dstT, ok := tipe.Underlying(dst).(*tipe.Table); ok && (!isNamed(dst) || !isNamed(src)) {
+			return tipe.Equal(srcT.Type, dstT.Type) && tipe.MissingColumn(dstT, srcT) == nil
 		}
-		return true
 	}
 
-	// bidirectional channels can be assigned to directional channels
-	if srcCh, ok := src.(*tipe.Chan); ok && srcCh.Direction == tipe.ChanBoth {
-		if dstCh, ok := dst.(*tipe.Chan); ok {
+	// bidirectional channels can be assigned to directional channels,
+	// as long as one of the types is not named
+	if srcCh, ok := tipe.Underlying(src).(*tipe.Chan); ok && srcCh.Direction == tipe.ChanBoth {
+		_, srcNamed := src.(*tipe.Named)
+		_, dstNamed := dst.(*tipe.Named)
+		if dstCh, ok := tipe.Underlying(dst).(*tipe.Chan); ok && !(srcNamed && dstNamed) {
 			return tipe.Equal(srcCh.Elem, dstCh.Elem)
 		}
 	}
@@ -1893,6 +3362,15 @@ func (c *Checker) assignable(dst, src tipe.Type) bool {
 	return false
 }
 
+// isNamed reports whether t is a predeclared or defined type.
+func isNamed(t tipe.Type) bool {
+	switch tipe.Unalias(t).(type) {
+	case tipe.Basic, *tipe.Named:
+		return true
+	}
+	return false
+}
+
 func isString(t tipe.Type) bool {
 	t = tipe.Underlying(t)
 	return t == tipe.String || t == tipe.UntypedString
@@ -1905,20 +3383,27 @@ func (c *Checker) convertible(dst, src tipe.Type) bool {
 	if tipe.Equal(tipe.Underlying(dst), tipe.Underlying(src)) {
 		return true
 	}
-	// numerics can be converted to one another
+	// numerics can be converted to one another, except that only
+	// constants convert between complex and non-complex types
 	if tipe.IsNumeric(dst) && tipe.IsNumeric(src) {
-		return true
+		return isComplex(dst) == isComplex(src) || isUntyped(src)
 	}
 	dst, src = tipe.Unalias(dst), tipe.Unalias(src)
 	if dst, isSlice := dst.(*tipe.Slice); isSlice {
 		if tipe.Equal(dst.Elem, tipe.Uint8) && isString(src) {
 			return true
 		}
+		if tipe.Equal(dst.Elem, tipe.Int32) && isString(src) {
+			return true
+		}
 	}
 	if src, isSlice := src.(*tipe.Slice); isSlice {
 		if tipe.Equal(src.Elem, tipe.Uint8) && isString(dst) {
 			return true
 		}
+		if tipe.Equal(src.Elem, tipe.Int32) && isString(dst) {
+			return true
+		}
 	}
 
 	// TODO several other forms of "identical" types,
@@ -1934,25 +3419,37 @@ func (c *Checker) constrainUntyped(p *partial, t tipe.Type) {
 	// catch invalid constraints
 	if isUntyped(t) {
 		switch {
-		case t == tipe.UntypedFloat && p.typ == tipe.UntypedInteger:
-			// promote untyped int to float
-		case t == tipe.UntypedComplex && (p.typ == tipe.UntypedInteger || p.typ == tipe.UntypedFloat):
-			// promote untyped int or float to complex
+		case untypedRank(p.typ) > 0 && untypedRank(t) > 0:
+			if untypedRank(t) < untypedRank(p.typ) {
+				// The other operand is promoted to p.typ.
+				return
+			}
+			// promote untyped int to rune, float, or complex
 		case t == tipe.Num && (p.typ == tipe.UntypedInteger || p.typ == tipe.UntypedFloat):
 			// promote untyped int or float to num type parameter
 		case t != p.typ:
-			c.errorf("cannot convert %s to untyped %s", format.Type(p.typ), format.Type(t))
+			c.errorf(p.expr, MismatchedTypes, "mismatched types %s and %s", format.Type(p.typ), format.Type(t))
 		}
+	} else if p.typ == tipe.UntypedNil && !canBeNil(t) {
+		c.errorf(p.expr, InvalidConversion, "cannot convert nil to type %s", format.Type(t))
+		p.mode = modeInvalid
+		return
 	} else {
 		switch t := tipe.Unalias(t).(type) {
 		case tipe.Basic:
 			switch p.mode {
 			case modeConst:
-				p.val = round(p.val, t)
-				if p.val == nil {
-					c.errorf("cannot convert const %s to %s", format.Type(p.typ), format.Type(t))
-					// TODO more details about why
+				v := round(p.val, t)
+				switch {
+				case v != nil:
+				case isInteger(t) && isNumeric(p.typ) && constant.ToInt(p.val).Kind() != constant.Int:
+					c.errorf(p.expr, ConstOverflow, "constant %s truncated to integer", p.val)
+				case isInteger(t) && isNumeric(p.typ):
+					c.errorf(p.expr, ConstOverflow, "constant %s overflows %s", p.val, format.Type(t))
+				default:
+					c.errorf(p.expr, InvalidConversion, "cannot convert const %s to %s", format.Type(p.typ), format.Type(t))
 				}
+				p.val = v
 			case modeVar:
 				panic(fmt.Sprintf("TODO coerce var to basic: t=%s, p.typ=%s", t, format.Type(p.typ)))
 			}
@@ -1992,9 +3489,26 @@ func (c *Checker) constrainExprType(e expr.Expr, t tipe.Type) {
 	c.Types[e] = t
 }
 
-func (c *Checker) errorf(format string, args ...interface{}) {
-	err := fmt.Errorf(format, args...)
-	c.Errs = append(c.Errs, err)
+// errorf records an error at n, the expression or type at fault.
+// If n is nil or has no position, as a type made by the checker does
+// not, the error is at the statement being checked.
+func (c *Checker) errorf(n expr.Node, code Code, format string, args ...interface{}) {
+	pos := c.pos
+	if n != nil && n.Pos().IsValid() {
+		pos = n.Pos()
+	}
+	c.Errs = append(c.Errs, Error{
+		Pos:  c.Fset.Position(pos),
+		Code: code,
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+// typeNode returns t as a node if it was written in the source, so
+// an error about it is reported there.
+func typeNode(t tipe.Type) expr.Node {
+	n, _ := t.(expr.Node)
+	return n
 }
 
 func (c *Checker) pushScope() {
@@ -2019,13 +3533,36 @@ func convGoOp(op token.Token) gotoken.Token {
 		return gotoken.QUO // TODO: QUO_ASSIGN for int div
 	case token.Rem:
 		return gotoken.REM
-	case token.Pow:
-		panic("TODO token.Pow")
-		return gotoken.REM
 	case token.LogicalAnd:
 		return gotoken.LAND
 	case token.LogicalOr:
 		return gotoken.LOR
+	case token.Not:
+		return gotoken.NOT
+	case token.And:
+		return gotoken.AND
+	case token.Or:
+		return gotoken.OR
+	case token.Xor:
+		return gotoken.XOR
+	case token.AndNot:
+		return gotoken.AND_NOT
+	case token.ShiftLeft:
+		return gotoken.SHL
+	case token.ShiftRight:
+		return gotoken.SHR
+	case token.Equal:
+		return gotoken.EQL
+	case token.NotEqual:
+		return gotoken.NEQ
+	case token.Less:
+		return gotoken.LSS
+	case token.LessEqual:
+		return gotoken.LEQ
+	case token.Greater:
+		return gotoken.GTR
+	case token.GreaterEqual:
+		return gotoken.GEQ
 	default:
 		panic(fmt.Sprintf("typecheck: bad op: %s", op))
 	}
@@ -2051,6 +3588,8 @@ func round(v constant.Value, t tipe.Basic) constant.Value {
 			return v
 		case tipe.Float, tipe.UntypedFloat, tipe.UntypedComplex:
 			return v
+		case tipe.Complex64, tipe.Complex128:
+			return roundComplex(v, t)
 		case tipe.Num:
 			return v
 		case tipe.Int:
@@ -2131,7 +3670,7 @@ func round(v constant.Value, t tipe.Basic) constant.Value {
 			} else {
 				return nil
 			}
-		case tipe.Uint64:
+		case tipe.Uint64, tipe.Uintptr:
 			if _, ok := constant.Uint64Val(v); ok {
 				return v
 			} else {
@@ -2146,9 +3685,19 @@ func round(v constant.Value, t tipe.Basic) constant.Value {
 			return constant.MakeFloat64(float64(r))
 		}
 	case constant.Float:
+		if isInteger(t) {
+			// A float constant with an integer value
+			// can be used as an integer.
+			if i := constant.ToInt(v); i.Kind() == constant.Int {
+				return round(i, t)
+			}
+			return nil
+		}
 		switch t {
 		case tipe.Float, tipe.UntypedFloat, tipe.UntypedComplex:
 			return v
+		case tipe.Complex64, tipe.Complex128:
+			return roundComplex(v, t)
 		case tipe.Float32:
 			r, _ := constant.Float32Val(v)
 			return constant.MakeFloat64(float64(r))
@@ -2158,11 +3707,147 @@ func round(v constant.Value, t tipe.Basic) constant.Value {
 		case tipe.Num:
 			return v
 		}
+	case constant.Complex:
+		switch t {
+		case tipe.UntypedComplex, tipe.Num:
+			return v
+		case tipe.Complex64, tipe.Complex128:
+			return roundComplex(v, t)
+		}
+		if constant.Sign(constant.Imag(v)) == 0 {
+			// A complex constant with no imaginary
+			// part can be used as a real number.
+			return round(constant.Real(v), t)
+		}
 	}
 	// TODO many more comparisons
 	return nil
 }
 
+// roundComplex rounds v to the precision of the complex type t.
+func roundComplex(v constant.Value, t tipe.Basic) constant.Value {
+	var re, im float64
+	if t == tipe.Complex64 {
+		re32, _ := constant.Float32Val(constant.ToFloat(constant.Real(v)))
+		im32, _ := constant.Float32Val(constant.ToFloat(constant.Imag(v)))
+		re, im = float64(re32), float64(im32)
+	} else {
+		re, _ = constant.Float64Val(constant.ToFloat(constant.Real(v)))
+		im, _ = constant.Float64Val(constant.ToFloat(constant.Imag(v)))
+	}
+	return constant.BinaryOp(constant.MakeFloat64(re), gotoken.ADD, constant.MakeImag(constant.MakeFloat64(im)))
+}
+
+// checkOverflow reports an error if p is a constant of a sized
+// integer type, such as uint8, that its value does not fit in.
+// Unlike a variable, a constant does not wrap around.
+func (c *Checker) checkOverflow(p *partial) {
+	if p.mode != modeConst || isUntyped(p.typ) || !isInteger(p.typ) {
+		return
+	}
+	t, ok := tipe.Underlying(p.typ).(tipe.Basic)
+	if !ok || t == tipe.Integer {
+		return
+	}
+	if round(p.val, t) == nil {
+		c.errorf(p.expr, ConstOverflow, "constant %s overflows %s", p.val, format.Type(p.typ))
+		p.mode = modeInvalid
+	}
+}
+
+// maxConstShift limits the shift count of a constant shift.
+const maxConstShift = 1023
+
+// exprShift checks the shift e. The shift count must be a
+// non-negative integer, and the result has the type of the
+// shifted operand.
+func (c *Checker) exprShift(e *expr.Binary, left, right partial) partial {
+	left.expr = e
+	if !isInteger(left.typ) {
+		c.errorf(e.Left, UndefinedOp, "invalid operation: shifted operand %s (%s) must be integer", format.Expr(e.Left), format.Type(left.typ))
+		left.mode = modeInvalid
+		return left
+	}
+	if !isInteger(right.typ) {
+		c.errorf(e.Right, UndefinedOp, "invalid operation: shift count %s (%s) must be integer", format.Expr(e.Right), format.Type(right.typ))
+		left.mode = modeInvalid
+		return left
+	}
+	if right.mode == modeConst {
+		if constant.Sign(right.val) < 0 {
+			c.errorf(e.Right, InvalidShiftCount, "invalid operation: negative shift count %s", format.Expr(e.Right))
+			left.mode = modeInvalid
+			return left
+		}
+		if isUntyped(right.typ) {
+			c.constrainUntyped(&right, tipe.Uint)
+		}
+	}
+
+	if left.mode == modeConst && right.mode == modeConst {
+		s, ok := constant.Uint64Val(right.val)
+		if !ok || s > maxConstShift {
+			c.errorf(e.Right, InvalidShiftCount, "invalid operation: shift count %s too large", format.Expr(e.Right))
+			left.mode = modeInvalid
+			return left
+		}
+		left.val = constant.Shift(left.val, convGoOp(e.Op), uint(s))
+		c.checkOverflow(&left)
+		return left
+	}
+	if left.mode == modeConst {
+		c.constrainUntyped(&left, defaultType(left.typ))
+		left.mode = modeVar
+	}
+	return left
+}
+
+// maxConstPowBits limits the size of an integer constant power.
+const maxConstPowBits = 512
+
+// constPow computes the constant x ** y. Integer powers are exact,
+// all others are computed in float64 or complex128 precision.
+func constPow(x, y constant.Value, integer bool) (constant.Value, error) {
+	if integer {
+		x, y = constant.ToInt(x), constant.ToInt(y)
+		if constant.Sign(y) < 0 {
+			return nil, fmt.Errorf("negative exponent %s in integer constant power", y)
+		}
+		base, _ := new(big.Int).SetString(x.ExactString(), 10)
+		n, ok := constant.Int64Val(y)
+		if base.CmpAbs(big.NewInt(1)) > 0 && (!ok || int64(base.BitLen())*n > maxConstPowBits) {
+			return nil, fmt.Errorf("constant %s ** %s overflows", x, y)
+		}
+		return constant.Make(new(big.Int).Exp(base, big.NewInt(n), nil)), nil
+	}
+	if x.Kind() == constant.Complex || y.Kind() == constant.Complex {
+		if n, ok := constant.Int64Val(constant.ToInt(y)); ok && 0 <= n && n <= maxConstPowBits {
+			// Small integer exponent, keep the result exact.
+			z := constant.MakeInt64(1)
+			for i := int64(0); i < n; i++ {
+				z = constant.BinaryOp(z, gotoken.MUL, x)
+			}
+			return z, nil
+		}
+		xre, _ := constant.Float64Val(constant.ToFloat(constant.Real(x)))
+		xim, _ := constant.Float64Val(constant.ToFloat(constant.Imag(x)))
+		yre, _ := constant.Float64Val(constant.ToFloat(constant.Real(y)))
+		yim, _ := constant.Float64Val(constant.ToFloat(constant.Imag(y)))
+		z := cmplx.Pow(complex(xre, xim), complex(yre, yim))
+		if cmplx.IsInf(z) || cmplx.IsNaN(z) {
+			return nil, fmt.Errorf("constant %s ** %s is not a finite number", x, y)
+		}
+		return constant.BinaryOp(constant.MakeFloat64(real(z)), gotoken.ADD, constant.MakeImag(constant.MakeFloat64(imag(z)))), nil
+	}
+	xf, _ := constant.Float64Val(constant.ToFloat(x))
+	yf, _ := constant.Float64Val(constant.ToFloat(y))
+	z := math.Pow(xf, yf)
+	if math.IsInf(z, 0) || math.IsNaN(z) {
+		return nil, fmt.Errorf("constant %s ** %s is not a finite number", x, y)
+	}
+	return constant.MakeFloat64(z), nil
+}
+
 func (c *Checker) Add(s stmt.Stmt) tipe.Type {
 	return c.stmt(s, nil)
 }
@@ -2176,10 +3861,10 @@ type Scope struct {
 	Objs   map[string]*Obj
 
 	// foundInParent tracks variables which were found in the Parent scope.
-	// foundMdikInParent tracks any Methodik defined up the scope chain.
+	// foundMdikInParent tracks any Named type defined up the scope chain.
 	// These are used to build a list of free variables.
 	foundInParent     map[string]bool
-	foundMdikInParent map[*tipe.Methodik]bool
+	foundMdikInParent map[*tipe.Named]bool
 	// TODO: NumSpec tipe.Type?
 }
 
@@ -2198,7 +3883,7 @@ func (s *Scope) LookupRec(name string) *Obj {
 		s.foundInParent[name] = true
 	}
 	if s.foundMdikInParent != nil && o.Kind == ObjType {
-		if mdik, ok := o.Type.(*tipe.Methodik); ok {
+		if mdik, ok := o.Type.(*tipe.Named); ok {
 			s.foundMdikInParent[mdik] = true
 		}
 	}
@@ -2238,6 +3923,11 @@ type Obj struct {
 	Type tipe.Type
 	Decl interface{} // *expr.FuncLiteral, *stmt.MethodikDecl, constant.Value
 	Used bool
+
+	// ReadOnly is set on a variable that may be read but not
+	// assigned to or have its address taken, such as one bound
+	// read-only to a Go variable by the program embedding Neugram.
+	ReadOnly bool
 }
 
 func isTyped(t tipe.Type) bool {
@@ -2253,30 +3943,61 @@ func isUntyped(t tipe.Type) bool {
 	return false
 }
 
-func isComparable(t tipe.Type) bool {
-	switch t := tipe.Underlying(t).(type) {
-	case tipe.Basic:
-		return t != tipe.Invalid && t != tipe.UntypedNil
-	case *tipe.Chan, *tipe.Interface, *tipe.Pointer:
+func isInteger(t tipe.Type) bool {
+	switch tipe.Underlying(t) {
+	case tipe.Byte, tipe.Rune, tipe.Integer,
+		tipe.Int, tipe.Int8, tipe.Int16, tipe.Int32, tipe.Int64,
+		tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64, tipe.Uintptr,
+		tipe.UntypedInteger, tipe.UntypedRune:
 		return true
-	case *tipe.Struct:
-		for _, f := range t.Fields {
-			if !isComparable(f) {
-				return false
-			}
-		}
+	default:
+		return false
+	}
+}
+
+func isComplex(t tipe.Type) bool {
+	switch tipe.Underlying(t) {
+	case tipe.Complex, tipe.Complex64, tipe.Complex128, tipe.UntypedComplex:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNumeric(t tipe.Type) bool {
+	switch tipe.Underlying(t) {
+	case tipe.Num, tipe.Byte, tipe.Rune, tipe.Integer, tipe.Float, tipe.Complex,
+		tipe.Int, tipe.Int8, tipe.Int16, tipe.Int32, tipe.Int64,
+		tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64, tipe.Uintptr,
+		tipe.Float32, tipe.Float64, tipe.Complex64, tipe.Complex128,
+		tipe.UntypedInteger, tipe.UntypedRune, tipe.UntypedFloat, tipe.UntypedComplex:
 		return true
 	default:
 		return false
 	}
-	// TODO Array, Table
+}
+
+// unsignedBits reports the size of an unsigned integer type,
+// or 0 for any other type.
+func unsignedBits(t tipe.Type) uint {
+	switch tipe.Underlying(t) {
+	case tipe.Byte, tipe.Uint8:
+		return 8
+	case tipe.Uint16:
+		return 16
+	case tipe.Uint32:
+		return 32
+	case tipe.Uint, tipe.Uint64, tipe.Uintptr:
+		return 64
+	}
+	return 0
 }
 
 func isOrdered(t tipe.Type) bool {
 	switch tipe.Underlying(t) {
 	case tipe.Num, tipe.Byte, tipe.Rune, tipe.Integer, tipe.Float, tipe.Complex, tipe.String,
 		tipe.Int, tipe.Int8, tipe.Int16, tipe.Int32, tipe.Int64,
-		tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64,
+		tipe.Uint, tipe.Uint8, tipe.Uint16, tipe.Uint32, tipe.Uint64, tipe.Uintptr,
 		tipe.Float32, tipe.Float64,
 		tipe.UntypedInteger, tipe.UntypedFloat, tipe.UntypedComplex, tipe.UntypedString:
 		return true
@@ -2295,6 +4016,22 @@ func canBeNil(t tipe.Type) bool {
 	}
 }
 
+// untypedRank orders the untyped numeric kinds. When two untyped
+// constants are combined, the result has the kind of higher rank.
+func untypedRank(t tipe.Type) int {
+	switch t {
+	case tipe.UntypedInteger:
+		return 1
+	case tipe.UntypedRune:
+		return 2
+	case tipe.UntypedFloat:
+		return 3
+	case tipe.UntypedComplex:
+		return 4
+	}
+	return 0
+}
+
 func defaultType(t tipe.Type) tipe.Type {
 	b, ok := t.(tipe.Basic)
 	if !ok {
@@ -2305,10 +4042,14 @@ func defaultType(t tipe.Type) tipe.Type {
 		return tipe.Bool
 	case tipe.UntypedString:
 		return tipe.String
+	case tipe.UntypedRune:
+		return tipe.Rune
 	case tipe.UntypedInteger:
 		return tipe.Int // tipe.Num
 	case tipe.UntypedFloat:
 		return tipe.Float64 // tipe.Num
+	case tipe.UntypedComplex:
+		return tipe.Complex128
 	}
 	return t
 }
@@ -5,6 +5,7 @@
 package typecheck
 
 import (
+	"strings"
 	"testing"
 
 	"neugram.io/ng/stmt"
@@ -46,6 +47,47 @@ var typeTests = []typeTest{
 			{"z", tipe.Int64},
 		},
 	},
+	{
+		[]string{
+			"x := int64(-1)",
+			"s := string(x)",
+			"r := []rune(s)",
+			"t := string('a')",
+		},
+		[]identType{
+			{"x", tipe.Int64},
+			{"s", tipe.String},
+			{"r", &tipe.Slice{Elem: tipe.Rune}},
+			{"t", tipe.String},
+		},
+	},
+	{
+		[]string{
+			"r := 'a'",
+			"s := 'a' + 1",
+			"f := 1.5 + 1",
+		},
+		[]identType{
+			{"r", tipe.Rune},
+			{"s", tipe.Rune},
+			{"f", tipe.Float64},
+		},
+	},
+	{
+		[]string{
+			"c := 1 + 2i",
+			"r := real(c)",
+			"var f float32 = 1",
+			"d := complex(f, 2)",
+			"i := imag(d)",
+		},
+		[]identType{
+			{"c", tipe.Complex128},
+			{"r", tipe.Float64},
+			{"d", tipe.Complex64},
+			{"i", tipe.Float32},
+		},
+	},
 	{
 		[]string{
 			"x := 4 + 5 + 2",
@@ -89,7 +131,10 @@ var typeTests = []typeTest{
 			`b := a.X`,
 		},
 		[]identType{
-			{"a", &tipe.Struct{FieldNames: []string{"X"}, Fields: []tipe.Type{tipe.Float64}}},
+			{"a", &tipe.Named{
+				Name: "A",
+				Type: &tipe.Struct{FieldNames: []string{"X"}, Fields: []tipe.Type{tipe.Float64}},
+			}},
 			{"b", tipe.Float64},
 		},
 	},
@@ -97,7 +142,24 @@ var typeTests = []typeTest{
 		[]string{
 			`a := [|]int64{{|"Col1","Col2"|}, {1, 2}, {3, 4}}`,
 		},
-		[]identType{{"a", &tipe.Table{tipe.Int64}}},
+		[]identType{{"a", &tipe.Table{
+			Type: tipe.Int64,
+			Schema: &tipe.TableSchema{Columns: []tipe.Column{
+				{Name: "Col1"}, {Name: "Col2"},
+			}},
+		}}},
+	},
+	{
+		[]string{
+			`t := [|]float64{{|"a", "b"|}, {1, 2}}`,
+			`func mean(t [|"a"|]float64) float64 { return 0 }`,
+			`m := mean(t)`,
+			`var u [|]float64 = t`,
+		},
+		[]identType{
+			{"m", tipe.Float64},
+			{"u", &tipe.Table{Type: tipe.Float64}},
+		},
 	},
 	{
 		[]string{
@@ -157,7 +219,7 @@ var typeTests = []typeTest{
 			`m := b.M()`,
 		},
 		[]identType{
-			{"a", &tipe.Interface{Methods: map[string]*tipe.Func{
+			{"a", &tipe.Named{Name: "A", Type: &tipe.Interface{Methods: map[string]*tipe.Func{
 				"M": &tipe.Func{
 					Params:  &tipe.Tuple{},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tipe.Int64}},
@@ -170,16 +232,181 @@ var typeTests = []typeTest{
 						tipe.Int32, Universe.Objs["error"].Type,
 					}},
 				},
-			}}},
-			{"b", &tipe.Interface{Methods: map[string]*tipe.Func{
+			}}}},
+			{"b", &tipe.Named{Name: "B", Type: &tipe.Interface{Methods: map[string]*tipe.Func{
 				"M": &tipe.Func{
 					Params:  &tipe.Tuple{},
 					Results: &tipe.Tuple{Elems: []tipe.Type{tipe.Int64}},
 				},
-			}}},
+			}}}},
 			{"m", tipe.Int64},
 		},
 	},
+	{
+		[]string{
+			"a := [...]int64{1, 2, 3}",
+			"s := a[1:]",
+		},
+		[]identType{
+			{"a", &tipe.Array{Len: 3, Elem: tipe.Int64}},
+			{"s", &tipe.Slice{Elem: tipe.Int64}},
+		},
+	},
+	{
+		[]string{
+			`m := map[string]int64{"a": 1}`,
+			`v, ok := m["a"]`,
+		},
+		[]identType{
+			{"v", tipe.Int64},
+			{"ok", tipe.Bool},
+		},
+	},
+	{
+		[]string{
+			`methodik P struct{ X int64 } {
+				func (*p) Set(x int64) { p.X = x }
+				func (*p) Get() int64 { return p.X }
+			}
+			`,
+			`var p P`,
+			`p.Set(2)`,
+			`x := p.Get()`,
+			`q := &p`,
+			`y := q.Get()`,
+		},
+		[]identType{
+			{"x", tipe.Int64},
+			{"y", tipe.Int64},
+		},
+	},
+	{
+		[]string{
+			`methodik Meters float64 {
+				func (m) Feet() float64 { return float64(m) * 3.28084 }
+			}
+			`,
+			`var d Meters = 2`,
+			`f := d.Feet()`,
+			`type Feet float64`,
+			`g := Feet(d.Feet())`,
+		},
+		[]identType{
+			{"f", tipe.Float64},
+			{"g", &tipe.Named{Name: "Feet", Type: tipe.Float64}},
+		},
+	},
+	{
+		[]string{
+			`var rw interface {
+				Read([]byte) (int, error)
+				Write([]byte) (int, error)
+			}`,
+			`var r interface{ Read([]byte) (int, error) } = rw`,
+		},
+		[]identType{
+			{"r", &tipe.Interface{Methods: map[string]*tipe.Func{
+				"Read": &tipe.Func{
+					Params:  &tipe.Tuple{Elems: []tipe.Type{&tipe.Slice{Elem: tipe.Byte}}},
+					Results: &tipe.Tuple{Elems: []tipe.Type{tipe.Int, Universe.Objs["error"].Type}},
+				},
+			}}},
+		},
+	},
+	{
+		[]string{
+			`const x = 4`,
+			`var a int64 = x`,
+			`var b float64 = x`,
+			`var c integer = x`,
+			`var d int = 6.0`,
+			`e := x`,
+			`f := x / 3.0`,
+		},
+		[]identType{
+			{"a", tipe.Int64},
+			{"b", tipe.Float64},
+			{"c", tipe.Integer},
+			{"d", tipe.Int},
+			{"e", tipe.Int},
+			{"f", tipe.Float64},
+		},
+	},
+	{
+		[]string{
+			`const n = 2`,
+			`var a [n * 2]int`,
+			`const m = len(a) + len("s")`,
+			`var b [m]string`,
+		},
+		[]identType{
+			{"a", &tipe.Array{Len: 4, Elem: tipe.Int}},
+			{"b", &tipe.Array{Len: 5, Elem: tipe.String}},
+		},
+	},
+	{
+		[]string{
+			`x := "s"`,
+			`var i interface{} = 1`,
+			`n := 0`,
+			`switch x := 2; x {
+			case 1, 2:
+				n = x
+			}`,
+			`switch v := i.(type) {
+			case int:
+				n = v
+			case string:
+				x = v
+			}`,
+		},
+		[]identType{
+			{"x", tipe.String},
+			{"n", tipe.Int},
+		},
+	},
+	{
+		[]string{
+			`methodik node struct {
+				Val  int
+				Kids []*node
+			} {
+				func (n) First() *node { return n.Kids[0] }
+			}
+			`,
+			`var n node`,
+			`v := n.First().First().Val`,
+		},
+		[]identType{
+			{"v", tipe.Int},
+		},
+	},
+	{
+		[]string{`f := func(x int) { if x > 0 { return }; print(x) }`},
+		[]identType{
+			{"f", &tipe.Func{Params: &tipe.Tuple{Elems: []tipe.Type{tipe.Int}}}},
+		},
+	},
+	{
+		// Assignments follow Go's assignability, not identity.
+		[]string{
+			`type ints []int`,
+			`var s ints = []int{1}`,
+			`s = []int{2}`,
+			`type num int`,
+			`var n num = 3`,
+			`x := 4`,
+			`var i interface{}`,
+			`i = x`,
+			`var r <-chan int = make(chan int)`,
+			`var p *int = nil`,
+		},
+		[]identType{
+			{"x", tipe.Int},
+			{"r", &tipe.Chan{Direction: tipe.ChanRecv, Elem: tipe.Int}},
+			{"p", &tipe.Pointer{Elem: tipe.Int}},
+		},
+	},
 }
 
 func TestBasic(t *testing.T) {
@@ -218,3 +445,105 @@ func TestBasic(t *testing.T) {
 		}
 	}
 }
+
+var errorTests = []struct {
+	stmts []string
+	code  Code
+}{
+	{[]string{`x := y`}, UndeclaredName},
+	{[]string{`x := 1`, `y := "s"`, `x = y`}, Unassignable},
+	{[]string{`x := 1 + "s"`}, MismatchedTypes},
+	{[]string{`var x uint8 = 256`}, ConstOverflow},
+	{[]string{`x := 1 / 0`}, DivByZero},
+	{[]string{`f := func(int) {}`, `f(1, 2)`}, WrongArgCount},
+	{[]string{`var s interface{ String() string } = 1`}, Unassignable},
+	{[]string{`type T struct{ A [2]struct{ B T } }`}, InvalidCycle},
+	{[]string{`var n = 2`, `var a [n]int`}, InvalidArrayLen},
+	{[]string{`var a [1.5]int`}, InvalidArrayLen},
+	{[]string{`type P struct { X int }`, `var a [P{X: 1}.X]int`}, InvalidArrayLen},
+	{[]string{`var a [[]int{1}[0]]int`}, InvalidArrayLen},
+	{[]string{`var t [|"a", "a"|]int`}, InvalidTableSchema},
+	{[]string{`t := [|"a"|]int{{|"b"|}, {1}}`}, InvalidTableSchema},
+	{[]string{`var t [|"a"|]int = [|]int{{|"b"|}, {1}}`}, Unassignable},
+	{[]string{`defer print()`}, InvalidDefer},
+	{[]string{`ch := make(chan int)`, `for k, v := range ch {}`}, InvalidChanOp},
+	{[]string{`var ch chan<- int`, `for v := range ch {}`}, InvalidChanOp},
+	{[]string{`ch := make(chan int)`, `var x int8`, `ch <- x`}, InvalidChanOp},
+	{[]string{`f := func() { recover(1) }`}, WrongArgCount},
+	{[]string{`s := make([]int)`}, WrongArgCount},
+	{[]string{`m := map[string]int{}`, `n := cap(m)`}, InvalidArgument},
+	{[]string{`s := []int{}`, `t := []string{}`, `n := copy(s, t)`}, InvalidArgument},
+	{[]string{`x := len(1)`}, InvalidArgument},
+	{[]string{`printf()`}, WrongArgCount},
+	{[]string{`print(print())`}, NoValue},
+	{[]string{`f := func() int { return }`}, AssignMismatch},
+	{[]string{`f := func() { return 1 }`}, AssignMismatch},
+	{[]string{`s := "abc"`, `s[0] = 'x'`}, NotAssignable},
+	{[]string{`s := "abc"`, `s[1:] = "x"`}, NotAssignable},
+	{[]string{`s := "abc"`, `s[0]++`}, NotAssignable},
+	{[]string{`s := "abc"`, `var i int`, `for i, s[0] = range []byte{1} {}`}, NotAssignable},
+	{[]string{`type num int`, `var n num`, `var x int = n`}, Unassignable},
+	{[]string{`type ints []int`, `type other []int`, `var s ints`, `var o other = s`}, Unassignable},
+	{[]string{`x := 1`, `var s interface{ String() string }`, `s = x`}, Unassignable},
+	{[]string{`var r <-chan int`, `var ch chan int = r`}, Unassignable},
+	{[]string{`var b bool = 1`}, InvalidConversion},
+}
+
+func TestErrorCodes(t *testing.T) {
+	for _, test := range errorTests {
+		c := New("")
+		for _, str := range test.stmts {
+			s, err := parser.ParseStmt([]byte(str))
+			if err != nil {
+				t.Fatalf("parser.ParseStmt(%q): %v", str, err)
+			}
+			c.Add(s)
+		}
+		if len(c.Errs) == 0 {
+			t.Errorf("%q: no error, want %s", test.stmts, test.code)
+			continue
+		}
+		err := c.Errs[0]
+		if err.Code != test.code {
+			t.Errorf("%q: %v, want code %s", test.stmts, err, test.code)
+		}
+		if !strings.HasPrefix(err.Error(), test.code.String()+": ") {
+			t.Errorf("%q: Error() = %q, want %s prefix", test.stmts, err.Error(), test.code)
+		}
+	}
+}
+
+var errorPosTests = []struct {
+	src string
+	pos string // position of the first error
+}{
+	{"x := y", "pos.ng:1:6"},
+	{"a := 1\nx := a + \"s\"", "pos.ng:2:10"},
+	{"x := 1\ny := \"s\"\nx = y", "pos.ng:3:5"},
+	{"var x uint8 = 256", "pos.ng:1:15"},
+	{"x := 7 / 0", "pos.ng:1:10"},
+	{"var t T", "pos.ng:1:7"},
+	{"f := func() int {\n\treturn \"s\"\n}", "pos.ng:2:9"},
+	{"f := func(x, y int) {}\nf(1, \"s\")", "pos.ng:2:6"},
+	{"defer print()", "pos.ng:1:1"},
+}
+
+func TestErrorPositions(t *testing.T) {
+	for _, test := range errorPosTests {
+		c := New("")
+		f, err := parser.ParseFile(c.Fset, "pos.ng", []byte(test.src), 0)
+		if err != nil {
+			t.Fatalf("parser.ParseFile(%q): %v", test.src, err)
+		}
+		for _, s := range f.Stmts {
+			c.Add(s)
+		}
+		if len(c.Errs) == 0 {
+			t.Errorf("%q: no error, want one at %s", test.src, test.pos)
+			continue
+		}
+		if got := c.Errs[0].Pos.String(); got != test.pos {
+			t.Errorf("%q: error %v at %s, want %s", test.src, c.Errs[0], got, test.pos)
+		}
+	}
+}